@@ -47,7 +47,7 @@
             inherit version;
 
             src = ./src/images;
-            vendorHash = "sha256-cukmtsu303EagzwSIF/ptIfEmO9bzsT0Y1+SOiNa+6M=";
+            vendorHash = "sha256-shBknT/3NfYdT/tIJ131D3k0jnJrUlZ+C3y/bkOv6bA=";
           };
 
           catlibrary = pkgs.callPackage ./src/catlibrary {};
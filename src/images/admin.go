@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/bans"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+var (
+	adminPassword = flag.String("admin-password", "", "let a client that types 'admin PASSWORD' ban, unban and kick (admin commands are off if unset)")
+	bansFile      = flag.String("bans-file", "", "keep bans in this JSON file across restarts (in memory only if unset)")
+	adminIP       = flag.String("admin-ip", "127.0.0.1", "address an admin has to connect from to use 'broadcast'")
+)
+
+var banlist *bans.Store
+
+func open_bans() {
+	s, err := bans.Open(*bansFile, time.Now())
+	if err != nil {
+		log.Fatalf("bans: %v", err)
+	}
+	banlist = s
+}
+
+// connected lists every open connection, so an admin can find one to
+// kick.
+var connected = struct {
+	sync.Mutex
+	all map[int64]*session
+}{all: map[int64]*session{}}
+
+func track_session(sess *session) func() {
+	connected.Lock()
+	connected.all[sess.id] = sess
+	connected.Unlock()
+
+	return func() {
+		connected.Lock()
+		delete(connected.all, sess.id)
+		connected.Unlock()
+	}
+}
+
+// remote_addr is the address conn comes from, or the zero Addr if it
+// isn't an IP connection.
+func remote_addr(conn net.Conn) netip.Addr {
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return ap.Addr().Unmap()
+}
+
+// turn_away closes conn, with a word why, if its address is banned. It's
+// checked before the connection gets a session, or any of the server's
+// attention.
+func turn_away(conn net.Conn) bool {
+	if !banned(remote_addr(conn)) {
+		return false
+	}
+	go func() {
+		conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+		send(conn, "You're banned from this server.\n")
+		conn.Close()
+	}()
+	return true
+}
+
+// banned reports whether addr is banned, and logs that it was refused if
+// so.
+func banned(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	b, ok := banlist.Check(addr, time.Now())
+	if ok {
+		log.Printf("refused %s: banned as %s", addr, b.Net)
+	}
+	return ok
+}
+
+// disconnect sends sess off with msg. The write is given a deadline, so a
+// client that has stopped reading can't hold up the admin.
+func disconnect(sess *session, msg string) {
+	sess.conn.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	send(sess.conn, msg)
+	sess.conn.Close()
+}
+
+// admin_name describes who sess is, for the audit log.
+func admin_name(sess *session) string {
+	return fmt.Sprintf("conn %d (%s) from %s", sess.id, player_name(sess, "no nick"), remote_addr(sess.conn))
+}
+
+// admin_command handles "admin PASSWORD", which unlocks ban, unban, bans,
+// kick, policy, announce and job for the rest of the connection.
+func admin_command(sess *session, line string) string {
+	given := strings.TrimSpace(strings.TrimPrefix(line, "admin"))
+	switch {
+	case *adminPassword == "":
+		return "Admin commands are off on this server.\n"
+	case sess.admin:
+		return "You're already an admin.\n"
+	case given == "":
+		return "Usage: admin PASSWORD\n"
+	}
+
+	if subtle.ConstantTimeCompare([]byte(given), []byte(*adminPassword)) != 1 {
+		log.Printf("audit: %s gave the wrong admin password", admin_name(sess))
+
+		// Guessing takes a second a try.
+		time.Sleep(time.Second)
+		return "Wrong password.\n"
+	}
+
+	sess.admin = true
+	log.Printf("audit: %s logged in as admin", admin_name(sess))
+	return "You're an admin now: ban, unban, bans, kick, policy, announce and job are yours.\n"
+}
+
+// admin_only lets only admins use handler.
+func admin_only(handler func(*session, string) string) command_handler {
+	return quick(func(sess *session, line string) string {
+		if !sess.admin {
+			return "That's an admin command; 'admin PASSWORD' first.\n"
+		}
+		return handler(sess, line)
+	})
+}
+
+// ban_duration reads a duration like "90m", "12h" or "7d".
+func ban_duration(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// ban_command handles "ban IP|CIDR [DURATION] [REASON]". Without a
+// duration the ban is for good. Anyone connected from the range is sent
+// off straight away.
+func ban_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "ban"))
+	if len(args) == 0 {
+		return "Usage: ban IP|CIDR [DURATION, like 30m, 12h or 7d] [REASON]\n"
+	}
+
+	p, err := bans.ParseTarget(args[0])
+	if err != nil {
+		return fmt.Sprintf("Can't ban %s: %v.\n", args[0], err)
+	}
+	if p.Contains(remote_addr(sess.conn)) {
+		return "That would ban you too.\n"
+	}
+
+	now := time.Now()
+	b := bans.Ban{Net: p, By: admin_name(sess), When: now}
+	args = args[1:]
+	if len(args) > 0 {
+		if d, ok := ban_duration(args[0]); ok {
+			b.Until = now.Add(d)
+			args = args[1:]
+		}
+	}
+	b.Reason = usertext.Clean(strings.Join(args, " "))
+
+	if err := banlist.Add(b); err != nil {
+		log.Printf("bans: %v", err)
+		return "Banned, but the ban couldn't be saved, so it won't survive a restart.\n"
+	}
+	log.Printf("audit: %s banned %s %s: %s", b.By, p, ban_length(b, now), or_none(b.Reason))
+
+	kicked := 0
+	connected.Lock()
+	for _, s := range connected.all {
+		if p.Contains(remote_addr(s.conn)) {
+			go disconnect(s, "You've been banned from this server.\n")
+			kicked++
+		}
+	}
+	connected.Unlock()
+
+	return fmt.Sprintf("Banned %s %s; %s disconnected.\n", p, ban_length(b, now), plural(kicked, "connection"))
+}
+
+// ban_length says how long b has left, as in "for 2h0m0s" or "for good".
+func ban_length(b bans.Ban, now time.Time) string {
+	if b.Until.IsZero() {
+		return "for good"
+	}
+	return "for " + b.Until.Sub(now).Round(time.Second).String()
+}
+
+func or_none(reason string) string {
+	if reason == "" {
+		return "no reason given"
+	}
+	return reason
+}
+
+// unban_command handles "unban IP|CIDR", which lifts the ban on exactly
+// that address or range.
+func unban_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "unban"))
+	if arg == "" {
+		return "Usage: unban IP|CIDR\n"
+	}
+
+	p, err := bans.ParseTarget(arg)
+	if err != nil {
+		return fmt.Sprintf("Can't unban %s: %v.\n", arg, err)
+	}
+
+	ok, err := banlist.Remove(p)
+	if !ok {
+		if b, banned := banlist.Check(p.Addr(), time.Now()); banned {
+			return fmt.Sprintf("%s isn't banned itself, but falls under the ban on %s.\n", p, b.Net)
+		}
+		return fmt.Sprintf("%s isn't banned.\n", p)
+	}
+	if err != nil {
+		log.Printf("bans: %v", err)
+	}
+	log.Printf("audit: %s unbanned %s", admin_name(sess), p)
+	return fmt.Sprintf("Unbanned %s.\n", p)
+}
+
+// bans_command handles "bans".
+func bans_command(*session, string) string {
+	now := time.Now()
+	list, err := banlist.List(now)
+	if err != nil {
+		log.Printf("bans: %v", err)
+	}
+	if len(list) == 0 {
+		return "Nobody is banned.\n"
+	}
+
+	var b strings.Builder
+	for _, ban := range list {
+		fmt.Fprintf(&b, "%-20s %-16s by %s: %s\n", ban.Net, ban_length(ban, now), ban.By, or_none(ban.Reason))
+	}
+	return b.String()
+}
+
+// kick_command handles "kick NICK|CONN-ID". Everyone by that nickname is
+// kicked; they can connect again, unlike after a ban.
+func kick_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "kick"))
+	if arg == "" {
+		return "Usage: kick NICK|CONN-ID\n"
+	}
+	id, err := strconv.ParseInt(arg, 10, 64)
+	by_id := err == nil
+
+	var targets []*session
+	connected.Lock()
+	for _, s := range connected.all {
+		if by_id && s.id == id || !by_id && s.nick == arg {
+			targets = append(targets, s)
+		}
+	}
+	connected.Unlock()
+
+	if len(targets) == 0 {
+		return fmt.Sprintf("Nobody connected is %s.\n", arg)
+	}
+	for _, s := range targets {
+		if s == sess {
+			return "You can't kick yourself.\n"
+		}
+	}
+
+	for _, s := range targets {
+		log.Printf("audit: %s kicked %s", admin_name(sess), admin_name(s))
+		go disconnect(s, "You've been disconnected by an admin.\n")
+	}
+	return fmt.Sprintf("Kicked %s.\n", plural(len(targets), "connection"))
+}
+
+// broadcast_command handles "broadcast MESSAGE", which writes MESSAGE to
+// every connection straight away, whatever it's doing, rather than
+// waiting for the prompt as announce does. Only an admin connecting from
+// -admin-ip can: behind a reverse proxy, WebSocket and SSH clients, and
+// anyone else, may well all come from 127.0.0.1. Connections that have
+// gone are skipped without a word.
+func broadcast_command(sess *session, line string) string {
+	if remote_addr(sess.conn) != netip.MustParseAddr(*adminIP) {
+		return "Only a connection from the server's admin address can broadcast.\n"
+	}
+	text := usertext.Clean(strings.TrimSpace(strings.TrimPrefix(line, "broadcast")))
+	if text == "" {
+		return "Usage: broadcast MESSAGE\n"
+	}
+
+	connected.Lock()
+	targets := make([]*session, 0, len(connected.all))
+	for _, s := range connected.all {
+		targets = append(targets, s)
+	}
+	connected.Unlock()
+
+	log.Printf("audit: %s broadcast %q", admin_name(sess), text)
+	msg := "\033[1m[Server]: " + text + "\033[0m\n"
+	for _, s := range targets {
+		// Each connection's writes are kept whole by its pacer, and a
+		// client that has stopped reading is given up on after two
+		// seconds of trying.
+		go s.send_by(msg, time.Now().Add(2*time.Second))
+	}
+	return fmt.Sprintf("Broadcast to %s.\n", plural(len(targets), "connection"))
+}
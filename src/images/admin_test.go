@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopback_session is a session on a real connection from 127.0.0.1.
+func loopback_session(t *testing.T) *session {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return new_session(server)
+}
+
+func TestBroadcastNeedsAdmin(t *testing.T) {
+	sess := loopback_session(t)
+
+	// A proxied client comes from the admin address too.
+	got, _ := commands.Dispatch(sess, "broadcast hello")
+	if !strings.Contains(got, "admin command") {
+		t.Errorf("a non-admin on 127.0.0.1 broadcasting got %q", got)
+	}
+
+	sess.admin = true
+	if got, _ := commands.Dispatch(sess, "broadcast"); got != "Usage: broadcast MESSAGE\n" {
+		t.Errorf("an admin on 127.0.0.1 got %q", got)
+	}
+
+	remote := test_session(t)
+	remote.admin = true
+	if got, _ := commands.Dispatch(remote, "broadcast hello"); !strings.Contains(got, "admin address") {
+		t.Errorf("an admin elsewhere broadcasting got %q", got)
+	}
+}
+
+// A broadcast to a client that has stopped reading gives up, and leaves
+// the connection's own writes without a deadline.
+func TestSendByGivesUp(t *testing.T) {
+	sess := test_session(t)
+	if err := sess.send_by("hello", time.Now().Add(50*time.Millisecond)); err == nil {
+		t.Fatal("nobody read the write, but it didn't time out")
+	}
+
+	done := make(chan error)
+	go func() { done <- sess.send("later") }()
+	select {
+	case err := <-done:
+		t.Fatalf("an ordinary write ended by itself: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	sess.conn.Close()
+	<-done
+}
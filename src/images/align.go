@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// aligns are the ways a render narrower than the session width can sit
+// within it.
+var aligns = map[string]bool{"left": true, "center": true, "right": true}
+
+// align_command handles "align left|center|right" and its shorthand,
+// "center".
+func align_command(sess *session, line string) string {
+	if line == "center" {
+		line = "align center"
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(line, "align"))
+	if !aligns[name] {
+		return fmt.Sprintf("Usage: align left|center|right (currently %s)\n", sess.align)
+	}
+
+	sess.align = name
+	return fmt.Sprintf("Images will be aligned %s.\n", name)
+}
+
+// align_padding returns the spaces that go before each row of a render
+// width columns wide.
+func align_padding(sess *session, width int) string {
+	spare := max(sess.width-width, 0)
+	switch sess.align {
+	case "center":
+		return strings.Repeat(" ", spare/2)
+	case "right":
+		return strings.Repeat(" ", spare)
+	}
+	return ""
+}
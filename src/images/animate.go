@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/ansi"
+)
+
+// Animations draw a frame no more often than this, however fast they
+// move; a faster one moves further each frame instead.
+const animation_frame = 50 * time.Millisecond
+
+// animate draws frames from draw in place, below a header naming title,
+// once every frame. draw is given how long the animation has been
+// running rather than how many frames it's drawn, so a slow connection
+// drops frames instead of slowing it down. On a throttled connection a
+// frame takes as long as it takes to send before the next is drawn, so
+// the frame rate falls to what the throttle allows rather than frames
+// queueing up, and frames over the session's maxfps are skipped the
+// same way. It stops at a key, when the connection goes or after d, if d
+// isn't 0, and leaves the cursor below the last frame.
+func animate(sess *session, title string, frame, d time.Duration, draw func(elapsed time.Duration) []string) (string, error) {
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(clearScreen + hideCursor)
+	defer sess.send(resetAttrs + showCursor)
+
+	ticker := time.NewTicker(max(frame, animation_frame))
+	defer ticker.Stop()
+	var done <-chan time.Time
+	if d > 0 {
+		done = time.After(d)
+	}
+
+	header := animation_header(title)
+	start := time.Now()
+	for {
+		if sess.frame_now() {
+			if err := sess.send(animation_frame_text(sess, header, draw(time.Since(start)))); err != nil {
+				return "", err
+			}
+		}
+
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return title + " stopped.\n", nil
+		case <-done:
+			return title + " over.\n", nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func animation_header(title string) string {
+	return "\033[1m" + title + "\033[0m   press any key to stop" + clearLine + "\n\n"
+}
+
+// animation_frame_text is a frame of rows, each ending in an attribute
+// reset, to draw over the last one from the top of the screen. Every
+// frame starts from a reset, so each can be compacted on its own.
+func animation_frame_text(sess *session, header string, rows []string) string {
+	var compactor ansi.Compactor
+	var b strings.Builder
+	b.WriteString(cursorHome + header)
+	for _, row := range rows {
+		if !sess.raw_output {
+			row = compactor.Line(row)
+		}
+		b.WriteString(row + clearLine + "\n")
+	}
+	return b.String()
+}
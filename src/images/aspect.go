@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Most terminal fonts are about twice as tall as they're wide.
+	default_aspect = 2.0
+	min_aspect     = 0.5
+	max_aspect     = 4.0
+
+	// aspect_wait is how long aspect-ratio auto waits for the terminal
+	// to answer, which it does within milliseconds if it's going to.
+	aspect_wait = 500 * time.Millisecond
+)
+
+// report_numbers reads the numbers in a report, as in "4;600;800".
+func report_numbers(report *string, n int) ([]int, bool) {
+	if report == nil {
+		return nil, false
+	}
+	fields := strings.Split(*report, ";")
+	if len(fields) != n {
+		return nil, false
+	}
+	out := make([]int, n)
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil || v <= 0 {
+			return nil, false
+		}
+		out[i] = v
+	}
+	return out, true
+}
+
+// measure_aspect asks the terminal how tall its cells are for how wide.
+// Moving the cursor as far down and right as it goes and asking where it
+// is gives the size in cells; CSI 14 t asks for the size of the text
+// area in pixels. ok is false if the terminal didn't answer both, or
+// answered something that makes no sense.
+func measure_aspect(sess *session) (aspect float64, ok bool) {
+	in := sess.input
+	in.cpr.Store(nil)
+	in.text_px.Store(nil)
+	in.reports.Store(true)
+	sess.send("\0337\033[999;999H\033[6n\0338\033[14t")
+
+	// Answers are taken out of the input as they're read, so they have
+	// to be read for; anything else coming in means someone's typing,
+	// and the wait is over.
+	deadline := time.Now().Add(aspect_wait)
+	for time.Now().Before(deadline) && (in.cpr.Load() == nil || in.text_px.Load() == nil) {
+		if sess.reader.Buffered() > 0 {
+			break
+		}
+		sess.conn.SetReadDeadline(min_time(deadline, time.Now().Add(probe_step)))
+		if _, err := sess.reader.Peek(1); !errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+	}
+	sess.conn.SetReadDeadline(time.Time{})
+
+	cells, ok1 := report_numbers(in.cpr.Load(), 2)
+	px, ok2 := report_numbers(in.text_px.Load(), 3)
+	if !ok1 || !ok2 || px[0] != 4 {
+		return 0, false
+	}
+	aspect = (float64(px[1]) / float64(cells[0])) / (float64(px[2]) / float64(cells[1]))
+	return aspect, aspect >= min_aspect && aspect <= max_aspect
+}
+
+func aspect_status(sess *session) string {
+	return fmt.Sprintf("%.2f (cells are %.2f times as tall as they're wide)", sess.aspect, sess.aspect)
+}
+
+// aspect_ratio_command handles "aspect-ratio N", how many times taller
+// than wide the client's terminal cells are, which sets how many rows an
+// image takes, and "aspect-ratio auto", which asks the terminal.
+func aspect_ratio_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "aspect-ratio"))
+	switch arg {
+	case "":
+		return "Aspect ratio: " + aspect_status(sess) + "\n"
+	case "auto":
+		aspect, ok := measure_aspect(sess)
+		if !ok {
+			sess.aspect = default_aspect
+			return fmt.Sprintf("Your terminal didn't say how big its cells are, so the aspect ratio is %g, which suits most fonts.\n", default_aspect)
+		}
+		sess.aspect = aspect
+		return "Aspect ratio measured: " + aspect_status(sess) + "\n"
+	}
+
+	n, err := strconv.ParseFloat(arg, 64)
+	if err != nil || !(n >= min_aspect && n <= max_aspect) {
+		return fmt.Sprintf("Usage: aspect-ratio auto, or aspect-ratio N, with N from %g to %g.\n", min_aspect, max_aspect)
+	}
+	sess.aspect = n
+	return "Aspect ratio: " + aspect_status(sess) + "\n"
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const (
+	// An image less saturated than gray_saturation on average is as
+	// good as gray, and is drawn in bw; one less than muted_saturation
+	// loses little kept to 256 colors.
+	gray_saturation  = 0.1
+	muted_saturation = 0.4
+
+	// An image whose neighbouring pixels differ in lightness by less
+	// than smooth_step (root mean square), but which spans at least
+	// gradient_range overall (standard deviation), is a smooth gradient
+	// that would show bands in 256 colors, so it's dithered.
+	smooth_step    = 0.03
+	gradient_range = 0.05
+
+	// auto_palette_samples is about how many pixels are looked at.
+	auto_palette_samples = 1 << 16
+)
+
+// mean_saturation is the average HSV saturation of img's pixels, from an
+// even grid of about auto_palette_samples of them. Fully transparent
+// pixels don't count.
+func mean_saturation(img image.Image) float64 {
+	b := img.Bounds()
+	step := max(int(math.Sqrt(float64(b.Dx())*float64(b.Dy())/auto_palette_samples)), 1)
+
+	sum, n := 0.0, 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			_, s, _ := colorspace.RGBToHSV(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+			sum += s
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// smooth_gradient reports whether img's lightness changes little from
+// one pixel to the next but a good deal across the whole, judged from
+// the same sort of grid as mean_saturation.
+func smooth_gradient(img image.Image) bool {
+	b := img.Bounds()
+	step := max(int(math.Sqrt(float64(b.Dx())*float64(b.Dy())/auto_palette_samples)), 1)
+
+	var sum, sum_sq, steps float64
+	n, m := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		prev := -1.0
+		for x := b.Min.X; x < b.Max.X; x += step {
+			l := luma255(img.At(x, y)) / 255
+			sum += l
+			sum_sq += l * l
+			n++
+			if prev >= 0 {
+				steps += (l - prev) * (l - prev)
+				m++
+			}
+			prev = l
+		}
+	}
+	if m == 0 {
+		return false
+	}
+
+	mean := sum / float64(n)
+	spread := math.Sqrt(max(sum_sq/float64(n)-mean*mean, 0))
+	return math.Sqrt(steps/float64(m)) < smooth_step && spread >= gradient_range
+}
+
+// auto_palette switches sess to the mode that suits img: bw for a gray
+// image, color for the rest, with a muted one reduced to 256 colors,
+// dithered if it's a smooth gradient, which is handed back. The line
+// that comes with it says what was picked.
+func auto_palette(sess *session, img image.Image) (image.Image, string) {
+	sat := mean_saturation(img)
+	mode, picked, dither := "color", "color", false
+	switch {
+	case sat < gray_saturation:
+		mode, picked = "bw", "bw"
+	case sat < muted_saturation:
+		picked = "color, in 256 colors"
+		if smooth_gradient(img) {
+			picked, dither = picked+", dithered", true
+		}
+	}
+
+	if !sess.set_mode(mode) {
+		return img, fmt.Sprintf("Auto-palette would pick %s (saturation: %.2f), but the server keeps everyone in %s.\n", picked, sat, *lockMode)
+	}
+	switch {
+	case dither:
+		img = apply_dithered_color_reduce(img, max_color_reduce)
+	case picked != mode:
+		img = apply_color_reduce(img, max_color_reduce)
+	}
+	return img, fmt.Sprintf("Auto-selected: %s (saturation: %.2f)\n", picked, sat)
+}
+
+// auto_palette_command handles "auto-palette", which turns it on and off.
+func auto_palette_command(sess *session, _ string) string {
+	sess.auto_palette = !sess.auto_palette
+	if sess.auto_palette {
+		return "Auto palette on: each image pasted is drawn in bw, 256 colors (dithered for smooth gradients) or full color, by how colorful it is.\n"
+	}
+	return "Auto palette off. The mode stays as it was last picked.\n"
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// muted is a color of saturation 0.25 and value v.
+func muted(v int) color.NRGBA {
+	return color.NRGBA{uint8(v), uint8(v * 3 / 4), uint8(v * 3 / 4), 255}
+}
+
+func TestAutoPaletteDithersGradients(t *testing.T) {
+	gradient := image.NewNRGBA(image.Rect(0, 0, 256, 32))
+	noisy := image.NewNRGBA(gradient.Bounds())
+	rng := rand.New(rand.NewSource(1))
+	for y := range 32 {
+		for x := range 256 {
+			gradient.SetNRGBA(x, y, muted(40+x*200/256))
+			noisy.SetNRGBA(x, y, muted(40+rng.Intn(200)))
+		}
+	}
+
+	for _, c := range []struct {
+		name   string
+		img    image.Image
+		dither bool
+	}{{"gradient", gradient, true}, {"noise", noisy, false}} {
+		_, picked := auto_palette(test_session(t), c.img)
+		if !strings.HasPrefix(picked, "Auto-selected: color, in 256 colors") {
+			t.Fatalf("%s: %q", c.name, picked)
+		}
+		if got := strings.Contains(picked, "dithered"); got != c.dither {
+			t.Errorf("%s: %q", c.name, picked)
+		}
+	}
+}
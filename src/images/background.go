@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// apply_background lays img over the session's background image,
+// stretched to img's size, so the background shows wherever img is
+// transparent. An opaque img comes out as it went in.
+func apply_background(img image.Image, bg image.Image) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	xdraw.BiLinear.Scale(out, b, bg, bg.Bounds(), xdraw.Src, nil)
+	draw.Draw(out, b, img, b.Min, draw.Over)
+	return out
+}
+
+// background_command handles "background-image URL" and
+// "background-image off".
+func background_command(sess *session, line string) (string, error) {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "background-image"))
+	switch arg {
+	case "":
+		if sess.background == nil {
+			return "Background image: off. Use 'background-image URL' to put transparent images over one.\n", nil
+		}
+		return "Background image: " + sess.background_url + "\n", nil
+	case "off":
+		sess.background, sess.background_url = nil, ""
+		return "Background image off.\n", nil
+	}
+
+	stop := watch_hangup(sess)
+	img, err := fetch_image(sess, arg, sess.max_pixels)
+	stop()
+
+	var big *fetch.TooLargeError
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ". Use 'info' to check dimensions first.\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
+	if err != nil {
+		return "Couldn't load that image: " + err.Error() + ".\n", nil
+	}
+
+	sess.background, sess.background_url = normalizeImage(img), arg
+	return "Background image set: transparent images are drawn over it from now on.\n", nil
+}
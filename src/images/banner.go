@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var bannerPath = flag.String("banner", "", "file shown to every client when it connects; re-read on SIGHUP")
+
+// banner holds the current banner as a []byte. Each connection loads it
+// once, so a reload only affects connections made after it.
+var banner atomic.Value
+
+func init() {
+	banner.Store([]byte(nil))
+}
+
+func load_banner() error {
+	data, err := os.ReadFile(*bannerPath)
+	if err != nil {
+		return err
+	}
+
+	banner.Store(data)
+	return nil
+}
+
+// reload_banner re-reads the banner whenever the process gets SIGHUP. A
+// file that can't be read leaves the old banner in place.
+func reload_banner() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		if err := load_banner(); err != nil {
+			log.Printf("banner: keeping the old one: %v", err)
+			continue
+		}
+		log.Printf("banner: reloaded %s", *bannerPath)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// benchmark_command handles "benchmark N URL": the image is fetched once
+// and rendered N times with the session's settings, and only the timings
+// are sent back.
+func benchmark_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "benchmark"))
+	if len(args) != 2 {
+		return "Usage: benchmark N URL, with N from 1 to 100.\n"
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > 100 {
+		return "Usage: benchmark N URL, with N from 1 to 100.\n"
+	}
+
+	sess.last_url = args[1]
+	img, err := fetch_image(sess, args[1], sess.max_pixels)
+	if err != nil {
+		return fmt.Sprintf("Couldn't fetch the image: %v\n", err)
+	}
+	img = preprocess(img, sess)
+
+	var out string
+	start := time.Now()
+	for range n {
+		out = compress(img, 1, sess)
+	}
+	total := time.Since(start)
+
+	// Each character of the render comes from one sampled pixel.
+	pixels := strings.Count(out, "\n") * render_width(img, sess)
+	per := total / time.Duration(n)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "renders:    %d at %d columns (%s)\n", n, sess.width, sess.mode)
+	fmt.Fprintf(&b, "total:      %s\n", total.Round(time.Microsecond))
+	fmt.Fprintf(&b, "per render: %s\n", per.Round(time.Microsecond))
+	fmt.Fprintf(&b, "pixels/s:   %.0f (%d per render)\n", float64(pixels*n)/total.Seconds(), pixels)
+	fmt.Fprintf(&b, "output:     %d bytes per render\n", len(out))
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// binary_max_bytes is the biggest file 'binary' takes.
+const binary_max_bytes = 32 << 20
+
+// binary_size is the size a line after "binary" gives, if it's one that
+// will be read.
+func binary_size(line string) (int, bool) {
+	n, err := strconv.Atoi(line)
+	if err != nil || n < 1 || n > binary_max_bytes {
+		return 0, false
+	}
+	return n, true
+}
+
+// binary_command handles "binary", after which the client sends the
+// size of an image file in bytes on a line of its own, and then the
+// file, which is rendered as if it had been fetched. It's for piping
+// files in, which as lines would be cut up at any byte that happens to
+// be a newline:
+//
+//	(echo binary; wc -c < cat.png; cat cat.png) | nc server 5173
+//
+// The input filter lets the file through without looking for telnet
+// negotiation in it; see note_line.
+func binary_command(sess *session, _ string) (string, error) {
+	line, err := sess.readLine()
+	if err != nil {
+		return "", err
+	}
+	size, ok := binary_size(line)
+	if !ok {
+		return fmt.Sprintf("Usage: binary, then the file's size from 1 to %d bytes on a line of its own, then the file.\n", binary_max_bytes), nil
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(sess.reader, data); err != nil {
+		return "", err
+	}
+
+	img, _, err := fetch.Decode(fetch.WithMaxPixels(fetching_for(sess), sess.max_pixels), bytes.NewReader(data))
+	var big *fetch.TooLargeError
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ".\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't decode that file: %v.\n", err), nil
+	}
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(preprocess(img, sess), 1, sess)
+	return sess.last_render, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/ansi"
+	"github.com/atalii/image-server-thing/internal/canvas"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+// A border_style is what a border is drawn with: the four corners, from
+// the top left round to the bottom left, then the top and bottom edges
+// and the sides.
+type border_style struct {
+	corners    [4]string
+	edge, side string
+}
+
+var border_styles = map[string]border_style{
+	"single":  {[4]string{"┌", "┐", "┘", "└"}, "─", "│"},
+	"double":  {[4]string{"╔", "╗", "╝", "╚"}, "═", "║"},
+	"rounded": {[4]string{"╭", "╮", "╯", "╰"}, "─", "│"},
+	"hash":    {[4]string{"#", "#", "#", "#"}, "#", "#"},
+}
+
+const border_usage = "Usage: border none|single|double|rounded|hash [#RRGGBB|default], or border color #RRGGBB|default.\n"
+
+// border_inset is how many columns, and rows, the session's border takes
+// out of a render.
+func border_inset(sess *session) int {
+	if sess.border == "none" {
+		return 0
+	}
+	return 2
+}
+
+// draw_border puts the session's border round lines, a render's rows,
+// each ending in an attribute reset. The sides are as far apart as the
+// widest row.
+func draw_border(lines []string, sess *session) []string {
+	style := border_styles[sess.border]
+	color := ""
+	if c, err := canvas.ParseColor(sess.border_color); err == nil && sess.mode != "bw" {
+		color = fg(int(c.R), int(c.G), int(c.B))
+	}
+
+	width := 0
+	for _, line := range lines {
+		width = max(width, usertext.Width(ansi.Strip(line)))
+	}
+
+	edge := func(left, right string) string {
+		return color + left + strings.Repeat(style.edge, width) + right + resetAttrs
+	}
+	side := color + style.side + resetAttrs
+
+	out := make([]string, 0, len(lines)+2)
+	out = append(out, edge(style.corners[0], style.corners[1]))
+	for _, line := range lines {
+		gap := strings.Repeat(" ", width-usertext.Width(ansi.Strip(line)))
+		out = append(out, side+line+gap+side)
+	}
+	return append(out, edge(style.corners[3], style.corners[2]))
+}
+
+func border_status(sess *session) string {
+	if sess.border_color == "" {
+		return sess.border
+	}
+	return fmt.Sprintf("%s in %s", sess.border, sess.border_color)
+}
+
+// parse_border_color reads a border color, "default" or "" being the
+// terminal's own.
+func parse_border_color(s string) (string, bool) {
+	if s == "default" || s == "" {
+		return "", true
+	}
+	c, err := canvas.ParseColor(s)
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B), err == nil
+}
+
+// border_command handles "border STYLE [COLOR]", which draws a border
+// round renders, taking two columns and two rows from them, and "border
+// color COLOR". It's "ascii-border" as well.
+func border_command(sess *session, line string) string {
+	args := strings.Fields(line)[1:]
+	if len(args) == 0 {
+		return "Border: " + border_status(sess) + "\n"
+	}
+	style := args[0]
+	if style == "color" {
+		style = sess.border
+	}
+	if len(args) > 2 || args[0] == "color" && len(args) != 2 || style != "none" && border_styles[style] == (border_style{}) {
+		return border_usage
+	}
+
+	color := sess.border_color
+	if len(args) == 2 {
+		var ok bool
+		if color, ok = parse_border_color(args[1]); !ok {
+			return border_usage
+		}
+	}
+
+	sess.border, sess.border_color = style, color
+	if sess.border == "none" {
+		return "Border: none.\n"
+	}
+	return fmt.Sprintf("Border: %s. It takes 2 columns and 2 rows from renders.\n", border_status(sess))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+const (
+	// The image bounces around a canvas as wide as the session and this
+	// many rows tall, drawn bounce_cols wide, or narrower if that's too
+	// tall to fit.
+	bounce_rows = 24
+	bounce_cols = 30
+
+	// Every bounce_step it moves two columns and a row, cells being
+	// about twice as tall as they're wide.
+	bounce_step = 100 * time.Millisecond
+)
+
+// bounce_command handles "bounce URL", which sends a thumbnail of the
+// image at URL bouncing off the edges of the screen, until a key is
+// pressed. Frames come as maxfps allows.
+func bounce_command(sess *session, line string) (string, error) {
+	url := strings.TrimSpace(strings.TrimPrefix(line, "bounce"))
+	if url == "" {
+		return "Usage: bounce URL\n", nil
+	}
+
+	sess.last_url = url
+	stop := watch_hangup(sess)
+	img, err := fetch_image(sess, url, sess.max_pixels)
+	stop()
+
+	var big *fetch.TooLargeError
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ". Use 'info' to check dimensions first.\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+
+	b := img.Bounds()
+	cols := min(bounce_cols, sess.width, int(bounce_rows*sess.aspect*float64(b.Dx())/float64(max(b.Dy(), 1))))
+	if cols < 1 {
+		return "That image is too tall and thin to bounce.\n", nil
+	}
+	stats.rendered.Add(1)
+	thumb := renderToStrings(preprocess(img, sess), cols, 1, sess)
+	thumb = thumb[:min(len(thumb), bounce_rows)]
+
+	// Moving a whole step at a time, back and forth across the span
+	// there is either way, is an integer velocity bounced off each edge.
+	span_x, span_y := sess.width-cols, bounce_rows-len(thumb)
+	return animate(sess, "Bounce", bounce_step, 0, func(elapsed time.Duration) []string {
+		step := float64(elapsed / bounce_step)
+		x, y := bounce(2*step, span_x), bounce(step, span_y)
+
+		rows := make([]string, bounce_rows)
+		for i, row := range thumb {
+			rows[y+i] = strings.Repeat(" ", x) + row
+		}
+		return rows
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"image"
+	"strings"
+)
+
+// channels are the converters "channel" switches to, each drawing one
+// channel's value as lightness, in the bw characters.
+var channels = map[string]ascii_fn{
+	"R": pix_channel(0),
+	"G": pix_channel(1),
+	"B": pix_channel(2),
+}
+
+func pix_channel(c int) ascii_fn {
+	return func(img image.Image, x, y int) string {
+		r, g, b, _ := img.At(x, y).RGBA()
+		v := [3]uint32{r, g, b}[c]
+		return string(chars[bw_index(float64(v)/0xffff)])
+	}
+}
+
+// set_channel draws renders from one channel alone, or, for "", in the
+// session's mode again. A channel is a mode of its own, so like set_mode
+// it reports false, and leaves things alone, if the server has locked
+// the mode.
+func (s *session) set_channel(name string) bool {
+	if name != "" && *lockMode != "" {
+		return false
+	}
+	s.channel = name
+	if name == "" {
+		s.converter = modes[s.mode]
+		return true
+	}
+	s.converter = channels[name]
+	return true
+}
+
+func channel_status(sess *session) string {
+	if sess.channel == "" {
+		return "off"
+	}
+	return sess.channel
+}
+
+// channel_command handles "channel R|G|B|off".
+func channel_command(sess *session, line string) string {
+	switch arg := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(line, "channel"))); {
+	case arg == "":
+	case arg == "OFF":
+		sess.set_channel("")
+	case channels[arg] != nil:
+		if !sess.set_channel(arg) {
+			return mode_locked
+		}
+	default:
+		return "Usage: channel R, G or B, or channel off.\n"
+	}
+	return "Channel: " + channel_status(sess) + "\n"
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestChannelLocked(t *testing.T) {
+	defer func(old string) { *lockMode = old }(*lockMode)
+	*lockMode = "color"
+	sess := test_session(t)
+
+	if got := channel_command(sess, "channel R"); got != mode_locked {
+		t.Errorf("channel R on a locked server said %q", got)
+	}
+
+	channel := "G"
+	if got := apply_settings(sess, saved_settings{Channel: &channel}); got != "Settings loaded, except the mode: "+mode_locked {
+		t.Errorf("loading a channel on a locked server said %q", got)
+	}
+	if sess.channel != "" {
+		t.Errorf("channel is %q on a server locked to color", sess.channel)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/runenames"
+
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+// ascii_table handles "ascii-table": what each character of the bw
+// charset is and which lightnesses it stands for. It's plain text in
+// every mode so it can be copied.
+func ascii_table() string {
+	var b strings.Builder
+
+	n := float64(len(chars))
+	for k, c := range chars {
+		// These are the bounds bw_index sorts lightness by: everything
+		// below 2/n goes to the first character, and the last only gets
+		// full white.
+		lo, hi := float64(k+1)/n, float64(k+2)/n
+		if k == 0 {
+			lo = 0
+		}
+		lightness := fmt.Sprintf("%.2f-%.2f", lo, hi)
+		if k == len(chars)-1 {
+			lightness = fmt.Sprintf("%.2f", lo)
+		}
+
+		fmt.Fprintf(&b, "%q (U+%04X) %s: lightness %s", string(c), c, runenames.Name(c), lightness)
+		if w := usertext.RuneWidth(c); w != 1 {
+			fmt.Fprintf(&b, " [warning: %d columns wide]", w)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/canvas"
+)
+
+const (
+	checker_default_tile = 10
+	checker_max_tile     = 1000
+)
+
+// checker_image is a checkerboard of tile_w×tile_h tiles, c1 at the top
+// left, worked out pixel by pixel as it's drawn.
+type checker_image struct {
+	tile_w, tile_h int
+	c1, c2         color.RGBA
+	w, h           int
+}
+
+func (c checker_image) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (c checker_image) Bounds() image.Rectangle {
+	return image.Rect(0, 0, c.w, c.h)
+}
+
+func (c checker_image) At(x, y int) color.Color {
+	if (x/c.tile_w+y/c.tile_h)%2 == 0 {
+		return c.c1
+	}
+	return c.c2
+}
+
+// checker_command handles "checker W H C1 C2", which draws a
+// checkerboard of W×H pixel tiles in two #RRGGBB colors, in the session's
+// mode at its width and height, or demo_rows rows if the height is left
+// to the image. Plain "checker" is 10×10 tiles in black and white.
+func checker_command(sess *session, line string) string {
+	usage := fmt.Sprintf("Usage: checker W H C1 C2, with tiles from 1 to %d pixels a side and colors as RRGGBB in hex, or just checker.\n", checker_max_tile)
+
+	board := checker_image{
+		tile_w: checker_default_tile, tile_h: checker_default_tile,
+		c1: color.RGBA{0, 0, 0, 0xff}, c2: color.RGBA{0xff, 0xff, 0xff, 0xff},
+	}
+	args := strings.Fields(strings.TrimPrefix(line, "checker"))
+	switch len(args) {
+	case 0:
+	case 4:
+		w, err1 := strconv.Atoi(args[0])
+		h, err2 := strconv.Atoi(args[1])
+		c1, err3 := canvas.ParseColor(args[2])
+		c2, err4 := canvas.ParseColor(args[3])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil ||
+			w < 1 || w > checker_max_tile || h < 1 || h > checker_max_tile {
+			return usage
+		}
+		board.tile_w, board.tile_h = w, h
+		board.c1 = color.RGBA{c1.R, c1.G, c1.B, 0xff}
+		board.c2 = color.RGBA{c2.R, c2.G, c2.B, 0xff}
+	default:
+		return usage
+	}
+
+	rows := sess.height
+	if rows == 0 {
+		rows = demo_rows
+	}
+	board.w, board.h = sess.width, max(int(float64(rows)*sess.aspect), 1)
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(board, 1, sess)
+	return sess.last_render
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/ansi"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+// clock_overlay writes the server's time over the top-right corner of a
+// render of lines, indented by pad, once the render has been written and
+// the cursor is on the line below it. The cursor is moved rather than
+// the time being put into the rows, so their colors and the resets that
+// end them are left as they are, and is put back where it was after.
+func clock_overlay(lines []string, pad string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	now := time.Now().Format("15:04:05")
+	width := usertext.Width(ansi.Strip(lines[0]))
+	col := len(pad) + max(width-len(now), 0) + 1
+	return fmt.Sprintf("\033[%dA\033[%dG\033[1;37m%s%s\033[%dB\r", len(lines), col, now, resetAttrs, len(lines))
+}
+
+// clock_command handles "ascii-clock", which turns the clock over
+// renders on and off.
+func clock_command(sess *session, _ string) string {
+	sess.clock = !sess.clock
+	if sess.clock {
+		return "Clock on: renders show the server's time in their top-right corner.\n"
+	}
+	return "Clock off.\n"
+}
+
+// draw_line draws ch from x0, y0 to x1, y1 on grid, Bresenham's way,
+// leaving out whatever falls off it.
+func draw_line(grid [][]rune, x0, y0, x1, y1 int, ch rune) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		if y0 >= 0 && y0 < len(grid) && x0 >= 0 && x0 < len(grid[y0]) {
+			grid[y0][x0] = ch
+		}
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// clock_face draws an analog clock reading t, w columns by w/2 rows: a
+// ring of ○, a mark for every hour, upright near 12 and 6 and flat near
+// 3 and 9, and the hands in bw's characters, darkest for the hour.
+func clock_face(t time.Time, w int) string {
+	h := w / 2
+	grid := make([][]rune, h)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", w))
+	}
+
+	// Cells are about twice as tall as they're wide, so the ring is half
+	// as many rows tall as it's columns wide, and looks round.
+	cx, cy := float64(w-1)/2, float64(h-1)/2
+	rx, ry := cx, cy
+	at := func(turn, r float64) (int, int) {
+		a := turn * 2 * math.Pi
+		return int(math.Round(cx + math.Sin(a)*rx*r)), int(math.Round(cy - math.Cos(a)*ry*r))
+	}
+
+	for i := range 8 * w {
+		x, y := at(float64(i)/float64(8*w), 1)
+		grid[y][x] = '○'
+	}
+	for hour := range 12 {
+		mark := '─'
+		if hour%6 <= 1 || hour%6 == 5 {
+			mark = '│'
+		}
+		x, y := at(float64(hour)/12, 0.85)
+		grid[y][x] = mark
+	}
+
+	hands := []struct {
+		turn, length float64
+		ch           rune
+	}{
+		{float64(t.Second()) / 60, 0.75, chars[1]},
+		{(float64(t.Minute()) + float64(t.Second())/60) / 60, 0.7, chars[2]},
+		{(float64(t.Hour()%12) + float64(t.Minute())/60) / 12, 0.45, chars[3]},
+	}
+	x0, y0 := at(0, 0)
+	for _, hand := range hands {
+		x1, y1 := at(hand.turn, hand.length)
+		draw_line(grid, x0, y0, x1, y1, hand.ch)
+	}
+
+	var b strings.Builder
+	for _, row := range grid {
+		b.WriteString(strings.TrimRight(string(row), " ") + "\n")
+	}
+	label := t.Format("15:04:05 MST")
+	b.WriteString(strings.Repeat(" ", max(w-len(label), 0)/2) + label + "\n")
+	return b.String()
+}
+
+// clock_face_command handles "clock", which draws the server's time on an
+// analog clock as wide as the session, and "clock UTC", for the time in
+// UTC.
+func clock_face_command(sess *session, line string) string {
+	args := strings.Fields(line)[1:]
+	t := time.Now()
+	switch {
+	case len(args) == 1 && strings.EqualFold(args[0], "utc"):
+		t = t.UTC()
+	case len(args) != 0:
+		return "Usage: clock, or clock UTC.\n"
+	}
+
+	sess.last_render = clock_face(t, sess.width)
+	return sess.last_render
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const (
+	color_cycle_max_frames = 100
+	color_cycle_delay      = 500 * time.Millisecond
+)
+
+// hue_rotated is img with every pixel's hue turned by deg degrees. The
+// rotation is worked out as pixels are asked for, so only the ones a
+// render samples cost anything.
+type hue_rotated struct {
+	image.Image
+	deg float64
+}
+
+func (h hue_rotated) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+func (h hue_rotated) At(x, y int) color.Color {
+	c := color.NRGBAModel.Convert(h.Image.At(x, y)).(color.NRGBA)
+	hue, s, v := colorspace.RGBToHSV(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+	r, g, b := colorspace.HSVToRGB(hue+h.deg, s, v)
+	return color.NRGBA{clamp8(int(r*255 + 0.5)), clamp8(int(g*255 + 0.5)), clamp8(int(b*255 + 0.5)), c.A}
+}
+
+// hue_rotate_command handles "hue-rotate N", which turns every image's
+// hues N degrees round the color wheel, keeping their saturation and
+// value; 180 gives each color its complement.
+func hue_rotate_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "hue-rotate"))
+	if arg == "" {
+		return fmt.Sprintf("Hue rotate: %d°\n", sess.hue_rotate)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(arg, "°"))
+	if err != nil || n < 0 || n > 359 {
+		return "Usage: hue-rotate N, with N from 0 to 359 degrees (0 leaves hues alone).\n"
+	}
+	sess.hue_rotate = n
+	if n == 0 {
+		return "Hue rotate: off.\n"
+	}
+	return fmt.Sprintf("Hue rotate: %d°\n", n)
+}
+
+// color_cycle_command handles "color-cycle N STEP", which draws the last
+// image asked for N times, turning its hues STEP degrees further each
+// time. Any key stops it early.
+func color_cycle_command(sess *session, line string) (string, error) {
+	usage := fmt.Sprintf("Usage: color-cycle N STEP, with N from 1 to %d frames and STEP from 1 to 360 degrees.\n", color_cycle_max_frames)
+
+	args := strings.Fields(strings.TrimPrefix(line, "color-cycle"))
+	if len(args) != 2 {
+		return usage, nil
+	}
+	n, err1 := strconv.Atoi(args[0])
+	step, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || n < 1 || n > color_cycle_max_frames || step < 1 || step > 360 {
+		return usage, nil
+	}
+	if sess.last_url == "" {
+		return "Paste an image URL first; color-cycle works on the last one.\n", nil
+	}
+
+	img, err := fetch_image(sess, sess.last_url, sess.max_pixels)
+	if err != nil {
+		return fmt.Sprintf("Couldn't load %s: %v.\n", sess.last_url, err), nil
+	}
+	img = preprocess(img, sess)
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	defer sess.send(resetAttrs + showCursor)
+	sess.send(hideCursor)
+
+	for i := range n {
+		deg := i * step % 360
+		stats.rendered.Add(1)
+		sess.send(clearScreen + fmt.Sprintf("\033[1mColor cycle\033[0m   frame %d/%d, hue %+d°   any key stops\n\n", i+1, n, deg) +
+			compress(hue_rotated{img, float64(deg)}, 1, sess))
+
+		if i == n-1 {
+			break
+		}
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return "Color cycle stopped.\n", nil
+		case <-time.After(sess.next_frame(color_cycle_delay)):
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// The colorize palettes, from what black turns into to what white does,
+// with the stops spread evenly between.
+var (
+	heat_stops = []color.RGBA{
+		{0x00, 0x00, 0x00, 0xff}, {0xff, 0x00, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff}, {0xff, 0xff, 0xff, 0xff},
+	}
+	cool_stops = []color.RGBA{
+		{0xff, 0xff, 0xff, 0xff}, {0x00, 0xff, 0xff, 0xff}, {0x00, 0x00, 0xff, 0xff}, {0x00, 0x00, 0x00, 0xff},
+	}
+	// Red round to magenta; going on to red again would make black and
+	// white the same.
+	rainbow_stops = []color.RGBA{
+		{0xff, 0x00, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff}, {0x00, 0xff, 0x00, 0xff},
+		{0x00, 0xff, 0xff, 0xff}, {0x00, 0x00, 0xff, 0xff}, {0xff, 0x00, 0xff, 0xff},
+	}
+	// matplotlib's viridis, every eighth of the way.
+	viridis_stops = []color.RGBA{
+		{0x44, 0x01, 0x54, 0xff}, {0x47, 0x2d, 0x7b, 0xff}, {0x3b, 0x52, 0x8b, 0xff},
+		{0x2c, 0x72, 0x8e, 0xff}, {0x21, 0x91, 0x8c, 0xff}, {0x28, 0xae, 0x80, 0xff},
+		{0x5e, 0xc9, 0x62, 0xff}, {0xad, 0xdc, 0x30, 0xff}, {0xfd, 0xe7, 0x25, 0xff},
+	}
+)
+
+var colorize_palettes = map[string][]color.RGBA{
+	"heat":    heat_stops,
+	"cool":    cool_stops,
+	"rainbow": rainbow_stops,
+	"viridis": viridis_stops,
+}
+
+// palette_at is the color t of the way along stops, from 0 to 1, mixed
+// linearly from the two stops either side.
+func palette_at(stops []color.RGBA, t float64) (r, g, b uint8) {
+	pos := min(max(t, 0), 1) * float64(len(stops)-1)
+	i := min(int(pos), len(stops)-2)
+	f := pos - float64(i)
+	mix := func(a, b uint8) uint8 {
+		return clamp8(int(math.Round(float64(a) + (float64(b)-float64(a))*f)))
+	}
+	lo, hi := stops[i], stops[i+1]
+	return mix(lo.R, hi.R), mix(lo.G, hi.G), mix(lo.B, hi.B)
+}
+
+// apply_colorize puts img's lightness, as bw sees it, through stops.
+// Alpha is left alone.
+func apply_colorize(img image.Image, stops []color.RGBA) image.Image {
+	out := to_nrgba(img)
+	for i := 0; i < len(out.Pix); i += 4 {
+		px := out.Pix[i : i+3]
+		l := 0.2126*float64(px[0]) + 0.7152*float64(px[1]) + 0.0722*float64(px[2])
+		px[0], px[1], px[2] = palette_at(stops, l/255)
+	}
+	return out
+}
+
+// colorize_command handles "colorize URL PALETTE", which draws the image
+// at URL in the palette's colors, by how light each pixel is. It's drawn
+// in color whatever the session's mode, unless the server has locked
+// everyone to another.
+func colorize_command(sess *session, line string) (string, error) {
+	names := make([]string, 0, len(colorize_palettes))
+	for name := range colorize_palettes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	args := strings.Fields(strings.TrimPrefix(line, "colorize"))
+	if len(args) != 2 || colorize_palettes[strings.ToLower(args[1])] == nil {
+		return "Usage: colorize URL PALETTE, with PALETTE one of " + strings.Join(names, ", ") + ".\n", nil
+	}
+	stops := colorize_palettes[strings.ToLower(args[1])]
+
+	sess.last_url = args[0]
+	stop := watch_hangup(sess)
+	img, err := fetch_image(sess, args[0], sess.max_pixels)
+	stop()
+
+	var big *fetch.TooLargeError
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ". Use 'info' to check dimensions first.\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+
+	if *lockMode == "" || *lockMode == "color" {
+		converter := sess.converter
+		sess.converter = modes["color"]
+		defer func() { sess.converter = converter }()
+	}
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(apply_colorize(preprocess(img, sess), stops), 1, sess)
+	return sess.last_render, nil
+}
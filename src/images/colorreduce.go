@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/quantize"
+)
+
+const (
+	min_color_reduce = 2
+	max_color_reduce = 256
+)
+
+// apply_color_reduce quantizes img to at most n colors and hands it back
+// as RGBA, which is what the converters are fastest on.
+func apply_color_reduce(img image.Image, n int) image.Image {
+	return paletted_rgba(quantize.Reduce(img, n))
+}
+
+// apply_dithered_color_reduce is apply_color_reduce with ordered
+// dithering, for gradients.
+func apply_dithered_color_reduce(img image.Image, n int) image.Image {
+	return paletted_rgba(quantize.ReduceDithered(img, n))
+}
+
+func paletted_rgba(reduced *image.Paletted) image.Image {
+	out := image.NewRGBA(reduced.Bounds())
+	draw.Draw(out, out.Bounds(), reduced, reduced.Bounds().Min, draw.Src)
+	return out
+}
+
+func color_reduce_status(sess *session) string {
+	if sess.color_reduce == 0 {
+		return "off"
+	}
+	return plural(sess.color_reduce, "color")
+}
+
+// color_reduce_command handles "color-reduce N".
+func color_reduce_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "color-reduce"))
+	if arg == "" {
+		return "Color reduce: " + color_reduce_status(sess) + "\n"
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n != 0 && (n < min_color_reduce || n > max_color_reduce) {
+		return fmt.Sprintf("Usage: color-reduce N, where N is %d to %d colors, or 0 for off.\n", min_color_reduce, max_color_reduce)
+	}
+
+	sess.color_reduce = n
+	if n == 0 {
+		return "Color reduce off.\n"
+	}
+	return "Color reduce: " + color_reduce_status(sess) + "\n"
+}
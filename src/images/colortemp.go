@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	min_color_temp     = 1000
+	max_color_temp     = 12000
+	neutral_color_temp = 6500
+)
+
+// kelvin_rgb is Tanner Helland's fit of the color of a black body at k
+// kelvin, with each channel from 0 to 255.
+func kelvin_rgb(k int) [3]float64 {
+	t := float64(k) / 100
+
+	var r, g, b float64
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	switch {
+	case t >= 66:
+		b = 255
+	case t <= 19:
+		b = 0
+	default:
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	return [3]float64{
+		min(max(r, 0), 255),
+		min(max(g, 0), 255),
+		min(max(b, 0), 255),
+	}
+}
+
+// color_temp_multipliers are the per-channel factors that shift an image
+// shot in neutral daylight to look lit at k kelvin. They are relative to
+// neutral_color_temp, so that temperature leaves images alone.
+func color_temp_multipliers(k int) [3]float64 {
+	want, neutral := kelvin_rgb(k), kelvin_rgb(neutral_color_temp)
+	return [3]float64{want[0] / neutral[0], want[1] / neutral[1], want[2] / neutral[2]}
+}
+
+// apply_color_temp scales R, G and B by mult. Alpha is left alone.
+func apply_color_temp(img image.Image, mult [3]float64) image.Image {
+	out := to_nrgba(img)
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		for c := range 3 {
+			out.Pix[i+c] = clamp8(int(math.Round(float64(out.Pix[i+c]) * mult[c])))
+		}
+	}
+
+	return out
+}
+
+// set_color_temp stores k and works out its multipliers once, rather than
+// for every render.
+func (s *session) set_color_temp(k int) {
+	s.color_temp = k
+	s.temp_mult = color_temp_multipliers(k)
+}
+
+// color_temp_command handles "color-temp N".
+func color_temp_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "color-temp"))
+	if arg == "" {
+		return fmt.Sprintf("Color temperature: %dK\n", sess.color_temp)
+	}
+
+	k, err := strconv.Atoi(strings.TrimSuffix(strings.ToUpper(arg), "K"))
+	if err != nil || k < min_color_temp || k > max_color_temp {
+		return fmt.Sprintf("Usage: color-temp N, where N is %d to %d kelvin (%d is neutral).\n",
+			min_color_temp, max_color_temp, neutral_color_temp)
+	}
+
+	sess.set_color_temp(k)
+	if k == neutral_color_temp {
+		return "Color temperature: neutral.\n"
+	}
+	return fmt.Sprintf("Color temperature: %dK\n", k)
+}
@@ -0,0 +1,241 @@
+package main
+
+import "strings"
+
+// A command_handler answers one line of input. It gets the whole line,
+// command name included.
+type command_handler func(sess *session, line string) (string, error)
+
+type command struct {
+	handler command_handler
+	exact   bool
+}
+
+// A CommandRegistry maps the first word of a line to the command that
+// handles it. Lines that don't name a command go to the fallback.
+type CommandRegistry struct {
+	commands map[string]command
+	fallback command_handler
+}
+
+func NewCommandRegistry(fallback command_handler) *CommandRegistry {
+	return &CommandRegistry{commands: map[string]command{}, fallback: fallback}
+}
+
+// Register adds a command that may take arguments: it handles both
+// "name" and "name ARGS...".
+func (r *CommandRegistry) Register(name string, handler command_handler) {
+	r.commands[name] = command{handler: handler}
+}
+
+// RegisterExact adds a command that takes no arguments, so "name" is the
+// only line it handles.
+func (r *CommandRegistry) RegisterExact(name string, handler command_handler) {
+	r.commands[name] = command{handler: handler, exact: true}
+}
+
+// Dispatch runs the command line names, or the fallback if it names none.
+func (r *CommandRegistry) Dispatch(sess *session, line string) (string, error) {
+	name, _, has_args := strings.Cut(line, " ")
+	if c, ok := r.commands[name]; ok && !(c.exact && has_args) {
+		return c.handler(sess, line)
+	}
+	return r.fallback(sess, line)
+}
+
+// commands is everything a client can type at the prompt. Anything else
+// is taken to be an image URL.
+var commands = NewCommandRegistry(render_url)
+
+// quick adapts handlers that can't fail.
+func quick(handler func(*session, string) string) command_handler {
+	return func(sess *session, line string) (string, error) {
+		return handler(sess, line), nil
+	}
+}
+
+func init() {
+	commands.RegisterExact("color", quick(func(sess *session, _ string) string {
+		if !sess.set_mode("color") {
+			return mode_locked
+		}
+		return "Using RGB.\n"
+	}))
+	commands.RegisterExact("bw", quick(func(sess *session, _ string) string {
+		if !sess.set_mode("bw") {
+			return mode_locked
+		}
+		return "Using BW.\n"
+	}))
+	commands.RegisterExact("status", quick(func(sess *session, _ string) string {
+		return status_command(sess)
+	}))
+	commands.RegisterExact("settings", quick(func(sess *session, _ string) string {
+		return status_command(sess)
+	}))
+	commands.RegisterExact("save-settings", quick(func(sess *session, _ string) string {
+		return save_settings(sess)
+	}))
+	commands.Register("copy-settings", quick(copy_settings_command))
+	commands.Register("load-settings", quick(func(sess *session, line string) string {
+		return load_settings(sess, strings.TrimPrefix(line, "load-settings"))
+	}))
+	commands.Register("width", quick(width_command))
+	commands.Register("resize", quick(resize_command))
+	commands.Register("aspect-ratio", quick(aspect_ratio_command))
+	commands.RegisterExact("adaptive-width", quick(adaptive_width_command))
+	commands.RegisterExact("center", quick(align_command))
+	commands.Register("align", quick(align_command))
+	commands.Register("sampling", quick(sampling_command))
+	commands.Register("trim", quick(trim_command))
+	commands.Register("trim-whitespace", quick(trim_command))
+	commands.Register("scale-filter", quick(sampling_command))
+	commands.RegisterExact("rawoutput", quick(func(sess *session, _ string) string {
+		sess.raw_output = !sess.raw_output
+		if sess.raw_output {
+			return "Raw output on: every cell gets its own escapes.\n"
+		}
+		return "Raw output off.\n"
+	}))
+	commands.RegisterExact("ascii-table", quick(func(*session, string) string {
+		return ascii_table()
+	}))
+	commands.Register("stats", quick(func(_ *session, line string) string {
+		return stats_command(line)
+	}))
+	commands.Register("watermark", quick(watermark_command))
+	commands.RegisterExact("ascii-clock", quick(clock_command))
+	commands.Register("clock", quick(clock_face_command))
+	commands.Register("ascii-clock-face", quick(clock_face_command))
+	commands.Register("qr", quick(func(sess *session, line string) string {
+		return qr_command(sess, strings.TrimPrefix(line, "qr"))
+	}))
+	commands.RegisterExact("auto-contrast", quick(auto_contrast_command))
+	commands.RegisterExact("auto-palette", quick(auto_palette_command))
+	commands.Register("noise", quick(noise_command))
+	commands.Register("color-reduce", quick(color_reduce_command))
+	commands.Register("channel", quick(channel_command))
+	commands.Register("outline", quick(outline_command))
+	commands.Register("shadow", quick(shadow_command))
+	commands.Register("palette-swap", quick(palette_swap_command))
+	commands.Register("border", quick(border_command))
+	commands.Register("ascii-border", quick(border_command))
+	commands.Register("background-image", background_command)
+	commands.RegisterExact("transparency-check", quick(transparency_check_command))
+	commands.Register("color-temp", quick(color_temp_command))
+	commands.Register("hue-rotate", quick(hue_rotate_command))
+	commands.Register("saturation", quick(saturation_command))
+	commands.RegisterExact("luminance-only", quick(ycbcr_command("luminance")))
+	commands.RegisterExact("chrominance-only", quick(ycbcr_command("chrominance")))
+	commands.Register("nick", quick(nick_command))
+	commands.Register("register", quick(register_command))
+	commands.Register("login", quick(login_command))
+	commands.Register("profile", quick(profile_command))
+	commands.RegisterExact("scores", quick(func(sess *session, _ string) string {
+		return scores_command(sess)
+	}))
+	commands.Register("top", quick(top_command))
+	commands.Register("benchmark", quick(benchmark_command))
+	commands.RegisterExact("fps-test", fps_test_command)
+	commands.RegisterExact("protocol-test", protocol_test_command)
+	commands.RegisterExact("binary", binary_command)
+	commands.Register("latency", quick(latency_command))
+	commands.Register("time-render", quick(time_render_command))
+	commands.Register("admin", quick(admin_command))
+	commands.Register("ban", admin_only(ban_command))
+	commands.Register("unban", admin_only(unban_command))
+	commands.RegisterExact("bans", admin_only(bans_command))
+	commands.Register("kick", admin_only(kick_command))
+	commands.Register("policy", admin_only(policy_command))
+	commands.Register("announce", admin_only(announce_command))
+	commands.Register("broadcast", admin_only(broadcast_command))
+	commands.Register("job", admin_only(job_command))
+	commands.RegisterExact("jobs", quick(jobs_command))
+	commands.Register("show", quick(show_command))
+	commands.Register("notify", quick(notify_command))
+	commands.Register("notices", quick(notices_command))
+	commands.Register("info", quick(info_command))
+	commands.Register("decode-test", quick(decode_test_command))
+	commands.Register("scan", quick(scan_command))
+	commands.Register("max-pixels", quick(max_pixels_command))
+	commands.Register("decode-format", quick(decode_format_command))
+	commands.Register("decode-timeout", quick(decode_timeout_command))
+	commands.Register("split", quick(split_command))
+	commands.Register("grid-layout", quick(grid_command))
+	commands.Register("multi-column", quick(grid_command))
+	commands.Register("diff", quick(diff_command))
+	commands.Register("convert", quick(convert_command))
+	commands.Register("diff-threshold", quick(diff_threshold_command))
+	commands.Register("reveal", reveal_command)
+	commands.Register("puzzle", puzzle_command)
+	commands.Register("play", play_command)
+	commands.Register("snake", snake_command)
+	commands.Register("ascii-snake", func(sess *session, line string) (string, error) {
+		return snake_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("tetris", tetris_command)
+	commands.Register("ascii-tetris", func(sess *session, line string) (string, error) {
+		return tetris_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("pong", pong_command)
+	commands.Register("ascii-pong", func(sess *session, line string) (string, error) {
+		return pong_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("daily", daily_command)
+	commands.RegisterExact("resume", resume_command)
+	commands.RegisterExact("pgn", quick(pgn_command))
+	commands.RegisterExact("games", quick(games_command))
+	commands.Register("watch", watch_command)
+	commands.Register("slideshow", slideshow_command)
+	commands.Register("film", film_command)
+	commands.Register("text", quick(text_command))
+	commands.Register("mandelbrot", quick(mandelbrot_command))
+	commands.Register("ascii-mandelbrot", quick(func(sess *session, line string) string {
+		return mandelbrot_command(sess, strings.TrimPrefix(line, "ascii-"))
+	}))
+	commands.Register("julia", quick(julia_command))
+	commands.Register("ascii-julia", quick(func(sess *session, line string) string {
+		return julia_command(sess, strings.TrimPrefix(line, "ascii-"))
+	}))
+	commands.Register("marquee", marquee_command)
+	commands.Register("color-cycle", color_cycle_command)
+	commands.Register("colorize", colorize_command)
+	commands.Register("plasma", plasma_command)
+	commands.Register("ascii-plasma", func(sess *session, line string) (string, error) {
+		return plasma_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("fire", fire_command)
+	commands.Register("ascii-fire", func(sess *session, line string) (string, error) {
+		return fire_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("bounce", bounce_command)
+	commands.Register("noise-pattern", quick(noise_pattern_command))
+	commands.Register("ascii-noise-pattern", quick(func(sess *session, line string) string {
+		return noise_pattern_command(sess, strings.TrimPrefix(line, "ascii-"))
+	}))
+	commands.Register("gradient", quick(gradient_command))
+	commands.Register("ascii-gradient", quick(func(sess *session, line string) string {
+		return gradient_command(sess, strings.TrimPrefix(line, "ascii-"))
+	}))
+	commands.Register("checker", quick(checker_command))
+	commands.Register("ascii-checker", quick(func(sess *session, line string) string {
+		return checker_command(sess, strings.TrimPrefix(line, "ascii-"))
+	}))
+	commands.Register("spectrum", spectrum_command)
+	commands.Register("ascii-spectrum", func(sess *session, line string) (string, error) {
+		return spectrum_command(sess, strings.TrimPrefix(line, "ascii-"))
+	})
+	commands.Register("matrix", matrix_command)
+	commands.Register("matrix-charset", quick(matrix_charset_command))
+	commands.Register("demo", demo_command)
+	commands.Register("screensaver", quick(screensaver_command))
+	commands.Register("throttle", quick(throttle_command))
+	commands.Register("maxfps", quick(max_fps_command))
+	commands.Register("user-agent", quick(user_agent_command))
+	commands.Register("prefetch", quick(prefetch_command))
+	commands.Register("export", quick(export_command))
+	commands.Register("export-ansi", quick(export_ansi_command))
+	commands.Register("record", quick(record_command))
+	commands.Register("replay", replay_command)
+	commands.RegisterExact("recordings", quick(recordings_command))
+}
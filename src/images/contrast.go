@@ -0,0 +1,62 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// apply_auto_contrast stretches img so that its darkest and lightest
+// values reach 0 and 255. In color each channel is stretched on its own;
+// in bw, where only lightness shows, all three are stretched alike from
+// the darkest to the lightest pixel, which stretches lightness the same
+// way. Fully transparent pixels don't count, and an image all one value
+// is left as it is.
+func apply_auto_contrast(img image.Image, per_channel bool) image.Image {
+	out := to_nrgba(img)
+
+	lo, hi := [3]float64{255, 255, 255}, [3]float64{}
+	for i := 0; i < len(out.Pix); i += 4 {
+		if out.Pix[i+3] == 0 {
+			continue
+		}
+		px := out.Pix[i : i+3]
+		if !per_channel {
+			l := 0.2126*float64(px[0]) + 0.7152*float64(px[1]) + 0.0722*float64(px[2])
+			lo[0], hi[0] = min(lo[0], l), max(hi[0], l)
+			continue
+		}
+		for c := range 3 {
+			lo[c], hi[c] = min(lo[c], float64(px[c])), max(hi[c], float64(px[c]))
+		}
+	}
+	if !per_channel {
+		lo[1], lo[2], hi[1], hi[2] = lo[0], lo[0], hi[0], hi[0]
+	}
+
+	stretch := false
+	for c := range 3 {
+		stretch = stretch || hi[c] > lo[c]
+	}
+	if !stretch {
+		return img
+	}
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		for c := range 3 {
+			if hi[c] > lo[c] {
+				out.Pix[i+c] = clamp8(int(math.Round((float64(out.Pix[i+c]) - lo[c]) * 255 / (hi[c] - lo[c]))))
+			}
+		}
+	}
+	return out
+}
+
+// auto_contrast_command handles "auto-contrast", which turns it on and
+// off.
+func auto_contrast_command(sess *session, _ string) string {
+	sess.auto_contrast = !sess.auto_contrast
+	if sess.auto_contrast {
+		return "Auto contrast on: images are stretched to use the full range from dark to light.\n"
+	}
+	return "Auto contrast off.\n"
+}
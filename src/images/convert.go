@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+	"golang.org/x/image/bmp"
+)
+
+// encoders are the formats convert can re-encode to.
+var encoders = map[string]func(io.Writer, image.Image) error{
+	"png": png.Encode,
+	"jpeg": func(w io.Writer, img image.Image) error {
+		return jpeg.Encode(w, img, nil)
+	},
+	"gif": func(w io.Writer, img image.Image) error {
+		return gif.Encode(w, img, nil)
+	},
+	"bmp": bmp.Encode,
+}
+
+// byte_counter is a writer that only counts what it's given.
+type byte_counter int64
+
+func (c *byte_counter) Write(p []byte) (int, error) {
+	*c += byte_counter(len(p))
+	return len(p), nil
+}
+
+// convert_command handles "convert URL FORMAT", reporting how big the
+// image would be in another format. The re-encoded bytes are counted and
+// thrown away.
+func convert_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "convert"))
+	if len(args) != 2 {
+		return "Usage: convert URL png|jpeg|gif|bmp\n"
+	}
+
+	target := strings.ToLower(args[1])
+	if target == "jpg" {
+		target = "jpeg"
+	}
+	encode, ok := encoders[target]
+	if !ok {
+		return "Formats: png, jpeg, gif or bmp.\n"
+	}
+
+	sess.last_url = args[0]
+	resp, err := http_get(sess, args[0])
+	if err != nil {
+		return fmt.Sprintf("Couldn't fetch that: %v.\n", err)
+	}
+	defer fetch.Close(resp.Body)
+
+	var original byte_counter
+	img, format, err := image.Decode(io.TeeReader(resp.Body, &original))
+	if err != nil {
+		return fmt.Sprintf("Couldn't decode that: %v.\n", err)
+	}
+	// Count anything after the image data too; it was all downloaded.
+	io.Copy(&original, resp.Body)
+
+	var converted byte_counter
+	if err := encode(&converted, img); err != nil {
+		return fmt.Sprintf("Couldn't encode as %s: %v.\n", target, err)
+	}
+
+	return fmt.Sprintf("Original: %s %s → Re-encoded: %s %s\n",
+		human_bytes(int64(original)), strings.ToUpper(format), human_bytes(int64(converted)), strings.ToUpper(target))
+}
+
+// human_bytes formats n in decimal units, like 2.1 MB.
+func human_bytes(n int64) string {
+	if n < 1000 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v, unit := float64(n)/1000, 0
+	for v >= 1000 && unit < 3 {
+		v /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", v, []string{"kB", "MB", "GB", "TB"}[unit])
+}
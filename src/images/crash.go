@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+var crashLog = flag.String("crash-log", "", "append the stack trace of any connection that panics to this file")
+
+var crash_log = struct {
+	sync.Mutex
+	f *os.File
+}{}
+
+func open_crash_log() {
+	if *crashLog == "" {
+		return
+	}
+
+	f, err := os.OpenFile(*crashLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatalf("crash log: %v", err)
+	}
+	crash_log.f = f
+}
+
+// report_crash records a panic that took down sess's connection, along
+// with everything that might help reproduce it.
+func report_crash(sess *session, v any, stack []byte) {
+	settings, _ := json.Marshal(session_settings(sess))
+
+	if crash_log.f == nil {
+		slog.Error("connection panicked",
+			"conn", sess.id,
+			"remote", sess.conn.RemoteAddr().String(),
+			"url", sess.last_url,
+			"settings", string(settings),
+			"panic", fmt.Sprint(v),
+			"stack", string(stack))
+		return
+	}
+
+	log.Printf("conn %d panicked: %v (stack trace in %s)", sess.id, v, *crashLog)
+
+	crash_log.Lock()
+	defer crash_log.Unlock()
+	fmt.Fprintf(crash_log.f, "=== %s conn %d from %s\nlast URL: %s\nsettings: %s\npanic: %v\n\n%s\n",
+		time.Now().Format(time.RFC3339), sess.id, sess.conn.RemoteAddr(), sess.last_url, settings, v, stack)
+}
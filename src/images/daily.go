@@ -0,0 +1,306 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/game2048"
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+	"github.com/atalii/image-server-thing/internal/usertext"
+	"github.com/atalii/image-server-thing/internal/wordle"
+)
+
+var dailySeed = flag.String("daily-seed", "", "mixed into every daily challenge, so this server's puzzles differ from other servers'")
+
+// Attempts at challenges scored fewest-first are entered with this until
+// the result comes in, so unfinished ones rank last.
+const daily_unfinished = 1e9
+
+// A daily_challenge is a game that can be set up from a seed, so that
+// everyone playing it on the same day gets the same puzzle. play runs
+// it with a source seeded for the day and returns the score to record;
+// finished is false if the player gave up, which leaves their entry
+// unfinished.
+type daily_challenge struct {
+	game  string
+	about string
+	kind  leaderboard.Kind
+	unit  string
+	play  func(sess *session, rng *rand.Rand) (score float64, finished bool, err error)
+
+	// show writes a score, if the unit alone won't do.
+	show func(score float64) string
+}
+
+func (c daily_challenge) format(score float64) string {
+	if c.show != nil {
+		return c.show(score)
+	}
+	return format_score(score) + " " + c.unit
+}
+
+// The challenges take turns, one a day.
+var daily_challenges = []daily_challenge{
+	{
+		game:  "wordle",
+		about: "find the word in as few guesses as you can",
+		kind:  leaderboard.Lowest,
+		unit:  "guesses",
+		play:  daily_wordle,
+		show: func(score float64) string {
+			if score > wordle.Guesses {
+				return fmt.Sprintf("X/%d", wordle.Guesses)
+			}
+			return fmt.Sprintf("%s/%d", format_score(score), wordle.Guesses)
+		},
+	},
+	{
+		game:  "maze",
+		about: "find the way out, taking as few steps off the shortest way as you can",
+		kind:  leaderboard.Lowest,
+		unit:  "extra steps",
+		play:  daily_maze,
+	},
+	{
+		game:  "2048",
+		about: "score as many points as you can; the tiles come up the same for everyone",
+		kind:  leaderboard.Highest,
+		unit:  "points",
+		play:  daily_2048,
+	},
+}
+
+// daily_day names the UTC date of t, which is what a challenge belongs
+// to: a new one starts at midnight UTC.
+func daily_day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// daily_for returns the challenge for day, a date like "2024-06-01".
+func daily_for(day string) (daily_challenge, bool) {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return daily_challenge{}, false
+	}
+	days := t.Unix() / (24 * 60 * 60)
+	return daily_challenges[days%int64(len(daily_challenges))], true
+}
+
+// daily_rng returns the source day's puzzle is built from, which only
+// depends on the date and the server's seed.
+func daily_rng(day string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(*dailySeed + "\x00" + day))
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// daily_board names the leaderboard holding day's results.
+func daily_board(day string) string {
+	return "daily-" + day
+}
+
+// daily_streak counts the days in a row nick has taken the challenge, up
+// to today. Not having played yet today doesn't break it.
+func daily_streak(nick string, now time.Time) int {
+	t := now.UTC()
+	if !scoreboard.Has(daily_board(daily_day(t)), nick) {
+		t = t.AddDate(0, 0, -1)
+	}
+
+	n := 0
+	for scoreboard.Has(daily_board(daily_day(t)), nick) {
+		n++
+		t = t.AddDate(0, 0, -1)
+	}
+	return n
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// daily_command handles "daily [play|board]".
+func daily_command(sess *session, line string) (string, error) {
+	now := time.Now()
+	switch strings.TrimSpace(strings.TrimPrefix(line, "daily")) {
+	case "":
+		return daily_about(sess, now), nil
+	case "play":
+		return daily_play(sess, now)
+	case "board":
+		return daily_results(sess, now), nil
+	}
+	return "Usage: daily [play|board]\n", nil
+}
+
+func daily_about(sess *session, now time.Time) string {
+	day := daily_day(now)
+	c, _ := daily_for(day)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\033[1mDaily challenge\033[0m %s: %s. The aim: %s.\n", day, c.game, c.about)
+	b.WriteString("Everyone gets the same puzzle today, and each nickname gets one try.\n")
+
+	left := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now).Round(time.Minute)
+	until := strings.TrimSuffix(left.String(), "0s")
+	switch {
+	case sess.nick == "":
+		b.WriteString("Set a 'nick' first: that's how your try is kept track of.\n")
+	case scoreboard.Has(daily_board(day), sess.nick):
+		fmt.Fprintf(&b, "You've had your try today. The next challenge is up in %s; 'daily board' has the results.\n", until)
+	default:
+		b.WriteString("Type 'daily play' to start, or 'daily board' for today's results.\n")
+	}
+
+	if sess.nick != "" {
+		if n := daily_streak(sess.nick, now); n > 0 {
+			fmt.Fprintf(&b, "Your streak: %s.\n", plural(n, "day"))
+		}
+	}
+	return b.String()
+}
+
+// daily_play handles "daily play". The attempt is entered before the game
+// starts, so quitting or hanging up uses it up. A game started before
+// midnight counts for the day it was started on.
+func daily_play(sess *session, now time.Time) (string, error) {
+	if sess.nick == "" {
+		return "Set a 'nick' first: the daily challenge is once per nickname.\n", nil
+	}
+
+	day := daily_day(now)
+	c, _ := daily_for(day)
+	board := daily_board(day)
+
+	start := daily_unfinished
+	if c.kind == leaderboard.Highest {
+		start = 0
+	}
+	fresh, err := scoreboard.Enter(board, sess.nick, c.kind, start)
+	if err != nil {
+		log.Printf("scores: %v", err)
+		return "The daily challenge can't be recorded right now.\n", nil
+	}
+	if !fresh {
+		return fmt.Sprintf("%s has already had a try at today's challenge. 'daily board' has the results.\n", sess.nick), nil
+	}
+
+	stop_live := go_live(sess, "daily "+c.game)
+	sess.send(clearScreen)
+	score, finished, err := c.play(sess, daily_rng(day))
+	sess.send(resetAttrs + showCursor)
+	stop_live()
+	if err != nil {
+		return "", err
+	}
+
+	if !finished {
+		return fmt.Sprintf("Daily challenge %s: gave up. Come back tomorrow for another.\n", day), nil
+	}
+	if _, err := scoreboard.Submit(board, sess.nick, c.kind, score); err != nil {
+		log.Printf("scores: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Daily challenge %s (%s): %s.", day, c.game, c.format(score))
+	if daily_day(time.Now()) != day {
+		fmt.Fprintf(&b, " That counts for %s, when you started; a new challenge is up now.", day)
+	}
+	fmt.Fprintf(&b, " Streak: %s.\n\n", plural(daily_streak(sess.nick, now), "day"))
+	b.WriteString(daily_table(sess, day, false))
+	return b.String(), nil
+}
+
+// daily_results handles "daily board": today's table so far, and who did
+// best yesterday.
+func daily_results(sess *session, now time.Time) string {
+	today := daily_day(now)
+	yesterday := daily_day(now.AddDate(0, 0, -1))
+	return daily_table(sess, today, false) + "\n" + daily_table(sess, yesterday, true)
+}
+
+// daily_table lists day's results, best first. With winners set only the
+// top three finishers are shown.
+func daily_table(sess *session, day string, winners bool) string {
+	c, _ := daily_for(day)
+	entries, _, ok := scoreboard.Top(daily_board(day), top_max)
+	if !ok {
+		return fmt.Sprintf("Nobody took the %s challenge (%s).\n", day, c.game)
+	}
+
+	var b strings.Builder
+	if winners {
+		fmt.Fprintf(&b, "Winners of %s (%s):\n", day, c.game)
+	} else {
+		fmt.Fprintf(&b, "\033[1mDaily %s\033[0m (%s):\n", day, c.game)
+	}
+
+	medals := []string{fg(255, 215, 0), fg(200, 200, 210), fg(205, 127, 50)}
+	place := 0
+	for _, e := range entries {
+		if winners && e.Plays == 0 {
+			continue
+		}
+		if winners && place == 3 {
+			break
+		}
+
+		// Unfinished attempts rank last, unnumbered.
+		rank, result := "-", "unfinished"
+		if e.Plays > 0 {
+			rank, result = fmt.Sprint(place+1), c.format(e.Best)
+		}
+
+		row := fmt.Sprintf("%4s  %s %-16s streak %d", rank, usertext.Pad(e.Nick, 16), result, daily_streak(e.Nick, time.Now()))
+		if e.Plays > 0 && place < len(medals) && sess.mode != "bw" {
+			row = medals[place] + row + resetAttrs
+		}
+		b.WriteString(row + "\n")
+		if e.Plays > 0 {
+			place++
+		}
+	}
+	if winners && place == 0 {
+		b.WriteString("  nobody finished\n")
+	}
+	return b.String()
+}
+
+func daily_wordle(sess *session, rng *rand.Rand) (float64, bool, error) {
+	g := &wordle_game{sess: sess, answer: wordle.Random(rng), title: "daily challenge", known: map[rune]wordle.Mark{}}
+	quit, err := g.run("Guess a five-letter word, or q to give up.")
+	if err != nil || quit {
+		return 0, false, err
+	}
+
+	// Failing counts as one more guess than allowed, so it ranks last.
+	if !g.solved() {
+		return wordle.Guesses + 1, true, nil
+	}
+	return float64(len(g.guesses)), true, nil
+}
+
+func daily_maze(sess *session, rng *rand.Rand) (float64, bool, error) {
+	g := new_maze_game(rng.Int63()%100000, maze_width, maze_height, false)
+	escaped, err := g.run(sess)
+	if err != nil || !escaped {
+		return 0, false, err
+	}
+	return float64(g.steps - g.shortest()), true, nil
+}
+
+func daily_2048(sess *session, rng *rand.Rand) (float64, bool, error) {
+	g := game2048.New(rng)
+	if _, err := run2048(sess, g); err != nil {
+		return 0, false, err
+	}
+	return float64(g.Score), true, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+func decode_format_status(sess *session) string {
+	if sess.decode_format == "" {
+		return "auto"
+	}
+	return sess.decode_format
+}
+
+// decode_format_command handles "decode-format FORMAT", which has images
+// decoded as FORMAT whatever their first bytes look like, for servers
+// that send something that can't be told apart, and "decode-format auto",
+// which goes back to looking.
+func decode_format_command(sess *session, line string) string {
+	arg := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "decode-format")))
+	switch {
+	case arg == "":
+		return "Decode format: " + decode_format_status(sess) + "\n"
+	case arg == "auto":
+		sess.decode_format = ""
+		return "Decode format: auto. Images are decoded as whatever they look like.\n"
+	case !slices.Contains(fetch.Formats(), arg):
+		return "Usage: decode-format FORMAT, with FORMAT auto or one of " + strings.Join(fetch.Formats(), ", ") + ".\n"
+	}
+	sess.decode_format = arg
+	return "Decode format: " + arg + ". Images are decoded as " + arg + " until 'decode-format auto'.\n"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// decode_test_command handles "decode-test URL", which goes through the
+// steps of rendering an image one by one and says how each went, to find
+// out why one won't render. A step that goes wrong doesn't stop the ones
+// after it where they can still be tried, as rendering doesn't stop for
+// a bad status or content type either.
+func decode_test_command(sess *session, line string) string {
+	url := strings.TrimSpace(strings.TrimPrefix(line, "decode-test"))
+	if url == "" {
+		return "Usage: decode-test URL\n"
+	}
+
+	var b strings.Builder
+	step := func(ok bool, format string, args ...any) {
+		mark := "✓"
+		if !ok {
+			mark = "✗"
+		}
+		fmt.Fprintf(&b, format+" "+mark+"\n", args...)
+	}
+
+	sess.last_url = url
+	resp, err := http_get(sess, url)
+	if err != nil {
+		step(false, "HTTP: failed: %v", err)
+		return b.String()
+	}
+	defer fetch.Close(resp.Body)
+	step(resp.StatusCode >= 200 && resp.StatusCode < 300, "HTTP: %s", resp.Status)
+
+	if kind := resp.Header.Get("Content-Type"); kind != "" {
+		step(strings.HasPrefix(kind, "image/"), "Content-Type: %s", kind)
+	} else {
+		step(false, "Content-Type: missing")
+	}
+
+	var head bytes.Buffer
+	cfg, format, err := image.DecodeConfig(io.TeeReader(resp.Body, &head))
+	if err != nil {
+		step(false, "DecodeConfig: failed: %v", err)
+		return b.String()
+	}
+	step(true, "DecodeConfig: success (%s, %d×%d)", format, cfg.Width, cfg.Height)
+
+	if fetch.OverLimit(cfg.Width, cfg.Height, sess.max_pixels) {
+		big := &fetch.TooLargeError{Width: cfg.Width, Height: cfg.Height, Limit: sess.max_pixels}
+		step(false, "Decode: skipped: the image is %s", big.Size())
+		return b.String()
+	}
+
+	// A decoder that panics on a bad file is a finding, not a crash.
+	func() {
+		defer func() {
+			if v := recover(); v != nil {
+				step(false, "Decode: the decoder panicked: %v", v)
+			}
+		}()
+		if _, _, err := image.Decode(io.MultiReader(&head, resp.Body)); err != nil {
+			step(false, "Decode: failed: %v", err)
+			return
+		}
+		step(true, "Decode: success")
+	}()
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+const (
+	default_decode_timeout = 30
+	max_decode_timeout     = 60
+)
+
+// decode_timeout_sentence is what a client is told of an image that took
+// too long to decode.
+func decode_timeout_sentence(slow *fetch.DecodeTimeoutError) string {
+	return fmt.Sprintf("Decode timeout after %ds\n", int(slow.After/time.Second))
+}
+
+// decode_timeout_command handles "decode-timeout [N]", the most seconds
+// decoding an image may take, however long its download is allowed.
+func decode_timeout_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "decode-timeout"))
+	if arg == "" {
+		return fmt.Sprintf("Decode timeout: %ds\n", sess.decode_timeout)
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > max_decode_timeout {
+		return fmt.Sprintf("Usage: decode-timeout N, where N is 1 to %d seconds.\n", max_decode_timeout)
+	}
+	sess.decode_timeout = n
+	return fmt.Sprintf("Decode timeout: %ds\n", n)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const (
+	demo_usage = "Usage: demo plasma, demo mandelbrot [X Y [ZOOM]], demo julia [X Y [ZOOM]], demo matrix, or demo bench\n"
+
+	// Effects are drawn this many rows tall, at the session's width.
+	demo_rows = 20
+
+	// ZOOM is how many times over the fractals zoom in each second.
+	demo_zoom     = 1.5
+	demo_max_zoom = 10
+
+	// Past this, zooming in further shows float64 running out of
+	// precision rather than more of the fractal, so the zoom starts over.
+	demo_deepest = 1e13
+
+	demo_bench_frames = 100
+)
+
+// A demo_effect draws the frame elapsed into it as a w×h image. make
+// sets one up from what follows its name in the command.
+type demo_effect struct {
+	name  string
+	about string
+	make  func(args []string) (func(elapsed time.Duration, w, h int) *image.RGBA, bool)
+}
+
+var demo_effects = []demo_effect{
+	{"plasma", "sines summed and palette-cycled", func(args []string) (func(time.Duration, int, int) *image.RGBA, bool) {
+		return demo_plasma, len(args) == 0
+	}},
+	{"mandelbrot", "a zoom into the Mandelbrot set", func(args []string) (func(time.Duration, int, int) *image.RGBA, bool) {
+		return demo_fractal(args, -0.743643887037151, 0.131825904205330, nil)
+	}},
+	{"julia", "a zoom into a Julia set", func(args []string) (func(time.Duration, int, int) *image.RGBA, bool) {
+		return demo_fractal(args, 0, 0, &complex_point{-0.8, 0.156})
+	}},
+	{"matrix", "falling green rain", func(args []string) (func(time.Duration, int, int) *image.RGBA, bool) {
+		return demo_matrix(rand.New(rand.NewSource(time.Now().UnixNano()))), len(args) == 0
+	}},
+}
+
+// demo_command handles "demo EFFECT", which animates one of the effects
+// until a key is pressed, and "demo bench", which times them all.
+func demo_command(sess *session, line string) (string, error) {
+	args := strings.Fields(strings.TrimPrefix(line, "demo"))
+	if len(args) == 1 && args[0] == "bench" {
+		return demo_bench(sess)
+	}
+
+	for _, e := range demo_effects {
+		if len(args) == 0 || args[0] != e.name {
+			continue
+		}
+		draw, ok := e.make(args[1:])
+		if !ok {
+			return demo_usage, nil
+		}
+		return animate(sess, "Demo: "+e.about, 0, 0, func(elapsed time.Duration) []string {
+			return renderToStrings(draw(elapsed, sess.width, demo_rows*2), sess.width, 1, sess)
+		})
+	}
+	return demo_usage, nil
+}
+
+// demo_bench draws a fixed number of frames of each effect as fast as
+// they'll go, and reports how fast that was. The frames are sent as
+// usual, so the rates are the whole way from drawing to the connection.
+// The clock each effect is given moves on a frame at a time, so what's
+// drawn doesn't depend on how fast it goes.
+func demo_bench(sess *session) (string, error) {
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(clearScreen + hideCursor)
+	defer sess.send(resetAttrs + showCursor)
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Demo bench, %d frames of each effect at %d×%d in %s:\n", demo_bench_frames, sess.width, demo_rows, sess.mode)
+	for _, e := range demo_effects {
+		draw, _ := e.make(nil)
+		header := animation_header(fmt.Sprintf("Bench: %s", e.name))
+
+		var sent int64
+		start := time.Now()
+		for i := range demo_bench_frames {
+			select {
+			case _, ok := <-keys:
+				if !ok {
+					return "", io.EOF
+				}
+				return "Demo bench stopped.\n", nil
+			default:
+			}
+
+			frame := animation_frame_text(sess, header, renderToStrings(draw(time.Duration(i)*animation_frame, sess.width, demo_rows*2), sess.width, 1, sess))
+			if err := sess.send(frame); err != nil {
+				return "", err
+			}
+			sent += int64(len(frame))
+		}
+		took := time.Since(start).Seconds()
+		stats.rendered.Add(demo_bench_frames)
+
+		fmt.Fprintf(&report, "  %-10s %6.1f frames/s  %8s/s  (%s a frame)\n", e.name,
+			demo_bench_frames/took, human_bytes(int64(float64(sent)/took)), human_bytes(sent/demo_bench_frames))
+	}
+	return report.String(), nil
+}
+
+// demo_plasma is four sine waves added together, which pick a hue off a
+// palette that turns as time goes on.
+func demo_plasma(elapsed time.Duration, w, h int) *image.RGBA {
+	t := elapsed.Seconds()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			fx, fy := float64(x), float64(y)
+			v := math.Sin(fx/16+t) +
+				math.Sin(fy/8+t/2) +
+				math.Sin((fx+fy)/16+t/1.5) +
+				math.Sin(math.Hypot(fx-float64(w)/2, fy-float64(h)/2)/8-t)
+			r, g, b := colorspace.HSVToRGB(v*45+t*40, 1, 1)
+			set_rgb(img, x, y, r, g, b)
+		}
+	}
+	return img
+}
+
+type complex_point struct{ re, im float64 }
+
+// demo_fractal zooms in on X, Y at ZOOM, if they're given. Without a
+// Julia constant it's the Mandelbrot set, where each pixel is the
+// constant and the orbit starts at 0; with one, each pixel is where the
+// orbit starts.
+func demo_fractal(args []string, x, y float64, julia *complex_point) (func(time.Duration, int, int) *image.RGBA, bool) {
+	zoom := demo_zoom
+	var err error
+	switch len(args) {
+	case 3:
+		zoom, err = strconv.ParseFloat(args[2], 64)
+		if err != nil || zoom < 1 || zoom > demo_max_zoom {
+			return nil, false
+		}
+		fallthrough
+	case 2:
+		x, err = strconv.ParseFloat(args[0], 64)
+		if err != nil || math.Abs(x) > 2 {
+			return nil, false
+		}
+		y, err = strconv.ParseFloat(args[1], 64)
+		if err != nil || math.Abs(y) > 2 {
+			return nil, false
+		}
+	case 0:
+	default:
+		return nil, false
+	}
+
+	// A zoom rate of 1 stays put, and the loop would never come round.
+	period := math.Log(demo_deepest) / math.Log(max(zoom, 1+1e-9))
+
+	return func(elapsed time.Duration, w, h int) *image.RGBA {
+		depth := math.Pow(zoom, math.Mod(elapsed.Seconds(), period))
+
+		// Deeper views need more iterations to show their edges.
+		limit := min(64+int(16*math.Log2(depth)), 400)
+
+		// Pixels are about square, and the view starts 3.5 wide.
+		scale := 3.5 / depth / float64(w)
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for py := range h {
+			for px := range w {
+				zr := x + (float64(px)-float64(w)/2)*scale
+				zi := y + (float64(py)-float64(h)/2)*scale
+				cr, ci := zr, zi
+				if julia != nil {
+					cr, ci = julia.re, julia.im
+				} else {
+					zr, zi = 0, 0
+				}
+
+				n := 0
+				for ; n < limit && zr*zr+zi*zi <= 4; n++ {
+					zr, zi = zr*zr-zi*zi+cr, 2*zr*zi+ci
+				}
+				if n == limit {
+					continue
+				}
+
+				// Smoothing the count by how far past the edge the
+				// orbit got stops the colors banding.
+				smooth := float64(n) + 1 - math.Log2(math.Log2(zr*zr+zi*zi)/2)
+				r, g, b := colorspace.HSVToRGB(smooth*10+elapsed.Seconds()*20, 0.8, 1)
+				set_rgb(img, px, py, r, g, b)
+			}
+		}
+		return img
+	}, true
+}
+
+// demo_matrix gives every column of rain a speed and a start of its own,
+// fixed when it begins, so any moment of it can be drawn from the time.
+func demo_matrix(rng *rand.Rand) func(time.Duration, int, int) *image.RGBA {
+	const trail = 16
+
+	var speeds, starts []float64
+	return func(elapsed time.Duration, w, h int) *image.RGBA {
+		for len(speeds) < w {
+			speeds = append(speeds, 8+rng.Float64()*24)
+			starts = append(starts, rng.Float64()*float64(h+trail))
+		}
+
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for x := range w {
+			// The head falls from the top and off the bottom, trailing
+			// a fading tail, and then comes round again.
+			head := math.Mod(starts[x]+elapsed.Seconds()*speeds[x], float64(h+trail))
+			for y := range h {
+				behind := head - float64(y)
+				switch {
+				case behind < 0 || behind >= trail:
+				case behind < 1:
+					set_rgb(img, x, y, 0.8, 1, 0.8)
+				default:
+					set_rgb(img, x, y, 0, 1-behind/trail, 0)
+				}
+			}
+		}
+		return img
+	}
+}
+
+// set_rgb sets the pixel at x, y to r, g and b, each from 0 to 1.
+func set_rgb(img *image.RGBA, x, y int, r, g, b float64) {
+	i := img.PixOffset(x, y)
+	img.Pix[i] = clamp8(int(r * 255))
+	img.Pix[i+1] = clamp8(int(g * 255))
+	img.Pix[i+2] = clamp8(int(b * 255))
+	img.Pix[i+3] = 255
+}
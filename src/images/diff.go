@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const default_diff_threshold = 0.05
+
+// diff_command handles "diff URL1 URL2", drawing where the two images
+// differ. Both are sampled on the grid of a render of the first, so they
+// needn't be the same size.
+func diff_command(sess *session, line string) string {
+	urls := strings.Fields(strings.TrimPrefix(line, "diff"))
+	if len(urls) != 2 {
+		return "Usage: diff URL1 URL2\n"
+	}
+
+	var imgs [2]image.Image
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imgs[i], errs[i] = fetch_image(sess, url, sess.max_pixels)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Sprintf("Couldn't load image %d: %v.\n", i+1, err)
+		}
+	}
+	stats.rendered.Add(2)
+
+	heat, differ := diff_map(imgs[0], imgs[1], sess.width, sess.diff_threshold)
+	pad := align_padding(sess, heat.Bounds().Dx())
+
+	var b strings.Builder
+	for y := range heat.Bounds().Dy() {
+		b.WriteString(pad)
+		for x := range heat.Bounds().Dx() {
+			b.WriteString(pix_to_bw(heat, x, y))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%.1f%% of cells differ by more than %.2f.\n", differ*100, sess.diff_threshold)
+
+	return b.String()
+}
+
+// diff_map compares a and b cell by cell, at the size a would be rendered
+// width columns wide. Each cell of the result is the color distance
+// between them, from 0 to 1. Distances within threshold become black;
+// the rest are lifted into the top half of the range, since the bw
+// converter draws anything darker than that as a space. It also returns
+// the fraction of cells that differ.
+func diff_map(a, b image.Image, width int, threshold float64) (*image.Gray, float64) {
+	ab, bb := a.Bounds(), b.Bounds()
+
+	w := min(ab.Dx(), width)
+	h := max(int(float64(ab.Dy())/float64(ab.Dx())/2*float64(w)), 1)
+
+	heat := image.NewGray(image.Rect(0, 0, w, h))
+	differ := 0
+	for y := range h {
+		for x := range w {
+			d := color_distance(
+				a.At(ab.Min.X+x*ab.Dx()/w, ab.Min.Y+y*ab.Dy()/h),
+				b.At(bb.Min.X+x*bb.Dx()/w, bb.Min.Y+y*bb.Dy()/h))
+			if d <= threshold {
+				continue
+			}
+			differ++
+			heat.SetGray(x, y, color.Gray{Y: uint8(math.Round((0.5 + d/2) * 255))})
+		}
+	}
+
+	return heat, float64(differ) / float64(w*h)
+}
+
+// color_distance is the Euclidean distance between two colors in RGB,
+// scaled so black to white is 1.
+func color_distance(c1, c2 color.Color) float64 {
+	r1, g1, b1, _ := c1.RGBA()
+	r2, g2, b2, _ := c2.RGBA()
+
+	dr := float64(r1) - float64(r2)
+	dg := float64(g1) - float64(g2)
+	db := float64(b1) - float64(b2)
+
+	return math.Sqrt(dr*dr+dg*dg+db*db) / (math.Sqrt(3) * 0xffff)
+}
+
+// diff_threshold_command handles "diff-threshold N".
+func diff_threshold_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "diff-threshold"))
+	if arg == "" {
+		return fmt.Sprintf("Diff threshold: %.2f\n", sess.diff_threshold)
+	}
+
+	t, err := strconv.ParseFloat(arg, 64)
+	if err != nil || t < 0 || t > 1 {
+		return "Usage: diff-threshold N, where N is 0 to 1.\n"
+	}
+
+	sess.diff_threshold = t
+	return fmt.Sprintf("Diff threshold: %.2f\n", t)
+}
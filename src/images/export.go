@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/ansi"
+)
+
+var (
+	httpAddr  = flag.String("http-addr", "", "address to serve exports from over HTTP, like :8080; 'export' is off without one")
+	exportURL = flag.String("export-url", "", "URL export links start with, if not http:// the address a client connected to, on -http-addr's port")
+	exportDir = flag.String("export-dir", "exports", "directory 'export' keeps renders in until they expire")
+	exportTTL = flag.Duration("export-ttl", 24*time.Hour, "how long an export can be fetched for")
+)
+
+const (
+	// What one client can have waiting to be fetched at once.
+	export_max_count = 20
+	export_max_bytes = 4 << 20
+
+	export_sweep = time.Minute
+
+	// An ID is 80 random bits, 16 characters of base32.
+	export_id_bytes = 10
+)
+
+var export_ids = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// exports are what each client has exported that hasn't expired, so that
+// the caps hold for the client however many connections it makes. Only
+// exports made since the server started count.
+var exports = struct {
+	sync.Mutex
+	by_client map[netip.Addr][]export_entry
+}{by_client: map[netip.Addr][]export_entry{}}
+
+type export_entry struct {
+	size    int
+	expires time.Time
+}
+
+func export_path(id string) string {
+	return filepath.Join(*exportDir, id+".ans")
+}
+
+func valid_export_id(id string) bool {
+	b, err := export_ids.DecodeString(id)
+	return err == nil && len(b) == export_id_bytes
+}
+
+// open_exports serves exports over HTTP, if there's an address to, and
+// sweeps away the expired ones.
+func open_exports() {
+	if *httpAddr == "" {
+		return
+	}
+	if err := os.MkdirAll(*exportDir, 0o755); err != nil {
+		log.Fatalf("exports: %v", err)
+	}
+	ln, err := net.Listen("tcp", *httpAddr)
+	if err != nil {
+		log.Fatalf("exports: %v", err)
+	}
+	log.Printf("Serving exports on %s", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /export/{id}", serve_export)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Fatalf("exports: %v", srv.Serve(ln))
+	}()
+	go sweep_exports()
+}
+
+func sweep_exports() {
+	for range time.Tick(export_sweep) {
+		entries, err := os.ReadDir(*exportDir)
+		if err != nil {
+			log.Printf("exports: %v", err)
+			continue
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err == nil && strings.HasSuffix(e.Name(), ".ans") && export_expired(info) {
+				os.Remove(filepath.Join(*exportDir, e.Name()))
+			}
+		}
+
+		exports.Lock()
+		for client := range exports.by_client {
+			export_prune(client)
+		}
+		exports.Unlock()
+	}
+}
+
+func export_expired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) > *exportTTL
+}
+
+// export_prune drops client's expired exports from the count, and the
+// client once it has none. exports must be locked.
+func export_prune(client netip.Addr) {
+	var kept []export_entry
+	for _, e := range exports.by_client[client] {
+		if time.Now().Before(e.expires) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		delete(exports.by_client, client)
+		return
+	}
+	exports.by_client[client] = kept
+}
+
+// serve_export handles GET /export/ID, as the text it was exported as,
+// or with ?format=txt without its colors, or with ?format=html as a page.
+func serve_export(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !valid_export_id(id) {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(export_path(id))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || export_expired(info) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, export_max_bytes))
+	if err != nil {
+		http.Error(w, "couldn't read the export", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	switch r.URL.Query().Get("format") {
+	case "", "ansi":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+	case "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, ansi.Strip(string(data)))
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		fmt.Fprintf(w, export_page, ansi.HTML(string(data)))
+	default:
+		http.Error(w, "format is ansi, txt or html", http.StatusBadRequest)
+	}
+}
+
+// export_page is an export as HTML, in a terminal's colors, with the
+// lines close enough for block characters to meet.
+const export_page = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>tcp-games export</title>
+<style>body{background:#000;color:#e5e5e5}pre{font:14px/1.05 monospace}</style>
+</head><body><pre>%s</pre></body></html>
+`
+
+// export_base is what sess's export links start with.
+func export_base(sess *session) string {
+	if *exportURL != "" {
+		return strings.TrimSuffix(*exportURL, "/")
+	}
+	host, port, _ := net.SplitHostPort(*httpAddr)
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host, _, _ = net.SplitHostPort(sess.conn.LocalAddr().String())
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// export_command handles "export", which keeps the last render or
+// finished game board for fetching over HTTP.
+func export_command(sess *session, _ string) string {
+	if *httpAddr == "" {
+		return "Exports are off on this server.\n"
+	}
+	if sess.last_render == "" {
+		return "Nothing to export yet: render an image or finish a game first.\n"
+	}
+
+	text := ansi.KeepColors(sess.last_render) + resetAttrs
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	if len(text) > export_max_bytes {
+		return "That's too big to export.\n"
+	}
+
+	client := remote_addr(sess.conn)
+	exports.Lock()
+	defer exports.Unlock()
+	export_prune(client)
+	used := 0
+	for _, e := range exports.by_client[client] {
+		used += e.size
+	}
+	if n := len(exports.by_client[client]); n >= export_max_count || used+len(text) > export_max_bytes {
+		return fmt.Sprintf("You have %s of %s waiting already, as much as can wait at once; the oldest expires first.\n",
+			plural(n, "export"), human_bytes(int64(used)))
+	}
+
+	raw := make([]byte, export_id_bytes)
+	rand.Read(raw)
+	id := export_ids.EncodeToString(raw)
+	f, err := os.OpenFile(export_path(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		log.Printf("export: %v", err)
+		return "Couldn't save the export.\n"
+	}
+	_, err = io.WriteString(f, text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("export: %v", err)
+		os.Remove(export_path(id))
+		return "Couldn't save the export.\n"
+	}
+
+	expires := time.Now().Add(*exportTTL)
+	exports.by_client[client] = append(exports.by_client[client], export_entry{len(text), expires})
+	url := export_base(sess) + "/export/" + id
+	return fmt.Sprintf("Exported to %s until %s.\nAdd ?format=html for a web page or ?format=txt for plain text.\n",
+		url, expires.UTC().Format("2006-01-02 15:04 UTC"))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+)
+
+var allowExportDir = flag.String("allow-export-dir", "", "directory 'export-ansi FILENAME' writes renders into, for running locally; without one, there's no export-ansi")
+
+// A name of letters, digits, '_', '-' and '.', not starting with a dot,
+// can't climb out of the directory or hide in it.
+var export_ansi_names = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,63}$`)
+
+// export_ansi_command handles "export-ansi FILENAME", which saves the last
+// render, escapes and all, as FILENAME in -allow-export-dir. A file
+// that's there already is replaced, and nobody reading it ever sees half
+// of one.
+func export_ansi_command(sess *session, line string) string {
+	if *allowExportDir == "" {
+		return "export-ansi is off on this server.\n"
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(line, "export-ansi"))
+	if !export_ansi_names.MatchString(name) {
+		return "Usage: export-ansi FILENAME, with up to 64 letters, digits, '_', '-' or '.', not starting with '.'.\n"
+	}
+	if sess.last_render == "" {
+		return "Nothing to export yet: render an image or finish a game first.\n"
+	}
+
+	path := filepath.Join(*allowExportDir, name)
+	err := os.MkdirAll(*allowExportDir, 0o755)
+	if err == nil {
+		err = atomicfile.Write(path, []byte(sess.last_render), 0o644)
+	}
+	if err != nil {
+		log.Printf("export-ansi: %v", err)
+		return "Couldn't save the export.\n"
+	}
+	return fmt.Sprintf("Saved as %s.\n", path)
+}
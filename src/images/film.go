@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	film_max_frames = 100
+
+	// Frames are shown for between film_min_seconds and film_max_seconds.
+	film_min_seconds = 0.1
+	film_max_seconds = 600
+)
+
+// A film_frame is one line of a film: an image and how long it's shown.
+// Its image is fetched into ready ahead of time.
+type film_frame struct {
+	seconds float64
+	url     string
+
+	started bool
+	ready   chan film_image
+}
+
+type film_image struct {
+	img image.Image
+	err error
+}
+
+// parse_film_line reads one "SECONDS URL" line of a film.
+func parse_film_line(line string) (*film_frame, error) {
+	f := strings.Fields(line)
+	if len(f) != 2 {
+		return nil, fmt.Errorf("a frame is written 'SECONDS URL'")
+	}
+
+	s, err := strconv.ParseFloat(f[0], 64)
+	if err != nil || math.IsNaN(s) || s < film_min_seconds || s > film_max_seconds {
+		return nil, fmt.Errorf("frames last from %g to %g seconds", film_min_seconds, float64(film_max_seconds))
+	}
+	return &film_frame{seconds: s, url: f[1], ready: make(chan film_image, 1)}, nil
+}
+
+// film_command handles "film": the lines after it, up to one holding
+// just ".", are the frames, which are then played in order, each for its
+// own time. While it plays, "pause" holds the current frame until the
+// next line comes in, and "q" stops it.
+func film_command(sess *session, line string) (string, error) {
+	if strings.TrimSpace(strings.TrimPrefix(line, "film")) != "" {
+		return "Usage: film, then one 'SECONDS URL' line per frame, then '.' on its own.\n", nil
+	}
+
+	sess.send(fmt.Sprintf("Enter up to %d frames as 'SECONDS URL', one to a line, and '.' to start the film.\n", film_max_frames))
+	var frames []*film_frame
+	for n := 1; ; n++ {
+		line, err := sess.readLine()
+		if err != nil {
+			return "", err
+		}
+		if line == "." {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		if len(frames) == film_max_frames {
+			sess.send(fmt.Sprintf("Line %d left out: a film has at most %d frames.\n", n, film_max_frames))
+			continue
+		}
+
+		f, err := parse_film_line(line)
+		if err != nil {
+			sess.send(fmt.Sprintf("Line %d left out: %v.\n", n, err))
+			continue
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) == 0 {
+		return "No frames, so no film.\n", nil
+	}
+
+	return play_film(sess, frames)
+}
+
+// fetch starts downloading f's image, unless that's already under way.
+func (f *film_frame) fetch(sess *session) {
+	if f.started {
+		return
+	}
+	f.started = true
+
+	go func() {
+		img, err := fetch_image(sess, f.url, sess.max_pixels)
+		f.ready <- film_image{img, err}
+	}()
+}
+
+func play_film(sess *session, frames []*film_frame) (string, error) {
+	lines, stop := sess.lines()
+	defer stop()
+
+	sess.send(clearScreen)
+	defer sess.send(resetAttrs + showCursor)
+
+	total := 0.0
+	for _, f := range frames {
+		total += f.seconds
+	}
+
+	for i, f := range frames {
+		// The next frame downloads while this one is on screen.
+		f.fetch(sess)
+		if i+1 < len(frames) {
+			frames[i+1].fetch(sess)
+		}
+
+		header := fmt.Sprintf("\033[1mFilm\033[0m   frame %d/%d   %gs of %gs\n\n", i+1, len(frames), f.seconds, total)
+		sess.send(clearScreen + header + "Loading " + f.url + "...\n")
+
+		var got film_image
+		select {
+		case got = <-f.ready:
+		case line, ok := <-lines:
+			if !ok {
+				return "", io.EOF
+			}
+			if line == "q" {
+				return "Film stopped.\n", nil
+			}
+			got = <-f.ready
+		}
+
+		screen := clearScreen + header
+		if got.err != nil {
+			screen += fmt.Sprintf("Couldn't load %s: %v.\n", f.url, got.err)
+		} else {
+			stats.rendered.Add(1)
+			screen += compress(preprocess(got.img, sess), 1, sess)
+		}
+		// The frame is done with, and only the next one is kept.
+		f.ready = nil
+
+		quit, err := hold_frame(sess, lines, screen, sess.next_frame(time.Duration(f.seconds*float64(time.Second))))
+		if err != nil || quit {
+			return "Film stopped.\n", err
+		}
+	}
+
+	return "The end.\n", nil
+}
+
+// hold_frame shows screen for d, or longer if it's paused along the way.
+// It reports whether the viewer asked to stop.
+func hold_frame(sess *session, lines <-chan string, screen string, d time.Duration) (bool, error) {
+	hint := "pause holds this frame, q stops the film.\n"
+	sess.send(screen + hint)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	end := time.Now().Add(d)
+
+	for {
+		select {
+		case <-timer.C:
+			return false, nil
+		case line, ok := <-lines:
+			if !ok {
+				return true, io.EOF
+			}
+			switch line {
+			case "q":
+				return true, nil
+			case "pause":
+			default:
+				continue
+			}
+
+			left := time.Until(end)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			sess.send(screen + "Paused. Type anything to carry on, or q to stop.\n")
+
+			line, ok = <-lines
+			if !ok {
+				return true, io.EOF
+			}
+			if line == "q" {
+				return true, nil
+			}
+
+			sess.send(screen + hint)
+			end = time.Now().Add(left)
+			timer.Reset(left)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// preprocess runs the session's image filters between decoding and
+// compress. Trimming comes first, while margins are still the white or
+// transparency they were. Palette swaps come next, on the colors as
+// decoded. The background image goes under the image next, so the other
+// filters treat the two as one picture. Color temperature goes next, as
+// a correction to the source, and hue rotation and saturation after it,
+// changing the corrected colors. Then auto contrast, so it stretches the
+// colors as they'll be shown, and noise after so it lands on the final
+// pixels rather than being smoothed or stretched by anything else. Color
+// reduce is last of the filters that change the picture, since anything
+// after it would bring back the colors it took out. Showing only
+// luminance or chrominance comes after even that, as a way of looking at
+// the result.
+func preprocess(img image.Image, sess *session) image.Image {
+	if sess.trim {
+		img = apply_trim(img)
+	}
+	if len(sess.palette_swaps) > 0 {
+		img = apply_palette_swaps(img, sess.palette_swaps)
+	}
+	if sess.background != nil && !sess.transparency_check {
+		img = apply_background(img, sess.background)
+	}
+	if sess.color_temp != neutral_color_temp {
+		img = apply_color_temp(img, sess.temp_mult)
+	}
+	if sess.hue_rotate != 0 {
+		img = hue_rotated{img, float64(sess.hue_rotate)}
+	}
+	if sess.saturation != 100 {
+		img = apply_saturation(img, sess.saturation)
+	}
+	if sess.auto_contrast {
+		img = apply_auto_contrast(img, sess.mode != "bw")
+	}
+	if sess.noise > 0 {
+		img = apply_noise(img, sess.noise, rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	if sess.color_reduce > 0 {
+		img = apply_color_reduce(img, sess.color_reduce)
+	}
+	if sess.ycbcr_only != "" && sess.mode != "bw" {
+		img = apply_ycbcr_split(img, sess.ycbcr_only)
+	}
+
+	return img
+}
+
+// to_nrgba copies img into a fresh, non-premultiplied buffer that filters
+// can modify in place.
+func to_nrgba(img image.Image) *image.NRGBA {
+	out := image.NewNRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+func clamp8(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// apply_noise adds independent uniform noise of up to amount percent of
+// the channel range to each of R, G and B. Alpha is left alone.
+func apply_noise(img image.Image, amount int, rng *rand.Rand) image.Image {
+	out := to_nrgba(img)
+
+	spread := amount * 255 / 100
+	for i := 0; i < len(out.Pix); i += 4 {
+		for c := range 3 {
+			delta := rng.Intn(2*spread+1) - spread
+			out.Pix[i+c] = clamp8(int(out.Pix[i+c]) + delta)
+		}
+	}
+
+	return out
+}
+
+// noise_command handles "noise N".
+func noise_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "noise"))
+	if arg == "" {
+		return fmt.Sprintf("Noise: %d%%\n", sess.noise)
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 || n > 100 {
+		return "Usage: noise N, where N is 0 to 100.\n"
+	}
+
+	sess.noise = n
+	if n == 0 {
+		return "Noise off.\n"
+	}
+	return fmt.Sprintf("Noise: %d%%\n", n)
+}
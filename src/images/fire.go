@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fire"
+)
+
+const (
+	fire_max_rows   = 60
+	fire_max_frames = 500
+)
+
+// What each heat, from 0 to 1, is drawn as.
+var fire_stops = []color.RGBA{
+	{0x00, 0x00, 0x00, 0xff}, {0xc0, 0x10, 0x00, 0xff}, {0xff, 0x70, 0x00, 0xff},
+	{0xff, 0xd0, 0x20, 0xff}, {0xff, 0xff, 0xff, 0xff},
+}
+
+// fire_image draws grid a pixel a cell.
+func fire_image(grid [][]float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(grid[0]), len(grid)))
+	for y, row := range grid {
+		for x, heat := range row {
+			r, g, b := palette_at(fire_stops, heat)
+			img.SetRGBA(x, y, color.RGBA{r, g, b, 0xff})
+		}
+	}
+	return img
+}
+
+// fire_command handles "fire WIDTH HEIGHT FRAMES", which plays FRAMES
+// frames of a fire WIDTH columns by HEIGHT rows, as fast as animations
+// go. It's drawn in color whatever the session's mode, unless the server
+// has locked everyone to another. Any key puts it out early.
+func fire_command(sess *session, line string) (string, error) {
+	usage := fmt.Sprintf("Usage: fire WIDTH HEIGHT FRAMES, with WIDTH from %d to %d, HEIGHT from 1 to %d and FRAMES from 1 to %d.\n",
+		*minWidth, *maxWidth, fire_max_rows, fire_max_frames)
+
+	args := strings.Fields(strings.TrimPrefix(line, "fire"))
+	if len(args) != 3 {
+		return usage, nil
+	}
+	w, err1 := strconv.Atoi(args[0])
+	h, err2 := strconv.Atoi(args[1])
+	n, err3 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil || err3 != nil || w != clamp_width(w) || h < 1 || h > fire_max_rows || n < 1 || n > fire_max_frames {
+		return usage, nil
+	}
+
+	if *lockMode == "" || *lockMode == "color" {
+		converter := sess.converter
+		sess.converter = modes["color"]
+		defer func() { sess.converter = converter }()
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(clearScreen + hideCursor)
+	defer sess.send(resetAttrs + showCursor)
+
+	// Each row of text is two of pixels.
+	grid := fire.New(w, h*2)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	header := animation_header("Fire")
+	for i := range n {
+		fire.Step(grid, rng)
+		stats.rendered.Add(1)
+		rows := renderToStrings(fire_image(grid), w, 1, sess)
+		if err := sess.send(animation_frame_text(sess, header, rows)); err != nil {
+			return "", err
+		}
+
+		if i == n-1 {
+			break
+		}
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return "Fire out.\n", nil
+		case <-time.After(sess.next_frame(animation_frame)):
+		}
+	}
+	return "Fire burnt out.\n", nil
+}
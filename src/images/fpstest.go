@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const fps_test_frames = 30
+
+// test_pattern is an image to time renders with when there's no other:
+// every hue across, fading to black down, with something in every cell
+// to change color.
+func test_pattern() image.Image {
+	const w, h = 320, 240
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			r, g, b := colorspace.HSVToRGB(float64(x)*360/w, 1, 1-float64(y)/h)
+			img.Set(x, y, color.RGBA{clamp8(int(r * 255)), clamp8(int(g * 255)), clamp8(int(b * 255)), 0xff})
+		}
+	}
+	return img
+}
+
+// fps_test_command handles "fps-test", which draws the last image asked
+// for, or a test pattern, fps_test_frames times as fast as it can, and
+// times rendering each frame apart from writing it to the connection, so
+// it shows whether it's the server or the link that holds animations
+// back. Neither maxfps nor the frames' own delays apply; a throttle does,
+// as it's part of the link.
+func fps_test_command(sess *session, _ string) (string, error) {
+	img, source := test_pattern(), "a test pattern"
+	if sess.last_url != "" {
+		if got, err := fetch_image(sess, sess.last_url, sess.max_pixels); err == nil {
+			img, source = got, sess.last_url
+		} else {
+			source += fmt.Sprintf(" (%s couldn't be fetched: %v)", sess.last_url, err)
+		}
+	}
+	img = preprocess(img, sess)
+
+	// A recording has no use for the frames.
+	off := sess.off_record.Swap(true)
+	defer sess.off_record.Store(off)
+
+	var rendering, writing time.Duration
+	sent := 0
+	start := time.Now()
+	for range fps_test_frames {
+		t := time.Now()
+		frame := clearScreen + compress(img, 1, sess)
+		rendering += time.Since(t)
+
+		t = time.Now()
+		if err := sess.send(frame); err != nil {
+			return "", err
+		}
+		writing += time.Since(t)
+		sent += len(frame)
+	}
+	total := time.Since(start)
+	stats.rendered.Add(fps_test_frames)
+
+	per := func(d time.Duration) time.Duration {
+		return (d / fps_test_frames).Round(time.Microsecond)
+	}
+	bottleneck := "the connection"
+	if rendering > writing {
+		bottleneck = "rendering"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "frames:     %d of %s at %d columns (%s)\n", fps_test_frames, source, sess.width, sess.mode)
+	fmt.Fprintf(&b, "render:     %s per frame\n", per(rendering))
+	fmt.Fprintf(&b, "write:      %s per frame (%s each)\n", per(writing), human_bytes(int64(sent/fps_test_frames)))
+	fmt.Fprintf(&b, "total:      %s\n", total.Round(time.Millisecond))
+	fmt.Fprintf(&b, "effective:  %.1f frames a second\n", fps_test_frames/total.Seconds())
+	// Were the next frame rendered while the last is written, only the
+	// slower of the two would count.
+	fmt.Fprintf(&b, "max:        about %.1f frames a second, held back by %s\n", fps_test_frames/max(rendering, writing).Seconds(), bottleneck)
+	return b.String(), nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const (
+	mandelbrot_max_zoom = 1000
+
+	// The whole Mandelbrot set, or a Julia set, fits in a view this
+	// wide at a zoom of 1, and a little over two thirds as tall.
+	fractal_span   = 3.2
+	fractal_aspect = 0.7
+
+	fractal_iterations = 64
+)
+
+// A fractal_view is the part of the complex plane a fractal is drawn
+// over: w × h pixels round x + yi, zoom times closer than the whole set.
+type fractal_view struct {
+	x, y, zoom float64
+	w, h       int
+}
+
+func new_fractal_view(sess *session, x, y, zoom float64) fractal_view {
+	return fractal_view{x, y, zoom, sess.width, int(float64(sess.width) * fractal_aspect)}
+}
+
+// escape_map works out escape for the point under every pixel of v, by
+// rows.
+func escape_map(v fractal_view, escape func(re, im float64) float64) [][]float64 {
+	step := fractal_span / v.zoom / float64(v.w)
+	rows := make([][]float64, v.h)
+	for py := range rows {
+		rows[py] = make([]float64, v.w)
+		for px := range rows[py] {
+			rows[py][px] = escape(v.x+(float64(px)-float64(v.w)/2)*step, v.y+(float64(py)-float64(v.h)/2)*step)
+		}
+	}
+	return rows
+}
+
+// escape_time is how many rounds of z = z² + c it takes z, starting from
+// zr + zi·i, to get far enough out that it never comes back, smoothed so
+// that the bands between counts blend; -1 if it's still close after n.
+func escape_time(zr, zi, cr, ci float64, n int) float64 {
+	for i := range n {
+		zr, zi = zr*zr-zi*zi+cr, 2*zr*zi+ci
+		if zr*zr+zi*zi > 16 {
+			return float64(i) + 1 - math.Log2(math.Log2(zr*zr+zi*zi)/2)
+		}
+	}
+	return -1
+}
+
+// A fractal is an escape map as an image. Points that escape are colored
+// by how quickly, from dark blue through the hues to bright near the
+// edge of the set; the set itself is inside.
+type fractal struct {
+	escapes    [][]float64
+	iterations int
+	inside     color.RGBA
+}
+
+func (f fractal) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (f fractal) Bounds() image.Rectangle {
+	if len(f.escapes) == 0 {
+		return image.Rectangle{}
+	}
+	return image.Rect(0, 0, len(f.escapes[0]), len(f.escapes))
+}
+
+func (f fractal) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(f.Bounds()) {
+		return color.RGBA{}
+	}
+	e := f.escapes[y][x]
+	if e < 0 {
+		return f.inside
+	}
+	t := min(max(math.Log1p(e)/math.Log1p(float64(f.iterations)), 0), 1)
+	r, g, b := colorspace.HSVToRGB(240+360*t, 0.85, t)
+	return color.RGBA{clamp8(int(r * 255)), clamp8(int(g * 255)), clamp8(int(b * 255)), 0xff}
+}
+
+// render_fractal draws v of the fractal escape gives, as the last
+// render, with caption under it.
+func render_fractal(sess *session, v fractal_view, iterations int, escape func(re, im float64) float64, caption string) string {
+	f := fractal{escapes: escape_map(v, escape), iterations: iterations, inside: color.RGBA{0, 0, 0, 0xff}}
+	// Black is a blank in bw, where the set should stand out.
+	if sess.mode == "bw" {
+		f.inside = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	}
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(preprocess(f, sess), 1, sess)
+	return sess.last_render + caption
+}
+
+// parse_floats reads args as numbers, each of which must be from lo to
+// hi.
+func parse_floats(args []string, lo, hi []float64) ([]float64, bool) {
+	out := make([]float64, len(args))
+	for i, arg := range args {
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil || !(n >= lo[i] && n <= hi[i]) {
+			return nil, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+// mandelbrot_command handles "mandelbrot [X Y ZOOM]", which draws the
+// Mandelbrot set centered on X + Yi, magnified ZOOM times, at the
+// session's width. With no arguments it's the whole set.
+func mandelbrot_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "mandelbrot"))
+	usage := fmt.Sprintf("Usage: mandelbrot, or mandelbrot X Y ZOOM, with X and Y from -2 to 2 and ZOOM from 1 to %d.\n", mandelbrot_max_zoom)
+
+	x, y, zoom := -0.6, 0.0, 1.0
+	switch len(args) {
+	case 0:
+	case 3:
+		n, ok := parse_floats(args, []float64{-2, -2, 1}, []float64{2, 2, mandelbrot_max_zoom})
+		if !ok {
+			return usage
+		}
+		x, y, zoom = n[0], n[1], n[2]
+	default:
+		return usage
+	}
+
+	// Deeper in, points take longer to tell apart.
+	iterations := fractal_iterations + int(32*math.Log2(zoom))
+	escape := func(re, im float64) float64 {
+		return escape_time(0, 0, re, im, iterations)
+	}
+	return render_fractal(sess, new_fractal_view(sess, x, y, zoom), iterations, escape,
+		fmt.Sprintf("Mandelbrot set at %g%+gi, zoom %g.\n", x, y, zoom))
+}
+
+// julia_command handles "julia [CR CI]", which draws the Julia set for
+// the constant CR + CI·i, as mandelbrot draws its set.
+func julia_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "julia"))
+
+	cr, ci := -0.7, 0.27015
+	switch len(args) {
+	case 0:
+	case 2:
+		n, ok := parse_floats(args, []float64{-2, -2}, []float64{2, 2})
+		if !ok {
+			return "Usage: julia, or julia CR CI, with CR and CI from -2 to 2.\n"
+		}
+		cr, ci = n[0], n[1]
+	default:
+		return "Usage: julia, or julia CR CI, with CR and CI from -2 to 2.\n"
+	}
+
+	escape := func(re, im float64) float64 {
+		return escape_time(re, im, cr, ci, fractal_iterations*2)
+	}
+	return render_fractal(sess, new_fractal_view(sess, 0, 0, 1), fractal_iterations*2, escape,
+		fmt.Sprintf("Julia set for c = %g%+gi.\n", cr, ci))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	clearScreen = "\033[2J\033[H"
+	cursorHome  = "\033[H"
+	clearLine   = "\033[K"
+	clearBelow  = "\033[J"
+	hideCursor  = "\033[?25l"
+	showCursor  = "\033[?25h"
+	resetAttrs  = "\033[0m"
+)
+
+// A game takes over the connection until it finishes, then returns a line
+// to print back at the normal prompt. args are the words after the game's
+// name in the play command.
+type game func(sess *session, args []string) (string, error)
+
+var games = map[string]game{
+	"2048":       play2048,
+	"battleship": play_battleship,
+	"canvas":     play_canvas,
+	"checkers":   play_checkers,
+	"chess":      play_chess,
+	"maze":       play_maze,
+	"memory":     play_memory,
+	"reversi":    play_reversi,
+	"pong":       play_pong,
+	"rogue":      play_rogue,
+	"snake":      play_snake,
+	"trivia":     play_trivia,
+	"tetris":     play_tetris,
+	"typing":     play_typing,
+	"wordle":     play_wordle,
+}
+
+func game_names() string {
+	var names []string
+	for name := range games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// play_command handles "play NAME [ARGS...]".
+func play_command(sess *session, line string) (string, error) {
+	args := strings.Fields(strings.TrimPrefix(line, "play"))
+	if len(args) == 0 {
+		return fmt.Sprintf("Usage: play GAME. Games: %s.\n", game_names()), nil
+	}
+
+	g, ok := games[args[0]]
+	if !ok {
+		return fmt.Sprintf("Unknown game. Try one of: %s.\n", game_names()), nil
+	}
+
+	stop_live := go_live(sess, args[0])
+	defer stop_live()
+
+	sess.send(clearScreen)
+	msg, err := g(sess, args[1:])
+
+	// The last screen is the finished board, for 'export'.
+	if board := sess.live.Load().last_frame(); board != "" {
+		sess.last_render = board
+	}
+	sess.send(resetAttrs + showCursor)
+	return msg, err
+}
+
+// keys splits a line of input into single keypresses. Arrow keys become
+// 'w', 'a', 's' and 'd' so games only have to handle one spelling.
+func keys(line string) []rune {
+	var out []rune
+
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\033' && i+2 < len(line) && (line[i+1] == '[' || line[i+1] == 'O') {
+			if k, ok := arrows[line[i+2]]; ok {
+				out = append(out, k)
+				i += 2
+				continue
+			}
+		}
+
+		if line[i] > ' ' && line[i] < 0x7f {
+			out = append(out, unicode.ToLower(rune(line[i])))
+		}
+	}
+
+	return out
+}
+
+var arrows = map[byte]rune{'A': 'w', 'B': 's', 'C': 'd', 'D': 'a'}
+
+func fg(r, g, b int) string {
+	return fmt.Sprintf("\033[38;2;%d;%d;%dm", r, g, b)
+}
+
+func bg(r, g, b int) string {
+	return fmt.Sprintf("\033[48;2;%d;%d;%dm", r, g, b)
+}
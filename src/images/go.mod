@@ -2,4 +2,13 @@ module github.com/atalii/image-server-thing
 
 go 1.22.6
 
-require golang.org/x/image v0.20.0 // indirect
+require (
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.27.0
+	golang.org/x/image v0.20.0
+	golang.org/x/net v0.29.0
+	golang.org/x/text v0.18.0
+	golang.org/x/time v0.6.0
+)
+
+require golang.org/x/sys v0.25.0 // indirect
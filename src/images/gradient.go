@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/canvas"
+)
+
+// gradient_at is how far along a gradient in direction the pixel at x, y
+// of a w×h image is, from 0 to 1.
+var gradient_at = map[string]func(x, y, w, h int) float64{
+	"horizontal": func(x, _, w, _ int) float64 { return float64(x) / float64(max(w-1, 1)) },
+	"vertical":   func(_, y, _, h int) float64 { return float64(y) / float64(max(h-1, 1)) },
+	"diagonal": func(x, y, w, h int) float64 {
+		return (float64(x)/float64(max(w-1, 1)) + float64(y)/float64(max(h-1, 1))) / 2
+	},
+}
+
+// gradient_image is a w×h image shading from c1 to c2 in direction.
+func gradient_image(direction string, c1, c2 canvas.Color, w, h int) *image.RGBA {
+	at := gradient_at[direction]
+	mix := func(a, b uint8, t float64) uint8 {
+		return clamp8(int(math.Round(float64(a) + (float64(b)-float64(a))*t)))
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			t := at(x, y, w, h)
+			img.SetRGBA(x, y, color.RGBA{mix(c1.R, c2.R, t), mix(c1.G, c2.G, t), mix(c1.B, c2.B, t), 0xff})
+		}
+	}
+	return img
+}
+
+// gradient_command handles "gradient DIRECTION C1 C2", which draws a
+// gradient from one #RRGGBB color to the other, across, down or
+// corner to corner, in the session's mode at its width and height, or
+// demo_rows rows if the height is left to the image.
+func gradient_command(sess *session, line string) string {
+	const usage = "Usage: gradient horizontal|vertical|diagonal C1 C2, with colors as RRGGBB in hex.\n"
+
+	args := strings.Fields(strings.TrimPrefix(line, "gradient"))
+	if len(args) != 3 || gradient_at[strings.ToLower(args[0])] == nil {
+		return usage
+	}
+	c1, err1 := canvas.ParseColor(args[1])
+	c2, err2 := canvas.ParseColor(args[2])
+	if err1 != nil || err2 != nil {
+		return usage
+	}
+
+	rows := sess.height
+	if rows == 0 {
+		rows = demo_rows
+	}
+	img := gradient_image(strings.ToLower(args[0]), c1, c2, sess.width, max(int(float64(rows)*sess.aspect), 1))
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(img, 1, sess)
+	return sess.last_render
+}
@@ -0,0 +1,113 @@
+// Package ansi shrinks rendered output without changing how it looks,
+// and turns it into plain text or HTML.
+package ansi
+
+import "strings"
+
+// A render sets the color of every cell, although neighbouring cells are
+// mostly the same color. Compactor drops an SGR sequence (the escapes that
+// set colors and attributes) when it's the same as the one before it, as
+// it would change nothing. Runs of a color then come out as plain
+// repeated glyphs, which every terminal understands; REP would be shorter
+// still, but PuTTY and the Linux console don't implement it.
+//
+// Spaces at the end of a line are dropped as well, where no attribute is
+// in effect that would make them visible.
+//
+// A Compactor carries its state from one line to the next, so it must see
+// the whole of a render, in order, and nothing else in between.
+type Compactor struct {
+	// last is the SGR sequence last written, if no other one has been
+	// written since.
+	last string
+}
+
+// Line returns line, a single row of output, compacted.
+func (c *Compactor) Line(line string) string {
+	line = trim_spaces(line)
+
+	var b strings.Builder
+	b.Grow(len(line))
+	for len(line) > 0 {
+		n := escape_length(line)
+		if n == 0 {
+			i := strings.IndexByte(line, '\033')
+			if i < 0 {
+				i = len(line)
+			}
+			if i == 0 {
+				i = 1
+			}
+			b.WriteString(line[:i])
+			line = line[i:]
+			continue
+		}
+
+		seq := line[:n]
+		line = line[n:]
+		if is_sgr(seq) {
+			if seq == c.last {
+				continue
+			}
+			c.last = seq
+		}
+		b.WriteString(seq)
+	}
+	return b.String()
+}
+
+// escape_length returns the length of the CSI sequence s starts with, or
+// 0 if it doesn't start with a complete one.
+func escape_length(s string) int {
+	if !strings.HasPrefix(s, "\033[") {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 0x40 && c <= 0x7e:
+			return i + 1
+		case c < 0x20 || c > 0x3f:
+			return 0
+		}
+	}
+	return 0
+}
+
+func is_sgr(seq string) bool {
+	return strings.HasSuffix(seq, "m")
+}
+
+const reset = "\033[0m"
+
+// trim_spaces drops the spaces at the end of line, up to a final reset,
+// as long as nothing is styling them: either the line has no SGR sequence
+// before them, or the last one is a reset.
+func trim_spaces(line string) string {
+	body, tail := line, ""
+	if strings.HasSuffix(body, reset) {
+		body, tail = body[:len(body)-len(reset)], reset
+	}
+
+	text := strings.TrimRight(body, " ")
+	if len(text) == len(body) {
+		return line
+	}
+	if sgr := last_sgr(text); sgr != "" && sgr != reset {
+		return line
+	}
+	return text + tail
+}
+
+// last_sgr returns the last SGR sequence in s, or "" if it has none.
+func last_sgr(s string) string {
+	last := ""
+	for i := 0; i < len(s); i++ {
+		if n := escape_length(s[i:]); n > 0 {
+			if is_sgr(s[i : i+n]) {
+				last = s[i : i+n]
+			}
+			i += n - 1
+		}
+	}
+	return last
+}
@@ -0,0 +1,256 @@
+package ansi
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// cell is what a terminal shows in one place on the screen.
+type cell struct {
+	glyph rune
+	style style
+}
+
+type style struct {
+	fg, bg string
+	bold   bool
+}
+
+// screen plays output on a minimal terminal, enough for what renders use:
+// text, newlines and the SGR codes for bold and colors. Spaces left in
+// the default style at the end of a line look like nothing at all, so
+// they're left off.
+func screen(t *testing.T, out string) [][]cell {
+	var rows [][]cell
+	var row []cell
+	var st style
+	for len(out) > 0 {
+		if n := escape_length(out); n > 0 {
+			seq := out[2 : n-1]
+			if out[n-1] != 'm' {
+				t.Fatalf("unexpected escape %q", out[:n])
+			}
+			st = apply(t, st, seq)
+			out = out[n:]
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(out)
+		out = out[size:]
+		if r == '\n' {
+			rows = append(rows, trim_row(row))
+			row = nil
+			continue
+		}
+		row = append(row, cell{r, st})
+	}
+	return append(rows, trim_row(row))
+}
+
+func trim_row(row []cell) []cell {
+	for len(row) > 0 {
+		c := row[len(row)-1]
+		if c.glyph != ' ' || c.style.bg != "" || c.style.bold {
+			break
+		}
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+func apply(t *testing.T, st style, seq string) style {
+	params := strings.Split(seq, ";")
+	for i := 0; i < len(params); i++ {
+		n, err := strconv.Atoi(params[i])
+		if params[i] == "" {
+			n, err = 0, nil
+		}
+		if err != nil {
+			t.Fatalf("bad SGR %q", seq)
+		}
+
+		switch {
+		case n == 0:
+			st = style{}
+		case n == 1:
+			st.bold = true
+		case n >= 30 && n <= 37 || n >= 90 && n <= 97:
+			st.fg = params[i]
+		case n >= 40 && n <= 47:
+			st.bg = params[i]
+		case (n == 38 || n == 48) && i+4 < len(params) && params[i+1] == "2":
+			color := strings.Join(params[i+2:i+5], ";")
+			if n == 38 {
+				st.fg = color
+			} else {
+				st.bg = color
+			}
+			i += 4
+		default:
+			t.Fatalf("unhandled SGR %q", seq)
+		}
+	}
+	return st
+}
+
+// sample is an image as a function of coordinates.
+type sample struct {
+	name  string
+	color func(x, y int) (r, g, b int)
+}
+
+var samples = []sample{
+	// A logo: a few flat shapes on a dark background.
+	{"flat logo", func(x, y int) (int, int, int) {
+		switch dx, dy := x-60, (y-20)*2; {
+		case dx*dx+dy*dy < 30*30:
+			return 220, 40, 40
+		case y > 34 && y < 38:
+			return 240, 240, 250
+		}
+		return 0, 0, 0
+	}},
+	// A photo: a smooth sky over grainy ground, so neighbours are often
+	// close but only equal in the sky.
+	{"photo", func() func(x, y int) (int, int, int) {
+		rng := rand.New(rand.NewSource(1))
+		return func(x, y int) (int, int, int) {
+			if y < height/2 {
+				return 90 + y*2, 140 + y*2, 230
+			}
+			g := rng.Intn(8)
+			return 60 + int(30*math.Sin(float64(x)/7)) + g, 110 + g, 40 + g
+		}
+	}()},
+	// Noise: no two neighbours alike, the worst case.
+	{"noise", func() func(x, y int) (int, int, int) {
+		rng := rand.New(rand.NewSource(2))
+		return func(int, int) (int, int, int) {
+			return rng.Intn(256), rng.Intn(256), rng.Intn(256)
+		}
+	}()},
+}
+
+const width, height = 120, 40
+
+// color_render draws s the way the color mode does, one escape a cell.
+func color_render(s sample) []string {
+	lines := make([]string, height)
+	for y := range height {
+		var b strings.Builder
+		for x := range width {
+			r, g, bl := s.color(x, y)
+			fmt.Fprintf(&b, "\033[38;2;%d;%d;%dm█", r, g, bl)
+		}
+		lines[y] = b.String() + reset
+	}
+	return lines
+}
+
+// bw_render draws s the way the bw mode does, with a watermark in the
+// bottom-left corner.
+func bw_render(s sample) []string {
+	chars := []rune{' ', '░', '▒', '▓'}
+	lines := make([]string, height)
+	for y := range height {
+		var b strings.Builder
+		for x := range width {
+			r, g, bl := s.color(x, y)
+			light := (r + g + bl) / 3
+			if y == height-1 && x < 4 {
+				b.WriteString("\033[1;97;40m" + string("mark"[x]) + reset)
+				continue
+			}
+			b.WriteRune(chars[min(light*len(chars)/256, len(chars)-1)])
+		}
+		lines[y] = b.String() + reset
+	}
+	return lines
+}
+
+func compact(lines []string) string {
+	var c Compactor
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(c.Line(l) + "\n")
+	}
+	return b.String()
+}
+
+func check(t *testing.T, raw, out string) {
+	t.Helper()
+	want, got := screen(t, raw), screen(t, out)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("compacted output looks different")
+	}
+}
+
+func TestCompactorSavings(t *testing.T) {
+	for _, s := range samples {
+		for _, mode := range []struct {
+			name   string
+			render func(sample) []string
+			// least is the fraction of bytes that must be saved.
+			least map[string]float64
+		}{
+			{"color", color_render, map[string]float64{"flat logo": 0.8, "photo": 0.3, "noise": 0}},
+			{"bw", bw_render, map[string]float64{"flat logo": 0.2, "photo": 0, "noise": 0}},
+		} {
+			lines := mode.render(s)
+			raw := strings.Join(lines, "\n") + "\n"
+			out := compact(lines)
+			check(t, raw, out)
+
+			saved := 1 - float64(len(out))/float64(len(raw))
+			t.Logf("%-5s %-9s %7d -> %7d bytes (%.0f%% saved)", mode.name, s.name, len(raw), len(out), saved*100)
+			if saved < mode.least[s.name] {
+				t.Errorf("%s %s: saved %.0f%%, want at least %.0f%%", mode.name, s.name, saved*100, mode.least[s.name]*100)
+			}
+			if len(out) > len(raw) {
+				t.Errorf("%s %s: output grew", mode.name, s.name)
+			}
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	red := "\033[38;2;255;0;0m"
+	blue := "\033[38;2;0;0;255m"
+	bg := "\033[40m"
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"repeated color", red + "█" + red + "█" + blue + "█" + reset, red + "██" + blue + "█" + reset},
+		{"trailing spaces", "░▒   " + reset, "░▒" + reset},
+		{"spaces after a reset", bg + "x" + reset + "  " + reset, bg + "x" + reset},
+		{"spaces with a background", bg + "x  " + reset, bg + "x  " + reset},
+		{"all spaces", "    ", ""},
+		{"unfinished escape", "a\033[3", "a\033[3"},
+	}
+
+	for _, tt := range tests {
+		var c Compactor
+		if got := c.Line(tt.in); got != tt.want {
+			t.Errorf("%s: Line(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+// The color a line ends on carries over to the next.
+func TestAcrossLines(t *testing.T) {
+	var c Compactor
+	red := "\033[38;2;255;0;0m"
+	c.Line(red + "█")
+	if got := c.Line(red + "█"); got != "█" {
+		t.Errorf("second line = %q, want the color left out", got)
+	}
+	if got := c.Line(reset + "░" + reset); got != reset+"░" {
+		t.Errorf("third line = %q, want the repeated reset left out", got)
+	}
+}
@@ -0,0 +1,218 @@
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Strip returns s with every escape sequence taken out, leaving the text.
+func Strip(s string) string {
+	return filter(s, func(string) bool { return false })
+}
+
+// KeepColors returns s with every escape sequence but SGR taken out, so
+// that what's left moves no cursor and clears nothing: a screen drawn
+// from the top comes out as plain colored lines.
+func KeepColors(s string) string {
+	return filter(s, is_sgr)
+}
+
+// filter keeps the escape sequences in s that keep reports true for. An
+// escape character that doesn't start a complete sequence goes too.
+func filter(s string, keep func(seq string) bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\033')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+
+		n := max(escape_length(s), 1)
+		if n > 1 && keep(s[:n]) {
+			b.WriteString(s[:n])
+		}
+		s = s[n:]
+	}
+	return b.String()
+}
+
+// basic_colors are how xterm shows the eight colors and their bright
+// versions.
+var basic_colors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// html_style is the SGR state, with colors as CSS.
+type html_style struct {
+	fg, bg  string
+	bold    bool
+	reverse bool
+}
+
+func (st html_style) css() string {
+	fg, bg := st.fg, st.bg
+	if st.reverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#000000"
+		}
+		if bg == "" {
+			bg = "#e5e5e5"
+		}
+	}
+
+	var css []string
+	if fg != "" {
+		css = append(css, "color:"+fg)
+	}
+	if bg != "" {
+		css = append(css, "background:"+bg)
+	}
+	if st.bold {
+		css = append(css, "font-weight:bold")
+	}
+	return strings.Join(css, ";")
+}
+
+// HTML returns s as HTML, to go in a <pre>: its text escaped, and its
+// colors and bold as styled spans. Escape sequences other than SGR are
+// left out.
+func HTML(s string) string {
+	var b strings.Builder
+	var st html_style
+	open := false
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\033')
+		if i < 0 {
+			i = len(s)
+		}
+		b.WriteString(html.EscapeString(s[:i]))
+		s = s[i:]
+		if s == "" {
+			break
+		}
+
+		n := max(escape_length(s), 1)
+		seq := s[:n]
+		s = s[n:]
+		if n == 1 || !is_sgr(seq) {
+			continue
+		}
+
+		next := apply_sgr(st, seq[2:n-1])
+		if next == st {
+			continue
+		}
+		st = next
+		if open {
+			b.WriteString("</span>")
+		}
+		css := st.css()
+		open = css != ""
+		if open {
+			fmt.Fprintf(&b, `<span style="%s">`, css)
+		}
+	}
+	if open {
+		b.WriteString("</span>")
+	}
+	return b.String()
+}
+
+// apply_sgr is st after the SGR parameters params.
+func apply_sgr(st html_style, params string) html_style {
+	p := strings.Split(params, ";")
+	num := func(i int) int {
+		if i >= len(p) {
+			return -1
+		}
+		if p[i] == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(p[i])
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+
+	for i := 0; i < len(p); i++ {
+		switch n := num(i); {
+		case n == 0:
+			st = html_style{}
+		case n == 1:
+			st.bold = true
+		case n == 22:
+			st.bold = false
+		case n == 7:
+			st.reverse = true
+		case n == 27:
+			st.reverse = false
+		case n >= 30 && n <= 37:
+			st.fg = basic_colors[n-30]
+		case n >= 90 && n <= 97:
+			st.fg = basic_colors[n-90+8]
+		case n == 39:
+			st.fg = ""
+		case n >= 40 && n <= 47:
+			st.bg = basic_colors[n-40]
+		case n >= 100 && n <= 107:
+			st.bg = basic_colors[n-100+8]
+		case n == 49:
+			st.bg = ""
+		case n == 38 || n == 48:
+			var c string
+			switch num(i + 1) {
+			case 2:
+				r, g, b := num(i+2), num(i+3), num(i+4)
+				if r < 0 || g < 0 || b < 0 {
+					return st
+				}
+				c = fmt.Sprintf("#%02x%02x%02x", min(r, 255), min(g, 255), min(b, 255))
+				i += 4
+			case 5:
+				if num(i+2) < 0 {
+					return st
+				}
+				c = color256(num(i + 2))
+				i += 2
+			default:
+				return st
+			}
+			if n == 38 {
+				st.fg = c
+			} else {
+				st.bg = c
+			}
+		}
+	}
+	return st
+}
+
+// color256 is color n of xterm's 256: the basic 16, a 6×6×6 cube, then
+// 24 grays.
+func color256(n int) string {
+	switch {
+	case n < 16:
+		return basic_colors[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + 40*v
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		v := 8 + 10*(min(n, 255)-232)
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
@@ -0,0 +1,42 @@
+package ansi
+
+import "testing"
+
+func TestStrip(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":                               "plain",
+		"\033[38;2;1;2;3m█\033[0m\n":          "█\n",
+		"\033[2J\033[Hboard\033[K\n\033[5;1H": "board\n",
+		"cut off \033[38;2":                   "cut off [38;2",
+		"lone \033 escape":                    "lone  escape",
+	} {
+		if got := Strip(in); got != want {
+			t.Errorf("Strip(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestKeepColors(t *testing.T) {
+	in := "\033[2J\033[H\033[?25l\033[1;97;44m 2 \033[0m\033[K\n"
+	if got, want := KeepColors(in), "\033[1;97;44m 2 \033[0m\n"; got != want {
+		t.Errorf("KeepColors(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"a < b & c", "a &lt; b &amp; c"},
+		{"\033[38;2;255;0;16m█\033[0m\n", `<span style="color:#ff0010">█</span>` + "\n"},
+		// A repeated color doesn't open a new span.
+		{"\033[31mx\033[31my\033[0m", `<span style="color:#cd0000">xy</span>`},
+		{"\033[1;97;44m2\033[22mz", `<span style="color:#ffffff;background:#0000ee;font-weight:bold">2</span><span style="color:#ffffff;background:#0000ee">z</span>`},
+		{"\033[7mr\033[27m.", `<span style="color:#000000;background:#e5e5e5">r</span>.`},
+		{"\033[38;5;196m!\033[38;5;244m?\033[m", `<span style="color:#ff0000">!</span><span style="color:#808080">?</span>`},
+		{"\033[48;2;0;0;0m \033[49m\033[2J.", `<span style="background:#000000"> </span>.`},
+		{"\033[38;2;1mbad", "bad"},
+	} {
+		if got := HTML(tt.in); got != tt.want {
+			t.Errorf("HTML(%q) =\n%s\nwant\n%s", tt.in, got, tt.want)
+		}
+	}
+}
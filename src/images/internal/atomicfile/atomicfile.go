@@ -0,0 +1,64 @@
+// Package atomicfile keeps files that are rewritten whole: writes go to a
+// temporary file beside the real one and are renamed into place, so a
+// crash mid-write leaves the old version intact, and a file that doesn't
+// load is moved aside rather than overwritten.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Write writes data to path, with perm, by way of a file beside it, so
+// that the file at path is always one whole version or another. path's
+// directory has to exist.
+func Write(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads path and hands it to parse. A file that isn't there isn't an
+// error; parse just isn't called. If parse fails, the file is renamed to
+// path.corrupt-TIMESTAMP, so the next Write doesn't lose it, and that name
+// is returned instead of an error.
+func Load(path string, parse func([]byte) error) (backup string, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if parse(data) == nil {
+		return "", nil
+	}
+	backup = fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
@@ -0,0 +1,61 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.json")
+
+	for _, data := range []string{"one", "two"} {
+		if err := Write(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != data {
+			t.Errorf("read back %q, want %q", got, data)
+		}
+	}
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("mode %v, %v; want 0600", fi.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d files left behind, want just the one", len(entries))
+	}
+
+	if err := Write(filepath.Join(dir, "missing", "f"), nil, 0o600); err == nil {
+		t.Error("wrote into a directory that isn't there")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.json")
+
+	called := false
+	if backup, err := Load(path, func([]byte) error { called = true; return nil }); backup != "" || err != nil || called {
+		t.Errorf("missing file: %q, %v, parsed %v", backup, err, called)
+	}
+
+	os.WriteFile(path, []byte("good"), 0o600)
+	var got string
+	if backup, err := Load(path, func(b []byte) error { got = string(b); return nil }); backup != "" || err != nil || got != "good" {
+		t.Errorf("good file: %q, %v, read %q", backup, err, got)
+	}
+
+	backup, err := Load(path, func([]byte) error { return errors.New("bad") })
+	if err != nil || !strings.HasPrefix(backup, path+".corrupt-") {
+		t.Fatalf("bad file: %q, %v", backup, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("bad file left in place")
+	}
+	if data, _ := os.ReadFile(backup); string(data) != "good" {
+		t.Errorf("backup holds %q", data)
+	}
+}
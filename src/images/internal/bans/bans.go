@@ -0,0 +1,193 @@
+// Package bans keeps the addresses a server turns away, and optionally
+// saves them to a JSON file so they outlive it.
+package bans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+)
+
+// A Ban turns away every address in Net. It lasts until Until, or for
+// good if that's zero.
+type Ban struct {
+	Net    netip.Prefix `json:"net"`
+	Until  time.Time    `json:"until"`
+	Reason string       `json:"reason,omitempty"`
+	By     string       `json:"by"`
+	When   time.Time    `json:"when"`
+}
+
+// Expired reports whether b is over at now.
+func (b Ban) Expired(now time.Time) bool {
+	return !b.Until.IsZero() && !now.Before(b.Until)
+}
+
+// A Store is safe for concurrent use. If it has a path, every change is
+// written straight back to it.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	bans map[netip.Prefix]Ban
+}
+
+var ErrTarget = errors.New("give an IP address, like 203.0.113.7, or a range, like 203.0.113.0/24")
+
+// ParseTarget reads an address, which stands for itself alone, or a
+// range in CIDR notation. IPv4 addresses written in IPv6 form are taken
+// as IPv4, as that's how they're matched.
+func ParseTarget(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, ErrTarget
+		}
+		if p.Addr().Is4In6() && p.Bits() >= 96 {
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		return p.Masked(), nil
+	}
+
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, ErrTarget
+	}
+	a = a.Unmap().WithZone("")
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// Open loads the bans saved at path, or starts with none if there is no
+// file yet; an empty path keeps them in memory only. Bans that ran out
+// while the server was down are dropped.
+func Open(path string, now time.Time) (*Store, error) {
+	s := &Store{path: path, bans: map[netip.Prefix]Ban{}}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Ban
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, b := range list {
+		if !b.Net.IsValid() {
+			return nil, fmt.Errorf("%s: a ban has no address", path)
+		}
+		if !b.Expired(now) {
+			s.bans[b.Net.Masked()] = b
+		}
+	}
+	return s, nil
+}
+
+// Add bans b.Net, replacing any ban on exactly that range.
+func (s *Store) Add(b Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b.Net = b.Net.Masked()
+	s.bans[b.Net] = b
+	return s.save()
+}
+
+// Remove lifts the ban on exactly p, and reports whether there was one.
+// An address inside a banned range can't be let off on its own.
+func (s *Store) Remove(p netip.Prefix) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p = p.Masked()
+	if _, ok := s.bans[p]; !ok {
+		return false, nil
+	}
+	delete(s.bans, p)
+	return true, s.save()
+}
+
+// Check returns the ban addr falls under at now, if any. Where ranges
+// overlap, the narrowest one is returned.
+func (s *Store) Check(addr netip.Addr, now time.Time) (Ban, bool) {
+	addr = addr.Unmap().WithZone("")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found Ban
+	ok := false
+	for p, b := range s.bans {
+		if b.Expired(now) || !p.Contains(addr) {
+			continue
+		}
+		if !ok || p.Bits() > found.Net.Bits() {
+			found, ok = b, true
+		}
+	}
+	return found, ok
+}
+
+// List returns the bans in force at now, in address order. Expired bans
+// are cleared out on the way.
+func (s *Store) List(now time.Time) ([]Ban, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Ban
+	changed := false
+	for p, b := range s.bans {
+		if b.Expired(now) {
+			delete(s.bans, p)
+			changed = true
+			continue
+		}
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i].Net, list[j].Net
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return a.Bits() < b.Bits()
+	})
+
+	if changed {
+		return list, s.save()
+	}
+	return list, nil
+}
+
+// save writes every ban to s.path, by way of a temporary file so a crash
+// halfway through doesn't lose them. It's called with s.mu held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]Ban, 0, len(s.bans))
+	for _, b := range s.bans {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].When.Before(list[j].When) })
+
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(s.path, data, 0o600)
+}
@@ -0,0 +1,157 @@
+package bans
+
+import (
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func target(t *testing.T, s string) netip.Prefix {
+	t.Helper()
+
+	p, err := ParseTarget(s)
+	if err != nil {
+		t.Fatalf("ParseTarget(%q): %v", s, err)
+	}
+	return p
+}
+
+func TestParseTarget(t *testing.T) {
+	for in, want := range map[string]string{
+		"203.0.113.7":         "203.0.113.7/32",
+		"203.0.113.7/24":      "203.0.113.0/24",
+		"::ffff:203.0.113.7":  "203.0.113.7/32",
+		"2001:db8::1":         "2001:db8::1/128",
+		"2001:db8::1/32":      "2001:db8::/32",
+		"::ffff:10.0.0.0/104": "10.0.0.0/8",
+	} {
+		if got := target(t, in).String(); got != want {
+			t.Errorf("ParseTarget(%q) = %s, want %s", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "nick", "203.0.113.300", "203.0.113.0/33"} {
+		if _, err := ParseTarget(in); err == nil {
+			t.Errorf("ParseTarget(%q) succeeded", in)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s, _ := Open("", now)
+	s.Add(Ban{Net: target(t, "10.0.0.0/8"), Reason: "range"})
+	s.Add(Ban{Net: target(t, "10.1.2.3"), Reason: "one"})
+	s.Add(Ban{Net: target(t, "2001:db8::/32"), Reason: "six"})
+	s.Add(Ban{Net: target(t, "192.0.2.1"), Until: now.Add(time.Hour), Reason: "timed"})
+
+	for addr, want := range map[string]string{
+		"10.200.0.1":      "range",
+		"10.1.2.3":        "one", // the narrowest ban wins
+		"::ffff:10.1.2.3": "one",
+		"2001:db8:5::9":   "six",
+		"192.0.2.1":       "timed",
+		"11.0.0.1":        "",
+		"2001:db9::1":     "",
+		"fe80::1%eth0":    "",
+	} {
+		b, ok := s.Check(netip.MustParseAddr(addr), now)
+		if got := b.Reason; got != want || ok != (want != "") {
+			t.Errorf("Check(%s) = %q, %v, want %q", addr, got, ok, want)
+		}
+	}
+
+	if _, ok := s.Check(netip.MustParseAddr("192.0.2.1"), now.Add(time.Hour)); ok {
+		t.Error("timed ban still in force when it ran out")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	s, _ := Open("", now)
+	s.Add(Ban{Net: target(t, "10.0.0.0/8")})
+
+	// Only the range itself can be unbanned, not an address inside it.
+	if ok, _ := s.Remove(target(t, "10.1.2.3")); ok {
+		t.Error("removed an address inside a banned range")
+	}
+	if ok, _ := s.Remove(target(t, "10.9.9.9/8")); !ok {
+		t.Error("couldn't remove the range")
+	}
+	if _, ok := s.Check(netip.MustParseAddr("10.1.2.3"), now); ok {
+		t.Error("still banned after removal")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	s, err := Open(path, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Ban{Net: target(t, "198.51.100.0/24"), Reason: "spam", By: "admin", When: now})
+	s.Add(Ban{Net: target(t, "192.0.2.1"), Until: now.Add(time.Hour), When: now})
+	s.Add(Ban{Net: target(t, "192.0.2.2"), When: now})
+	s.Remove(target(t, "192.0.2.2"))
+
+	// By the time it's opened again, the timed ban has run out.
+	s, err = Open(path, now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.List(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Net.String() != "198.51.100.0/24" || list[0].Reason != "spam" || list[0].By != "admin" {
+		t.Fatalf("reopened store has %+v", list)
+	}
+}
+
+func TestList(t *testing.T) {
+	s, _ := Open("", now)
+	for _, n := range []string{"192.0.2.9", "10.0.0.0/8", "10.0.0.1", "2001:db8::1"} {
+		s.Add(Ban{Net: target(t, n)})
+	}
+	s.Add(Ban{Net: target(t, "10.0.0.2"), Until: now.Add(-time.Minute)})
+
+	list, _ := s.List(now)
+	var got []string
+	for _, b := range list {
+		got = append(got, b.Net.String())
+	}
+	want := []string{"10.0.0.0/8", "10.0.0.1/32", "192.0.2.9/32", "2001:db8::1/128"}
+	if len(got) != len(want) {
+		t.Fatalf("List = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("List = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	s, _ := Open(filepath.Join(t.TempDir(), "bans.json"), now)
+	addr := netip.MustParseAddr("203.0.113.5")
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p := netip.PrefixFrom(netip.AddrFrom4([4]byte{203, 0, 113, byte(i)}), 32)
+			s.Add(Ban{Net: p})
+			s.Remove(p)
+		}()
+		go func() {
+			defer wg.Done()
+			s.Check(addr, now)
+			s.List(now)
+		}()
+	}
+	wg.Wait()
+}
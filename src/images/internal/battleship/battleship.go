@@ -0,0 +1,393 @@
+// Package battleship implements fleet placement and shot bookkeeping for
+// a 10x10 game of Battleship, plus a hunt/target computer opponent.
+package battleship
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const Size = 10
+
+type Ship struct {
+	Name string
+	Len  int
+}
+
+// Fleet is the standard set of ships every player places.
+var Fleet = []Ship{
+	{"carrier", 5},
+	{"battleship", 4},
+	{"cruiser", 3},
+	{"submarine", 3},
+	{"destroyer", 2},
+}
+
+// Coord is a cell on the board. Rows are lettered A-J and columns are
+// numbered 1-10 when written down.
+type Coord struct{ Row, Col int }
+
+func (c Coord) String() string {
+	return fmt.Sprintf("%c%d", 'A'+c.Row, c.Col+1)
+}
+
+func (c Coord) in() bool {
+	return c.Row >= 0 && c.Row < Size && c.Col >= 0 && c.Col < Size
+}
+
+// ParseCoord reads coordinates like "a1" or "J10".
+func ParseCoord(s string) (Coord, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return Coord{}, fmt.Errorf("%q isn't a coordinate like b7", s)
+	}
+
+	col, err := strconv.Atoi(s[1:])
+	c := Coord{int(s[0] - 'a'), col - 1}
+	if err != nil || !c.in() {
+		return Coord{}, fmt.Errorf("%q isn't on the board (A1 to J10)", s)
+	}
+	return c, nil
+}
+
+type Result int
+
+const (
+	Miss Result = iota
+	Hit
+	Sunk
+)
+
+var (
+	ErrOverlap     = errors.New("that overlaps another ship")
+	ErrOffBoard    = errors.New("that runs off the board")
+	ErrPlaced      = errors.New("that ship is already placed")
+	ErrUnknownShip = errors.New("no such ship")
+	ErrRepeat      = errors.New("you already fired there")
+)
+
+// Board is one player's waters: where their ships are and which cells the
+// opponent has fired at.
+type Board struct {
+	// ships holds the Fleet index plus one of the ship on each cell.
+	ships [Size][Size]int
+	shots [Size][Size]bool
+
+	placed []bool
+	hits   []int
+}
+
+func NewBoard() *Board {
+	return &Board{placed: make([]bool, len(Fleet)), hits: make([]int, len(Fleet))}
+}
+
+// ShipIndex looks a ship up by name or unique prefix.
+func ShipIndex(name string) (int, error) {
+	if name == "" {
+		return 0, ErrUnknownShip
+	}
+
+	found := -1
+	for i, s := range Fleet {
+		if strings.HasPrefix(s.Name, strings.ToLower(name)) {
+			if found >= 0 {
+				return 0, fmt.Errorf("%q could be more than one ship", name)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, ErrUnknownShip
+	}
+	return found, nil
+}
+
+func cells(ship int, at Coord, horizontal bool) []Coord {
+	var out []Coord
+	for i := range Fleet[ship].Len {
+		c := at
+		if horizontal {
+			c.Col += i
+		} else {
+			c.Row += i
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Place puts a ship with its bow at at, running right or down.
+func (b *Board) Place(ship int, at Coord, horizontal bool) error {
+	if ship < 0 || ship >= len(Fleet) {
+		return ErrUnknownShip
+	}
+	if b.placed[ship] {
+		return ErrPlaced
+	}
+
+	cs := cells(ship, at, horizontal)
+	for _, c := range cs {
+		if !c.in() {
+			return ErrOffBoard
+		}
+		if b.ships[c.Row][c.Col] != 0 {
+			return ErrOverlap
+		}
+	}
+
+	for _, c := range cs {
+		b.ships[c.Row][c.Col] = ship + 1
+	}
+	b.placed[ship] = true
+	return nil
+}
+
+// PlaceRandom places every ship that isn't on the board yet.
+func (b *Board) PlaceRandom(rng *rand.Rand) {
+	for ship := range Fleet {
+		for !b.placed[ship] {
+			at := Coord{rng.Intn(Size), rng.Intn(Size)}
+			b.Place(ship, at, rng.Intn(2) == 0)
+		}
+	}
+}
+
+// Unplaced returns the names of ships still to be placed.
+func (b *Board) Unplaced() []string {
+	var out []string
+	for i, p := range b.placed {
+		if !p {
+			out = append(out, Fleet[i].Name)
+		}
+	}
+	return out
+}
+
+// Ready reports whether the whole fleet is placed.
+func (b *Board) Ready() bool {
+	return len(b.Unplaced()) == 0
+}
+
+// Fire records a shot at c. When it sinks a ship the ship's name is
+// returned too.
+func (b *Board) Fire(c Coord) (Result, string, error) {
+	if !c.in() {
+		return Miss, "", ErrOffBoard
+	}
+	if b.shots[c.Row][c.Col] {
+		return Miss, "", ErrRepeat
+	}
+	b.shots[c.Row][c.Col] = true
+
+	ship := b.ships[c.Row][c.Col] - 1
+	if ship < 0 {
+		return Miss, "", nil
+	}
+
+	b.hits[ship]++
+	if b.hits[ship] == Fleet[ship].Len {
+		return Sunk, Fleet[ship].Name, nil
+	}
+	return Hit, "", nil
+}
+
+// AllSunk reports whether every ship has been sunk.
+func (b *Board) AllSunk() bool {
+	for i, s := range Fleet {
+		if b.hits[i] < s.Len {
+			return false
+		}
+	}
+	return true
+}
+
+type saved_board struct {
+	Ships  [Size][Size]int  `json:"ships"`
+	Shots  [Size][Size]bool `json:"shots"`
+	Placed []bool           `json:"placed"`
+	Hits   []int            `json:"hits"`
+}
+
+func (b *Board) MarshalJSON() ([]byte, error) {
+	return json.Marshal(saved_board{b.ships, b.shots, b.placed, b.hits})
+}
+
+func (b *Board) UnmarshalJSON(data []byte) error {
+	var s saved_board
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if len(s.Placed) != len(Fleet) || len(s.Hits) != len(Fleet) {
+		return fmt.Errorf("saved board has %d ships, not %d", len(s.Placed), len(Fleet))
+	}
+	for _, row := range s.Ships {
+		for _, ship := range row {
+			if ship < 0 || ship > len(Fleet) {
+				return fmt.Errorf("no ship %d in the fleet", ship)
+			}
+		}
+	}
+
+	b.ships, b.shots, b.placed, b.hits = s.Ships, s.Shots, s.Placed, s.Hits
+	return nil
+}
+
+// Cell describes one square for drawing.
+type Cell int
+
+const (
+	Water Cell = iota
+	ShipCell
+	MissCell
+	HitCell
+	SunkCell
+)
+
+// Own is the owner's view of a cell: ships are visible.
+func (b *Board) Own(c Coord) Cell {
+	return b.cell(c, true)
+}
+
+// Public is what the opponent (or anyone else) may see of a cell: only
+// the results of shots, never an unhit ship.
+func (b *Board) Public(c Coord) Cell {
+	return b.cell(c, false)
+}
+
+func (b *Board) cell(c Coord, own bool) Cell {
+	ship := b.ships[c.Row][c.Col] - 1
+	shot := b.shots[c.Row][c.Col]
+
+	switch {
+	case shot && ship >= 0 && b.hits[ship] == Fleet[ship].Len:
+		return SunkCell
+	case shot && ship >= 0:
+		return HitCell
+	case shot:
+		return MissCell
+	case own && ship >= 0:
+		return ShipCell
+	}
+	return Water
+}
+
+// AI fires at random until it hits something, then works outwards from its
+// unsunk hits until the ship goes down.
+type AI struct {
+	rng   *rand.Rand
+	tried [Size][Size]bool
+
+	// open holds hits on ships that haven't been sunk yet.
+	open []Coord
+}
+
+func NewAI(rng *rand.Rand) *AI {
+	return &AI{rng: rng}
+}
+
+// Next picks the AI's next shot.
+func (a *AI) Next() Coord {
+	// Prefer extending a line of two or more hits, then any neighbour of
+	// a hit.
+	var line, near []Coord
+	for _, h := range a.open {
+		for _, d := range []Coord{{0, 1}, {0, -1}, {1, 0}, {-1, 0}} {
+			c := Coord{h.Row + d.Row, h.Col + d.Col}
+			if !c.in() || a.tried[c.Row][c.Col] {
+				continue
+			}
+
+			back := Coord{h.Row - d.Row, h.Col - d.Col}
+			if a.isOpen(back) {
+				line = append(line, c)
+			}
+			near = append(near, c)
+		}
+	}
+
+	switch {
+	case len(line) > 0:
+		return line[a.rng.Intn(len(line))]
+	case len(near) > 0:
+		return near[a.rng.Intn(len(near))]
+	}
+
+	// Hunting: a checkerboard is enough to find every ship of length two
+	// or more.
+	var free []Coord
+	for r := range Size {
+		for c := range Size {
+			if !a.tried[r][c] && (r+c)%2 == 0 {
+				free = append(free, Coord{r, c})
+			}
+		}
+	}
+	if len(free) == 0 {
+		for r := range Size {
+			for c := range Size {
+				if !a.tried[r][c] {
+					free = append(free, Coord{r, c})
+				}
+			}
+		}
+	}
+	return free[a.rng.Intn(len(free))]
+}
+
+func (a *AI) isOpen(c Coord) bool {
+	for _, h := range a.open {
+		if h == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Report tells the AI how its shot at c went. target is the board the
+// shot landed on, used to drop a sunk ship's cells from the open hits.
+func (a *AI) Report(c Coord, r Result, target *Board) {
+	a.tried[c.Row][c.Col] = true
+
+	switch r {
+	case Hit:
+		a.open = append(a.open, c)
+	case Sunk:
+		a.open = append(a.open, c)
+		var still []Coord
+		for _, h := range a.open {
+			if target.Public(h) != SunkCell {
+				still = append(still, h)
+			}
+		}
+		a.open = still
+	}
+}
+
+type saved_ai struct {
+	Tried [Size][Size]bool `json:"tried"`
+	Open  []Coord          `json:"open"`
+}
+
+// The AI's random source isn't saved; one restored keeps the one it was
+// made with.
+func (a *AI) MarshalJSON() ([]byte, error) {
+	return json.Marshal(saved_ai{a.tried, a.open})
+}
+
+func (a *AI) UnmarshalJSON(data []byte) error {
+	var s saved_ai
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, c := range s.Open {
+		if !c.in() {
+			return fmt.Errorf("%v isn't on the board", c)
+		}
+	}
+	a.tried, a.open = s.Tried, s.Open
+	return nil
+}
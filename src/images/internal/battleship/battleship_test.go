@@ -0,0 +1,198 @@
+package battleship
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestParseCoord(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Coord
+		ok   bool
+	}{
+		{"a1", Coord{0, 0}, true},
+		{"J10", Coord{9, 9}, true},
+		{"c7", Coord{2, 6}, true},
+		{"k1", Coord{}, false},
+		{"a0", Coord{}, false},
+		{"a11", Coord{}, false},
+		{"a", Coord{}, false},
+		{"1a", Coord{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCoord(tt.in)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("ParseCoord(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestPlace(t *testing.T) {
+	b := NewBoard()
+
+	if err := b.Place(0, Coord{0, 0}, true); err != nil {
+		t.Fatalf("carrier at A1 across: %v", err)
+	}
+	if err := b.Place(0, Coord{5, 5}, true); err != ErrPlaced {
+		t.Errorf("placing the carrier twice: %v", err)
+	}
+	if err := b.Place(1, Coord{0, 4}, false); err != ErrOverlap {
+		t.Errorf("battleship through the carrier's stern: %v", err)
+	}
+	if err := b.Place(1, Coord{0, 7}, true); err != ErrOffBoard {
+		t.Errorf("battleship off the right edge: %v", err)
+	}
+	if err := b.Place(1, Coord{7, 0}, false); err != ErrOffBoard {
+		t.Errorf("battleship off the bottom: %v", err)
+	}
+	if err := b.Place(1, Coord{6, 0}, false); err != nil {
+		t.Errorf("battleship touching the bottom edge: %v", err)
+	}
+	if err := b.Place(4, Coord{1, 0}, true); err != nil {
+		t.Errorf("destroyer alongside the carrier: %v", err)
+	}
+
+	if got := b.Unplaced(); len(got) != 2 || got[0] != "cruiser" || got[1] != "submarine" {
+		t.Errorf("Unplaced() = %v", got)
+	}
+}
+
+func TestPlaceRandom(t *testing.T) {
+	for seed := range int64(50) {
+		b := NewBoard()
+		b.Place(2, Coord{4, 4}, false)
+		b.PlaceRandom(rand.New(rand.NewSource(seed)))
+
+		if !b.Ready() {
+			t.Fatalf("seed %d: fleet incomplete", seed)
+		}
+
+		cells := 0
+		for r := range Size {
+			for c := range Size {
+				if b.Own(Coord{r, c}) == ShipCell {
+					cells++
+				}
+			}
+		}
+		if cells != 17 {
+			t.Fatalf("seed %d: %d ship cells, want 17", seed, cells)
+		}
+	}
+}
+
+func TestFire(t *testing.T) {
+	b := NewBoard()
+	b.Place(4, Coord{3, 3}, true) // destroyer on D4-D5
+
+	if r, _, _ := b.Fire(Coord{0, 0}); r != Miss {
+		t.Errorf("A1: %v, want miss", r)
+	}
+	if _, _, err := b.Fire(Coord{0, 0}); err != ErrRepeat {
+		t.Errorf("A1 again: %v, want ErrRepeat", err)
+	}
+	if r, _, _ := b.Fire(Coord{3, 3}); r != Hit {
+		t.Errorf("D4: %v, want hit", r)
+	}
+	if b.AllSunk() {
+		t.Error("AllSunk with ships afloat")
+	}
+	if b.Public(Coord{3, 4}) != Water {
+		t.Error("public view reveals an unhit ship")
+	}
+	if r, name, _ := b.Fire(Coord{3, 4}); r != Sunk || name != "destroyer" {
+		t.Errorf("D5: %v %q, want sunk destroyer", r, name)
+	}
+	if b.Public(Coord{3, 3}) != SunkCell {
+		t.Error("sunk ship not shown as sunk")
+	}
+}
+
+func TestAllSunk(t *testing.T) {
+	b := NewBoard()
+	b.PlaceRandom(rand.New(rand.NewSource(1)))
+
+	for r := range Size {
+		for c := range Size {
+			b.Fire(Coord{r, c})
+		}
+	}
+	if !b.AllSunk() {
+		t.Error("every cell fired at but the fleet survived")
+	}
+}
+
+func TestAIFinishesWhatItStarts(t *testing.T) {
+	for seed := range int64(20) {
+		rng := rand.New(rand.NewSource(seed))
+		b := NewBoard()
+		b.PlaceRandom(rng)
+		ai := NewAI(rng)
+
+		shots := 0
+		for !b.AllSunk() {
+			c := ai.Next()
+			r, _, err := b.Fire(c)
+			if err != nil {
+				t.Fatalf("seed %d: AI fired at %v twice", seed, c)
+			}
+			ai.Report(c, r, b)
+			shots++
+		}
+
+		// Pure random search needs ~95 shots on average; hunt/target
+		// should do far better.
+		if shots > 85 {
+			t.Errorf("seed %d: AI took %d shots", seed, shots)
+		}
+	}
+}
+
+func TestBoardJSON(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	b := NewBoard()
+	b.PlaceRandom(rng)
+	ai := NewAI(rng)
+	for range 30 {
+		c := ai.Next()
+		r, _, _ := b.Fire(c)
+		ai.Report(c, r, b)
+	}
+
+	data, err := json.Marshal(struct {
+		Board *Board
+		AI    *AI
+	}{b, ai})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := struct {
+		Board *Board
+		AI    *AI
+	}{NewBoard(), NewAI(rand.New(rand.NewSource(1)))}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for r := range Size {
+		for c := range Size {
+			at := Coord{r, c}
+			if got.Board.Own(at) != b.Own(at) || got.Board.Public(at) != b.Public(at) {
+				t.Fatalf("%v differs after a round trip", at)
+			}
+		}
+	}
+	if !got.Board.Ready() || got.Board.AllSunk() != b.AllSunk() {
+		t.Error("fleet differs after a round trip")
+	}
+	if got.AI.tried != ai.tried || len(got.AI.open) != len(ai.open) {
+		t.Error("AI differs after a round trip")
+	}
+
+	if err := json.Unmarshal([]byte(`{"ships":[[9]],"placed":[],"hits":[]}`), NewBoard()); err == nil {
+		t.Error("loaded a board with the wrong fleet")
+	}
+}
@@ -0,0 +1,242 @@
+// Package canvas is a grid of colored characters that several people
+// draw on at once. Every edit is a stroke belonging to whoever made it,
+// so each of them can undo their own work without touching anyone else's.
+package canvas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxUndo is how many strokes are kept per author.
+const MaxUndo = 20
+
+var ErrColor = errors.New("colors are written like #ff8800")
+
+type Color struct {
+	R, G, B uint8
+}
+
+var White = Color{255, 255, 255}
+
+// ParseColor reads a color written as RRGGBB in hex, with or without a
+// leading '#'.
+func ParseColor(s string) (Color, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return Color{}, ErrColor
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return Color{}, ErrColor
+	}
+	return Color{uint8(n >> 16), uint8(n >> 8), uint8(n)}, nil
+}
+
+func (c Color) String() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+type Cell struct {
+	Ch    rune
+	Color Color
+}
+
+// Blank is what an empty square holds, and what the eraser paints.
+var Blank = Cell{Ch: ' '}
+
+type Point struct {
+	X, Y int
+}
+
+type stroke struct {
+	before, after map[Point]Cell
+}
+
+type Canvas struct {
+	Width, Height int
+	cells         []Cell
+
+	// history holds each author's strokes, oldest first.
+	history map[int][]stroke
+}
+
+func New(width, height int) *Canvas {
+	c := &Canvas{Width: width, Height: height, history: map[int][]stroke{}}
+	c.cells = make([]Cell, width*height)
+	for i := range c.cells {
+		c.cells[i] = Blank
+	}
+	return c
+}
+
+func (c *Canvas) In(p Point) bool {
+	return p.X >= 0 && p.X < c.Width && p.Y >= 0 && p.Y < c.Height
+}
+
+func (c *Canvas) At(p Point) Cell {
+	return c.cells[p.Y*c.Width+p.X]
+}
+
+func (c *Canvas) set(p Point, cell Cell) {
+	c.cells[p.Y*c.Width+p.X] = cell
+}
+
+// Draw paints cell onto every point given, as one stroke by author. It
+// returns the points that changed.
+func (c *Canvas) Draw(author int, cell Cell, points ...Point) []Point {
+	s := stroke{before: map[Point]Cell{}, after: map[Point]Cell{}}
+
+	var changed []Point
+	for _, p := range points {
+		if !c.In(p) || c.At(p) == cell {
+			continue
+		}
+		if _, ok := s.before[p]; !ok {
+			s.before[p] = c.At(p)
+		}
+		s.after[p] = cell
+		c.set(p, cell)
+		changed = append(changed, p)
+	}
+
+	if len(changed) > 0 {
+		h := append(c.history[author], s)
+		if len(h) > MaxUndo {
+			h = h[1:]
+		}
+		c.history[author] = h
+	}
+	return changed
+}
+
+// Fill paints cell over the area of squares like the one at p that can be
+// reached from it without going diagonally.
+func (c *Canvas) Fill(author int, at Point, cell Cell) []Point {
+	if !c.In(at) {
+		return nil
+	}
+
+	target := c.At(at)
+	if target == cell {
+		return nil
+	}
+
+	seen := map[Point]bool{at: true}
+	queue := []Point{at}
+	for i := 0; i < len(queue); i++ {
+		p := queue[i]
+		for _, d := range []Point{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} {
+			n := Point{p.X + d.X, p.Y + d.Y}
+			if c.In(n) && !seen[n] && c.At(n) == target {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+
+	return c.Draw(author, cell, queue...)
+}
+
+// Undo takes back author's last stroke. Squares someone else has drawn
+// over since are left as they are. It returns the points that changed,
+// or false if there was nothing to undo.
+func (c *Canvas) Undo(author int) ([]Point, bool) {
+	h := c.history[author]
+	if len(h) == 0 {
+		return nil, false
+	}
+	s := h[len(h)-1]
+	c.history[author] = h[:len(h)-1]
+
+	var changed []Point
+	for p, cell := range s.after {
+		if c.At(p) == cell {
+			c.set(p, s.before[p])
+			changed = append(changed, p)
+		}
+	}
+	return changed, true
+}
+
+// Forget drops author's history, for when they leave.
+func (c *Canvas) Forget(author int) {
+	delete(c.history, author)
+}
+
+// Clear blanks the whole canvas. Nothing from before can be undone
+// afterwards.
+func (c *Canvas) Clear() []Point {
+	return c.replace(New(c.Width, c.Height).cells)
+}
+
+// replace puts cells in place of the canvas's own and forgets everyone's
+// strokes, returning the points that changed.
+func (c *Canvas) replace(cells []Cell) []Point {
+	var changed []Point
+	for i, cell := range cells {
+		if c.cells[i] != cell {
+			c.cells[i] = cell
+			changed = append(changed, Point{i % c.Width, i / c.Width})
+		}
+	}
+	c.history = map[int][]stroke{}
+	return changed
+}
+
+// saved is the JSON form of a canvas. Only squares that aren't blank are
+// listed.
+type saved struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Cells  []saved_cell `json:"cells"`
+}
+
+type saved_cell struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Ch    string `json:"ch"`
+	Color string `json:"color"`
+}
+
+func (c *Canvas) MarshalJSON() ([]byte, error) {
+	s := saved{Width: c.Width, Height: c.Height, Cells: []saved_cell{}}
+	for i, cell := range c.cells {
+		if cell != Blank {
+			s.Cells = append(s.Cells, saved_cell{X: i % c.Width, Y: i / c.Width, Ch: string(cell.Ch), Color: cell.Color.String()})
+		}
+	}
+	return json.Marshal(s)
+}
+
+// Load replaces the canvas with a saved one, which must be the same size.
+// It returns the points that changed; history is forgotten, as with Clear.
+func (c *Canvas) Load(data []byte) ([]Point, error) {
+	var s saved
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if s.Width != c.Width || s.Height != c.Height {
+		return nil, fmt.Errorf("saved canvas is %dx%d, not %dx%d", s.Width, s.Height, c.Width, c.Height)
+	}
+
+	cells := New(c.Width, c.Height).cells
+	for _, sc := range s.Cells {
+		p := Point{sc.X, sc.Y}
+		if !c.In(p) || utf8.RuneCountInString(sc.Ch) != 1 {
+			return nil, fmt.Errorf("bad square %+v", sc)
+		}
+		col, err := ParseColor(sc.Color)
+		if err != nil {
+			return nil, fmt.Errorf("square %d,%d: %w", sc.X, sc.Y, err)
+		}
+		r, _ := utf8.DecodeRuneInString(sc.Ch)
+		cells[p.Y*c.Width+p.X] = Cell{Ch: r, Color: col}
+	}
+
+	return c.replace(cells), nil
+}
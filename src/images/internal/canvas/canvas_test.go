@@ -0,0 +1,148 @@
+package canvas
+
+import "testing"
+
+var red = Cell{Ch: '#', Color: Color{255, 0, 0}}
+
+func TestParseColor(t *testing.T) {
+	for s, want := range map[string]Color{"#ff8800": {255, 136, 0}, "00FF10": {0, 255, 16}} {
+		if c, err := ParseColor(s); err != nil || c != want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v", s, c, err, want)
+		}
+	}
+	for _, s := range []string{"", "#fff", "#gg0000", "#ff88001"} {
+		if _, err := ParseColor(s); err == nil {
+			t.Errorf("ParseColor(%q) succeeded", s)
+		}
+	}
+
+	if s := (Color{255, 136, 0}).String(); s != "#ff8800" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	c := New(4, 3)
+
+	changed := c.Draw(1, red, Point{0, 0}, Point{1, 0}, Point{9, 9}, Point{1, 0})
+	if len(changed) != 2 {
+		t.Errorf("Draw changed %v; want 2 points", changed)
+	}
+	if c.At(Point{1, 0}) != red || c.At(Point{2, 0}) != Blank {
+		t.Error("Draw painted the wrong squares")
+	}
+
+	if changed := c.Draw(1, red, Point{0, 0}); len(changed) != 0 {
+		t.Errorf("redrawing the same cell changed %v", changed)
+	}
+}
+
+func TestFill(t *testing.T) {
+	c := New(5, 3)
+
+	// A wall down the middle column keeps the fill on the left.
+	c.Draw(1, red, Point{2, 0}, Point{2, 1}, Point{2, 2})
+
+	blue := Cell{Ch: '~', Color: Color{0, 0, 255}}
+	if changed := c.Fill(2, Point{0, 1}, blue); len(changed) != 6 {
+		t.Errorf("Fill changed %d squares; want 6", len(changed))
+	}
+	if c.At(Point{1, 2}) != blue || c.At(Point{3, 0}) != Blank || c.At(Point{2, 1}) != red {
+		t.Error("Fill went through the wall")
+	}
+
+	if changed := c.Fill(2, Point{0, 0}, blue); changed != nil {
+		t.Error("filling with the same cell changed something")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	c := New(4, 1)
+	blue := Cell{Ch: '~', Color: Color{0, 0, 255}}
+
+	c.Draw(1, red, Point{0, 0}, Point{1, 0})
+	c.Draw(2, blue, Point{1, 0}, Point{2, 0})
+
+	// Author 1's square under author 2's stroke stays blue.
+	if changed, ok := c.Undo(1); !ok || len(changed) != 1 {
+		t.Fatalf("Undo(1) = %v, %v", changed, ok)
+	}
+	if c.At(Point{0, 0}) != Blank || c.At(Point{1, 0}) != blue {
+		t.Error("Undo(1) changed someone else's work")
+	}
+	if _, ok := c.Undo(1); ok {
+		t.Error("Undo(1) had a second stroke to undo")
+	}
+
+	// Author 2's undo puts back what was under their stroke.
+	c.Undo(2)
+	if c.At(Point{1, 0}) != red || c.At(Point{2, 0}) != Blank {
+		t.Error("Undo(2) didn't restore what was there before")
+	}
+}
+
+func TestUndoLimit(t *testing.T) {
+	c := New(MaxUndo+5, 1)
+	for x := range c.Width {
+		c.Draw(1, red, Point{x, 0})
+	}
+
+	n := 0
+	for {
+		if _, ok := c.Undo(1); !ok {
+			break
+		}
+		n++
+	}
+	if n != MaxUndo {
+		t.Errorf("undid %d strokes; want %d", n, MaxUndo)
+	}
+}
+
+func TestClear(t *testing.T) {
+	c := New(3, 3)
+	c.Draw(1, red, Point{0, 0}, Point{2, 2})
+
+	if changed := c.Clear(); len(changed) != 2 {
+		t.Errorf("Clear changed %d squares; want 2", len(changed))
+	}
+	if _, ok := c.Undo(1); ok {
+		t.Error("strokes could be undone after Clear")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	c := New(6, 4)
+	c.Draw(1, red, Point{0, 0}, Point{5, 3})
+	c.Draw(1, Cell{Ch: 'é', Color: White}, Point{2, 1})
+
+	data, err := c.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := New(6, 4)
+	other.Draw(2, red, Point{1, 1})
+	changed, err := other.Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 4 {
+		t.Errorf("Load changed %d squares; want 4", len(changed))
+	}
+	for y := range 4 {
+		for x := range 6 {
+			p := Point{x, y}
+			if other.At(p) != c.At(p) {
+				t.Errorf("square %v is %v after loading; want %v", p, other.At(p), c.At(p))
+			}
+		}
+	}
+
+	if _, err := New(5, 4).Load(data); err == nil {
+		t.Error("loaded a canvas of the wrong size")
+	}
+	if _, err := other.Load([]byte(`{"width":6,"height":4,"cells":[{"x":9,"y":0,"ch":"a","color":"#ffffff"}]}`)); err == nil {
+		t.Error("loaded a square off the canvas")
+	}
+}
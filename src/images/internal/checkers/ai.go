@@ -0,0 +1,80 @@
+package checkers
+
+import "math/rand"
+
+const (
+	man_value  = 100
+	king_value = 160
+	win_value  = 100000
+)
+
+// Evaluate scores the board from side's point of view: material first,
+// then men that have advanced and pieces holding the middle.
+func Evaluate(b *Board, side Side) int {
+	score := 0
+	for r := range Size {
+		for c := range Size {
+			p := b[r][c]
+			if p == Empty {
+				continue
+			}
+
+			v := man_value
+			if p.King() {
+				v = king_value
+			} else if p.Side() == Black {
+				v += 3 * r
+			} else {
+				v += 3 * (Size - 1 - r)
+			}
+			if c >= 2 && c <= 5 && r >= 2 && r <= 5 {
+				v += 4
+			}
+
+			if p.Side() == side {
+				score += v
+			} else {
+				score -= v
+			}
+		}
+	}
+	return score
+}
+
+// Best searches depth plies ahead with alpha-beta and returns the best
+// move for side, choosing at random between equally good ones. side must
+// have a legal move.
+func Best(b Board, side Side, depth int, rng *rand.Rand) Move {
+	moves := b.Moves(side)
+	rng.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+
+	best, alpha := moves[0], -win_value-1
+	for _, m := range moves {
+		next := b.Apply(m)
+		if v := -search(&next, side.Other(), depth-1, -win_value-1, -alpha); v > alpha {
+			best, alpha = m, v
+		}
+	}
+	return best
+}
+
+func search(b *Board, side Side, depth, alpha, beta int) int {
+	moves := b.Moves(side)
+	if len(moves) == 0 {
+		// Losing later is better than losing now.
+		return -win_value + 100 - depth
+	}
+	if depth <= 0 {
+		return Evaluate(b, side)
+	}
+
+	for _, m := range moves {
+		next := b.Apply(m)
+		v := -search(&next, side.Other(), depth-1, -beta, -alpha)
+		if v >= beta {
+			return v
+		}
+		alpha = max(alpha, v)
+	}
+	return alpha
+}
@@ -0,0 +1,65 @@
+package checkers
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBestLooksAhead(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		".b......",
+		"........",
+		"...w....",
+		"........",
+		".......w",
+	)
+
+	// c5 is the better square on its own, but one ply later white takes
+	// the man there, so a deeper search goes to a5.
+	for seed := range int64(5) {
+		rng := rand.New(rand.NewSource(seed))
+		if m := Best(b, Black, 1, rng); m.String() != "b6 c5" {
+			t.Errorf("depth 1 chose %v", m)
+		}
+		if m := Best(b, Black, 3, rng); m.String() != "b6 a5" {
+			t.Errorf("depth 3 chose %v", m)
+		}
+	}
+}
+
+func TestBestTakesTheMost(t *testing.T) {
+	b := Parse(
+		".b......",
+		"..w.....",
+		"........",
+		"..w.w...",
+		"........",
+		"......w.",
+	)
+
+	// Either chain is legal, but the one through f4 takes three men.
+	for depth := 1; depth <= 4; depth++ {
+		if m := Best(b, Black, depth, rand.New(rand.NewSource(1))); m.String() != "b8xd6xf4xh2" {
+			t.Errorf("depth %d chose %v", depth, m)
+		}
+	}
+}
+
+func TestPlaysItself(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	b, side := New(), Black
+
+	for range 300 {
+		moves := b.Moves(side)
+		if len(moves) == 0 {
+			return
+		}
+		m := Best(b, side, 3, rng)
+		if _, err := Find(moves, m.String()); err != nil {
+			t.Fatalf("AI chose %v, which Find rejects: %v", m, err)
+		}
+		b, side = b.Apply(m), side.Other()
+	}
+}
@@ -0,0 +1,336 @@
+// Package checkers implements English draughts: men move diagonally
+// forward, captures are compulsory and must be followed through to the
+// end of the chain, and a man reaching the far side is crowned at once,
+// which ends its move.
+package checkers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const Size = 8
+
+type Side int
+
+const (
+	Black Side = iota // moves first, from the top of the board
+	White
+)
+
+func (s Side) Other() Side {
+	return 1 - s
+}
+
+func (s Side) String() string {
+	return [...]string{"Black", "White"}[s]
+}
+
+type Piece byte
+
+const (
+	Empty Piece = iota
+	BlackMan
+	BlackKing
+	WhiteMan
+	WhiteKing
+)
+
+func (p Piece) Side() Side {
+	if p == WhiteMan || p == WhiteKing {
+		return White
+	}
+	return Black
+}
+
+func (p Piece) King() bool {
+	return p == BlackKing || p == WhiteKing
+}
+
+func (p Piece) crowned() Piece {
+	if p.Side() == Black {
+		return BlackKing
+	}
+	return WhiteKing
+}
+
+// A Square is a row and column, with row 0 at the top (Black's side).
+// Squares are named like a chessboard from White's side: "a1" is the
+// bottom-left corner.
+type Square struct{ Row, Col int }
+
+func (s Square) String() string {
+	return fmt.Sprintf("%c%d", 'a'+s.Col, Size-s.Row)
+}
+
+func (s Square) on() bool {
+	return s.Row >= 0 && s.Col >= 0 && s.Row < Size && s.Col < Size
+}
+
+func ParseSquare(s string) (Square, error) {
+	s = strings.ToLower(s)
+	if len(s) != 2 || s[0] < 'a' || s[0] >= 'a'+Size || s[1] < '1' || s[1] >= '1'+Size {
+		return Square{}, fmt.Errorf("%q isn't a square like c3", s)
+	}
+	return Square{Size - int(s[1]-'0'), int(s[0] - 'a')}, nil
+}
+
+type Board [Size][Size]Piece
+
+func (b *Board) At(s Square) Piece {
+	return b[s.Row][s.Col]
+}
+
+// New sets out both sides' twelve men on the dark squares.
+func New() Board {
+	var b Board
+	for r := range Size {
+		for c := range Size {
+			if (r+c)%2 == 0 {
+				continue
+			}
+			switch {
+			case r < 3:
+				b[r][c] = BlackMan
+			case r >= Size-3:
+				b[r][c] = WhiteMan
+			}
+		}
+	}
+	return b
+}
+
+// Parse reads a board drawn as eight rows of 'b', 'w' (men), 'B', 'W'
+// (kings) and anything else for empty, top row first.
+func Parse(rows ...string) Board {
+	var b Board
+	pieces := map[byte]Piece{'b': BlackMan, 'B': BlackKing, 'w': WhiteMan, 'W': WhiteKing}
+	for r, row := range rows {
+		for c := range min(len(row), Size) {
+			b[r][c] = pieces[row[c]]
+		}
+	}
+	return b
+}
+
+// A Move is the squares a piece visits, from where it starts. Jumps list
+// the squares of the pieces it captures on the way.
+type Move struct {
+	Path  []Square
+	Jumps []Square
+}
+
+func (m Move) String() string {
+	sep := " "
+	if len(m.Jumps) > 0 {
+		sep = "x"
+	}
+
+	var parts []string
+	for _, s := range m.Path {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, sep)
+}
+
+// forward is the direction a side's men move in.
+func forward(s Side) int {
+	if s == Black {
+		return 1
+	}
+	return -1
+}
+
+func directions(p Piece) [][2]int {
+	f := forward(p.Side())
+	if p.King() {
+		return [][2]int{{f, -1}, {f, 1}, {-f, -1}, {-f, 1}}
+	}
+	return [][2]int{{f, -1}, {f, 1}}
+}
+
+// Moves lists every legal move for side. If any capture is possible only
+// captures are legal, and each is taken as far as it can go.
+func (b *Board) Moves(side Side) []Move {
+	var steps, jumps []Move
+
+	for r := range Size {
+		for c := range Size {
+			from := Square{r, c}
+			p := b.At(from)
+			if p == Empty || p.Side() != side {
+				continue
+			}
+
+			jumps = append(jumps, b.jumps(from, p, Move{Path: []Square{from}})...)
+			if len(jumps) > 0 {
+				continue
+			}
+
+			for _, d := range directions(p) {
+				to := Square{r + d[0], c + d[1]}
+				if to.on() && b.At(to) == Empty {
+					steps = append(steps, Move{Path: []Square{from, to}})
+				}
+			}
+		}
+	}
+
+	if len(jumps) > 0 {
+		return jumps
+	}
+	return steps
+}
+
+// jumps extends so far, which has p standing at its last square, by every
+// capture open to it, and returns the finished chains. The board isn't
+// changed as the chain grows: the starting square counts as empty, and
+// captured pieces stay put but can't be jumped twice.
+func (b *Board) jumps(at Square, p Piece, so_far Move) []Move {
+	var out []Move
+
+	for _, d := range directions(p) {
+		over := Square{at.Row + d[0], at.Col + d[1]}
+		to := Square{at.Row + 2*d[0], at.Col + 2*d[1]}
+		if !to.on() {
+			continue
+		}
+
+		victim := b.At(over)
+		if victim == Empty || victim.Side() == p.Side() || contains(so_far.Jumps, over) {
+			continue
+		}
+		if b.At(to) != Empty && to != so_far.Path[0] {
+			continue
+		}
+
+		next := Move{
+			Path:  append(append([]Square(nil), so_far.Path...), to),
+			Jumps: append(append([]Square(nil), so_far.Jumps...), over),
+		}
+
+		// Being crowned ends the move, even if the new king could jump on.
+		if !p.King() && crowning(p.Side(), to) {
+			out = append(out, next)
+			continue
+		}
+
+		if more := b.jumps(to, p, next); len(more) > 0 {
+			out = append(out, more...)
+		} else {
+			out = append(out, next)
+		}
+	}
+
+	return out
+}
+
+func crowning(side Side, s Square) bool {
+	if side == Black {
+		return s.Row == Size-1
+	}
+	return s.Row == 0
+}
+
+func contains(squares []Square, s Square) bool {
+	for _, q := range squares {
+		if q == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the board after m, which must be legal.
+func (b Board) Apply(m Move) Board {
+	from, to := m.Path[0], m.Path[len(m.Path)-1]
+	p := b.At(from)
+
+	b[from.Row][from.Col] = Empty
+	for _, j := range m.Jumps {
+		b[j.Row][j.Col] = Empty
+	}
+	if !p.King() && crowning(p.Side(), to) {
+		p = p.crowned()
+	}
+	b[to.Row][to.Col] = p
+
+	return b
+}
+
+// Count returns how many men and kings side has.
+func (b *Board) Count(side Side) (men, kings int) {
+	for r := range Size {
+		for c := range Size {
+			p := b[r][c]
+			if p == Empty || p.Side() != side {
+				continue
+			}
+			if p.King() {
+				kings++
+			} else {
+				men++
+			}
+		}
+	}
+	return men, kings
+}
+
+var ErrIllegal = errors.New("that isn't a legal move")
+
+// Find matches what a player typed, like "b6 c5", "b6-c5" or "a3xc5xe7",
+// to one of moves. For a multi-jump the start and end squares are enough
+// unless two different chains join them.
+func Find(moves []Move, text string) (Move, error) {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return r == ' ' || r == '-' || r == 'x'
+	})
+	if len(fields) < 2 {
+		return Move{}, fmt.Errorf("give the squares to move from and to, like b6 c5")
+	}
+
+	var path []Square
+	for _, f := range fields {
+		s, err := ParseSquare(f)
+		if err != nil {
+			return Move{}, err
+		}
+		path = append(path, s)
+	}
+
+	var found []Move
+	for _, m := range moves {
+		if matches(m, path) {
+			found = append(found, m)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		for _, m := range moves {
+			if len(m.Jumps) > 0 {
+				return Move{}, fmt.Errorf("%w: you have to capture", ErrIllegal)
+			}
+		}
+		return Move{}, ErrIllegal
+	case 1:
+		return found[0], nil
+	}
+	return Move{}, fmt.Errorf("more than one jump fits; give every square, like %s", found[0])
+}
+
+func matches(m Move, path []Square) bool {
+	if len(path) == 2 {
+		return m.Path[0] == path[0] && m.Path[len(m.Path)-1] == path[1]
+	}
+	if len(path) != len(m.Path) {
+		return false
+	}
+	for i := range path {
+		if path[i] != m.Path[i] {
+			return false
+		}
+	}
+	return true
+}
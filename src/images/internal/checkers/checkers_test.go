@@ -0,0 +1,267 @@
+package checkers
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func names(moves []Move) []string {
+	var out []string
+	for _, m := range moves {
+		out = append(out, m.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func expect(t *testing.T, what string, moves []Move, want ...string) {
+	t.Helper()
+
+	got := names(moves)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, got, want)
+		}
+	}
+}
+
+func TestSquares(t *testing.T) {
+	for name, want := range map[string]Square{"a1": {7, 0}, "h8": {0, 7}, "B6": {2, 1}, "c5": {3, 2}} {
+		s, err := ParseSquare(name)
+		if err != nil || s != want {
+			t.Errorf("ParseSquare(%q) = %v, %v; want %v", name, s, err, want)
+		}
+	}
+	for _, bad := range []string{"i1", "a9", "a0", "a", "a10"} {
+		if _, err := ParseSquare(bad); err == nil {
+			t.Errorf("ParseSquare(%q) accepted", bad)
+		}
+	}
+}
+
+func TestOpening(t *testing.T) {
+	b := New()
+
+	for _, side := range []Side{Black, White} {
+		if men, kings := b.Count(side); men != 12 || kings != 0 {
+			t.Errorf("%v starts with %d men and %d kings", side, men, kings)
+		}
+	}
+
+	expect(t, "black's openings", b.Moves(Black),
+		"b6 a5", "b6 c5", "d6 c5", "d6 e5", "f6 e5", "f6 g5", "h6 g5")
+	expect(t, "white's openings", b.Moves(White),
+		"a3 b4", "c3 b4", "c3 d4", "e3 d4", "e3 f4", "g3 f4", "g3 h4")
+}
+
+func TestCaptureIsCompulsory(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		".b...b..",
+		"..w.....",
+	)
+
+	expect(t, "black", b.Moves(Black), "b6xd4")
+}
+
+func TestMenDontMoveBackwards(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"........",
+		"..w.....",
+		"...b....",
+	)
+
+	// The white man is behind the black one, so neither can take.
+	expect(t, "black", b.Moves(Black), "d4 c3", "d4 e3")
+	expect(t, "white", b.Moves(White), "c5 b6", "c5 d6")
+}
+
+func TestBlockedJump(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		".b......",
+		"..w.....",
+		"...w....",
+	)
+
+	expect(t, "black", b.Moves(Black), "b6 a5")
+}
+
+func TestMultiJump(t *testing.T) {
+	b := Parse(
+		".b......",
+		"..w.....",
+		"........",
+		"..w.w...",
+	)
+
+	// After the first jump the chain forks, and both ways must be
+	// followed to the end.
+	moves := b.Moves(Black)
+	expect(t, "black", moves, "b8xd6xb4", "b8xd6xf4")
+
+	after := b.Apply(moves[0])
+	if men, _ := after.Count(White); men != 1 {
+		t.Errorf("%d white men left after a double jump", men)
+	}
+	if after.At(moves[0].Path[0]) != Empty {
+		t.Error("the jumping man is still on its first square")
+	}
+}
+
+func TestCrowningEndsTheMove(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"..b.....",
+		"...w.w..",
+	)
+
+	// A king on e1 could go on to take f2, but a man crowned by a jump
+	// has to stop there.
+	moves := b.Moves(Black)
+	expect(t, "black", moves, "c3xe1")
+
+	after := b.Apply(moves[0])
+	if p := after.At(Square{7, 4}); p != BlackKing {
+		t.Errorf("man landed on the back rank as %v, not a king", p)
+	}
+}
+
+func TestCrowningByStep(t *testing.T) {
+	b := Parse(
+		"........",
+		".w......",
+	)
+
+	moves := b.Moves(White)
+	expect(t, "white", moves, "b7 a8", "b7 c8")
+	for _, m := range moves {
+		after := b.Apply(m)
+		if p := after.At(m.Path[1]); p != WhiteKing {
+			t.Errorf("%v: got %v, not a king", m, p)
+		}
+	}
+}
+
+func TestKings(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"........",
+		"........",
+		"...B....",
+	)
+	expect(t, "king", b.Moves(Black), "d4 c5", "d4 e5", "d4 c3", "d4 e3")
+
+	// Kings capture backwards too.
+	b = Parse(
+		"........",
+		"........",
+		"........",
+		"..w.....",
+		"...B....",
+	)
+	expect(t, "king", b.Moves(Black), "d4xb6")
+}
+
+func TestKingCircuit(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"...w.w..",
+		"..B.....",
+		"...w.w..",
+	)
+
+	// The king can go all the way round and back to where it started, in
+	// either direction, but can't take the first man a second time.
+	moves := b.Moves(Black)
+	expect(t, "king", moves, "c5xe3xg5xe7xc5", "c5xe7xg5xe3xc5")
+
+	after := b.Apply(moves[0])
+	if men, _ := after.Count(White); men != 0 {
+		t.Errorf("%d white men survived the circuit", men)
+	}
+	if p := after.At(Square{3, 2}); p != BlackKing {
+		t.Errorf("king finished as %v", p)
+	}
+}
+
+func TestNoMoves(t *testing.T) {
+	// Black is hemmed in: it can't step, and b6 can't be jumped because
+	// c5 is taken.
+	b := Parse(
+		"........",
+		"b.......",
+		".w......",
+		"..w.....",
+	)
+	if moves := b.Moves(Black); len(moves) != 0 {
+		t.Errorf("blocked black has moves %v", names(moves))
+	}
+
+	var empty Board
+	if moves := empty.Moves(White); len(moves) != 0 {
+		t.Errorf("no pieces but moves %v", names(moves))
+	}
+}
+
+func TestFind(t *testing.T) {
+	b := New()
+	moves := b.Moves(Black)
+
+	for _, text := range []string{"b6 c5", "B6-C5", "b6xc5"} {
+		m, err := Find(moves, text)
+		if err != nil || m.String() != "b6 c5" {
+			t.Errorf("Find(%q) = %v, %v", text, m, err)
+		}
+	}
+	if _, err := Find(moves, "b6 b5"); !errors.Is(err, ErrIllegal) {
+		t.Errorf("moving straight ahead: %v", err)
+	}
+	if _, err := Find(moves, "b6"); err == nil {
+		t.Error("one square accepted as a move")
+	}
+
+	b = Parse(
+		"........",
+		"........",
+		".b...b..",
+		"..w.....",
+	)
+	if _, err := Find(b.Moves(Black), "f6 e5"); !errors.Is(err, ErrIllegal) {
+		t.Errorf("skipping a capture: %v", err)
+	}
+}
+
+func TestFindAmbiguousJump(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"...w.w..",
+		"..B.....",
+		"...w.w..",
+	)
+	moves := b.Moves(Black)
+
+	if _, err := Find(moves, "c5 c5"); err == nil {
+		t.Error("accepted a circuit without saying which way round")
+	}
+	m, err := Find(moves, "c5 e3 g5 e7 c5")
+	if err != nil || m.String() != "c5xe3xg5xe7xc5" {
+		t.Errorf("full path: %v, %v", m, err)
+	}
+}
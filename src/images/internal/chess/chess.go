@@ -0,0 +1,262 @@
+// Package chess implements the rules of chess for two players: legal
+// moves, including castling, en passant and promotion, standard algebraic
+// notation, and the ways a game can end.
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Color uint8
+
+const (
+	White Color = iota
+	Black
+)
+
+func (c Color) Other() Color {
+	return 1 - c
+}
+
+func (c Color) String() string {
+	if c == White {
+		return "White"
+	}
+	return "Black"
+}
+
+type Kind uint8
+
+const (
+	None Kind = iota
+	Pawn
+	Knight
+	Bishop
+	Rook
+	Queen
+	King
+)
+
+// kind_letters are the letters of each kind in notation, by Kind.
+const kind_letters = " PNBRQK"
+
+func (k Kind) Letter() string {
+	return kind_letters[k : k+1]
+}
+
+// Piece is what stands on a square. The zero Piece is an empty square.
+type Piece struct {
+	Kind  Kind
+	Color Color
+}
+
+// FEN gives the piece's letter as FEN writes it: upper case for White.
+func (p Piece) FEN() rune {
+	r := rune(kind_letters[p.Kind])
+	if p.Color == Black {
+		r += 'a' - 'A'
+	}
+	return r
+}
+
+// Square numbers the board from a1 = 0 along each rank to h8 = 63.
+type Square int8
+
+const NoSquare Square = -1
+
+func Sq(file, rank int) Square {
+	return Square(rank*8 + file)
+}
+
+func (s Square) File() int { return int(s) % 8 }
+func (s Square) Rank() int { return int(s) / 8 }
+
+func (s Square) String() string {
+	if s == NoSquare {
+		return "-"
+	}
+	return string(rune('a'+s.File())) + string(rune('1'+s.Rank()))
+}
+
+var ErrSquare = errors.New("squares are named a1 to h8")
+
+func ParseSquare(s string) (Square, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return NoSquare, ErrSquare
+	}
+	return Sq(int(s[0]-'a'), int(s[1]-'1')), nil
+}
+
+// Castling holds which castling moves are still allowed, one bit each.
+type Castling uint8
+
+const (
+	WhiteKingside Castling = 1 << iota
+	WhiteQueenside
+	BlackKingside
+	BlackQueenside
+)
+
+type Position struct {
+	Board    [64]Piece
+	Turn     Color
+	Castling Castling
+
+	// EnPassant is the square a pawn that just moved two squares passed
+	// over, or NoSquare.
+	EnPassant Square
+
+	// Halfmove counts moves since the last capture or pawn move, for the
+	// fifty-move rule. Fullmove is the number of the move being played.
+	Halfmove, Fullmove int
+}
+
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+func Start() Position {
+	p, _ := ParseFEN(StartFEN)
+	return p
+}
+
+func (p *Position) At(s Square) Piece {
+	return p.Board[s]
+}
+
+var fen_castling = []struct {
+	letter byte
+	right  Castling
+}{{'K', WhiteKingside}, {'Q', WhiteQueenside}, {'k', BlackKingside}, {'q', BlackQueenside}}
+
+// ParseFEN reads a position in Forsyth-Edwards Notation. The move
+// counters may be left off.
+func ParseFEN(fen string) (Position, error) {
+	f := strings.Fields(fen)
+	if len(f) != 4 && len(f) != 6 {
+		return Position{}, fmt.Errorf("FEN has %d fields, not 6", len(f))
+	}
+
+	p := Position{EnPassant: NoSquare, Fullmove: 1}
+
+	ranks := strings.Split(f[0], "/")
+	if len(ranks) != 8 {
+		return Position{}, fmt.Errorf("FEN has %d ranks, not 8", len(ranks))
+	}
+	for i, row := range ranks {
+		rank, file := 7-i, 0
+		for _, r := range row {
+			if r >= '1' && r <= '8' {
+				file += int(r - '0')
+				continue
+			}
+			kind := strings.IndexRune(kind_letters, r-'a'+'A')
+			color := Black
+			if r >= 'A' && r <= 'Z' {
+				kind = strings.IndexRune(kind_letters, r)
+				color = White
+			}
+			if kind < 1 || file > 7 {
+				return Position{}, fmt.Errorf("bad rank %q", row)
+			}
+			p.Board[Sq(file, rank)] = Piece{Kind(kind), color}
+			file++
+		}
+		if file != 8 {
+			return Position{}, fmt.Errorf("rank %q isn't 8 squares", row)
+		}
+	}
+
+	switch f[1] {
+	case "w":
+		p.Turn = White
+	case "b":
+		p.Turn = Black
+	default:
+		return Position{}, fmt.Errorf("bad side to move %q", f[1])
+	}
+
+	if f[2] != "-" {
+		for i := range len(f[2]) {
+			ok := false
+			for _, c := range fen_castling {
+				if f[2][i] == c.letter {
+					p.Castling |= c.right
+					ok = true
+				}
+			}
+			if !ok {
+				return Position{}, fmt.Errorf("bad castling rights %q", f[2])
+			}
+		}
+	}
+
+	if f[3] != "-" {
+		s, err := ParseSquare(f[3])
+		if err != nil {
+			return Position{}, fmt.Errorf("bad en passant square %q", f[3])
+		}
+		p.EnPassant = s
+	}
+
+	if len(f) == 6 {
+		var err error
+		if p.Halfmove, err = strconv.Atoi(f[4]); err != nil || p.Halfmove < 0 {
+			return Position{}, fmt.Errorf("bad halfmove clock %q", f[4])
+		}
+		if p.Fullmove, err = strconv.Atoi(f[5]); err != nil || p.Fullmove < 1 {
+			return Position{}, fmt.Errorf("bad move number %q", f[5])
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Position) FEN() string {
+	turn := "w"
+	if p.Turn == Black {
+		turn = "b"
+	}
+	return fmt.Sprintf("%s %s %s %s %d %d", p.placement(), turn, p.castling_string(), p.EnPassant, p.Halfmove, p.Fullmove)
+}
+
+// placement is the first field of the FEN.
+func (p *Position) placement() string {
+	var b strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := range 8 {
+			piece := p.Board[Sq(file, rank)]
+			if piece.Kind == None {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				b.WriteByte(byte('0' + empty))
+				empty = 0
+			}
+			b.WriteRune(piece.FEN())
+		}
+		if empty > 0 {
+			b.WriteByte(byte('0' + empty))
+		}
+		if rank > 0 {
+			b.WriteByte('/')
+		}
+	}
+	return b.String()
+}
+
+func (p *Position) castling_string() string {
+	var s string
+	for _, c := range fen_castling {
+		if p.Castling&c.right != 0 {
+			s += string(c.letter)
+		}
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
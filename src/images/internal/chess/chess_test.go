@@ -0,0 +1,58 @@
+package chess
+
+import "testing"
+
+func TestFEN(t *testing.T) {
+	for _, fen := range []string{
+		StartFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+		"8/8/8/8/8/8/6k1/4K2R b K - 12 57",
+	} {
+		p, err := ParseFEN(fen)
+		if err != nil {
+			t.Errorf("ParseFEN(%q): %v", fen, err)
+			continue
+		}
+		if got := p.FEN(); got != fen {
+			t.Errorf("FEN() = %q; want %q", got, fen)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1",
+	} {
+		if _, err := ParseFEN(bad); err == nil {
+			t.Errorf("ParseFEN(%q) succeeded", bad)
+		}
+	}
+
+	// The move counters are optional.
+	if p, err := ParseFEN("8/8/8/8/8/8/6k1/4K2R w K -"); err != nil || p.Fullmove != 1 {
+		t.Errorf("ParseFEN without counters = %v, %v", p.FEN(), err)
+	}
+}
+
+func TestSquares(t *testing.T) {
+	for name, want := range map[string]Square{"a1": 0, "h1": 7, "a2": 8, "e4": 28, "h8": 63} {
+		s, err := ParseSquare(name)
+		if err != nil || s != want {
+			t.Errorf("ParseSquare(%q) = %d, %v; want %d", name, s, err, want)
+		}
+		if s.String() != name {
+			t.Errorf("Square(%d).String() = %q", s, s.String())
+		}
+	}
+
+	for _, bad := range []string{"", "i1", "a0", "a9", "e44"} {
+		if _, err := ParseSquare(bad); err == nil {
+			t.Errorf("ParseSquare(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrOver = errors.New("the game is over")
+
+// Results as PGN writes them.
+const (
+	Ongoing   = "*"
+	WhiteWins = "1-0"
+	BlackWins = "0-1"
+	Drawn     = "1/2-1/2"
+)
+
+// Game is a whole game from the starting position: the moves so far, and
+// how it ended once it has.
+type Game struct {
+	Pos Position
+
+	// SAN holds every move played, in standard algebraic notation.
+	SAN []string
+
+	Result string
+
+	// Reason says how the game ended, as in "checkmate" or "threefold
+	// repetition".
+	Reason string
+
+	// seen counts how often each position has come up, for repetition.
+	seen map[string]int
+}
+
+func NewGame() *Game {
+	g := &Game{Pos: Start(), Result: Ongoing, seen: map[string]int{}}
+	g.seen[g.Pos.repetition_key()]++
+	return g
+}
+
+func (g *Game) Over() bool {
+	return g.Result != Ongoing
+}
+
+// Play makes the move text names and returns it in SAN, then ends the
+// game if that move finished it.
+func (g *Game) Play(text string) (string, error) {
+	if g.Over() {
+		return "", ErrOver
+	}
+
+	m, err := g.Pos.ParseMove(text)
+	if err != nil {
+		return "", err
+	}
+
+	san := g.Pos.SAN(m)
+	g.Pos = g.Pos.Apply(m)
+	g.SAN = append(g.SAN, san)
+	g.seen[g.Pos.repetition_key()]++
+
+	switch {
+	case len(g.Pos.Moves()) == 0 && g.Pos.InCheck():
+		g.finish(win_for(g.Pos.Turn.Other()), "checkmate")
+	case len(g.Pos.Moves()) == 0:
+		g.finish(Drawn, "stalemate")
+	case g.seen[g.Pos.repetition_key()] >= 3:
+		g.finish(Drawn, "threefold repetition")
+	case g.Pos.Halfmove >= 100:
+		g.finish(Drawn, "the fifty-move rule")
+	}
+
+	return san, nil
+}
+
+func win_for(c Color) string {
+	if c == White {
+		return WhiteWins
+	}
+	return BlackWins
+}
+
+func (g *Game) finish(result, reason string) {
+	g.Result, g.Reason = result, reason
+}
+
+// Resign ends the game in favour of c's opponent.
+func (g *Game) Resign(c Color) {
+	if !g.Over() {
+		g.finish(win_for(c.Other()), c.String()+" resigned")
+	}
+}
+
+// Draw ends the game drawn by agreement.
+func (g *Game) Draw() {
+	if !g.Over() {
+		g.finish(Drawn, "agreed")
+	}
+}
+
+// Forfeit ends the game in favour of c's opponent for some other reason,
+// such as running out of time.
+func (g *Game) Forfeit(c Color, reason string) {
+	if !g.Over() {
+		g.finish(win_for(c.Other()), reason)
+	}
+}
+
+// repetition_key identifies a position for the repetition rule: the same
+// pieces on the same squares, with the same side to move and the same
+// moves available. The en passant square only counts if a pawn could
+// actually take there.
+func (p *Position) repetition_key() string {
+	ep := NoSquare
+	for _, m := range p.Moves() {
+		if p.is_en_passant(m) {
+			ep = p.EnPassant
+		}
+	}
+	return fmt.Sprintf("%s %d %s %s", p.placement(), p.Turn, p.castling_string(), ep)
+}
+
+// PGN writes the game in Portable Game Notation. tags go first, in the
+// order given, followed by the result tag.
+func (g *Game) PGN(tags [][2]string) string {
+	var b strings.Builder
+	for _, t := range tags {
+		fmt.Fprintf(&b, "[%s %q]\n", t[0], t[1])
+	}
+	fmt.Fprintf(&b, "[Result %q]\n\n", g.Result)
+
+	var words []string
+	for i, san := range g.SAN {
+		if i%2 == 0 {
+			words = append(words, fmt.Sprintf("%d.", i/2+1))
+		}
+		words = append(words, san)
+	}
+	words = append(words, g.Result)
+
+	// Lines of movetext are kept under 80 characters.
+	line := 0
+	for i, w := range words {
+		if i > 0 && line+1+len(w) > 79 {
+			b.WriteString("\n")
+			line = 0
+		} else if i > 0 {
+			b.WriteString(" ")
+			line++
+		}
+		b.WriteString(w)
+		line += len(w)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
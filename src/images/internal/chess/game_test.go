@@ -0,0 +1,109 @@
+package chess
+
+import (
+	"strings"
+	"testing"
+)
+
+func play(t *testing.T, g *Game, moves string) {
+	t.Helper()
+	for _, m := range strings.Fields(moves) {
+		if _, err := g.Play(m); err != nil {
+			t.Fatalf("%s: %v", m, err)
+		}
+	}
+}
+
+func TestCheckmate(t *testing.T) {
+	g := NewGame()
+	play(t, g, "f3 e5 g4 Qh4")
+
+	if g.Result != BlackWins || g.Reason != "checkmate" {
+		t.Errorf("after fool's mate: %s by %s", g.Result, g.Reason)
+	}
+	if g.SAN[3] != "Qh4#" {
+		t.Errorf("mate is written %q", g.SAN[3])
+	}
+	if _, err := g.Play("a3"); err != ErrOver {
+		t.Errorf("played on after mate: %v", err)
+	}
+}
+
+func TestStalemate(t *testing.T) {
+	g := NewGame()
+	// Sam Loyd's ten-move stalemate.
+	play(t, g, "e3 a5 Qh5 Ra6 Qxa5 h5 h4 Rah6 Qxc7 f6 Qxd7+ Kf7 Qxb7 Qd3 Qxb8 Qh7 Qxc8 Kg6 Qe6")
+
+	if g.Result != Drawn || g.Reason != "stalemate" {
+		t.Errorf("after Loyd's stalemate: %s by %s", g.Result, g.Reason)
+	}
+}
+
+func TestThreefoldRepetition(t *testing.T) {
+	g := NewGame()
+	play(t, g, "Nf3 Nf6 Ng1 Ng8 Nf3 Nf6 Ng1")
+	if g.Over() {
+		t.Fatal("drawn before the third repetition")
+	}
+
+	play(t, g, "Ng8")
+	if g.Result != Drawn || g.Reason != "threefold repetition" {
+		t.Errorf("after three repetitions: %s by %s", g.Result, g.Reason)
+	}
+}
+
+func TestFiftyMoveRule(t *testing.T) {
+	g := NewGame()
+	g.Pos, _ = ParseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 99 80")
+
+	play(t, g, "Ra2")
+	if g.Result != Drawn || g.Reason != "the fifty-move rule" {
+		t.Errorf("after 50 quiet moves: %s by %s", g.Result, g.Reason)
+	}
+}
+
+func TestResignAndDraw(t *testing.T) {
+	g := NewGame()
+	g.Resign(White)
+	if g.Result != BlackWins {
+		t.Errorf("White resigned: %s", g.Result)
+	}
+
+	// The first result stands.
+	g.Draw()
+	if g.Result != BlackWins {
+		t.Errorf("drawn after resigning: %s", g.Result)
+	}
+}
+
+func TestPGN(t *testing.T) {
+	g := NewGame()
+	play(t, g, "e4 e5 Nf3 Nc6 Bb5 a6")
+	g.Draw()
+
+	got := g.PGN([][2]string{{"White", "alice"}, {"Black", "bob"}})
+	want := `[White "alice"]
+[Black "bob"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1/2-1/2
+`
+	if got != want {
+		t.Errorf("PGN:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Long games wrap.
+	long := NewGame()
+	for range 120 {
+		long.SAN = append(long.SAN, "Qxh7+")
+	}
+	lines := strings.Split(long.PGN(nil), "\n")
+	if len(lines) < 10 {
+		t.Errorf("120 moves fit on %d lines", len(lines))
+	}
+	for _, line := range lines {
+		if len(line) >= 80 {
+			t.Errorf("PGN line is %d characters: %q", len(line), line)
+		}
+	}
+}
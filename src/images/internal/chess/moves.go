@@ -0,0 +1,339 @@
+package chess
+
+// Move takes a piece from one square to another. Castling is written as
+// the king's move, two squares along. Promotion is the kind a pawn
+// reaching the last rank becomes.
+type Move struct {
+	From, To  Square
+	Promotion Kind
+}
+
+type offset struct {
+	file, rank int
+}
+
+var (
+	knight_jumps = []offset{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	king_steps   = []offset{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+	rook_lines   = []offset{{0, 1}, {1, 0}, {0, -1}, {-1, 0}}
+	bishop_lines = []offset{{1, 1}, {1, -1}, {-1, -1}, {-1, 1}}
+
+	promotions = []Kind{Queen, Rook, Bishop, Knight}
+)
+
+// step returns the square o away from s, if that is still on the board.
+func step(s Square, o offset) (Square, bool) {
+	file, rank := s.File()+o.file, s.Rank()+o.rank
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return NoSquare, false
+	}
+	return Sq(file, rank), true
+}
+
+// pawn_dir is the way c's pawns go up the board.
+func pawn_dir(c Color) int {
+	if c == White {
+		return 1
+	}
+	return -1
+}
+
+// Attacked reports whether any of by's pieces attack s.
+func (p *Position) Attacked(s Square, by Color) bool {
+	is := func(at Square, kinds ...Kind) bool {
+		piece := p.Board[at]
+		if piece.Kind == None || piece.Color != by {
+			return false
+		}
+		for _, k := range kinds {
+			if piece.Kind == k {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A pawn attacks s from one rank behind it, as by's pawns move.
+	for _, df := range []int{-1, 1} {
+		if at, ok := step(s, offset{df, -pawn_dir(by)}); ok && is(at, Pawn) {
+			return true
+		}
+	}
+	for _, o := range knight_jumps {
+		if at, ok := step(s, o); ok && is(at, Knight) {
+			return true
+		}
+	}
+	for _, o := range king_steps {
+		if at, ok := step(s, o); ok && is(at, King) {
+			return true
+		}
+	}
+
+	slides := func(lines []offset, kinds ...Kind) bool {
+		for _, o := range lines {
+			for at, ok := step(s, o); ok; at, ok = step(at, o) {
+				if p.Board[at].Kind != None {
+					if is(at, kinds...) {
+						return true
+					}
+					break
+				}
+			}
+		}
+		return false
+	}
+	return slides(rook_lines, Rook, Queen) || slides(bishop_lines, Bishop, Queen)
+}
+
+func (p *Position) king(c Color) Square {
+	for s, piece := range p.Board {
+		if piece.Kind == King && piece.Color == c {
+			return Square(s)
+		}
+	}
+	return NoSquare
+}
+
+// InCheck reports whether the side to move is in check.
+func (p *Position) InCheck() bool {
+	k := p.king(p.Turn)
+	return k != NoSquare && p.Attacked(k, p.Turn.Other())
+}
+
+// Moves lists every legal move for the side to move.
+func (p *Position) Moves() []Move {
+	var legal []Move
+	for _, m := range p.pseudo_moves() {
+		next := p.Apply(m)
+		k := next.king(p.Turn)
+		if k == NoSquare || !next.Attacked(k, next.Turn) {
+			legal = append(legal, m)
+		}
+	}
+	return legal
+}
+
+// pseudo_moves lists the moves that follow the way each piece moves,
+// without checking whether they leave the king in check. Castling is the
+// exception: it is only listed when the king doesn't start, pass through
+// or land on an attacked square.
+func (p *Position) pseudo_moves() []Move {
+	var moves []Move
+	me := p.Turn
+
+	for i, piece := range p.Board {
+		from := Square(i)
+		if piece.Kind == None || piece.Color != me {
+			continue
+		}
+
+		target := func(to Square) bool {
+			t := p.Board[to]
+			return t.Kind == None || t.Color != me
+		}
+
+		switch piece.Kind {
+		case Pawn:
+			moves = p.pawn_moves(moves, from)
+		case Knight, King:
+			steps := knight_jumps
+			if piece.Kind == King {
+				steps = king_steps
+			}
+			for _, o := range steps {
+				if to, ok := step(from, o); ok && target(to) {
+					moves = append(moves, Move{From: from, To: to})
+				}
+			}
+		default:
+			var lines []offset
+			if piece.Kind != Bishop {
+				lines = append(lines, rook_lines...)
+			}
+			if piece.Kind != Rook {
+				lines = append(lines, bishop_lines...)
+			}
+			for _, o := range lines {
+				for to, ok := step(from, o); ok; to, ok = step(to, o) {
+					if !target(to) {
+						break
+					}
+					moves = append(moves, Move{From: from, To: to})
+					if p.Board[to].Kind != None {
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return p.castling_moves(moves)
+}
+
+func (p *Position) pawn_moves(moves []Move, from Square) []Move {
+	me := p.Turn
+	dir := pawn_dir(me)
+	last := 7
+	start := 1
+	if me == Black {
+		last, start = 0, 6
+	}
+
+	add := func(to Square) {
+		if to.Rank() == last {
+			for _, k := range promotions {
+				moves = append(moves, Move{From: from, To: to, Promotion: k})
+			}
+			return
+		}
+		moves = append(moves, Move{From: from, To: to})
+	}
+
+	if one, ok := step(from, offset{0, dir}); ok && p.Board[one].Kind == None {
+		add(one)
+		if two, ok := step(one, offset{0, dir}); ok && from.Rank() == start && p.Board[two].Kind == None {
+			add(two)
+		}
+	}
+
+	for _, df := range []int{-1, 1} {
+		to, ok := step(from, offset{df, dir})
+		if !ok {
+			continue
+		}
+		if t := p.Board[to]; (t.Kind != None && t.Color != me) || to == p.EnPassant {
+			add(to)
+		}
+	}
+
+	return moves
+}
+
+// castle describes one of the four castling moves.
+type castle struct {
+	right          Castling
+	king, rook     Square
+	king_to        Square
+	rook_to        Square
+	must_be_empty  []Square
+	must_be_unseen []Square
+}
+
+var castles = []castle{
+	{WhiteKingside, Sq(4, 0), Sq(7, 0), Sq(6, 0), Sq(5, 0), []Square{Sq(5, 0), Sq(6, 0)}, []Square{Sq(5, 0), Sq(6, 0)}},
+	{WhiteQueenside, Sq(4, 0), Sq(0, 0), Sq(2, 0), Sq(3, 0), []Square{Sq(1, 0), Sq(2, 0), Sq(3, 0)}, []Square{Sq(2, 0), Sq(3, 0)}},
+	{BlackKingside, Sq(4, 7), Sq(7, 7), Sq(6, 7), Sq(5, 7), []Square{Sq(5, 7), Sq(6, 7)}, []Square{Sq(5, 7), Sq(6, 7)}},
+	{BlackQueenside, Sq(4, 7), Sq(0, 7), Sq(2, 7), Sq(3, 7), []Square{Sq(1, 7), Sq(2, 7), Sq(3, 7)}, []Square{Sq(2, 7), Sq(3, 7)}},
+}
+
+func (p *Position) castling_moves(moves []Move) []Move {
+	them := p.Turn.Other()
+
+next:
+	for _, c := range castles {
+		if p.Castling&c.right == 0 || p.Board[c.king] != (Piece{King, p.Turn}) || p.Board[c.rook] != (Piece{Rook, p.Turn}) {
+			continue
+		}
+		for _, s := range c.must_be_empty {
+			if p.Board[s].Kind != None {
+				continue next
+			}
+		}
+		if p.Attacked(c.king, them) {
+			continue
+		}
+		for _, s := range c.must_be_unseen {
+			if p.Attacked(s, them) {
+				continue next
+			}
+		}
+		moves = append(moves, Move{From: c.king, To: c.king_to})
+	}
+
+	return moves
+}
+
+// is_castle reports whether m, in p, is a king castling rather than
+// taking an ordinary step.
+func (p *Position) is_castle(m Move) bool {
+	diff := m.To.File() - m.From.File()
+	return p.Board[m.From].Kind == King && (diff == 2 || diff == -2)
+}
+
+// is_en_passant reports whether m, in p, is a pawn taking en passant.
+func (p *Position) is_en_passant(m Move) bool {
+	return p.Board[m.From].Kind == Pawn && m.To == p.EnPassant && m.From.File() != m.To.File()
+}
+
+// IsCapture reports whether m takes a piece.
+func (p *Position) IsCapture(m Move) bool {
+	return p.Board[m.To].Kind != None || p.is_en_passant(m)
+}
+
+// Apply returns the position after m, which is assumed to be legal.
+func (p *Position) Apply(m Move) Position {
+	next := *p
+	piece := p.Board[m.From]
+	capture := p.IsCapture(m)
+
+	next.Board[m.From] = Piece{}
+	if p.is_en_passant(m) {
+		next.Board[Sq(m.To.File(), m.From.Rank())] = Piece{}
+	}
+	if p.is_castle(m) {
+		for _, c := range castles {
+			if c.king == m.From && c.king_to == m.To {
+				next.Board[c.rook] = Piece{}
+				next.Board[c.rook_to] = Piece{Rook, piece.Color}
+			}
+		}
+	}
+	if m.Promotion != None {
+		piece.Kind = m.Promotion
+	}
+	next.Board[m.To] = piece
+
+	next.EnPassant = NoSquare
+	if piece.Kind == Pawn && (m.To.Rank()-m.From.Rank() == 2 || m.To.Rank()-m.From.Rank() == -2) {
+		next.EnPassant = Sq(m.From.File(), (m.From.Rank()+m.To.Rank())/2)
+	}
+
+	// Moving a king or rook, or taking a rook at home, loses the right to
+	// castle with it.
+	for _, c := range castles {
+		if m.From == c.king || m.From == c.rook || m.To == c.rook {
+			next.Castling &^= c.right
+		}
+	}
+
+	next.Halfmove++
+	if piece.Kind == Pawn || capture {
+		next.Halfmove = 0
+	}
+	if p.Turn == Black {
+		next.Fullmove++
+	}
+	next.Turn = p.Turn.Other()
+	return next
+}
+
+// Perft counts the positions depth moves ahead. Checking its counts
+// against well-known ones is the standard test of a move generator.
+func (p *Position) Perft(depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	moves := p.Moves()
+	if depth == 1 {
+		return len(moves)
+	}
+
+	n := 0
+	for _, m := range moves {
+		next := p.Apply(m)
+		n += next.Perft(depth - 1)
+	}
+	return n
+}
@@ -0,0 +1,140 @@
+package chess
+
+import "testing"
+
+// The positions and counts are the usual ones from the Chess Programming
+// Wiki's perft results page. Between them they cover castling through and
+// out of check, en passant, promotions and discovered checks.
+var perft_positions = []struct {
+	name   string
+	fen    string
+	counts []int
+}{
+	{"start", StartFEN, []int{20, 400, 8902, 197281}},
+	{"kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+	{"position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238}},
+	{"position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+	{"position 4 mirrored", "r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1", []int{6, 264, 9467}},
+	{"position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379}},
+	{"position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890}},
+}
+
+func TestPerft(t *testing.T) {
+	for _, tc := range perft_positions {
+		p, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for i, want := range tc.counts {
+			if got := p.Perft(i + 1); got != want {
+				t.Errorf("%s: perft(%d) = %d; want %d", tc.name, i+1, got, want)
+			}
+		}
+	}
+}
+
+func moves_from(t *testing.T, fen string) (Position, map[string]bool) {
+	t.Helper()
+	p, err := ParseFEN(fen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]bool{}
+	for _, m := range p.Moves() {
+		found[m.From.String()+m.To.String()+m.Promotion.Letter()] = true
+	}
+	return p, found
+}
+
+func TestPinnedPiece(t *testing.T) {
+	// The knight on e4 is pinned to the king by the rook on e8.
+	_, found := moves_from(t, "4r1k1/8/8/8/4N3/8/8/4K3 w - - 0 1")
+	for m := range found {
+		if m[:2] == "e4" {
+			t.Errorf("pinned knight can move: %s", m)
+		}
+	}
+}
+
+func TestCastlingRules(t *testing.T) {
+	// Both ways are open.
+	_, found := moves_from(t, "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if !found["e1g1 "] || !found["e1c1 "] {
+		t.Errorf("can't castle on an open board: %v", found)
+	}
+
+	// The bishop on c4 sees f1, which the king would pass through.
+	_, found = moves_from(t, "r3k2r/8/8/8/2b5/8/8/R3K2R w KQkq - 0 1")
+	if found["e1g1 "] || !found["e1c1 "] {
+		t.Error("castled through an attacked square")
+	}
+
+	// b1 is only passed by the rook, so an attack there doesn't matter,
+	// but a piece standing there does.
+	_, found = moves_from(t, "r3k2r/8/8/8/8/8/8/RN2K2R w KQkq - 0 1")
+	if found["e1c1 "] {
+		t.Error("castled through a piece")
+	}
+	_, found = moves_from(t, "r3k2r/8/8/8/8/8/5b2/R3K2R w KQkq - 0 1")
+	if found["e1g1 "] || found["e1c1 "] {
+		t.Error("castled out of check")
+	}
+
+	// Without the rights, no castling.
+	_, found = moves_from(t, "r3k2r/8/8/8/8/8/8/R3K2R w kq - 0 1")
+	if found["e1g1 "] || found["e1c1 "] {
+		t.Error("castled without the right to")
+	}
+}
+
+func TestApplyCastlingAndRights(t *testing.T) {
+	p, _ := ParseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+
+	next := p.Apply(Move{From: Sq(4, 0), To: Sq(6, 0)})
+	if next.At(Sq(5, 0)) != (Piece{Rook, White}) || next.At(Sq(7, 0)).Kind != None {
+		t.Error("the rook didn't move when castling")
+	}
+	if next.Castling != BlackKingside|BlackQueenside {
+		t.Errorf("castling rights after castling = %v", next.castling_string())
+	}
+
+	// Taking the rook on h8 takes away Black's kingside castling.
+	p, _ = ParseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	next = p.Apply(Move{From: Sq(7, 0), To: Sq(7, 7)})
+	if got := next.castling_string(); got != "Qq" {
+		t.Errorf("castling rights after Rxh8 = %s; want Qq", got)
+	}
+}
+
+func TestEnPassant(t *testing.T) {
+	p, _ := ParseFEN("4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1")
+	m := Move{From: Sq(4, 4), To: Sq(3, 5)}
+
+	found := false
+	for _, legal := range p.Moves() {
+		found = found || legal == m
+	}
+	if !found {
+		t.Fatal("exd6 en passant isn't offered")
+	}
+
+	next := p.Apply(m)
+	if next.At(Sq(3, 4)).Kind != None || next.At(Sq(3, 5)) != (Piece{Pawn, White}) {
+		t.Error("en passant didn't take the pawn")
+	}
+
+	// Taking en passant here would open the rank to the king.
+	_, moves := moves_from(t, "8/8/8/K2pP2r/8/8/8/4k3 w - d6 0 1")
+	if moves["e5d6 "] {
+		t.Error("took en passant into check")
+	}
+}
+
+func TestPromotion(t *testing.T) {
+	_, found := moves_from(t, "8/4P3/8/8/8/8/k7/4K3 w - - 0 1")
+	for _, k := range "QRBN" {
+		if !found["e7e8"+string(k)] {
+			t.Errorf("can't promote to %c", k)
+		}
+	}
+}
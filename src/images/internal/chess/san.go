@@ -0,0 +1,163 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrIllegal   = errors.New("that isn't a legal move")
+	ErrAmbiguous = errors.New("more than one piece can make that move")
+	ErrNotation  = errors.New("write moves like Nf3, exd5, O-O or e2e4")
+	ErrPromote   = errors.New("say what to promote to, like e8=Q")
+)
+
+// SAN writes m in standard algebraic notation, as in "Nbd7", "exd5",
+// "O-O" or "e8=Q+".
+func (p *Position) SAN(m Move) string {
+	next := p.Apply(m)
+	suffix := ""
+	if next.InCheck() {
+		suffix = "+"
+		if len(next.Moves()) == 0 {
+			suffix = "#"
+		}
+	}
+
+	return p.san_body(m) + suffix
+}
+
+// san_body is SAN without the check or mate sign.
+func (p *Position) san_body(m Move) string {
+	piece := p.Board[m.From]
+
+	if p.is_castle(m) {
+		if m.To.File() == 6 {
+			return "O-O"
+		}
+		return "O-O-O"
+	}
+
+	capture := ""
+	if p.IsCapture(m) {
+		capture = "x"
+	}
+
+	if piece.Kind == Pawn {
+		s := m.To.String()
+		if capture != "" {
+			s = string(rune('a'+m.From.File())) + "x" + s
+		}
+		if m.Promotion != None {
+			s += "=" + m.Promotion.Letter()
+		}
+		return s
+	}
+
+	// Name the piece's file, or failing that its rank, or failing that
+	// both, if another of the same kind could go to the same square.
+	same_file, same_rank, others := false, false, false
+	for _, o := range p.Moves() {
+		if o.To != m.To || o.From == m.From || p.Board[o.From].Kind != piece.Kind {
+			continue
+		}
+		others = true
+		same_file = same_file || o.From.File() == m.From.File()
+		same_rank = same_rank || o.From.Rank() == m.From.Rank()
+	}
+
+	from := ""
+	switch {
+	case !others:
+	case !same_file:
+		from = m.From.String()[:1]
+	case !same_rank:
+		from = m.From.String()[1:]
+	default:
+		from = m.From.String()
+	}
+
+	return piece.Kind.Letter() + from + capture + m.To.String()
+}
+
+var (
+	long_form = regexp.MustCompile(`^([a-h][1-8])[-x]?([a-h][1-8])=?([qrbnQRBN])?$`)
+	san_form  = regexp.MustCompile(`^([NBRQK])?([a-h])?([1-8])?x?([a-h][1-8])(?:=?([NBRQ]))?$`)
+)
+
+// ParseMove finds the legal move text names. It takes standard algebraic
+// notation, with or without the check sign, and also the long form that
+// gives both squares, as in "e2e4" or "e7e8q".
+func (p *Position) ParseMove(text string) (Move, error) {
+	text = strings.TrimRight(strings.TrimSpace(text), "+#!?")
+	legal := p.Moves()
+
+	switch strings.ReplaceAll(text, "0", "O") {
+	case "O-O", "O-O-O":
+		for _, m := range legal {
+			if p.is_castle(m) && p.san_body(m) == strings.ReplaceAll(text, "0", "O") {
+				return m, nil
+			}
+		}
+		return Move{}, ErrIllegal
+	}
+
+	if f := long_form.FindStringSubmatch(text); f != nil {
+		from, _ := ParseSquare(f[1])
+		to, _ := ParseSquare(f[2])
+		promotion := None
+		if f[3] != "" {
+			promotion = Kind(strings.Index(kind_letters, strings.ToUpper(f[3])))
+		}
+		return p.pick(legal, func(m Move) bool { return m.From == from && m.To == to }, promotion)
+	}
+
+	f := san_form.FindStringSubmatch(text)
+	if f == nil {
+		// People often type piece letters in lower case. A leading 'b' is
+		// left as a file, since "bxc3" is far more likely than "Bxc3".
+		if len(text) > 1 && strings.ContainsRune("nrqk", rune(text[0])) {
+			return p.ParseMove(strings.ToUpper(text[:1]) + text[1:])
+		}
+		return Move{}, ErrNotation
+	}
+
+	kind := Pawn
+	if f[1] != "" {
+		kind = Kind(strings.Index(kind_letters, f[1]))
+	}
+	to, _ := ParseSquare(f[4])
+	promotion := None
+	if f[5] != "" {
+		promotion = Kind(strings.Index(kind_letters, f[5]))
+	}
+
+	return p.pick(legal, func(m Move) bool {
+		return m.To == to && p.Board[m.From].Kind == kind && !p.is_castle(m) &&
+			(f[2] == "" || m.From.File() == int(f[2][0]-'a')) &&
+			(f[3] == "" || m.From.Rank() == int(f[3][0]-'1'))
+	}, promotion)
+}
+
+// pick returns the one legal move that matches and promotes to promotion,
+// if it's a promotion at all.
+func (p *Position) pick(legal []Move, match func(Move) bool, promotion Kind) (Move, error) {
+	var found []Move
+	for _, m := range legal {
+		if match(m) && (m.Promotion == None || m.Promotion == promotion || promotion == None) {
+			found = append(found, m)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		return Move{}, ErrIllegal
+	case found[0].Promotion != None && promotion == None:
+		return Move{}, ErrPromote
+	case len(found) > 1:
+		return Move{}, fmt.Errorf("%w: say which, like %s", ErrAmbiguous, p.SAN(found[0]))
+	}
+	return found[0], nil
+}
@@ -0,0 +1,95 @@
+package chess
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSAN(t *testing.T) {
+	for _, tc := range []struct {
+		fen, move, want string
+	}{
+		{StartFEN, "g1f3", "Nf3"},
+		{StartFEN, "e2e4", "e4"},
+		{"4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "e4d5", "exd5"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1g1", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O"},
+		// Knights on b1 and f1 both reach d2: the file tells them apart.
+		{"4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1", "b1d2", "Nbd2"},
+		// Rooks on a1 and a5 share a file, so the rank is given.
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1a3", "R1a3"},
+		// Queens on a1, c1 and a3 all reach b2; a1 shares a file with a3
+		// and a rank with c1, so it takes both.
+		{"4k3/8/8/8/8/Q7/8/Q1Q1K3 w - - 0 1", "a1b2", "Qa1b2"},
+		{"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8q", "e8=Q"},
+		{"4k3/8/8/8/8/8/8/4K2R w K - 0 1", "h1h8", "Rh8+"},
+		// Fool's mate.
+		{"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2", "d8h4", "Qh4#"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+	} {
+		p, err := ParseFEN(tc.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := p.ParseMove(tc.move)
+		if err != nil {
+			t.Errorf("%s: ParseMove(%q): %v", tc.fen, tc.move, err)
+			continue
+		}
+		if got := p.SAN(m); got != tc.want {
+			t.Errorf("%s: SAN(%s) = %q; want %q", tc.fen, tc.move, got, tc.want)
+		}
+
+		// Every move reads back from its own SAN.
+		if back, err := p.ParseMove(tc.want); err != nil || back != m {
+			t.Errorf("ParseMove(%q) = %v, %v; want %v", tc.want, back, err, m)
+		}
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	p := Start()
+
+	for text, want := range map[string]Move{
+		"Nf3":   {From: Sq(6, 0), To: Sq(5, 2)},
+		"nf3":   {From: Sq(6, 0), To: Sq(5, 2)},
+		"Ngf3":  {From: Sq(6, 0), To: Sq(5, 2)},
+		"g1-f3": {From: Sq(6, 0), To: Sq(5, 2)},
+		"e4":    {From: Sq(4, 1), To: Sq(4, 3)},
+		" e4+ ": {From: Sq(4, 1), To: Sq(4, 3)},
+	} {
+		if m, err := p.ParseMove(text); err != nil || m != want {
+			t.Errorf("ParseMove(%q) = %v, %v; want %v", text, m, err, want)
+		}
+	}
+
+	for text, want := range map[string]error{
+		"e5":    ErrIllegal,
+		"Nd4":   ErrIllegal,
+		"O-O":   ErrIllegal,
+		"hello": ErrNotation,
+		"e2e5":  ErrIllegal,
+	} {
+		if _, err := p.ParseMove(text); !errors.Is(err, want) {
+			t.Errorf("ParseMove(%q) error = %v; want %v", text, err, want)
+		}
+	}
+
+	amb, _ := ParseFEN("4k3/8/8/8/8/8/8/1N2KN2 w - - 0 1")
+	if _, err := amb.ParseMove("Nd2"); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("ParseMove(Nd2) with two knights = %v; want ErrAmbiguous", err)
+	}
+
+	promo, _ := ParseFEN("8/4P3/8/8/8/8/k7/4K3 w - - 0 1")
+	if _, err := promo.ParseMove("e8"); !errors.Is(err, ErrPromote) {
+		t.Errorf("ParseMove(e8) without a piece = %v; want ErrPromote", err)
+	}
+	if m, err := promo.ParseMove("e8=N"); err != nil || m.Promotion != Knight {
+		t.Errorf("ParseMove(e8=N) = %v, %v", m, err)
+	}
+
+	castle, _ := ParseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if m, err := castle.ParseMove("0-0-0"); err != nil || m.To != Sq(2, 0) {
+		t.Errorf("ParseMove(0-0-0) = %v, %v", m, err)
+	}
+}
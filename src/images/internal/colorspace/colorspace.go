@@ -0,0 +1,73 @@
+// Package colorspace converts colors between RGB and HSV.
+package colorspace
+
+import "math"
+
+// RGBToHSV converts r, g and b, each from 0 to 1, to a hue in degrees
+// from 0 up to 360, and a saturation and value from 0 to 1. Grays have
+// no hue, and come out with 0.
+func RGBToHSV(r, g, b float64) (h, s, v float64) {
+	hi := max(r, g, b)
+	lo := min(r, g, b)
+	v = hi
+	if hi == 0 {
+		return 0, 0, v
+	}
+	s = (hi - lo) / hi
+
+	d := hi - lo
+	switch {
+	case d == 0:
+		return 0, s, v
+	case hi == r:
+		h = (g - b) / d
+	case hi == g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return Wrap(h * 60), s, v
+}
+
+// HSVToRGB is the inverse of RGBToHSV. Any hue will do; it's taken
+// around the circle.
+func HSVToRGB(h, s, v float64) (r, g, b float64) {
+	h = Wrap(h) / 60
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	m := v - c
+	return r + m, g + m, b + m
+}
+
+// Wrap brings a hue in degrees round to between 0 and 360.
+func Wrap(h float64) float64 {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+// Saturate multiplies the saturation of r, g and b, each from 0 to 1, by
+// f, up to full saturation, keeping hue and value. f of 0 leaves a gray
+// as bright as the color's brightest channel.
+func Saturate(r, g, b, f float64) (float64, float64, float64) {
+	h, s, v := RGBToHSV(r, g, b)
+	return HSVToRGB(h, min(max(s*f, 0), 1), v)
+}
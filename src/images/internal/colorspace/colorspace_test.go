@@ -0,0 +1,107 @@
+package colorspace
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRGBToHSV(t *testing.T) {
+	tests := []struct {
+		r, g, b float64
+		h, s, v float64
+	}{
+		{1, 0, 0, 0, 1, 1},
+		{0, 1, 0, 120, 1, 1},
+		{0, 0, 1, 240, 1, 1},
+		{1, 1, 0, 60, 1, 1},
+		{1, 0, 1, 300, 1, 1},
+		{0.5, 0.25, 0.25, 0, 0.5, 0.5},
+		{0, 0, 0, 0, 0, 0},
+		{0.5, 0.5, 0.5, 0, 0, 0.5},
+		{1, 1, 1, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		h, s, v := RGBToHSV(tt.r, tt.g, tt.b)
+		if !near(h, tt.h) || !near(s, tt.s) || !near(v, tt.v) {
+			t.Errorf("RGBToHSV(%v, %v, %v) = %v, %v, %v; want %v, %v, %v", tt.r, tt.g, tt.b, h, s, v, tt.h, tt.s, tt.v)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for r := 0.0; r <= 1; r += 0.1 {
+		for g := 0.0; g <= 1; g += 0.1 {
+			for b := 0.0; b <= 1; b += 0.1 {
+				r2, g2, b2 := HSVToRGB(RGBToHSV(r, g, b))
+				if !near(r, r2) || !near(g, g2) || !near(b, b2) {
+					t.Fatalf("%v, %v, %v came back as %v, %v, %v", r, g, b, r2, g2, b2)
+				}
+			}
+		}
+	}
+}
+
+func TestHueWraps(t *testing.T) {
+	for _, h := range []float64{-240, 120, 480, 840} {
+		r, g, b := HSVToRGB(h, 1, 1)
+		if !near(r, 0) || !near(g, 1) || !near(b, 0) {
+			t.Errorf("HSVToRGB(%v, 1, 1) = %v, %v, %v; want green", h, r, g, b)
+		}
+	}
+}
+
+func TestComplement(t *testing.T) {
+	tests := []struct {
+		r, g, b    float64
+		cr, cg, cb float64
+	}{
+		{1, 0, 0, 0, 1, 1},
+		{1, 1, 0, 0, 0, 1},
+		{0.5, 0.25, 0.25, 0.25, 0.5, 0.5},
+		{0.5, 0.5, 0.5, 0.5, 0.5, 0.5},
+	}
+
+	for _, tt := range tests {
+		h, s, v := RGBToHSV(tt.r, tt.g, tt.b)
+		r, g, b := HSVToRGB(h+180, s, v)
+		if !near(r, tt.cr) || !near(g, tt.cg) || !near(b, tt.cb) {
+			t.Errorf("%v, %v, %v turned 180° = %v, %v, %v; want %v, %v, %v", tt.r, tt.g, tt.b, r, g, b, tt.cr, tt.cg, tt.cb)
+		}
+	}
+}
+
+func TestSaturate(t *testing.T) {
+	for r := 0.0; r <= 1; r += 0.25 {
+		for g := 0.0; g <= 1; g += 0.25 {
+			for b := 0.0; b <= 1; b += 0.25 {
+				if r2, g2, b2 := Saturate(r, g, b, 1); !near(r, r2) || !near(g, g2) || !near(b, b2) {
+					t.Errorf("Saturate(%v, %v, %v, 1) = %v, %v, %v; want it unchanged", r, g, b, r2, g2, b2)
+				}
+				if r2, g2, b2 := Saturate(r, g, b, 0); !near(r2, g2) || !near(g2, b2) || !near(r2, max(r, g, b)) {
+					t.Errorf("Saturate(%v, %v, %v, 0) = %v, %v, %v; want a gray at %v", r, g, b, r2, g2, b2, max(r, g, b))
+				}
+			}
+		}
+	}
+
+	// Grays have no saturation to take away, or to add.
+	for v := 0.0; v <= 1; v += 0.1 {
+		for _, f := range []float64{0, 2} {
+			if r, g, b := Saturate(v, v, v, f); !near(r, v) || !near(g, v) || !near(b, v) {
+				t.Errorf("Saturate(%v, %v, %v, %v) = %v, %v, %v", v, v, v, f, r, g, b)
+			}
+		}
+	}
+
+	if r, g, b := Saturate(1, 0.75, 0.75, 2); !near(r, 1) || !near(g, 0.5) || !near(b, 0.5) {
+		t.Errorf("doubling gave %v, %v, %v; want 1, 0.5, 0.5", r, g, b)
+	}
+	if r, g, b := Saturate(1, 0.25, 0.25, 2); !near(r, 1) || !near(g, 0) || !near(b, 0) {
+		t.Errorf("doubling past full gave %v, %v, %v; want 1, 0, 0", r, g, b)
+	}
+}
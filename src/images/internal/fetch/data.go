@@ -0,0 +1,58 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// Data decodes data: URIs, RFC 2397's images written out in the
+// reference itself, like data:image/png;base64,iVBORw0KGgo...
+type Data struct{}
+
+func (Data) Fetch(ctx context.Context, ref string) (image.Image, Metadata, error) {
+	if scheme, _ := Scheme(ref); scheme != "data" {
+		return nil, Metadata{}, errors.New("that isn't a data: URI")
+	}
+	header, payload, ok := strings.Cut(ref[len("data:"):], ",")
+	if !ok {
+		return nil, Metadata{}, errors.New("a data: URI needs a comma before its data")
+	}
+
+	content_type, is_base64 := header, false
+	if strings.HasSuffix(strings.ToLower(header), ";base64") {
+		content_type, is_base64 = header[:len(header)-len(";base64")], true
+	}
+	if content_type == "" {
+		content_type = "text/plain;charset=US-ASCII"
+	}
+	if _, _, err := mime.ParseMediaType(content_type); err != nil {
+		return nil, Metadata{}, errors.New("a data: URI's media type doesn't parse")
+	}
+
+	payload, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, Metadata{}, errors.New("a data: URI's data isn't percent-encoded properly")
+	}
+	var r *strings.Reader
+	if is_base64 {
+		// Padding is often left off, so it's taken off everywhere.
+		raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		if err != nil {
+			return nil, Metadata{}, errors.New("a data: URI's base64 doesn't decode")
+		}
+		r = strings.NewReader(string(raw))
+	} else {
+		r = strings.NewReader(payload)
+	}
+
+	img, format, err := Decode(ctx, r)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return img, metadata(img, format, content_type), nil
+}
@@ -0,0 +1,54 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestData(t *testing.T) {
+	data := png_of(t, 4, 3)
+	b64 := base64.StdEncoding.EncodeToString(data)
+
+	for _, ref := range []string{
+		"data:image/png;base64," + b64,
+		"DATA:image/png;BASE64," + strings.TrimRight(b64, "="),
+		"data:image/png;base64," + url.PathEscape(b64),
+		"data:image/png," + url.PathEscape(string(data)),
+	} {
+		img, meta, err := Data{}.Fetch(context.Background(), ref)
+		if err != nil {
+			t.Errorf("Fetch(%.30q...): %v", ref, err)
+			continue
+		}
+		check(t, img, meta, 4, 3)
+		if meta.ContentType != "image/png" {
+			t.Errorf("ContentType = %q", meta.ContentType)
+		}
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	big := base64.StdEncoding.EncodeToString(png_of(t, 1001, 1000))
+	var too_large *TooLargeError
+	if _, _, err := (Data{}).Fetch(WithMaxPixels(context.Background(), 1), "data:image/png;base64,"+big); !errors.As(err, &too_large) {
+		t.Errorf("an image over the limit gave %v", err)
+	}
+
+	for _, ref := range []string{
+		"data:",
+		"data:image/png;base64",
+		"data:image/png;base64,!!!",
+		"data:image/png,%zz",
+		"data:image/png,not a png",
+		"data:bad type;base64,AAAA",
+		"https://example.com/",
+	} {
+		if _, _, err := (Data{}).Fetch(context.Background(), ref); err == nil {
+			t.Errorf("Fetch(%q) took it", ref)
+		}
+	}
+}
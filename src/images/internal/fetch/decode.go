@@ -0,0 +1,230 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+// Decoding allocates every pixel, however small the render, so a fetch's
+// context carries a limit on the size of image it takes, which sources
+// keep to by decoding with Decode.
+type max_pixels_key struct{}
+
+// WithMaxPixels is ctx with fetches limited to images of at most limit
+// megapixels.
+func WithMaxPixels(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, max_pixels_key{}, limit)
+}
+
+// MaxPixels is the megapixel limit on ctx, or 0 for none.
+func MaxPixels(ctx context.Context) int {
+	limit, _ := ctx.Value(max_pixels_key{}).(int)
+	return limit
+}
+
+// A decoder decodes one format, whatever the data looks like.
+type decoder struct {
+	decode func(io.Reader) (image.Image, error)
+	config func(io.Reader) (image.Config, error)
+}
+
+var decoders = map[string]decoder{
+	"bmp":  {bmp.Decode, bmp.DecodeConfig},
+	"gif":  {gif.Decode, gif.DecodeConfig},
+	"jpeg": {jpeg.Decode, jpeg.DecodeConfig},
+	"png":  {png.Decode, png.DecodeConfig},
+	"tiff": {tiff.Decode, tiff.DecodeConfig},
+	"webp": {webp.Decode, webp.DecodeConfig},
+}
+
+// Formats is the formats WithFormat takes, in order.
+func Formats() []string {
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+type format_key struct{}
+
+// WithFormat is ctx with images decoded as format, one of Formats,
+// rather than whatever their first bytes say they are. "" goes back to
+// looking.
+func WithFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, format_key{}, format)
+}
+
+// Format is the format images are decoded as within ctx, or "" for
+// whatever they look like.
+func Format(ctx context.Context) string {
+	format, _ := ctx.Value(format_key{}).(string)
+	return format
+}
+
+type decode_timeout_key struct{}
+
+// WithDecodeTimeout is ctx with decoding an image, download and all, given
+// up on after d, whatever the fetch's own timeout. A crafted image can keep
+// a decoder busy far longer than it took to download.
+func WithDecodeTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, decode_timeout_key{}, d)
+}
+
+// DecodeTimeout is the decode timeout on ctx, or 0 for none.
+func DecodeTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(decode_timeout_key{}).(time.Duration)
+	return d
+}
+
+// DecodeTimeoutError is returned for an image that took longer than the
+// decode timeout to decode.
+type DecodeTimeoutError struct {
+	After time.Duration
+}
+
+func (e *DecodeTimeoutError) Error() string {
+	return fmt.Sprintf("decode timeout after %s", e.After)
+}
+
+// A ctx_reader reads from r until ctx is done, and then fails, so that a
+// decoder that's been given up on stops at its next read.
+type ctx_reader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctx_reader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// TooLargeError is returned for an image with more pixels than allowed.
+type TooLargeError struct {
+	Width, Height, Limit int
+}
+
+// Size describes the image against the limit, as in "10000×10000 (100 MP,
+// limit 50 MP)".
+func (e *TooLargeError) Size() string {
+	return fmt.Sprintf("%d×%d (%s MP, limit %d MP)", e.Width, e.Height, Megapixels(e.Width, e.Height), e.Limit)
+}
+
+func (e *TooLargeError) Error() string {
+	return "image too large: " + e.Size()
+}
+
+// Megapixels formats width × height in millions, to one decimal place
+// when that's not a whole number.
+func Megapixels(width, height int) string {
+	mp := float64(width) * float64(height) / 1e6
+	return strconv.FormatFloat(math.Round(mp*10)/10, 'f', -1, 64)
+}
+
+// OverLimit reports whether a width × height image has more than limit
+// megapixels.
+func OverLimit(width, height, limit int) bool {
+	return int64(width)*int64(height) > int64(limit)*1_000_000
+}
+
+// Decode decodes an image from r, unless it's over the limit on ctx. The
+// header is read first, so an oversized image is turned away before its
+// pixels are allocated. It returns the format's name, as image.Decode
+// does. The format is the one on ctx, if there is one.
+//
+// The image package takes a read that fails for an unknown format, so
+// when ctx is what ended the read, its error is returned instead.
+//
+// With a decode timeout on ctx, decoding is given up on when it runs out,
+// with a *DecodeTimeoutError; the decoder is left to stop at its next
+// read of r, which the caller had better close rather than read itself.
+func Decode(ctx context.Context, r io.Reader) (image.Image, string, error) {
+	timeout := DecodeTimeout(ctx)
+	if timeout <= 0 {
+		img, format, err := decode(MaxPixels(ctx), Format(ctx), r)
+		if err != nil && ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		return img, format, err
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type decoded struct {
+		img    image.Image
+		format string
+		err    error
+	}
+	done := make(chan decoded, 1)
+	go func() {
+		img, format, err := decode(MaxPixels(ctx), Format(ctx), ctx_reader{dctx, r})
+		done <- decoded{img, format, err}
+	}()
+
+	var d decoded
+	select {
+	case d = <-done:
+	case <-dctx.Done():
+	}
+	switch {
+	case d.err == nil && d.img != nil:
+		return d.img, d.format, nil
+	case ctx.Err() != nil:
+		return nil, "", ctx.Err()
+	case dctx.Err() != nil:
+		return nil, "", &DecodeTimeoutError{timeout}
+	}
+	return nil, "", d.err
+}
+
+func decode(limit int, format string, r io.Reader) (image.Image, string, error) {
+	d, forced := decoders[format]
+	if !forced {
+		d = decoder{
+			decode: func(r io.Reader) (img image.Image, err error) {
+				img, format, err = image.Decode(r)
+				return img, err
+			},
+			config: func(r io.Reader) (cfg image.Config, err error) {
+				cfg, format, err = image.DecodeConfig(r)
+				return cfg, err
+			},
+		}
+	}
+
+	if limit == 0 {
+		img, err := d.decode(r)
+		return img, format, err
+	}
+
+	var head bytes.Buffer
+	cfg, err := d.config(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, "", err
+	}
+	if OverLimit(cfg.Width, cfg.Height, limit) {
+		return nil, "", &TooLargeError{cfg.Width, cfg.Height, limit}
+	}
+
+	// What the header took is read again, followed by the rest.
+	img, err := d.decode(io.MultiReader(&head, r))
+	return img, format, err
+}
@@ -0,0 +1,20 @@
+// Package fetch gets images from wherever a reference to one points: the
+// web, a data: URI, or any other Source registered with a Resolver. It
+// also has what's shared by everything else that downloads images.
+package fetch
+
+import "io"
+
+// DrainLimit is as much of a body as Close reads to get to its end.
+// Reading a longer one to the end would cost more than the new
+// connection that closing it early makes necessary.
+const DrainLimit = 256 << 10
+
+// Close reads what's left of an HTTP response body, up to DrainLimit,
+// and closes it. A body closed before it's been read to the end takes
+// its connection down with it, where one read to the end lets the
+// client use the connection again for the next request.
+func Close(body io.ReadCloser) error {
+	io.Copy(io.Discard, io.LimitReader(body, DrainLimit))
+	return body.Close()
+}
@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serve starts a server answering every request with body, counting the
+// requests and the connections they come in on. The last byte of the
+// body comes a little after the rest, as from a slow server: newer
+// clients read a little of a body closed early themselves, but not for
+// as long as that.
+func serve(t *testing.T, body string) (srv *httptest.Server, requests, conns *atomic.Int32) {
+	requests, conns = new(atomic.Int32), new(atomic.Int32)
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(body[:len(body)-1]))
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(body[len(body)-1:]))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, requests, conns
+}
+
+func TestCloseReusesConnection(t *testing.T) {
+	srv, requests, conns := serve(t, strings.Repeat("x", 64<<10))
+
+	const n = 3
+	for range n {
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the start is read, as a decoder that gives up would.
+		resp.Body.Read(make([]byte, 10))
+		if err := Close(resp.Body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := requests.Load(); got != n {
+		t.Errorf("the handler was called %d times, want %d", got, n)
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("%d requests took %d connections, want them all on 1", n, got)
+	}
+}
+
+func TestCloseGivesUpOnLongBodies(t *testing.T) {
+	srv, _, conns := serve(t, strings.Repeat("x", 4*DrainLimit))
+
+	for range 2 {
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Close(resp.Body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each long body is cut off, taking its connection with it.
+	if got := conns.Load(); got != 2 {
+		t.Errorf("2 requests took %d connections, want 2", got)
+	}
+}
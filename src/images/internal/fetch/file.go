@@ -0,0 +1,74 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"image"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// File fetches file: references, file:cats/tabby.png or
+// file:///cats/tabby.png, from under Root and nowhere else. A symbolic
+// link out of Root is refused like a path out of it.
+type File struct {
+	Root string
+}
+
+var ErrOutsideRoot = errors.New("that file is outside the directory images are served from")
+
+func (f File) Fetch(ctx context.Context, ref string) (image.Image, Metadata, error) {
+	if f.Root == "" {
+		return nil, Metadata{}, errors.New("file: references are turned off")
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	name := u.Path
+	if u.Opaque != "" {
+		name, err = url.PathUnescape(u.Opaque)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	p, err := f.resolve(name)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer file.Close()
+
+	img, format, err := Decode(ctx, file)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return img, metadata(img, format, mime.TypeByExtension(filepath.Ext(p))), nil
+}
+
+// resolve is where under Root name is, with any links followed.
+func (f File) resolve(name string) (string, error) {
+	root, err := filepath.EvalSymlinks(f.Root)
+	if err != nil {
+		return "", err
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	return p, nil
+}
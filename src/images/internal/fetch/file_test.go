@@ -0,0 +1,62 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "cats"), 0o755)
+	os.WriteFile(filepath.Join(root, "cats", "tabby.png"), png_of(t, 5, 4), 0o644)
+	f := File{Root: root}
+
+	for _, ref := range []string{
+		"file:cats/tabby.png",
+		"file:///cats/tabby.png",
+		"file:/cats/../cats/tabby.png",
+		"file:cats%2Ftabby.png",
+	} {
+		img, meta, err := f.Fetch(context.Background(), ref)
+		if err != nil {
+			t.Errorf("Fetch(%q): %v", ref, err)
+			continue
+		}
+		check(t, img, meta, 5, 4)
+		if meta.ContentType != "image/png" {
+			t.Errorf("ContentType = %q", meta.ContentType)
+		}
+	}
+
+	if _, _, err := f.Fetch(context.Background(), "file:cats/siamese.png"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a missing file gave %v", err)
+	}
+	if _, _, err := (File{}).Fetch(context.Background(), "file:cats/tabby.png"); err == nil {
+		t.Error("a File with no root served a file")
+	}
+}
+
+func TestFileStaysInRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0o755)
+	os.WriteFile(filepath.Join(dir, "secret.png"), png_of(t, 1, 1), 0o644)
+	if err := os.Symlink(filepath.Join(dir, "secret.png"), filepath.Join(root, "link.png")); err != nil {
+		t.Skip(err)
+	}
+	f := File{Root: root}
+
+	// A path climbing out is taken as one from the root, where there's no
+	// such file.
+	for _, ref := range []string{"file:../secret.png", "file:///../../secret.png", "file:%2e%2e/secret.png"} {
+		if _, _, err := f.Fetch(context.Background(), ref); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Fetch(%q) gave %v, want it not found", ref, err)
+		}
+	}
+	if _, _, err := f.Fetch(context.Background(), "file:link.png"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("a link out of the root gave %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"time"
+)
+
+// HTTP fetches http: and https: references. Whatever policy its client's
+// transport keeps, on hosts or on types, holds for every fetch.
+type HTTP struct {
+	// Client is what requests go through, http.DefaultClient if nil.
+	Client *http.Client
+	// Timeout, if set, is the longest a fetch may take, download and
+	// all.
+	Timeout time.Duration
+}
+
+// ErrNotModified is what a fetch made with IfChanged gives when the
+// image is still the one it was.
+var ErrNotModified = errors.New("not modified since it was last fetched")
+
+type if_changed_key struct{}
+
+// IfChanged is ctx with HTTP fetches asking the server for the image only
+// if it's changed since the one meta describes. If it hasn't, the fetch
+// fails with ErrNotModified, having downloaded nothing. Metadata without
+// validators asks unconditionally.
+func IfChanged(ctx context.Context, meta Metadata) context.Context {
+	return context.WithValue(ctx, if_changed_key{}, meta)
+}
+
+func (h HTTP) Fetch(ctx context.Context, ref string) (image.Image, Metadata, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	if since, ok := ctx.Value(if_changed_key{}).(Metadata); ok {
+		if since.ETag != "" {
+			req.Header.Set("If-None-Match", since.ETag)
+		}
+		if since.LastModified != "" {
+			req.Header.Set("If-Modified-Since", since.LastModified)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// A decoder that timed out may still be reading the body, so it's
+	// closed, not drained alongside it.
+	drain := true
+	defer func() {
+		if drain {
+			Close(resp.Body)
+		} else {
+			resp.Body.Close()
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, Metadata{}, ErrNotModified
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, Metadata{}, fmt.Errorf("the server said %s", resp.Status)
+	}
+
+	img, format, err := Decode(ctx, resp.Body)
+	var slow *DecodeTimeoutError
+	drain = !errors.As(err, &slow) && ctx.Err() == nil
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	meta := metadata(img, format, resp.Header.Get("Content-Type"))
+	meta.ETag, meta.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return img, meta, nil
+}
@@ -0,0 +1,117 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	data := png_of(t, 3, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/a.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	defer srv.Close()
+	h := HTTP{Client: srv.Client()}
+
+	img, meta, err := h.Fetch(context.Background(), srv.URL+"/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, img, meta, 3, 2)
+	if meta.ContentType != "image/png" {
+		t.Errorf("ContentType = %q", meta.ContentType)
+	}
+
+	if _, _, err := h.Fetch(context.Background(), srv.URL+"/missing.png"); err == nil {
+		t.Error("a 404 fetched")
+	}
+	if _, _, err := h.Fetch(WithMaxPixels(context.Background(), 1), srv.URL+"/a.png"); err != nil {
+		t.Errorf("a small image under a limit: %v", err)
+	}
+}
+
+// hang starts a server that sends headers and then nothing until the
+// test is over.
+func hang(t *testing.T) *httptest.Server {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.(http.Flusher).Flush()
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() { close(done); srv.Close() })
+	return srv
+}
+
+func TestHTTPCancel(t *testing.T) {
+	srv := hang(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := HTTP{Client: srv.Client()}.Fetch(ctx, srv.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled fetch gave %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("a cancelled fetch took %v to give up", d)
+	}
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	srv := hang(t)
+
+	_, _, err := HTTP{Client: srv.Client(), Timeout: 50 * time.Millisecond}.Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a fetch past its timeout gave %v", err)
+	}
+}
+
+func TestHTTPIfChanged(t *testing.T) {
+	data := png_of(t, 3, 2)
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	defer srv.Close()
+	h := HTTP{Client: srv.Client()}
+
+	_, meta, err := h.Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ETag != etag || meta.LastModified == "" {
+		t.Errorf("validators = %q, %q", meta.ETag, meta.LastModified)
+	}
+
+	if _, _, err := h.Fetch(IfChanged(context.Background(), meta), srv.URL); err != ErrNotModified {
+		t.Errorf("an unchanged image gave %v", err)
+	}
+
+	etag = `"v2"`
+	if img, _, err := h.Fetch(IfChanged(context.Background(), meta), srv.URL); err != nil {
+		t.Errorf("a changed image gave %v", err)
+	} else {
+		check(t, img, meta, 3, 2)
+	}
+}
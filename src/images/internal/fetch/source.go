@@ -0,0 +1,102 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+)
+
+// Metadata is what a source found out about an image besides its pixels.
+type Metadata struct {
+	// Format is the decoder's name for it, like "png".
+	Format string
+	// ContentType is the media type the source gave it, if any.
+	ContentType   string
+	Width, Height int
+	// ETag and LastModified are the validators a web server gave it, if
+	// any, for asking again only if it's changed: see IfChanged.
+	ETag, LastModified string
+}
+
+// A Source fetches and decodes the images that references to it name. It
+// should give up when ctx is done, and keep to the limit on it with
+// Decode.
+type Source interface {
+	Fetch(ctx context.Context, ref string) (image.Image, Metadata, error)
+}
+
+// A Resolver is a Source that hands each reference to the source
+// registered for its scheme, the part before the first colon, as in
+// "https:" or "data:". It's safe for concurrent use.
+type Resolver struct {
+	mu      sync.RWMutex
+	sources map[string]Source
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{sources: map[string]Source{}}
+}
+
+// Default is the resolver the server fetches through.
+var Default = NewResolver()
+
+// Register has Default send references with the given scheme to s.
+func Register(scheme string, s Source) {
+	Default.Register(scheme, s)
+}
+
+// Register sends references with the given scheme to s, in place of any
+// source registered for it before. Schemes are case-insensitive.
+func (r *Resolver) Register(scheme string, s Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[strings.ToLower(scheme)] = s
+}
+
+// Resolve picks the source for ref.
+func (r *Resolver) Resolve(ref string) (Source, error) {
+	scheme, ok := Scheme(ref)
+	if !ok {
+		return nil, fmt.Errorf("%q has no scheme, like https:", ref)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s := r.sources[scheme]
+	if s == nil {
+		return nil, fmt.Errorf("there's no source for %s: references", scheme)
+	}
+	return s, nil
+}
+
+func (r *Resolver) Fetch(ctx context.Context, ref string) (image.Image, Metadata, error) {
+	s, err := r.Resolve(ref)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return s.Fetch(ctx, ref)
+}
+
+// Scheme is ref's scheme in lower case, as RFC 3986 spells them: a
+// letter, then letters, digits, '+', '-' or '.'.
+func Scheme(ref string) (string, bool) {
+	i := strings.IndexByte(ref, ':')
+	if i < 1 {
+		return "", false
+	}
+	for j, c := range ref[:i] {
+		letter := 'a' <= c|0x20 && c|0x20 <= 'z'
+		if !letter && (j == 0 || !('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return "", false
+		}
+	}
+	return strings.ToLower(ref[:i]), true
+}
+
+// metadata fills in what the decoded image says about itself.
+func metadata(img image.Image, format, content_type string) Metadata {
+	b := img.Bounds()
+	return Metadata{Format: format, ContentType: content_type, Width: b.Dx(), Height: b.Dy()}
+}
@@ -0,0 +1,171 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+	"time"
+)
+
+// png_of is a w×h PNG, all one gray.
+func png_of(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// check fails unless img is a w×h image of the gray png_of draws.
+func check(t *testing.T, img image.Image, meta Metadata, w, h int) {
+	t.Helper()
+	if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+		t.Fatalf("got a %v image, want %d×%d", b, w, h)
+	}
+	if got := color.GrayModel.Convert(img.At(0, 0)); got != (color.Gray{0x80}) {
+		t.Errorf("pixel is %v, want gray 0x80", got)
+	}
+	if meta.Format != "png" || meta.Width != w || meta.Height != h {
+		t.Errorf("metadata %+v, want a %d×%d png", meta, w, h)
+	}
+}
+
+type fake_source string
+
+func (f fake_source) Fetch(_ context.Context, ref string) (image.Image, Metadata, error) {
+	return nil, Metadata{Format: string(f)}, nil
+}
+
+func TestResolver(t *testing.T) {
+	r := NewResolver()
+	r.Register("s3", fake_source("s3"))
+	r.Register("HTTPS", fake_source("web"))
+
+	for ref, want := range map[string]string{
+		"s3://bucket/key.png":       "s3",
+		"S3://bucket/key.png":       "s3",
+		"https://example.com/a.png": "web",
+	} {
+		_, meta, err := r.Fetch(context.Background(), ref)
+		if err != nil || meta.Format != want {
+			t.Errorf("Fetch(%q) went to %q (%v), want %q", ref, meta.Format, err, want)
+		}
+	}
+
+	for _, ref := range []string{"http://example.com/a.png", "example.com/a.png", "", ":x", "1x:y", "a b:c"} {
+		if _, err := r.Resolve(ref); err == nil {
+			t.Errorf("Resolve(%q) found a source", ref)
+		}
+	}
+
+	// A later registration takes over the scheme.
+	r.Register("s3", fake_source("minio"))
+	if _, meta, _ := r.Fetch(context.Background(), "s3://b/k"); meta.Format != "minio" {
+		t.Errorf("re-registered s3 went to %q", meta.Format)
+	}
+}
+
+func TestScheme(t *testing.T) {
+	for ref, want := range map[string]string{
+		"https://x":       "https",
+		"Data:image/png,": "data",
+		"svn+ssh://x":     "svn+ssh",
+		"x-y.z:w":         "x-y.z",
+		"c:\\windows":     "c",
+		"/a:b":            "",
+		"1x:y":            "",
+		"nocolon":         "",
+	} {
+		got, ok := Scheme(ref)
+		if got != want || ok != (want != "") {
+			t.Errorf("Scheme(%q) = %q, %v; want %q", ref, got, ok, want)
+		}
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	data := png_of(t, 2000, 1000)
+
+	img, format, err := Decode(WithMaxPixels(context.Background(), 2), bytes.NewReader(data))
+	if err != nil || format != "png" || img.Bounds().Dx() != 2000 {
+		t.Fatalf("an image at the limit: %v, %q, %v", img, format, err)
+	}
+
+	_, _, err = Decode(WithMaxPixels(context.Background(), 1), bytes.NewReader(data))
+	var big *TooLargeError
+	if !errors.As(err, &big) || *big != (TooLargeError{2000, 1000, 1}) {
+		t.Fatalf("an image over the limit gave %v", err)
+	}
+	if got, want := big.Size(), "2000×1000 (2 MP, limit 1 MP)"; got != want {
+		t.Errorf("Size() = %q, want %q", got, want)
+	}
+
+	if _, _, err := Decode(context.Background(), bytes.NewReader(data)); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+}
+
+func TestDecodeFormat(t *testing.T) {
+	data := png_of(t, 4, 3)
+
+	for _, limit := range []int{0, 1} {
+		ctx := WithMaxPixels(context.Background(), limit)
+		img, format, err := Decode(WithFormat(ctx, "png"), bytes.NewReader(data))
+		if err != nil || format != "png" || img.Bounds().Dx() != 4 {
+			t.Errorf("a png decoded as png: %v, %q, %v", img, format, err)
+		}
+		if _, _, err := Decode(WithFormat(ctx, "jpeg"), bytes.NewReader(data)); err == nil {
+			t.Errorf("a png decoded as jpeg")
+		}
+		if _, format, err := Decode(WithFormat(ctx, ""), bytes.NewReader(data)); err != nil || format != "png" {
+			t.Errorf("a png sniffed: %q, %v", format, err)
+		}
+	}
+
+	if got := Formats(); len(got) != 6 || got[0] != "bmp" || got[5] != "webp" {
+		t.Errorf("Formats() = %v", got)
+	}
+}
+
+func TestDecodeTimeout(t *testing.T) {
+	ctx := WithDecodeTimeout(context.Background(), 50*time.Millisecond)
+	if _, format, err := Decode(ctx, bytes.NewReader(png_of(t, 4, 3))); err != nil || format != "png" {
+		t.Fatalf("a quick decode: %q, %v", format, err)
+	}
+
+	// A body that never comes.
+	r, w := io.Pipe()
+	defer w.Close()
+	_, _, err := Decode(ctx, r)
+	var slow *DecodeTimeoutError
+	if !errors.As(err, &slow) || slow.After != 50*time.Millisecond {
+		t.Fatalf("a stalled decode gave %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := Decode(cancelled, bytes.NewReader(png_of(t, 4, 3))); err != context.Canceled {
+		t.Errorf("a cancelled decode gave %v", err)
+	}
+}
+
+func TestMegapixels(t *testing.T) {
+	for _, tt := range []struct {
+		w, h int
+		want string
+	}{{1000, 1000, "1"}, {1920, 1080, "2.1"}, {10, 10, "0"}, {10000, 10000, "100"}} {
+		if got := Megapixels(tt.w, tt.h); got != tt.want {
+			t.Errorf("Megapixels(%d, %d) = %q, want %q", tt.w, tt.h, got, tt.want)
+		}
+	}
+}
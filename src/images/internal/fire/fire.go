@@ -0,0 +1,38 @@
+// Package fire is the old demo scene fire: heat fed in along the bottom
+// row rises, drifting sideways and cooling as it goes. Coloring it is left
+// to the caller.
+package fire
+
+import "math/rand"
+
+// New is a grid of h rows of w cells, all cold.
+func New(w, h int) [][]float64 {
+	grid := make([][]float64, h)
+	for y := range grid {
+		grid[y] = make([]float64, w)
+	}
+	return grid
+}
+
+// Step moves grid on a frame. The bottom row is fed fresh heat, from 0.75
+// to 1, and every cell above takes the heat of one of the three below it,
+// less a random amount. It cools by half of 3/h a row on average, so
+// flames die out about two thirds of the way up. Heat stays from 0 to 1.
+func Step(grid [][]float64, rng *rand.Rand) {
+	h := len(grid)
+	if h == 0 {
+		return
+	}
+	w := len(grid[0])
+	cooling := 3 / float64(h)
+
+	for x := range w {
+		grid[h-1][x] = 0.75 + 0.25*rng.Float64()
+	}
+	for y := range h - 1 {
+		for x := range w {
+			from := min(max(x+rng.Intn(3)-1, 0), w-1)
+			grid[y][x] = max(grid[y+1][from]-cooling*rng.Float64(), 0)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package fire
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func mean(row []float64) float64 {
+	sum := 0.0
+	for _, v := range row {
+		sum += v
+	}
+	return sum / float64(len(row))
+}
+
+func TestStep(t *testing.T) {
+	grid := New(40, 30)
+	rng := rand.New(rand.NewSource(1))
+	for range 100 {
+		Step(grid, rng)
+	}
+
+	for y, row := range grid {
+		for x, v := range row {
+			if v < 0 || v > 1 {
+				t.Fatalf("heat at %d,%d is %v", x, y, v)
+			}
+		}
+	}
+	if bottom := mean(grid[len(grid)-1]); bottom < 0.75 {
+		t.Errorf("the bottom row averages %v, want it fed", bottom)
+	}
+	if top := mean(grid[0]); top != 0 {
+		t.Errorf("the top row averages %v, want flames to die out first", top)
+	}
+	for y := 1; y < len(grid); y++ {
+		if mean(grid[y-1]) > mean(grid[y])+0.05 {
+			t.Errorf("row %d is hotter than the one below", y-1)
+		}
+	}
+}
+
+func TestStepRepeats(t *testing.T) {
+	a, b := New(10, 10), New(10, 10)
+	ra, rb := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+	for range 20 {
+		Step(a, ra)
+		Step(b, rb)
+	}
+	for y := range a {
+		for x := range a[y] {
+			if a[y][x] != b[y][x] {
+				t.Fatalf("the same seed gave different fires at %d,%d", x, y)
+			}
+		}
+	}
+}
+
+func TestStepEmpty(t *testing.T) {
+	Step(nil, rand.New(rand.NewSource(1)))
+	Step(New(0, 3), rand.New(rand.NewSource(1)))
+}
@@ -0,0 +1,215 @@
+// Package font draws text with a pair of small built-in bitmap fonts.
+package font
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A Font is a fixed-width bitmap font. Each glyph is Height rows of
+// bits, the leftmost column in the highest of the Width bits. Glyphs are
+// set a column apart.
+type Font struct {
+	Width, Height int
+
+	// chars lists the glyphs in rows, Height bytes to a glyph.
+	chars string
+	rows  []byte
+}
+
+// Big is 5×7, Small 3×5. Both only have capitals, so lower case is drawn
+// as upper case; anything else they don't have comes out as '?'.
+var (
+	Big   = &Font{Width: 5, Height: 7, chars: glyph_chars, rows: big_rows[:]}
+	Small = &Font{Width: 3, Height: 5, chars: glyph_chars, rows: small_rows[:]}
+)
+
+// Fonts are the fonts by name.
+var Fonts = map[string]*Font{"big": Big, "small": Small}
+
+const glyph_chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 !?.,:-'\"/+=()#*&_"
+
+var big_rows = [...]byte{
+	0x0E, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11, // A
+	0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E, // B
+	0x0E, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0E, // C
+	0x1C, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1C, // D
+	0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x1F, // E
+	0x1F, 0x10, 0x10, 0x1E, 0x10, 0x10, 0x10, // F
+	0x0E, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0F, // G
+	0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11, // H
+	0x0E, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0E, // I
+	0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0C, // J
+	0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11, // K
+	0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1F, // L
+	0x11, 0x1B, 0x15, 0x15, 0x11, 0x11, 0x11, // M
+	0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11, // N
+	0x0E, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E, // O
+	0x1E, 0x11, 0x11, 0x1E, 0x10, 0x10, 0x10, // P
+	0x0E, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0D, // Q
+	0x1E, 0x11, 0x11, 0x1E, 0x14, 0x12, 0x11, // R
+	0x0F, 0x10, 0x10, 0x0E, 0x01, 0x01, 0x1E, // S
+	0x1F, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, // T
+	0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0E, // U
+	0x11, 0x11, 0x11, 0x11, 0x11, 0x0A, 0x04, // V
+	0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0A, // W
+	0x11, 0x11, 0x0A, 0x04, 0x0A, 0x11, 0x11, // X
+	0x11, 0x11, 0x0A, 0x04, 0x04, 0x04, 0x04, // Y
+	0x1F, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1F, // Z
+	0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E, // 0
+	0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E, // 1
+	0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F, // 2
+	0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E, // 3
+	0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02, // 4
+	0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E, // 5
+	0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E, // 6
+	0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08, // 7
+	0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E, // 8
+	0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C, // 9
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // space
+	0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04, // !
+	0x0E, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04, // ?
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C, // .
+	0x00, 0x00, 0x00, 0x00, 0x0C, 0x04, 0x08, // ,
+	0x00, 0x0C, 0x0C, 0x00, 0x0C, 0x0C, 0x00, // :
+	0x00, 0x00, 0x00, 0x1F, 0x00, 0x00, 0x00, // -
+	0x04, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00, // '
+	0x0A, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x00, // "
+	0x01, 0x01, 0x02, 0x04, 0x08, 0x10, 0x10, // /
+	0x00, 0x04, 0x04, 0x1F, 0x04, 0x04, 0x00, // +
+	0x00, 0x00, 0x1F, 0x00, 0x1F, 0x00, 0x00, // =
+	0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02, // (
+	0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08, // )
+	0x0A, 0x0A, 0x1F, 0x0A, 0x1F, 0x0A, 0x0A, // #
+	0x00, 0x04, 0x15, 0x0E, 0x15, 0x04, 0x00, // *
+	0x0C, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0D, // &
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1F, // _
+}
+
+var small_rows = [...]byte{
+	2, 5, 7, 5, 5, // A
+	6, 5, 6, 5, 6, // B
+	3, 4, 4, 4, 3, // C
+	6, 5, 5, 5, 6, // D
+	7, 4, 6, 4, 7, // E
+	7, 4, 6, 4, 4, // F
+	3, 4, 5, 5, 3, // G
+	5, 5, 7, 5, 5, // H
+	7, 2, 2, 2, 7, // I
+	1, 1, 1, 5, 2, // J
+	5, 5, 6, 5, 5, // K
+	4, 4, 4, 4, 7, // L
+	5, 7, 7, 5, 5, // M
+	6, 5, 5, 5, 5, // N
+	2, 5, 5, 5, 2, // O
+	6, 5, 6, 4, 4, // P
+	2, 5, 5, 6, 3, // Q
+	6, 5, 6, 5, 5, // R
+	3, 4, 2, 1, 6, // S
+	7, 2, 2, 2, 2, // T
+	5, 5, 5, 5, 7, // U
+	5, 5, 5, 5, 2, // V
+	5, 5, 7, 7, 5, // W
+	5, 5, 2, 5, 5, // X
+	5, 5, 2, 2, 2, // Y
+	7, 1, 2, 4, 7, // Z
+	7, 5, 5, 5, 7, // 0
+	2, 6, 2, 2, 7, // 1
+	6, 1, 2, 4, 7, // 2
+	6, 1, 2, 1, 6, // 3
+	5, 5, 7, 1, 1, // 4
+	7, 4, 6, 1, 6, // 5
+	3, 4, 7, 5, 7, // 6
+	7, 1, 2, 2, 2, // 7
+	7, 5, 7, 5, 7, // 8
+	7, 5, 7, 1, 6, // 9
+	0, 0, 0, 0, 0, // space
+	2, 2, 2, 0, 2, // !
+	6, 1, 2, 0, 2, // ?
+	0, 0, 0, 0, 2, // .
+	0, 0, 0, 2, 4, // ,
+	0, 2, 0, 2, 0, // :
+	0, 0, 7, 0, 0, // -
+	2, 2, 0, 0, 0, // '
+	5, 5, 0, 0, 0, // "
+	1, 1, 2, 4, 4, // /
+	0, 2, 7, 2, 0, // +
+	0, 7, 0, 7, 0, // =
+	1, 2, 2, 2, 1, // (
+	4, 2, 2, 2, 4, // )
+	5, 7, 5, 7, 5, // #
+	0, 5, 2, 5, 0, // *
+	2, 5, 2, 5, 3, // &
+	0, 0, 0, 0, 7, // _
+}
+
+// glyph returns the rows of r's glyph.
+func (f *Font) glyph(r rune) []byte {
+	i := strings.IndexRune(f.chars, unicode.ToUpper(r))
+	if i < 0 {
+		i = strings.IndexByte(f.chars, '?')
+	}
+	return f.rows[i*f.Height : (i+1)*f.Height]
+}
+
+// Columns is how wide text comes out.
+func (f *Font) Columns(text string) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return n*(f.Width+1) - 1
+}
+
+// Render draws one line of text as Height rows of pixels, set where the
+// text is.
+func (f *Font) Render(text string) [][]bool {
+	out := make([][]bool, f.Height)
+	for y := range out {
+		out[y] = make([]bool, f.Columns(text))
+	}
+
+	for i, r := range []rune(text) {
+		for y, bits := range f.glyph(r) {
+			for x := range f.Width {
+				out[y][i*(f.Width+1)+x] = bits&(1<<(f.Width-1-x)) != 0
+			}
+		}
+	}
+	return out
+}
+
+// Wrap breaks text into lines that each fit in cols columns when drawn.
+// Lines break between words where they can; a word too long for a line
+// of its own is broken wherever it has to be.
+func (f *Font) Wrap(text string, cols int) []string {
+	fit := max((cols+1)/(f.Width+1), 1)
+
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > fit {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			w := []rune(word)
+			lines = append(lines, string(w[:fit]))
+			word = string(w[fit:])
+		}
+
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= fit:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,84 @@
+package font
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGlyphData(t *testing.T) {
+	for name, f := range Fonts {
+		if len(f.rows) != len(f.chars)*f.Height {
+			t.Errorf("%s: %d rows for %d glyphs of %d", name, len(f.rows), len(f.chars), f.Height)
+		}
+		for i, bits := range f.rows {
+			if bits >= 1<<f.Width {
+				t.Errorf("%s: %q row %d is wider than %d", name, f.chars[i/f.Height], i%f.Height, f.Width)
+			}
+		}
+	}
+}
+
+func picture(rows [][]bool) string {
+	var b strings.Builder
+	for _, row := range rows {
+		for _, on := range row {
+			if on {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestRender(t *testing.T) {
+	want := "" +
+		"#.#.###\n" +
+		"#.#..#.\n" +
+		"###..#.\n" +
+		"#.#..#.\n" +
+		"#.#.###\n"
+	if got := picture(Small.Render("hi")); got != want {
+		t.Errorf("Small.Render(%q) =\n%s\nwant\n%s", "hi", got, want)
+	}
+
+	// What isn't in the font is drawn as a question mark.
+	if got, want := picture(Big.Render("~")), picture(Big.Render("?")); got != want {
+		t.Errorf("Big.Render(%q) =\n%s\nwant\n%s", "~", got, want)
+	}
+
+	if got := Big.Columns("abc"); got != 17 {
+		t.Errorf("Big.Columns(%q) = %d, want 17", "abc", got)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text string
+		cols int
+		want []string
+	}{
+		// Eleven columns fit three small glyphs, so both words are broken.
+		{"hello world", 11, []string{"hel", "lo", "wor", "ld"}},
+		{"hi there you", 23, []string{"hi there", "you"}},
+		{"  spaced   out ", 100, []string{"spaced out"}},
+		{"", 40, nil},
+		{"a b", 1, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		got := Small.Wrap(tt.text, tt.cols)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Small.Wrap(%q, %d) = %q, want %q", tt.text, tt.cols, got, tt.want)
+		}
+	}
+
+	for _, line := range Big.Wrap("the quick brown fox jumps over the lazy dog", 40) {
+		if Big.Columns(line) > 40 {
+			t.Errorf("Big.Wrap gave %q, %d columns wide", line, Big.Columns(line))
+		}
+	}
+}
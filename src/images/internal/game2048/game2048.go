@@ -0,0 +1,178 @@
+// Package game2048 implements the rules of 2048 independently of how the
+// board is drawn or where the moves come from.
+package game2048
+
+import "math/rand"
+
+const (
+	Size = 4
+	Goal = 2048
+)
+
+type Direction int
+
+const (
+	Up Direction = iota
+	Down
+	Left
+	Right
+)
+
+type Board [Size][Size]int
+
+type Game struct {
+	Board Board
+	Score int
+
+	// Won is set once a tile reaches Goal; play may continue afterwards.
+	Won bool
+
+	rng *rand.Rand
+}
+
+// New returns a game with the two starting tiles already placed.
+func New(rng *rand.Rand) *Game {
+	g := &Game{rng: rng}
+	g.spawn()
+	g.spawn()
+	return g
+}
+
+// SlideRow slides a row towards index 0, merging equal neighbours. A tile
+// produced by a merge is never merged again in the same slide, so
+// [2 2 2 2] becomes [4 4 0 0] rather than [8 0 0 0]. The returned score
+// is the sum of the merged tiles.
+func SlideRow(row [Size]int) ([Size]int, int) {
+	var out [Size]int
+	score := 0
+	n := 0
+	merged := false
+
+	for _, v := range row {
+		if v == 0 {
+			continue
+		}
+
+		if n > 0 && !merged && out[n-1] == v {
+			out[n-1] *= 2
+			score += out[n-1]
+			merged = true
+			continue
+		}
+
+		out[n] = v
+		n++
+		merged = false
+	}
+
+	return out, score
+}
+
+// line returns the board coordinates of line i, ordered so that index 0 is
+// the edge the tiles move towards.
+func line(d Direction, i int) [Size][2]int {
+	var cells [Size][2]int
+	for j := range Size {
+		switch d {
+		case Left:
+			cells[j] = [2]int{i, j}
+		case Right:
+			cells[j] = [2]int{i, Size - 1 - j}
+		case Up:
+			cells[j] = [2]int{j, i}
+		case Down:
+			cells[j] = [2]int{Size - 1 - j, i}
+		}
+	}
+	return cells
+}
+
+// Slide applies a move to the board and reports the points gained and
+// whether any tile moved.
+func (b *Board) Slide(d Direction) (int, bool) {
+	score := 0
+	moved := false
+
+	for i := range Size {
+		cells := line(d, i)
+
+		var row [Size]int
+		for j, c := range cells {
+			row[j] = b[c[0]][c[1]]
+		}
+
+		slid, s := SlideRow(row)
+		score += s
+		if slid != row {
+			moved = true
+		}
+
+		for j, c := range cells {
+			b[c[0]][c[1]] = slid[j]
+		}
+	}
+
+	return score, moved
+}
+
+// Max returns the largest tile on the board.
+func (b *Board) Max() int {
+	m := 0
+	for _, row := range b {
+		for _, v := range row {
+			m = max(m, v)
+		}
+	}
+	return m
+}
+
+// Move plays a move. A move that changes nothing is ignored and does not
+// spawn a tile; Move reports whether the board changed.
+func (g *Game) Move(d Direction) bool {
+	score, moved := g.Board.Slide(d)
+	if !moved {
+		return false
+	}
+
+	g.Score += score
+	if g.Board.Max() >= Goal {
+		g.Won = true
+	}
+
+	g.spawn()
+	return true
+}
+
+// CanMove reports whether any move would change the board.
+func (g *Game) CanMove() bool {
+	for _, d := range []Direction{Up, Down, Left, Right} {
+		b := g.Board
+		if _, moved := b.Slide(d); moved {
+			return true
+		}
+	}
+	return false
+}
+
+// spawn places a 2 (or, one time in ten, a 4) on a random empty cell.
+func (g *Game) spawn() {
+	var empty [][2]int
+	for r, row := range g.Board {
+		for c, v := range row {
+			if v == 0 {
+				empty = append(empty, [2]int{r, c})
+			}
+		}
+	}
+
+	if len(empty) == 0 {
+		return
+	}
+
+	cell := empty[g.rng.Intn(len(empty))]
+	v := 2
+	if g.rng.Intn(10) == 0 {
+		v = 4
+	}
+	g.Board[cell[0]][cell[1]] = v
+}
@@ -0,0 +1,113 @@
+package game2048
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSlideRow(t *testing.T) {
+	tests := []struct {
+		in    [Size]int
+		out   [Size]int
+		score int
+	}{
+		{[Size]int{0, 0, 0, 0}, [Size]int{0, 0, 0, 0}, 0},
+		{[Size]int{0, 0, 0, 2}, [Size]int{2, 0, 0, 0}, 0},
+		{[Size]int{2, 0, 2, 0}, [Size]int{4, 0, 0, 0}, 4},
+		{[Size]int{2, 2, 2, 2}, [Size]int{4, 4, 0, 0}, 8},
+		{[Size]int{2, 2, 2, 0}, [Size]int{4, 2, 0, 0}, 4},
+		{[Size]int{2, 2, 4, 0}, [Size]int{4, 4, 0, 0}, 4},
+		{[Size]int{4, 2, 2, 0}, [Size]int{4, 4, 0, 0}, 4},
+		{[Size]int{4, 4, 8, 8}, [Size]int{8, 16, 0, 0}, 24},
+		{[Size]int{8, 0, 0, 8}, [Size]int{16, 0, 0, 0}, 16},
+		{[Size]int{2, 4, 2, 4}, [Size]int{2, 4, 2, 4}, 0},
+		{[Size]int{2, 0, 0, 4}, [Size]int{2, 4, 0, 0}, 0},
+		{[Size]int{1024, 1024, 0, 0}, [Size]int{2048, 0, 0, 0}, 2048},
+	}
+
+	for _, tt := range tests {
+		out, score := SlideRow(tt.in)
+		if out != tt.out || score != tt.score {
+			t.Errorf("SlideRow(%v) = %v, %d; want %v, %d", tt.in, out, score, tt.out, tt.score)
+		}
+	}
+}
+
+func TestSlideDirections(t *testing.T) {
+	start := Board{
+		{2, 0, 0, 2},
+		{0, 4, 0, 4},
+		{0, 0, 0, 0},
+		{2, 0, 0, 0},
+	}
+
+	tests := []struct {
+		d    Direction
+		want Board
+	}{
+		{Left, Board{{4, 0, 0, 0}, {8, 0, 0, 0}, {0, 0, 0, 0}, {2, 0, 0, 0}}},
+		{Right, Board{{0, 0, 0, 4}, {0, 0, 0, 8}, {0, 0, 0, 0}, {0, 0, 0, 2}}},
+		{Up, Board{{4, 4, 0, 2}, {0, 0, 0, 4}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+		{Down, Board{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 2}, {4, 4, 0, 4}}},
+	}
+
+	for _, tt := range tests {
+		b := start
+		b.Slide(tt.d)
+		if b != tt.want {
+			t.Errorf("Slide(%v) = %v; want %v", tt.d, b, tt.want)
+		}
+	}
+}
+
+func TestNoopMoveDoesNotSpawn(t *testing.T) {
+	g := &Game{rng: rand.New(rand.NewSource(1))}
+	g.Board = Board{{2, 4, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}
+
+	if g.Move(Left) {
+		t.Fatal("Move(Left) reported a change on a left-packed board")
+	}
+	if g.Board != (Board{{2, 4, 0, 0}}) {
+		t.Errorf("no-op move changed the board: %v", g.Board)
+	}
+
+	if !g.Move(Right) {
+		t.Fatal("Move(Right) reported no change")
+	}
+
+	tiles := 0
+	for _, row := range g.Board {
+		for _, v := range row {
+			if v != 0 {
+				tiles++
+			}
+		}
+	}
+	if tiles != 3 {
+		t.Errorf("expected one spawned tile after a real move, board is %v", g.Board)
+	}
+}
+
+func TestWinAndGameOver(t *testing.T) {
+	g := &Game{rng: rand.New(rand.NewSource(1))}
+	g.Board = Board{{1024, 1024, 0, 0}}
+	g.Move(Left)
+	if !g.Won || g.Score != 2048 {
+		t.Errorf("after merging to 2048: Won=%v Score=%d", g.Won, g.Score)
+	}
+
+	g.Board = Board{
+		{2, 4, 2, 4},
+		{4, 2, 4, 2},
+		{2, 4, 2, 4},
+		{4, 2, 4, 2},
+	}
+	if g.CanMove() {
+		t.Error("CanMove() on a locked board")
+	}
+
+	g.Board[3][3] = 4
+	if !g.CanMove() {
+		t.Error("CanMove() false with a mergeable pair")
+	}
+}
@@ -0,0 +1,392 @@
+// Package jobs runs renders on a schedule, with nobody connected, and
+// keeps what the last one made. Like the bans, jobs can be saved to a
+// JSON file so they outlive the server.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+)
+
+const (
+	// MinInterval keeps a job from fetching the same thing over and
+	// over.
+	MinInterval = 30 * time.Second
+
+	// MaxBackoff is the longest a failing job waits to try again, unless
+	// its interval is longer still.
+	MaxBackoff = time.Hour
+
+	// Each wait is stretched or shrunk by up to this fraction, so jobs
+	// with the same interval don't all fetch at once.
+	jitter = 0.1
+
+	// A job's first run comes within this long of it being scheduled.
+	first_spread = 10 * time.Second
+
+	// No more than this many jobs run at once; the rest wait their turn.
+	max_running = 4
+)
+
+var (
+	ErrName     = errors.New("job names are 1-32 letters, digits, '_' or '-'")
+	ErrURL      = errors.New("a job needs a URL to fetch")
+	ErrInterval = fmt.Errorf("a job's interval is at least %s", MinInterval)
+)
+
+// ValidName reports whether name can name a job.
+func ValidName(name string) bool {
+	if len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// A Spec is what a job does. Settings are the render settings as the
+// server saved them, without the scheduler looking inside. A Live job's
+// renders are shown to spectators as well as kept.
+type Spec struct {
+	Name     string
+	URL      string
+	Interval time.Duration
+	Settings json.RawMessage
+	Live     bool
+}
+
+// spec_json is how a Spec is written down: the interval is kept as
+// something a person can write, like "5m".
+type spec_json struct {
+	Name     string          `json:"name"`
+	URL      string          `json:"url"`
+	Interval string          `json:"interval"`
+	Settings json.RawMessage `json:"settings,omitempty"`
+	Live     bool            `json:"live,omitempty"`
+}
+
+func (s Spec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(spec_json{s.Name, s.URL, s.Interval.String(), s.Settings, s.Live})
+}
+
+func (s *Spec) UnmarshalJSON(data []byte) error {
+	var j spec_json
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(j.Interval)
+	if err != nil {
+		return fmt.Errorf("job %q: interval: %w", j.Name, err)
+	}
+	*s = Spec{j.Name, j.URL, d, j.Settings, j.Live}
+	return nil
+}
+
+func (s Spec) check(min_interval time.Duration) error {
+	switch {
+	case !ValidName(s.Name):
+		return ErrName
+	case s.URL == "":
+		return ErrURL
+	case s.Interval < min_interval:
+		return ErrInterval
+	}
+	return nil
+}
+
+// A RunFunc does a job once, returning what it made. ctx is done if the
+// job is removed meanwhile.
+type RunFunc func(ctx context.Context, s Spec) (string, error)
+
+// A Status is how a job is getting on.
+type Status struct {
+	Spec
+
+	Running bool
+	Next    time.Time
+
+	// Runs and Skipped count the runs made and the ticks passed over
+	// because the last run was still going.
+	Runs    int
+	Skipped int
+
+	// The last run: when it started, how long it took and, if it failed,
+	// why. Failures counts the failed runs since the last that worked.
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastErr      error
+	Failures     int
+
+	// Output is what the last run that worked made, at OutputAt.
+	Output   string
+	OutputAt time.Time
+}
+
+type job struct {
+	status Status
+	timer  *time.Timer
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// A Scheduler runs every job it holds on its own timer, and is safe for
+// concurrent use. If it has a path, every change to the jobs is written
+// straight back to it.
+type Scheduler struct {
+	mu      sync.Mutex
+	path    string
+	run     RunFunc
+	jobs    map[string]*job
+	slots   chan struct{}
+	stopped bool
+
+	// min_interval is MinInterval, lowered by the tests.
+	min_interval time.Duration
+}
+
+// Open loads the jobs saved at path, or starts with none if there is no
+// file yet; an empty path keeps them in memory only. Nothing runs until
+// Start.
+func Open(path string, run RunFunc) (*Scheduler, error) {
+	s := &Scheduler{
+		path:         path,
+		run:          run,
+		jobs:         map[string]*job{},
+		slots:        make(chan struct{}, max_running),
+		min_interval: MinInterval,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Spec
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, spec := range list {
+		if err := spec.check(s.min_interval); err != nil {
+			return nil, fmt.Errorf("%s: job %q: %w", path, spec.Name, err)
+		}
+		if s.jobs[spec.Name] != nil {
+			return nil, fmt.Errorf("%s: job %q is there twice", path, spec.Name)
+		}
+		s.jobs[spec.Name] = s.new_job(spec)
+	}
+	return s, nil
+}
+
+// Start schedules every job loaded.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		s.schedule(j, first_wait(j.status.Interval))
+	}
+}
+
+// Stop cancels every job, for good.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	for _, j := range s.jobs {
+		j.timer.Stop()
+		j.cancel()
+	}
+}
+
+// Add schedules spec, in place of any job by the same name, and reports
+// whether it replaced one.
+func (s *Scheduler) Add(spec Spec) (bool, error) {
+	if err := spec.check(s.min_interval); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.jobs[spec.Name]
+	if old != nil {
+		old.timer.Stop()
+		old.cancel()
+	}
+	j := s.new_job(spec)
+	s.jobs[spec.Name] = j
+	if !s.stopped {
+		s.schedule(j, first_wait(spec.Interval))
+	}
+	return old != nil, s.save()
+}
+
+// Remove takes the named job away, stopping it if it's running, and
+// reports whether there was one.
+func (s *Scheduler) Remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := s.jobs[name]
+	if j == nil {
+		return false, nil
+	}
+	j.timer.Stop()
+	j.cancel()
+	delete(s.jobs, name)
+	return true, s.save()
+}
+
+// Get returns how the named job is getting on.
+func (s *Scheduler) Get(name string) (Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j := s.jobs[name]
+	if j == nil {
+		return Status{}, false
+	}
+	return j.status, true
+}
+
+// List returns how every job is getting on, by name.
+func (s *Scheduler) List() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.status)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].Name < list[k].Name })
+	return list
+}
+
+func (s *Scheduler) new_job(spec Spec) *job {
+	j := &job{status: Status{Spec: spec}}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	j.timer = time.AfterFunc(time.Hour, func() { s.tick(j) })
+	j.timer.Stop()
+	return j
+}
+
+// schedule sets j's next tick d from now. It's called with s.mu held.
+func (s *Scheduler) schedule(j *job, d time.Duration) {
+	j.status.Next = time.Now().Add(d)
+	j.timer.Reset(d)
+}
+
+// tick starts a run of j, unless the last is still going, and sets the
+// tick after. Ticks keep to the interval however long runs take.
+func (s *Scheduler) tick(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[j.status.Name] != j || j.ctx.Err() != nil {
+		return
+	}
+	s.schedule(j, wait(j.status))
+	if j.status.Running {
+		j.status.Skipped++
+		return
+	}
+	j.status.Running = true
+	go s.run_job(j)
+}
+
+func (s *Scheduler) run_job(j *job) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-j.ctx.Done():
+		s.mu.Lock()
+		j.status.Running = false
+		s.mu.Unlock()
+		return
+	}
+	defer func() { <-s.slots }()
+
+	start := time.Now()
+	out, err := s.run(j.ctx, j.status.Spec)
+	took := time.Since(start)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &j.status
+	st.Running = false
+	st.Runs++
+	st.LastRun, st.LastDuration, st.LastErr = start, took, err
+	if err != nil {
+		// A failure puts the next try off for longer each time.
+		st.Failures++
+		if s.jobs[st.Name] == j && j.ctx.Err() == nil {
+			s.schedule(j, wait(*st))
+		}
+		return
+	}
+	st.Failures = 0
+	st.Output, st.OutputAt = out, start
+}
+
+// wait is how long until the next tick of a job: its interval, doubled
+// for each failure in a row up to MaxBackoff, give or take the jitter.
+func wait(st Status) time.Duration {
+	d := st.Interval
+	for range min(st.Failures, 16) {
+		if d >= MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if st.Failures > 0 {
+		d = max(min(d, MaxBackoff), st.Interval)
+	}
+	spread := float64(d) * jitter
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// first_wait is how long until a newly scheduled job first runs: soon,
+// but not at the same moment as every other job loaded with it.
+func first_wait(interval time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(min(interval, first_spread))))
+}
+
+// save writes every job to s.path, by way of a temporary file so a crash
+// halfway through doesn't lose them. It's called with s.mu held.
+func (s *Scheduler) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]Spec, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.status.Spec)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].Name < list[k].Name })
+
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(s.path, data, 0o600)
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"dashboard":                         true,
+		"status_2-b":                        true,
+		"":                                  false,
+		"has space":                         false,
+		"dash.board":                        false,
+		"x1234567890123456789012345678901y": false,
+	} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestAddChecks(t *testing.T) {
+	s, _ := Open("", nil)
+	for spec, want := range map[*Spec]error{
+		{Name: "bad name", URL: "http://x/a.png", Interval: time.Minute}: ErrName,
+		{Name: "a", Interval: time.Minute}:                               ErrURL,
+		{Name: "a", URL: "http://x/a.png", Interval: time.Second}:        ErrInterval,
+	} {
+		if _, err := s.Add(*spec); err != want {
+			t.Errorf("Add(%+v) = %v, want %v", *spec, err, want)
+		}
+	}
+}
+
+func TestSaveAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	s, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	spec := Spec{Name: "dash", URL: "http://x/a.png", Interval: 5 * time.Minute, Settings: json.RawMessage(`{"width":80}`), Live: true}
+	if replaced, err := s.Add(spec); replaced || err != nil {
+		t.Fatalf("Add = %v, %v", replaced, err)
+	}
+	s.Add(Spec{Name: "gone", URL: "http://x/b.png", Interval: time.Hour})
+	if ok, err := s.Remove("gone"); !ok || err != nil {
+		t.Fatalf("Remove = %v, %v", ok, err)
+	}
+
+	again, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := again.List()
+	if len(list) != 1 {
+		t.Fatalf("reopened with %d jobs, want 1", len(list))
+	}
+	got := list[0].Spec
+	var settings bytes.Buffer
+	json.Compact(&settings, got.Settings)
+	if got.Name != spec.Name || got.URL != spec.URL || got.Interval != spec.Interval || settings.String() != string(spec.Settings) || !got.Live {
+		t.Errorf("reopened as %+v, want %+v", got, spec)
+	}
+}
+
+func TestWait(t *testing.T) {
+	within := func(d, want time.Duration) bool {
+		spread := time.Duration(float64(want) * jitter)
+		return d >= want-spread && d <= want+spread
+	}
+
+	for _, c := range []struct {
+		interval time.Duration
+		failures int
+		want     time.Duration
+	}{
+		{time.Minute, 0, time.Minute},
+		{time.Minute, 1, 2 * time.Minute},
+		{time.Minute, 3, 8 * time.Minute},
+		{time.Minute, 20, MaxBackoff},
+		{2 * time.Hour, 5, 2 * time.Hour},
+	} {
+		st := Status{Spec: Spec{Interval: c.interval}, Failures: c.failures}
+		for range 20 {
+			if d := wait(st); !within(d, c.want) {
+				t.Errorf("wait(%s, %d failures) = %s, want about %s", c.interval, c.failures, d, c.want)
+				break
+			}
+		}
+	}
+}
+
+// quick is a scheduler that ticks every few milliseconds.
+func quick(t *testing.T, run RunFunc) *Scheduler {
+	t.Helper()
+
+	s, _ := Open("", run)
+	s.min_interval = time.Millisecond
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func eventually(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunKeepsOutput(t *testing.T) {
+	var runs atomic.Int32
+	s := quick(t, func(_ context.Context, spec Spec) (string, error) {
+		if runs.Add(1) == 2 {
+			return "", errors.New("no luck")
+		}
+		return "frame of " + spec.URL, nil
+	})
+	s.Add(Spec{Name: "dash", URL: "http://x/a.png", Interval: 5 * time.Millisecond})
+
+	eventually(t, "a failed run", func() bool {
+		st, _ := s.Get("dash")
+		return st.Failures == 1 && !st.Running
+	})
+	st, _ := s.Get("dash")
+	if st.Output != "frame of http://x/a.png" {
+		t.Errorf("output after a failure = %q, want the last that worked", st.Output)
+	}
+	if st.LastErr == nil || st.LastErr.Error() != "no luck" {
+		t.Errorf("last error = %v", st.LastErr)
+	}
+
+	eventually(t, "a run that works again", func() bool {
+		st, _ := s.Get("dash")
+		return st.Runs >= 3 && st.Failures == 0
+	})
+}
+
+func TestSkipsWhileRunning(t *testing.T) {
+	release := make(chan struct{})
+	var runs atomic.Int32
+	s := quick(t, func(ctx context.Context, _ Spec) (string, error) {
+		runs.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return "", nil
+	})
+	s.Add(Spec{Name: "slow", URL: "http://x/a.png", Interval: 2 * time.Millisecond})
+
+	eventually(t, "ticks to be skipped", func() bool {
+		st, _ := s.Get("slow")
+		return st.Skipped >= 3
+	})
+	if n := runs.Load(); n != 1 {
+		t.Errorf("%d runs at once, want 1", n)
+	}
+	close(release)
+}
+
+func TestRemoveCancels(t *testing.T) {
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{})
+	s := quick(t, func(ctx context.Context, _ Spec) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	})
+	s.Add(Spec{Name: "dash", URL: "http://x/a.png", Interval: 5 * time.Millisecond})
+
+	<-started
+	if ok, _ := s.Remove("dash"); !ok {
+		t.Fatal("Remove found no job")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("removing the job didn't cancel its run")
+	}
+	if _, ok := s.Get("dash"); ok {
+		t.Error("removed job is still listed")
+	}
+}
@@ -0,0 +1,292 @@
+// Package leaderboard keeps every player's best result in each game, and
+// optionally saves them to a JSON file so they outlive the server.
+package leaderboard
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+)
+
+// A Kind says how a game's results are compared.
+type Kind int
+
+const (
+	Highest Kind = iota // points, speed
+	Lowest              // guesses, moves, turns
+	Total               // wins: results add up rather than compete
+)
+
+// Better reports whether a beats b.
+func (k Kind) Better(a, b float64) bool {
+	if k == Lowest {
+		return a < b
+	}
+	return a > b
+}
+
+type Record struct {
+	Best  float64   `json:"best"`
+	Plays int       `json:"plays"`
+	When  time.Time `json:"when"` // when Best was set
+}
+
+type board struct {
+	Kind    Kind               `json:"kind"`
+	Players map[string]*Record `json:"players"`
+}
+
+// A Store is safe for concurrent use. If it has a path, every change is
+// written straight back to it.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	games map[string]*board
+}
+
+var ErrNick = errors.New("nicknames are 1-16 letters, digits, '_' or '-'")
+
+// ValidNick reports whether name can be put on a leaderboard.
+func ValidNick(name string) bool {
+	if len(name) > 16 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Open loads the store saved at path, or starts an empty one if there is
+// no file yet; an empty path keeps scores in memory only. A file that
+// can't be read as scores is moved aside rather than lost, and the name
+// it was moved to is returned.
+func Open(path string) (s *Store, backup string, err error) {
+	s = &Store{path: path, games: map[string]*board{}}
+	if path == "" {
+		return s, "", nil
+	}
+
+	backup, err = atomicfile.Load(path, func(data []byte) error {
+		if err := json.Unmarshal(data, &s.games); err != nil {
+			return err
+		}
+		if !s.valid() {
+			return errors.New("invalid leaderboard")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if backup != "" {
+		s.games = map[string]*board{}
+	}
+	return s, backup, nil
+}
+
+// valid checks a freshly loaded file hangs together.
+func (s *Store) valid() bool {
+	if s.games == nil {
+		return false
+	}
+	for _, b := range s.games {
+		if b == nil || b.Kind < Highest || b.Kind > Total {
+			return false
+		}
+		if b.Players == nil {
+			b.Players = map[string]*Record{}
+		}
+		for nick, r := range b.Players {
+			if r == nil || !ValidNick(nick) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// A Result is what Submit made of a score.
+type Result struct {
+	Record
+
+	// Improved is set when the score became the player's best, or for
+	// Total games, whenever it was added.
+	Improved bool
+	First    bool
+}
+
+func (s *Store) Submit(game, nick string, kind Kind, score float64) (Result, error) {
+	if !ValidNick(nick) {
+		return Result{}, ErrNick
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.board(game, kind)
+	r := b.Players[nick]
+	res := Result{First: r == nil}
+	if r == nil {
+		r = &Record{Best: score}
+		b.Players[nick] = r
+		res.Improved = true
+	}
+	r.Plays++
+
+	switch {
+	case b.Kind == Total && !res.First:
+		r.Best += score
+		res.Improved = true
+	case !res.First && b.Kind.Better(score, r.Best):
+		r.Best = score
+		res.Improved = true
+	}
+	if res.Improved {
+		r.When = time.Now()
+	}
+
+	res.Record = *r
+	return res, s.save()
+}
+
+// Enter puts nick on game's board with score, unless they're on it
+// already, and reports whether they were added. It's for games that can
+// only be played once: the attempt is entered as it starts, and Submit
+// records the result. An entry Submit hasn't seen yet has no Plays.
+func (s *Store) Enter(game, nick string, kind Kind, score float64) (bool, error) {
+	if !ValidNick(nick) {
+		return false, ErrNick
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.board(game, kind)
+	if b.Players[nick] != nil {
+		return false, nil
+	}
+	b.Players[nick] = &Record{Best: score, When: time.Now()}
+	return true, s.save()
+}
+
+// Has reports whether nick is on game's board.
+func (s *Store) Has(game, nick string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.games[game]
+	return b != nil && b.Players[nick] != nil
+}
+
+// board returns game's board, starting it if need be. It's called with
+// s.mu held.
+func (s *Store) board(game string, kind Kind) *board {
+	b := s.games[game]
+	if b == nil {
+		b = &board{Kind: kind, Players: map[string]*Record{}}
+		s.games[game] = b
+	}
+	return b
+}
+
+// save writes the store to a temporary file beside its own and renames
+// it into place, so a crash mid-write leaves the old scores intact. It's
+// called with s.mu held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.games, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(s.path, data, 0o600)
+}
+
+type Entry struct {
+	Nick string
+	Record
+}
+
+// ranked sorts a board's entries best first; ties go to who got there
+// first. It's called with s.mu held.
+func (b *board) ranked() []Entry {
+	var entries []Entry
+	for nick, r := range b.Players {
+		entries = append(entries, Entry{nick, *r})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, c := entries[i], entries[j]
+		if a.Best != c.Best {
+			return b.Kind.Better(a.Best, c.Best)
+		}
+		if !a.When.Equal(c.When) {
+			return a.When.Before(c.When)
+		}
+		return a.Nick < c.Nick
+	})
+	return entries
+}
+
+// Top returns up to n of game's best players, and how the game is scored.
+func (s *Store) Top(game string, n int) ([]Entry, Kind, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.games[game]
+	if b == nil {
+		return nil, 0, false
+	}
+	entries := b.ranked()
+	return entries[:min(n, len(entries))], b.Kind, true
+}
+
+// Games lists every game with a leaderboard.
+func (s *Store) Games() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for name := range s.games {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A Standing is how one player is doing in one game.
+type Standing struct {
+	Game string
+	Kind Kind
+	Record
+	Rank, Of int
+}
+
+// Player lists nick's standing in every game they've played.
+func (s *Store) Player(nick string) []Standing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Standing
+	for game, b := range s.games {
+		if b.Players[nick] == nil {
+			continue
+		}
+		for i, e := range b.ranked() {
+			if e.Nick == nick {
+				out = append(out, Standing{game, b.Kind, e.Record, i + 1, len(b.Players)})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Game < out[j].Game })
+	return out
+}
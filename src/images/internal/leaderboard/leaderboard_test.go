@@ -0,0 +1,236 @@
+package leaderboard
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+
+	s, backup, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup != "" {
+		t.Fatalf("unexpected backup to %s", backup)
+	}
+	return s
+}
+
+func nicks(entries []Entry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Nick+"="+strconv.FormatFloat(e.Best, 'f', -1, 64))
+	}
+	return out
+}
+
+func TestKinds(t *testing.T) {
+	s := open(t, "")
+
+	for _, sub := range []struct {
+		game, nick string
+		kind       Kind
+		score      float64
+	}{
+		{"snake", "ann", Highest, 10},
+		{"snake", "bob", Highest, 30},
+		{"snake", "ann", Highest, 20},
+		{"snake", "ann", Highest, 5},
+		{"maze", "ann", Lowest, 40},
+		{"maze", "bob", Lowest, 25},
+		{"maze", "bob", Lowest, 60},
+		{"chess", "ann", Total, 1},
+		{"chess", "ann", Total, 1},
+		{"chess", "bob", Total, 1},
+	} {
+		if _, err := s.Submit(sub.game, sub.nick, sub.kind, sub.score); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for game, want := range map[string]string{
+		"snake": "[bob=30 ann=20]",
+		"maze":  "[bob=25 ann=40]",
+		"chess": "[ann=2 bob=1]",
+	} {
+		entries, _, ok := s.Top(game, 10)
+		if got := fmt.Sprint(nicks(entries)); !ok || got != want {
+			t.Errorf("%s: got %v, want %s", game, got, want)
+		}
+	}
+
+	if entries, _, _ := s.Top("snake", 1); len(entries) != 1 || entries[0].Nick != "bob" {
+		t.Errorf("top 1: %v", nicks(entries))
+	}
+	if _, _, ok := s.Top("pong", 10); ok {
+		t.Error("a board for a game nobody played")
+	}
+}
+
+func TestSubmitResult(t *testing.T) {
+	s := open(t, "")
+
+	res, _ := s.Submit("2048", "ann", Highest, 100)
+	if !res.First || !res.Improved || res.Best != 100 || res.Plays != 1 {
+		t.Errorf("first game: %+v", res)
+	}
+	res, _ = s.Submit("2048", "ann", Highest, 50)
+	if res.First || res.Improved || res.Best != 100 || res.Plays != 2 {
+		t.Errorf("worse game: %+v", res)
+	}
+	res, _ = s.Submit("2048", "ann", Highest, 200)
+	if !res.Improved || res.Best != 200 || res.Plays != 3 {
+		t.Errorf("better game: %+v", res)
+	}
+
+	for _, bad := range []string{"", "this-nick-is-far-too-long", "ann smith", "ann\033[31m"} {
+		if _, err := s.Submit("2048", bad, Highest, 1); err != ErrNick {
+			t.Errorf("nick %q: %v", bad, err)
+		}
+	}
+}
+
+func TestEnter(t *testing.T) {
+	s := open(t, "")
+
+	if ok, err := s.Enter("daily", "ann", Lowest, 99); !ok || err != nil {
+		t.Fatalf("first entry: %v, %v", ok, err)
+	}
+	if ok, _ := s.Enter("daily", "ann", Lowest, 99); ok {
+		t.Error("entered twice")
+	}
+	if !s.Has("daily", "ann") || s.Has("daily", "bob") || s.Has("maze", "ann") {
+		t.Error("Has doesn't match the entries")
+	}
+
+	entries, _, _ := s.Top("daily", 10)
+	if len(entries) != 1 || entries[0].Plays != 0 {
+		t.Errorf("before the result: %+v", entries)
+	}
+	res, _ := s.Submit("daily", "ann", Lowest, 4)
+	if res.First || !res.Improved || res.Best != 4 || res.Plays != 1 {
+		t.Errorf("result after entering: %+v", res)
+	}
+
+	if _, err := s.Enter("daily", "no spaces", Lowest, 1); err != ErrNick {
+		t.Errorf("bad nick: %v", err)
+	}
+}
+
+func TestTies(t *testing.T) {
+	s := open(t, "")
+
+	s.Submit("snake", "zed", Highest, 10)
+	s.Submit("snake", "amy", Highest, 10)
+
+	// zed got there first.
+	if entries, _, _ := s.Top("snake", 10); entries[0].Nick != "zed" {
+		t.Errorf("tie went to %s", entries[0].Nick)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	s := open(t, "")
+
+	s.Submit("snake", "ann", Highest, 10)
+	s.Submit("snake", "bob", Highest, 30)
+	s.Submit("maze", "ann", Lowest, 4)
+
+	standings := s.Player("ann")
+	if len(standings) != 2 {
+		t.Fatalf("standings: %+v", standings)
+	}
+	if m := standings[0]; m.Game != "maze" || m.Rank != 1 || m.Of != 1 {
+		t.Errorf("maze: %+v", m)
+	}
+	if sn := standings[1]; sn.Game != "snake" || sn.Rank != 2 || sn.Of != 2 || sn.Best != 10 {
+		t.Errorf("snake: %+v", sn)
+	}
+	if len(s.Player("cat")) != 0 {
+		t.Error("standings for someone who never played")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.json")
+
+	s := open(t, path)
+	s.Submit("snake", "ann", Highest, 10)
+	s.Submit("maze", "bob", Lowest, 7)
+
+	s = open(t, path)
+	if entries, kind, ok := s.Top("maze", 10); !ok || kind != Lowest || len(entries) != 1 || entries[0].Best != 7 {
+		t.Errorf("maze after reopening: %v %v %v", entries, kind, ok)
+	}
+	if got := s.Games(); len(got) != 2 {
+		t.Errorf("games after reopening: %v", got)
+	}
+
+	leftovers, _ := filepath.Glob(path + ".tmp-*")
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, contents := range map[string]string{
+		"garbage":  "{not json",
+		"wrong":    `["a", "list"]`,
+		"bad kind": `{"snake": {"kind": 9, "players": {}}}`,
+		"bad nick": `{"snake": {"kind": 0, "players": {"no spaces": {"best": 1}}}}`,
+	} {
+		path := filepath.Join(dir, "scores.json")
+		os.WriteFile(path, []byte(contents), 0o644)
+
+		s, backup, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(s.Games()) != 0 {
+			t.Errorf("%s: kept games %v", name, s.Games())
+		}
+		saved, err := os.ReadFile(backup)
+		if err != nil || string(saved) != contents {
+			t.Errorf("%s: backup %q holds %q, %v", name, backup, saved, err)
+		}
+		os.Remove(backup)
+
+		// The fresh store can still be written to.
+		if _, err := s.Submit("snake", "ann", Highest, 1); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestConcurrentSubmits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.json")
+	s := open(t, path)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Submit("typing", "p"+strconv.Itoa(i), Highest, float64(i))
+			s.Submit("wins", "ann", Total, 1)
+		}()
+	}
+	wg.Wait()
+
+	s = open(t, path)
+	if entries, _, _ := s.Top("typing", 100); len(entries) != 20 {
+		t.Errorf("%d typists saved", len(entries))
+	}
+	if entries, _, _ := s.Top("wins", 1); entries[0].Best != 20 {
+		t.Errorf("%v wins saved", entries[0].Best)
+	}
+}
@@ -0,0 +1,196 @@
+// Package maze generates and solves perfect mazes: every floor square can
+// reach every other by exactly one path. Drawing and input are left to
+// the caller.
+package maze
+
+import "math/rand"
+
+type Point struct{ X, Y int }
+
+var (
+	Up    = Point{0, -1}
+	Down  = Point{0, 1}
+	Left  = Point{-1, 0}
+	Right = Point{1, 0}
+)
+
+var directions = []Point{Up, Down, Left, Right}
+
+func (p Point) Add(q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
+
+// A Maze is a grid of squares that are either wall or floor. Rooms sit at
+// odd coordinates with the squares between them carved out where two
+// rooms are joined, so both dimensions are odd and the border is solid.
+type Maze struct {
+	Width, Height int
+	Start, Exit   Point
+
+	walls []bool
+}
+
+// New generates a maze with a recursive backtracker: a random walk that
+// carves into unvisited rooms and backs up when it gets stuck. Even
+// dimensions are rounded down, and anything under 3 becomes 3.
+func New(width, height int, rng *rand.Rand) *Maze {
+	width = max(3, width-(1-width%2))
+	height = max(3, height-(1-height%2))
+
+	m := &Maze{
+		Width:  width,
+		Height: height,
+		Start:  Point{1, 1},
+		Exit:   Point{width - 2, height - 2},
+		walls:  make([]bool, width*height),
+	}
+	for i := range m.walls {
+		m.walls[i] = true
+	}
+
+	m.set(m.Start, false)
+	stack := []Point{m.Start}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+
+		var next []Point
+		for _, d := range directions {
+			q := Point{p.X + 2*d.X, p.Y + 2*d.Y}
+			if m.inside(q) && m.Wall(q) {
+				next = append(next, q)
+			}
+		}
+		if len(next) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		q := next[rng.Intn(len(next))]
+		m.set(Point{(p.X + q.X) / 2, (p.Y + q.Y) / 2}, false)
+		m.set(q, false)
+		stack = append(stack, q)
+	}
+
+	return m
+}
+
+func (m *Maze) inside(p Point) bool {
+	return p.X > 0 && p.Y > 0 && p.X < m.Width-1 && p.Y < m.Height-1
+}
+
+func (m *Maze) set(p Point, wall bool) {
+	m.walls[p.Y*m.Width+p.X] = wall
+}
+
+// Wall reports whether p is a wall. Everything outside the grid is.
+func (m *Maze) Wall(p Point) bool {
+	if p.X < 0 || p.Y < 0 || p.X >= m.Width || p.Y >= m.Height {
+		return true
+	}
+	return m.walls[p.Y*m.Width+p.X]
+}
+
+// Solve returns the shortest path from Start to Exit, both included.
+func (m *Maze) Solve() []Point {
+	return m.Path(m.Start, m.Exit)
+}
+
+// Path finds the shortest route between two floor squares by breadth
+// first search, or returns nil if there is none.
+func (m *Maze) Path(from, to Point) []Point {
+	prev := map[Point]Point{from: from}
+	queue := []Point{from}
+
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+
+		if p == to {
+			var path []Point
+			for ; p != from; p = prev[p] {
+				path = append(path, p)
+			}
+			path = append(path, from)
+
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+
+		for _, d := range directions {
+			q := p.Add(d)
+			if _, seen := prev[q]; !seen && !m.Wall(q) {
+				prev[q] = p
+				queue = append(queue, q)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Visible returns the squares within radius of from that can be seen from
+// it: those reached by a straight line that passes through no wall before
+// getting there. Walls themselves can be seen, so corridors have edges.
+func (m *Maze) Visible(from Point, radius int) map[Point]bool {
+	seen := map[Point]bool{}
+
+	for y := from.Y - radius; y <= from.Y+radius; y++ {
+		for x := from.X - radius; x <= from.X+radius; x++ {
+			to := Point{x, y}
+			dx, dy := x-from.X, y-from.Y
+			if dx*dx+dy*dy > radius*radius || to.X < 0 || to.Y < 0 || to.X >= m.Width || to.Y >= m.Height {
+				continue
+			}
+			if m.clear(from, to) {
+				seen[to] = true
+			}
+		}
+	}
+
+	return seen
+}
+
+// clear walks a Bresenham line from a to b and reports whether nothing
+// but floor lies strictly between them. The line may step diagonally, but
+// can't slip between rooms that way: the squares where rooms' corners
+// meet are always wall.
+func (m *Maze) clear(a, b Point) bool {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	err := dx + dy
+
+	for p := a; p != b; {
+		if p != a && m.Wall(p) {
+			return false
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			p.X += sx
+		}
+		if e2 <= dx {
+			err += dx
+			p.Y += sy
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
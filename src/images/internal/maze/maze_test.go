@@ -0,0 +1,116 @@
+package maze
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func floors(m *Maze) []Point {
+	var out []Point
+	for y := range m.Height {
+		for x := range m.Width {
+			if p := (Point{x, y}); !m.Wall(p) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// A maze is perfect when its floor is connected and has no loops, which
+// for a grid graph means exactly one fewer joins than squares.
+func TestPerfect(t *testing.T) {
+	for seed := range int64(50) {
+		m := New(21, 15, rand.New(rand.NewSource(seed)))
+
+		squares := floors(m)
+		joins := 0
+		for _, p := range squares {
+			for _, d := range []Point{Right, Down} {
+				if !m.Wall(p.Add(d)) {
+					joins++
+				}
+			}
+			if m.Path(m.Start, p) == nil {
+				t.Fatalf("seed %d: %v is unreachable", seed, p)
+			}
+		}
+
+		if joins != len(squares)-1 {
+			t.Fatalf("seed %d: %d squares joined %d times, want a tree", seed, len(squares), joins)
+		}
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	a := New(31, 21, rand.New(rand.NewSource(12345)))
+	b := New(31, 21, rand.New(rand.NewSource(12345)))
+
+	for i := range a.walls {
+		if a.walls[i] != b.walls[i] {
+			t.Fatal("the same seed generated different mazes")
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	m := New(30, 20, rand.New(rand.NewSource(1)))
+	if m.Width != 29 || m.Height != 19 {
+		t.Errorf("30x20 gave %dx%d, want 29x19", m.Width, m.Height)
+	}
+	if m.Wall(m.Exit) || m.Exit != (Point{27, 17}) {
+		t.Errorf("exit %v is not the bottom-right room", m.Exit)
+	}
+}
+
+func TestSolve(t *testing.T) {
+	m := New(41, 21, rand.New(rand.NewSource(7)))
+	path := m.Solve()
+
+	if path[0] != m.Start || path[len(path)-1] != m.Exit {
+		t.Fatalf("path runs %v to %v", path[0], path[len(path)-1])
+	}
+	seen := map[Point]bool{}
+	for i, p := range path {
+		if m.Wall(p) || seen[p] {
+			t.Fatalf("path goes through wall or revisits %v", p)
+		}
+		seen[p] = true
+		if i > 0 && abs(p.X-path[i-1].X)+abs(p.Y-path[i-1].Y) != 1 {
+			t.Fatalf("path jumps from %v to %v", path[i-1], p)
+		}
+	}
+}
+
+func TestVisible(t *testing.T) {
+	// A hand-made corridor: the wall in the middle hides what's behind it.
+	//
+	//	#######
+	//	#..#..#
+	//	#######
+	m := &Maze{Width: 7, Height: 3, walls: make([]bool, 21)}
+	for i := range m.walls {
+		m.walls[i] = true
+	}
+	for _, x := range []int{1, 2, 4, 5} {
+		m.set(Point{x, 1}, false)
+	}
+
+	seen := m.Visible(Point{1, 1}, 10)
+	for p, want := range map[Point]bool{
+		{1, 1}: true,
+		{2, 1}: true,
+		{3, 1}: true, // the wall itself
+		{4, 1}: false,
+		{5, 1}: false,
+		{0, 0}: true,
+	} {
+		if seen[p] != want {
+			t.Errorf("visible %v = %v, want %v", p, seen[p], want)
+		}
+	}
+
+	if len(m.Visible(Point{1, 1}, 1)) != 5 {
+		t.Errorf("radius 1 should see the square and its four neighbours")
+	}
+}
@@ -0,0 +1,189 @@
+// Package memory implements the card-matching game Concentration: a grid
+// of face-down pairs, turned over two at a time.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	MinCols, MaxCols = 4, 8
+	MinRows, MaxRows = 3, 6
+
+	// Faces is how many different cards there are, enough to fill the
+	// largest board.
+	Faces = MaxCols * MaxRows / 2
+)
+
+var (
+	ErrSame    = errors.New("pick two different cards")
+	ErrMatched = errors.New("that card is already matched")
+)
+
+type Card struct {
+	Face    int
+	Matched bool
+}
+
+// Board holds the cards row by row. Cards are named by row letter and
+// column number, so "a1" is the top-left one.
+type Board struct {
+	Cols, Rows int
+	Cards      []Card
+}
+
+// New deals a shuffled board. cols*rows must be even.
+func New(cols, rows int, rng *rand.Rand) (*Board, error) {
+	if cols < MinCols || cols > MaxCols || rows < MinRows || rows > MaxRows {
+		return nil, fmt.Errorf("boards are from %dx%d to %dx%d", MinCols, MinRows, MaxCols, MaxRows)
+	}
+	if cols*rows%2 != 0 {
+		return nil, fmt.Errorf("a %dx%d board has an odd number of cards", cols, rows)
+	}
+
+	b := &Board{Cols: cols, Rows: rows}
+	for _, face := range rng.Perm(Faces)[:cols*rows/2] {
+		b.Cards = append(b.Cards, Card{Face: face}, Card{Face: face})
+	}
+	rng.Shuffle(len(b.Cards), func(i, j int) {
+		b.Cards[i], b.Cards[j] = b.Cards[j], b.Cards[i]
+	})
+	return b, nil
+}
+
+// Index finds the card named by coord, such as "b3".
+func (b *Board) Index(coord string) (int, error) {
+	coord = strings.ToLower(strings.TrimSpace(coord))
+	if len(coord) < 2 {
+		return 0, fmt.Errorf("%q isn't a card like b3", coord)
+	}
+
+	row := int(coord[0] - 'a')
+	col, err := strconv.Atoi(coord[1:])
+	if err != nil || row < 0 || row >= b.Rows || col < 1 || col > b.Cols {
+		return 0, fmt.Errorf("%q isn't on the board (A1 to %c%d)", coord, 'A'+b.Rows-1, b.Cols)
+	}
+	return row*b.Cols + col - 1, nil
+}
+
+// Name is the inverse of Index.
+func (b *Board) Name(i int) string {
+	return fmt.Sprintf("%c%d", 'A'+i/b.Cols, i%b.Cols+1)
+}
+
+// Check reports why card i can't be turned over, if it can't.
+func (b *Board) Check(i int) error {
+	if b.Cards[i].Matched {
+		return ErrMatched
+	}
+	return nil
+}
+
+// Flip turns over cards i and j and reports whether they match, in which
+// case they stay face up for good.
+func (b *Board) Flip(i, j int) (bool, error) {
+	if i == j {
+		return false, ErrSame
+	}
+	if err := b.Check(i); err != nil {
+		return false, err
+	}
+	if err := b.Check(j); err != nil {
+		return false, err
+	}
+
+	if b.Cards[i].Face != b.Cards[j].Face {
+		return false, nil
+	}
+	b.Cards[i].Matched = true
+	b.Cards[j].Matched = true
+	return true, nil
+}
+
+// Done reports whether every pair has been found.
+func (b *Board) Done() bool {
+	for _, c := range b.Cards {
+		if !c.Matched {
+			return false
+		}
+	}
+	return true
+}
+
+// AI remembers cards it has seen turned over, though not perfectly: each
+// time a card is shown it is only taken in Recall percent of the time.
+type AI struct {
+	Recall int
+
+	known map[int]int // card index to face
+	rng   *rand.Rand
+}
+
+func NewAI(recall int, rng *rand.Rand) *AI {
+	return &AI{Recall: recall, known: map[int]int{}, rng: rng}
+}
+
+// Saw tells the AI a card has been shown face up.
+func (a *AI) Saw(i, face int) {
+	if a.rng.Intn(100) < a.Recall {
+		a.known[i] = face
+	}
+}
+
+// First picks the first card of a turn: half of a pair it knows about if
+// there is one, or else one it hasn't seen.
+func (a *AI) First(b *Board) int {
+	a.forget_matched(b)
+
+	for i, fi := range a.known {
+		for j, fj := range a.known {
+			if i != j && fi == fj {
+				return i
+			}
+		}
+	}
+	return a.unknown(b, -1)
+}
+
+// Second picks a partner for the card just turned over.
+func (a *AI) Second(b *Board, first int) int {
+	face := b.Cards[first].Face
+	for i, f := range a.known {
+		if i != first && f == face {
+			return i
+		}
+	}
+	return a.unknown(b, first)
+}
+
+func (a *AI) forget_matched(b *Board) {
+	for i := range a.known {
+		if b.Cards[i].Matched {
+			delete(a.known, i)
+		}
+	}
+}
+
+// unknown picks a random unmatched card other than not, preferring ones it
+// doesn't remember.
+func (a *AI) unknown(b *Board, not int) int {
+	var fresh, any []int
+	for i, c := range b.Cards {
+		if c.Matched || i == not {
+			continue
+		}
+		any = append(any, i)
+		if _, ok := a.known[i]; !ok {
+			fresh = append(fresh, i)
+		}
+	}
+
+	if len(fresh) > 0 {
+		return fresh[a.rng.Intn(len(fresh))]
+	}
+	return any[a.rng.Intn(len(any))]
+}
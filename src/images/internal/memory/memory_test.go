@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	b, err := New(8, 6, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := map[int]int{}
+	for _, c := range b.Cards {
+		count[c.Face]++
+	}
+	for face, n := range count {
+		if n != 2 {
+			t.Errorf("face %d dealt %d times", face, n)
+		}
+	}
+
+	if _, err := New(5, 3, rng); err == nil {
+		t.Error("dealt an odd number of cards")
+	}
+	if _, err := New(9, 6, rng); err == nil {
+		t.Error("dealt a board that's too wide")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	b := &Board{Cols: 4, Rows: 3, Cards: make([]Card, 12)}
+
+	for coord, want := range map[string]int{"a1": 0, "A4": 3, "b1": 4, "c4": 11} {
+		if i, err := b.Index(coord); err != nil || i != want {
+			t.Errorf("Index(%q) = %d, %v; want %d", coord, i, err, want)
+		}
+		if name := b.Name(want); !strings.EqualFold(name, coord) {
+			t.Errorf("Name(%d) = %s, want %s", want, name, coord)
+		}
+	}
+	for _, bad := range []string{"d1", "a5", "a0", "zz", "a"} {
+		if _, err := b.Index(bad); err == nil {
+			t.Errorf("Index(%q) accepted", bad)
+		}
+	}
+}
+
+func TestFlip(t *testing.T) {
+	b := &Board{Cols: 2, Rows: 2, Cards: []Card{{Face: 1}, {Face: 2}, {Face: 1}, {Face: 2}}}
+
+	if match, err := b.Flip(0, 1); match || err != nil {
+		t.Errorf("0 and 1 differ but got %v, %v", match, err)
+	}
+	if _, err := b.Flip(0, 0); err != ErrSame {
+		t.Errorf("flipping one card twice: %v", err)
+	}
+	if match, _ := b.Flip(0, 2); !match || !b.Cards[0].Matched {
+		t.Error("0 and 2 should match and stay up")
+	}
+	if _, err := b.Flip(2, 1); err != ErrMatched {
+		t.Errorf("flipping a matched card: %v", err)
+	}
+	if b.Done() {
+		t.Error("done with a pair left")
+	}
+	b.Flip(1, 3)
+	if !b.Done() {
+		t.Error("not done with every pair found")
+	}
+}
+
+func TestPerfectAI(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	b, _ := New(8, 6, rng)
+	ai := NewAI(100, rng)
+
+	// With perfect recall no card needs to be seen more than twice, so the
+	// board is cleared in well under one turn per card.
+	turns := 0
+	for !b.Done() {
+		turns++
+		i := ai.First(b)
+		ai.Saw(i, b.Cards[i].Face)
+		j := ai.Second(b, i)
+		ai.Saw(j, b.Cards[j].Face)
+
+		if _, err := b.Flip(i, j); err != nil {
+			t.Fatalf("AI made an illegal flip: %v", err)
+		}
+		if turns > len(b.Cards) {
+			t.Fatal("AI failed to finish")
+		}
+	}
+}
@@ -0,0 +1,223 @@
+// Package policy decides which hosts a server may fetch images from, and
+// which content types it accepts from them.
+//
+// A policy file has a rule a line:
+//
+//	# Only imgur and the artifact store, and no SVG anywhere.
+//	allow host *.imgur.com
+//	allow host artifacts.corp.example:8443
+//	deny host 10.0.0.0/8
+//	allow type image/*
+//	deny type image/svg+xml
+//
+// A host or type that matches a deny rule is refused. Otherwise, if there
+// are allow rules of its kind, it has to match one of them.
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// A Policy is never changed once made, so it's safe for concurrent use.
+// The nil Policy allows everything.
+type Policy struct {
+	hosts []host_rule
+	types []type_rule
+}
+
+// A host_rule matches either names, by glob, or IP addresses, by range.
+// A name glob like *.example.com takes in every subdomain of
+// example.com, however deep, but not example.com itself. A rule without
+// a port matches any port.
+type host_rule struct {
+	allow bool
+	glob  string
+	ips   netip.Prefix
+	port  string
+}
+
+type type_rule struct {
+	allow bool
+	glob  string
+}
+
+// Load reads a policy from the file at path.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a policy. Blank lines and ones starting with # are left
+// out.
+func Parse(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		f := strings.Fields(line)
+		if len(f) != 3 || f[0] != "allow" && f[0] != "deny" {
+			return nil, fmt.Errorf("line %d: want allow|deny host|type PATTERN, got %q", n, line)
+		}
+		allow := f[0] == "allow"
+
+		switch f[1] {
+		case "host":
+			rule, err := parse_host(f[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			rule.allow = allow
+			p.hosts = append(p.hosts, rule)
+		case "type":
+			glob := strings.ToLower(f[2])
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("line %d: bad type pattern %q", n, f[2])
+			}
+			p.types = append(p.types, type_rule{allow, glob})
+		default:
+			return nil, fmt.Errorf("line %d: %q is neither host nor type", n, f[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parse_host reads a host pattern: a name glob, an IP address or a CIDR
+// range, any of them but a range followed by a port. IPv6 addresses take
+// brackets when they have a port, as in URLs.
+func parse_host(s string) (host_rule, error) {
+	if strings.Contains(s, "/") {
+		ips, err := netip.ParsePrefix(s)
+		if err != nil {
+			return host_rule{}, fmt.Errorf("bad address range %q", s)
+		}
+		return host_rule{ips: unmap(ips).Masked()}, nil
+	}
+
+	var rule host_rule
+	host := s
+	if h, port, err := net.SplitHostPort(s); err == nil {
+		host, rule.port = h, port
+	}
+	if strings.HasPrefix(host, "[") {
+		if !strings.HasSuffix(host, "]") {
+			return host_rule{}, fmt.Errorf("bad host pattern %q", s)
+		}
+		host = host[1 : len(host)-1]
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if a, err := netip.ParseAddr(host); err == nil {
+		rule.ips = netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen())
+		return rule, nil
+	}
+	if _, err := path.Match(host, ""); err != nil || host == "" {
+		return host_rule{}, fmt.Errorf("bad host pattern %q", s)
+	}
+	rule.glob = host
+	return rule, nil
+}
+
+func unmap(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p
+}
+
+// default_ports are what a URL's port is without one written.
+var default_ports = map[string]string{"http": "80", "https": "443"}
+
+// Host reports whether the policy allows fetching u.
+func (p *Policy) Host(u *url.URL) bool {
+	if p == nil {
+		return true
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == "" {
+		port = default_ports[u.Scheme]
+	}
+	addr, err := netip.ParseAddr(host)
+	is_ip := err == nil
+
+	matches := func(r host_rule) bool {
+		if r.port != "" && r.port != port {
+			return false
+		}
+		if is_ip {
+			return r.ips.IsValid() && r.ips.Contains(addr.Unmap())
+		}
+		ok, _ := path.Match(r.glob, host)
+		return r.glob != "" && ok
+	}
+
+	allowed, allows := false, false
+	for _, r := range p.hosts {
+		switch {
+		case !matches(r):
+		case !r.allow:
+			return false
+		default:
+			allowed = true
+		}
+		allows = allows || r.allow
+	}
+	return allowed || !allows
+}
+
+// Type reports whether the policy allows a response whose Content-Type
+// header is content_type. Its parameters, like a charset, don't count.
+// A response without one only passes a policy with no type to allow.
+func (p *Policy) Type(content_type string) bool {
+	if p == nil {
+		return true
+	}
+
+	kind, _, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		kind = ""
+	}
+
+	allowed, allows := false, false
+	for _, r := range p.types {
+		ok, _ := path.Match(r.glob, kind)
+		switch {
+		case !ok || kind == "":
+		case !r.allow:
+			return false
+		default:
+			allowed = true
+		}
+		allows = allows || r.allow
+	}
+	return allowed || !allows
+}
+
+// Rules counts the policy's host and type rules.
+func (p *Policy) Rules() (hosts, types int) {
+	if p == nil {
+		return 0, 0
+	}
+	return len(p.hosts), len(p.types)
+}
@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, rules string) *Policy {
+	t.Helper()
+	p, err := Parse(strings.NewReader(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestHost(t *testing.T) {
+	p := parse(t, `
+		# Imgur, the artifact store on its one port, and the lab's range.
+		allow host *.imgur.com
+		allow host Artifacts.Corp.Example:8443
+		allow host 192.0.2.0/24
+		allow host [2001:db8::1]:8080
+		deny host bad.imgur.com
+		deny host 192.0.2.66
+	`)
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://i.imgur.com/a.png", true},
+		{"https://a.b.imgur.com/a.png", true},
+		{"https://I.IMGUR.COM./a.png", true},
+		{"https://i.imgur.com:8443/a.png", true},
+		{"https://imgur.com/a.png", false},
+		{"https://notimgur.com/a.png", false},
+		{"https://imgur.com.evil.example/a.png", false},
+		{"https://bad.imgur.com/a.png", false},
+		{"https://bad.imgur.com:444/a.png", false},
+		{"https://artifacts.corp.example:8443/a.png", true},
+		{"https://artifacts.corp.example/a.png", false},
+		{"http://artifacts.corp.example:80/a.png", false},
+		{"http://192.0.2.7/a.png", true},
+		{"http://192.0.2.7:9000/a.png", true},
+		{"http://192.0.2.66/a.png", false},
+		{"http://[::ffff:192.0.2.7]/a.png", true},
+		{"http://192.0.3.1/a.png", false},
+		{"http://[2001:db8::1]:8080/a.png", true},
+		{"http://[2001:db8::1]/a.png", false},
+		{"http://[2001:db8::2]:8080/a.png", false},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Host(u); got != tt.want {
+			t.Errorf("Host(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestHostDefaultPorts(t *testing.T) {
+	p := parse(t, "allow host example.com:443")
+
+	for url_string, want := range map[string]bool{
+		"https://example.com/":    true,
+		"http://example.com/":     false,
+		"http://example.com:443/": true,
+	} {
+		u, _ := url.Parse(url_string)
+		if got := p.Host(u); got != want {
+			t.Errorf("Host(%s) = %v, want %v", url_string, got, want)
+		}
+	}
+}
+
+func TestHostDenyOnly(t *testing.T) {
+	p := parse(t, "deny host *.internal\ndeny host 127.0.0.0/8\ndeny host ::1")
+
+	for url_string, want := range map[string]bool{
+		"http://example.com/":        true,
+		"http://printer.internal/":   false,
+		"http://127.0.0.1:8000/":     false,
+		"http://[::1]/":              false,
+		"http://internal/":           true,
+		"http://203.0.113.9/":        true,
+		"http://[::ffff:127.0.0.1]/": false,
+	} {
+		u, _ := url.Parse(url_string)
+		if got := p.Host(u); got != want {
+			t.Errorf("Host(%s) = %v, want %v", url_string, got, want)
+		}
+	}
+}
+
+func TestType(t *testing.T) {
+	p := parse(t, "allow type image/*\ndeny type image/svg+xml")
+
+	for kind, want := range map[string]bool{
+		"image/png":                    true,
+		"IMAGE/JPEG":                   true,
+		"image/webp; q=0.9":            true,
+		"image/svg+xml":                false,
+		"image/svg+xml; charset=utf-8": false,
+		"text/html":                    false,
+		"":                             false,
+		"nonsense;;":                   false,
+	} {
+		if got := p.Type(kind); got != want {
+			t.Errorf("Type(%q) = %v, want %v", kind, got, want)
+		}
+	}
+
+	// Refusing only SVG lets untyped responses through.
+	p = parse(t, "deny type image/svg+xml")
+	if !p.Type("") || !p.Type("application/octet-stream") || p.Type("image/svg+xml") {
+		t.Error("a deny-only type policy should refuse only what it names")
+	}
+}
+
+func TestNilAllowsEverything(t *testing.T) {
+	var p *Policy
+	u, _ := url.Parse("http://anything.example/")
+	if !p.Host(u) || !p.Type("text/html") {
+		t.Error("the nil policy refused something")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, rules := range []string{
+		"allow host",
+		"permit host example.com",
+		"allow hosts example.com",
+		"allow host 10.0.0.0/33",
+		"allow host [bad",
+		"allow type image/[",
+		"allow host example.com extra",
+	} {
+		if _, err := Parse(strings.NewReader(rules)); err == nil {
+			t.Errorf("Parse(%q) took it", rules)
+		}
+	}
+}
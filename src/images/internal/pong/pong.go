@@ -0,0 +1,124 @@
+// Package pong implements the court, paddles and ball physics of Pong.
+// The game advances one fixed tick per Step; scheduling ticks, reading
+// input and drawing frames are the caller's job.
+package pong
+
+import "math/rand"
+
+const (
+	PaddleHeight = 4
+
+	serveSpeed = 0.7
+	// Each return speeds the ball up a little, but it never moves more
+	// than a column per tick so it can't skip through a paddle.
+	speedUp  = 1.05
+	maxSpeed = 1.0
+	// How much hitting the edge of a paddle angles the return.
+	english = 0.35
+)
+
+type Game struct {
+	Width, Height int
+
+	// Paddles holds the top row of the left and right paddle.
+	Paddles [2]float64
+
+	BallX, BallY float64
+	VX, VY       float64
+
+	Score [2]int
+
+	rng *rand.Rand
+}
+
+// New sets up a court with both paddles centred and the ball served to a
+// random side.
+func New(width, height int, rng *rand.Rand) *Game {
+	g := &Game{Width: width, Height: height, rng: rng}
+
+	mid := float64(height-PaddleHeight) / 2
+	g.Paddles = [2]float64{mid, mid}
+
+	g.serve(rng.Intn(2))
+	return g
+}
+
+// PaddleColumn returns the column player p's paddle occupies.
+func (g *Game) PaddleColumn(p int) int {
+	if p == 0 {
+		return 1
+	}
+	return g.Width - 2
+}
+
+// MovePaddle moves player p's paddle by dy rows, keeping it on the court.
+func (g *Game) MovePaddle(p int, dy float64) {
+	g.Paddles[p] = min(max(g.Paddles[p]+dy, 0), float64(g.Height-PaddleHeight))
+}
+
+// Covers reports whether player p's paddle is in the way of row y.
+func (g *Game) Covers(p int, y float64) bool {
+	row := int(y + 0.5)
+	top := int(g.Paddles[p] + 0.5)
+	return row >= top && row < top+PaddleHeight
+}
+
+// Step advances the ball by one tick. It returns the player who scored, or
+// -1 if the ball is still in play.
+func (g *Game) Step() int {
+	x := g.BallX + g.VX
+	y := g.BallY + g.VY
+
+	bottom := float64(g.Height - 1)
+	if y < 0 {
+		y, g.VY = -y, -g.VY
+	} else if y > bottom {
+		y, g.VY = 2*bottom-y, -g.VY
+	}
+
+	// A paddle only gets one chance at the ball: the tick it crosses the
+	// paddle's face. Once past, it's a point.
+	left := float64(g.PaddleColumn(0) + 1)
+	right := float64(g.PaddleColumn(1) - 1)
+
+	switch {
+	case g.VX < 0 && g.BallX >= left && x < left && g.Covers(0, y):
+		x = 2*left - x
+		g.bounce(0, y)
+	case g.VX > 0 && g.BallX <= right && x > right && g.Covers(1, y):
+		x = 2*right - x
+		g.bounce(1, y)
+	case x < 0:
+		g.Score[1]++
+		g.serve(0)
+		return 1
+	case x > float64(g.Width-1):
+		g.Score[0]++
+		g.serve(1)
+		return 0
+	}
+
+	g.BallX, g.BallY = x, y
+	return -1
+}
+
+func (g *Game) bounce(p int, y float64) {
+	g.VX = -g.VX * speedUp
+	g.VX = min(max(g.VX, -maxSpeed), maxSpeed)
+
+	centre := g.Paddles[p] + float64(PaddleHeight-1)/2
+	offset := (y - centre) / (float64(PaddleHeight) / 2)
+	g.VY = min(max(g.VY+offset*english, -maxSpeed), maxSpeed)
+}
+
+// serve puts the ball back in the middle heading towards player p.
+func (g *Game) serve(p int) {
+	g.BallX = float64(g.Width-1) / 2
+	g.BallY = float64(g.Height-1) / 2
+
+	g.VX = serveSpeed
+	if p == 0 {
+		g.VX = -serveSpeed
+	}
+	g.VY = (g.rng.Float64() - 0.5) * serveSpeed
+}
@@ -0,0 +1,80 @@
+package pong
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func game() *Game {
+	return New(40, 20, rand.New(rand.NewSource(1)))
+}
+
+func TestWallBounce(t *testing.T) {
+	g := game()
+	g.BallX, g.BallY = 20, 0.2
+	g.VX, g.VY = 0.5, -0.5
+
+	g.Step()
+	if g.VY <= 0 || g.BallY < 0 {
+		t.Fatalf("ball left the court through the top: y=%v vy=%v", g.BallY, g.VY)
+	}
+}
+
+func TestPaddleReturn(t *testing.T) {
+	g := game()
+	g.Paddles[0] = 8
+	g.BallX, g.BallY = 2.3, 9.5
+	g.VX, g.VY = -0.7, 0
+
+	if scored := g.Step(); scored != -1 {
+		t.Fatalf("point scored through a paddle: %d", scored)
+	}
+	if g.VX <= 0 {
+		t.Fatalf("ball not returned: vx=%v", g.VX)
+	}
+}
+
+func TestMissScores(t *testing.T) {
+	g := game()
+	g.Paddles[0] = 0
+	g.BallX, g.BallY = 2.3, 15
+	g.VX, g.VY = -0.7, 0
+
+	for range 10 {
+		if scored := g.Step(); scored != -1 {
+			if scored != 1 || g.Score != [2]int{0, 1} {
+				t.Fatalf("wrong point: scored=%d score=%v", scored, g.Score)
+			}
+			return
+		}
+	}
+	t.Fatal("ball never went out")
+}
+
+func TestNoLateSave(t *testing.T) {
+	g := game()
+	g.Paddles[0] = 0
+	g.BallX, g.BallY = 2.3, 10
+	g.VX, g.VY = -0.7, 0
+
+	g.Step()
+	// The ball is past the paddle face now; moving the paddle behind it
+	// must not bring it back.
+	g.Paddles[0] = 8
+	g.Step()
+	if g.VX > 0 {
+		t.Fatal("paddle returned a ball that had already passed it")
+	}
+}
+
+func TestPaddleStaysOnCourt(t *testing.T) {
+	g := game()
+	g.MovePaddle(1, -100)
+	if g.Paddles[1] != 0 {
+		t.Errorf("paddle above the court: %v", g.Paddles[1])
+	}
+	g.MovePaddle(1, 100)
+	if g.Paddles[1] != float64(g.Height-PaddleHeight) {
+		t.Errorf("paddle below the court: %v", g.Paddles[1])
+	}
+}
@@ -0,0 +1,234 @@
+// Package profiles keeps registered nicknames: a password hash for each,
+// the settings its owner wants on logging in, and what they've played.
+// Like the leaderboards, it can be saved to a JSON file so it outlives
+// the server.
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+)
+
+// Passwords are bounded by what bcrypt takes: it ignores anything past
+// 72 bytes, so longer ones are refused rather than silently cut short.
+const (
+	MinPassword = 8
+	MaxPassword = 72
+)
+
+var (
+	ErrTaken    = errors.New("that nickname is registered already")
+	ErrUnknown  = errors.New("that nickname isn't registered")
+	ErrWrong    = errors.New("wrong password")
+	ErrPassword = fmt.Errorf("passwords are %d-%d bytes", MinPassword, MaxPassword)
+)
+
+// A Profile is one registered nickname. Settings are kept as the server
+// saved them, without the store looking inside.
+type Profile struct {
+	Hash      []byte          `json:"hash"`
+	Created   time.Time       `json:"created"`
+	Logins    int             `json:"logins"`
+	LastLogin time.Time       `json:"last_login"`
+	Settings  json.RawMessage `json:"settings,omitempty"`
+
+	// Plays counts the owner's finished games, by leaderboard name.
+	Plays map[string]int `json:"plays,omitempty"`
+}
+
+// A Store is safe for concurrent use. If it has a path, every change is
+// written straight back to it.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	profiles map[string]*Profile
+
+	// cost is bcrypt's, lowered by the tests.
+	cost int
+}
+
+// Open loads the profiles saved at path, or starts with none if there is
+// no file yet; an empty path keeps them in memory only. A file that can't
+// be read as profiles is moved aside rather than lost, and the name it
+// was moved to is returned.
+func Open(path string) (s *Store, backup string, err error) {
+	s = &Store{path: path, profiles: map[string]*Profile{}, cost: bcrypt.DefaultCost}
+	if path == "" {
+		return s, "", nil
+	}
+
+	backup, err = atomicfile.Load(path, func(data []byte) error {
+		if err := json.Unmarshal(data, &s.profiles); err != nil {
+			return err
+		}
+		if !s.valid() {
+			return errors.New("invalid profiles")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if backup != "" {
+		s.profiles = map[string]*Profile{}
+	}
+	return s, backup, nil
+}
+
+// valid checks a freshly loaded file hangs together.
+func (s *Store) valid() bool {
+	if s.profiles == nil {
+		return false
+	}
+	for nick, p := range s.profiles {
+		if p == nil || !leaderboard.ValidNick(nick) {
+			return false
+		}
+		if _, err := bcrypt.Cost(p.Hash); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Register makes nick its own, under password.
+func (s *Store) Register(nick, password string) error {
+	if !leaderboard.ValidNick(nick) {
+		return leaderboard.ErrNick
+	}
+	if len(password) < MinPassword || len(password) > MaxPassword {
+		return ErrPassword
+	}
+	if s.Registered(nick) {
+		return ErrTaken
+	}
+
+	// Hashing is slow on purpose, so it's done without holding the lock.
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.profiles[nick] != nil {
+		return ErrTaken
+	}
+	now := time.Now()
+	s.profiles[nick] = &Profile{Hash: hash, Created: now, Logins: 1, LastLogin: now}
+	return s.save()
+}
+
+// Login checks password is nick's, and counts the login if it is. The
+// profile it returns has no hash.
+func (s *Store) Login(nick, password string) (Profile, error) {
+	s.mu.Lock()
+	p := s.profiles[nick]
+	var hash []byte
+	if p != nil {
+		hash = p.Hash
+	}
+	s.mu.Unlock()
+
+	if hash == nil {
+		return Profile{}, ErrUnknown
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return Profile{}, ErrWrong
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.Logins++
+	p.LastLogin = time.Now()
+	return p.public(), s.save()
+}
+
+// Registered reports whether nick has an owner.
+func (s *Store) Registered(nick string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.profiles[nick] != nil
+}
+
+// Get returns nick's profile, without its hash.
+func (s *Store) Get(nick string) (Profile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.profiles[nick]
+	if p == nil {
+		return Profile{}, false
+	}
+	return p.public(), true
+}
+
+// SetSettings keeps settings to be applied when nick logs in.
+func (s *Store) SetSettings(nick string, settings json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.profiles[nick]
+	if p == nil {
+		return ErrUnknown
+	}
+	p.Settings = append(json.RawMessage(nil), settings...)
+	return s.save()
+}
+
+// AddPlay counts a finished game of game for nick.
+func (s *Store) AddPlay(nick, game string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.profiles[nick]
+	if p == nil {
+		return ErrUnknown
+	}
+	if p.Plays == nil {
+		p.Plays = map[string]int{}
+	}
+	p.Plays[game]++
+	return s.save()
+}
+
+// public is a copy of p to hand out: no hash, and nothing shared that the
+// store goes on changing. It's called with s.mu held.
+func (p *Profile) public() Profile {
+	out := *p
+	out.Hash = nil
+	out.Settings = append(json.RawMessage(nil), p.Settings...)
+	out.Plays = make(map[string]int, len(p.Plays))
+	for game, n := range p.Plays {
+		out.Plays[game] = n
+	}
+	return out
+}
+
+// save writes the store to a temporary file beside its own and renames
+// it into place, so a crash mid-write leaves the old profiles intact.
+// The file holds password hashes, so only the server may read it. It's
+// called with s.mu held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.profiles, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(s.path, data, 0o600)
+}
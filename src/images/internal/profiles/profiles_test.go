@@ -0,0 +1,207 @@
+package profiles
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+
+	s, backup, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup != "" {
+		t.Fatalf("unexpected backup to %s", backup)
+	}
+	s.cost = bcrypt.MinCost
+	return s
+}
+
+// compact is settings without the indentation saving gives them.
+func compact(settings json.RawMessage) string {
+	var b bytes.Buffer
+	json.Compact(&b, settings)
+	return b.String()
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := open(t, "")
+
+	if err := s.Register("ann", "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Registered("ann") || s.Registered("bob") {
+		t.Error("registered the wrong nicknames")
+	}
+	if err := s.Register("ann", "something else"); !errors.Is(err, ErrTaken) {
+		t.Errorf("registering twice: %v", err)
+	}
+
+	p, err := s.Login("ann", "hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Logins != 2 || p.Hash != nil {
+		t.Errorf("logged in to %+v", p)
+	}
+	if _, err := s.Login("ann", "hunter23"); !errors.Is(err, ErrWrong) {
+		t.Errorf("wrong password: %v", err)
+	}
+	if _, err := s.Login("bob", "hunter22"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("unregistered nickname: %v", err)
+	}
+	if p, _ := s.Get("ann"); p.Logins != 2 {
+		t.Errorf("a wrong password was counted as a login: %d", p.Logins)
+	}
+}
+
+func TestRefusals(t *testing.T) {
+	s := open(t, "")
+
+	for _, c := range []struct{ nick, password string }{
+		{"ann", "short"},
+		{"ann", string(bytes.Repeat([]byte("x"), MaxPassword+1))},
+		{"no spaces", "hunter22"},
+		{"", "hunter22"},
+	} {
+		if err := s.Register(c.nick, c.password); err == nil {
+			t.Errorf("registered %q with a %d-byte password", c.nick, len(c.password))
+		}
+	}
+	if err := s.Register("ann", string(bytes.Repeat([]byte("x"), MaxPassword))); err != nil {
+		t.Errorf("longest password: %v", err)
+	}
+}
+
+func TestSettingsAndPlays(t *testing.T) {
+	s := open(t, "")
+	s.Register("ann", "hunter22")
+
+	if err := s.SetSettings("ann", json.RawMessage(`{"width":80}`)); err != nil {
+		t.Fatal(err)
+	}
+	s.AddPlay("ann", "2048")
+	s.AddPlay("ann", "2048")
+	s.AddPlay("ann", "snake")
+
+	p, _ := s.Get("ann")
+	if string(p.Settings) != `{"width":80}` || p.Plays["2048"] != 2 || p.Plays["snake"] != 1 {
+		t.Errorf("profile %+v", p)
+	}
+
+	// What's handed out is a copy.
+	p.Plays["2048"] = 99
+	if p, _ := s.Get("ann"); p.Plays["2048"] != 2 {
+		t.Error("changing a returned profile changed the store")
+	}
+
+	if err := s.AddPlay("bob", "2048"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("play for an unregistered nickname: %v", err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+
+	s := open(t, path)
+	s.Register("ann", "hunter22")
+	s.SetSettings("ann", json.RawMessage(`{"mode":"bw"}`))
+	s.AddPlay("ann", "chess")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter22")) {
+		t.Error("the password was saved as it was typed")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("profiles saved readable by others: %v", info.Mode())
+	}
+
+	s = open(t, path)
+	if _, err := s.Login("ann", "hunter22"); err != nil {
+		t.Errorf("login after reopening: %v", err)
+	}
+	if p, _ := s.Get("ann"); compact(p.Settings) != `{"mode":"bw"}` || p.Plays["chess"] != 1 {
+		t.Errorf("profile after reopening: %+v", p)
+	}
+
+	leftovers, _ := filepath.Glob(path + ".tmp-*")
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, contents := range map[string]string{
+		"garbage":  "{not json",
+		"wrong":    `["a", "list"]`,
+		"bad hash": `{"ann": {"hash": "bm90IGEgaGFzaA=="}}`,
+		"bad nick": `{"no spaces": {"hash": null}}`,
+	} {
+		path := filepath.Join(dir, "profiles.json")
+		os.WriteFile(path, []byte(contents), 0o600)
+
+		s, backup, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if s.Registered("ann") {
+			t.Errorf("%s: kept a profile", name)
+		}
+		saved, err := os.ReadFile(backup)
+		if err != nil || string(saved) != contents {
+			t.Errorf("%s: backup %q holds %q, %v", name, backup, saved, err)
+		}
+		os.Remove(backup)
+
+		// The fresh store can still be written to.
+		s.cost = bcrypt.MinCost
+		if err := s.Register("ann", "hunter22"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		os.Remove(path)
+	}
+}
+
+func TestConcurrentRegistration(t *testing.T) {
+	s := open(t, filepath.Join(t.TempDir(), "profiles.json"))
+
+	var wg sync.WaitGroup
+	won := make(chan string, 10)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			password := "password" + string(rune('0'+i))
+			if s.Register("ann", password) == nil {
+				won <- password
+			}
+		}()
+	}
+	wg.Wait()
+	close(won)
+
+	var winners []string
+	for w := range won {
+		winners = append(winners, w)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("%d registrations of one nickname went through", len(winners))
+	}
+	if _, err := s.Login("ann", winners[0]); err != nil {
+		t.Errorf("the winner can't log in: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+// Package puzzle implements the sliding-tile puzzle: an NxN grid with one
+// square missing, solved by sliding tiles into the gap until they are back
+// in order.
+package puzzle
+
+import (
+	"errors"
+	"math/rand"
+)
+
+const (
+	MinSize = 3
+	MaxSize = 5
+)
+
+type Dir int
+
+// A direction is the way a tile moves: Up slides the tile below the gap
+// up into it.
+const (
+	Up Dir = iota
+	Down
+	Left
+	Right
+)
+
+// A Puzzle holds the tile at each position, row by row. Tiles are
+// numbered from 1 in the order they belong; 0 is the gap, which belongs
+// in the bottom-right corner.
+type Puzzle struct {
+	N     int
+	Tiles []int
+	Moves int
+}
+
+var ErrSize = errors.New("puzzles are 3x3, 4x4 or 5x5")
+
+// Solved returns an NxN puzzle with every tile in place.
+func Solved(n int) (*Puzzle, error) {
+	if n < MinSize || n > MaxSize {
+		return nil, ErrSize
+	}
+
+	p := &Puzzle{N: n, Tiles: make([]int, n*n)}
+	for i := range n*n - 1 {
+		p.Tiles[i] = i + 1
+	}
+	return p, nil
+}
+
+// Scramble returns an NxN puzzle in a random order that can be solved
+// and isn't already.
+func Scramble(n int, rng *rand.Rand) (*Puzzle, error) {
+	p, err := Solved(n)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.Done() || !p.Solvable() {
+		rng.Shuffle(len(p.Tiles), func(i, j int) { p.Tiles[i], p.Tiles[j] = p.Tiles[j], p.Tiles[i] })
+
+		// Half of all orders can't be solved; swapping any two tiles
+		// flips that, so there's no need to shuffle again.
+		if !p.Solvable() {
+			a, b := 0, 1
+			if p.Tiles[a] == 0 {
+				a = 2
+			} else if p.Tiles[b] == 0 {
+				b = 2
+			}
+			p.Tiles[a], p.Tiles[b] = p.Tiles[b], p.Tiles[a]
+		}
+	}
+	return p, nil
+}
+
+// Solvable reports whether the tiles can be slid back into order. Every
+// slide keeps the parity of the inversions (pairs of tiles out of order)
+// on odd boards, and on even boards ties it to the gap's row.
+func (p *Puzzle) Solvable() bool {
+	inversions := 0
+	for i, a := range p.Tiles {
+		for _, b := range p.Tiles[i+1:] {
+			if a != 0 && b != 0 && a > b {
+				inversions++
+			}
+		}
+	}
+
+	if p.N%2 == 1 {
+		return inversions%2 == 0
+	}
+	rows_below := p.N - 1 - p.Gap()/p.N
+	return (inversions+rows_below)%2 == 0
+}
+
+func (p *Puzzle) Gap() int {
+	for i, t := range p.Tiles {
+		if t == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Done reports whether every tile is back in place.
+func (p *Puzzle) Done() bool {
+	for i, t := range p.Tiles[:len(p.Tiles)-1] {
+		if t != i+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Slide moves a tile into the gap in direction d, reporting whether there
+// was a tile to move.
+func (p *Puzzle) Slide(d Dir) bool {
+	gap := p.Gap()
+	r, c := gap/p.N, gap%p.N
+
+	// The tile that moves is on the opposite side of the gap.
+	switch d {
+	case Up:
+		r++
+	case Down:
+		r--
+	case Left:
+		c++
+	case Right:
+		c--
+	}
+	if r < 0 || c < 0 || r >= p.N || c >= p.N {
+		return false
+	}
+
+	from := r*p.N + c
+	p.Tiles[gap], p.Tiles[from] = p.Tiles[from], 0
+	p.Moves++
+	return true
+}
+
+// SlideTile moves tile t into the gap, if it is next to it.
+func (p *Puzzle) SlideTile(t int) bool {
+	gap := p.Gap()
+	for i, tile := range p.Tiles {
+		if tile != t || t == 0 {
+			continue
+		}
+
+		switch {
+		case i == gap+p.N:
+			return p.Slide(Up)
+		case i == gap-p.N:
+			return p.Slide(Down)
+		case i == gap+1 && i%p.N != 0:
+			return p.Slide(Left)
+		case i == gap-1 && gap%p.N != 0:
+			return p.Slide(Right)
+		}
+	}
+	return false
+}
+
+// Estimate is a lower bound on the moves left: each tile's distance from
+// home, plus two for every pair in their home row or column that have to
+// pass each other to get there.
+func (p *Puzzle) Estimate() int {
+	n, total := p.N, 0
+
+	home := func(t int) (int, int) { return (t - 1) / n, (t - 1) % n }
+	abs := func(x int) int { return max(x, -x) }
+
+	for i, t := range p.Tiles {
+		if t == 0 {
+			continue
+		}
+		r, c := home(t)
+		total += abs(r-i/n) + abs(c-i%n)
+	}
+
+	for i, a := range p.Tiles {
+		for j := i + 1; j < len(p.Tiles); j++ {
+			b := p.Tiles[j]
+			if a == 0 || b == 0 {
+				continue
+			}
+			ar, ac := home(a)
+			br, bc := home(b)
+
+			same_row := i/n == j/n && ar == i/n && br == i/n
+			same_col := i%n == j%n && ac == i%n && bc == i%n
+			if same_row && ac > bc || same_col && ar > br {
+				total += 2
+			}
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,138 @@
+package puzzle
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func puzzle(n int, tiles ...int) *Puzzle {
+	return &Puzzle{N: n, Tiles: tiles}
+}
+
+func TestSolvable(t *testing.T) {
+	for _, c := range []struct {
+		p    *Puzzle
+		want bool
+	}{
+		{puzzle(3, 1, 2, 3, 4, 5, 6, 7, 8, 0), true},
+		{puzzle(3, 1, 2, 3, 4, 5, 6, 8, 7, 0), false},
+		{puzzle(3, 1, 2, 3, 4, 5, 6, 7, 0, 8), true},
+		{puzzle(3, 0, 1, 3, 4, 2, 5, 7, 8, 6), true},
+
+		// On even boards the gap's row counts too.
+		{puzzle(4, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 0), true},
+		{puzzle(4, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 15, 14, 0), false},
+		{puzzle(4, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0, 13, 14, 15, 12), true},
+		{puzzle(4, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 0, 13, 14, 15), true},
+	} {
+		if got := c.p.Solvable(); got != c.want {
+			t.Errorf("%v: Solvable() = %v", c.p.Tiles, got)
+		}
+	}
+}
+
+func TestScramble(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for n := MinSize; n <= MaxSize; n++ {
+		for range 50 {
+			p, err := Scramble(n, rng)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Done() || !p.Solvable() {
+				t.Fatalf("bad scramble %v", p.Tiles)
+			}
+
+			seen := map[int]bool{}
+			for _, tile := range p.Tiles {
+				seen[tile] = true
+			}
+			if len(seen) != n*n {
+				t.Fatalf("scramble lost tiles: %v", p.Tiles)
+			}
+		}
+	}
+
+	if _, err := Scramble(6, rng); err != ErrSize {
+		t.Errorf("6x6: %v", err)
+	}
+}
+
+// A random walk from the solved puzzle is always solvable, and always
+// takes at least Estimate moves to undo.
+func TestWalks(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+
+	for n := MinSize; n <= MaxSize; n++ {
+		p, _ := Solved(n)
+		for range 500 {
+			p.Slide(Dir(rng.Intn(4)))
+			if !p.Solvable() {
+				t.Fatalf("%v isn't solvable after a slide", p.Tiles)
+			}
+			if p.Estimate() > p.Moves {
+				t.Fatalf("estimate %d for %v after only %d moves", p.Estimate(), p.Tiles, p.Moves)
+			}
+		}
+	}
+}
+
+func TestSlide(t *testing.T) {
+	p, _ := Solved(3)
+
+	if p.Slide(Up) || p.Slide(Left) {
+		t.Error("slid a tile in from off the board")
+	}
+	if !p.Slide(Down) || p.Tiles[8] != 6 || p.Tiles[5] != 0 {
+		t.Errorf("after Down: %v", p.Tiles)
+	}
+	if !p.Slide(Right) || p.Tiles[5] != 5 || p.Tiles[4] != 0 {
+		t.Errorf("after Right: %v", p.Tiles)
+	}
+	if p.Moves != 2 {
+		t.Errorf("%d moves counted", p.Moves)
+	}
+
+	p.Slide(Left)
+	p.Slide(Up)
+	if !p.Done() {
+		t.Errorf("not done after undoing: %v", p.Tiles)
+	}
+}
+
+func TestSlideTile(t *testing.T) {
+	p := puzzle(3, 1, 2, 3, 4, 0, 5, 6, 7, 8)
+
+	for _, far := range []int{1, 3, 6, 8, 0} {
+		if p.SlideTile(far) {
+			t.Errorf("slid %d, which isn't next to the gap", far)
+		}
+	}
+	if !p.SlideTile(5) || p.Tiles[4] != 5 || p.Tiles[5] != 0 {
+		t.Errorf("after sliding 5: %v", p.Tiles)
+	}
+
+	// 6 is at the start of the next row: next to the gap in the list but
+	// not on the board.
+	if p.SlideTile(6) {
+		t.Errorf("slid 6 round the edge: %v", p.Tiles)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	for _, c := range []struct {
+		p    *Puzzle
+		want int
+	}{
+		{puzzle(3, 1, 2, 3, 4, 5, 6, 7, 8, 0), 0},
+		{puzzle(3, 1, 2, 3, 4, 5, 6, 7, 0, 8), 1},
+		{puzzle(3, 1, 2, 3, 4, 5, 0, 7, 8, 6), 1},
+		// 2 and 1 have to pass each other in the top row.
+		{puzzle(3, 2, 1, 3, 4, 5, 6, 7, 8, 0), 4},
+	} {
+		if got := c.p.Estimate(); got != c.want {
+			t.Errorf("%v: Estimate() = %d, want %d", c.p.Tiles, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Package quantize reduces images to a few colors by median cut.
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"slices"
+)
+
+// max_samples is how many of an image's pixels the palette is picked
+// from. Big images are sampled evenly rather than read in full; every
+// pixel is still mapped to the palette.
+const max_samples = 1 << 18
+
+// A node is a box of colors. The boxes it was split into are lo, for
+// channel ch at or below cut, and hi; a box that wasn't split is leaf
+// index in the palette, and keeps the spread of its colors.
+type node struct {
+	ch     int
+	cut    uint8
+	lo, hi *node
+	index  int
+	spread int
+}
+
+// leaf is the box c falls in.
+func (n *node) leaf(c [4]uint8) *node {
+	for n.lo != nil {
+		if c[n.ch] <= n.cut {
+			n = n.lo
+		} else {
+			n = n.hi
+		}
+	}
+	return n
+}
+
+// bayer is the 4x4 threshold map for ordered dithering.
+var bayer = [4][4]int{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// dither nudges the color of the pixel at x, y by up to half the spread
+// of its box either way, by where it falls in the threshold map, so a
+// gradient crossing from one box to the next mixes the two colors in a
+// fine pattern instead of changing all at once. Alpha is left alone.
+func (n *node) dither(c [4]uint8, x, y int) [4]uint8 {
+	spread := n.leaf(c).spread
+	d := (2*bayer[y&3][x&3] + 1 - 16) * spread / 32
+	for i := range 3 {
+		c[i] = uint8(min(max(int(c[i])+d, 0), 255))
+	}
+	return c
+}
+
+// A box also knows the channel, R, G, B or alpha, its colors spread
+// furthest along, and how far.
+type box struct {
+	colors [][4]uint8
+	node   *node
+	ch     int
+	spread int
+}
+
+func new_box(colors [][4]uint8, n *node) box {
+	b := box{colors: colors, node: n}
+	lo, hi := [4]uint8{255, 255, 255, 255}, [4]uint8{}
+	for _, c := range colors {
+		for i := range 4 {
+			lo[i], hi[i] = min(lo[i], c[i]), max(hi[i], c[i])
+		}
+	}
+	for i := range 4 {
+		if int(hi[i]-lo[i]) > b.spread {
+			b.ch, b.spread = i, int(hi[i]-lo[i])
+		}
+	}
+	return b
+}
+
+// split cuts the box in two along its widest channel at the median, or
+// as near it as ties allow; both halves get at least one color.
+func (b box) split() (box, box) {
+	ch := b.ch
+	slices.SortFunc(b.colors, func(x, y [4]uint8) int { return int(x[ch]) - int(y[ch]) })
+
+	// below is how many colors have ch below v.
+	below := func(v int) int {
+		i, _ := slices.BinarySearchFunc(b.colors, v, func(c [4]uint8, v int) int { return int(c[ch]) - v })
+		return i
+	}
+	cut := b.colors[(len(b.colors)-1)/2][ch]
+	k := below(int(cut) + 1)
+	if k == len(b.colors) {
+		// The median is the top value, so cut just under it.
+		k = below(int(cut))
+		cut = b.colors[k-1][ch]
+	}
+
+	b.node.ch, b.node.cut = ch, cut
+	b.node.lo, b.node.hi = &node{}, &node{}
+	return new_box(b.colors[:k], b.node.lo), new_box(b.colors[k:], b.node.hi)
+}
+
+func (b box) mean() color.NRGBA {
+	var sum [4]int
+	for _, c := range b.colors {
+		for i := range 4 {
+			sum[i] += int(c[i])
+		}
+	}
+	n := len(b.colors)
+	return color.NRGBA{uint8((sum[0] + n/2) / n), uint8((sum[1] + n/2) / n), uint8((sum[2] + n/2) / n), uint8((sum[3] + n/2) / n)}
+}
+
+func nrgba_at(img image.Image, x, y int) [4]uint8 {
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	return [4]uint8{c.R, c.G, c.B, c.A}
+}
+
+// Reduce returns img in at most n colors, n from 1 to 256. The box of
+// colors with the widest spread is split at its median until there are
+// n boxes or none left with more than one color in it, and each pixel
+// takes the average color of its box.
+func Reduce(img image.Image, n int) *image.Paletted {
+	return reduce(img, n, false)
+}
+
+// ReduceDithered is Reduce with ordered dithering, which suits smooth
+// gradients that would otherwise come out in bands.
+func ReduceDithered(img image.Image, n int) *image.Paletted {
+	return reduce(img, n, true)
+}
+
+func reduce(img image.Image, n int, dither bool) *image.Paletted {
+	n = min(max(n, 1), 256)
+	bounds := img.Bounds()
+	out := image.NewPaletted(bounds, nil)
+	if bounds.Empty() {
+		out.Palette = color.Palette{color.NRGBA{}}
+		return out
+	}
+
+	stride := max(1, (bounds.Dx()*bounds.Dy()+max_samples-1)/max_samples)
+	var samples [][4]uint8
+	for i := 0; i < bounds.Dx()*bounds.Dy(); i += stride {
+		samples = append(samples, nrgba_at(img, bounds.Min.X+i%bounds.Dx(), bounds.Min.Y+i/bounds.Dx()))
+	}
+
+	root := &node{}
+	boxes := []box{new_box(samples, root)}
+	for len(boxes) < n {
+		best := -1
+		for i, b := range boxes {
+			if b.spread > 0 && (best < 0 || b.spread > boxes[best].spread) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		lo, hi := boxes[best].split()
+		boxes[best] = lo
+		boxes = append(boxes, hi)
+	}
+
+	for i, b := range boxes {
+		b.node.index, b.node.spread = i, b.spread
+		out.Palette = append(out.Palette, b.mean())
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := nrgba_at(img, x, y)
+			if dither {
+				c = root.dither(c, x, y)
+			}
+			out.SetColorIndex(x, y, uint8(root.leaf(c).index))
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func distinct(img image.Image) map[color.RGBA]bool {
+	seen := map[color.RGBA]bool{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)] = true
+		}
+	}
+	return seen
+}
+
+func TestReduceGradientToTwo(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 256, 8))
+	for x := range 256 {
+		for y := range 8 {
+			img.SetGray(x, y, color.Gray{uint8(x)})
+		}
+	}
+
+	out := Reduce(img, 2)
+	if got := len(distinct(out)); got != 2 {
+		t.Fatalf("got %d colors, want 2", got)
+	}
+
+	// The dark half goes one way and the light half the other.
+	dark, light := out.ColorIndexAt(0, 0), out.ColorIndexAt(255, 0)
+	for x := range 256 {
+		want := dark
+		if x >= 128 {
+			want = light
+		}
+		if got := out.ColorIndexAt(x, 3); got != want {
+			t.Errorf("pixel %d is in box %d, want %d", x, got, want)
+		}
+	}
+}
+
+func TestReduceKeepsFewColors(t *testing.T) {
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {10, 10, 10, 0}}
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for i := range 40 * 40 {
+		img.SetNRGBA(i%40, i/40, colors[i%len(colors)])
+	}
+
+	out := Reduce(img, 16)
+	if len(out.Palette) != len(colors) {
+		t.Fatalf("palette of %d colors, want %d", len(out.Palette), len(colors))
+	}
+	for i := range 40 * 40 {
+		if got := out.At(i%40, i/40); got != colors[i%len(colors)] {
+			t.Fatalf("pixel %d is %v, want %v", i, got, colors[i%len(colors)])
+		}
+	}
+}
+
+func TestReduceAtMostN(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(5, 5, 105, 85))
+	rng.Read(img.Pix)
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	for _, n := range []int{1, 2, 7, 64, 256} {
+		out := Reduce(img, n)
+		if out.Bounds() != img.Bounds() {
+			t.Fatalf("n=%d: bounds %v, want %v", n, out.Bounds(), img.Bounds())
+		}
+		if got := len(distinct(out)); got > n || len(out.Palette) != n {
+			t.Errorf("n=%d: %d colors in a palette of %d", n, got, len(out.Palette))
+		}
+	}
+}
+
+func TestReduceDitheredGradient(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 256, 8))
+	for x := range 256 {
+		for y := range 8 {
+			img.SetGray(x, y, color.Gray{uint8(x)})
+		}
+	}
+
+	out := ReduceDithered(img, 2)
+	if got := len(distinct(out)); got != 2 {
+		t.Fatalf("got %d colors, want 2", got)
+	}
+
+	// Going across in bands, the share of light pixels never falls, and
+	// the bands around the middle mix both colors rather than switching
+	// from one to the other at once.
+	light := out.ColorIndexAt(255, 0)
+	prev, mixed := 0, 0
+	for band := 0; band < 256; band += 16 {
+		n := 0
+		for x := band; x < band+16; x++ {
+			for y := range 8 {
+				if out.ColorIndexAt(x, y) == light {
+					n++
+				}
+			}
+		}
+		if n < prev {
+			t.Errorf("band at %d has %d light pixels, fewer than the %d before it", band, n, prev)
+		}
+		if n > 0 && n < 16*8 {
+			mixed++
+		}
+		prev = n
+	}
+	if mixed < 4 {
+		t.Errorf("%d bands mix the two colors, want at least 4", mixed)
+	}
+	if out.ColorIndexAt(0, 0) == light || out.ColorIndexAt(255, 7) != light {
+		t.Error("the ends of the gradient aren't dark and light")
+	}
+}
@@ -0,0 +1,53 @@
+// Package reveal holds the rules of the guess-the-image game: how coarse
+// each stage of the reveal is, what a guess is worth, and when a guess
+// counts as right.
+package reveal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Stages is how many times the image sharpens before the answer is given.
+const Stages = 5
+
+// Block is the size, in columns, of the blocks the image is drawn in at
+// stage (counting from 0) when it is width columns wide. The first stage
+// is about four blocks across and each one after halves them; the last
+// is the image as it is.
+func Block(width, stage int) int {
+	if stage >= Stages-1 {
+		return 1
+	}
+	return max(width/(4<<stage), 1)
+}
+
+// Points is what a right guess at stage is worth: the sooner, the more.
+func Points(stage int) int {
+	return max(100*(Stages-stage)/Stages, 10)
+}
+
+// key is what's left of s to compare once case, spacing and punctuation
+// are gone.
+func key(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Match reports whether guess is the answer, ignoring case, spacing and
+// punctuation: "Eiffel-Tower!" and "eiffeltower" both match "Eiffel
+// Tower", but "the eiffel tower" doesn't.
+func Match(guess, answer string) bool {
+	k := key(answer)
+	return k != "" && key(guess) == k
+}
+
+// Valid reports whether an answer can ever be matched.
+func Valid(answer string) bool {
+	return key(answer) != ""
+}
@@ -0,0 +1,68 @@
+package reveal
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct {
+		guess, answer string
+		want          bool
+	}{
+		{"eiffel tower", "Eiffel Tower", true},
+		{"EIFFEL-TOWER!", "eiffel tower", true},
+		{"eiffeltower", "Eiffel Tower", true},
+		{"  eiffel   tower ", "Eiffel Tower", true},
+		{"St. Paul's", "st pauls", true},
+		{"Café", "café", true},
+		{"eiffel", "Eiffel Tower", false},
+		{"eiffel towers", "Eiffel Tower", false},
+		{"the eiffel tower", "Eiffel Tower", false},
+		{"R2-D2", "r2d2", true},
+		{"R2-D3", "r2d2", false},
+		{"", "", false},
+		{"!!!", "?", false},
+	} {
+		if got := Match(c.guess, c.answer); got != c.want {
+			t.Errorf("Match(%q, %q) = %v", c.guess, c.answer, got)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	if Valid("...") || Valid("") {
+		t.Error("punctuation accepted as an answer")
+	}
+	if !Valid("7") {
+		t.Error("a digit refused as an answer")
+	}
+}
+
+func TestBlock(t *testing.T) {
+	last := 1 << 30
+	for stage := range Stages {
+		b := Block(100, stage)
+		if b < 1 || b > last {
+			t.Errorf("stage %d: block %d after %d", stage, b, last)
+		}
+		last = b
+	}
+	if Block(100, 0) != 25 || Block(100, Stages-1) != 1 {
+		t.Errorf("blocks run %d to %d", Block(100, 0), Block(100, Stages-1))
+	}
+	if Block(3, 0) != 1 {
+		t.Errorf("tiny image got block %d", Block(3, 0))
+	}
+}
+
+func TestPoints(t *testing.T) {
+	last := 1 << 30
+	for stage := range Stages {
+		p := Points(stage)
+		if p >= last || p < 10 {
+			t.Errorf("stage %d worth %d after %d", stage, p, last)
+		}
+		last = p
+	}
+	if Points(0) != 100 {
+		t.Errorf("first stage worth %d", Points(0))
+	}
+}
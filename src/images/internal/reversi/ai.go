@@ -0,0 +1,90 @@
+package reversi
+
+import "math/rand"
+
+const win_value = 100000
+
+// weights is how much holding each square is worth. Corners can never be
+// flipped back; the squares next to them are bad because they hand the
+// corner over, and the edges are better than the middle.
+var weights = [Size][Size]int{
+	{100, -20, 10, 5, 5, 10, -20, 100},
+	{-20, -50, -2, -2, -2, -2, -50, -20},
+	{10, -2, -1, -1, -1, -1, -2, 10},
+	{5, -2, -1, -1, -1, -1, -2, 5},
+	{5, -2, -1, -1, -1, -1, -2, 5},
+	{10, -2, -1, -1, -1, -1, -2, 10},
+	{-20, -50, -2, -2, -2, -2, -50, -20},
+	{100, -20, 10, 5, 5, 10, -20, 100},
+}
+
+// Evaluate scores the board from side's point of view by the squares each
+// side holds.
+func Evaluate(b *Board, side Side) int {
+	score := 0
+	for r := range Size {
+		for c := range Size {
+			switch b[r][c] {
+			case disc(side):
+				score += weights[r][c]
+			case disc(side.Other()):
+				score -= weights[r][c]
+			}
+		}
+	}
+	return score
+}
+
+// final scores a finished game for side: any win beats any position, and
+// a bigger win beats a smaller one.
+func final(b *Board, side Side) int {
+	diff := b.Count(side) - b.Count(side.Other())
+	switch {
+	case diff > 0:
+		return win_value + diff
+	case diff < 0:
+		return -win_value + diff
+	}
+	return 0
+}
+
+// Best searches depth plies ahead with alpha-beta and returns the best
+// square for side, choosing at random between equally good ones. side
+// must have a legal move.
+func Best(b Board, side Side, depth int, rng *rand.Rand) Square {
+	moves := b.Moves(side)
+	rng.Shuffle(len(moves), func(i, j int) { moves[i], moves[j] = moves[j], moves[i] })
+
+	best, alpha := moves[0], -2*win_value
+	for _, s := range moves {
+		next := b.Apply(s, side)
+		if v := -search(&next, side.Other(), depth-1, -2*win_value, -alpha); v > alpha {
+			best, alpha = s, v
+		}
+	}
+	return best
+}
+
+func search(b *Board, side Side, depth, alpha, beta int) int {
+	moves := b.Moves(side)
+	if len(moves) == 0 {
+		// Passing costs no depth, and two passes in a row end the game.
+		if len(b.Moves(side.Other())) == 0 {
+			return final(b, side)
+		}
+		return -search(b, side.Other(), depth, -beta, -alpha)
+	}
+	if depth <= 0 {
+		return Evaluate(b, side)
+	}
+
+	for _, s := range moves {
+		next := b.Apply(s, side)
+		v := -search(&next, side.Other(), depth-1, -beta, -alpha)
+		if v >= beta {
+			return v
+		}
+		alpha = max(alpha, v)
+	}
+	return alpha
+}
@@ -0,0 +1,66 @@
+package reversi
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBestTakesTheCorner(t *testing.T) {
+	b := Parse(
+		".wb.....",
+		"........",
+		"........",
+		"...wb...",
+	)
+
+	for seed := range int64(5) {
+		rng := rand.New(rand.NewSource(seed))
+		if s := Best(b, Black, 1, rng); s.String() != "a8" {
+			t.Errorf("chose %v over the corner", s)
+		}
+	}
+}
+
+// perfect plays the rest of the game out over every line and returns the
+// best final score side can force.
+func perfect(b *Board, side Side) int {
+	moves := b.Moves(side)
+	if len(moves) == 0 {
+		if len(b.Moves(side.Other())) == 0 {
+			return final(b, side)
+		}
+		return -perfect(b, side.Other())
+	}
+
+	best := -2 * win_value
+	for _, s := range moves {
+		next := b.Apply(s, side)
+		best = max(best, -perfect(&next, side.Other()))
+	}
+	return best
+}
+
+func TestBestPlaysEndgamesPerfectly(t *testing.T) {
+	for seed := range int64(20) {
+		rng := rand.New(rand.NewSource(seed))
+
+		// Play randomly until only a few squares are left.
+		b, side := New(), Black
+		over := false
+		for b.Count(Black)+b.Count(White) < Size*Size-7 && !over {
+			moves := b.Moves(side)
+			b = b.Apply(moves[rng.Intn(len(moves))], side)
+			side, _, over = b.Next(side)
+		}
+		if over {
+			continue
+		}
+
+		want := perfect(&b, side)
+		s := Best(b, side, 10, rng)
+		next := b.Apply(s, side)
+		if got := -perfect(&next, side.Other()); got != want {
+			t.Errorf("seed %d: %v playing %v gets %d; best is %d", seed, side, s, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package reversi implements Othello's rules: a disc must be placed so
+// that it outflanks at least one straight line of the opponent's discs,
+// every line it outflanks is flipped, a side with no such move passes,
+// and the game ends when neither side can move.
+package reversi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const Size = 8
+
+type Side int
+
+const (
+	Black Side = iota // moves first
+	White
+)
+
+func (s Side) Other() Side {
+	return 1 - s
+}
+
+func (s Side) String() string {
+	return [...]string{"Black", "White"}[s]
+}
+
+type Disc byte
+
+const (
+	Empty Disc = iota
+	BlackDisc
+	WhiteDisc
+)
+
+func disc(s Side) Disc {
+	return Disc(s) + 1
+}
+
+// A Square is a row and column, with row 0 at the top. Squares are named
+// like a chessboard: "a1" is the bottom-left corner.
+type Square struct{ Row, Col int }
+
+func (s Square) String() string {
+	return fmt.Sprintf("%c%d", 'a'+s.Col, Size-s.Row)
+}
+
+func (s Square) on() bool {
+	return s.Row >= 0 && s.Col >= 0 && s.Row < Size && s.Col < Size
+}
+
+func ParseSquare(s string) (Square, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != 2 || s[0] < 'a' || s[0] >= 'a'+Size || s[1] < '1' || s[1] >= '1'+Size {
+		return Square{}, fmt.Errorf("%q isn't a square like d3", s)
+	}
+	return Square{Size - int(s[1]-'0'), int(s[0] - 'a')}, nil
+}
+
+type Board [Size][Size]Disc
+
+func (b *Board) At(s Square) Disc {
+	return b[s.Row][s.Col]
+}
+
+// New sets out the four discs in the middle, with each side's pair on a
+// diagonal.
+func New() Board {
+	var b Board
+	b[3][4], b[4][3] = WhiteDisc, WhiteDisc
+	b[3][3], b[4][4] = BlackDisc, BlackDisc
+	return b
+}
+
+// Parse reads a board drawn as eight rows of 'b', 'w' and anything else
+// for empty, top row first.
+func Parse(rows ...string) Board {
+	var b Board
+	discs := map[byte]Disc{'b': BlackDisc, 'w': WhiteDisc}
+	for r, row := range rows {
+		for c := range min(len(row), Size) {
+			b[r][c] = discs[row[c]]
+		}
+	}
+	return b
+}
+
+var directions = [8][2]int{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+
+// Flips lists the discs side would turn over by playing at s, along all
+// eight lines out from it. A line only counts if it's one or more of the
+// opponent's discs closed off by one of side's own; running into an
+// empty square or the edge first flips nothing. It's empty if s is taken.
+func (b *Board) Flips(s Square, side Side) []Square {
+	if b.At(s) != Empty {
+		return nil
+	}
+
+	var out []Square
+	mine, theirs := disc(side), disc(side.Other())
+	for _, d := range directions {
+		var line []Square
+		at := Square{s.Row + d[0], s.Col + d[1]}
+		for at.on() && b.At(at) == theirs {
+			line = append(line, at)
+			at = Square{at.Row + d[0], at.Col + d[1]}
+		}
+		if len(line) > 0 && at.on() && b.At(at) == mine {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// Moves lists the squares side can play on, top row first.
+func (b *Board) Moves(side Side) []Square {
+	var out []Square
+	for r := range Size {
+		for c := range Size {
+			if s := (Square{r, c}); len(b.Flips(s, side)) > 0 {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+var ErrIllegal = errors.New("that isn't a legal move")
+
+// Check says why side can't play at s, or nil if it can.
+func (b *Board) Check(s Square, side Side) error {
+	if b.At(s) != Empty {
+		return fmt.Errorf("%w: %s is taken", ErrIllegal, s)
+	}
+	if len(b.Flips(s, side)) == 0 {
+		return fmt.Errorf("%w: %s doesn't outflank anything", ErrIllegal, s)
+	}
+	return nil
+}
+
+// Apply returns the board after side plays at s, which must be legal.
+func (b Board) Apply(s Square, side Side) Board {
+	for _, f := range b.Flips(s, side) {
+		b[f.Row][f.Col] = disc(side)
+	}
+	b[s.Row][s.Col] = disc(side)
+	return b
+}
+
+// Next says who moves after mover has: normally the other side, but if
+// they have no move they pass and mover goes again. over is set when
+// neither side can move, which ends the game.
+func (b *Board) Next(mover Side) (next Side, passed, over bool) {
+	switch {
+	case len(b.Moves(mover.Other())) > 0:
+		return mover.Other(), false, false
+	case len(b.Moves(mover)) > 0:
+		return mover, true, false
+	}
+	return mover.Other(), false, true
+}
+
+// Count returns how many discs side has on the board.
+func (b *Board) Count(side Side) int {
+	n := 0
+	for r := range Size {
+		for c := range Size {
+			if b[r][c] == disc(side) {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,166 @@
+package reversi
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func names(squares []Square) []string {
+	var out []string
+	for _, s := range squares {
+		out = append(out, s.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func expect(t *testing.T, what string, squares []Square, want ...string) {
+	t.Helper()
+
+	got := names(squares)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, got, want)
+		}
+	}
+}
+
+func TestSquares(t *testing.T) {
+	for name, want := range map[string]Square{"a1": {7, 0}, "h8": {0, 7}, "D3": {5, 3}} {
+		s, err := ParseSquare(name)
+		if err != nil || s != want {
+			t.Errorf("ParseSquare(%q) = %v, %v; want %v", name, s, err, want)
+		}
+	}
+	for _, bad := range []string{"i1", "a9", "a0", "a", "a10"} {
+		if _, err := ParseSquare(bad); err == nil {
+			t.Errorf("ParseSquare(%q) accepted", bad)
+		}
+	}
+}
+
+func TestOpening(t *testing.T) {
+	b := New()
+	if b.Count(Black) != 2 || b.Count(White) != 2 {
+		t.Fatalf("starts with %d black and %d white", b.Count(Black), b.Count(White))
+	}
+	expect(t, "black's openings", b.Moves(Black), "d3", "c4", "f5", "e6")
+	expect(t, "white's openings", b.Moves(White), "e3", "f4", "c5", "d6")
+}
+
+func TestFlipsEveryDirection(t *testing.T) {
+	b := Parse(
+		"........",
+		".b.b.b..",
+		"..www...",
+		".bw.wb..",
+		"..www...",
+		".b.b.b..",
+	)
+
+	s, _ := ParseSquare("d5")
+	expect(t, "flips from d5", b.Flips(s, Black), "c6", "d6", "e6", "c5", "e5", "c4", "d4", "e4")
+
+	after := b.Apply(s, Black)
+	if after.Count(White) != 0 || after.Count(Black) != 17 {
+		t.Errorf("after d5: %d black, %d white", after.Count(Black), after.Count(White))
+	}
+}
+
+func TestFlipsOnlyClosedLines(t *testing.T) {
+	b := Parse(
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"w.b.....",
+		"w.w.....",
+		".wwb....",
+	)
+
+	// Up from a1 the whites run into an empty square, so only the row,
+	// which black closes at d1, flips. Turning c1 over mustn't then flip
+	// c2, though it now sits between two black discs.
+	s, _ := ParseSquare("a1")
+	expect(t, "flips from a1", b.Flips(s, Black), "b1", "c1")
+
+	after := b.Apply(s, Black)
+	for name, want := range map[string]Disc{"a1": BlackDisc, "b1": BlackDisc, "c1": BlackDisc, "a2": WhiteDisc, "a3": WhiteDisc, "c2": WhiteDisc} {
+		at, _ := ParseSquare(name)
+		if got := after.At(at); got != want {
+			t.Errorf("after a1, %s is %v; want %v", name, got, want)
+		}
+	}
+}
+
+func TestFlipsStopAtTheEdge(t *testing.T) {
+	b := Parse(
+		".bbbbbbb",
+		"b.......",
+		"w.......",
+	)
+
+	s, _ := ParseSquare("a8")
+	expect(t, "flips from a8", b.Flips(s, White), "a7")
+}
+
+func TestCheck(t *testing.T) {
+	b := New()
+
+	taken, _ := ParseSquare("d4")
+	if err := b.Check(taken, Black); !errors.Is(err, ErrIllegal) || len(b.Flips(taken, Black)) != 0 {
+		t.Errorf("playing on a disc: %v", err)
+	}
+	nothing, _ := ParseSquare("a1")
+	if err := b.Check(nothing, Black); !errors.Is(err, ErrIllegal) {
+		t.Errorf("playing where nothing flips: %v", err)
+	}
+	fine, _ := ParseSquare("d3")
+	if err := b.Check(fine, Black); err != nil {
+		t.Errorf("d3: %v", err)
+	}
+}
+
+func TestPass(t *testing.T) {
+	b := Parse("bw......", "........", "..b.w...")
+
+	// White's only disc on the top row is backed by the edge, and the
+	// other can't reach anything black.
+	if moves := b.Moves(White); len(moves) != 0 {
+		t.Fatalf("white can play %v", names(moves))
+	}
+	if next, passed, over := b.Next(Black); next != Black || !passed || over {
+		t.Errorf("after black: next %v, passed %v, over %v; want black again", next, passed, over)
+	}
+	if next, passed, over := b.Next(White); next != Black || passed || over {
+		t.Errorf("after white: next %v, passed %v, over %v; want black", next, passed, over)
+	}
+}
+
+func TestDoublePassEnds(t *testing.T) {
+	// Neither side can move, though both have discs and the board is
+	// nearly empty.
+	b := Parse("b......w", "........", "w......b")
+	if next, passed, over := b.Next(Black); !over {
+		t.Errorf("with no moves for anyone: next %v, passed %v, not over", next, passed)
+	}
+
+	// Black wipes out white's last disc, leaving nothing to flip.
+	b = Parse("bw......")
+	s, _ := ParseSquare("c8")
+	b = b.Apply(s, Black)
+	if _, _, over := b.Next(Black); !over || b.Count(Black) != 3 || b.Count(White) != 0 {
+		t.Errorf("after wiping white out: over %v, %d black, %d white", over, b.Count(Black), b.Count(White))
+	}
+
+	start := New()
+	if _, _, over := start.Next(White); over {
+		t.Error("the opening position is over")
+	}
+}
@@ -0,0 +1,51 @@
+// Package combat holds the arithmetic of fights: who hits, and how hard.
+package combat
+
+import "math/rand"
+
+type Stats struct {
+	HP, MaxHP       int
+	Attack, Defense int
+}
+
+func (s *Stats) Alive() bool {
+	return s.HP > 0
+}
+
+// Heal restores up to n hit points without going over the maximum, and
+// returns how many were restored.
+func (s *Stats) Heal(n int) int {
+	n = min(n, s.MaxHP-s.HP)
+	s.HP += n
+	return n
+}
+
+// HitChance is the percentage chance that an attack lands. Every point of
+// attack over the target's defense adds five, but nothing is ever certain
+// either way.
+func HitChance(attack, defense int) int {
+	return min(max(75+5*(attack-defense), 25), 95)
+}
+
+// Damage is what a hit does on average: the attack less half the
+// target's defense, and never nothing.
+func Damage(attack, defense int) int {
+	return max(1, attack-defense/2)
+}
+
+type Outcome struct {
+	Hit    bool
+	Damage int
+	Killed bool
+}
+
+// Attack resolves one swing of a at d. A hit does Damage give or take one.
+func Attack(a, d *Stats, rng *rand.Rand) Outcome {
+	if rng.Intn(100) >= HitChance(a.Attack, d.Defense) {
+		return Outcome{}
+	}
+
+	dmg := max(1, Damage(a.Attack, d.Defense)+rng.Intn(3)-1)
+	d.HP -= dmg
+	return Outcome{Hit: true, Damage: dmg, Killed: !d.Alive()}
+}
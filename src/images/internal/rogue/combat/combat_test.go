@@ -0,0 +1,77 @@
+package combat
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHitChance(t *testing.T) {
+	tests := []struct{ attack, defense, want int }{
+		{3, 3, 75},
+		{5, 3, 85},
+		{20, 0, 95},
+		{0, 20, 25},
+	}
+	for _, tt := range tests {
+		if got := HitChance(tt.attack, tt.defense); got != tt.want {
+			t.Errorf("HitChance(%d, %d) = %d, want %d", tt.attack, tt.defense, got, tt.want)
+		}
+	}
+}
+
+func TestDamage(t *testing.T) {
+	if d := Damage(6, 4); d != 4 {
+		t.Errorf("Damage(6, 4) = %d, want 4", d)
+	}
+	if d := Damage(1, 10); d != 1 {
+		t.Errorf("Damage(1, 10) = %d, want the minimum of 1", d)
+	}
+}
+
+func TestAttack(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hits := 0
+	const swings = 10000
+
+	for range swings {
+		a := Stats{HP: 10, MaxHP: 10, Attack: 5}
+		d := Stats{HP: 100, MaxHP: 100, Defense: 3}
+
+		o := Attack(&a, &d, rng)
+		if !o.Hit {
+			if d.HP != 100 {
+				t.Fatal("a miss did damage")
+			}
+			continue
+		}
+
+		hits++
+		if o.Damage < 3 || o.Damage > 5 || d.HP != 100-o.Damage {
+			t.Fatalf("hit for %d leaving %d HP, want 3-5 damage", o.Damage, d.HP)
+		}
+	}
+
+	// 85% to hit; allow for luck.
+	if rate := 100 * hits / swings; rate < 83 || rate > 87 {
+		t.Errorf("hit %d%% of the time, want about 85%%", rate)
+	}
+}
+
+func TestKill(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a := Stats{Attack: 50}
+	d := Stats{HP: 1, MaxHP: 5}
+
+	for d.Alive() {
+		if o := Attack(&a, &d, rng); o.Hit && !o.Killed {
+			t.Fatal("a hit on 1 HP didn't kill")
+		}
+	}
+}
+
+func TestHeal(t *testing.T) {
+	s := Stats{HP: 7, MaxHP: 10}
+	if n := s.Heal(5); n != 3 || s.HP != 10 {
+		t.Errorf("Heal(5) from 7/10 restored %d to %d, want 3 to 10", n, s.HP)
+	}
+}
@@ -0,0 +1,127 @@
+// Package dungeon generates roguelike levels: rectangular rooms joined by
+// corridors, with a staircase down in the last room dug.
+package dungeon
+
+import "math/rand"
+
+type Tile byte
+
+const (
+	Wall Tile = iota
+	Floor
+	Stairs
+)
+
+type Point struct{ X, Y int }
+
+func (p Point) Add(q Point) Point {
+	return Point{p.X + q.X, p.Y + q.Y}
+}
+
+type Rect struct{ X, Y, W, H int }
+
+func (r Rect) Center() Point {
+	return Point{r.X + r.W/2, r.Y + r.H/2}
+}
+
+// Contains reports whether p is inside the room.
+func (r Rect) Contains(p Point) bool {
+	return p.X >= r.X && p.Y >= r.Y && p.X < r.X+r.W && p.Y < r.Y+r.H
+}
+
+// near reports whether two rooms overlap or would share a wall.
+func (r Rect) near(o Rect) bool {
+	return r.X <= o.X+o.W && o.X <= r.X+r.W && r.Y <= o.Y+o.H && o.Y <= r.Y+r.H
+}
+
+type Level struct {
+	Width, Height int
+	Tiles         []Tile
+
+	// Rooms are in the order they were dug; each is joined to the one
+	// before it, so the first is a good place to start.
+	Rooms  []Rect
+	Stairs Point
+}
+
+const (
+	max_rooms = 12
+	attempts  = 300
+)
+
+// Generate digs a level. Rooms are placed at random and thrown away if
+// they would touch one already dug; each new room is joined to the last
+// by an L-shaped corridor, which keeps the whole level connected.
+func Generate(width, height int, rng *rand.Rand) *Level {
+	l := &Level{Width: width, Height: height, Tiles: make([]Tile, width*height)}
+
+	for range attempts {
+		if len(l.Rooms) == max_rooms {
+			break
+		}
+
+		w, h := 4+rng.Intn(9), 3+rng.Intn(4)
+		if w >= width-2 || h >= height-2 {
+			continue
+		}
+		r := Rect{1 + rng.Intn(width-w-1), 1 + rng.Intn(height-h-1), w, h}
+
+		clash := false
+		for _, o := range l.Rooms {
+			clash = clash || r.near(o)
+		}
+		if clash {
+			continue
+		}
+
+		for y := r.Y; y < r.Y+r.H; y++ {
+			for x := r.X; x < r.X+r.W; x++ {
+				l.Set(Point{x, y}, Floor)
+			}
+		}
+		if len(l.Rooms) > 0 {
+			l.corridor(l.Rooms[len(l.Rooms)-1].Center(), r.Center(), rng.Intn(2) == 0)
+		}
+		l.Rooms = append(l.Rooms, r)
+	}
+
+	l.Stairs = l.Rooms[len(l.Rooms)-1].Center()
+	l.Set(l.Stairs, Stairs)
+	return l
+}
+
+// corridor digs from a to b, going across first or down first.
+func (l *Level) corridor(a, b Point, across bool) {
+	corner := Point{b.X, a.Y}
+	if !across {
+		corner = Point{a.X, b.Y}
+	}
+	l.dig(a, corner)
+	l.dig(corner, b)
+}
+
+// dig clears a straight line between two points that share a row or
+// column.
+func (l *Level) dig(a, b Point) {
+	for x := min(a.X, b.X); x <= max(a.X, b.X); x++ {
+		for y := min(a.Y, b.Y); y <= max(a.Y, b.Y); y++ {
+			l.Set(Point{x, y}, Floor)
+		}
+	}
+}
+
+func (l *Level) Set(p Point, t Tile) {
+	l.Tiles[p.Y*l.Width+p.X] = t
+}
+
+// At returns the tile at p. Everything off the map is wall.
+func (l *Level) At(p Point) Tile {
+	if p.X < 0 || p.Y < 0 || p.X >= l.Width || p.Y >= l.Height {
+		return Wall
+	}
+	return l.Tiles[p.Y*l.Width+p.X]
+}
+
+func (l *Level) Walkable(p Point) bool {
+	return l.At(p) != Wall
+}
@@ -0,0 +1,67 @@
+package dungeon
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestConnected(t *testing.T) {
+	for seed := range int64(100) {
+		l := Generate(70, 21, rand.New(rand.NewSource(seed)))
+
+		// Flood from the first room and make sure every floor tile, and so
+		// every room and the stairs, was reached.
+		start := l.Rooms[0].Center()
+		seen := map[Point]bool{start: true}
+		queue := []Point{start}
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			for _, d := range []Point{{0, 1}, {0, -1}, {1, 0}, {-1, 0}} {
+				if q := p.Add(d); l.Walkable(q) && !seen[q] {
+					seen[q] = true
+					queue = append(queue, q)
+				}
+			}
+		}
+
+		for y := range l.Height {
+			for x := range l.Width {
+				if p := (Point{x, y}); l.Walkable(p) && !seen[p] {
+					t.Fatalf("seed %d: %v can't be reached from the first room", seed, p)
+				}
+			}
+		}
+		if !seen[l.Stairs] || l.At(l.Stairs) != Stairs {
+			t.Fatalf("seed %d: stairs at %v are missing or cut off", seed, l.Stairs)
+		}
+	}
+}
+
+func TestRooms(t *testing.T) {
+	for seed := range int64(100) {
+		l := Generate(70, 21, rand.New(rand.NewSource(seed)))
+
+		if len(l.Rooms) < 4 {
+			t.Errorf("seed %d: only %d rooms", seed, len(l.Rooms))
+		}
+		for i, r := range l.Rooms {
+			if r.X < 1 || r.Y < 1 || r.X+r.W > l.Width-1 || r.Y+r.H > l.Height-1 {
+				t.Fatalf("seed %d: room %v breaks the outer wall", seed, r)
+			}
+			for _, o := range l.Rooms[:i] {
+				if r.near(o) {
+					t.Fatalf("seed %d: rooms %v and %v touch", seed, r, o)
+				}
+			}
+		}
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	a := Generate(70, 21, rand.New(rand.NewSource(42)))
+	b := Generate(70, 21, rand.New(rand.NewSource(42)))
+	if string(a.Tiles) != string(b.Tiles) {
+		t.Error("the same seed generated different levels")
+	}
+}
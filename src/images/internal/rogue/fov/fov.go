@@ -0,0 +1,84 @@
+// Package fov computes field of view on a grid by recursive shadowcasting:
+// each octant is scanned row by row outward from the viewer, and opaque
+// squares narrow the range of slopes the next rows can be seen through.
+package fov
+
+// Each octant maps its own (dx, dy) onto the grid as
+// (dx*xx + dy*xy, dx*yx + dy*yy).
+var octants = [8][4]int{
+	{1, 0, 0, 1},
+	{0, 1, 1, 0},
+	{0, -1, 1, 0},
+	{-1, 0, 0, 1},
+	{-1, 0, 0, -1},
+	{0, -1, -1, 0},
+	{0, 1, -1, 0},
+	{1, 0, 0, -1},
+}
+
+// Compute calls visit for every square within radius of (x, y) that can
+// be seen from it, including the viewer's own square and the first opaque
+// square in each direction. opaque must treat anything off the map as
+// opaque; visit may be called more than once for a square.
+func Compute(x, y, radius int, opaque func(x, y int) bool, visit func(x, y int)) {
+	visit(x, y)
+	for _, o := range octants {
+		c := caster{x, y, radius, o, opaque, visit}
+		c.cast(1, 1.0, 0.0)
+	}
+}
+
+type caster struct {
+	x, y, radius int
+	o            [4]int
+	opaque       func(x, y int) bool
+	visit        func(x, y int)
+}
+
+// cast scans rows outward from row, seeing through the slopes from start
+// down to end.
+func (c *caster) cast(row int, start, end float64) {
+	if start < end {
+		return
+	}
+
+	for j := row; j <= c.radius; j++ {
+		blocked := false
+		next_start := start
+
+		for dx := -j; dx <= 0; dx++ {
+			dy := -j
+			left := (float64(dx) - 0.5) / (float64(dy) + 0.5)
+			right := (float64(dx) + 0.5) / (float64(dy) - 0.5)
+
+			if start < right {
+				continue
+			}
+			if end > left {
+				break
+			}
+
+			gx := c.x + dx*c.o[0] + dy*c.o[1]
+			gy := c.y + dx*c.o[2] + dy*c.o[3]
+			if dx*dx+dy*dy <= c.radius*c.radius {
+				c.visit(gx, gy)
+			}
+
+			switch {
+			case blocked && c.opaque(gx, gy):
+				next_start = right
+			case blocked:
+				blocked = false
+				start = next_start
+			case c.opaque(gx, gy) && j < c.radius:
+				blocked = true
+				c.cast(j+1, start, left)
+				next_start = right
+			}
+		}
+
+		if blocked {
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package fov
+
+import (
+	"strings"
+	"testing"
+)
+
+// grid parses a map where '#' is opaque and '@' is the viewer.
+func grid(rows ...string) (int, int, func(x, y int) bool) {
+	vx, vy := 0, 0
+	for y, row := range rows {
+		if x := strings.IndexByte(row, '@'); x >= 0 {
+			vx, vy = x, y
+		}
+	}
+
+	opaque := func(x, y int) bool {
+		return y < 0 || y >= len(rows) || x < 0 || x >= len(rows[y]) || rows[y][x] == '#'
+	}
+	return vx, vy, opaque
+}
+
+func seen(rows []string, radius int) map[[2]int]bool {
+	x, y, opaque := grid(rows...)
+	out := map[[2]int]bool{}
+	Compute(x, y, radius, opaque, func(x, y int) { out[[2]int{x, y}] = true })
+	return out
+}
+
+func TestOpenRoom(t *testing.T) {
+	rows := []string{
+		"#######",
+		"#.....#",
+		"#..@..#",
+		"#.....#",
+		"#######",
+	}
+
+	s := seen(rows, 10)
+	for y, row := range rows {
+		for x := range row {
+			if !s[[2]int{x, y}] {
+				t.Errorf("(%d, %d) not seen in an open room", x, y)
+			}
+		}
+	}
+}
+
+func TestWallBlocks(t *testing.T) {
+	rows := []string{
+		"#########",
+		"#.......#",
+		"#@..#...#",
+		"#.......#",
+		"#########",
+	}
+
+	s := seen(rows, 10)
+	if !s[[2]int{4, 2}] {
+		t.Error("the pillar itself should be seen")
+	}
+	for _, p := range [][2]int{{5, 2}, {6, 2}, {7, 2}} {
+		if s[p] {
+			t.Errorf("%v seen straight through the pillar", p)
+		}
+	}
+	if !s[[2]int{7, 1}] || !s[[2]int{7, 3}] {
+		t.Error("squares beside the pillar's shadow should be seen")
+	}
+}
+
+func TestCorridor(t *testing.T) {
+	rows := []string{
+		"###########",
+		"#@........#",
+		"###########",
+	}
+
+	s := seen(rows, 4)
+	for x := 1; x <= 5; x++ {
+		if !s[[2]int{x, 1}] {
+			t.Errorf("(%d, 1) within reach but not seen", x)
+		}
+	}
+	if s[[2]int{6, 1}] {
+		t.Error("(6, 1) is out of range")
+	}
+}
+
+func TestRoomCorner(t *testing.T) {
+	// Around a corner nothing of the other corridor shows.
+	rows := []string{
+		"#####",
+		"#@..#",
+		"###.#",
+		"###.#",
+		"#...#",
+		"#####",
+	}
+
+	s := seen(rows, 10)
+	if s[[2]int{1, 4}] || s[[2]int{2, 4}] {
+		t.Error("saw round the corner")
+	}
+}
@@ -0,0 +1,374 @@
+// Package rogue is the game itself: a player descending through generated
+// levels, fighting what lives there. Each move is a turn; monsters act
+// after the player does.
+package rogue
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/atalii/image-server-thing/internal/rogue/combat"
+	"github.com/atalii/image-server-thing/internal/rogue/dungeon"
+	"github.com/atalii/image-server-thing/internal/rogue/fov"
+)
+
+const (
+	Width  = 70
+	Height = 21
+
+	Sight = 8
+)
+
+type Point = dungeon.Point
+
+var (
+	Up    = Point{X: 0, Y: -1}
+	Down  = Point{X: 0, Y: 1}
+	Left  = Point{X: -1, Y: 0}
+	Right = Point{X: 1, Y: 0}
+)
+
+type Monster struct {
+	Name  string
+	Glyph rune
+	Pos   Point
+	combat.Stats
+
+	// awake monsters chase the player even once out of sight.
+	awake bool
+}
+
+type kind struct {
+	name    string
+	glyph   rune
+	depth   int // the first floor it turns up on
+	hp      int
+	attack  int
+	defense int
+}
+
+var bestiary = []kind{
+	{"rat", 'r', 1, 4, 2, 0},
+	{"kobold", 'k', 1, 6, 3, 1},
+	{"goblin", 'g', 2, 10, 4, 1},
+	{"orc", 'o', 3, 15, 6, 2},
+	{"troll", 'T', 5, 26, 8, 3},
+	{"wraith", 'W', 7, 32, 10, 5},
+}
+
+type ItemKind int
+
+const (
+	Potion ItemKind = iota
+	Weapon
+)
+
+type Item struct {
+	Kind ItemKind
+	Name string
+	Pos  Point
+
+	// Power is what a potion heals or what a weapon adds to attack.
+	Power int
+}
+
+var weapons = []string{"dagger", "short sword", "mace", "long sword", "war axe", "great sword"}
+
+type Game struct {
+	Level  *dungeon.Level
+	Depth  int
+	Pos    Point
+	Player combat.Stats
+	Weapon *Item
+
+	Monsters []*Monster
+	Items    []*Item
+
+	// Visible is what the player can see right now; Seen is everything
+	// they have seen on this floor.
+	Visible map[Point]bool
+	Seen    map[Point]bool
+
+	Kills int
+	Turns int
+	Dead  bool
+
+	// Log holds messages for the player, newest last.
+	Log []string
+
+	rng *rand.Rand
+}
+
+func New(rng *rand.Rand) *Game {
+	g := &Game{
+		Player: combat.Stats{HP: 20, MaxHP: 20, Attack: 3, Defense: 1},
+		rng:    rng,
+	}
+	g.descend()
+	g.Say("Welcome to the dungeon. Find the stairs (>) and keep going down.")
+	return g
+}
+
+func (g *Game) Say(format string, args ...any) {
+	g.Log = append(g.Log, fmt.Sprintf(format, args...))
+}
+
+// Score rewards depth above all, with a little for each kill.
+func (g *Game) Score() int {
+	return 100*g.Depth + 10*g.Kills
+}
+
+// descend generates the next floor and drops the player in its first room.
+func (g *Game) descend() {
+	g.Depth++
+	g.Level = dungeon.Generate(Width, Height, g.rng)
+	g.Pos = g.Level.Rooms[0].Center()
+	g.Monsters = nil
+	g.Items = nil
+	g.Seen = map[Point]bool{}
+
+	// The first room is left empty so the player gets a moment.
+	for range 3 + g.Depth {
+		pos, ok := g.free_spot()
+		if !ok {
+			break
+		}
+		k := g.pick_kind()
+		// Monsters grow a little with each floor past their first.
+		extra := g.Depth - k.depth
+		g.Monsters = append(g.Monsters, &Monster{
+			Name:  k.name,
+			Glyph: k.glyph,
+			Pos:   pos,
+			Stats: combat.Stats{HP: k.hp + 2*extra, MaxHP: k.hp + 2*extra, Attack: k.attack + extra/2, Defense: k.defense},
+		})
+	}
+
+	for range 1 + g.rng.Intn(2) {
+		if pos, ok := g.free_spot(); ok {
+			g.Items = append(g.Items, &Item{Kind: Potion, Name: "healing potion", Pos: pos, Power: 8 + 2*g.Depth})
+		}
+	}
+	if g.rng.Intn(100) < 45 {
+		tier := min(len(weapons)-1, (g.Depth-1)/2+g.rng.Intn(2))
+		if pos, ok := g.free_spot(); ok {
+			g.Items = append(g.Items, &Item{Kind: Weapon, Name: weapons[tier], Pos: pos, Power: tier + 1})
+		}
+	}
+
+	g.look()
+}
+
+// pick_kind chooses a monster fit for the current depth, favouring the
+// tougher of those available.
+func (g *Game) pick_kind() kind {
+	var fit []kind
+	for _, k := range bestiary {
+		if k.depth <= g.Depth {
+			fit = append(fit, k)
+		}
+	}
+	i := max(g.rng.Intn(len(fit)), g.rng.Intn(len(fit)))
+	return fit[i]
+}
+
+// free_spot finds an empty floor square outside the first room.
+func (g *Game) free_spot() (Point, bool) {
+	for range 200 {
+		r := g.Level.Rooms[1+g.rng.Intn(len(g.Level.Rooms)-1)]
+		p := Point{X: r.X + g.rng.Intn(r.W), Y: r.Y + g.rng.Intn(r.H)}
+		if g.Level.At(p) == dungeon.Floor && g.MonsterAt(p) == nil && g.ItemAt(p) == nil {
+			return p, true
+		}
+	}
+	return Point{}, false
+}
+
+func (g *Game) MonsterAt(p Point) *Monster {
+	for _, m := range g.Monsters {
+		if m.Pos == p {
+			return m
+		}
+	}
+	return nil
+}
+
+func (g *Game) ItemAt(p Point) *Item {
+	for _, it := range g.Items {
+		if it.Pos == p {
+			return it
+		}
+	}
+	return nil
+}
+
+// look recomputes what the player can see.
+func (g *Game) look() {
+	g.Visible = map[Point]bool{}
+	opaque := func(x, y int) bool {
+		return g.Level.At(Point{X: x, Y: y}) == dungeon.Wall
+	}
+	fov.Compute(g.Pos.X, g.Pos.Y, Sight, opaque, func(x, y int) {
+		if x >= 0 && y >= 0 && x < Width && y < Height {
+			g.Visible[Point{X: x, Y: y}] = true
+			g.Seen[Point{X: x, Y: y}] = true
+		}
+	})
+}
+
+// Move walks the player one square, attacking whatever is in the way, and
+// then lets the monsters act. Walking into a wall costs no turn.
+func (g *Game) Move(d Point) {
+	if g.Dead {
+		return
+	}
+
+	to := g.Pos.Add(d)
+	if m := g.MonsterAt(to); m != nil {
+		g.attack(m)
+	} else if g.Level.Walkable(to) {
+		g.Pos = to
+		g.pick_up()
+	} else {
+		return
+	}
+
+	g.end_turn()
+}
+
+// Wait passes a turn.
+func (g *Game) Wait() {
+	if !g.Dead {
+		g.end_turn()
+	}
+}
+
+// Descend takes the stairs if the player is standing on them.
+func (g *Game) Descend() bool {
+	if g.Dead || g.Level.At(g.Pos) != dungeon.Stairs {
+		return false
+	}
+
+	g.descend()
+	g.Say("You descend to depth %d.", g.Depth)
+	return true
+}
+
+func (g *Game) attack(m *Monster) {
+	o := combat.Attack(&g.Player, &m.Stats, g.rng)
+	m.awake = true
+
+	switch {
+	case !o.Hit:
+		g.Say("You miss the %s.", m.Name)
+	case o.Killed:
+		g.Say("You kill the %s.", m.Name)
+		g.Kills++
+		for i, other := range g.Monsters {
+			if other == m {
+				g.Monsters = append(g.Monsters[:i], g.Monsters[i+1:]...)
+				break
+			}
+		}
+	default:
+		g.Say("You hit the %s for %d.", m.Name, o.Damage)
+	}
+}
+
+func (g *Game) pick_up() {
+	it := g.ItemAt(g.Pos)
+	if it == nil {
+		return
+	}
+
+	switch it.Kind {
+	case Potion:
+		if g.Player.HP == g.Player.MaxHP {
+			g.Say("You see a %s, but you feel fine.", it.Name)
+			return
+		}
+		g.Say("You drink the %s and recover %d HP.", it.Name, g.Player.Heal(it.Power))
+	case Weapon:
+		if g.Weapon != nil && g.Weapon.Power >= it.Power {
+			g.Say("You see a %s, no better than your %s.", it.Name, g.Weapon.Name)
+			return
+		}
+		if g.Weapon != nil {
+			g.Player.Attack -= g.Weapon.Power
+		}
+		g.Weapon = it
+		g.Player.Attack += it.Power
+		g.Say("You wield the %s.", it.Name)
+	}
+
+	for i, other := range g.Items {
+		if other == it {
+			g.Items = append(g.Items[:i], g.Items[i+1:]...)
+			break
+		}
+	}
+}
+
+func (g *Game) end_turn() {
+	g.Turns++
+	g.look()
+
+	for _, m := range g.Monsters {
+		if g.Dead {
+			return
+		}
+		g.monster_turn(m)
+	}
+	// Monsters may have come into view.
+	g.look()
+}
+
+// monster_turn wakes a monster once the player can see it, then has it
+// close in and attack. It steps whichever way brings it closest and waits
+// if nothing does.
+func (g *Game) monster_turn(m *Monster) {
+	if g.Visible[m.Pos] && !m.awake {
+		m.awake = true
+		g.Say("A %s notices you.", m.Name)
+	}
+	if !m.awake {
+		return
+	}
+
+	if distance(m.Pos, g.Pos) == 1 {
+		o := combat.Attack(&m.Stats, &g.Player, g.rng)
+		switch {
+		case !o.Hit:
+			g.Say("The %s misses.", m.Name)
+		case o.Killed:
+			g.Say("The %s hits you for %d. You die...", m.Name, o.Damage)
+			g.Dead = true
+		default:
+			g.Say("The %s hits you for %d.", m.Name, o.Damage)
+		}
+		return
+	}
+
+	best, best_d := m.Pos, distance(m.Pos, g.Pos)
+	for _, d := range []Point{Up, Down, Left, Right} {
+		to := m.Pos.Add(d)
+		if !g.Level.Walkable(to) || g.MonsterAt(to) != nil || to == g.Pos {
+			continue
+		}
+		if dist := distance(to, g.Pos); dist < best_d {
+			best, best_d = to, dist
+		}
+	}
+	m.Pos = best
+}
+
+func distance(a, b Point) int {
+	return abs(a.X-b.X) + abs(a.Y-b.Y)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
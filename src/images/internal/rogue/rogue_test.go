@@ -0,0 +1,116 @@
+package rogue
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/atalii/image-server-thing/internal/rogue/combat"
+	"github.com/atalii/image-server-thing/internal/rogue/dungeon"
+)
+
+// clear empties the floor so a test can set up exactly what it needs
+// next to the player.
+func clear(g *Game) {
+	g.Monsters = nil
+	g.Items = nil
+	r := g.Level.Rooms[0]
+	g.Pos = Point{X: r.X, Y: r.Y}
+}
+
+func TestBumpAttack(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	clear(g)
+	g.Player.Attack = 100
+
+	m := &Monster{Name: "rat", Pos: g.Pos.Add(Right), Stats: combat.Stats{HP: 1, MaxHP: 1}}
+	g.Monsters = []*Monster{m}
+
+	// HitChance never reaches 100%, so swing until it lands.
+	start := g.Pos
+	for len(g.Monsters) > 0 {
+		g.Move(Right)
+		if g.Pos != start {
+			t.Fatal("the player walked into the monster")
+		}
+	}
+	if g.Kills != 1 {
+		t.Errorf("kills = %d, want 1", g.Kills)
+	}
+
+	g.Move(Right)
+	if g.Pos != start.Add(Right) {
+		t.Error("couldn't step where the monster was")
+	}
+}
+
+func TestWallCostsNoTurn(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	clear(g)
+
+	// A corridor may leave from the corner, but not in every direction.
+	for _, d := range []Point{Up, Left} {
+		if !g.Level.Walkable(g.Pos.Add(d)) {
+			g.Move(d)
+		}
+	}
+	if g.Turns != 0 {
+		t.Errorf("walking into the wall took %d turns", g.Turns)
+	}
+}
+
+func TestItems(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	clear(g)
+	base := g.Player.Attack
+
+	g.Items = []*Item{
+		{Kind: Weapon, Name: "mace", Power: 3, Pos: g.Pos.Add(Right)},
+		{Kind: Weapon, Name: "dagger", Power: 1, Pos: g.Pos.Add(Right).Add(Right)},
+	}
+	g.Move(Right)
+	g.Move(Right)
+
+	if g.Weapon == nil || g.Weapon.Name != "mace" || g.Player.Attack != base+3 {
+		t.Errorf("wielding %v with attack %d, want the mace and %d", g.Weapon, g.Player.Attack, base+3)
+	}
+	if len(g.Items) != 1 {
+		t.Error("the worse weapon should be left on the floor")
+	}
+
+	g.Player.HP = 5
+	g.Items = []*Item{{Kind: Potion, Name: "potion", Power: 8, Pos: g.Pos.Add(Down)}}
+	g.Move(Down)
+	if g.Player.HP != 13 || len(g.Items) != 0 {
+		t.Errorf("HP %d after the potion, want 13", g.Player.HP)
+	}
+}
+
+func TestDescend(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	clear(g)
+
+	if g.Descend() {
+		t.Fatal("descended without standing on the stairs")
+	}
+
+	g.Pos = g.Level.Stairs
+	if !g.Descend() || g.Depth != 2 {
+		t.Fatalf("depth %d after taking the stairs, want 2", g.Depth)
+	}
+	if g.Level.At(g.Pos) == dungeon.Wall || g.Score() != 200 {
+		t.Errorf("landed on %v with score %d", g.Pos, g.Score())
+	}
+}
+
+func TestMonstersChase(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	clear(g)
+
+	m := &Monster{Name: "rat", Pos: g.Pos.Add(Right).Add(Right), Stats: combat.Stats{HP: 5, MaxHP: 5}, awake: true}
+	g.Monsters = []*Monster{m}
+
+	g.Wait()
+	if m.Pos != g.Pos.Add(Right) {
+		t.Errorf("monster at %v, want it next to the player at %v", m.Pos, g.Pos)
+	}
+}
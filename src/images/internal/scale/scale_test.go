@@ -0,0 +1,58 @@
+package scale
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// photo is a stand-in for a 4K photo: smooth gradients with fine stripes
+// across them, which is where the filters differ.
+func photo() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3840, 2160))
+	for y := range 2160 {
+		for x := range 3840 {
+			stripe := uint8(0)
+			if x%7 < 2 {
+				stripe = 60
+			}
+			img.Set(x, y, color.RGBA{uint8(x * 255 / 3840), uint8(y * 255 / 2160), 128 + stripe, 0xff})
+		}
+	}
+	return img
+}
+
+func TestTo(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 50, 30))
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 50; x++ {
+			img.Set(x, y, color.RGBA{200, 100, 50, 0xff})
+		}
+	}
+
+	for _, name := range []string{"nearest", "bilinear", "lanczos", "unknown"} {
+		out := To(img, 8, 4, name)
+		if out.Bounds() != image.Rect(0, 0, 8, 4) {
+			t.Errorf("%s: bounds %v", name, out.Bounds())
+		}
+		// A single color stays itself however it's scaled.
+		if c := out.RGBAAt(3, 2); c != (color.RGBA{200, 100, 50, 0xff}) {
+			t.Errorf("%s: %v at 3, 2", name, c)
+		}
+	}
+}
+
+// BenchmarkFilters scales a 4K image down to a wide render's size by
+// each filter. nearest is fastest by far; bilinear and lanczos cost more
+// the bigger the source, as they read all of it, and give smoother,
+// sharper results for it.
+func BenchmarkFilters(b *testing.B) {
+	img := photo()
+	for _, name := range []string{"nearest", "bilinear", "lanczos"} {
+		b.Run(name, func(b *testing.B) {
+			for range b.N {
+				To(img, 200, 56, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package snake implements the rules of Snake: movement, growth, food and
+// collisions. Timing and drawing are left to the caller.
+package snake
+
+import "math/rand"
+
+type Point struct{ X, Y int }
+
+var (
+	Up    = Point{0, -1}
+	Down  = Point{0, 1}
+	Left  = Point{-1, 0}
+	Right = Point{1, 0}
+)
+
+type Game struct {
+	Width, Height int
+
+	// Wrap makes the snake come out of the opposite wall instead of
+	// dying when it hits one.
+	Wrap bool
+
+	// Body runs from head to tail.
+	Body []Point
+	Dir  Point
+	Food Point
+
+	Score int
+	Over  bool
+
+	next Point
+	rng  *rand.Rand
+}
+
+// New starts a three-segment snake in the middle of the field heading right.
+func New(width, height int, wrap bool, rng *rand.Rand) *Game {
+	g := &Game{Width: width, Height: height, Wrap: wrap, Dir: Right, next: Right, rng: rng}
+
+	mid := Point{width / 2, height / 2}
+	for i := range 3 {
+		g.Body = append(g.Body, Point{mid.X - i, mid.Y})
+	}
+
+	g.placeFood()
+	return g
+}
+
+// Turn queues a direction change for the next step. Reversing straight
+// into the neck is ignored.
+func (g *Game) Turn(d Point) {
+	if d.X == -g.Dir.X && d.Y == -g.Dir.Y {
+		return
+	}
+	g.next = d
+}
+
+// Head returns the position of the snake's head.
+func (g *Game) Head() Point {
+	return g.Body[0]
+}
+
+// Occupies reports whether any segment of the snake is on p.
+func (g *Game) Occupies(p Point) bool {
+	for _, b := range g.Body {
+		if b == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Step advances the snake by one cell and reports whether it ate.
+func (g *Game) Step() bool {
+	if g.Over {
+		return false
+	}
+
+	g.Dir = g.next
+	head := Point{g.Head().X + g.Dir.X, g.Head().Y + g.Dir.Y}
+
+	if g.Wrap {
+		head.X = (head.X + g.Width) % g.Width
+		head.Y = (head.Y + g.Height) % g.Height
+	} else if head.X < 0 || head.Y < 0 || head.X >= g.Width || head.Y >= g.Height {
+		g.Over = true
+		return false
+	}
+
+	ate := head == g.Food
+
+	// The tail moves out of the way this step unless the snake is growing.
+	body := g.Body
+	if !ate {
+		body = body[:len(body)-1]
+	}
+	for _, b := range body {
+		if b == head {
+			g.Over = true
+			return false
+		}
+	}
+
+	g.Body = append([]Point{head}, body...)
+
+	if ate {
+		g.Score++
+		g.placeFood()
+	}
+	return ate
+}
+
+// placeFood drops food on a random free cell. A snake that fills the whole
+// field has nowhere left to go, which ends the game.
+func (g *Game) placeFood() {
+	var free []Point
+	for y := range g.Height {
+		for x := range g.Width {
+			p := Point{x, y}
+			if !g.Occupies(p) {
+				free = append(free, p)
+			}
+		}
+	}
+
+	if len(free) == 0 {
+		g.Over = true
+		return
+	}
+	g.Food = free[g.rng.Intn(len(free))]
+}
@@ -0,0 +1,106 @@
+package snake
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFoodNeverOnSnake(t *testing.T) {
+	for seed := range int64(200) {
+		g := New(4, 3, true, rand.New(rand.NewSource(seed)))
+		for !g.Over {
+			if g.Occupies(g.Food) {
+				t.Fatalf("seed %d: food %v placed on snake %v", seed, g.Food, g.Body)
+			}
+			// Chase the food to fill the field quickly.
+			h := g.Head()
+			switch {
+			case g.Food.X != h.X:
+				g.Turn(Point{sign(g.Food.X - h.X), 0})
+			default:
+				g.Turn(Point{0, sign(g.Food.Y - h.Y)})
+			}
+			g.Step()
+		}
+	}
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	}
+	return 1
+}
+
+func TestWallCollision(t *testing.T) {
+	g := New(10, 5, false, rand.New(rand.NewSource(1)))
+	g.Food = Point{0, 0}
+
+	for i := 0; i < 10 && !g.Over; i++ {
+		g.Step()
+	}
+	if !g.Over {
+		t.Fatal("snake drove through the right wall")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	g := New(10, 5, true, rand.New(rand.NewSource(1)))
+	g.Food = Point{0, 0}
+	g.Body = []Point{{9, 2}, {8, 2}, {7, 2}}
+
+	g.Step()
+	if g.Over || g.Head() != (Point{0, 2}) {
+		t.Fatalf("expected wrap to (0,2), got head %v over=%v", g.Head(), g.Over)
+	}
+}
+
+func TestSelfCollision(t *testing.T) {
+	g := New(10, 10, false, rand.New(rand.NewSource(1)))
+	g.Food = Point{0, 0}
+	g.Body = []Point{{5, 5}, {4, 5}, {4, 6}, {5, 6}, {6, 6}}
+
+	g.Turn(Down)
+	g.Step()
+	if !g.Over {
+		t.Fatal("snake turned into its own body")
+	}
+}
+
+func TestChasingTailIsAllowed(t *testing.T) {
+	g := New(10, 10, false, rand.New(rand.NewSource(1)))
+	g.Food = Point{0, 0}
+	// A 2x2 loop: the head moves onto the cell the tail is leaving.
+	g.Body = []Point{{5, 5}, {5, 6}, {6, 6}, {6, 5}}
+	g.Dir = Up
+
+	g.Turn(Right)
+	g.Step()
+	if g.Over {
+		t.Fatal("moving into the vacating tail cell ended the game")
+	}
+}
+
+func TestReverseIgnored(t *testing.T) {
+	g := New(10, 5, false, rand.New(rand.NewSource(1)))
+	g.Food = Point{0, 0}
+
+	g.Turn(Left)
+	g.Step()
+	if g.Over || g.Dir != Right {
+		t.Fatalf("reversal was applied: dir %v over=%v", g.Dir, g.Over)
+	}
+}
+
+func TestEatingGrows(t *testing.T) {
+	g := New(10, 5, false, rand.New(rand.NewSource(1)))
+	h := g.Head()
+	g.Food = Point{h.X + 1, h.Y}
+
+	if !g.Step() {
+		t.Fatal("Step did not report eating")
+	}
+	if len(g.Body) != 4 || g.Score != 1 {
+		t.Fatalf("after eating: len %d score %d", len(g.Body), g.Score)
+	}
+}
@@ -0,0 +1,227 @@
+// Package tetris implements the rules of Tetris: the seven pieces,
+// moving and rotating them, collisions, and clearing full rows. Timing,
+// input and drawing are left to the caller.
+package tetris
+
+import "math/rand"
+
+const (
+	Width  = 10
+	Height = 20
+)
+
+// A Kind is one of the seven pieces, or Empty for a square with nothing
+// in it.
+type Kind int
+
+const (
+	Empty Kind = iota
+	I
+	O
+	T
+	S
+	Z
+	J
+	L
+)
+
+var Kinds = []Kind{I, O, T, S, Z, J, L}
+
+type Point struct{ X, Y int }
+
+// A shape is a piece's squares as it spawns, within a box size squares a
+// side that it rotates in.
+type shape struct {
+	size    int
+	squares []Point
+}
+
+var shapes = map[Kind]shape{
+	I: {4, []Point{{0, 1}, {1, 1}, {2, 1}, {3, 1}}},
+	O: {2, []Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}}},
+	T: {3, []Point{{1, 0}, {0, 1}, {1, 1}, {2, 1}}},
+	S: {3, []Point{{1, 0}, {2, 0}, {0, 1}, {1, 1}}},
+	Z: {3, []Point{{0, 0}, {1, 0}, {1, 1}, {2, 1}}},
+	J: {3, []Point{{0, 0}, {0, 1}, {1, 1}, {2, 1}}},
+	L: {3, []Point{{2, 0}, {0, 1}, {1, 1}, {2, 1}}},
+}
+
+// Points for clearing one, two, three or four rows at once.
+var line_scores = []int{0, 100, 300, 500, 800}
+
+// A Piece is a kind turned Rot quarter turns clockwise, with the top left
+// of its box at X, Y.
+type Piece struct {
+	Kind Kind
+	X, Y int
+	Rot  int
+}
+
+// Squares is where on the board p is.
+func (p Piece) Squares() []Point {
+	s := shapes[p.Kind]
+	out := make([]Point, len(s.squares))
+	for i, q := range s.squares {
+		for range p.Rot % 4 {
+			q = Point{s.size - 1 - q.Y, q.X}
+		}
+		out[i] = Point{p.X + q.X, p.Y + q.Y}
+	}
+	return out
+}
+
+type Game struct {
+	// Board holds the pieces that have landed, row by row from the top.
+	Board [Height][Width]Kind
+
+	// Piece is the one falling, and Next the kind that comes after.
+	Piece Piece
+	Next  Kind
+
+	Score, Lines int
+	Over         bool
+
+	rng *rand.Rand
+}
+
+// New is an empty board with the first piece at the top.
+func New(rng *rand.Rand) *Game {
+	g := &Game{rng: rng}
+	g.Next = g.random()
+	g.spawn()
+	return g
+}
+
+func (g *Game) random() Kind {
+	return Kinds[g.rng.Intn(len(Kinds))]
+}
+
+// spawn starts the next piece at the top in the middle. One that has no
+// room there ends the game.
+func (g *Game) spawn() {
+	g.Piece = Piece{Kind: g.Next, X: (Width - shapes[g.Next].size) / 2}
+	g.Next = g.random()
+	if !g.fits(g.Piece) {
+		g.Over = true
+	}
+}
+
+// fits reports whether p is within the walls and floor and clear of what's
+// landed. Above the top is allowed, for rotating as a piece spawns.
+func (g *Game) fits(p Piece) bool {
+	for _, q := range p.Squares() {
+		if q.X < 0 || q.X >= Width || q.Y >= Height {
+			return false
+		}
+		if q.Y >= 0 && g.Board[q.Y][q.X] != Empty {
+			return false
+		}
+	}
+	return true
+}
+
+// At is what's on the board at p, falling piece included.
+func (g *Game) At(p Point) Kind {
+	for _, q := range g.Piece.Squares() {
+		if q == p {
+			return g.Piece.Kind
+		}
+	}
+	return g.Board[p.Y][p.X]
+}
+
+// Move shifts the piece dx columns, if there's room, and reports whether
+// it did.
+func (g *Game) Move(dx int) bool {
+	p := g.Piece
+	p.X += dx
+	if g.Over || !g.fits(p) {
+		return false
+	}
+	g.Piece = p
+	return true
+}
+
+// Rotate turns the piece a quarter turn clockwise. A piece against a wall
+// or another is nudged a column or two sideways if that gives it room;
+// failing that, it doesn't turn.
+func (g *Game) Rotate() bool {
+	if g.Over {
+		return false
+	}
+	for _, kick := range []int{0, -1, 1, -2, 2} {
+		p := g.Piece
+		p.Rot = (p.Rot + 1) % 4
+		p.X += kick
+		if g.fits(p) {
+			g.Piece = p
+			return true
+		}
+	}
+	return false
+}
+
+// Drop moves the piece down a row. One that can't go any lower lands
+// instead: it's fixed to the board, full rows are cleared, and the next
+// piece spawns. Drop reports whether the piece fell.
+func (g *Game) Drop() bool {
+	if g.Over {
+		return false
+	}
+	p := g.Piece
+	p.Y++
+	if g.fits(p) {
+		g.Piece = p
+		return true
+	}
+	g.land()
+	return false
+}
+
+// HardDrop drops the piece as far as it goes, lands it, and says how many
+// rows it fell.
+func (g *Game) HardDrop() int {
+	n := 0
+	for g.Drop() {
+		n++
+	}
+	return n
+}
+
+func (g *Game) land() {
+	for _, q := range g.Piece.Squares() {
+		if q.Y < 0 {
+			// Landing with a square still above the top is topping out.
+			g.Over = true
+			return
+		}
+		g.Board[q.Y][q.X] = g.Piece.Kind
+	}
+	n := g.clear()
+	g.Lines += n
+	g.Score += line_scores[n]
+	g.spawn()
+}
+
+// clear takes out every full row, moving those above down, and says how
+// many there were.
+func (g *Game) clear() int {
+	n := 0
+	for y := Height - 1; y >= 0; y-- {
+		full := true
+		for _, k := range g.Board[y] {
+			if k == Empty {
+				full = false
+				break
+			}
+		}
+		if !full {
+			continue
+		}
+		copy(g.Board[1:y+1], g.Board[:y])
+		g.Board[0] = [Width]Kind{}
+		n++
+		y++
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package tetris
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func sorted(ps []Point) []Point {
+	slices.SortFunc(ps, func(a, b Point) int {
+		if a.Y != b.Y {
+			return a.Y - b.Y
+		}
+		return a.X - b.X
+	})
+	return ps
+}
+
+func TestFourTurnsGoRound(t *testing.T) {
+	for _, k := range Kinds {
+		p := Piece{Kind: k, X: 3, Y: 5}
+		start := sorted(p.Squares())
+		for range 4 {
+			p.Rot++
+			if got := p.Squares(); len(got) != 4 {
+				t.Fatalf("%v turned %d times has %d squares", k, p.Rot, len(got))
+			}
+		}
+		if got := sorted(p.Squares()); !slices.Equal(got, start) {
+			t.Errorf("%v turned all the way round is at %v, not %v", k, got, start)
+		}
+	}
+}
+
+func TestWalls(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	for g.Move(-1) {
+	}
+	for _, q := range g.Piece.Squares() {
+		if q.X < 0 {
+			t.Fatalf("moved through the left wall to %v", q)
+		}
+	}
+	for g.Move(1) {
+	}
+	for _, q := range g.Piece.Squares() {
+		if q.X >= Width {
+			t.Fatalf("moved through the right wall to %v", q)
+		}
+	}
+}
+
+func TestHardDropLands(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	g.Piece = Piece{Kind: O, X: 0}
+	if n := g.HardDrop(); n != Height-2 {
+		t.Errorf("an O fell %d rows, want %d", n, Height-2)
+	}
+	if g.Board[Height-1][0] != O || g.Board[Height-2][1] != O {
+		t.Errorf("the O didn't land in the bottom corner")
+	}
+	if g.Piece.Y != 0 {
+		t.Errorf("no new piece at the top after landing")
+	}
+}
+
+func TestClearLines(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	for x := range Width - 1 {
+		g.Board[Height-1][x] = T
+		g.Board[Height-2][x] = T
+	}
+	g.Board[Height-3][4] = S
+
+	// An I stood upright in the gap fills both bottom rows.
+	g.Piece = Piece{Kind: I, X: Width - 3, Rot: 1}
+	g.HardDrop()
+
+	if g.Lines != 2 || g.Score != 300 {
+		t.Errorf("lines %d, score %d; want 2 and 300", g.Lines, g.Score)
+	}
+	if g.Board[Height-1][4] != S {
+		t.Errorf("the row above didn't come down")
+	}
+	if g.Board[Height-1][Width-1] != I || g.Board[Height-2][Width-1] != I {
+		t.Errorf("the rest of the I isn't left on the bottom two rows")
+	}
+}
+
+func TestRotateKicksOffWall(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	g.Piece = Piece{Kind: I, X: -2, Y: 5, Rot: 1}
+	if !g.fits(g.Piece) {
+		t.Fatal("an upright I against the left wall doesn't fit")
+	}
+	if !g.Rotate() {
+		t.Fatal("an upright I against the wall wouldn't turn")
+	}
+	for _, q := range g.Piece.Squares() {
+		if q.X < 0 {
+			t.Fatalf("turned into the wall at %v", q)
+		}
+	}
+}
+
+func TestToppingOut(t *testing.T) {
+	g := New(rand.New(rand.NewSource(1)))
+	for !g.Over {
+		g.HardDrop()
+	}
+	if g.Drop() || g.Move(1) || g.Rotate() {
+		t.Error("a finished game still moves")
+	}
+}
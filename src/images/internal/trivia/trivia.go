@@ -0,0 +1,200 @@
+// Package trivia loads and checks multiple-choice question packs, picks
+// rounds from them and scores answers by how quickly they came.
+package trivia
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	MinChoices = 2
+	MaxChoices = 6
+
+	// A right answer is worth MaxPoints given at once, falling to
+	// MaxPoints/2 given at the last moment.
+	MaxPoints = 1000
+)
+
+var Difficulties = []string{"easy", "medium", "hard"}
+
+// A Question is one entry of a pack. Answer indexes Choices.
+type Question struct {
+	Question   string   `json:"question"`
+	Choices    []string `json:"choices"`
+	Answer     int      `json:"answer"`
+	Category   string   `json:"category,omitempty"`
+	Difficulty string   `json:"difficulty,omitempty"`
+}
+
+// A pack file is a JSON object with a list of questions.
+type pack struct {
+	Questions []Question `json:"questions"`
+}
+
+// starter.json is the pack every server has.
+//
+//go:embed starter.json
+var starter_json []byte
+
+// Starter returns the embedded pack.
+func Starter() []Question {
+	qs, err := Parse(starter_json)
+	if err != nil {
+		panic("trivia: starter pack: " + err.Error())
+	}
+	return qs
+}
+
+// Parse reads and checks a pack. Unknown fields are an error, so a typo
+// in a field name doesn't quietly drop what it was meant to set.
+func Parse(data []byte) ([]Question, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p pack
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	if len(p.Questions) == 0 {
+		return nil, errors.New("no questions")
+	}
+	for i := range p.Questions {
+		q := &p.Questions[i]
+		q.Category = strings.ToLower(strings.TrimSpace(q.Category))
+		q.Difficulty = strings.ToLower(strings.TrimSpace(q.Difficulty))
+		if err := q.check(); err != nil {
+			return nil, fmt.Errorf("question %d: %w", i+1, err)
+		}
+	}
+	return p.Questions, nil
+}
+
+func (q *Question) check() error {
+	if strings.TrimSpace(q.Question) == "" {
+		return errors.New("no question text")
+	}
+	if len(q.Choices) < MinChoices || len(q.Choices) > MaxChoices {
+		return fmt.Errorf("%d choices, want %d to %d", len(q.Choices), MinChoices, MaxChoices)
+	}
+	for i, c := range q.Choices {
+		if strings.TrimSpace(c) == "" {
+			return fmt.Errorf("choice %d is empty", i+1)
+		}
+	}
+	if q.Answer < 0 || q.Answer >= len(q.Choices) {
+		return fmt.Errorf("answer %d isn't one of the %d choices (they count from 0)", q.Answer, len(q.Choices))
+	}
+	if strings.ContainsAny(q.Category, " \t") {
+		return fmt.Errorf("category %q has spaces; use dashes", q.Category)
+	}
+	if q.Difficulty != "" && !valid_difficulty(q.Difficulty) {
+		return fmt.Errorf("difficulty %q isn't one of %s", q.Difficulty, strings.Join(Difficulties, ", "))
+	}
+	return nil
+}
+
+func valid_difficulty(d string) bool {
+	for _, v := range Difficulties {
+		if d == v {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDir reads every .json file in dir, in name order. The error names
+// the first file that doesn't parse.
+func LoadDir(dir string) ([]Question, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var all []Question
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		qs, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		all = append(all, qs...)
+	}
+	return all, nil
+}
+
+// A Bank is every question the server can ask. Questions with the same
+// text count once, the first one loaded winning.
+type Bank struct {
+	questions []Question
+}
+
+func NewBank(qs ...[]Question) *Bank {
+	b := &Bank{}
+	seen := map[string]bool{}
+	for _, pack := range qs {
+		for _, q := range pack {
+			if !seen[q.Question] {
+				seen[q.Question] = true
+				b.questions = append(b.questions, q)
+			}
+		}
+	}
+	return b
+}
+
+func (b *Bank) Len() int { return len(b.questions) }
+
+// Categories lists the categories asked about, with how many questions
+// each has.
+func (b *Bank) Categories() map[string]int {
+	out := map[string]int{}
+	for _, q := range b.questions {
+		if q.Category != "" {
+			out[q.Category]++
+		}
+	}
+	return out
+}
+
+// Pick chooses up to n questions in the category and difficulty, either
+// of which may be empty for any. Questions in seen, by text, are only
+// used once the unseen ones run out.
+func (b *Bank) Pick(rng *rand.Rand, category, difficulty string, n int, seen map[string]bool) []Question {
+	var fresh, stale []Question
+	for _, q := range b.questions {
+		if category != "" && q.Category != category || difficulty != "" && q.Difficulty != difficulty {
+			continue
+		}
+		if seen[q.Question] {
+			stale = append(stale, q)
+		} else {
+			fresh = append(fresh, q)
+		}
+	}
+	rng.Shuffle(len(fresh), func(i, j int) { fresh[i], fresh[j] = fresh[j], fresh[i] })
+	rng.Shuffle(len(stale), func(i, j int) { stale[i], stale[j] = stale[j], stale[i] })
+
+	return append(fresh, stale...)[:min(n, len(fresh)+len(stale))]
+}
+
+// Points is what a right answer given after took, out of limit, is worth.
+func Points(took, limit time.Duration) int {
+	left := 1 - min(max(float64(took)/float64(limit), 0), 1)
+	return MaxPoints/2 + int(float64(MaxPoints/2)*left+0.5)
+}
@@ -0,0 +1,125 @@
+package trivia
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStarter(t *testing.T) {
+	qs := Starter()
+	if len(qs) < 20 {
+		t.Fatalf("starter pack has %d questions", len(qs))
+	}
+	for _, q := range qs {
+		if q.Category == "" || q.Difficulty == "" {
+			t.Errorf("%q has no category or difficulty", q.Question)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, json, err string
+	}{
+		{"good", `{"questions": [{"question": "q", "choices": ["a", "b"], "answer": 1, "difficulty": "Easy"}]}`, ""},
+		{"empty", `{"questions": []}`, "no questions"},
+		{"one choice", `{"questions": [{"question": "q", "choices": ["a"], "answer": 0}]}`, "question 1: 1 choices"},
+		{"seven choices", `{"questions": [{"question": "q", "choices": ["a","b","c","d","e","f","g"], "answer": 0}]}`, "7 choices"},
+		{"answer out of range", `{"questions": [{"question": "q", "choices": ["a", "b"], "answer": 2}]}`, "answer 2"},
+		{"blank choice", `{"questions": [{"question": "q", "choices": ["a", " "], "answer": 0}]}`, "choice 2 is empty"},
+		{"no text", `{"questions": [{"choices": ["a", "b"], "answer": 0}]}`, "no question text"},
+		{"bad difficulty", `{"questions": [{"question": "q", "choices": ["a", "b"], "answer": 0, "difficulty": "brutal"}]}`, "difficulty"},
+		{"spaced category", `{"questions": [{"question": "q", "choices": ["a", "b"], "answer": 0, "category": "pop music"}]}`, "spaces"},
+		{"unknown field", `{"questions": [{"question": "q", "choices": ["a", "b"], "correct": 0}]}`, "unknown field"},
+		{"not json", `questions`, "invalid"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.json))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got %v, want an error with %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.json", `{"questions": [{"question": "one", "choices": ["a", "b"], "answer": 0}]}`)
+	write("notes.txt", "not a pack")
+
+	qs, err := LoadDir(dir)
+	if err != nil || len(qs) != 1 {
+		t.Fatalf("LoadDir = %d questions, %v", len(qs), err)
+	}
+
+	write("b.json", `{"questions": [{"question": "two", "choices": ["a"], "answer": 0}]}`)
+	if _, err := LoadDir(dir); err == nil || !strings.Contains(err.Error(), "b.json") {
+		t.Errorf("a bad pack gave %v, want it named", err)
+	}
+
+	if _, err := LoadDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("a missing directory loaded")
+	}
+}
+
+func TestPick(t *testing.T) {
+	q := func(text, cat, diff string) Question {
+		return Question{Question: text, Choices: []string{"a", "b"}, Category: cat, Difficulty: diff}
+	}
+	b := NewBank([]Question{
+		q("1", "science", "easy"), q("2", "science", "hard"), q("3", "history", "easy"), q("4", "history", "hard"),
+	}, []Question{q("1", "history", "hard")})
+
+	if b.Len() != 4 {
+		t.Errorf("bank has %d questions, want the repeat dropped", b.Len())
+	}
+	if cats := b.Categories(); cats["science"] != 2 || cats["history"] != 2 {
+		t.Errorf("Categories = %v", cats)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	if got := b.Pick(rng, "science", "hard", 5, nil); len(got) != 1 || got[0].Question != "2" {
+		t.Errorf("science/hard picked %v", got)
+	}
+	if got := b.Pick(rng, "", "easy", 5, nil); len(got) != 2 {
+		t.Errorf("easy picked %v", got)
+	}
+
+	// Seen questions only come after the rest.
+	seen := map[string]bool{"1": true, "2": true, "3": true}
+	for range 10 {
+		got := b.Pick(rng, "", "", 2, seen)
+		if len(got) != 2 || got[0].Question != "4" {
+			t.Fatalf("with 1-3 seen picked %v", got)
+		}
+	}
+}
+
+func TestPoints(t *testing.T) {
+	tests := []struct {
+		took time.Duration
+		want int
+	}{
+		{0, MaxPoints},
+		{5 * time.Second, 750},
+		{10 * time.Second, MaxPoints / 2},
+		{time.Minute, MaxPoints / 2},
+	}
+	for _, tt := range tests {
+		if got := Points(tt.took, 10*time.Second); got != tt.want {
+			t.Errorf("Points(%v) = %d, want %d", tt.took, got, tt.want)
+		}
+	}
+}
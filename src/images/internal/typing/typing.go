@@ -0,0 +1,148 @@
+// Package typing scores typing tests: it aligns what was typed against the
+// passage so that one dropped or doubled character counts as one mistake
+// rather than shifting every character after it.
+package typing
+
+import (
+	_ "embed"
+	"math/rand"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// passages.txt holds the corpus, one paragraph per line.
+//
+//go:embed passages.txt
+var passages_txt string
+
+var passages = strings.Split(strings.TrimSpace(passages_txt), "\n")
+
+// Lengths are the passage lengths that can be asked for, with the most
+// characters a passage of each length may have.
+var Lengths = map[string]int{
+	"short":  200,
+	"medium": 350,
+	"long":   1 << 30,
+}
+
+// Passage picks a random passage of the given length, which must be one
+// of Lengths. Each length picks up where the one below it stops.
+func Passage(length string, rng *rand.Rand) string {
+	lo := 0
+	for _, l := range Lengths {
+		if l < Lengths[length] {
+			lo = max(lo, l)
+		}
+	}
+
+	var pick []string
+	for _, p := range passages {
+		if n := utf8.RuneCountInString(p); n > lo && n <= Lengths[length] {
+			pick = append(pick, p)
+		}
+	}
+	return pick[rng.Intn(len(pick))]
+}
+
+type Op int
+
+const (
+	Match      Op = iota
+	Substitute    // the wrong character was typed
+	Insert        // an extra character was typed
+	Delete        // a character of the passage was skipped
+)
+
+// A Step is one position of an alignment. Want is zero for an Insert and
+// Got is zero for a Delete.
+type Step struct {
+	Op        Op
+	Want, Got rune
+}
+
+// Align finds the cheapest way to turn want into got, counting every
+// substitution, insertion and deletion as one edit.
+func Align(want, got string) []Step {
+	w, g := []rune(want), []rune(got)
+
+	// cost[i][j] is the edit distance between w[i:] and g[j:].
+	cost := make([][]int, len(w)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(g)+1)
+	}
+	for i := len(w); i >= 0; i-- {
+		for j := len(g); j >= 0; j-- {
+			switch {
+			case i == len(w):
+				cost[i][j] = len(g) - j
+			case j == len(g):
+				cost[i][j] = len(w) - i
+			case w[i] == g[j]:
+				cost[i][j] = cost[i+1][j+1]
+			default:
+				cost[i][j] = 1 + min(cost[i+1][j+1], cost[i][j+1], cost[i+1][j])
+			}
+		}
+	}
+
+	var steps []Step
+	i, j := 0, 0
+	for i < len(w) || j < len(g) {
+		switch {
+		case i < len(w) && j < len(g) && w[i] == g[j] && cost[i][j] == cost[i+1][j+1]:
+			steps = append(steps, Step{Match, w[i], g[j]})
+			i, j = i+1, j+1
+		case i < len(w) && j < len(g) && cost[i][j] == 1+cost[i+1][j+1]:
+			steps = append(steps, Step{Substitute, w[i], g[j]})
+			i, j = i+1, j+1
+		case j < len(g) && cost[i][j] == 1+cost[i][j+1]:
+			steps = append(steps, Step{Insert, 0, g[j]})
+			j++
+		default:
+			steps = append(steps, Step{Delete, w[i], 0})
+			i++
+		}
+	}
+	return steps
+}
+
+// Result summarises a finished test.
+type Result struct {
+	Steps   []Step
+	Correct int // characters typed that match the passage
+	Errors  int // edits needed to make the typing match
+	Length  int // characters in the passage
+
+	Elapsed time.Duration
+}
+
+func Score(want, got string, elapsed time.Duration) Result {
+	r := Result{Steps: Align(want, got), Length: utf8.RuneCountInString(want), Elapsed: elapsed}
+	for _, s := range r.Steps {
+		if s.Op == Match {
+			r.Correct++
+		} else {
+			r.Errors++
+		}
+	}
+	return r
+}
+
+// WPM is the speed in words per minute, counting only correct characters
+// and taking a word to be five of them.
+func (r Result) WPM() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Correct) / 5 / r.Elapsed.Minutes()
+}
+
+// Accuracy is the share of alignment steps that matched, as a percentage,
+// so both mistakes and missed characters bring it down.
+func (r Result) Accuracy() float64 {
+	if len(r.Steps) == 0 {
+		return 0
+	}
+	return 100 * float64(r.Correct) / float64(len(r.Steps))
+}
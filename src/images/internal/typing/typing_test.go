@@ -0,0 +1,66 @@
+package typing
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func ops(steps []Step) string {
+	letters := map[Op]byte{Match: '=', Substitute: 's', Insert: 'i', Delete: 'd'}
+	var b []byte
+	for _, s := range steps {
+		b = append(b, letters[s.Op])
+	}
+	return string(b)
+}
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		want, got, ops string
+	}{
+		{"the cat", "the cat", "======="},
+		{"the cat", "the bat", "====s=="},
+		// A dropped character is one mistake, not one per character after.
+		{"the cat sat", "th cat sat", "==d========"},
+		{"the cat sat", "thee cat sat", "===i========"},
+		{"the cat sat", "the sat", "====dddd==="},
+		{"abc", "", "ddd"},
+		{"", "abc", "iii"},
+	}
+
+	for _, tt := range tests {
+		if got := ops(Align(tt.want, tt.got)); got != tt.ops {
+			t.Errorf("Align(%q, %q) = %s, want %s", tt.want, tt.got, got, tt.ops)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	// 48 correct characters in a minute is 9.6 WPM.
+	want := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	r := Score(want, want[2:]+"b", time.Minute)
+
+	// One character missed and one typed wrong.
+	if r.Correct != 48 || r.Errors != 2 {
+		t.Errorf("got %d correct and %d errors, want 48 and 2", r.Correct, r.Errors)
+	}
+	if wpm := r.WPM(); wpm != 9.6 {
+		t.Errorf("WPM = %.2f, want 9.6", wpm)
+	}
+	if acc := r.Accuracy(); acc != 96 {
+		t.Errorf("Accuracy = %.2f, want 96", acc)
+	}
+}
+
+func TestPassage(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for length, most := range Lengths {
+		for range 20 {
+			if n := utf8.RuneCountInString(Passage(length, rng)); n > most {
+				t.Errorf("%s passage has %d characters", length, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package usertext makes text people type safe to show on other
+// people's terminals, and measures it in the columns it takes up there,
+// so that tables and boards with names in them stay lined up.
+package usertext
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// max_marks is how many combining marks one character keeps. Real
+// scripts rarely stack more than two; piles of them are only there to
+// spill onto the lines above and below.
+const max_marks = 2
+
+const zwj = '\u200d'
+
+// bidi reports whether c changes the direction text is drawn in, which
+// can make what follows it on the line read backwards.
+func bidi(c rune) bool {
+	switch {
+	case c == '\u061c', c == '\u200e', c == '\u200f':
+		return true
+	case c >= '\u202a' && c <= '\u202e', c >= '\u2066' && c <= '\u2069':
+		return true
+	}
+	return false
+}
+
+func mark(c rune) bool {
+	return unicode.In(c, unicode.Mn, unicode.Me)
+}
+
+// Clean makes s safe to print as part of one line: bytes that aren't
+// UTF-8 become U+FFFD, tabs become spaces, and control characters,
+// escape sequences' introducers among them, are dropped, as are line
+// and paragraph separators and bidi controls. Combining marks with
+// nothing to combine with are dropped, and no character keeps more than
+// a couple.
+func Clean(s string) string {
+	var b strings.Builder
+	marks, base := 0, false
+	for _, c := range s {
+		switch {
+		case c == '\t':
+			c = ' '
+		case unicode.IsControl(c), bidi(c), unicode.In(c, unicode.Zl, unicode.Zp):
+			continue
+		}
+
+		if mark(c) {
+			if !base || marks == max_marks {
+				continue
+			}
+			marks++
+		} else {
+			marks, base = 0, true
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// RuneWidth is how many terminal columns c takes up on its own.
+func RuneWidth(c rune) int {
+	switch {
+	case unicode.In(c, unicode.Mn, unicode.Me, unicode.Cf) || unicode.IsControl(c):
+		return 0
+	case unicode.Is(unicode.So, c) && c >= 0x1F000:
+		// Emoji are drawn double width whatever their listed width.
+		return 2
+	}
+
+	switch width.LookupRune(c).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// regional reports whether c is one of the letters flags are spelled in.
+func regional(c rune) bool {
+	return c >= 0x1F1E6 && c <= 0x1F1FF
+}
+
+// each calls fn with every rune of s, where it starts, and the columns
+// it adds in context: a character joined onto the one before by a
+// zero-width joiner, or the second letter of a flag, adds nothing, as
+// they're drawn as one. It stops when fn returns false.
+func each(s string, fn func(i int, c rune, w int) bool) {
+	joined, flag := false, false
+	for i, c := range s {
+		w := RuneWidth(c)
+		switch {
+		case joined:
+			w = 0
+		case regional(c) && flag:
+			w, flag = 0, false
+		case regional(c):
+			flag = true
+		case w > 0:
+			flag = false
+		}
+		joined = c == zwj
+		if !fn(i, c, w) {
+			return
+		}
+	}
+}
+
+// Width is how many terminal columns s takes up.
+func Width(s string) int {
+	n := 0
+	each(s, func(_ int, _ rune, w int) bool {
+		n += w
+		return true
+	})
+	return n
+}
+
+// Truncate cuts s down to at most cols columns. A wide character that
+// would straddle the edge is left out whole, and combining marks go with
+// the character they're on.
+func Truncate(s string, cols int) string {
+	n, end := 0, len(s)
+	each(s, func(i int, _ rune, w int) bool {
+		if n+w > cols {
+			end = i
+			return false
+		}
+		n += w
+		return true
+	})
+	return s[:end]
+}
+
+// Pad fills s out with spaces to cols columns, as %-*s would if every
+// character were one column wide. Longer text is left as it is.
+func Pad(s string, cols int) string {
+	return s + strings.Repeat(" ", max(cols-Width(s), 0))
+}
+
+// PadLeft is Pad with the spaces in front, as %*s.
+func PadLeft(s string, cols int) string {
+	return strings.Repeat(" ", max(cols-Width(s), 0)) + s
+}
+
+// Fit truncates or pads s to exactly cols columns.
+func Fit(s string, cols int) string {
+	return Pad(Truncate(s, cols), cols)
+}
+
+// Cells splits s into one string per column, for drawing into a grid. A
+// character is kept with whatever is drawn as part of it; a wide one is
+// followed by an empty cell for the column it covers.
+func Cells(s string) []string {
+	var cells []string
+	each(s, func(_ int, c rune, w int) bool {
+		switch {
+		case w == 0 && len(cells) > 0:
+			// Follow a wide character's own cell, not its empty one.
+			i := len(cells) - 1
+			if cells[i] == "" && i > 0 {
+				i--
+			}
+			cells[i] += string(c)
+		case w == 0:
+		case w == 1:
+			cells = append(cells, string(c))
+		default:
+			cells = append(cells, string(c), "")
+		}
+		return true
+	})
+	return cells
+}
@@ -0,0 +1,136 @@
+package usertext
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain text":        "plain text",
+		"tab\there":         "tab here",
+		"line\r\nfeed":      "linefeed",
+		"bad \xff\xfe byte": "bad \ufffd\ufffd byte",
+		"日本語":               "日本語",
+		"cafe\u0301":        "cafe\u0301",
+
+		// Marks with nothing under them, and too many on one letter.
+		"\u0301start":               "start",
+		"z\u0301\u0302\u0303\u0304": "z\u0301\u0302",
+
+		// Bidi overrides could turn the rest of a line around.
+		"evil\u202egpj.exe": "evilgpj.exe",
+		"a\u2066b\u2069c":   "abc",
+		"one\u2028two":      "onetwo",
+
+		// Emoji sequences keep their joiners and variation selectors.
+		"👩\u200d💻 ok": "👩\u200d💻 ok",
+		"❤\ufe0f":     "❤\ufe0f",
+	} {
+		if got := Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// A hostile string does nothing to a terminal once cleaned: no escape
+// is left to start a sequence, C1 ones included, and nothing moves the
+// cursor off the line.
+func TestCleanHostile(t *testing.T) {
+	hostile := "\x1b[2J\x1b[H\x1b]0;owned\x07\x1b[31mred\x9b31m\u009b1m\x1bP+q\x1b\\\x08\x08\x7f\r\nend\u202e"
+	got := Clean(hostile)
+	for _, c := range got {
+		if c < 0x20 || c >= 0x7f && c < 0xa0 || c == '\u202e' {
+			t.Fatalf("Clean left %U in %q", c, got)
+		}
+	}
+	if !strings.HasSuffix(got, "end") || !strings.Contains(got, "red") {
+		t.Errorf("Clean(hostile) = %q, lost the text in it", got)
+	}
+}
+
+func TestWidth(t *testing.T) {
+	for in, want := range map[string]int{
+		"":              0,
+		"abc":           3,
+		"日本語":           6,
+		"ｈｉ":            4, // fullwidth
+		"ﾊﾝｶｸ":          4, // halfwidth katakana
+		"cafe\u0301":    4,
+		"e\u0301\u0302": 1,
+		"🎉":             2,
+		"❤\ufe0f":       1,
+		"👩\u200d💻":      2,
+		"🇳🇿":            2,
+		"🇳🇿🇫🇷":          4,
+		"a\u200bb":      2, // zero width space
+	} {
+		if got := Width(in); got != want {
+			t.Errorf("Width(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		cols int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"日本語", 4, "日本"},
+		{"日本語", 5, "日本"}, // 語 would straddle the edge
+		{"a日", 2, "a"},
+		{"cafe\u0301s", 4, "cafe\u0301"},
+		{"🎉🎉", 3, "🎉"},
+		{"👩\u200d💻x", 2, "👩\u200d💻"},
+		{"bad\xffbyte", 4, "bad\xff"},
+		{"anything", 0, ""},
+	} {
+		if got := Truncate(c.in, c.cols); got != c.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", c.in, c.cols, got, c.want)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	for _, c := range []struct {
+		got, want string
+	}{
+		{Pad("ab", 4), "ab  "},
+		{Pad("日本", 6), "日本  "},
+		{Pad("cafe\u0301", 6), "cafe\u0301  "},
+		{Pad("toolong", 3), "toolong"},
+		{PadLeft("日", 4), "  日"},
+		{Fit("日本語", 5), "日本 "},
+		{Fit("🎉", 1), " "},
+	} {
+		if c.got != c.want {
+			t.Errorf("got %q, want %q", c.got, c.want)
+		}
+	}
+
+	// Columns line up whatever the names are written in.
+	for _, name := range []string{"bob", "李小龍", "zoë", "jose\u0301", "🎉party"} {
+		if w := Width(Pad(name, 10) + "|"); w != 11 {
+			t.Errorf("Pad(%q, 10) is %d columns with its bar, want 11", name, w)
+		}
+	}
+}
+
+func TestCells(t *testing.T) {
+	for in, want := range map[string][]string{
+		"ab":        {"a", "b"},
+		"a日b":       {"a", "日", "", "b"},
+		"e\u0301x":  {"e\u0301", "x"},
+		"日\u0301":   {"日\u0301", ""},
+		"👩\u200d💻!": {"👩\u200d💻", "", "!"},
+		"\u0301":    nil,
+	} {
+		if got := Cells(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("Cells(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
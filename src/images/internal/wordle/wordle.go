@@ -0,0 +1,118 @@
+// Package wordle implements the scoring and word lists for a five-letter
+// word guessing game.
+package wordle
+
+import (
+	_ "embed"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	Length  = 5
+	Guesses = 6
+)
+
+// answers.txt holds the words that can be picked as the answer.
+// guesses.txt holds the extra words accepted as guesses but never
+// picked; together they make up the dictionary.
+var (
+	//go:embed answers.txt
+	answers_txt string
+	//go:embed guesses.txt
+	guesses_txt string
+
+	answers    = strings.Fields(answers_txt)
+	dictionary = make(map[string]bool)
+)
+
+func init() {
+	for _, w := range answers {
+		dictionary[w] = true
+	}
+	for _, w := range strings.Fields(guesses_txt) {
+		dictionary[w] = true
+	}
+}
+
+type Mark int
+
+const (
+	Absent Mark = iota
+	Present
+	Correct
+)
+
+// Valid reports whether guess is a word we accept.
+func Valid(guess string) bool {
+	return dictionary[strings.ToLower(guess)]
+}
+
+// Random picks a practice answer.
+func Random(rng *rand.Rand) string {
+	return answers[rng.Intn(len(answers))]
+}
+
+// Daily picks the answer for the UTC date of t. Everyone playing on the
+// same day gets the same word.
+func Daily(t time.Time) string {
+	h := fnv.New32a()
+	h.Write([]byte(t.UTC().Format("2006-01-02")))
+	return answers[h.Sum32()%uint32(len(answers))]
+}
+
+// Score marks each letter of guess against answer. Exact matches are
+// taken first; a misplaced letter is only marked Present while copies of
+// it remain in the answer that aren't already accounted for, so guessing
+// LLAMA against ALLEY gives one yellow L (the other is green), one yellow
+// A and a gray A.
+func Score(answer, guess string) [Length]Mark {
+	var marks [Length]Mark
+	left := map[byte]int{}
+
+	for i := range Length {
+		if guess[i] == answer[i] {
+			marks[i] = Correct
+		} else {
+			left[answer[i]]++
+		}
+	}
+
+	for i := range Length {
+		if marks[i] == Correct {
+			continue
+		}
+		if left[guess[i]] > 0 {
+			marks[i] = Present
+			left[guess[i]]--
+		}
+	}
+
+	return marks
+}
+
+// Solved reports whether every letter is Correct.
+func Solved(marks [Length]Mark) bool {
+	for _, m := range marks {
+		if m != Correct {
+			return false
+		}
+	}
+	return true
+}
+
+// Share renders a finished game as the familiar grid of squares.
+func Share(rows [][Length]Mark) string {
+	squares := map[Mark]string{Absent: "⬛", Present: "🟨", Correct: "🟩"}
+
+	var b strings.Builder
+	for _, row := range rows {
+		for _, m := range row {
+			b.WriteString(squares[m])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package wordle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScore(t *testing.T) {
+	const (
+		x = Absent
+		y = Present
+		g = Correct
+	)
+
+	tests := []struct {
+		answer, guess string
+		want          [Length]Mark
+	}{
+		// One L is green, so only one of the others can be yellow.
+		{"alley", "llama", [Length]Mark{y, g, y, x, x}},
+		{"abbey", "babes", [Length]Mark{y, y, g, g, x}},
+		// Three Es guessed, one in the answer and already green.
+		{"crepe", "eerie", [Length]Mark{y, x, y, x, g}},
+		{"those", "geese", [Length]Mark{x, x, x, g, g}},
+		{"speed", "abide", [Length]Mark{x, x, x, y, y}},
+		{"sassy", "asset", [Length]Mark{y, y, g, x, x}},
+		{"robot", "robot", [Length]Mark{g, g, g, g, g}},
+		{"apple", "paper", [Length]Mark{y, y, g, y, x}},
+		{"stone", "tests", [Length]Mark{y, y, y, x, x}},
+	}
+
+	for _, tt := range tests {
+		if got := Score(tt.answer, tt.guess); got != tt.want {
+			t.Errorf("Score(%q, %q) = %v, want %v", tt.answer, tt.guess, got, tt.want)
+		}
+	}
+}
+
+func TestLists(t *testing.T) {
+	for _, w := range answers {
+		if len(w) != Length {
+			t.Errorf("answer %q is not %d letters", w, Length)
+		}
+		if !Valid(w) {
+			t.Errorf("answer %q is not a valid guess", w)
+		}
+	}
+
+	if Valid("zzzzz") {
+		t.Error("zzzzz accepted as a word")
+	}
+}
+
+func TestDaily(t *testing.T) {
+	day := time.Date(2024, 9, 21, 0, 0, 1, 0, time.UTC)
+	late := time.Date(2024, 9, 21, 23, 59, 59, 0, time.UTC)
+
+	if Daily(day) != Daily(late) {
+		t.Error("daily word changed within a UTC day")
+	}
+	if Daily(day) == Daily(day.AddDate(0, 0, 1)) && Daily(day) == Daily(day.AddDate(0, 0, 2)) {
+		t.Error("daily word the same three days running")
+	}
+}
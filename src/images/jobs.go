@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/jobs"
+)
+
+var jobsFile = flag.String("jobs-file", "", "keep render jobs in this JSON file across restarts (in memory only if unset); admins change them with 'job'")
+
+// render_jobs renders images on a schedule for whoever connects; main
+// opens it.
+var render_jobs *jobs.Scheduler
+
+// job_lives are the listings live jobs show their renders on, by job
+// name, so that 'watch' can look on.
+var job_lives = struct {
+	sync.Mutex
+	by_name map[string]*live_game
+}{by_name: map[string]*live_game{}}
+
+func open_jobs() {
+	s, err := jobs.Open(*jobsFile, run_job)
+	if err != nil {
+		log.Fatalf("jobs: %v", err)
+	}
+	render_jobs = s
+	s.Start()
+}
+
+// job_session is a session with no connection, set up as spec's settings
+// say, to render with.
+func job_session(spec jobs.Spec) (*session, error) {
+	sess := new_session(nil)
+	if len(spec.Settings) == 0 {
+		return sess, nil
+	}
+
+	var s saved_settings
+	if err := json.Unmarshal(spec.Settings, &s); err != nil {
+		sess.cancel()
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+	if msg := apply_settings(sess, s); strings.HasPrefix(msg, "Settings not loaded") {
+		sess.cancel()
+		return nil, errors.New(strings.TrimSpace(strings.TrimPrefix(msg, "Settings not loaded: ")))
+	}
+	return sess, nil
+}
+
+// run_job fetches and renders spec's image, as the server rather than
+// anyone connected, and shows it to spectators if the job is live.
+func run_job(ctx context.Context, spec jobs.Spec) (string, error) {
+	sess, err := job_session(spec)
+	if err != nil {
+		return "", err
+	}
+	defer sess.cancel()
+
+	img, err := fetch_in(ctx, spec.URL, sess.max_pixels)
+	if refused, ok := err.(*policy_error); ok {
+		return "", errors.New(strings.TrimSpace(refused.sentence()))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	out := compress(preprocess(img, sess), 1, sess)
+	if spec.Live {
+		job_live(spec.Name).show(clearScreen + out + fmt.Sprintf("Job %s, rendered %s.\n", spec.Name, time.Now().UTC().Format("15:04:05")))
+	}
+	return out, nil
+}
+
+// job_live is the listing the named job shows its renders on, opened
+// the first time it's needed.
+func job_live(name string) *live_game {
+	job_lives.Lock()
+	defer job_lives.Unlock()
+
+	if g := job_lives.by_name[name]; g != nil {
+		return g
+	}
+
+	live_games.Lock()
+	live_games.next++
+	g := &live_game{
+		id:       live_games.next,
+		name:     "job",
+		started:  time.Now(),
+		players:  []string{name},
+		watchers: map[*live_watcher]bool{},
+	}
+	live_games.all[g.id] = g
+	live_games.Unlock()
+
+	job_lives.by_name[name] = g
+	return g
+}
+
+// job_offline takes the named job's listing down, if it has one.
+func job_offline(name string) {
+	job_lives.Lock()
+	g := job_lives.by_name[name]
+	delete(job_lives.by_name, name)
+	job_lives.Unlock()
+
+	if g != nil {
+		g.close()
+	}
+}
+
+// ago says how long before now t was, as in "3m20s ago".
+func ago(t time.Time) string {
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// job_state sums up how st is getting on, for the listing.
+func job_state(st jobs.Status) string {
+	switch {
+	case st.Running:
+		return "running"
+	case st.Runs == 0:
+		return "not run yet"
+	case st.Failures > 0:
+		return fmt.Sprintf("failing (%s in a row): %v", plural(st.Failures, "failure"), st.LastErr)
+	}
+	return "ok"
+}
+
+// jobs_command handles "jobs".
+func jobs_command(*session, string) string {
+	list := render_jobs.List()
+	if len(list) == 0 {
+		return "There are no render jobs.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %-8s %-14s %-10s %-10s %s\n", "job", "every", "last run", "took", "next in", "state")
+	for _, st := range list {
+		last, took := "never", "-"
+		if !st.LastRun.IsZero() {
+			last, took = ago(st.LastRun), st.LastDuration.Round(time.Millisecond).String()
+		}
+		next := max(time.Until(st.Next), 0).Round(time.Second).String()
+
+		name := st.Name
+		if st.Live {
+			name += " (live)"
+		}
+		fmt.Fprintf(&b, "%-16s %-8s %-14s %-10s %-10s %s", name, st.Interval, last, took, next, job_state(st))
+		if st.Skipped > 0 {
+			fmt.Fprintf(&b, ", %s skipped", plural(st.Skipped, "tick"))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Use 'show job NAME' to see one's latest render, or 'watch ID' from 'games' for a live one.\n")
+	return b.String()
+}
+
+// show_command handles "show job NAME", the latest render the job made.
+// It becomes the session's last render, so it can be exported.
+func show_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "show"))
+	if len(args) != 2 || args[0] != "job" {
+		return "Usage: show job NAME, with a NAME from 'jobs'.\n"
+	}
+
+	st, ok := render_jobs.Get(args[1])
+	switch {
+	case !ok:
+		return fmt.Sprintf("There's no job %s. Try 'jobs'.\n", args[1])
+	case st.Output == "" && st.Failures > 0:
+		return fmt.Sprintf("Job %s hasn't rendered anything yet: %v.\n", st.Name, st.LastErr)
+	case st.Output == "":
+		return fmt.Sprintf("Job %s hasn't rendered anything yet.\n", st.Name)
+	}
+
+	sess.last_render = st.Output
+	note := fmt.Sprintf("Job %s, rendered %s from %s.\n", st.Name, ago(st.OutputAt), st.URL)
+	if st.Failures > 0 {
+		note += fmt.Sprintf("It's been failing since: %v.\n", st.LastErr)
+	}
+	return st.Output + note
+}
+
+// job_command handles "job add NAME INTERVAL URL [live] [SETTINGS]",
+// where SETTINGS is a blob from save-settings, and "job remove NAME".
+func job_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "job"))
+	usage := "Usage: job add NAME INTERVAL URL [live] [SETTINGS from save-settings], or job remove NAME.\n"
+	if len(args) == 2 && args[0] == "remove" {
+		ok, err := render_jobs.Remove(args[1])
+		if !ok {
+			return fmt.Sprintf("There's no job %s.\n", args[1])
+		}
+		job_offline(args[1])
+		if err != nil {
+			log.Printf("jobs: %v", err)
+		}
+		log.Printf("audit: %s removed job %s", admin_name(sess), args[1])
+		return fmt.Sprintf("Removed job %s.\n", args[1])
+	}
+	if len(args) < 4 || len(args) > 6 || args[0] != "add" {
+		return usage
+	}
+
+	interval, err := time.ParseDuration(args[2])
+	if err != nil {
+		return usage
+	}
+	spec := jobs.Spec{Name: args[1], URL: args[3], Interval: interval}
+	rest := args[4:]
+	if len(rest) > 0 && rest[0] == "live" {
+		spec.Live = true
+		rest = rest[1:]
+	}
+	switch len(rest) {
+	case 0:
+	case 1:
+		s, msg := decode_settings(rest[0])
+		if msg != "" {
+			return msg
+		}
+		if spec.Settings, err = json.Marshal(s); err != nil {
+			return fmt.Sprintf("Couldn't keep those settings: %v\n", err)
+		}
+		check, err := job_session(spec)
+		if err != nil {
+			return fmt.Sprintf("Those settings won't do: %v.\n", err)
+		}
+		check.cancel()
+	default:
+		return usage
+	}
+
+	replaced, err := render_jobs.Add(spec)
+	if replaced {
+		job_offline(spec.Name)
+	}
+	switch {
+	case errors.Is(err, jobs.ErrName), errors.Is(err, jobs.ErrURL), errors.Is(err, jobs.ErrInterval):
+		return fmt.Sprintf("Can't add that job: %v.\n", err)
+	case err != nil:
+		log.Printf("jobs: %v", err)
+		return "Added, but the job couldn't be saved, so it won't survive a restart.\n"
+	}
+
+	log.Printf("audit: %s set job %s: %s every %s", admin_name(sess), spec.Name, spec.URL, spec.Interval)
+	verb := "Added"
+	if replaced {
+		verb = "Replaced"
+	}
+	return fmt.Sprintf("%s job %s: %s every %s. It runs shortly; 'jobs' shows how it's doing.\n", verb, spec.Name, spec.URL, spec.Interval)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// latency_command handles "latency URL N": the URL is asked for N times in
+// a row, and the time each took to answer is sent back. Only the headers
+// are fetched, so the times are the network's and the remote server's
+// rather than the download's or ours.
+func latency_command(sess *session, line string) string {
+	usage := "Usage: latency URL N, with N from 1 to 10.\n"
+
+	args := strings.Fields(strings.TrimPrefix(line, "latency"))
+	if len(args) != 2 {
+		return usage
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil || n < 1 || n > 10 {
+		return usage
+	}
+	url := args[0]
+
+	var b strings.Builder
+	var times []time.Duration
+	method := http.MethodHead
+	for i := range n {
+		took, used, err := time_request(sess, url, method)
+		if err != nil {
+			fmt.Fprintf(&b, "%2d: failed: %v\n", i+1, err)
+			continue
+		}
+		if used != method {
+			fmt.Fprintf(&b, "The server doesn't allow HEAD, so GET is used instead.\n")
+			method = used
+		}
+		times = append(times, took)
+		fmt.Fprintf(&b, "%2d: %s %.1f ms\n", i+1, used, ms(took))
+	}
+
+	if len(times) == 0 {
+		return b.String() + "No request got an answer.\n"
+	}
+
+	lo, hi, total := times[0], times[0], time.Duration(0)
+	for _, t := range times {
+		lo, hi, total = min(lo, t), max(hi, t), total+t
+	}
+	fmt.Fprintf(&b, "min %.1f ms, avg %.1f ms, max %.1f ms over %d requests", ms(lo), ms(total/time.Duration(len(times))), ms(hi), len(times))
+	if len(times) > 1 {
+		b.WriteString(" (the first also sets up the connection)")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// time_request times one request for url, from sending it to the first
+// byte of the answer. A HEAD the server refuses with 405 is tried again
+// as a GET, of which only one byte of the body is read; the method that
+// got the answer is returned.
+func time_request(sess *session, url, method string) (time.Duration, string, error) {
+	req, err := http.NewRequestWithContext(fetching_for(sess), method, url, nil)
+	if err != nil {
+		return 0, method, err
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, method, policy_unwrap(err)
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed && method == http.MethodHead {
+		fetch.Close(resp.Body)
+		return time_request(sess, url, http.MethodGet)
+	}
+	defer fetch.Close(resp.Body)
+
+	if method == http.MethodGet {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+	}
+	return time.Since(start), method, nil
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+// Each spectator gets a queue this long. A spectator who can't keep up
+// loses frames rather than slowing the game down.
+const live_queue = 64
+
+// A live_game is a game in progress that others can watch. Normally it
+// mirrors everything sent to one of its players. A game with something
+// to hide from spectators, like where the ships are, sets private and
+// shows them a public view itself instead.
+type live_game struct {
+	id      int
+	name    string
+	started time.Time
+	private atomic.Bool
+
+	mu       sync.Mutex
+	players  []string
+	watchers map[*live_watcher]bool
+	last     string
+	closed   bool
+}
+
+type live_watcher struct {
+	frames  chan string
+	dropped atomic.Bool
+}
+
+var live_games = struct {
+	sync.Mutex
+	next int
+	all  map[int]*live_game
+}{all: map[int]*live_game{}}
+
+// go_live lists sess as playing the named game and mirrors what it's sent
+// to anyone watching. The returned function takes it off the list.
+func go_live(sess *session, name string) func() {
+	live_games.Lock()
+	live_games.next++
+	g := &live_game{
+		id:       live_games.next,
+		name:     name,
+		started:  time.Now(),
+		players:  []string{player_name(sess, "guest")},
+		watchers: map[*live_watcher]bool{},
+	}
+	live_games.all[g.id] = g
+	live_games.Unlock()
+
+	sess.live.Store(g)
+	return func() {
+		sess.live.CompareAndSwap(g, nil)
+		g.close()
+	}
+}
+
+// merge_live joins two players' listings into one when they're matched,
+// so the game shows up once. Only the first player's screen is mirrored
+// from then on. other is nil for the computer.
+func merge_live(first, other *session) *live_game {
+	g := first.live.Load()
+	if g == nil {
+		return nil
+	}
+
+	name := "computer"
+	if other != nil {
+		name = player_name(other, "guest")
+		if theirs := other.live.Swap(nil); theirs != nil {
+			theirs.close()
+		}
+	}
+
+	g.mu.Lock()
+	g.players = append(g.players, name)
+	g.mu.Unlock()
+	return g
+}
+
+// mirror passes on a frame sent to the mirrored player.
+func (g *live_game) mirror(frame string) {
+	if !g.private.Load() {
+		g.show(frame)
+	}
+}
+
+// show sends a frame to every spectator without waiting on any of them.
+// A frame that's the same as the last is skipped, so games that redraw
+// for each player in turn don't send spectators everything twice.
+func (g *live_game) show(frame string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed || frame == g.last {
+		return
+	}
+	g.last = frame
+
+	for w := range g.watchers {
+		select {
+		case w.frames <- frame:
+		default:
+			w.dropped.Store(true)
+		}
+	}
+}
+
+// last_frame is the last frame shown, or "" for the nil game.
+func (g *live_game) last_frame() string {
+	if g == nil {
+		return ""
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.last
+}
+
+func (g *live_game) close() {
+	live_games.Lock()
+	delete(live_games.all, g.id)
+	live_games.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	for w := range g.watchers {
+		close(w.frames)
+	}
+}
+
+// subscribe adds a spectator, who starts with the latest frame. It
+// returns nil if the game has just finished.
+func (g *live_game) subscribe() *live_watcher {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return nil
+	}
+	w := &live_watcher{frames: make(chan string, live_queue)}
+	if g.last != "" {
+		w.frames <- g.last
+	}
+	g.watchers[w] = true
+	return w
+}
+
+func (g *live_game) unsubscribe(w *live_watcher) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.watchers, w)
+}
+
+// games_command handles "games".
+func games_command(*session, string) string {
+	live_games.Lock()
+	var list []*live_game
+	for _, g := range live_games.all {
+		list = append(list, g)
+	}
+	live_games.Unlock()
+
+	if len(list) == 0 {
+		return "Nobody is playing right now.\n"
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%4s  %-12s %-34s %s\n", "id", "game", "players", "playing for")
+	for _, g := range list {
+		g.mu.Lock()
+		players := strings.Join(g.players, " vs ")
+		g.mu.Unlock()
+		fmt.Fprintf(&b, "%4d  %-12s %s %s\n", g.id, g.name, usertext.Pad(players, 34), time.Since(g.started).Round(time.Second))
+	}
+	b.WriteString("Use 'watch ID' to look on.\n")
+	return b.String()
+}
+
+// watch_command handles "watch ID", and "watch URL N", which is
+// watch_url. Spectators see the game as the mirrored player's settings
+// drew it; anything they type other than "stop" is ignored.
+func watch_command(sess *session, line string) (string, error) {
+	args := strings.Fields(strings.TrimPrefix(line, "watch"))
+	if len(args) == 2 {
+		return watch_url(sess, args[0], args[1])
+	}
+
+	usage := "Usage: watch ID, with an ID from 'games', or watch URL SECONDS to draw an image again and again.\n"
+	if len(args) != 1 {
+		return usage, nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return usage, nil
+	}
+
+	live_games.Lock()
+	g := live_games.all[id]
+	live_games.Unlock()
+
+	var w *live_watcher
+	if g != nil {
+		w = g.subscribe()
+	}
+	if w == nil {
+		return fmt.Sprintf("There's no game %d. Try 'games'.\n", id), nil
+	}
+	defer g.unsubscribe(w)
+	defer sess.send(resetAttrs + showCursor)
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	sess.send(clearScreen)
+	for {
+		select {
+		case frame, ok := <-w.frames:
+			if !ok {
+				return "\nThe game is over.\n", nil
+			}
+			if w.dropped.Swap(false) {
+				sess.send(clearScreen + "[You fell behind, so some of the game was skipped.]\n")
+			}
+			sess.send(frame)
+		case line, ok := <-lines:
+			if !ok {
+				return "", io.EOF
+			}
+			if strings.TrimSpace(line) == "stop" {
+				return "\nStopped watching.\n", nil
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// log_level is the least severe level that's logged. The metrics port
+// can change it while the server runs.
+var log_level slog.LevelVar
+
+// A log_handler writes records as the log package writes lines, with
+// the level before any message that isn't INFO and attributes after it
+// as key=value, as slog's default handler does, but leaves out those
+// below log_level. Everything log.Printf writes is INFO, so lines look
+// as they always have.
+type log_handler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	attrs string
+	group string
+}
+
+// open_log has everything logged, through log or slog, go through a
+// log_handler.
+func open_log() {
+	slog.SetDefault(slog.New(&log_handler{mu: &sync.Mutex{}, w: os.Stderr}))
+}
+
+func (h *log_handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= log_level.Level()
+}
+
+func (h *log_handler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	}
+	if r.Level != slog.LevelInfo {
+		b.WriteString(r.Level.String() + " ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		write_attr(&b, h.group, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *log_handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		write_attr(&b, h.group, a)
+	}
+	with := *h
+	with.attrs += b.String()
+	return &with
+}
+
+func (h *log_handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	with := *h
+	with.group += name + "."
+	return &with
+}
+
+// write_attr writes a as " key=value", or each attribute of a group as
+// " group.key=value". Values that would read as more than one are
+// quoted.
+func write_attr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			group += a.Key + "."
+		}
+		for _, g := range a.Value.Group() {
+			write_attr(b, group, g)
+		}
+		return
+	}
+
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = strconv.Quote(v)
+	}
+	fmt.Fprintf(b, " %s%s=%s", group, a.Key, v)
+}
+
+// set_log_level is log_level set from a name, DEBUG, INFO, WARN or ERROR,
+// in any case.
+func set_log_level(name string) bool {
+	var level slog.Level
+	switch strings.ToUpper(name) {
+	case "DEBUG", "INFO", "WARN", "ERROR":
+		level.UnmarshalText([]byte(name))
+	default:
+		return false
+	}
+	// Logged first, so a level that hides INFO doesn't hide this.
+	log.Printf("audit: log level set to %s", level)
+	log_level.Set(level)
+	return true
+}
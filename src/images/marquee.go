@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+	"github.com/atalii/image-server-thing/internal/font"
+	"github.com/atalii/image-server-thing/internal/scale"
+)
+
+const (
+	marquee_usage = "Usage: marquee [rainbow] [speed N] [for SECONDS] TEXT, or marquee [speed N] [for SECONDS] image URL\n"
+
+	// speed is in columns a second.
+	marquee_speed     = 15
+	marquee_max_speed = 100
+
+	marquee_duration     = 60
+	marquee_max_duration = 600
+	marquee_max_text     = 200
+
+	// A panorama is drawn this many rows tall, and at most this wide.
+	marquee_image_rows = 20
+	marquee_image_cols = 4000
+)
+
+// marquee_command handles "marquee", which scrolls text in the big font,
+// or a wide image, across the session's width until a key is pressed or
+// the time is up.
+func marquee_command(sess *session, line string) (string, error) {
+	f := strings.Fields(strings.TrimPrefix(line, "marquee"))
+	rainbow := false
+	speed, duration := marquee_speed, marquee_duration
+
+options:
+	for len(f) > 0 {
+		switch {
+		case f[0] == "rainbow":
+			rainbow = true
+			f = f[1:]
+		case f[0] == "speed" || f[0] == "for":
+			n, limit := &speed, marquee_max_speed
+			if f[0] == "for" {
+				n, limit = &duration, marquee_max_duration
+			}
+			if len(f) < 2 {
+				return marquee_usage, nil
+			}
+			v, err := strconv.Atoi(f[1])
+			if err != nil || v < 1 || v > limit {
+				return fmt.Sprintf("%q goes from 1 to %d.\n", f[0], limit), nil
+			}
+			*n = v
+			f = f[2:]
+		default:
+			break options
+		}
+	}
+
+	if len(f) == 2 && f[0] == "image" {
+		return marquee_image(sess, f[1], speed, time.Duration(duration)*time.Second)
+	}
+
+	text := strings.Join(f, " ")
+	if text == "" {
+		return marquee_usage, nil
+	}
+	if len([]rune(text)) > marquee_max_text {
+		return fmt.Sprintf("That's too long to scroll; keep it to %d characters.\n", marquee_max_text), nil
+	}
+
+	strip := font.Big.Render(text)
+	cols := len(strip[0])
+	colored := rainbow && sess.mode != "bw"
+
+	// The text comes in from the right, and once it's gone off the left
+	// it starts again.
+	draw := func(offset int) []string {
+		rows := make([]string, len(strip))
+		for y, pixels := range strip {
+			var b strings.Builder
+			for c := range sess.width {
+				x := (offset+c)%(cols+sess.width) - sess.width
+				if x < 0 || !pixels[x] {
+					b.WriteRune(chars[0])
+					continue
+				}
+				if colored {
+					b.WriteString(fg(rainbow_color(float64(x*6 + offset*4))))
+				}
+				b.WriteRune(chars[len(chars)-1])
+			}
+			rows[y] = b.String() + resetAttrs
+		}
+		return rows
+	}
+
+	return marquee_run(sess, speed, time.Duration(duration)*time.Second, draw)
+}
+
+// marquee_image scrolls the image at url back and forth through a window
+// as wide as the session. It's scaled so that each pixel is a column,
+// and the window is a crop of it.
+func marquee_image(sess *session, url string, speed int, d time.Duration) (string, error) {
+	sess.last_url = url
+	img, err := fetch_image(sess, url, sess.max_pixels)
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+
+	b := img.Bounds()
+	rows := min(marquee_image_rows, b.Dy()/2)
+	cols := min(rows*2*b.Dx()/max(b.Dy(), 1), marquee_image_cols)
+	if rows < 1 || cols <= sess.width {
+		return "That image isn't wide enough to scroll; paste the URL to see it.\n", nil
+	}
+
+	wide := scale.To(preprocess(img, sess), cols, rows*2, "bilinear")
+	span := cols - sess.width
+
+	draw := func(offset int) []string {
+		x := bounce(float64(offset), span)
+		window := crop_image(wide, image.Rect(x, 0, x+sess.width, rows*2))
+		return renderToStrings(window, sess.width, 1, sess)
+	}
+
+	stats.rendered.Add(1)
+	return marquee_run(sess, speed, d, draw)
+}
+
+// marquee_run animates frames from draw, each given how many columns the
+// scroll has moved.
+func marquee_run(sess *session, speed int, d time.Duration, draw func(offset int) []string) (string, error) {
+	return animate(sess, "Marquee", time.Second/time.Duration(speed), d, func(elapsed time.Duration) []string {
+		return draw(int(elapsed.Seconds() * float64(speed)))
+	})
+}
+
+// rainbow_color is the fully saturated color of hue, in degrees.
+func rainbow_color(hue float64) (int, int, int) {
+	r, g, b := colorspace.HSVToRGB(hue, 1, 1)
+	return int(r * 255), int(g * 255), int(b * 255)
+}
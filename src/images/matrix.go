@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	matrix_rows       = 40
+	matrix_max_frames = 1000
+
+	// A drop's tail fades over this many rows behind its head.
+	matrix_trail = 14
+
+	// A charset of one's own is kept to this many characters.
+	matrix_max_charset = 200
+)
+
+// The charsets matrix-charset has names for. The katakana are the
+// half-width ones, which take a column each as the rest do.
+var matrix_charsets = map[string]string{
+	"ascii":    "!\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~",
+	"katakana": "ｦｧｨｩｪｫｬｭｮｯｱｲｳｴｵｶｷｸｹｺｻｼｽｾｿﾀﾁﾂﾃﾄﾅﾆﾇﾈﾉﾊﾋﾌﾍﾎﾏﾐﾑﾒﾓﾔﾕﾖﾗﾘﾙﾚﾛﾜﾝ0123456789",
+	"binary":   "01",
+}
+
+// matrix_charset_status names sess's charset, or shows it if it's one of
+// its own.
+func matrix_charset_status(sess *session) string {
+	for name, chars := range matrix_charsets {
+		if sess.matrix_charset == chars {
+			return name
+		}
+	}
+	return strconv.Quote(sess.matrix_charset)
+}
+
+// valid_matrix_charset reports whether chars will do for rain: printable
+// characters a column wide, no spaces, and not too many.
+func valid_matrix_charset(chars string) bool {
+	if chars == "" || !utf8.ValidString(chars) || utf8.RuneCountInString(chars) > matrix_max_charset {
+		return false
+	}
+	for _, r := range chars {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) || usertext.RuneWidth(r) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// matrix_charset_command handles "matrix-charset NAME", one of the named
+// charsets, and "matrix-charset CHARS", for rain of those characters.
+func matrix_charset_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "matrix-charset"))
+	if arg == "" {
+		return "Matrix charset: " + matrix_charset_status(sess) + "\n"
+	}
+	if chars, ok := matrix_charsets[strings.ToLower(arg)]; ok {
+		arg = chars
+	}
+	if !valid_matrix_charset(arg) {
+		return fmt.Sprintf("Usage: matrix-charset ascii, katakana or binary, or matrix-charset CHARS, with up to %d printable characters and no spaces.\n", matrix_max_charset)
+	}
+	sess.matrix_charset = arg
+	return "Matrix charset: " + matrix_charset_status(sess) + "\n"
+}
+
+// A matrix_drop is one column's rain: where its head is, in rows from the
+// top, and how many rows a frame it falls.
+type matrix_drop struct {
+	head, speed float64
+}
+
+// matrix_rain is the rain on screen. Every cell keeps a character, which
+// now and then changes, whether or not it's lit.
+type matrix_rain struct {
+	rng     *rand.Rand
+	charset []rune
+	drops   []matrix_drop
+	glyphs  [][]rune
+}
+
+func new_matrix_rain(w, h int, charset string, rng *rand.Rand) *matrix_rain {
+	m := &matrix_rain{rng: rng, charset: []rune(charset), drops: make([]matrix_drop, w), glyphs: make([][]rune, h)}
+	for x := range m.drops {
+		m.drops[x] = m.new_drop()
+		// Start anywhere, so the screen doesn't fill from the top in a
+		// single line.
+		m.drops[x].head = rng.Float64() * float64(h+matrix_trail)
+	}
+	for y := range m.glyphs {
+		m.glyphs[y] = make([]rune, w)
+		for x := range m.glyphs[y] {
+			m.glyphs[y][x] = m.glyph()
+		}
+	}
+	return m
+}
+
+func (m *matrix_rain) glyph() rune {
+	return m.charset[m.rng.Intn(len(m.charset))]
+}
+
+// new_drop is a drop just above the top, at a speed of its own.
+func (m *matrix_rain) new_drop() matrix_drop {
+	return matrix_drop{head: -m.rng.Float64() * matrix_trail, speed: 0.3 + m.rng.Float64()*0.9}
+}
+
+// step moves the rain on a frame. A drop whose tail has gone off the
+// bottom starts again from the top, at a new speed.
+func (m *matrix_rain) step() {
+	h := len(m.glyphs)
+	for x := range m.drops {
+		m.drops[x].head += m.drops[x].speed
+		if m.drops[x].head-matrix_trail >= float64(h) {
+			m.drops[x] = m.new_drop()
+		}
+	}
+	for range len(m.drops) * h / 20 {
+		m.glyphs[m.rng.Intn(h)][m.rng.Intn(len(m.drops))] = m.glyph()
+	}
+}
+
+// rows draws the rain: the head of each drop near white, its tail green,
+// dimming with age.
+func (m *matrix_rain) rows() []string {
+	out := make([]string, len(m.glyphs))
+	for y, glyphs := range m.glyphs {
+		var b strings.Builder
+		for x, r := range glyphs {
+			behind := m.drops[x].head - float64(y)
+			switch {
+			case behind < 0 || behind >= matrix_trail:
+				b.WriteByte(' ')
+			case behind < 1:
+				b.WriteString(fg(210, 255, 210) + string(r))
+			default:
+				b.WriteString(fg(0, 40+int(215*(1-behind/matrix_trail)), 0) + string(r))
+			}
+		}
+		b.WriteString(resetAttrs)
+		out[y] = b.String()
+	}
+	return out
+}
+
+// matrix_command handles "matrix FRAMES", which plays FRAMES frames of
+// falling green characters at the session's width and matrix_rows rows,
+// from the charset matrix-charset picks. Any key stops it early.
+func matrix_command(sess *session, line string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "matrix")))
+	if err != nil || n < 1 || n > matrix_max_frames {
+		return fmt.Sprintf("Usage: matrix FRAMES, with FRAMES from 1 to %d.\n", matrix_max_frames), nil
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(hideCursor)
+	defer sess.send(resetAttrs + clearScreen + showCursor)
+
+	rain := new_matrix_rain(sess.width, matrix_rows, sess.matrix_charset, rand.New(rand.NewSource(time.Now().UnixNano())))
+	header := animation_header("Matrix")
+	for i := range n {
+		if err := sess.send(clearScreen + animation_frame_text(sess, header, rain.rows())); err != nil {
+			return "", err
+		}
+
+		if i == n-1 {
+			break
+		}
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return "Matrix stopped.\n", nil
+		case <-time.After(sess.next_frame(animation_frame)):
+		}
+		rain.step()
+	}
+	return "Matrix over.\n", nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	min_max_fps = 0.1
+	max_max_fps = 60
+)
+
+// set_max_fps caps the frames the session's animations and watches draw
+// at n a second, or lifts the cap for 0. Each session has its own token
+// bucket, holding one frame, so a cap can't be got round by starting a
+// new animation.
+func (s *session) set_max_fps(n float64) {
+	s.max_fps = n
+	s.frames = nil
+	if n > 0 {
+		s.frames = rate.NewLimiter(rate.Limit(n), 1)
+	}
+}
+
+// next_frame is how long a loop that would draw its next frame after d
+// should wait: d, or longer if the cap calls for it. The frame is
+// counted against the cap as of then.
+func (s *session) next_frame(d time.Duration) time.Duration {
+	if s.frames == nil {
+		return d
+	}
+	now := time.Now()
+	return s.frames.ReserveN(now.Add(d), 1).DelayFrom(now)
+}
+
+// frame_now reports whether the cap lets a frame be drawn now, counting
+// it if so, for loops that would sooner skip a frame than wait for one.
+func (s *session) frame_now() bool {
+	return s.frames == nil || s.frames.Allow()
+}
+
+func max_fps_status(sess *session) string {
+	if sess.max_fps == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%g frames a second", sess.max_fps)
+}
+
+// valid_max_fps reports whether n is a cap that can be set, 0 being none.
+// NaN is none of them.
+func valid_max_fps(n float64) bool {
+	return n == 0 || n >= min_max_fps && n <= max_max_fps
+}
+
+// max_fps_command handles "maxfps [off|N]", which caps how fast watch,
+// slideshow, color-cycle, film and the other animations draw frames,
+// whatever their own delays, for connections and terminals that can't
+// keep up.
+func max_fps_command(sess *session, line string) string {
+	switch arg := strings.TrimSpace(strings.TrimPrefix(line, "maxfps")); arg {
+	case "":
+	case "off":
+		sess.set_max_fps(0)
+	default:
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil || !valid_max_fps(n) {
+			return fmt.Sprintf("Usage: maxfps off, or maxfps N frames a second from %g to %d.\n", min_max_fps, max_max_fps)
+		}
+		sess.set_max_fps(n)
+	}
+	return "Max FPS: " + max_fps_status(sess) + "\n"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+var metricsPort = flag.Int("metrics-port", 0, "take operators' commands ('loglevel LEVEL', 'connections') on this port, from this machine only; 0 is off")
+
+// serve_metrics takes connections on the metrics port, which only listens
+// on the loopback interface: nothing on it asks who's connecting.
+func serve_metrics() {
+	addr := fmt.Sprintf("127.0.0.1:%d", *metricsPort)
+	log.Printf("Binding metrics: %s", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("metrics: %v", err)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("metrics: %v", err)
+			continue
+		}
+		go metrics_conn(conn)
+	}
+}
+
+// metrics_conn answers commands on a metrics connection, a line each:
+// "loglevel LEVEL" gets "OK" or "ERR: unknown level", and "connections"
+// how many clients are connected.
+func metrics_conn(conn net.Conn) {
+	defer conn.Close()
+
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		var reply string
+		switch args := strings.Fields(sc.Text()); {
+		case len(args) == 0:
+			continue
+		case args[0] == "loglevel" && len(args) == 2:
+			reply = "OK\n"
+			if !set_log_level(args[1]) {
+				reply = "ERR: unknown level\n"
+			}
+		case args[0] == "loglevel":
+			reply = "ERR: usage: loglevel DEBUG|INFO|WARN|ERROR\n"
+		case args[0] == "connections" && len(args) == 1:
+			reply = fmt.Sprintf("%d\n", stats.active.Load())
+		default:
+			reply = "ERR: unknown command\n"
+		}
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// noise_image is uniformly random RGB, each pixel worked out from its
+// coordinates and the seed when it's asked for, so the same seed always
+// gives the same picture without anything being stored.
+type noise_image struct {
+	seed int64
+	w, h int
+}
+
+func (n noise_image) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (n noise_image) Bounds() image.Rectangle {
+	return image.Rect(0, 0, n.w, n.h)
+}
+
+// At mixes the seed and coordinates with splitmix64's finalizer, whose
+// low three bytes are as random as any.
+func (n noise_image) At(x, y int) color.Color {
+	z := uint64(n.seed) + uint64(y)*0x9e3779b97f4a7c15 + uint64(x)*0xbf58476d1ce4e5b9
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return color.RGBA{uint8(z), uint8(z >> 8), uint8(z >> 16), 0xff}
+}
+
+// noise_pattern_command handles "noise-pattern", which draws random
+// noise in the session's mode at its width and height, or demo_rows rows
+// if the height is left to the image, and "noise-pattern SEED", the same
+// noise again. No filters are applied, so every color comes through the
+// renderer as it was made.
+func noise_pattern_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "noise-pattern"))
+	seed := rand.Int63()
+	if arg != "" {
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return "Usage: noise-pattern [SEED], with SEED a whole number.\n"
+		}
+		seed = n
+	}
+
+	rows := sess.height
+	if rows == 0 {
+		rows = demo_rows
+	}
+	img := noise_image{seed, sess.width, max(int(float64(rows)*sess.aspect), 1)}
+
+	stats.rendered.Add(1)
+	sess.last_render = compress(img, 1, sess)
+	return sess.last_render + fmt.Sprintf("Seed: %d\n", seed)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	// notice_queue is how many notices wait, per connection, for it to
+	// be back at the prompt; past that the oldest is dropped.
+	notice_queue = 8
+
+	// notice_history is how many of the latest notices 'notices' can show.
+	notice_history = 20
+
+	notices_default = 10
+
+	// How long before the daily challenge changes everyone is told.
+	daily_warning = 10 * time.Minute
+)
+
+// notify_modes are what a connection can ask to be told: everything, only
+// what's about it, or nothing as it happens.
+var notify_modes = map[string]bool{"on": true, "mentions": true, "off": true}
+
+// A notice is one line of news. A mention is about the connection it
+// went to, rather than for everyone.
+type notice struct {
+	at      time.Time
+	text    string
+	mention bool
+	shown   bool
+}
+
+// A notice_box holds a connection's notices. Anything may put a notice
+// in one without waiting; the connection's own notice_loop writes them
+// out, only ever while it's at the prompt, so nothing lands in the middle
+// of a game or an animation.
+type notice_box struct {
+	mode    string
+	pending []*notice
+	history []*notice
+	wake    chan struct{}
+}
+
+// notify puts a notice for sess in its box, if its mode lets it through,
+// and never blocks. Notices the mode holds back still go in the history.
+func notify(sess *session, text string, mention bool) {
+	n := &notice{at: time.Now(), text: text, mention: mention}
+
+	sess.notice_mu.Lock()
+	box := &sess.notices
+	box.history = append(box.history, n)
+	if len(box.history) > notice_history {
+		box.history = box.history[1:]
+	}
+	wanted := box.mode == "on" || box.mode == "mentions" && mention
+	if wanted {
+		if len(box.pending) == notice_queue {
+			box.pending = box.pending[1:]
+		}
+		box.pending = append(box.pending, n)
+	}
+	sess.notice_mu.Unlock()
+
+	if wanted {
+		select {
+		case box.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notify_all tells every connection, except skip if it's set.
+func notify_all(text string, skip *session) int {
+	connected.Lock()
+	var targets []*session
+	for _, s := range connected.all {
+		if s != skip {
+			targets = append(targets, s)
+		}
+	}
+	connected.Unlock()
+
+	for _, s := range targets {
+		notify(s, text, false)
+	}
+	return len(targets)
+}
+
+// notify_nick tells whoever is connected under nick, if it's theirs.
+func notify_nick(nick, text string) {
+	connected.Lock()
+	var targets []*session
+	for _, s := range connected.all {
+		if s.nick == nick && s.owns_nick() {
+			targets = append(targets, s)
+		}
+	}
+	connected.Unlock()
+
+	for _, s := range targets {
+		notify(s, text, true)
+	}
+}
+
+// set_prompt records whether sess is at the prompt, where a notice can
+// be printed without spoiling anything; notices held back while it
+// wasn't go out once it is.
+func (s *session) set_prompt(at bool) {
+	s.at_prompt.Store(at)
+	if at {
+		select {
+		case s.notices.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notice_loop writes out sess's notices until it's gone. A slow client
+// only holds up this goroutine, never whoever sent the notice.
+func notice_loop(sess *session) {
+	for {
+		select {
+		case <-sess.ctx.Done():
+			return
+		case <-sess.notices.wake:
+		}
+		if !sess.at_prompt.Load() {
+			continue
+		}
+
+		sess.notice_mu.Lock()
+		pending := sess.notices.pending
+		sess.notices.pending = nil
+		for _, n := range pending {
+			n.shown = true
+		}
+		sess.notice_mu.Unlock()
+
+		for _, n := range pending {
+			if sess.send("Notice: "+n.text+"\n") != nil {
+				return
+			}
+		}
+	}
+}
+
+// daily_reminder warns everyone shortly before each day's challenge
+// changes over.
+func daily_reminder() {
+	for {
+		now := time.Now().UTC()
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		if wait := midnight.Sub(now) - daily_warning; wait > 0 {
+			time.Sleep(wait)
+			notify_all(fmt.Sprintf("The daily challenge changes in %d minutes; 'daily' if you haven't had your try.", int(daily_warning.Minutes())), nil)
+		}
+		time.Sleep(time.Until(midnight) + time.Second)
+	}
+}
+
+// notice_passed tells the players nick has just overtaken on game's
+// board, ahead of them before and behind the new best now. before is the
+// board as it stood.
+func notice_passed(game, nick string, before []leaderboard.Entry, best float64) {
+	kind := score_kind(game)
+	mine, ranked := 0.0, false
+	for _, e := range before {
+		if e.Nick == nick {
+			mine, ranked = e.Best, true
+		}
+	}
+	for _, e := range before {
+		if e.Nick == nick || e.Plays == 0 || ranked && kind.Better(mine, e.Best) || !kind.Better(best, e.Best) {
+			continue
+		}
+		notify_nick(e.Nick, fmt.Sprintf("%s beat your best at %s: %s to your %s.", nick, game, format_score(best), format_score(e.Best)))
+	}
+}
+
+func notify_status(sess *session) string {
+	sess.notice_mu.Lock()
+	defer sess.notice_mu.Unlock()
+	return sess.notices.mode
+}
+
+// notify_command handles "notify [on|off|mentions]".
+func notify_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "notify"))
+	if arg == "" {
+		return "Notices: " + notify_status(sess) + "\n"
+	}
+	if !notify_modes[arg] {
+		return "Usage: notify on|off|mentions. Mentions are only notices about you, like someone beating your best.\n"
+	}
+
+	sess.notice_mu.Lock()
+	sess.notices.mode = arg
+	if arg == "off" {
+		sess.notices.pending = nil
+	}
+	sess.notice_mu.Unlock()
+	return "Notices: " + arg + "\n"
+}
+
+// notices_command handles "notices [N]", the latest notices, including
+// any that weren't shown.
+func notices_command(sess *session, line string) string {
+	n := notices_default
+	if arg := strings.TrimSpace(strings.TrimPrefix(line, "notices")); arg != "" {
+		var err error
+		if n, err = strconv.Atoi(arg); err != nil || n < 1 || n > notice_history {
+			return fmt.Sprintf("Usage: notices [N], N from 1 to %d.\n", notice_history)
+		}
+	}
+
+	sess.notice_mu.Lock()
+	history := sess.notices.history[max(len(sess.notices.history)-n, 0):]
+	var b strings.Builder
+	for _, n := range history {
+		missed := ""
+		if !n.shown {
+			missed = " (missed)"
+		}
+		fmt.Fprintf(&b, "%s %s%s\n", n.at.UTC().Format("15:04"), n.text, missed)
+	}
+	sess.notice_mu.Unlock()
+
+	if b.Len() == 0 {
+		return "No notices yet.\n"
+	}
+	return b.String()
+}
+
+// announce_command handles "announce TEXT", for everyone connected.
+func announce_command(sess *session, line string) string {
+	text := usertext.Clean(strings.TrimSpace(strings.TrimPrefix(line, "announce")))
+	if text == "" {
+		return "Usage: announce TEXT\n"
+	}
+
+	log.Printf("audit: %s announced %q", admin_name(sess), text)
+	n := notify_all("From the admins: "+text, sess)
+	return fmt.Sprintf("Announced to %s.\n", plural(n, "other connection"))
+}
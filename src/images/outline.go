@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// outline_ink is what outline cells are drawn from: the session's own
+// converter is given this instead of the image, so the outline comes out
+// black in whatever way the mode draws black.
+var outline_ink = image.NewUniform(color.Black)
+
+// draw_outline blacks out the cells of rows that sit on an edge of img,
+// for a cartoon look. Edges are found with a Sobel filter over the cells'
+// lightness rather than the image's, so outlines are a cell wide however
+// far the image is scaled down. at is the pixel each cell samples.
+func draw_outline(rows [][]string, img image.Image, at func(x, y int) image.Point, sess *session) {
+	if len(rows) == 0 {
+		return
+	}
+	height, width := len(rows), len(rows[0])
+
+	light := make([][]float64, height)
+	for y := range height {
+		light[y] = make([]float64, width)
+		for x := range width {
+			p := at(x, y)
+			light[y][x] = luma255(img.At(p.X, p.Y))
+		}
+	}
+
+	// Cells past the edge of the render repeat the nearest one.
+	l := func(x, y int) float64 {
+		return light[min(max(y, 0), height-1)][min(max(x, 0), width-1)]
+	}
+
+	ink := sess.converter(outline_ink, 0, 0)
+	for y := range height {
+		for x := range width {
+			gx := l(x+1, y-1) + 2*l(x+1, y) + l(x+1, y+1) - l(x-1, y-1) - 2*l(x-1, y) - l(x-1, y+1)
+			gy := l(x-1, y+1) + 2*l(x, y+1) + l(x+1, y+1) - l(x-1, y-1) - 2*l(x, y-1) - l(x+1, y-1)
+
+			// A step from black to white scores 255, as high as it
+			// goes, so at 255 nothing is outlined.
+			if min(math.Hypot(gx, gy)/4, 255) > float64(sess.outline) {
+				rows[y][x] = ink
+			}
+		}
+	}
+}
+
+// luma255 is the lightness of c, from 0 to 255, weighted as bw weighs it.
+func luma255(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff * 255
+}
+
+// outline_command handles "outline N".
+func outline_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "outline"))
+	if arg == "" {
+		return fmt.Sprintf("Outline: %d\n", sess.outline)
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 || n > 255 {
+		return "Usage: outline N, where N is 0 (off) to 255; lower N outlines fainter edges.\n"
+	}
+
+	sess.outline = n
+	if n == 0 {
+		return "Outline off.\n"
+	}
+	return fmt.Sprintf("Outline: edges stronger than %d are drawn black.\n", n)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/canvas"
+)
+
+// max_palette_swaps keeps a session from making every render scan the
+// image hundreds of times.
+const max_palette_swaps = 16
+
+// max_rgb_distance is how far apart black and white are in RGB space.
+var max_rgb_distance = math.Sqrt(3) * 255
+
+// A palette_swap turns every pixel within tolerance, a percentage of
+// max_rgb_distance, of src into dst.
+type palette_swap struct {
+	src, dst  color.RGBA
+	tolerance float64
+}
+
+func (p palette_swap) String() string {
+	return fmt.Sprintf("#%02x%02x%02x -> #%02x%02x%02x within %s%%",
+		p.src.R, p.src.G, p.src.B, p.dst.R, p.dst.G, p.dst.B, format_score(p.tolerance))
+}
+
+// apply_palette_swaps recolors img. Each pixel is matched against its
+// original color, so swaps don't chain, and the first swap to match it
+// wins. Alpha is left alone.
+func apply_palette_swaps(img image.Image, swaps []palette_swap) image.Image {
+	out := to_nrgba(img)
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		r, g, b := float64(out.Pix[i]), float64(out.Pix[i+1]), float64(out.Pix[i+2])
+		for _, p := range swaps {
+			dr, dg, db := r-float64(p.src.R), g-float64(p.src.G), b-float64(p.src.B)
+			if math.Sqrt(dr*dr+dg*dg+db*db) <= p.tolerance/100*max_rgb_distance {
+				out.Pix[i], out.Pix[i+1], out.Pix[i+2] = p.dst.R, p.dst.G, p.dst.B
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+func palette_rgba(s string) (color.RGBA, bool) {
+	c, err := canvas.ParseColor(s)
+	return color.RGBA{c.R, c.G, c.B, 0xff}, err == nil
+}
+
+func palette_status(sess *session) string {
+	if len(sess.palette_swaps) == 0 {
+		return "No palette swaps.\n"
+	}
+
+	var b strings.Builder
+	for i, p := range sess.palette_swaps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, p)
+	}
+	return b.String()
+}
+
+// palette_swap_command handles "palette-swap #RRGGBB #RRGGBB TOLERANCE"
+// and "palette-swap clear".
+func palette_swap_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "palette-swap"))
+	switch {
+	case len(args) == 0:
+		return palette_status(sess)
+	case len(args) == 1 && args[0] == "clear":
+		sess.palette_swaps = nil
+		return "Palette swaps cleared.\n"
+	}
+
+	usage := "Usage: palette-swap #RRGGBB #RRGGBB TOLERANCE, where TOLERANCE is 0 to 100%, or palette-swap clear.\n"
+	if len(args) != 3 {
+		return usage
+	}
+	src, ok1 := palette_rgba(args[0])
+	dst, ok2 := palette_rgba(args[1])
+	tolerance, err := strconv.ParseFloat(strings.TrimSuffix(args[2], "%"), 64)
+	if !ok1 || !ok2 || err != nil || tolerance < 0 || tolerance > 100 {
+		return usage
+	}
+	if len(sess.palette_swaps) == max_palette_swaps {
+		return fmt.Sprintf("That's %d swaps already; 'palette-swap clear' to start again.\n", max_palette_swaps)
+	}
+
+	p := palette_swap{src: src, dst: dst, tolerance: tolerance}
+	sess.palette_swaps = append(sess.palette_swaps, p)
+	return fmt.Sprintf("Palette swap: %s\n", p)
+}
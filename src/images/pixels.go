@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// Decoding allocates every pixel, however small the render, so the size
+// of image a client may ask for is limited. maxPixels is the limit each
+// session starts with.
+var maxPixels = flag.Int("max-pixels", 50, "largest image, in megapixels, a client may render until it sets its own with 'max-pixels N'")
+
+const max_pixels_ceiling = 1000
+
+// max_pixels_command handles "max-pixels [N]".
+func max_pixels_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "max-pixels"))
+	if arg == "" {
+		return fmt.Sprintf("Max pixels: %d MP\n", sess.max_pixels)
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > max_pixels_ceiling {
+		return fmt.Sprintf("Usage: max-pixels N, where N is 1 to %d megapixels.\n", max_pixels_ceiling)
+	}
+
+	sess.max_pixels = n
+	return fmt.Sprintf("Max pixels: %d MP\n", n)
+}
+
+// info_command handles "info URL", which reports an image's format and
+// size from its header alone, without decoding it.
+func info_command(sess *session, line string) string {
+	url := strings.TrimSpace(strings.TrimPrefix(line, "info"))
+	if url == "" {
+		return "Usage: info URL\n"
+	}
+
+	sess.last_url = url
+	resp, err := http_get(sess, url)
+	if err != nil {
+		return fmt.Sprintf("Couldn't fetch that: %v.\n", err)
+	}
+	defer fetch.Close(resp.Body)
+
+	cfg, format, err := image.DecodeConfig(resp.Body)
+	if err != nil {
+		return fmt.Sprintf("Couldn't read that as an image: %v.\n", err)
+	}
+
+	verdict := "within"
+	if fetch.OverLimit(cfg.Width, cfg.Height, sess.max_pixels) {
+		verdict = "over"
+	}
+	return fmt.Sprintf("%s, %d×%d (%s MP): %s your limit of %d MP.\n",
+		strings.ToUpper(format), cfg.Width, cfg.Height, fetch.Megapixels(cfg.Width, cfg.Height), verdict, sess.max_pixels)
+}
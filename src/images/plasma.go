@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	plasma_max_frames = 50
+	plasma_max_speed  = 10
+)
+
+// plasma_command handles "plasma FRAMES SPEED", which draws FRAMES
+// frames of demo plasma's effect, the clock moving on SPEED tenths of a
+// second between each, however long they take to draw. They come as
+// fast as animations do, or as maxfps lets them. Any key stops it early.
+func plasma_command(sess *session, line string) (string, error) {
+	usage := fmt.Sprintf("Usage: plasma FRAMES SPEED, with FRAMES from 1 to %d and SPEED from 1 to %d.\n", plasma_max_frames, plasma_max_speed)
+
+	args := strings.Fields(strings.TrimPrefix(line, "plasma"))
+	if len(args) != 2 {
+		return usage, nil
+	}
+	n, err1 := strconv.Atoi(args[0])
+	speed, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || n < 1 || n > plasma_max_frames || speed < 1 || speed > plasma_max_speed {
+		return usage, nil
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(clearScreen + hideCursor)
+	defer sess.send(resetAttrs + showCursor)
+
+	header := animation_header("Plasma")
+	for i := range n {
+		t := time.Duration(i*speed) * time.Second / 10
+		stats.rendered.Add(1)
+		rows := renderToStrings(demo_plasma(t, sess.width, demo_rows*2), sess.width, 1, sess)
+		if err := sess.send(animation_frame_text(sess, header, rows)); err != nil {
+			return "", err
+		}
+
+		if i == n-1 {
+			break
+		}
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return "Plasma stopped.\n", nil
+		case <-time.After(sess.next_frame(animation_frame)):
+		}
+	}
+	return "Plasma over.\n", nil
+}
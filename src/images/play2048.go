@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/game2048"
+)
+
+type tile_color struct {
+	bg, fg [3]int
+}
+
+// The palette of the original game; anything past 2048 shares one color.
+var tile_colors = map[int]tile_color{
+	0:    {[3]int{205, 193, 180}, [3]int{119, 110, 101}},
+	2:    {[3]int{238, 228, 218}, [3]int{119, 110, 101}},
+	4:    {[3]int{237, 224, 200}, [3]int{119, 110, 101}},
+	8:    {[3]int{242, 177, 121}, [3]int{249, 246, 242}},
+	16:   {[3]int{245, 149, 99}, [3]int{249, 246, 242}},
+	32:   {[3]int{246, 124, 95}, [3]int{249, 246, 242}},
+	64:   {[3]int{246, 94, 59}, [3]int{249, 246, 242}},
+	128:  {[3]int{237, 207, 114}, [3]int{249, 246, 242}},
+	256:  {[3]int{237, 204, 97}, [3]int{249, 246, 242}},
+	512:  {[3]int{237, 200, 80}, [3]int{249, 246, 242}},
+	1024: {[3]int{237, 197, 63}, [3]int{249, 246, 242}},
+	2048: {[3]int{237, 194, 46}, [3]int{249, 246, 242}},
+}
+
+var tile_big = tile_color{[3]int{60, 58, 50}, [3]int{249, 246, 242}}
+
+var board_bg = bg(187, 173, 160)
+
+const tile_width = 7
+
+func draw_tile_row(b *game2048.Board, r, sub int) string {
+	var sb strings.Builder
+
+	sb.WriteString(board_bg + " ")
+	for _, v := range b[r] {
+		c, ok := tile_colors[v]
+		if !ok {
+			c = tile_big
+		}
+
+		text := ""
+		if sub == 1 && v != 0 {
+			text = fmt.Sprint(v)
+		}
+		pad := tile_width - len(text)
+
+		sb.WriteString(bg(c.bg[0], c.bg[1], c.bg[2]) + fg(c.fg[0], c.fg[1], c.fg[2]) + "\033[1m")
+		sb.WriteString(strings.Repeat(" ", pad/2) + text + strings.Repeat(" ", pad-pad/2))
+		sb.WriteString(resetAttrs + board_bg + " ")
+	}
+	sb.WriteString(resetAttrs + clearLine + "\n")
+
+	return sb.String()
+}
+
+func draw2048(g *game2048.Game, status string) string {
+	var sb strings.Builder
+	width := game2048.Size*(tile_width+1) + 1
+
+	sb.WriteString(cursorHome)
+	fmt.Fprintf(&sb, "\033[1m2048\033[0m   score: %d%s\n\n", g.Score, clearLine)
+
+	border := board_bg + strings.Repeat(" ", width) + resetAttrs + clearLine + "\n"
+	sb.WriteString(border)
+	for r := range game2048.Size {
+		for sub := range 3 {
+			sb.WriteString(draw_tile_row(&g.Board, r, sub))
+		}
+		sb.WriteString(border)
+	}
+
+	sb.WriteString("\n" + status + clearLine + "\n> " + clearBelow)
+	return sb.String()
+}
+
+var directions_2048 = map[rune]game2048.Direction{
+	'w': game2048.Up,
+	's': game2048.Down,
+	'a': game2048.Left,
+	'd': game2048.Right,
+}
+
+func play2048(sess *session, args []string) (string, error) {
+	g := game2048.New(rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	over, err := run2048(sess, g)
+	if err != nil {
+		return "", err
+	}
+	how := "quit"
+	if over {
+		how = "game over"
+	}
+	return fmt.Sprintf("2048: %s with %d points.%s\n", how, g.Score, sess.record_score("2048", float64(g.Score))), nil
+}
+
+// run2048 plays g until no move is left, or until the player quits, in
+// which case over is false. Where tiles appear comes from g's own random
+// source, so seeding it fixes the whole game.
+func run2048(sess *session, g *game2048.Game) (over bool, err error) {
+	help := "w/a/s/d or arrow keys (then enter) to move, q to quit."
+	status := help
+	// Once the player has seen the win message they keep playing freely.
+	celebrated := false
+
+	for {
+		over = !g.CanMove()
+		if over {
+			status = fmt.Sprintf("No moves left. Final score: %d. Press enter.", g.Score)
+		} else if g.Won && !celebrated {
+			status = "You made 2048! c to keep going, q to quit."
+		}
+
+		sess.send(draw2048(g, status))
+
+		line, err := sess.readLine()
+		if err != nil {
+			return false, err
+		}
+
+		if over {
+			return true, nil
+		}
+
+		for _, k := range keys(line) {
+			if k == 'q' {
+				return false, nil
+			}
+
+			if g.Won && !celebrated {
+				if k == 'c' {
+					celebrated = true
+					status = help
+				}
+				continue
+			}
+
+			if d, ok := directions_2048[k]; ok {
+				g.Move(d)
+				if g.Won && !celebrated || !g.CanMove() {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/battleship"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	battleship_place_time = 3 * time.Minute
+	battleship_turn_time  = 90 * time.Second
+	battleship_log_lines  = 6
+)
+
+var battleship_glyphs = map[battleship.Cell]string{
+	battleship.Water:    fg(60, 90, 140) + "· " + resetAttrs,
+	battleship.ShipCell: fg(170, 170, 170) + "■ " + resetAttrs,
+	battleship.MissCell: fg(230, 230, 230) + "○ " + resetAttrs,
+	battleship.HitCell:  fg(255, 70, 50) + "✕ " + resetAttrs,
+	battleship.SunkCell: fg(140, 20, 20) + "█ " + resetAttrs,
+}
+
+type battleship_game struct {
+	m      *versus_match
+	boards [2]*battleship.Board
+	log    [2][]string
+
+	// firing is set once both fleets are placed; turn is whose shot it
+	// is then.
+	firing bool
+	turn   int
+
+	ai  *battleship.AI
+	rng *rand.Rand
+}
+
+// play_battleship handles "play battleship [ai]".
+func play_battleship(sess *session, args []string) (string, error) {
+	ai := len(args) == 1 && args[0] == "ai"
+	if len(args) > 0 && !ai {
+		return "Usage: play battleship [ai]\n", nil
+	}
+
+	return versus_play(sess, "battleship", ai, run_battleship)
+}
+
+func run_battleship(m *versus_match) {
+	// Spectators only ever see the public view from draw.
+	if m.live != nil {
+		m.live.private.Store(true)
+	}
+
+	g := &battleship_game{
+		m:      m,
+		boards: [2]*battleship.Board{battleship.NewBoard(), battleship.NewBoard()},
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if m.ai(1) {
+		g.boards[1].PlaceRandom(g.rng)
+		g.ai = battleship.NewAI(g.rng)
+	}
+	m.redraw = g.draw
+
+	if m.attach(g) && g.place() {
+		g.fire()
+	}
+}
+
+// battleship_state is what's kept of a game while its match is frozen.
+type battleship_state struct {
+	Boards [2]*battleship.Board
+	Log    [2][]string
+	Firing bool
+	Turn   int
+	AI     *battleship.AI `json:",omitempty"`
+}
+
+func (g *battleship_game) save() ([]byte, error) {
+	return json.Marshal(battleship_state{g.boards, g.log, g.firing, g.turn, g.ai})
+}
+
+func (g *battleship_game) restore(data []byte) error {
+	s := battleship_state{Boards: [2]*battleship.Board{battleship.NewBoard(), battleship.NewBoard()}, AI: g.ai}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	g.boards, g.log, g.firing, g.turn = s.Boards, s.Log, s.Firing, s.Turn
+	return nil
+}
+
+func (g *battleship_game) say(p int, format string, args ...any) {
+	g.log[p] = append(g.log[p], fmt.Sprintf(format, args...))
+	if len(g.log[p]) > battleship_log_lines {
+		g.log[p] = g.log[p][1:]
+	}
+}
+
+// place runs the placement phase, where both players set up at once. It
+// reports whether the game should carry on to firing. Only a player with
+// ships still to place is on the clock, as a restored game may have one
+// whose fleet is ready already.
+func (g *battleship_game) place() bool {
+	if g.firing {
+		return true
+	}
+
+	for p := range 2 {
+		if !g.boards[p].Ready() {
+			g.say(p, "Place your fleet: 'place SHIP COORD [h|v]' (e.g. place carrier a1 h), or 'place random'.")
+			g.m.start_clock(p, battleship_place_time)
+		}
+		g.draw(p)
+	}
+
+	for !g.boards[0].Ready() || !g.boards[1].Ready() {
+		ev := g.m.next()
+		switch {
+		case ev.timeout:
+			g.forfeit(ev.player, "ran out of time placing ships")
+			return false
+		case ev.gone || ev.line == "q" || ev.line == "resign":
+			g.forfeit(ev.player, "left the game")
+			return false
+		}
+
+		g.place_command(ev.player, ev.line)
+		if g.boards[ev.player].Ready() {
+			g.m.stop_clock(ev.player)
+		}
+		g.draw(ev.player)
+	}
+
+	return true
+}
+
+func (g *battleship_game) place_command(p int, line string) {
+	b := g.boards[p]
+	if b.Ready() {
+		g.say(p, "Your fleet is ready. Waiting for your opponent...")
+		return
+	}
+
+	f := strings.Fields(line)
+	switch {
+	case len(f) == 2 && f[0] == "place" && f[1] == "random":
+		b.PlaceRandom(g.rng)
+	case len(f) == 2 && f[0] == "place" && f[1] == "reset":
+		g.boards[p] = battleship.NewBoard()
+		g.say(p, "Fleet cleared.")
+		return
+	case (len(f) == 3 || len(f) == 4) && f[0] == "place":
+		ship, err := battleship.ShipIndex(f[1])
+		if err != nil {
+			g.say(p, "%s: %v.", f[1], err)
+			return
+		}
+		at, err := battleship.ParseCoord(f[2])
+		if err != nil {
+			g.say(p, "%v.", err)
+			return
+		}
+		horizontal := len(f) == 3 || f[3] == "h"
+		if len(f) == 4 && f[3] != "h" && f[3] != "v" {
+			g.say(p, "Direction is h (across) or v (down).")
+			return
+		}
+		if err := b.Place(ship, at, horizontal); err != nil {
+			g.say(p, "Can't place the %s there: %v.", battleship.Fleet[ship].Name, err)
+			return
+		}
+	default:
+		g.say(p, "Place ships with 'place SHIP COORD [h|v]', 'place random' or 'place reset'.")
+		return
+	}
+
+	if left := b.Unplaced(); len(left) > 0 {
+		g.say(p, "Still to place: %s.", strings.Join(left, ", "))
+	} else if !g.boards[1-p].Ready() {
+		g.say(p, "Fleet ready. Waiting for your opponent...")
+	}
+}
+
+// fire runs the shooting phase, with the first player going first.
+func (g *battleship_game) fire() {
+	if !g.firing {
+		g.firing = true
+		for p := range 2 {
+			g.say(p, "All ships placed. %s", g.turn_message(p, g.turn))
+			g.draw(p)
+		}
+	}
+
+	for {
+		turn := g.turn
+		if g.m.ai(turn) {
+			c := g.ai.Next()
+			r, name, _ := g.boards[0].Fire(c)
+			g.ai.Report(c, r, g.boards[0])
+			g.report(1, c, r, name)
+		} else if !g.take_shot(turn) {
+			return
+		}
+
+		if g.boards[1-turn].AllSunk() {
+			g.win(turn)
+			return
+		}
+
+		g.turn = 1 - turn
+		for p := range 2 {
+			g.say(p, "%s", g.turn_message(p, g.turn))
+			g.draw(p)
+		}
+	}
+}
+
+func (g *battleship_game) turn_message(p, turn int) string {
+	if p == turn {
+		return "Your turn: fire at a coordinate, e.g. 'b7'."
+	}
+	return "Opponent's turn."
+}
+
+// take_shot waits for the player whose turn it is to fire. Anyone else
+// typing gets told to wait. It returns false if the game ended instead.
+func (g *battleship_game) take_shot(turn int) bool {
+	g.m.start_clock(turn, battleship_turn_time)
+	defer g.m.stop_clock(turn)
+
+	for {
+		ev := g.m.next()
+		switch {
+		case ev.timeout:
+			g.forfeit(turn, "ran out of time")
+			return false
+		case ev.gone || ev.line == "q" || ev.line == "resign":
+			g.forfeit(ev.player, "left the game")
+			return false
+		}
+
+		if ev.player != turn {
+			g.say(ev.player, "Not your turn.")
+			g.draw(ev.player)
+			continue
+		}
+
+		c, err := battleship.ParseCoord(strings.TrimPrefix(ev.line, "fire "))
+		if err != nil {
+			g.say(turn, "%v.", err)
+			g.draw(turn)
+			continue
+		}
+
+		r, name, err := g.boards[1-turn].Fire(c)
+		if err != nil {
+			g.say(turn, "%s: %v.", c, err)
+			g.draw(turn)
+			continue
+		}
+
+		g.report(turn, c, r, name)
+		return true
+	}
+}
+
+func (g *battleship_game) report(shooter int, c battleship.Coord, r battleship.Result, name string) {
+	target := 1 - shooter
+	switch r {
+	case battleship.Miss:
+		g.say(shooter, "%s: miss.", c)
+		g.say(target, "Opponent fired at %s: miss.", c)
+	case battleship.Hit:
+		g.say(shooter, "%s: hit!", c)
+		g.say(target, "Opponent fired at %s: hit!", c)
+	case battleship.Sunk:
+		g.say(shooter, "%s: you sank their %s!", c, name)
+		g.say(target, "Opponent fired at %s and sank your %s.", c, name)
+	}
+}
+
+func (g *battleship_game) win(p int) {
+	g.say(p, "You sank the entire enemy fleet!")
+	g.say(1-p, "Your fleet is at the bottom of the sea.")
+	g.draw(0)
+	g.draw(1)
+
+	results := [2]string{}
+	results[p] = fmt.Sprintf("Battleship: you won!%s\n", record_win(g.m.session(p), g.m.session(1-p), "battleship"))
+	results[1-p] = "Battleship: you lost.\n"
+	g.m.end(results[0], results[1])
+}
+
+func (g *battleship_game) forfeit(p int, why string) {
+	results := [2]string{}
+	results[p] = fmt.Sprintf("Battleship: you forfeited (%s).\n", why)
+	results[1-p] = fmt.Sprintf("Battleship: your opponent %s. You win!%s\n", why, record_win(g.m.session(1-p), g.m.session(p), "battleship"))
+	g.m.end(results[0], results[1])
+}
+
+// draw shows player p their own fleet next to what they know of the
+// enemy's. The enemy board is only ever drawn through its public view.
+// Spectators get both boards that way, so nobody can watch to find out
+// where the ships are.
+func (g *battleship_game) draw(p int) {
+	if g.m.live != nil {
+		g.m.live.show(battleship_grids("Player 1's waters", "Player 2's waters", g.boards[0].Public, g.boards[1].Public) + "\n")
+	}
+	if g.m.ai(p) {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(battleship_grids("Your fleet", "Enemy waters", g.boards[p].Own, g.boards[1-p].Public))
+
+	b.WriteString("\n")
+	for _, l := range g.log[p] {
+		b.WriteString(l + "\n")
+	}
+	b.WriteString("> ")
+
+	g.m.send(p, b.String())
+}
+
+// battleship_grids draws two boards side by side, each square as the view
+// function given for it says.
+func battleship_grids(left_title, right_title string, left, right func(battleship.Coord) battleship.Cell) string {
+	var b strings.Builder
+
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "\033[1m   %s%s   %s\033[0m\n", usertext.Pad(left_title, 20), strings.Repeat(" ", 8), right_title)
+
+	header := "   " + strings.Join(strings.Fields("1 2 3 4 5 6 7 8 9 10"), " ") + " "
+	b.WriteString(header + strings.Repeat(" ", 8) + header + "\n")
+
+	for r := range battleship.Size {
+		fmt.Fprintf(&b, "%c  ", 'A'+r)
+		for c := range battleship.Size {
+			b.WriteString(battleship_glyphs[left(battleship.Coord{Row: r, Col: c})])
+		}
+		fmt.Fprintf(&b, "%s%c  ", strings.Repeat(" ", 8), 'A'+r)
+		for c := range battleship.Size {
+			b.WriteString(battleship_glyphs[right(battleship.Coord{Row: r, Col: c})])
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
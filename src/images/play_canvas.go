@@ -0,0 +1,445 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/atalii/image-server-thing/internal/atomicfile"
+	"github.com/atalii/image-server-thing/internal/canvas"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+var canvasDir = flag.String("canvas-dir", "canvases", "directory 'play canvas' saves drawings in")
+
+const (
+	canvas_width  = 100
+	canvas_height = 40
+
+	// The canvas starts this far down the screen, below the help line and
+	// the top of the frame, and one column in.
+	canvas_top  = 3
+	canvas_left = 2
+)
+
+const canvas_help = "w/a/s/d move, goto X Y, pen, . stamps, char C, color #RRGGBB, eraser, fill, undo [N], clear, save/load NAME, q"
+
+var canvas_names = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+const canvas_bad_name = "Canvas names are 1-32 letters, digits, '_' or '-'."
+
+var canvas_moves = map[rune]canvas.Point{
+	'w': {X: 0, Y: -1},
+	's': {X: 0, Y: 1},
+	'a': {X: -1, Y: 0},
+	'd': {X: 1, Y: 0},
+}
+
+// There is one canvas, shared by everyone drawing. A single goroutine owns
+// it along with every viewer's state, and the viewers' connections only
+// pass it their lines, so edits from several people at once happen one
+// after another.
+var canvas_room = struct {
+	start  sync.Once
+	joins  chan *canvas_viewer
+	events chan canvas_event
+}{
+	joins:  make(chan *canvas_viewer),
+	events: make(chan canvas_event),
+}
+
+type canvas_event struct {
+	v    *canvas_viewer
+	line string
+	gone bool
+}
+
+type canvas_viewer struct {
+	id   int
+	sess *session
+	bw   bool
+
+	cursor canvas.Point
+	brush  canvas.Cell
+	pen    bool
+	eraser bool
+
+	// confirming is set while a clear waits for a "yes".
+	confirming bool
+	status     string
+
+	// shown is what the viewer's screen has in each square, and in the
+	// status line, so only what changed gets sent.
+	shown        []string
+	shown_status string
+
+	left chan string
+}
+
+type canvas_state struct {
+	c       *canvas.Canvas
+	viewers map[*canvas_viewer]bool
+	next_id int
+}
+
+// play_canvas handles "play canvas".
+func play_canvas(sess *session, args []string) (string, error) {
+	if len(args) > 0 {
+		return "Usage: play canvas\n", nil
+	}
+
+	canvas_room.start.Do(func() { go run_canvas() })
+
+	// Screens are only sent what changed, which means nothing to someone
+	// who wasn't watching from the start. Spectators get whole frames.
+	if g := sess.live.Load(); g != nil {
+		g.private.Store(true)
+	}
+
+	v := &canvas_viewer{
+		sess:   sess,
+		bw:     sess.mode == "bw",
+		cursor: canvas.Point{X: canvas_width / 2, Y: canvas_height / 2},
+		brush:  canvas.Cell{Ch: '#', Color: canvas.White},
+		left:   make(chan string, 1),
+	}
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	canvas_room.joins <- v
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				canvas_room.events <- canvas_event{v: v, gone: true}
+				<-v.left
+				return "", io.EOF
+			}
+			canvas_room.events <- canvas_event{v: v, line: line}
+		case msg := <-v.left:
+			return msg, nil
+		}
+	}
+}
+
+func run_canvas() {
+	st := &canvas_state{c: canvas.New(canvas_width, canvas_height), viewers: map[*canvas_viewer]bool{}}
+
+	for {
+		select {
+		case v := <-canvas_room.joins:
+			st.next_id++
+			v.id = st.next_id
+			st.viewers[v] = true
+			st.announce(v, "%s joined.", player_name(v.sess, "Someone"))
+			v.status = "Welcome! Everyone here sees what you draw."
+			v.paint(st)
+			st.update(nil, nil)
+		case ev := <-canvas_room.events:
+			if !st.viewers[ev.v] {
+				continue
+			}
+			if ev.gone || ev.line == "q" {
+				st.leave(ev.v)
+				continue
+			}
+
+			was := ev.v.cursor
+			changed := st.command(ev.v, ev.line)
+			st.update(ev.v, append(changed, was, ev.v.cursor))
+		}
+	}
+}
+
+func (st *canvas_state) leave(v *canvas_viewer) {
+	delete(st.viewers, v)
+	st.c.Forget(v.id)
+	st.announce(v, "%s left.", player_name(v.sess, "Someone"))
+	st.update(nil, nil)
+	v.left <- "Left the canvas.\n"
+}
+
+// announce puts a message on everyone's status line but v's.
+func (st *canvas_state) announce(v *canvas_viewer, format string, args ...any) {
+	for w := range st.viewers {
+		if w != v {
+			w.status = fmt.Sprintf(format, args...)
+		}
+	}
+}
+
+func (v *canvas_viewer) paint_with() canvas.Cell {
+	if v.eraser {
+		return canvas.Blank
+	}
+	return v.brush
+}
+
+// command carries out one line from v, returning the squares it changed.
+func (st *canvas_state) command(v *canvas_viewer, line string) []canvas.Point {
+	c := st.c
+	f := strings.Fields(line)
+	v.status = ""
+
+	if v.confirming {
+		v.confirming = false
+		if line != "yes" {
+			v.status = "Left as it was."
+			return nil
+		}
+		st.announce(v, "%s cleared the canvas.", player_name(v.sess, "Someone"))
+		v.status = "Cleared."
+		return c.Clear()
+	}
+
+	switch {
+	case len(f) == 0:
+		return nil
+	case strings.Trim(line, "wasd") == "":
+		var trail []canvas.Point
+		for _, k := range line {
+			d := canvas_moves[k]
+			next := canvas.Point{X: v.cursor.X + d.X, Y: v.cursor.Y + d.Y}
+			if c.In(next) {
+				v.cursor = next
+				trail = append(trail, next)
+			}
+		}
+		if v.pen {
+			return c.Draw(v.id, v.paint_with(), trail...)
+		}
+	case f[0] == "goto" && len(f) == 3:
+		x, errx := strconv.Atoi(f[1])
+		y, erry := strconv.Atoi(f[2])
+		p := canvas.Point{X: x - 1, Y: y - 1}
+		if errx != nil || erry != nil || !c.In(p) {
+			v.status = fmt.Sprintf("Squares go from 1 1 to %d %d.", c.Width, c.Height)
+			return nil
+		}
+		v.cursor = p
+	case line == "." || line == "stamp":
+		return c.Draw(v.id, v.paint_with(), v.cursor)
+	case line == "pen":
+		v.pen = !v.pen
+	case f[0] == "char" && len(f) == 2:
+		r, _ := utf8.DecodeRuneInString(f[1])
+		if utf8.RuneCountInString(f[1]) != 1 || !unicode.IsGraphic(r) || usertext.RuneWidth(r) != 1 {
+			v.status = "The brush is a single character, e.g. 'char *'."
+			return nil
+		}
+		v.brush.Ch, v.eraser = r, false
+	case f[0] == "color" && len(f) == 2:
+		col, err := canvas.ParseColor(f[1])
+		if err != nil {
+			v.status = "Colors are written like #ff8800."
+			return nil
+		}
+		v.brush.Color, v.eraser = col, false
+	case line == "eraser":
+		v.eraser = !v.eraser
+	case line == "fill":
+		return c.Fill(v.id, v.cursor, v.paint_with())
+	case f[0] == "undo" && len(f) <= 2:
+		n := 1
+		if len(f) == 2 {
+			var err error
+			if n, err = strconv.Atoi(f[1]); err != nil || n < 1 || n > canvas.MaxUndo {
+				v.status = fmt.Sprintf("Up to %d strokes can be undone.", canvas.MaxUndo)
+				return nil
+			}
+		}
+		var changed []canvas.Point
+		for range n {
+			more, ok := c.Undo(v.id)
+			if !ok {
+				v.status = "Nothing more of yours to undo."
+				break
+			}
+			changed = append(changed, more...)
+		}
+		return changed
+	case line == "clear":
+		v.confirming = true
+		v.status = "Clear the whole canvas for everyone? Type 'yes' to confirm."
+	case f[0] == "save" && len(f) == 2:
+		v.status = save_canvas(c, f[1])
+	case f[0] == "load" && len(f) == 2:
+		changed, failed := load_canvas(c, f[1])
+		if failed != "" {
+			v.status = failed
+			return nil
+		}
+		st.announce(v, "%s loaded %q.", player_name(v.sess, "Someone"), f[1])
+		v.status = fmt.Sprintf("Loaded %q.", f[1])
+		return changed
+	case line == "redraw":
+		v.paint(st)
+	default:
+		v.status = "Unknown command. " + canvas_help
+	}
+
+	return nil
+}
+
+func canvas_path(name string) string {
+	return filepath.Join(*canvasDir, name+".json")
+}
+
+// save_canvas writes the canvas to a temporary file first so a crash
+// halfway through never leaves a broken save behind.
+func save_canvas(c *canvas.Canvas, name string) string {
+	if !canvas_names.MatchString(name) {
+		return canvas_bad_name
+	}
+
+	data, err := c.MarshalJSON()
+	if err == nil {
+		err = os.MkdirAll(*canvasDir, 0o755)
+	}
+	if err == nil {
+		err = atomicfile.Write(canvas_path(name), data, 0o600)
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't save: %v.", err)
+	}
+	return fmt.Sprintf("Saved as %q.", name)
+}
+
+// load_canvas replaces c with the one saved as name. If that can't be
+// done, it says why instead.
+func load_canvas(c *canvas.Canvas, name string) ([]canvas.Point, string) {
+	if !canvas_names.MatchString(name) {
+		return nil, canvas_bad_name
+	}
+
+	data, err := os.ReadFile(canvas_path(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Sprintf("There's no canvas called %q.", name)
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("Couldn't load: %v.", err)
+	}
+
+	changed, err := c.Load(data)
+	if err != nil {
+		return nil, fmt.Sprintf("Couldn't load %q: %v.", name, err)
+	}
+	return changed, ""
+}
+
+// update sends each viewer the squares among points that look different
+// to them now, and their status line if that changed. actor is whoever's
+// line caused it: their prompt is cleared for the next one. Everyone else
+// may be partway through typing, so their cursor is put back where it was.
+func (st *canvas_state) update(actor *canvas_viewer, points []canvas.Point) {
+	for v := range st.viewers {
+		var b strings.Builder
+		for _, p := range points {
+			i := p.Y*st.c.Width + p.X
+			if want := v.square(st.c, p); v.shown[i] != want {
+				v.shown[i] = want
+				fmt.Fprintf(&b, "\033[%d;%dH%s", p.Y+canvas_top, p.X+canvas_left, want)
+			}
+		}
+		if status := v.status_line(st); status != v.shown_status {
+			v.shown_status = status
+			fmt.Fprintf(&b, "\033[%d;1H%s%s", st.c.Height+canvas_top+1, status, clearLine)
+		}
+
+		switch {
+		case v == actor:
+			v.send(b.String() + v.prompt(st))
+		case b.Len() > 0:
+			v.send("\0337" + b.String() + "\0338")
+		}
+	}
+}
+
+// paint draws v's whole screen.
+func (v *canvas_viewer) paint(st *canvas_state) {
+	c := st.c
+	v.shown = make([]string, c.Width*c.Height)
+
+	var b strings.Builder
+	b.WriteString(clearScreen + "\033[1mCanvas\033[0m   " + canvas_help + "\n")
+	b.WriteString("┌" + strings.Repeat("─", c.Width) + "┐\n")
+	for y := range c.Height {
+		b.WriteString("│")
+		for x := range c.Width {
+			i := y*c.Width + x
+			v.shown[i] = v.square(c, canvas.Point{X: x, Y: y})
+			b.WriteString(v.shown[i])
+		}
+		b.WriteString("│\n")
+	}
+	b.WriteString("└" + strings.Repeat("─", c.Width) + "┘\n")
+
+	v.shown_status = v.status_line(st)
+	b.WriteString(v.shown_status + clearLine)
+	v.send(b.String() + v.prompt(st))
+}
+
+func (v *canvas_viewer) square(c *canvas.Canvas, p canvas.Point) string {
+	cell := c.At(p)
+	s := string(cell.Ch)
+	if !v.bw && cell != canvas.Blank {
+		s = fg(int(cell.Color.R), int(cell.Color.G), int(cell.Color.B)) + s
+	}
+	if p == v.cursor {
+		s = "\033[7m" + s
+	}
+	return s + resetAttrs
+}
+
+func (v *canvas_viewer) status_line(st *canvas_state) string {
+	brush := fmt.Sprintf("brush '%c' %s", v.brush.Ch, v.brush.Color)
+	if v.eraser {
+		brush = "eraser"
+	}
+	pen := "pen up"
+	if v.pen {
+		pen = "pen down"
+	}
+
+	s := fmt.Sprintf("%d,%d   %s   %s   %d drawing", v.cursor.X+1, v.cursor.Y+1, brush, pen, len(st.viewers))
+	if v.status != "" {
+		s += "   " + v.status
+	}
+	return s
+}
+
+func (v *canvas_viewer) prompt(st *canvas_state) string {
+	return fmt.Sprintf("\033[%d;1H> %s", st.c.Height+canvas_top+2, clearLine)
+}
+
+// send writes to the viewer from the canvas goroutine. The deadline stops
+// one stuck client holding up everyone else for long.
+func (v *canvas_viewer) send(s string) {
+	v.sess.conn.SetWriteDeadline(time.Now().Add(versus_write_timeout))
+	v.sess.send(s)
+	v.sess.conn.SetWriteDeadline(time.Time{})
+
+	if g := v.sess.live.Load(); g != nil {
+		g.show(canvas_frame(v))
+	}
+}
+
+// canvas_frame is the whole canvas as v sees it, for spectators.
+func canvas_frame(v *canvas_viewer) string {
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	for y := range canvas_height {
+		b.WriteString(strings.Join(v.shown[y*canvas_width:(y+1)*canvas_width], "") + "\n")
+	}
+	return b.String()
+}
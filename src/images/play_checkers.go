@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/checkers"
+)
+
+const (
+	checkers_turn_time = 2 * time.Minute
+	checkers_ai_pause  = 600 * time.Millisecond
+	checkers_depth     = 6
+	checkers_max_depth = 10
+
+	// With only kings moving and nothing taken for this many moves in a
+	// row, neither side is getting anywhere and the game is drawn.
+	checkers_quiet_limit = 80
+)
+
+var (
+	checkers_light = bg(225, 205, 165)
+	checkers_dark  = bg(110, 75, 45)
+	checkers_moved = bg(150, 115, 50)
+
+	checkers_pieces = map[checkers.Piece]string{
+		checkers.BlackMan:  fg(20, 20, 20) + "\033[1m ● ",
+		checkers.BlackKing: fg(20, 20, 20) + "\033[1m ♚ ",
+		checkers.WhiteMan:  fg(250, 250, 245) + "\033[1m ● ",
+		checkers.WhiteKing: fg(250, 250, 245) + "\033[1m ♚ ",
+	}
+	checkers_bw_pieces = map[checkers.Piece]string{
+		checkers.BlackMan:  " b ",
+		checkers.BlackKing: " B ",
+		checkers.WhiteMan:  " w ",
+		checkers.WhiteKing: " W ",
+	}
+)
+
+type checkers_game struct {
+	m     *versus_match
+	board checkers.Board
+	turn  checkers.Side
+	last  *checkers.Move
+	quiet int
+
+	// shown is the status line each player was last drawn with.
+	shown [2]string
+
+	depth int
+	rng   *rand.Rand
+}
+
+// play_checkers handles "play checkers [ai [DEPTH]]".
+func play_checkers(sess *session, args []string) (string, error) {
+	usage := fmt.Sprintf("Usage: play checkers [ai [DEPTH]], with DEPTH from 1 to %d.\n", checkers_max_depth)
+
+	ai, depth := false, checkers_depth
+	if len(args) > 0 {
+		if args[0] != "ai" || len(args) > 2 {
+			return usage, nil
+		}
+		ai = true
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > checkers_max_depth {
+			return usage, nil
+		}
+		depth = n
+	}
+
+	return versus_play(sess, "checkers", ai, func(m *versus_match) {
+		g := &checkers_game{
+			m:     m,
+			board: checkers.New(),
+			depth: depth,
+			rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+		m.redraw = g.redraw
+		if m.attach(g) {
+			g.run()
+		}
+	})
+}
+
+// checkers_state is what's kept of a game while its match is frozen.
+type checkers_state struct {
+	Board checkers.Board
+	Turn  checkers.Side
+	Last  *checkers.Move
+	Quiet int
+}
+
+func (g *checkers_game) save() ([]byte, error) {
+	return json.Marshal(checkers_state{g.board, g.turn, g.last, g.quiet})
+}
+
+func (g *checkers_game) restore(data []byte) error {
+	var s checkers_state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	g.board, g.turn, g.last, g.quiet = s.Board, s.Turn, s.Last, s.Quiet
+	return nil
+}
+
+// The first player takes Black, which moves first.
+func checkers_side(p int) checkers.Side {
+	return checkers.Side(p)
+}
+
+func (g *checkers_game) run() {
+	status := [2]string{}
+
+	for {
+		moves := g.board.Moves(g.turn)
+		p := int(g.turn)
+		if len(moves) == 0 {
+			why := "has no moves left"
+			if men, kings := g.board.Count(g.turn); men+kings == 0 {
+				why = "has no pieces left"
+			}
+			g.finish(1-p, why)
+			return
+		}
+		if g.quiet >= checkers_quiet_limit {
+			g.draw([2]string{"Drawn: nothing has been taken in a long while.", "Drawn: nothing has been taken in a long while."})
+			g.m.end("Checkers: a draw.\n", "Checkers: a draw.\n")
+			return
+		}
+
+		if status[p] == "" {
+			status[p] = "Your move, e.g. 'b6 c5'. 'moves' lists them, 'q' resigns."
+		}
+		status[1-p] = "Waiting for your opponent..."
+		g.draw(status)
+		status = [2]string{}
+
+		var move checkers.Move
+		if g.m.ai(p) {
+			time.Sleep(checkers_ai_pause)
+			move = checkers.Best(g.board, g.turn, g.depth, g.rng)
+		} else {
+			var ok bool
+			if move, ok = g.take_turn(p, moves); !ok {
+				return
+			}
+		}
+
+		g.play(move)
+		status[1-p] = fmt.Sprintf("%s played %s.", g.turn.Other(), move)
+	}
+}
+
+// take_turn waits for the player to give a legal move. It returns false
+// if the game ended instead.
+func (g *checkers_game) take_turn(p int, moves []checkers.Move) (checkers.Move, bool) {
+	g.m.start_clock(p, checkers_turn_time)
+	defer g.m.stop_clock(p)
+
+	for {
+		ev := g.m.next()
+		switch {
+		case ev.timeout:
+			g.finish(1-p, "ran out of time")
+			return checkers.Move{}, false
+		case ev.gone || ev.line == "q" || ev.line == "resign":
+			g.finish(1-ev.player, "resigned")
+			return checkers.Move{}, false
+		}
+		if ev.player != p {
+			g.m.send(ev.player, "Not your turn.\n> ")
+			continue
+		}
+
+		if strings.TrimSpace(ev.line) == "moves" {
+			g.m.send(p, "Legal moves: "+checkers_list(moves)+"\n> ")
+			continue
+		}
+		move, err := checkers.Find(moves, ev.line)
+		if err != nil {
+			g.m.send(p, err.Error()+".\n> ")
+			continue
+		}
+		return move, true
+	}
+}
+
+func checkers_list(moves []checkers.Move) string {
+	var names []string
+	for _, m := range moves {
+		names = append(names, m.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *checkers_game) play(move checkers.Move) {
+	from := move.Path[0]
+	if len(move.Jumps) > 0 || !g.board.At(from).King() {
+		g.quiet = 0
+	} else {
+		g.quiet++
+	}
+
+	g.board = g.board.Apply(move)
+	g.last = &move
+	g.turn = g.turn.Other()
+}
+
+// finish ends the game in winner's favour; why says what the loser did.
+func (g *checkers_game) finish(winner int, why string) {
+	loser := 1 - winner
+	msg := fmt.Sprintf("%s %s.", checkers_side(loser), why)
+	g.draw([2]string{msg, msg})
+
+	results := [2]string{}
+	results[winner] = fmt.Sprintf("Checkers: you won as %s! %s%s\n", checkers_side(winner), msg,
+		record_win(g.m.session(winner), g.m.session(loser), "checkers"))
+	results[loser] = fmt.Sprintf("Checkers: you lost as %s. %s\n", checkers_side(loser), msg)
+	g.m.end(results[0], results[1])
+}
+
+func (g *checkers_game) draw(status [2]string) {
+	g.shown = status
+	for p := range 2 {
+		g.redraw(p)
+	}
+}
+
+func (g *checkers_game) redraw(p int) {
+	if g.m.ai(p) {
+		return
+	}
+	g.m.send(p, g.render(p, g.m.seats[p].sess.mode == "bw", g.shown[p]))
+}
+
+// render draws the board from player p's side, so their men always head
+// up the screen.
+func (g *checkers_game) render(p int, bw bool, status string) string {
+	var b strings.Builder
+
+	me := checkers_side(p)
+	men, kings := g.board.Count(me)
+	their_men, their_kings := g.board.Count(me.Other())
+
+	against := "another player"
+	if g.m.ai(1 - p) {
+		against = fmt.Sprintf("the computer (depth %d)", g.depth)
+	}
+	fmt.Fprintf(&b, "%s\033[1mCheckers\033[0m   you are %s, playing %s\n", clearScreen, me, against)
+	fmt.Fprintf(&b, "you: %d men, %d kings   them: %d men, %d kings\n\n", men, kings, their_men, their_kings)
+
+	flip := me == checkers.Black
+	at := func(i int) int {
+		if flip {
+			return checkers.Size - 1 - i
+		}
+		return i
+	}
+
+	moved := map[checkers.Square]bool{}
+	if g.last != nil {
+		for _, s := range g.last.Path {
+			moved[s] = true
+		}
+	}
+
+	files := "    "
+	for i := range checkers.Size {
+		files += fmt.Sprintf(" %c ", 'a'+at(i))
+	}
+
+	b.WriteString(files + "\n")
+	for i := range checkers.Size {
+		r := at(i)
+		fmt.Fprintf(&b, " %d  ", checkers.Size-r)
+		for j := range checkers.Size {
+			s := checkers.Square{Row: r, Col: at(j)}
+			b.WriteString(checkers_square(g.board.At(s), s, moved[s], bw))
+		}
+		fmt.Fprintf(&b, "  %d\n", checkers.Size-r)
+	}
+	b.WriteString(files + "\n\n")
+
+	b.WriteString(status + "\n> ")
+	return b.String()
+}
+
+func checkers_square(p checkers.Piece, s checkers.Square, moved, bw bool) string {
+	dark := (s.Row+s.Col)%2 == 1
+
+	if bw {
+		switch {
+		case p != checkers.Empty:
+			return checkers_bw_pieces[p]
+		case moved:
+			return " * "
+		case dark:
+			return " . "
+		}
+		return "   "
+	}
+
+	back := checkers_light
+	if moved {
+		back = checkers_moved
+	} else if dark {
+		back = checkers_dark
+	}
+	if p == checkers.Empty {
+		return back + "   " + resetAttrs
+	}
+	return back + checkers_pieces[p] + resetAttrs
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/chess"
+)
+
+const chess_turn_time = 5 * time.Minute
+
+var (
+	chess_light = bg(240, 217, 181)
+	chess_dark  = bg(181, 136, 99)
+	chess_moved = bg(205, 210, 106)
+	chess_check = bg(220, 80, 70)
+
+	// The solid glyphs are used for both sides and colored in, which
+	// reads better on a colored square than the outlined white ones.
+	chess_glyphs = map[chess.Kind]string{
+		chess.Pawn:   "♟",
+		chess.Knight: "♞",
+		chess.Bishop: "♝",
+		chess.Rook:   "♜",
+		chess.Queen:  "♛",
+		chess.King:   "♚",
+	}
+	chess_colors = [2]string{fg(255, 255, 255), fg(20, 20, 20)}
+)
+
+type chess_game struct {
+	m    *versus_match
+	game *chess.Game
+	last *chess.Move
+
+	// offer is the player who has offered a draw, or -1.
+	offer int
+
+	shown [2]string
+}
+
+// play_chess handles "play chess".
+func play_chess(sess *session, args []string) (string, error) {
+	if len(args) > 0 {
+		return "Usage: play chess\n", nil
+	}
+
+	return versus_play(sess, "chess", false, func(m *versus_match) {
+		g := &chess_game{m: m, game: chess.NewGame(), offer: -1}
+		m.redraw = g.redraw
+		if m.attach(g) {
+			g.run()
+		}
+	})
+}
+
+// chess_state is what's kept of a game while its match is frozen. The
+// moves are played over again to restore it, which brings back the
+// counts for repetition along with the position.
+type chess_state struct {
+	SAN   []string
+	Offer int
+}
+
+func (g *chess_game) save() ([]byte, error) {
+	return json.Marshal(chess_state{g.game.SAN, g.offer})
+}
+
+func (g *chess_game) restore(data []byte) error {
+	var s chess_state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	g.game, g.last, g.offer = chess.NewGame(), nil, s.Offer
+	for _, san := range s.SAN {
+		m, err := g.game.Pos.ParseMove(san)
+		if err != nil {
+			return fmt.Errorf("%s: %w", san, err)
+		}
+		g.game.Play(san)
+		g.last = &m
+	}
+	return nil
+}
+
+// The first player takes White.
+func chess_side(p int) chess.Color {
+	return chess.Color(p)
+}
+
+func (g *chess_game) run() {
+	status := [2]string{}
+
+	for !g.game.Over() {
+		p := int(g.game.Pos.Turn)
+		if status[p] == "" {
+			status[p] = "Your move, e.g. 'e4' or 'Nf3'. 'moves' lists them; 'draw' offers one; 'resign' resigns."
+		}
+		if status[1-p] == "" {
+			status[1-p] = "Waiting for your opponent..."
+		}
+		if g.game.Pos.InCheck() {
+			status[p] = "Check! " + status[p]
+		}
+		g.draw(status)
+		status = [2]string{}
+
+		san, ok := g.take_turn(p)
+		if !ok {
+			break
+		}
+		if san != "" {
+			status[1-p] = fmt.Sprintf("%s played %s.", chess_side(p), san)
+		}
+	}
+
+	g.finish()
+}
+
+// take_turn handles input until the player to move makes a move, which
+// it returns in SAN. It returns false if the game ended some other way.
+func (g *chess_game) take_turn(p int) (string, bool) {
+	g.m.start_clock(p, chess_turn_time)
+	defer g.m.stop_clock(p)
+
+	for {
+		ev := g.m.next()
+		line := strings.TrimSpace(ev.line)
+
+		switch {
+		case ev.timeout:
+			g.game.Forfeit(chess_side(p), chess_side(p).String()+" ran out of time")
+			return "", false
+		case ev.gone:
+			g.game.Forfeit(chess_side(ev.player), chess_side(ev.player).String()+" left")
+			return "", false
+		case line == "resign" || line == "q":
+			g.game.Resign(chess_side(ev.player))
+			return "", false
+		case line == "pgn":
+			g.m.send(ev.player, "\n"+g.pgn()+"> ")
+			continue
+		case line == "draw" && g.offer == 1-ev.player:
+			g.game.Draw()
+			return "", false
+		case line == "draw":
+			g.offer = ev.player
+			g.m.send(ev.player, "You offered a draw.\n> ")
+			g.m.send(1-ev.player, "Your opponent offers a draw: type 'draw' to accept, or carry on to decline.\n> ")
+			continue
+		case ev.player != p:
+			g.m.send(ev.player, "Not your turn.\n> ")
+			continue
+		case line == "moves":
+			g.m.send(p, "Legal moves: "+g.legal_moves()+"\n> ")
+			continue
+		}
+
+		m, err := g.game.Pos.ParseMove(line)
+		if err != nil {
+			g.m.send(p, err.Error()+".\n> ")
+			continue
+		}
+		san, _ := g.game.Play(line)
+		g.last = &m
+
+		// Moving instead of answering turns a draw offer down. An offer of
+		// the player's own stands until the other answers it.
+		if g.offer == 1-p {
+			g.offer = -1
+		}
+		return san, true
+	}
+}
+
+func (g *chess_game) legal_moves() string {
+	var names []string
+	for _, m := range g.game.Pos.Moves() {
+		names = append(names, g.game.Pos.SAN(m))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (g *chess_game) pgn() string {
+	return g.game.PGN([][2]string{
+		{"Event", "Casual game"},
+		{"Site", "image-server-thing"},
+		{"Date", time.Now().Format("2006.01.02")},
+		{"White", player_name(g.m.session(0), "White")},
+		{"Black", player_name(g.m.session(1), "Black")},
+	})
+}
+
+func (g *chess_game) finish() {
+	msg := fmt.Sprintf("%s (%s).", chess_result_words(g.game.Result), g.game.Reason)
+	g.draw([2]string{msg, msg})
+
+	pgn := g.pgn()
+	winner := -1
+	switch g.game.Result {
+	case chess.WhiteWins:
+		winner = 0
+	case chess.BlackWins:
+		winner = 1
+	}
+
+	results := [2]string{}
+	for p := range 2 {
+		g.m.session(p).last_pgn = pgn
+
+		switch p {
+		case winner:
+			results[p] = fmt.Sprintf("Chess: you won as %s! %s%s", chess_side(p), msg, record_win(g.m.session(p), g.m.session(1-p), "chess"))
+		case 1 - winner:
+			results[p] = fmt.Sprintf("Chess: you lost as %s. %s", chess_side(p), msg)
+		default:
+			results[p] = "Chess: " + msg
+		}
+		results[p] += " Type 'pgn' for the game record.\n"
+	}
+	g.m.end(results[0], results[1])
+}
+
+func chess_result_words(result string) string {
+	switch result {
+	case chess.WhiteWins:
+		return "White wins"
+	case chess.BlackWins:
+		return "Black wins"
+	}
+	return "Drawn"
+}
+
+func (g *chess_game) draw(status [2]string) {
+	g.shown = status
+	for p := range 2 {
+		g.redraw(p)
+	}
+}
+
+func (g *chess_game) redraw(p int) {
+	if g.m.ai(p) {
+		return
+	}
+	g.m.send(p, g.render(p, g.m.seats[p].sess.mode == "bw", g.shown[p]))
+}
+
+// render draws the board from player p's side, so their pieces are
+// always at the bottom.
+func (g *chess_game) render(p int, bw bool, status string) string {
+	var b strings.Builder
+
+	pos := &g.game.Pos
+	me := chess_side(p)
+	fmt.Fprintf(&b, "%s\033[1mChess\033[0m   you are %s   move %d\n\n", clearScreen, me, pos.Fullmove)
+
+	at := func(i int) int {
+		if me == chess.White {
+			return 7 - i
+		}
+		return i
+	}
+
+	checked := chess.NoSquare
+	if pos.InCheck() {
+		for s, piece := range pos.Board {
+			if piece.Kind == chess.King && piece.Color == pos.Turn {
+				checked = chess.Square(s)
+			}
+		}
+	}
+
+	files := "    "
+	for i := range 8 {
+		files += fmt.Sprintf(" %c ", 'a'+7-at(i))
+	}
+
+	b.WriteString(files + "\n")
+	for i := range 8 {
+		rank := at(i)
+		fmt.Fprintf(&b, " %d  ", rank+1)
+		for j := range 8 {
+			s := chess.Sq(7-at(j), rank)
+			moved := g.last != nil && (g.last.From == s || g.last.To == s)
+			b.WriteString(chess_square(pos.At(s), s, moved, s == checked, bw))
+		}
+		fmt.Fprintf(&b, "  %d\n", rank+1)
+	}
+	b.WriteString(files + "\n\n")
+
+	if n := len(g.game.SAN); n > 0 {
+		fmt.Fprintf(&b, "Last move: %s\n", g.game.SAN[n-1])
+	}
+	b.WriteString(status + "\n> ")
+	return b.String()
+}
+
+func chess_square(piece chess.Piece, s chess.Square, moved, checked, bw bool) string {
+	light := (s.File()+s.Rank())%2 == 1
+
+	if bw {
+		switch {
+		case piece.Kind != chess.None:
+			return " " + string(piece.FEN()) + " "
+		case moved:
+			return " * "
+		case !light:
+			return " . "
+		}
+		return "   "
+	}
+
+	back := chess_dark
+	switch {
+	case checked:
+		back = chess_check
+	case moved:
+		back = chess_moved
+	case light:
+		back = chess_light
+	}
+	if piece.Kind == chess.None {
+		return back + "   " + resetAttrs
+	}
+	return back + chess_colors[piece.Color] + "\033[1m " + chess_glyphs[piece.Kind] + " " + resetAttrs
+}
+
+// pgn_command handles "pgn", which prints the last chess game played.
+func pgn_command(sess *session, _ string) string {
+	if sess.last_pgn == "" {
+		return "No finished chess game yet. Try 'play chess'.\n"
+	}
+	return sess.last_pgn
+}
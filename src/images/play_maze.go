@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/maze"
+)
+
+const (
+	maze_width  = 31
+	maze_height = 21
+
+	// How far the player can see in fog.
+	maze_sight = 6
+)
+
+var maze_moves = map[rune]maze.Point{
+	'w': maze.Up,
+	's': maze.Down,
+	'a': maze.Left,
+	'd': maze.Right,
+}
+
+var (
+	maze_wall  = fg(110, 110, 150) + "██" + resetAttrs
+	maze_fog   = fg(35, 35, 45) + "░░" + resetAttrs
+	maze_me    = fg(255, 220, 60) + "\033[1m@ " + resetAttrs
+	maze_exit  = fg(90, 230, 90) + "\033[1m⚑ " + resetAttrs
+	maze_crumb = fg(140, 120, 60) + "· " + resetAttrs
+
+	// The overlay at the end. In a perfect maze the only way out is the
+	// shortest, so everything the player walked off it was a detour.
+	maze_optimal = bg(40, 140, 60) + "  " + resetAttrs
+	maze_detour  = bg(150, 110, 30) + "  " + resetAttrs
+)
+
+type maze_game struct {
+	m    *maze.Maze
+	seed int64
+	me   maze.Point
+
+	// trail is every square stood on.
+	trail map[maze.Point]bool
+	steps int
+
+	full   bool
+	crumbs bool
+}
+
+// play_maze handles "play maze [SEED] [WxH] [full]".
+func play_maze(sess *session, args []string) (string, error) {
+	usage := "Usage: play maze [SEED] [WxH] [full], e.g. play maze 12345 31x21\n"
+
+	seed := time.Now().UnixNano() % 100000
+	width, height, full := maze_width, maze_height, false
+	for _, arg := range args {
+		if arg == "full" {
+			full = true
+		} else if w, h, ok := strings.Cut(arg, "x"); ok {
+			var errw, errh error
+			width, errw = strconv.Atoi(w)
+			height, errh = strconv.Atoi(h)
+			if errw != nil || errh != nil || width < 7 || width > 79 || height < 7 || height > 41 {
+				return "Mazes can be from 7x7 up to 79x41.\n", nil
+			}
+		} else if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+			seed = n
+		} else {
+			return usage, nil
+		}
+	}
+
+	g := new_maze_game(seed, width, height, full)
+	escaped, err := g.run(sess)
+	if err != nil {
+		return "", err
+	}
+	if !escaped {
+		return fmt.Sprintf("Maze: gave up after %d steps (seed %d).\n", g.steps, g.seed), nil
+	}
+
+	// Mazes differ, so the leaderboard ranks steps wasted rather than
+	// steps taken.
+	best := g.shortest()
+	return fmt.Sprintf("Maze: escaped in %d steps, shortest %d (seed %d, %dx%d).%s\n",
+		g.steps, best, g.seed, g.m.Width, g.m.Height, sess.record_score("maze", float64(g.steps-best))), nil
+}
+
+// new_maze_game sets up the maze seed makes, so the same seed always
+// gives the same maze.
+func new_maze_game(seed int64, width, height int, full bool) *maze_game {
+	g := &maze_game{
+		m:     maze.New(width, height, rand.New(rand.NewSource(seed))),
+		seed:  seed,
+		trail: map[maze.Point]bool{},
+		full:  full,
+	}
+	g.move_to(g.m.Start)
+	return g
+}
+
+// run lets the player walk until they reach the exit, then shows them the
+// way they could have taken. It returns false if they gave up.
+func (g *maze_game) run(sess *session) (bool, error) {
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(clearScreen + hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	help := "w/a/s/d or arrows to walk, v to toggle view, t for breadcrumbs, q to quit."
+	for g.me != g.m.Exit {
+		sess.send(g.draw(help))
+
+		k, ok := <-keys
+		if !ok {
+			return false, io.EOF
+		}
+
+		switch k {
+		case 'q':
+			return false, nil
+		case 'v':
+			g.full = !g.full
+		case 't':
+			g.crumbs = !g.crumbs
+		default:
+			if d, ok := maze_moves[k]; ok && !g.m.Wall(g.me.Add(d)) {
+				g.move_to(g.me.Add(d))
+				g.steps++
+			}
+		}
+	}
+
+	sess.send(g.draw_solution(fmt.Sprintf("Out in %d steps; the shortest way is %d. Press any key.", g.steps, g.shortest())))
+	if _, ok := <-keys; !ok {
+		return false, io.EOF
+	}
+	return true, nil
+}
+
+func (g *maze_game) shortest() int {
+	return len(g.m.Solve()) - 1
+}
+
+func (g *maze_game) move_to(p maze.Point) {
+	g.me = p
+	g.trail[p] = true
+}
+
+func (g *maze_game) header() string {
+	return fmt.Sprintf("\033[1mMaze\033[0m   seed %d   %dx%d   steps: %d%s\n",
+		g.seed, g.m.Width, g.m.Height, g.steps, clearLine)
+}
+
+func (g *maze_game) draw(status string) string {
+	var b strings.Builder
+
+	var seen map[maze.Point]bool
+	if !g.full {
+		seen = g.m.Visible(g.me, maze_sight)
+	}
+
+	b.WriteString(cursorHome + g.header())
+	for y := range g.m.Height {
+		for x := range g.m.Width {
+			p := maze.Point{X: x, Y: y}
+			switch {
+			case !g.full && !seen[p]:
+				b.WriteString(maze_fog)
+			case p == g.me:
+				b.WriteString(maze_me)
+			case p == g.m.Exit:
+				b.WriteString(maze_exit)
+			case g.m.Wall(p):
+				b.WriteString(maze_wall)
+			case g.crumbs && g.trail[p]:
+				b.WriteString(maze_crumb)
+			default:
+				b.WriteString("  ")
+			}
+		}
+		b.WriteString(clearLine + "\n")
+	}
+
+	b.WriteString(status + clearLine + "\n" + clearBelow)
+	return b.String()
+}
+
+// draw_solution shows the whole maze with the shortest route and the
+// detours the player took on the way.
+func (g *maze_game) draw_solution(status string) string {
+	var b strings.Builder
+
+	optimal := map[maze.Point]bool{}
+	for _, p := range g.m.Solve() {
+		optimal[p] = true
+	}
+
+	b.WriteString(cursorHome + g.header())
+	for y := range g.m.Height {
+		for x := range g.m.Width {
+			p := maze.Point{X: x, Y: y}
+			switch {
+			case g.m.Wall(p):
+				b.WriteString(maze_wall)
+			case optimal[p]:
+				b.WriteString(maze_optimal)
+			case g.trail[p]:
+				b.WriteString(maze_detour)
+			default:
+				b.WriteString("  ")
+			}
+		}
+		b.WriteString(clearLine + "\n")
+	}
+
+	b.WriteString(maze_optimal + " shortest way  " + maze_detour + " your detours" + clearLine + "\n")
+	b.WriteString(status + clearLine + "\n" + clearBelow)
+	return b.String()
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/memory"
+)
+
+const (
+	// How long a pair that doesn't match stays face up. Input sent in the
+	// meantime is thrown away so it can't turn over cards unseen.
+	memory_reveal = 1500 * time.Millisecond
+
+	memory_turn_time = 90 * time.Second
+	memory_ai_pause  = 700 * time.Millisecond
+	memory_ai_recall = 70
+)
+
+// Twelve colors, each used for two faces. Every face also has its own
+// letter, which is all that identifies it in bw mode.
+var memory_palette = [][3]int{
+	{230, 60, 60}, {240, 150, 40}, {240, 220, 60}, {120, 200, 60},
+	{40, 160, 90}, {60, 200, 200}, {60, 130, 230}, {120, 80, 220},
+	{200, 80, 200}, {240, 120, 170}, {150, 100, 60}, {200, 200, 200},
+}
+
+func memory_card(b *memory.Board, i int, up, bw bool) string {
+	c := b.Cards[i]
+	letter := string(rune('A' + c.Face))
+
+	switch {
+	case !up && !c.Matched && bw:
+		return " # "
+	case !up && !c.Matched:
+		return bg(70, 70, 90) + "   " + resetAttrs
+	case bw && c.Matched:
+		return " " + letter + " "
+	case bw:
+		return "[" + letter + "]"
+	}
+
+	col := memory_palette[c.Face%len(memory_palette)]
+	return bg(col[0], col[1], col[2]) + fg(20, 20, 20) + "\033[1m " + letter + " " + resetAttrs
+}
+
+// draw_memory shows the board with the cards in up turned over.
+func draw_memory(b *memory.Board, up map[int]bool, bw bool, header, status string) string {
+	var sb strings.Builder
+
+	sb.WriteString(clearScreen + "\033[1m" + header + "\033[0m\n\n   ")
+	for c := range b.Cols {
+		fmt.Fprintf(&sb, " %-3d", c+1)
+	}
+	sb.WriteString("\n")
+
+	for r := range b.Rows {
+		fmt.Fprintf(&sb, "%c   ", 'A'+r)
+		for c := range b.Cols {
+			i := r*b.Cols + c
+			sb.WriteString(memory_card(b, i, up[i], bw) + " ")
+		}
+		sb.WriteString("\n\n")
+	}
+
+	sb.WriteString(status + "\n> ")
+	return sb.String()
+}
+
+// memory_picks reads the one or two cards named on a line, as in "a1 b3".
+func memory_picks(b *memory.Board, line string) ([]int, error) {
+	var picks []int
+	for _, f := range strings.Fields(line) {
+		i, err := b.Index(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Check(i); err != nil {
+			return nil, err
+		}
+		picks = append(picks, i)
+	}
+
+	if len(picks) == 0 || len(picks) > 2 {
+		return nil, fmt.Errorf("name one or two cards, like 'a1 b3'")
+	}
+	return picks, nil
+}
+
+// play_memory handles "play memory [WxH] [duo]".
+func play_memory(sess *session, args []string) (string, error) {
+	usage := "Usage: play memory [WxH] [duo], with boards from 4x3 to 8x6.\n"
+
+	cols, rows, duo := 4, 4, false
+	for _, arg := range args {
+		if arg == "duo" {
+			duo = true
+		} else if _, err := fmt.Sscanf(arg, "%dx%d", &cols, &rows); err != nil {
+			return usage, nil
+		}
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	b, err := memory.New(cols, rows, rng)
+	if err != nil {
+		return fmt.Sprintf("Can't deal that: %v.\n", err), nil
+	}
+
+	if duo {
+		// Players are only paired with someone who asked for the same
+		// size of board.
+		name := fmt.Sprintf("memory %dx%d", cols, rows)
+		return versus_play(sess, name, false, func(m *versus_match) {
+			g := &memory_match{m: m, b: b, ai: memory.NewAI(memory_ai_recall, rng)}
+			m.redraw = g.redraw
+			if m.attach(g) {
+				g.run()
+			}
+		})
+	}
+
+	return memory_solo(sess, b)
+}
+
+func memory_solo(sess *session, b *memory.Board) (string, error) {
+	start := time.Now()
+	turns := 0
+	header := fmt.Sprintf("Memory %dx%d", b.Cols, b.Rows)
+	status := "Turn over two cards, e.g. 'a1 b3', or q to quit."
+	first := -1
+
+	for !b.Done() {
+		up := map[int]bool{first: first >= 0}
+		sess.send(draw_memory(b, up, sess.mode == "bw", fmt.Sprintf("%s   turns: %d", header, turns), status))
+
+		line, err := sess.readLine()
+		if err != nil {
+			return "", err
+		}
+		if line == "q" {
+			return fmt.Sprintf("Memory: gave up after %d turns.\n", turns), nil
+		}
+
+		picks, err := memory_picks(b, line)
+		if err != nil {
+			status = err.Error() + "."
+			continue
+		}
+		if first >= 0 {
+			picks = append([]int{first}, picks...)
+		}
+		if len(picks) == 1 {
+			first = picks[0]
+			status = "And the second?"
+			continue
+		}
+		if len(picks) > 2 {
+			status = "You already have one card up; name just one more."
+			continue
+		}
+
+		first = -1
+		match, err := b.Flip(picks[0], picks[1])
+		if err != nil {
+			status = err.Error() + "."
+			continue
+		}
+		turns++
+
+		if match {
+			status = "A pair!"
+			continue
+		}
+
+		up = map[int]bool{picks[0]: true, picks[1]: true}
+		sess.send(draw_memory(b, up, sess.mode == "bw", fmt.Sprintf("%s   turns: %d", header, turns), "No match."))
+		time.Sleep(memory_reveal)
+		sess.discard_input()
+		status = "No match. Try again."
+	}
+
+	sess.send(draw_memory(b, nil, sess.mode == "bw", header, "All pairs found!"))
+	return fmt.Sprintf("\nMemory: cleared %dx%d in %d turns and %s.%s\n",
+		b.Cols, b.Rows, turns, time.Since(start).Round(time.Second),
+		sess.record_score(fmt.Sprintf("memory-%dx%d", b.Cols, b.Rows), float64(turns))), nil
+}
+
+// memory_match is the two-player game: players take turns, and finding a
+// pair earns another go.
+type memory_match struct {
+	m      *versus_match
+	b      *memory.Board
+	ai     *memory.AI
+	scores [2]int
+	turn   int
+
+	// picks holds the first card of a turn once it's turned over.
+	picks []int
+
+	// up and status are what was last drawn, for redrawing a player who
+	// resumes.
+	up     map[int]bool
+	status [2]string
+}
+
+// memory_state is what's kept of a game while its match is frozen. The
+// computer's memory isn't: duo games are never against it.
+type memory_state struct {
+	Board  *memory.Board
+	Scores [2]int
+	Turn   int
+	Picks  []int
+}
+
+func (g *memory_match) save() ([]byte, error) {
+	return json.Marshal(memory_state{g.b, g.scores, g.turn, g.picks})
+}
+
+func (g *memory_match) restore(data []byte) error {
+	var s memory_state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	g.b, g.scores, g.turn, g.picks = s.Board, s.Scores, s.Turn, s.Picks
+	return nil
+}
+
+func (g *memory_match) run() {
+	status := [2]string{}
+
+	for !g.b.Done() {
+		turn := g.turn
+		if status[turn] == "" {
+			status[turn] = "Your turn: name two cards, e.g. 'a1 b3'."
+			status[1-turn] = "Opponent's turn."
+		}
+		g.draw(nil, status)
+
+		var picks []int
+		if g.m.ai(turn) {
+			picks = g.ai_turn(turn)
+		} else if picks = g.take_turn(turn); picks == nil {
+			return
+		}
+
+		match, _ := g.b.Flip(picks[0], picks[1])
+		up := map[int]bool{picks[0]: true, picks[1]: true}
+		for _, i := range picks {
+			g.ai.Saw(i, g.b.Cards[i].Face)
+		}
+
+		if match {
+			g.scores[turn]++
+			status[turn] = "A pair! Go again: name two more cards."
+			status[1-turn] = fmt.Sprintf("Opponent found a pair at %s and %s.", g.b.Name(picks[0]), g.b.Name(picks[1]))
+			continue
+		}
+
+		status[turn] = "No match."
+		status[1-turn] = "No match."
+		g.draw(up, status)
+		if !g.pause() {
+			return
+		}
+		g.turn = 1 - turn
+		status = [2]string{}
+	}
+
+	g.draw(nil, [2]string{"All pairs found.", "All pairs found."})
+
+	results := [2]string{}
+	for p := range 2 {
+		mine, theirs := g.scores[p], g.scores[1-p]
+		switch {
+		case mine > theirs:
+			results[p] = fmt.Sprintf("Memory: you won %d-%d!%s\n", mine, theirs, record_win(g.m.session(p), g.m.session(1-p), "memory-duo"))
+		case mine < theirs:
+			results[p] = fmt.Sprintf("Memory: you lost %d-%d.\n", mine, theirs)
+		default:
+			results[p] = fmt.Sprintf("Memory: a draw, %d-%d.\n", mine, theirs)
+		}
+	}
+	g.m.end(results[0], results[1])
+}
+
+// take_turn waits for the player to name two cards, showing the first as
+// soon as it is turned over. It returns nil if the game ended instead.
+func (g *memory_match) take_turn(turn int) []int {
+	g.m.start_clock(turn, memory_turn_time)
+	defer g.m.stop_clock(turn)
+
+	if len(g.picks) == 1 {
+		g.draw(map[int]bool{g.picks[0]: true}, [2]string{"And the second?", "Opponent's turn."})
+	}
+	for {
+		ev := g.m.next()
+		if ev.gone || ev.timeout || ev.line == "q" {
+			g.forfeit(ev.player)
+			return nil
+		}
+		if ev.player != turn {
+			g.m.send(ev.player, "Not your turn.\n> ")
+			continue
+		}
+
+		more, err := memory_picks(g.b, ev.line)
+		if err == nil && len(g.picks)+len(more) > 2 {
+			err = fmt.Errorf("that's more than two cards")
+		}
+		if err == nil && len(more) == 1 && len(g.picks) == 1 && more[0] == g.picks[0] {
+			err = memory.ErrSame
+		}
+		if err != nil {
+			g.m.send(turn, err.Error()+".\n> ")
+			continue
+		}
+
+		g.picks = append(g.picks, more...)
+		if len(g.picks) == 2 {
+			picks := g.picks
+			g.picks = nil
+			return picks
+		}
+		g.draw(map[int]bool{g.picks[0]: true}, [2]string{"And the second?", "Opponent's turn."})
+	}
+}
+
+// ai_turn has the computer turn over two cards, pausing so the other
+// player can follow along.
+func (g *memory_match) ai_turn(turn int) []int {
+	time.Sleep(memory_ai_pause)
+	first := g.ai.First(g.b)
+	g.draw(map[int]bool{first: true}, [2]string{"Opponent's turn.", "Opponent's turn."})
+
+	time.Sleep(memory_ai_pause)
+	second := g.ai.Second(g.b, first)
+	return []int{first, second}
+}
+
+// pause leaves the cards up for a moment, then throws away whatever was
+// typed in the meantime. It returns false if someone left.
+func (g *memory_match) pause() bool {
+	time.Sleep(memory_reveal)
+	for {
+		ev, ok := g.m.poll()
+		if !ok {
+			return true
+		}
+		if ev.gone {
+			g.forfeit(ev.player)
+			return false
+		}
+	}
+}
+
+func (g *memory_match) forfeit(p int) {
+	results := [2]string{}
+	results[p] = "Memory: you forfeited.\n"
+	results[1-p] = fmt.Sprintf("Memory: your opponent left. You win!%s\n", record_win(g.m.session(1-p), g.m.session(p), "memory-duo"))
+	g.m.end(results[0], results[1])
+}
+
+func (g *memory_match) draw(up map[int]bool, status [2]string) {
+	g.up, g.status = up, status
+	for p := range 2 {
+		g.redraw(p)
+	}
+}
+
+func (g *memory_match) redraw(p int) {
+	if g.m.ai(p) {
+		return
+	}
+
+	header := fmt.Sprintf("Memory %dx%d   you %d : %d opponent", g.b.Cols, g.b.Rows, g.scores[p], g.scores[1-p])
+	g.m.send(p, draw_memory(g.b, g.up, g.m.seats[p].sess.mode == "bw", header, g.status[p]))
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/pong"
+)
+
+const (
+	pong_width  = 60
+	pong_height = 20
+	pong_tick   = 50 * time.Millisecond
+	pong_target = 7
+
+	// A client that can't take a frame within this long is treated as
+	// gone rather than allowed to hold its writer forever.
+	pong_write_timeout = 5 * time.Second
+
+	// The computer paddle moves slower than a player can, so it can be
+	// beaten with angled returns.
+	pong_ai_speed = 0.45
+)
+
+// pong_player is one side of a match. Input and output are both decoupled
+// from the tick: keys only update the latest wanted direction, and frames
+// go through a one-slot channel so a slow connection misses frames
+// instead of holding up its opponent.
+type pong_player struct {
+	sess   *session
+	input  atomic.Int32
+	frames chan string
+	gone   atomic.Bool
+
+	// matched receives the match once an opponent turns up.
+	matched chan *pong_match
+	target  int
+}
+
+type pong_match struct {
+	game    *pong.Game
+	players [2]*pong_player // nil is the computer
+	target  int
+
+	done   chan struct{}
+	result [2]string
+}
+
+// The lobby holds at most one player waiting for an opponent.
+var pong_lobby struct {
+	sync.Mutex
+	waiting *pong_player
+}
+
+// play_pong handles "play pong [ai] [POINTS]".
+func play_pong(sess *session, args []string) (string, error) {
+	p := &pong_player{
+		sess:    sess,
+		frames:  make(chan string, 1),
+		matched: make(chan *pong_match, 1),
+		target:  pong_target,
+	}
+
+	ai := false
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= 21 {
+			p.target = n
+		} else if arg == "ai" {
+			ai = true
+		} else {
+			return "Usage: play pong [ai] [POINTS]\n", nil
+		}
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	var m *pong_match
+	if ai {
+		m = new_pong_match(p, nil, p.target)
+	} else {
+		var err error
+		if m, err = pong_matchmake(p, keys); m == nil {
+			return "No game.\n", err
+		}
+	}
+
+	return p.serve(m, keys)
+}
+
+// pong_matchmake pairs p with the waiting player, or waits to be paired.
+// While waiting the player can bail out or switch to playing the computer.
+func pong_matchmake(p *pong_player, keys <-chan rune) (*pong_match, error) {
+	pong_lobby.Lock()
+	if other := pong_lobby.waiting; other != nil {
+		pong_lobby.waiting = nil
+		pong_lobby.Unlock()
+
+		m := new_pong_match(other, p, other.target)
+		other.matched <- m
+		return m, nil
+	}
+	pong_lobby.waiting = p
+	pong_lobby.Unlock()
+
+	p.sess.send(clearScreen + fmt.Sprintf("Waiting for an opponent (first to %d)...\n", p.target) +
+		"Press a to play the computer instead, q to give up.\n")
+
+	// leave takes us out of the lobby unless someone matched us first, in
+	// which case that match is returned and has to be played.
+	leave := func() *pong_match {
+		pong_lobby.Lock()
+		defer pong_lobby.Unlock()
+		if pong_lobby.waiting == p {
+			pong_lobby.waiting = nil
+			return nil
+		}
+		return <-p.matched
+	}
+
+	for {
+		select {
+		case m := <-p.matched:
+			return m, nil
+		case k, ok := <-keys:
+			if !ok {
+				if m := leave(); m != nil {
+					p.gone.Store(true)
+					return m, nil
+				}
+				return nil, io.EOF
+			}
+
+			if k != 'q' && k != 'a' {
+				continue
+			}
+			if m := leave(); m != nil {
+				return m, nil
+			}
+			if k == 'a' {
+				return new_pong_match(p, nil, p.target), nil
+			}
+			return nil, nil
+		}
+	}
+}
+
+func new_pong_match(left, right *pong_player, target int) *pong_match {
+	var other *session
+	if right != nil {
+		other = right.sess
+	}
+	merge_live(left.sess, other)
+
+	m := &pong_match{
+		game:    pong.New(pong_width, pong_height, rand.New(rand.NewSource(time.Now().UnixNano()))),
+		players: [2]*pong_player{left, right},
+		target:  target,
+		done:    make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// serve runs one player's side of a match until it ends: keys feed the
+// player's input slot and a writer goroutine delivers frames. The writer
+// is always finished before serve returns so nothing else writes to the
+// connection at the same time.
+func (p *pong_player) serve(m *pong_match, keys <-chan rune) (string, error) {
+	side := 0
+	if m.players[1] == p {
+		side = 1
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for frame := range p.frames {
+			p.sess.conn.SetWriteDeadline(time.Now().Add(pong_write_timeout))
+			if err := p.sess.send(frame); err != nil {
+				p.gone.Store(true)
+			}
+		}
+		p.sess.conn.SetWriteDeadline(time.Time{})
+	}()
+
+	var err error
+	for waiting := true; waiting; {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				p.gone.Store(true)
+				err = io.EOF
+				keys = nil
+				continue
+			}
+
+			switch k {
+			case 'w':
+				p.input.Store(-1)
+			case 's':
+				p.input.Store(1)
+			case 'q':
+				p.gone.Store(true)
+			}
+		case <-m.done:
+			waiting = false
+		}
+	}
+
+	close(p.frames)
+	<-written
+
+	if err != nil {
+		return "", err
+	}
+	return m.result[side], nil
+}
+
+// offer hands the player a frame if their writer is ready for one.
+func (p *pong_player) offer(frame string) {
+	select {
+	case p.frames <- frame:
+	default:
+	}
+}
+
+func (m *pong_match) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(pong_tick)
+	defer ticker.Stop()
+
+	g := m.game
+	for range ticker.C {
+		for i, p := range m.players {
+			if p == nil {
+				m.ai_move(i)
+				continue
+			}
+
+			if p.gone.Load() {
+				m.finish(1-i, "forfeit")
+				return
+			}
+			g.MovePaddle(i, float64(p.input.Swap(0)))
+		}
+
+		g.Step()
+
+		for i, s := range g.Score {
+			if s >= m.target {
+				m.finish(i, fmt.Sprintf("%d-%d", g.Score[i], g.Score[1-i]))
+				return
+			}
+		}
+
+		for i, p := range m.players {
+			if p != nil {
+				p.offer(m.draw(i))
+			}
+		}
+	}
+}
+
+// ai_move tracks the ball while it's coming this way and drifts back to
+// the middle otherwise.
+func (m *pong_match) ai_move(side int) {
+	g := m.game
+
+	want := float64(g.Height-1) / 2
+	if (side == 0) == (g.VX < 0) {
+		want = g.BallY
+	}
+
+	centre := g.Paddles[side] + float64(pong.PaddleHeight-1)/2
+	dy := min(max(want-centre, -pong_ai_speed), pong_ai_speed)
+	g.MovePaddle(side, dy)
+}
+
+func (m *pong_match) finish(winner int, how string) {
+	loser := 1 - winner
+	m.result[winner] = fmt.Sprintf("Pong: you won (%s)!", how)
+	m.result[loser] = fmt.Sprintf("Pong: you lost (%s).\n", how)
+
+	if how == "forfeit" {
+		m.result[winner] = "Pong: your opponent left, you win by forfeit."
+		m.result[loser] = "Pong: you forfeited.\n"
+	}
+
+	if w, l := m.players[winner], m.players[loser]; w != nil && l != nil {
+		m.result[winner] += record_win(w.sess, l.sess, "pong")
+	}
+	m.result[winner] += "\n"
+}
+
+func (m *pong_match) name(side, viewer int) string {
+	switch {
+	case side == viewer:
+		return "you"
+	case m.players[side] == nil:
+		return "computer"
+	}
+	return "opponent"
+}
+
+func (m *pong_match) draw(viewer int) string {
+	g := m.game
+	var b strings.Builder
+
+	b.WriteString(cursorHome)
+	fmt.Fprintf(&b, "\033[1m%s %d : %d %s\033[0m   first to %d   w/s to move, q to forfeit%s\n",
+		m.name(0, viewer), g.Score[0], g.Score[1], m.name(1, viewer), m.target, clearLine)
+
+	b.WriteString("┌" + strings.Repeat("─", g.Width) + "┐" + clearLine + "\n")
+
+	bx, by := int(g.BallX+0.5), int(g.BallY+0.5)
+	for y := range g.Height {
+		b.WriteString("│")
+		for x := range g.Width {
+			switch {
+			case x == bx && y == by:
+				b.WriteString("●")
+			case x == g.PaddleColumn(0) && g.Covers(0, float64(y)):
+				b.WriteString(paddle_style(viewer == 0) + "█" + resetAttrs)
+			case x == g.PaddleColumn(1) && g.Covers(1, float64(y)):
+				b.WriteString(paddle_style(viewer == 1) + "█" + resetAttrs)
+			case x == g.Width/2:
+				b.WriteString("┊")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("│" + clearLine + "\n")
+	}
+
+	b.WriteString("└" + strings.Repeat("─", g.Width) + "┘" + clearLine + "\n" + clearBelow)
+	return b.String()
+}
+
+// The viewer's own paddle is highlighted so they know which side they are.
+func paddle_style(own bool) string {
+	if own {
+		return fg(90, 200, 255)
+	}
+	return ""
+}
+
+// pong_command handles "pong [ai] [POINTS]", play pong.
+func pong_command(sess *session, line string) (string, error) {
+	return play_command(sess, "play pong"+strings.TrimPrefix(line, "pong"))
+}
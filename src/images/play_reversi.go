@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/reversi"
+)
+
+const (
+	reversi_turn_time = 2 * time.Minute
+	reversi_ai_pause  = 600 * time.Millisecond
+	reversi_depth     = 4
+	reversi_max_depth = 8
+)
+
+var (
+	reversi_felt  = bg(30, 120, 70)
+	reversi_moved = bg(60, 160, 100)
+
+	reversi_discs = map[reversi.Disc]string{
+		reversi.BlackDisc: fg(20, 20, 20) + "\033[1m ● ",
+		reversi.WhiteDisc: fg(250, 250, 245) + "\033[1m ● ",
+	}
+	reversi_bw_discs = map[reversi.Disc]string{
+		reversi.BlackDisc: " X ",
+		reversi.WhiteDisc: " O ",
+	}
+	reversi_hint = fg(20, 60, 35) + " · "
+)
+
+type reversi_game struct {
+	m     *versus_match
+	board reversi.Board
+	turn  reversi.Side
+	last  *reversi.Square
+
+	// hints is whether each player sees their legal moves marked.
+	hints [2]bool
+
+	// shown is the status line each player was last drawn with.
+	shown [2]string
+
+	depth int
+	rng   *rand.Rand
+}
+
+// play_reversi handles "play reversi [ai [DEPTH]]".
+func play_reversi(sess *session, args []string) (string, error) {
+	usage := fmt.Sprintf("Usage: play reversi [ai [DEPTH]], with DEPTH from 1 to %d.\n", reversi_max_depth)
+
+	ai, depth := false, reversi_depth
+	if len(args) > 0 {
+		if args[0] != "ai" || len(args) > 2 {
+			return usage, nil
+		}
+		ai = true
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > reversi_max_depth {
+			return usage, nil
+		}
+		depth = n
+	}
+
+	return versus_play(sess, "reversi", ai, func(m *versus_match) {
+		g := &reversi_game{
+			m:     m,
+			board: reversi.New(),
+			hints: [2]bool{true, true},
+			depth: depth,
+			rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		}
+		m.redraw = g.redraw
+		if m.attach(g) {
+			g.run()
+		}
+	})
+}
+
+// reversi_state is what's kept of a game while its match is frozen.
+type reversi_state struct {
+	Board reversi.Board
+	Turn  reversi.Side
+	Last  *reversi.Square
+	Hints [2]bool
+}
+
+func (g *reversi_game) save() ([]byte, error) {
+	return json.Marshal(reversi_state{g.board, g.turn, g.last, g.hints})
+}
+
+func (g *reversi_game) restore(data []byte) error {
+	var s reversi_state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	g.board, g.turn, g.last, g.hints = s.Board, s.Turn, s.Last, s.Hints
+	return nil
+}
+
+// The first player takes Black, which moves first.
+func reversi_side(p int) reversi.Side {
+	return reversi.Side(p)
+}
+
+func (g *reversi_game) run() {
+	status := [2]string{}
+
+	for {
+		p := int(g.turn)
+		if status[p] == "" {
+			status[p] = "Your move, e.g. 'd3'. 'moves' lists them, 'hints' toggles the markers, 'q' resigns."
+		}
+		if status[1-p] == "" {
+			status[1-p] = "Waiting for your opponent..."
+		}
+		g.draw(status)
+		status = [2]string{}
+
+		var s reversi.Square
+		if g.m.ai(p) {
+			time.Sleep(reversi_ai_pause)
+			s = reversi.Best(g.board, g.turn, g.depth, g.rng)
+		} else {
+			var ok bool
+			if s, ok = g.take_turn(p); !ok {
+				return
+			}
+		}
+
+		flipped := len(g.board.Flips(s, g.turn))
+		g.board = g.board.Apply(s, g.turn)
+		g.last = &s
+
+		next, passed, over := g.board.Next(g.turn)
+		if over {
+			g.finish()
+			return
+		}
+
+		played := fmt.Sprintf("%s played %s, flipping %d.", g.turn, s, flipped)
+		if passed {
+			status[p] = played + " Your opponent has no move and passes, so it's you again."
+			status[1-p] = played + " You have no move, so you pass."
+		} else {
+			status[1-p] = played
+		}
+		g.turn = next
+	}
+}
+
+// take_turn waits for the player to give a legal square. It returns false
+// if the game ended instead.
+func (g *reversi_game) take_turn(p int) (reversi.Square, bool) {
+	g.m.start_clock(p, reversi_turn_time)
+	defer g.m.stop_clock(p)
+
+	for {
+		ev := g.m.next()
+		line := strings.TrimSpace(ev.line)
+
+		switch {
+		case ev.timeout:
+			g.forfeit(1-p, "ran out of time")
+			return reversi.Square{}, false
+		case ev.gone || line == "q" || line == "resign":
+			g.forfeit(1-ev.player, "resigned")
+			return reversi.Square{}, false
+		case line == "hints":
+			g.hints[ev.player] = !g.hints[ev.player]
+			g.redraw(ev.player)
+			continue
+		case ev.player != p:
+			g.m.send(ev.player, "Not your turn.\n> ")
+			continue
+		case line == "moves":
+			g.m.send(p, "Legal moves: "+reversi_list(g.board.Moves(g.turn))+"\n> ")
+			continue
+		}
+
+		s, err := reversi.ParseSquare(line)
+		if err == nil {
+			err = g.board.Check(s, g.turn)
+		}
+		if err != nil {
+			g.m.send(p, err.Error()+".\n> ")
+			continue
+		}
+		return s, true
+	}
+}
+
+func reversi_list(squares []reversi.Square) string {
+	var names []string
+	for _, s := range squares {
+		names = append(names, s.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// finish ends a game neither side can move in, on the count of discs.
+func (g *reversi_game) finish() {
+	black, white := g.board.Count(reversi.Black), g.board.Count(reversi.White)
+	msg := fmt.Sprintf("No moves are left: Black %d, White %d.", black, white)
+	g.draw([2]string{msg, msg})
+
+	if black == white {
+		g.m.end("Reversi: a draw. "+msg+"\n", "Reversi: a draw. "+msg+"\n")
+		return
+	}
+	winner := 0
+	if white > black {
+		winner = 1
+	}
+	g.won(winner, msg)
+}
+
+// forfeit ends the game in winner's favour; why says what the loser did.
+func (g *reversi_game) forfeit(winner int, why string) {
+	msg := fmt.Sprintf("%s %s.", reversi_side(1-winner), why)
+	g.draw([2]string{msg, msg})
+	g.won(winner, msg)
+}
+
+func (g *reversi_game) won(winner int, msg string) {
+	loser := 1 - winner
+	results := [2]string{}
+	results[winner] = fmt.Sprintf("Reversi: you won as %s! %s%s\n", reversi_side(winner), msg,
+		record_win(g.m.session(winner), g.m.session(loser), "reversi"))
+	results[loser] = fmt.Sprintf("Reversi: you lost as %s. %s\n", reversi_side(loser), msg)
+	g.m.end(results[0], results[1])
+}
+
+func (g *reversi_game) draw(status [2]string) {
+	g.shown = status
+	for p := range 2 {
+		g.redraw(p)
+	}
+}
+
+func (g *reversi_game) redraw(p int) {
+	if g.m.ai(p) {
+		return
+	}
+	g.m.send(p, g.render(p, g.m.seats[p].sess.mode == "bw", g.shown[p]))
+}
+
+// render draws the board for player p, with their legal moves marked if
+// it's their turn and they want hints.
+func (g *reversi_game) render(p int, bw bool, status string) string {
+	var b strings.Builder
+
+	me := reversi_side(p)
+	against := "another player"
+	if g.m.ai(1 - p) {
+		against = fmt.Sprintf("the computer (depth %d)", g.depth)
+	}
+	fmt.Fprintf(&b, "%s\033[1mReversi\033[0m   you are %s, playing %s\n", clearScreen, me, against)
+	fmt.Fprintf(&b, "you: %d discs   them: %d discs\n\n", g.board.Count(me), g.board.Count(me.Other()))
+
+	marked := map[reversi.Square]bool{}
+	if g.hints[p] && g.turn == me {
+		for _, s := range g.board.Moves(me) {
+			marked[s] = true
+		}
+	}
+
+	files := "    "
+	for c := range reversi.Size {
+		files += fmt.Sprintf(" %c ", 'a'+c)
+	}
+
+	b.WriteString(files + "\n")
+	for r := range reversi.Size {
+		fmt.Fprintf(&b, " %d  ", reversi.Size-r)
+		for c := range reversi.Size {
+			s := reversi.Square{Row: r, Col: c}
+			moved := g.last != nil && *g.last == s
+			b.WriteString(reversi_square(g.board.At(s), moved, marked[s], bw))
+		}
+		fmt.Fprintf(&b, "  %d\n", reversi.Size-r)
+	}
+	b.WriteString(files + "\n\n")
+
+	b.WriteString(status + "\n> ")
+	return b.String()
+}
+
+func reversi_square(d reversi.Disc, moved, hint, bw bool) string {
+	if bw {
+		switch {
+		case d != reversi.Empty:
+			return reversi_bw_discs[d]
+		case hint:
+			return " + "
+		}
+		return " . "
+	}
+
+	back := reversi_felt
+	if moved {
+		back = reversi_moved
+	}
+	switch {
+	case d != reversi.Empty:
+		return back + reversi_discs[d] + resetAttrs
+	case hint:
+		return back + reversi_hint + resetAttrs
+	}
+	return back + "   " + resetAttrs
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/rogue"
+	"github.com/atalii/image-server-thing/internal/rogue/dungeon"
+)
+
+var rogue_moves = map[rune]rogue.Point{
+	'w': rogue.Up,
+	's': rogue.Down,
+	'a': rogue.Left,
+	'd': rogue.Right,
+}
+
+// Squares in view are drawn bright, remembered ones in the lighter shades
+// and unexplored ones not at all.
+var (
+	rogue_wall   = fg(170, 150, 120) + "▓"
+	rogue_floor  = fg(190, 190, 190) + "."
+	rogue_stairs = fg(255, 255, 255) + "\033[1m>\033[22m"
+
+	rogue_old_wall   = fg(100, 100, 110) + "▒"
+	rogue_old_floor  = fg(55, 55, 65) + "░"
+	rogue_old_stairs = fg(120, 120, 120) + ">"
+
+	rogue_player  = fg(255, 220, 60) + "\033[1m@\033[22m"
+	rogue_monster = fg(230, 70, 60)
+
+	rogue_items = map[rogue.ItemKind]string{
+		rogue.Potion: fg(220, 90, 230) + "!",
+		rogue.Weapon: fg(90, 210, 230) + ")",
+	}
+)
+
+// play_rogue handles "play rogue".
+func play_rogue(sess *session, args []string) (string, error) {
+	if len(args) > 0 {
+		return "Usage: play rogue\n", nil
+	}
+
+	g := rogue.New(rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(clearScreen + hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	help := "w/a/s/d to move and attack, > to descend, . to wait, q to quit."
+	shown := 0
+	for !g.Dead {
+		var news []string
+		if shown < len(g.Log) {
+			news = g.Log[shown:]
+		}
+		shown = len(g.Log)
+		sess.send(draw_rogue(g, news, help))
+
+		k, ok := <-keys
+		if !ok {
+			return "", io.EOF
+		}
+
+		switch k {
+		case 'q':
+			return fmt.Sprintf("Rogue: you fled the dungeon from depth %d with a score of %d.\n", g.Depth, g.Score()), nil
+		case '>':
+			if !g.Descend() {
+				g.Say("There are no stairs here.")
+			}
+		case '.':
+			g.Wait()
+		default:
+			if d, ok := rogue_moves[k]; ok {
+				g.Move(d)
+			}
+		}
+	}
+
+	sess.send(draw_rogue(g, g.Log[shown:], fmt.Sprintf("You died on depth %d. Score: %d. Press any key.", g.Depth, g.Score())))
+	if _, ok := <-keys; !ok {
+		return "", io.EOF
+	}
+
+	return fmt.Sprintf("Rogue: died on depth %d with %d kills, score %d.%s\n",
+		g.Depth, g.Kills, g.Score(), sess.record_score("rogue", float64(g.Score()))), nil
+}
+
+func draw_rogue(g *rogue.Game, news []string, status string) string {
+	var b strings.Builder
+
+	weapon := "bare hands"
+	if g.Weapon != nil {
+		weapon = g.Weapon.Name
+	}
+
+	b.WriteString(cursorHome)
+	fmt.Fprintf(&b, "\033[1mRogue\033[0m   depth %d   HP %d/%d   attack %d   defense %d   %s   kills %d%s\n",
+		g.Depth, g.Player.HP, g.Player.MaxHP, g.Player.Attack, g.Player.Defense, weapon, g.Kills, clearLine)
+
+	for y := range rogue.Height {
+		for x := range rogue.Width {
+			b.WriteString(rogue_square(g, rogue.Point{X: x, Y: y}))
+		}
+		b.WriteString(resetAttrs + clearLine + "\n")
+	}
+
+	// Only the last couple of messages from this turn fit.
+	if len(news) > 2 {
+		news = news[len(news)-2:]
+	}
+	for i := range 2 {
+		if i < len(news) {
+			b.WriteString(news[i])
+		}
+		b.WriteString(clearLine + "\n")
+	}
+
+	b.WriteString(status + clearLine + "\n" + clearBelow)
+	return b.String()
+}
+
+func rogue_square(g *rogue.Game, p rogue.Point) string {
+	if !g.Visible[p] {
+		if !g.Seen[p] {
+			return " "
+		}
+		switch g.Level.At(p) {
+		case dungeon.Wall:
+			return rogue_old_wall
+		case dungeon.Stairs:
+			return rogue_old_stairs
+		}
+		return rogue_old_floor
+	}
+
+	if p == g.Pos {
+		return rogue_player
+	}
+	if m := g.MonsterAt(p); m != nil {
+		return rogue_monster + string(m.Glyph)
+	}
+	if it := g.ItemAt(p); it != nil {
+		return rogue_items[it.Kind]
+	}
+
+	switch g.Level.At(p) {
+	case dungeon.Wall:
+		return rogue_wall
+	case dungeon.Stairs:
+		return rogue_stairs
+	}
+	return rogue_floor
+}
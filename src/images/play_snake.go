@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/snake"
+)
+
+const (
+	snake_width  = 30
+	snake_height = 15
+
+	// A full-screen board fills this many rows with the score, walls and
+	// status line, and the session's width.
+	snake_full_rows = 24
+	snake_min_full  = 10
+
+	// Each point eaten shaves this much off the tick, down to snake_fastest.
+	snake_speedup = 4 * time.Millisecond
+	snake_fastest = 50 * time.Millisecond
+)
+
+var snake_speeds = map[string]time.Duration{
+	"slow":   220 * time.Millisecond,
+	"normal": 160 * time.Millisecond,
+	"fast":   110 * time.Millisecond,
+}
+
+var snake_turns = map[rune]snake.Point{
+	'w': snake.Up,
+	's': snake.Down,
+	'a': snake.Left,
+	'd': snake.Right,
+}
+
+// draw_snake draws g, with empty squares as empty, two columns wide.
+func draw_snake(g *snake.Game, status, empty string) string {
+	var sb strings.Builder
+
+	sb.WriteString(cursorHome)
+	fmt.Fprintf(&sb, "\033[1mSnake\033[0m   score: %d%s\n", g.Score, clearLine)
+
+	sb.WriteString("┌" + strings.Repeat("──", g.Width) + "┐" + clearLine + "\n")
+	for y := range g.Height {
+		sb.WriteString("│")
+		for x := range g.Width {
+			p := snake.Point{X: x, Y: y}
+			switch {
+			case p == g.Head():
+				sb.WriteString(fg(120, 255, 120) + "██" + resetAttrs)
+			case g.Occupies(p):
+				sb.WriteString(fg(40, 170, 40) + "██" + resetAttrs)
+			case p == g.Food:
+				sb.WriteString(fg(230, 50, 50) + "● " + resetAttrs)
+			default:
+				sb.WriteString(empty)
+			}
+		}
+		sb.WriteString("│" + clearLine + "\n")
+	}
+	sb.WriteString("└" + strings.Repeat("──", g.Width) + "┘" + clearLine + "\n")
+
+	sb.WriteString(status + clearLine + "\n" + clearBelow)
+	return sb.String()
+}
+
+// play_snake handles "play snake [slow|normal|fast|MILLISECONDS] [wrap]
+// [full]". A full board is as wide as the session and snake_full_rows
+// tall, with its empty squares shaded.
+func play_snake(sess *session, args []string) (string, error) {
+	tick := snake_speeds["normal"]
+	wrap := false
+	w, h, empty := snake_width, snake_height, "  "
+
+	for _, arg := range args {
+		if d, ok := snake_speeds[arg]; ok {
+			tick = d
+		} else if arg == "wrap" {
+			wrap = true
+		} else if arg == "full" {
+			w, h, empty = max((sess.width-2)/2, snake_min_full), snake_full_rows-4, "░░"
+		} else if ms, err := strconv.Atoi(arg); err == nil && ms >= 20 && ms <= 1000 {
+			tick = time.Duration(ms) * time.Millisecond
+		} else {
+			return "Usage: play snake [slow|normal|fast|MILLISECONDS] [wrap] [full]\n", nil
+		}
+	}
+
+	g := snake.New(w, h, wrap, rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(clearScreen + hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	interval := func() time.Duration {
+		return max(tick-time.Duration(g.Score)*snake_speedup, snake_fastest)
+	}
+	timer := time.NewTimer(interval())
+	defer timer.Stop()
+
+	status := "w/a/s/d or arrow keys to steer, q to quit. (netcat: type the key, then enter)"
+	sess.send(draw_snake(g, status, empty))
+
+	for !g.Over {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			if k == 'q' {
+				return fmt.Sprintf("Snake: quit with %d points.%s\n", g.Score, sess.record_score("snake", float64(g.Score))), nil
+			}
+			if d, ok := snake_turns[k]; ok {
+				g.Turn(d)
+			}
+		case <-timer.C:
+			g.Step()
+			sess.send(draw_snake(g, status, empty))
+			timer.Reset(interval())
+		}
+	}
+
+	sess.send(draw_snake(g, fmt.Sprintf("Game over! Score: %d. Press any key.", g.Score), empty))
+	if _, ok := <-keys; !ok {
+		return "", io.EOF
+	}
+
+	return fmt.Sprintf("Snake: game over with %d points.%s\n", g.Score, sess.record_score("snake", float64(g.Score))), nil
+}
+
+// snake_command handles "snake [ARGS...]", play snake full, with any of
+// its other options.
+func snake_command(sess *session, line string) (string, error) {
+	return play_command(sess, "play snake full"+strings.TrimPrefix(line, "snake"))
+}
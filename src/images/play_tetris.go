@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/tetris"
+)
+
+// Pieces fall a row every tetris_tick, whatever's pressed.
+const tetris_tick = 500 * time.Millisecond
+
+// The usual colors for each piece.
+var tetris_colors = map[tetris.Kind]string{
+	tetris.I: fg(0, 240, 240),
+	tetris.O: fg(240, 240, 0),
+	tetris.T: fg(160, 0, 240),
+	tetris.S: fg(0, 240, 0),
+	tetris.Z: fg(240, 0, 0),
+	tetris.J: fg(0, 80, 240),
+	tetris.L: fg(240, 160, 0),
+}
+
+var tetris_names = map[tetris.Kind]string{
+	tetris.I: "I", tetris.O: "O", tetris.T: "T", tetris.S: "S", tetris.Z: "Z", tetris.J: "J", tetris.L: "L",
+}
+
+func draw_tetris(g *tetris.Game, status string) string {
+	var sb strings.Builder
+
+	sb.WriteString(cursorHome)
+	fmt.Fprintf(&sb, "\033[1mTetris\033[0m   score: %d   lines: %d   next: %s%s%s\n",
+		g.Score, g.Lines, tetris_colors[g.Next], tetris_names[g.Next], resetAttrs+clearLine)
+
+	sb.WriteString("┌" + strings.Repeat("──", tetris.Width) + "┐" + clearLine + "\n")
+	for y := range tetris.Height {
+		sb.WriteString("│")
+		for x := range tetris.Width {
+			if k := g.At(tetris.Point{X: x, Y: y}); k != tetris.Empty {
+				sb.WriteString(tetris_colors[k] + "██" + resetAttrs)
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		sb.WriteString("│" + clearLine + "\n")
+	}
+	sb.WriteString("└" + strings.Repeat("──", tetris.Width) + "┘" + clearLine + "\n")
+
+	sb.WriteString(status + clearLine + "\n" + clearBelow)
+	return sb.String()
+}
+
+// play_tetris handles "play tetris".
+func play_tetris(sess *session, args []string) (string, error) {
+	if len(args) != 0 {
+		return "Usage: play tetris\n", nil
+	}
+
+	g := tetris.New(rand.New(rand.NewSource(time.Now().UnixNano())))
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(clearScreen + hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	ticker := time.NewTicker(tetris_tick)
+	defer ticker.Stop()
+
+	status := "a/d or ←/→ to move, w or ↑ to turn, s or ↓ to drop a row, space to drop, q to quit. (netcat: type the key, then enter)"
+	sess.send(draw_tetris(g, status))
+
+	for !g.Over {
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			switch k {
+			case 'q':
+				return fmt.Sprintf("Tetris: quit with %d points.%s\n", g.Score, sess.record_score("tetris", float64(g.Score))), nil
+			case 'a':
+				g.Move(-1)
+			case 'd':
+				g.Move(1)
+			case 'w':
+				g.Rotate()
+			case 's':
+				g.Drop()
+			case ' ':
+				g.HardDrop()
+			default:
+				continue
+			}
+		case <-ticker.C:
+			g.Drop()
+		}
+		sess.send(draw_tetris(g, status))
+	}
+
+	sess.send(draw_tetris(g, fmt.Sprintf("Game over! Score: %d. Press any key.", g.Score)))
+	if _, ok := <-keys; !ok {
+		return "", io.EOF
+	}
+
+	return fmt.Sprintf("Tetris: game over with %d points.%s\n", g.Score, sess.record_score("tetris", float64(g.Score))), nil
+}
+
+// tetris_command handles "tetris", play tetris.
+func tetris_command(sess *session, line string) (string, error) {
+	return play_command(sess, "play tetris"+strings.TrimPrefix(line, "tetris"))
+}
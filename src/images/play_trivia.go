@@ -0,0 +1,492 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/trivia"
+)
+
+var triviaDir = flag.String("trivia-dir", "", "load extra trivia packs from the JSON files in this directory")
+
+const (
+	trivia_questions = 10
+	trivia_time      = 20 * time.Second
+	trivia_reveal    = 3 * time.Second
+	trivia_countdown = 15 * time.Second
+)
+
+// trivia_bank is the starter pack plus whatever -trivia-dir adds; main
+// loads it.
+var trivia_bank *trivia.Bank
+
+// load_trivia fills trivia_bank. A bad pack stops the server from
+// starting rather than being skipped, so the file gets fixed.
+func load_trivia() error {
+	packs := [][]trivia.Question{trivia.Starter()}
+	if *triviaDir != "" {
+		qs, err := trivia.LoadDir(*triviaDir)
+		if err != nil {
+			return fmt.Errorf("-trivia-dir: %w", err)
+		}
+		packs = append(packs, qs)
+	}
+	trivia_bank = trivia.NewBank(packs...)
+	log.Printf("Trivia: %d questions", trivia_bank.Len())
+	return nil
+}
+
+// A trivia_room asks everyone in it the same questions at the same time.
+// A solo game is a room of one that starts at once. run moves it from
+// question to question; changed is closed and replaced whenever anything
+// shown changes.
+type trivia_room struct {
+	questions []trivia.Question
+	filter    string
+	starts    time.Time
+	start     chan struct{}
+
+	mu        sync.Mutex
+	players   []*trivia_player
+	current   int // -1 until the first question
+	asked     time.Time
+	revealing bool
+	over      bool
+	all_in    chan struct{} // closed once everyone still here has answered
+	changed   chan struct{}
+}
+
+type trivia_player struct {
+	name    string
+	choice  int // -1 until this question is answered
+	took    time.Duration
+	score   int
+	points  []int // per question asked, 0 if missed
+	choices []int
+	left    bool
+}
+
+// The lobby holds the room that is counting down, if any.
+var trivia_lobby struct {
+	sync.Mutex
+	open *trivia_room
+}
+
+func trivia_usage() string {
+	cats := trivia_bank.Categories()
+	names := make([]string, 0, len(cats))
+	for name := range cats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("Usage: play trivia [room] [CATEGORY] [%s]. Categories: %s.\n",
+		strings.Join(trivia.Difficulties, "|"), strings.Join(names, ", "))
+}
+
+// play_trivia handles "play trivia [room] [CATEGORY] [DIFFICULTY]". A room
+// game is joined by anyone else starting one in the next few seconds,
+// whatever they asked for.
+func play_trivia(sess *session, args []string) (string, error) {
+	room, category, difficulty := false, "", ""
+	cats := trivia_bank.Categories()
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		switch {
+		case arg == "room":
+			room = true
+		case arg == "easy" || arg == "medium" || arg == "hard":
+			difficulty = arg
+		case cats[arg] > 0:
+			category = arg
+		default:
+			return trivia_usage(), nil
+		}
+	}
+
+	if sess.trivia_seen == nil {
+		sess.trivia_seen = map[string]bool{}
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	questions := trivia_bank.Pick(rng, category, difficulty, trivia_questions, sess.trivia_seen)
+	if len(questions) == 0 {
+		return "No questions are " + strings.TrimSpace(difficulty+" "+category) + ". " + trivia_usage(), nil
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(hideCursor)
+
+	r := &trivia_room{
+		questions: questions,
+		filter:    strings.TrimSpace(category + " " + difficulty),
+		start:     make(chan struct{}),
+		current:   -1,
+		changed:   make(chan struct{}),
+	}
+	if r.filter == "" {
+		r.filter = "anything"
+	}
+
+	var me *trivia_player
+	if room {
+		r, me = trivia_join(sess, r)
+	} else {
+		me = r.add(sess)
+		close(r.start)
+		go r.run()
+	}
+
+	return trivia_play(sess, r, me)
+}
+
+// trivia_join joins the room that is counting down, or opens r.
+func trivia_join(sess *session, r *trivia_room) (*trivia_room, *trivia_player) {
+	trivia_lobby.Lock()
+	defer trivia_lobby.Unlock()
+
+	if trivia_lobby.open != nil {
+		r = trivia_lobby.open
+		return r, r.add(sess)
+	}
+
+	r.starts = time.Now().Add(trivia_countdown)
+	trivia_lobby.open = r
+	time.AfterFunc(trivia_countdown, func() {
+		trivia_lobby.Lock()
+		if trivia_lobby.open == r {
+			trivia_lobby.open = nil
+		}
+		trivia_lobby.Unlock()
+		close(r.start)
+		r.run()
+	})
+	return r, r.add(sess)
+}
+
+func (r *trivia_room) add(sess *session) *trivia_player {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := &trivia_player{name: sess.nick, choice: -1}
+	if p.name == "" {
+		p.name = fmt.Sprintf("guest%d", len(r.players)+1)
+	}
+	r.players = append(r.players, p)
+	r.notify()
+	return p
+}
+
+// notify wakes everyone up to redraw. r.mu must be held.
+func (r *trivia_room) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// run asks each question until everyone has answered it or its time is
+// up, then shows the answer for a moment. It stops early if everyone
+// leaves.
+func (r *trivia_room) run() {
+	for i := range r.questions {
+		all_in := make(chan struct{})
+
+		r.mu.Lock()
+		r.current, r.asked, r.revealing, r.all_in = i, time.Now(), false, all_in
+		for _, p := range r.players {
+			p.choice = -1
+		}
+		r.check_all_in()
+		r.notify()
+		r.mu.Unlock()
+
+		timer := time.NewTimer(trivia_time)
+		select {
+		case <-all_in:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		r.mu.Lock()
+		r.revealing = true
+		present := 0
+		for _, p := range r.players {
+			if p.left {
+				continue
+			}
+			present++
+			points := 0
+			if p.choice == r.questions[i].Answer {
+				points = trivia.Points(p.took, trivia_time)
+			}
+			p.score += points
+			p.points = append(p.points, points)
+			p.choices = append(p.choices, p.choice)
+		}
+		r.notify()
+		r.mu.Unlock()
+
+		if present == 0 {
+			break
+		}
+		time.Sleep(trivia_reveal)
+	}
+
+	r.mu.Lock()
+	r.over = true
+	r.notify()
+	r.mu.Unlock()
+}
+
+// check_all_in closes all_in if nobody still playing has yet to answer.
+// r.mu must be held.
+func (r *trivia_room) check_all_in() {
+	if r.all_in == nil {
+		return
+	}
+	for _, p := range r.players {
+		if !p.left && p.choice < 0 {
+			return
+		}
+	}
+	close(r.all_in)
+	r.all_in = nil
+}
+
+func (r *trivia_room) answer(p *trivia_player, choice int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current < 0 || r.revealing || r.over || p.choice >= 0 || choice >= len(r.questions[r.current].Choices) {
+		return
+	}
+	p.choice, p.took = choice, time.Since(r.asked)
+	r.check_all_in()
+	r.notify()
+}
+
+func (r *trivia_room) leave(p *trivia_player) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.left = true
+	r.check_all_in()
+	r.notify()
+}
+
+// trivia_play shows the room to one player and passes their answers on
+// until the last question, or until they leave.
+func trivia_play(sess *session, r *trivia_room, me *trivia_player) (string, error) {
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	// The countdown and each question's clock are redrawn every second.
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		r.mu.Lock()
+		changed, view, over := r.changed, r.draw(sess, me), r.over
+		r.mu.Unlock()
+
+		if view != "" {
+			sess.send(view)
+		}
+		if over {
+			break
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case k, ok := <-keys:
+			if !ok {
+				r.leave(me)
+				return "", io.EOF
+			}
+			switch {
+			case k == 'q':
+				r.leave(me)
+				return fmt.Sprintf("Trivia: left with %d points.\n", me.score), nil
+			case k >= 'a' && k < 'a'+trivia.MaxChoices:
+				r.answer(me, int(k-'a'))
+			}
+		}
+	}
+
+	for _, q := range r.questions[:len(me.points)] {
+		sess.trivia_seen[q.Question] = true
+	}
+	return fmt.Sprintf("Trivia: %d points.%s\n", me.score, sess.record_score("trivia", float64(me.score))), nil
+}
+
+// draw is what p sees of the room right now, or nothing for a solo game
+// that hasn't asked its first question yet. r.mu must be held.
+func (r *trivia_room) draw(sess *session, p *trivia_player) string {
+	if r.current < 0 && r.starts.IsZero() {
+		return ""
+	}
+
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case r.current < 0:
+		add("\033[1mTrivia room\033[0m: %d questions on %s.", len(r.questions), r.filter)
+		add("")
+		add("Starting in about %ds. Players: %s.", max(0, int(time.Until(r.starts).Round(time.Second).Seconds())), strings.Join(r.names(), ", "))
+		add("Press q to leave.")
+
+	case r.over:
+		add("\033[1mTrivia\033[0m: round over.")
+		add("")
+		for i, points := range p.points {
+			mark := "✓"
+			if points == 0 {
+				mark = "✗"
+			}
+			add("%s %4d  %s", mark, points, truncate_text(r.questions[i].Question, 60))
+		}
+		add("")
+		add("%d of %d right, %d points.", right_count(p.points), len(p.points), p.score)
+
+	default:
+		q := r.questions[r.current]
+		about := strings.TrimSpace(q.Category + " " + q.Difficulty)
+		if about != "" {
+			about = " (" + about + ")"
+		}
+		add("\033[1mTrivia\033[0m   question %d of %d%s   score: %d", r.current+1, len(r.questions), about, p.score)
+		add("")
+		lines = append(lines, strings.Split(wrap_text(q.Question, 72), "\n")...)
+		add("")
+		for i, choice := range q.Choices {
+			add("%s", trivia_choice(sess, r, p, i, choice))
+		}
+		add("")
+		add("%s", r.status(p))
+	}
+
+	if len(r.players) > 1 && r.current >= 0 {
+		add("")
+		lines = append(lines, r.scoreboard()...)
+	}
+
+	return cursorHome + strings.Join(lines, clearLine+"\n") + clearLine + "\n" + clearBelow
+}
+
+// trivia_choice draws one lettered answer. Once the answer is shown the
+// right one is green and a wrong pick red; in bw they are marked instead.
+func trivia_choice(sess *session, r *trivia_room, p *trivia_player, i int, choice string) string {
+	line := fmt.Sprintf("  %c) %s", 'A'+i, choice)
+	right := i == r.questions[r.current].Answer
+	picked := i == p.choice
+
+	switch {
+	case !r.revealing && picked:
+		return "\033[1m" + line + " <" + resetAttrs
+	case !r.revealing || !right && !picked:
+		return line
+	case sess.mode == "bw" && right:
+		return line + " ✓"
+	case sess.mode == "bw":
+		return line + " ✗"
+	case right:
+		return fg(80, 220, 80) + "\033[1m" + line + " ✓" + resetAttrs
+	default:
+		return fg(255, 70, 50) + line + " ✗" + resetAttrs
+	}
+}
+
+// status is the line under the answers. r.mu must be held.
+func (r *trivia_room) status(p *trivia_player) string {
+	if r.revealing {
+		i := len(p.points) - 1
+		switch {
+		case i < 0:
+			return ""
+		case p.points[i] > 0:
+			return fmt.Sprintf("Right! +%d", p.points[i])
+		case p.choices[i] < 0:
+			return "Out of time."
+		default:
+			return "Wrong."
+		}
+	}
+
+	if p.choice >= 0 {
+		waiting := 0
+		for _, other := range r.players {
+			if !other.left && other.choice < 0 {
+				waiting++
+			}
+		}
+		switch waiting {
+		case 0:
+			return fmt.Sprintf("Answered %c.", 'A'+p.choice)
+		case 1:
+			return fmt.Sprintf("Answered %c. Waiting for 1 more player...", 'A'+p.choice)
+		}
+		return fmt.Sprintf("Answered %c. Waiting for %d more players...", 'A'+p.choice, waiting)
+	}
+
+	left := max(0, int(time.Until(r.asked.Add(trivia_time)).Round(time.Second).Seconds()))
+	return fmt.Sprintf("%ds left. Press a letter to answer, q to quit.", left)
+}
+
+// scoreboard lists everyone, highest score first. r.mu must be held.
+func (r *trivia_room) scoreboard() []string {
+	players := append([]*trivia_player(nil), r.players...)
+	sort.SliceStable(players, func(i, j int) bool { return players[i].score > players[j].score })
+
+	lines := []string{"\033[1mScores\033[0m"}
+	for _, p := range players {
+		note := ""
+		switch {
+		case p.left:
+			note = "left"
+		case !r.revealing && !r.over && p.choice >= 0:
+			note = "answered"
+		}
+		lines = append(lines, fmt.Sprintf("  %-16s %6d  %s", p.name, p.score, note))
+	}
+	return lines
+}
+
+// names lists the players. r.mu must be held.
+func (r *trivia_room) names() []string {
+	var names []string
+	for _, p := range r.players {
+		if !p.left {
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+func right_count(points []int) int {
+	n := 0
+	for _, p := range points {
+		if p > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// truncate_text cuts s to at most n runes, with an ellipsis if it was
+// longer.
+func truncate_text(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
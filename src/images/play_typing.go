@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/atalii/image-server-thing/internal/typing"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const typing_countdown = 15 * time.Second
+
+// A typing_race gives everyone who joins before it starts the same
+// passage. changed is closed and replaced whenever a racer finishes or
+// leaves, so anyone watching the board knows to redraw it.
+type typing_race struct {
+	passage string
+	starts  time.Time
+	start   chan struct{}
+
+	mu      sync.Mutex
+	racers  []*typing_racer
+	changed chan struct{}
+}
+
+type typing_racer struct {
+	name   string
+	result *typing.Result
+	left   bool
+}
+
+// The lobby holds the race that is counting down, if any.
+var typing_lobby struct {
+	sync.Mutex
+	open *typing_race
+}
+
+// play_typing handles "play typing [race] [short|medium|long]".
+func play_typing(sess *session, args []string) (string, error) {
+	usage := "Usage: play typing [race] [short|medium|long]\n"
+
+	race := len(args) > 0 && args[0] == "race"
+	if race {
+		args = args[1:]
+	}
+
+	length := "medium"
+	if len(args) == 1 {
+		length = args[0]
+	}
+	if _, ok := typing.Lengths[length]; !ok || len(args) > 1 {
+		return usage, nil
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if race {
+		return typing_race_play(sess, typing.Passage(length, rng))
+	}
+
+	for {
+		res, err := typing_round(sess, "Typing test", typing.Passage(length, rng))
+		if err != nil {
+			return "", err
+		}
+
+		sess.send(typing_report(sess, res) + "\nEnter for another passage, q to quit.\n> ")
+		line, _, err := type_line(sess, time.Now())
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "q" {
+			return "Typing: done.\n", nil
+		}
+	}
+}
+
+// typing_round shows the passage and times the player typing it back.
+func typing_round(sess *session, title, passage string) (typing.Result, error) {
+	sess.send(clearScreen + "\033[1m" + title + "\033[0m\n\n" + wrap_text(passage, 72) +
+		"\n\nType the passage and press enter. The clock starts with your first key.\n\n> ")
+
+	typed, start, err := type_line(sess, time.Now())
+	if err != nil {
+		return typing.Result{}, err
+	}
+
+	return typing.Score(passage, typed, time.Since(start)), nil
+}
+
+// type_line reads a line a key at a time, echoing it when the client has
+// handed echo over to us. It also returns when the first key arrived. A
+// client in line mode sends the whole line at once on enter, so for those
+// the clock falls back to when the prompt was shown.
+func type_line(sess *session, shown time.Time) (string, time.Time, error) {
+	echo := sess.input.telnet.Load()
+
+	var typed []rune
+	var start time.Time
+	for {
+		r, _, err := sess.reader.ReadRune()
+		if err != nil {
+			return "", start, err
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+			if sess.reader.Buffered() > 0 {
+				start = shown
+			}
+		}
+
+		switch {
+		case r == '\r' || r == '\n':
+			// Swallow the newline of a CRLF so it doesn't turn up as an
+			// empty line later.
+			if r == '\r' && sess.reader.Buffered() > 0 {
+				if b, _ := sess.reader.Peek(1); b[0] == '\n' {
+					sess.reader.ReadByte()
+				}
+			}
+			if echo {
+				sess.send("\r\n")
+			}
+			return string(typed), start, nil
+		case r == 0x7f || r == '\b':
+			if len(typed) > 0 {
+				typed = typed[:len(typed)-1]
+				if echo {
+					sess.send("\b \b")
+				}
+			}
+		case unicode.IsPrint(r):
+			typed = append(typed, r)
+			if echo {
+				sess.send(string(r))
+			}
+		}
+	}
+}
+
+// typing_replay shows what was typed with the mistakes picked out: wrong
+// or extra characters in red, and skipped ones on a red background. In bw
+// mode they are bracketed instead.
+func typing_replay(sess *session, res typing.Result) string {
+	var b strings.Builder
+
+	for _, s := range res.Steps {
+		switch {
+		case s.Op == typing.Match:
+			b.WriteRune(s.Got)
+		case sess.mode == "bw" && s.Op == typing.Delete:
+			b.WriteString("<" + string(s.Want) + ">")
+		case sess.mode == "bw":
+			b.WriteString("[" + string(s.Got) + "]")
+		case s.Op == typing.Delete:
+			b.WriteString(bg(170, 30, 30) + string(s.Want) + resetAttrs)
+		default:
+			b.WriteString(fg(255, 70, 50) + "\033[1m" + string(s.Got) + resetAttrs)
+		}
+	}
+
+	return b.String()
+}
+
+func typing_report(sess *session, res typing.Result) string {
+	var b strings.Builder
+
+	b.WriteString("\n" + typing_replay(sess, res) + "\n\n")
+
+	// Speeds are kept to a tenth, as shown.
+	wpm := math.Round(res.WPM()*10) / 10
+	fmt.Fprintf(&b, "%.1f WPM, %.0f%% accuracy, %d mistakes in %s.%s\n",
+		wpm, res.Accuracy(), res.Errors, res.Elapsed.Round(100*time.Millisecond),
+		sess.record_score("typing", wpm))
+
+	return b.String()
+}
+
+// typing_race_play joins the race that is counting down, or starts one,
+// then runs the player through it and shows the board until everyone is
+// done or they leave.
+func typing_race_play(sess *session, passage string) (string, error) {
+	typing_lobby.Lock()
+	r := typing_lobby.open
+	if r == nil {
+		r = &typing_race{
+			passage: passage,
+			starts:  time.Now().Add(typing_countdown),
+			start:   make(chan struct{}),
+			changed: make(chan struct{}),
+		}
+		typing_lobby.open = r
+		time.AfterFunc(typing_countdown, func() {
+			typing_lobby.Lock()
+			if typing_lobby.open == r {
+				typing_lobby.open = nil
+			}
+			typing_lobby.Unlock()
+			close(r.start)
+		})
+	}
+
+	r.mu.Lock()
+	me := &typing_racer{name: sess.nick}
+	if me.name == "" {
+		me.name = fmt.Sprintf("guest%d", len(r.racers)+1)
+	}
+	r.racers = append(r.racers, me)
+	r.mu.Unlock()
+	typing_lobby.Unlock()
+
+	// Nobody is notified when someone joins, so the countdown is redrawn
+	// every second to keep the list of racers fresh.
+	ticker := time.NewTicker(time.Second)
+	for waiting := true; waiting; {
+		sess.send(clearScreen + fmt.Sprintf("Typing race starting in about %ds. Racers: %s.\n",
+			max(0, int(time.Until(r.starts).Round(time.Second).Seconds())), strings.Join(r.names(), ", ")))
+		select {
+		case <-r.start:
+			waiting = false
+		case <-ticker.C:
+		}
+	}
+	ticker.Stop()
+
+	res, err := typing_round(sess, "Typing race", r.passage)
+	if err != nil {
+		r.finish(me, nil)
+		return "", err
+	}
+	r.finish(me, &res)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	report := typing_report(sess, res)
+	for {
+		r.mu.Lock()
+		changed, board, done := r.changed, r.board(), r.done()
+		r.mu.Unlock()
+
+		sess.send(clearScreen + report + "\n" + board)
+		if done {
+			return "Typing race: finished.\n", nil
+		}
+		sess.send("\nWaiting for the others. Press q to leave.\n")
+
+		select {
+		case <-changed:
+		case k, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			if k == 'q' {
+				return "Typing race: left before the end.\n", nil
+			}
+		}
+	}
+}
+
+func (r *typing_race) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for _, racer := range r.racers {
+		names = append(names, racer.name)
+	}
+	return names
+}
+
+// finish records a racer's result, or nil if they dropped out.
+func (r *typing_race) finish(racer *typing_racer, res *typing.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	racer.result = res
+	racer.left = res == nil
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *typing_race) done() bool {
+	for _, racer := range r.racers {
+		if racer.result == nil && !racer.left {
+			return false
+		}
+	}
+	return true
+}
+
+// board lists the finishers fastest first, then everyone else.
+func (r *typing_race) board() string {
+	racers := append([]*typing_racer(nil), r.racers...)
+	sort.SliceStable(racers, func(i, j int) bool {
+		a, b := racers[i].result, racers[j].result
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.WPM() > b.WPM()
+	})
+
+	var b strings.Builder
+	b.WriteString("\033[1mRace results\033[0m\n")
+	for i, racer := range racers {
+		switch {
+		case racer.result != nil:
+			fmt.Fprintf(&b, "%2d. %s %5.1f WPM  %3.0f%%\n", i+1, usertext.Pad(racer.name, 16), racer.result.WPM(), racer.result.Accuracy())
+		case racer.left:
+			fmt.Fprintf(&b, "    %s left\n", usertext.Pad(racer.name, 16))
+		default:
+			fmt.Fprintf(&b, "    %s typing...\n", usertext.Pad(racer.name, 16))
+		}
+	}
+	return b.String()
+}
+
+// wrap_text breaks text into lines of at most width runes at spaces.
+func wrap_text(text string, width int) string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
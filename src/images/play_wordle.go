@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/usertext"
+	"github.com/atalii/image-server-thing/internal/wordle"
+)
+
+var wordle_colors = map[wordle.Mark]string{
+	wordle.Absent:  bg(120, 124, 126),
+	wordle.Present: bg(201, 180, 88),
+	wordle.Correct: bg(106, 170, 100),
+}
+
+// Without color the marks are spelled out around the letter.
+var wordle_markers = map[wordle.Mark][2]string{
+	wordle.Absent:  {" ", " "},
+	wordle.Present: {"(", ")"},
+	wordle.Correct: {"[", "]"},
+}
+
+var wordle_keyboard = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// wordle_board holds the daily results: guesses taken per nickname, keyed
+// by date. Only a player's first finished game of the day counts.
+var wordle_board struct {
+	sync.Mutex
+	days map[string]map[string]int
+}
+
+type wordle_game struct {
+	sess   *session
+	answer string
+	daily  string // the date being played, or "" for practice
+	title  string // shown beside the name
+
+	guesses []string
+	marks   [][wordle.Length]wordle.Mark
+	known   map[rune]wordle.Mark
+}
+
+// play_wordle handles "play wordle [daily|board]".
+func play_wordle(sess *session, args []string) (string, error) {
+	g := &wordle_game{sess: sess, title: "practice", known: map[rune]wordle.Mark{}}
+
+	now := time.Now()
+	switch {
+	case len(args) == 0:
+		g.answer = wordle.Random(rand.New(rand.NewSource(now.UnixNano())))
+	case len(args) == 1 && args[0] == "daily":
+		g.answer = wordle.Daily(now)
+		g.daily = now.UTC().Format("2006-01-02")
+		g.title = "daily " + g.daily
+	case len(args) == 1 && args[0] == "board":
+		return wordle_leaderboard(now.UTC().Format("2006-01-02")), nil
+	default:
+		return "Usage: play wordle [daily|board]\n", nil
+	}
+
+	status := "Guess a five-letter word, or q to quit."
+	if g.daily != "" && sess.nick == "" {
+		status += " Set a 'nick' first to make the leaderboard."
+	}
+
+	quit, err := g.run(status)
+	if err != nil {
+		return "", err
+	}
+	if quit {
+		return fmt.Sprintf("Wordle: the word was %s.\n", strings.ToUpper(g.answer)), nil
+	}
+	return g.result(g.solved()), nil
+}
+
+// run takes guesses until the word is found or they run out, unless the
+// player quits first. Spectators see only the colors of each guess: the
+// letters would give the word away, and the daily word is everyone's.
+func (g *wordle_game) run(status string) (quit bool, err error) {
+	live := g.sess.live.Load()
+	if live != nil {
+		live.private.Store(true)
+	}
+	show := func(status string) {
+		g.sess.send(g.draw(status))
+		if live != nil {
+			live.show(g.public())
+		}
+	}
+
+	for len(g.guesses) < wordle.Guesses {
+		show(status)
+
+		line, err := g.sess.readLine()
+		if err != nil {
+			return false, err
+		}
+
+		guess := strings.ToLower(line)
+		switch {
+		case guess == "q":
+			return true, nil
+		case len(guess) != wordle.Length:
+			status = "Guesses are five letters."
+			continue
+		case !wordle.Valid(guess):
+			status = fmt.Sprintf("%s: not in word list.", strings.ToUpper(guess))
+			continue
+		}
+
+		g.guess(guess)
+		status = ""
+		if g.solved() {
+			break
+		}
+	}
+
+	show("")
+	return false, nil
+}
+
+func (g *wordle_game) solved() bool {
+	return len(g.marks) > 0 && wordle.Solved(g.marks[len(g.marks)-1])
+}
+
+func (g *wordle_game) guess(word string) {
+	marks := wordle.Score(g.answer, word)
+	g.guesses = append(g.guesses, word)
+	g.marks = append(g.marks, marks)
+
+	for i, c := range word {
+		if m, ok := g.known[c]; !ok || marks[i] > m {
+			g.known[c] = marks[i]
+		}
+	}
+}
+
+func (g *wordle_game) result(solved bool) string {
+	var b strings.Builder
+
+	title := "Wordle"
+	if g.daily != "" {
+		title += " " + g.daily
+	}
+
+	score := "X"
+	if solved {
+		score = fmt.Sprint(len(g.guesses))
+	}
+	fmt.Fprintf(&b, "%s %s/%d\n\n", title, score, wordle.Guesses)
+	b.WriteString(wordle.Share(g.marks))
+
+	if !solved {
+		fmt.Fprintf(&b, "\nThe word was %s.\n", strings.ToUpper(g.answer))
+	} else if note := g.sess.record_score("wordle", float64(len(g.guesses))); note != "" {
+		b.WriteString("\n" + strings.TrimSpace(note) + "\n")
+	}
+
+	if g.daily != "" && g.sess.nick != "" {
+		if !wordle_record(g.daily, g.sess.nick, len(g.guesses), solved) {
+			b.WriteString("\nOnly your first game today counts for the leaderboard.\n")
+		}
+		b.WriteString("\n" + wordle_leaderboard(g.daily))
+	}
+
+	return b.String()
+}
+
+func (g *wordle_game) tile(c rune, m wordle.Mark) string {
+	letter := strings.ToUpper(string(c))
+	if g.sess.mode == "bw" {
+		return wordle_markers[m][0] + letter + wordle_markers[m][1]
+	}
+	return wordle_colors[m] + fg(255, 255, 255) + "\033[1m " + letter + " " + resetAttrs
+}
+
+// grid draws the guesses so far, without their letters if hide is set.
+func (g *wordle_game) grid(b *strings.Builder, hide bool) {
+	b.WriteString(cursorHome)
+	fmt.Fprintf(b, "\033[1mWordle\033[0m   %s%s\n\n", g.title, clearLine)
+
+	for row := range wordle.Guesses {
+		b.WriteString("  ")
+		for i := range wordle.Length {
+			switch {
+			case row >= len(g.guesses):
+				b.WriteString(" _ ")
+			case hide:
+				b.WriteString(g.tile('·', g.marks[row][i]))
+			default:
+				b.WriteString(g.tile(rune(g.guesses[row][i]), g.marks[row][i]))
+			}
+			b.WriteString(" ")
+		}
+		b.WriteString(clearLine + "\n\n")
+	}
+}
+
+// public is the board as spectators see it: no letters and no keyboard.
+func (g *wordle_game) public() string {
+	var b strings.Builder
+	g.grid(&b, true)
+	b.WriteString(clearBelow)
+	return b.String()
+}
+
+func (g *wordle_game) draw(status string) string {
+	var b strings.Builder
+	g.grid(&b, false)
+
+	for i, keys := range wordle_keyboard {
+		b.WriteString(strings.Repeat("  ", i))
+		for _, c := range keys {
+			if m, ok := g.known[c]; ok && m == wordle.Absent && g.sess.mode == "bw" {
+				// Gray keys would look untried, so they're blanked.
+				b.WriteString(" - ")
+			} else if ok {
+				b.WriteString(g.tile(c, m))
+			} else {
+				b.WriteString(" " + strings.ToUpper(string(c)) + " ")
+			}
+			b.WriteString(" ")
+		}
+		b.WriteString(clearLine + "\n")
+	}
+
+	b.WriteString("\n" + status + clearLine + "\n> " + clearBelow)
+	return b.String()
+}
+
+// wordle_record notes a finished daily game and reports whether it was
+// the player's first that day. Failed games are kept as one more than the
+// number of guesses allowed so they sort last.
+func wordle_record(day, nick string, guesses int, solved bool) bool {
+	wordle_board.Lock()
+	defer wordle_board.Unlock()
+
+	if wordle_board.days == nil {
+		wordle_board.days = map[string]map[string]int{}
+	}
+	// Old days are never looked at again.
+	for d := range wordle_board.days {
+		if d != day {
+			delete(wordle_board.days, d)
+		}
+	}
+
+	results := wordle_board.days[day]
+	if results == nil {
+		results = map[string]int{}
+		wordle_board.days[day] = results
+	}
+	if _, ok := results[nick]; ok {
+		return false
+	}
+
+	if !solved {
+		guesses = wordle.Guesses + 1
+	}
+	results[nick] = guesses
+	return true
+}
+
+func wordle_leaderboard(day string) string {
+	wordle_board.Lock()
+	defer wordle_board.Unlock()
+
+	results := wordle_board.days[day]
+	if len(results) == 0 {
+		return fmt.Sprintf("Nobody has finished the %s puzzle yet.\n", day)
+	}
+
+	var nicks []string
+	for nick := range results {
+		nicks = append(nicks, nick)
+	}
+	sort.Slice(nicks, func(i, j int) bool {
+		if results[nicks[i]] != results[nicks[j]] {
+			return results[nicks[i]] < results[nicks[j]]
+		}
+		return nicks[i] < nicks[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Leaderboard for %s:\n", day)
+	for _, nick := range nicks {
+		score := "X"
+		if n := results[nick]; n <= wordle.Guesses {
+			score = fmt.Sprint(n)
+		}
+		fmt.Fprintf(&b, "  %s %s/%d\n", usertext.Pad(nick, 16), score, wordle.Guesses)
+	}
+	return b.String()
+}
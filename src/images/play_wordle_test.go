@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/atalii/image-server-thing/internal/wordle"
+)
+
+func TestWordleSpectatorsSeeNoLetters(t *testing.T) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	sess := new_session(server)
+	stop := go_live(sess, "daily wordle")
+	defer stop()
+	w := sess.live.Load().subscribe()
+
+	seen := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(client)
+		seen <- string(b)
+	}()
+	go io.WriteString(client, "slate\ncrane\n")
+
+	g := &wordle_game{sess: sess, answer: "crane", daily: "2026-10-15", title: "daily challenge", known: map[rune]wordle.Mark{}}
+	if _, err := g.run(""); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	stop()
+
+	frames := 0
+	for frame := range w.frames {
+		frames++
+		for _, c := range "SLATECRN" {
+			if strings.Contains(frame, "\033[1m "+string(c)+" ") {
+				t.Errorf("spectator saw %c: %q", c, frame)
+			}
+		}
+	}
+	if frames == 0 {
+		t.Error("spectator saw nothing")
+	}
+	if player := <-seen; !strings.Contains(player, "\033[1m C ") {
+		t.Errorf("player didn't see their guess: %q", player)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+	"github.com/atalii/image-server-thing/internal/policy"
+)
+
+var policyFile = flag.String("fetch-policy", "", "file of rules for which hosts images may be fetched from and which content types are taken from them; re-read on SIGHUP or with 'policy reload'")
+
+// fetch_policy is nil, which allows everything, unless there's a policy
+// file.
+var fetch_policy atomic.Pointer[policy.Policy]
+
+// open_policy loads the policy and has every request the server makes
+// checked against it.
+func open_policy() {
+	if *policyFile != "" {
+		p, err := policy.Load(*policyFile)
+		if err != nil {
+			log.Fatalf("policy: %v", err)
+		}
+		fetch_policy.Store(p)
+	}
+	http.DefaultClient.Transport = policy_transport{http.DefaultTransport}
+}
+
+// reload_policy re-reads the policy whenever the process gets SIGHUP. A
+// policy that doesn't load leaves the old one in force.
+func reload_policy() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		load_policy()
+	}
+}
+
+func load_policy() error {
+	p, err := policy.Load(*policyFile)
+	if err != nil {
+		log.Printf("policy: keeping the old one: %v", err)
+		return err
+	}
+	fetch_policy.Store(p)
+	log.Printf("policy: reloaded %s", *policyFile)
+	return nil
+}
+
+// A policy_error is a request the policy refused, for its host or, if
+// kind is set, for the type of what came back.
+type policy_error struct {
+	host string
+	kind string
+}
+
+func (e *policy_error) Error() string {
+	if e.kind != "" {
+		return fmt.Sprintf("responses of type %s are not permitted on this server", e.kind)
+	}
+	return "fetching from that host is not permitted on this server"
+}
+
+// sentence is the error as a line to send.
+func (e *policy_error) sentence() string {
+	msg := e.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:] + ".\n"
+}
+
+// policy_transport checks every request against the policy before it's
+// sent, and what comes back before it's read. A redirect is a request
+// of its own, so it's the host at the end of any redirects that counts,
+// and no request at all goes to a refused host on the way.
+type policy_transport struct {
+	base http.RoundTripper
+}
+
+type fetcher_key struct{}
+
+// fetching_for is a context for requests made on behalf of sess, which
+// may be nil, so that refusals can say who asked. It's done when sess's
+// connection is, and decodes images as sess's decode-format and
+// decode-timeout say.
+func fetching_for(sess *session) context.Context {
+	ctx := context.Background()
+	if sess != nil {
+		ctx = fetch.WithFormat(sess.ctx, sess.decode_format)
+		ctx = fetch.WithDecodeTimeout(ctx, time.Duration(sess.decode_timeout)*time.Second)
+	}
+	return context.WithValue(ctx, fetcher_key{}, sess)
+}
+
+func (t policy_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := fetch_policy.Load()
+	if !p.Host(req.URL) {
+		log.Printf("audit: policy refused %s fetching from %s", fetcher(req), req.URL.Host)
+		return nil, &policy_error{host: req.URL.Host}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redirects and errors aren't images whatever they are.
+	kind := resp.Header.Get("Content-Type")
+	if resp.StatusCode/100 == 2 && !p.Type(kind) {
+		resp.Body.Close()
+		if kind == "" {
+			kind = "untyped"
+		}
+		log.Printf("audit: policy refused %s a response of type %s from %s", fetcher(req), kind, req.URL.Host)
+		return nil, &policy_error{host: req.URL.Host, kind: kind}
+	}
+	return resp, nil
+}
+
+func fetcher(req *http.Request) string {
+	if sess, _ := req.Context().Value(fetcher_key{}).(*session); sess != nil {
+		return admin_name(sess)
+	}
+	return "the server"
+}
+
+// http_get is http.Get on behalf of sess. A refusal by the policy comes
+// back as the policy_error itself, rather than wrapped up with the URL.
+func http_get(sess *session, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(fetching_for(sess), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	return resp, policy_unwrap(err)
+}
+
+func policy_unwrap(err error) error {
+	var refused *policy_error
+	if errors.As(err, &refused) {
+		return refused
+	}
+	return err
+}
+
+// policy_command handles "policy", which sums up the fetch policy, and
+// "policy reload", which reads it again.
+func policy_command(sess *session, line string) string {
+	if *policyFile == "" {
+		return "There's no fetch policy on this server: every host and type is allowed.\n"
+	}
+
+	switch strings.TrimSpace(strings.TrimPrefix(line, "policy")) {
+	case "":
+	case "reload":
+		if err := load_policy(); err != nil {
+			return fmt.Sprintf("The policy didn't load, so the old one stays: %v.\n", err)
+		}
+		log.Printf("audit: %s reloaded the fetch policy", admin_name(sess))
+	default:
+		return "Usage: policy [reload]\n"
+	}
+
+	hosts, types := fetch_policy.Load().Rules()
+	return fmt.Sprintf("Fetch policy %s: %s and %s.\n", *policyFile, plural(hosts, "host rule"), plural(types, "type rule"))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+var (
+	noPrefetch  = flag.Bool("no-prefetch", false, "don't fetch images mentioned in slideshows ahead of anyone rendering them")
+	logPrefetch = flag.Bool("log-prefetch", false, "log each prefetch, and why it failed when it does")
+)
+
+const (
+	prefetch_workers = 2
+	prefetch_queue   = 32
+
+	// One image at a time per host, a second apart at the closest.
+	prefetch_host_gap = time.Second
+
+	// A prefetched image is kept until it's used, for a few minutes at
+	// most, and what's kept is held to a few screenfuls of big images.
+	prefetch_keep   = 5 * time.Minute
+	prefetch_pixels = 64_000_000
+)
+
+// prefetch_extensions are what a URL mentioned in chat has to end in to
+// be taken for an image, rather than a page someone's talking about.
+var prefetch_extensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true,
+}
+
+// prefetched is an image fetched before anyone asked for it.
+type prefetched struct {
+	img  image.Image
+	meta fetch.Metadata
+	at   time.Time
+}
+
+// prefetch is the queue of URLs to fetch ahead and the images fetched.
+// A worker takes the oldest URL whose host is free: not being fetched
+// from, and not fetched from within prefetch_host_gap. A full queue
+// drops its oldest URL for a new one.
+var prefetch = struct {
+	mu     sync.Mutex
+	queue  []string
+	hosts  map[string]time.Time
+	images map[string]prefetched
+	pixels int
+	wake   chan struct{}
+	start  sync.Once
+}{
+	hosts:  map[string]time.Time{},
+	images: map[string]prefetched{},
+	wake:   make(chan struct{}, 1),
+}
+
+// prefetch_stats count what the prefetcher did, to tell whether it
+// earns its keep: used against fetched is its hit rate.
+var prefetch_stats struct {
+	queued, dropped, fetched, failed, used, wasted atomic.Int64
+}
+
+// prefetch_url queues ref to be fetched ahead, unless it's queued or
+// fetched already. It reports whether ref is something it can fetch.
+func prefetch_url(ref string) bool {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return false
+	}
+	if *noPrefetch {
+		return true
+	}
+	prefetch.start.Do(func() {
+		for range prefetch_workers {
+			go prefetch_worker()
+		}
+	})
+
+	prefetch.mu.Lock()
+	defer prefetch.mu.Unlock()
+	if _, ok := prefetch.images[ref]; ok {
+		return true
+	}
+	for _, queued := range prefetch.queue {
+		if queued == ref {
+			return true
+		}
+	}
+	if len(prefetch.queue) == prefetch_queue {
+		prefetch.queue = prefetch.queue[1:]
+		prefetch_stats.dropped.Add(1)
+	}
+	prefetch.queue = append(prefetch.queue, ref)
+	prefetch_stats.queued.Add(1)
+
+	select {
+	case prefetch.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// prefetch_mentions queues whatever in text looks like an image URL.
+func prefetch_mentions(text string) {
+	for _, word := range strings.Fields(text) {
+		u, err := url.Parse(word)
+		if err == nil && prefetch_extensions[strings.ToLower(path.Ext(u.Path))] {
+			prefetch_url(word)
+		}
+	}
+}
+
+func prefetch_host(ref string) string {
+	u, _ := url.Parse(ref)
+	return strings.ToLower(u.Host)
+}
+
+// prefetch_next takes the next URL off the queue whose host is free,
+// marking the host busy, or says how long until one might be.
+func prefetch_next() (string, time.Duration) {
+	prefetch.mu.Lock()
+	defer prefetch.mu.Unlock()
+
+	now := time.Now()
+	for host, free := range prefetch.hosts {
+		if !free.After(now) {
+			delete(prefetch.hosts, host)
+		}
+	}
+
+	wait := time.Duration(0)
+	for i, ref := range prefetch.queue {
+		free, busy := prefetch.hosts[prefetch_host(ref)]
+		if !busy {
+			prefetch.queue = append(prefetch.queue[:i], prefetch.queue[i+1:]...)
+			// The host is busy until the fetch is over and the gap after
+			// it is set.
+			prefetch.hosts[prefetch_host(ref)] = now.Add(24 * time.Hour)
+			return ref, 0
+		}
+		if d := free.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	return "", wait
+}
+
+func prefetch_worker() {
+	for {
+		ref, wait := prefetch_next()
+		if ref == "" {
+			var timeout <-chan time.Time
+			if wait > 0 {
+				timeout = time.After(wait)
+			}
+			select {
+			case <-prefetch.wake:
+			case <-timeout:
+			}
+			continue
+		}
+
+		// Nobody's waiting on it, so it goes as the server, within the
+		// server's own limits.
+		ctx := fetch.WithMaxPixels(fetching_for(nil), *maxPixels)
+		img, meta, err := fetch.Default.Fetch(ctx, ref)
+
+		prefetch.mu.Lock()
+		prefetch.hosts[prefetch_host(ref)] = time.Now().Add(prefetch_host_gap)
+		if err == nil {
+			prefetch_keep_image(ref, prefetched{normalizeImage(img), meta, time.Now()})
+		}
+		prefetch.mu.Unlock()
+
+		if err != nil {
+			prefetch_stats.failed.Add(1)
+			if *logPrefetch {
+				log.Printf("prefetch: %s: %v", ref, err)
+			}
+			continue
+		}
+		prefetch_stats.fetched.Add(1)
+		if *logPrefetch {
+			log.Printf("prefetch: %s: %d×%d", ref, meta.Width, meta.Height)
+		}
+	}
+}
+
+// prefetch_keep_image adds p to what's kept, making room by dropping
+// whatever's been kept longest. prefetch.mu must be held.
+func prefetch_keep_image(ref string, p prefetched) {
+	size := p.img.Bounds().Dx() * p.img.Bounds().Dy()
+	if size > prefetch_pixels {
+		prefetch_stats.wasted.Add(1)
+		return
+	}
+	for prefetch.pixels+size > prefetch_pixels || prefetch_expire() {
+		oldest := ""
+		for ref, kept := range prefetch.images {
+			if oldest == "" || kept.at.Before(prefetch.images[oldest].at) {
+				oldest = ref
+			}
+		}
+		prefetch_drop(oldest)
+		prefetch_stats.wasted.Add(1)
+	}
+	prefetch.images[ref] = p
+	prefetch.pixels += size
+}
+
+// prefetch_expire reports whether the longest kept image is past
+// keeping. prefetch.mu must be held.
+func prefetch_expire() bool {
+	for _, kept := range prefetch.images {
+		if time.Since(kept.at) > prefetch_keep {
+			return true
+		}
+	}
+	return false
+}
+
+func prefetch_drop(ref string) {
+	b := prefetch.images[ref].img.Bounds()
+	prefetch.pixels -= b.Dx() * b.Dy()
+	delete(prefetch.images, ref)
+}
+
+// prefetch_take hands over the image prefetched for ref, if there is
+// one, and forgets it: an image is only ever used once, so a render
+// asked for again gets a fresh copy. It has to pass the same checks a
+// fetch now would: the policy, which may have changed, and max_pixels.
+func prefetch_take(ref string, max_pixels int) (image.Image, bool, error) {
+	prefetch.mu.Lock()
+	p, ok := prefetch.images[ref]
+	if ok {
+		prefetch_drop(ref)
+	}
+	prefetch.mu.Unlock()
+
+	if !ok || time.Since(p.at) > prefetch_keep {
+		if ok {
+			prefetch_stats.wasted.Add(1)
+		}
+		stats.cacheMisses.Add(1)
+		return nil, false, nil
+	}
+
+	u, _ := url.Parse(ref)
+	policy := fetch_policy.Load()
+	if !policy.Host(u) || !policy.Type(p.meta.ContentType) {
+		prefetch_stats.wasted.Add(1)
+		stats.cacheMisses.Add(1)
+		return nil, false, nil
+	}
+
+	prefetch_stats.used.Add(1)
+	stats.cacheHits.Add(1)
+	if b := p.img.Bounds(); fetch.OverLimit(b.Dx(), b.Dy(), max_pixels) {
+		return nil, true, &fetch.TooLargeError{Width: b.Dx(), Height: b.Dy(), Limit: max_pixels}
+	}
+	return p.img, true, nil
+}
+
+func prefetch_report() string {
+	fetched, used := prefetch_stats.fetched.Load(), prefetch_stats.used.Load()
+	rate := "n/a"
+	if fetched > 0 {
+		rate = fmt.Sprintf("%.1f%%", 100*float64(used)/float64(fetched))
+	}
+	return fmt.Sprintf("%d queued, %d dropped, %d fetched, %d failed, %d used (%s), %d wasted",
+		prefetch_stats.queued.Load(), prefetch_stats.dropped.Load(), fetched,
+		prefetch_stats.failed.Load(), used, rate, prefetch_stats.wasted.Load())
+}
+
+// prefetch_command handles "prefetch URL", for an image wanted next.
+func prefetch_command(_ *session, line string) string {
+	ref := strings.TrimSpace(strings.TrimPrefix(line, "prefetch"))
+	if ref == "" || strings.ContainsAny(ref, " \t") {
+		return "Usage: prefetch URL\n"
+	}
+	if *noPrefetch {
+		return "Prefetching is turned off on this server.\n"
+	}
+	if !prefetch_url(ref) {
+		return "Only http and https URLs can be prefetched.\n"
+	}
+	return "Prefetching; render it when you're ready.\n"
+}
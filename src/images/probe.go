@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var noProbe = flag.Bool("no-probe", false, "don't ask new clients' terminals what they can show; everyone starts in color")
+
+// probe_timeout is how long a new connection waits for its terminal to
+// answer. Terminals answer within a few milliseconds, so this is mostly
+// spent on clients that never will.
+const probe_timeout = 300 * time.Millisecond
+
+// probe_step is how often the probe checks for an answer while waiting.
+const probe_step = 25 * time.Millisecond
+
+// Terminal types that can't show color, or anything but plain text.
+var mono_terminals = []string{"dumb", "vt52", "vt100", "vt102", "vt220"}
+
+// probe_terminal asks the client's terminal what it is, and picks the
+// mode it should start in. Telnet clients are asked for their terminal
+// type; any terminal is sent a Device Attributes query, whose reply shows
+// it understands ANSI escapes. A client that says nothing is most likely
+// netcat or a script, and starts in bw. The replies are taken out of the
+// input wherever they turn up, so they never reach a command.
+func probe_terminal(sess *session) {
+	in := sess.input
+	sess.send("\033[c")
+
+	deadline := time.Now().Add(probe_timeout)
+	asked, sent := false, false
+	for time.Now().Before(deadline) {
+		if in.telnet.Load() && !asked {
+			sess.send(string([]byte{tel_iac, tel_do, opt_ttype}))
+			asked = true
+		}
+		if in.ttype_will.Load() && !sent {
+			sess.send(string([]byte{tel_iac, tel_sb, opt_ttype, ttype_send, tel_iac, tel_se}))
+			sent = true
+		}
+
+		answered := in.ttype.Load() != nil || in.ttype_refused.Load() || !asked
+		if in.da.Load() != nil && answered {
+			break
+		}
+
+		// Someone already typing has a terminal that works well enough,
+		// and shouldn't be kept waiting.
+		if sess.reader.Buffered() > 0 {
+			break
+		}
+		sess.conn.SetReadDeadline(min_time(deadline, time.Now().Add(probe_step)))
+		if _, err := sess.reader.Peek(1); !errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+	}
+	sess.conn.SetReadDeadline(time.Time{})
+
+	mode, about := probe_verdict(in.ttype.Load(), in.da.Load())
+	sess.terminal = about
+	if *lockMode == "" {
+		sess.set_mode(mode)
+	}
+}
+
+// probe_verdict picks a mode from what the terminal said. ttype is the
+// telnet terminal type and da the Device Attributes reply, each nil if
+// it didn't come. Device Attributes don't say whether a terminal can do
+// 24-bit color, but those that answer mostly can.
+func probe_verdict(ttype, da *string) (mode, about string) {
+	if ttype != nil {
+		name := strings.ToLower(*ttype)
+		for _, mono := range mono_terminals {
+			if name == mono || strings.HasPrefix(name, mono+"-") {
+				return "bw", fmt.Sprintf("%s, which doesn't do color", name)
+			}
+		}
+		return "color", name
+	}
+	if da != nil {
+		return "color", fmt.Sprintf("an ANSI terminal (it answered %s)", *da)
+	}
+	return "bw", "unknown (it didn't answer; netcat or a script, perhaps)"
+}
+
+func min_time(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// probe_note tells a client in bw what was decided, and how to change it.
+func probe_note(sess *session) string {
+	if sess.terminal == "" || sess.mode != "bw" || *lockMode != "" {
+		return ""
+	}
+	return "Starting in black and white, as your terminal is " + sess.terminal + ". Type 'color' if it can show 24-bit color.\n"
+}
+
+// protocol_test_wait is how long protocol-test waits for each answer.
+const protocol_test_wait = 30 * time.Second
+
+// ask_yes_no asks question until it gets y or n, yes or no, in any case,
+// for as long as protocol_test_wait. ok is false if no answer came.
+func ask_yes_no(sess *session, question string) (yes, ok bool, err error) {
+	sess.send(question + " (y/n) ")
+	deadline := time.Now().Add(protocol_test_wait)
+	for sess.line_within(time.Until(deadline)) {
+		line, err := sess.readLine()
+		if err != nil {
+			return false, false, err
+		}
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			return true, true, nil
+		case "n", "no":
+			return false, true, nil
+		}
+		sess.send("Please answer y or n. ")
+	}
+	sess.send("\n")
+	return false, false, nil
+}
+
+// protocol_test_command handles "protocol-test", which shows the client
+// what renders are made of and asks whether each came out, for terminals
+// the probe can't tell about, and says which mode suits what did.
+func protocol_test_command(sess *session, _ string) (string, error) {
+	probes := []struct {
+		show, question string
+	}{
+		{"Blocks: █▀▄ ░▒▓", "Did you see a block character?"},
+		{"Color: " + fg(230, 60, 60) + "red " + fg(60, 200, 60) + "green " + fg(70, 120, 255) + "blue" + resetAttrs, "Did you see colored text?"},
+		{"Braille: ⣿⡇⢸⠛", "Did you see a Braille character?"},
+	}
+
+	var seen [3]string
+	for i, p := range probes {
+		sess.send(p.show + "\n")
+		yes, ok, err := ask_yes_no(sess, p.question)
+		switch {
+		case err != nil:
+			return "", err
+		case !ok:
+			seen[i] = "no answer"
+		case yes:
+			seen[i] = "yes"
+		default:
+			seen[i] = "no"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Blocks: %s. Color: %s. Braille: %s.\n", seen[0], seen[1], seen[2])
+	switch {
+	case seen[0] != "yes":
+		b.WriteString("Your terminal may not be showing UTF-8: renders are made of block characters, in color or bw. Set it to UTF-8 and try again.\n")
+	case seen[1] == "yes":
+		b.WriteString("Color mode suits your terminal; 'color' switches to it.\n")
+	default:
+		b.WriteString("Black and white suits your terminal; 'bw' switches to it.\n")
+	}
+	if *lockMode != "" {
+		b.WriteString(mode_locked)
+	}
+	return b.String(), nil
+}
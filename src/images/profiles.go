@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+	"github.com/atalii/image-server-thing/internal/profiles"
+)
+
+var profilesFile = flag.String("profiles-file", "", "keep registered nicknames in this JSON file across restarts (in memory only if unset)")
+
+// nicknames holds the registered nicknames; main opens it.
+var nicknames *profiles.Store
+
+func open_profiles() {
+	s, backup, err := profiles.Open(*profilesFile)
+	if err != nil {
+		log.Fatalf("profiles: %v", err)
+	}
+	if backup != "" {
+		log.Printf("profiles: %s was unreadable; moved it to %s and started afresh", *profilesFile, backup)
+	}
+	nicknames = s
+}
+
+const (
+	// Each address gets a few tries at 'login' and 'register' at once,
+	// and one more a minute after that. Registering counts too, as each
+	// one costs the server a password hash.
+	login_burst  = 5
+	login_refill = time.Minute
+)
+
+type login_bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var login_attempts = struct {
+	sync.Mutex
+	by_client map[netip.Addr]login_bucket
+}{by_client: map[netip.Addr]login_bucket{}}
+
+// login_wait takes one of sess's address's tries, or says how long until
+// it has one.
+func login_wait(sess *session) time.Duration {
+	now := time.Now()
+	fill := func(b login_bucket) float64 {
+		return min(b.tokens+float64(now.Sub(b.last))/float64(login_refill), login_burst)
+	}
+
+	login_attempts.Lock()
+	defer login_attempts.Unlock()
+
+	// Addresses that are back to a full set of tries are forgotten.
+	for addr, b := range login_attempts.by_client {
+		if fill(b) == login_burst {
+			delete(login_attempts.by_client, addr)
+		}
+	}
+
+	client := remote_addr(sess.conn)
+	b, ok := login_attempts.by_client[client]
+	tokens := float64(login_burst)
+	if ok {
+		tokens = fill(b)
+	}
+	if tokens < 1 {
+		return time.Duration((1 - tokens) * float64(login_refill))
+	}
+	login_attempts.by_client[client] = login_bucket{tokens - 1, now}
+	return 0
+}
+
+// login_args splits "register NICK PASSWORD" or "login NICK PASSWORD". The
+// password is everything after the nickname, spaces and all.
+func login_args(line, name string) (nick, password string, ok bool) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, name))
+	nick, password, _ = strings.Cut(rest, " ")
+	password = strings.TrimSpace(password)
+	return nick, password, nick != "" && password != ""
+}
+
+// take_nick makes name sess's nickname, as its owner if registered, and
+// says so.
+func take_nick(sess *session, name string, registered bool) string {
+	sess.nick, sess.registered = name, registered
+
+	msg := fmt.Sprintf("You are now %s.", name)
+	if !registered {
+		msg = fmt.Sprintf("You are now %s, as a guest: the nickname is anyone's until it's registered. 'register %s PASSWORD' makes it yours.", name, name)
+	}
+	if game := versus_waiting(name); game != "" {
+		msg += fmt.Sprintf(" Your game of %s is waiting for you: type 'resume' to rejoin it.", game)
+	}
+	return msg + "\n"
+}
+
+// owns_nick reports whether sess may go on using its nickname: it's the
+// registered owner's, or nobody has registered it.
+func (s *session) owns_nick() bool {
+	return s.registered || !nicknames.Registered(s.nick)
+}
+
+// nick_displaced takes a guest's nickname away once its owner registers
+// it, and says so; it's checked before each line the guest sends.
+func nick_displaced(sess *session) string {
+	if sess.nick == "" || sess.owns_nick() {
+		return ""
+	}
+	name := sess.nick
+	sess.nick = ""
+	return fmt.Sprintf("%s has been registered by its owner, so you're no longer %s. Pick another with 'nick NAME'.\n", name, name)
+}
+
+func login_refused(wait time.Duration) string {
+	return fmt.Sprintf("Too many tries from your address; try again in %s.\n", wait.Round(time.Second))
+}
+
+// register_command handles "register NICK PASSWORD".
+func register_command(sess *session, line string) string {
+	nick, password, ok := login_args(line, "register")
+	switch {
+	case !ok:
+		return fmt.Sprintf("Usage: register NICK PASSWORD, with a password of %d-%d bytes.\n", profiles.MinPassword, profiles.MaxPassword)
+	case !leaderboard.ValidNick(nick):
+		return "Nicknames are 1-16 letters, digits, '_' or '-'.\n"
+	case len(password) < profiles.MinPassword || len(password) > profiles.MaxPassword:
+		return fmt.Sprintf("Passwords are %d-%d bytes.\n", profiles.MinPassword, profiles.MaxPassword)
+	}
+	if wait := login_wait(sess); wait > 0 {
+		return login_refused(wait)
+	}
+
+	err := nicknames.Register(nick, password)
+	if errors.Is(err, profiles.ErrTaken) {
+		return fmt.Sprintf("%s is registered already; 'login %s PASSWORD' if it's yours.\n", nick, nick)
+	}
+	if err != nil {
+		log.Printf("profiles: %v", err)
+		return "Couldn't register: the server couldn't save it.\n"
+	}
+
+	log.Printf("profiles: %s registered %s", admin_name(sess), nick)
+	return "Registered. " + take_nick(sess, nick, true) +
+		"Log in with 'login " + nick + " PASSWORD' next time; 'profile save' keeps your settings for then.\n"
+}
+
+// login_command handles "login NICK PASSWORD", which takes back a
+// registered nickname and the settings saved with it.
+func login_command(sess *session, line string) string {
+	nick, password, ok := login_args(line, "login")
+	if !ok {
+		return "Usage: login NICK PASSWORD\n"
+	}
+	if wait := login_wait(sess); wait > 0 {
+		return login_refused(wait)
+	}
+
+	p, err := nicknames.Login(nick, password)
+	switch {
+	case errors.Is(err, profiles.ErrUnknown):
+		return fmt.Sprintf("%s isn't registered; 'register %s PASSWORD' makes it yours.\n", nick, nick)
+	case errors.Is(err, profiles.ErrWrong):
+		log.Printf("profiles: %s gave the wrong password for %s", admin_name(sess), nick)
+		return "Wrong password.\n"
+	case err != nil:
+		// The login still counts; only the count of logins wasn't saved.
+		log.Printf("profiles: %v", err)
+	}
+
+	msg := take_nick(sess, nick, true)
+	if len(p.Settings) > 0 {
+		var s saved_settings
+		if err := json.Unmarshal(p.Settings, &s); err != nil {
+			log.Printf("profiles: %s's settings: %v", nick, err)
+			return msg + "Your saved settings couldn't be read; 'profile save' to save them again.\n"
+		}
+		msg += apply_settings(sess, s)
+	}
+	return msg
+}
+
+// profile_command handles "profile", and "profile save", which keeps the
+// session's settings to be applied at each login.
+func profile_command(sess *session, line string) string {
+	if sess.nick == "" || !sess.registered {
+		return "You're not logged in to a registered nickname: 'register NICK PASSWORD' or 'login NICK PASSWORD' first.\n"
+	}
+
+	switch arg := strings.TrimSpace(strings.TrimPrefix(line, "profile")); arg {
+	case "":
+	case "save":
+		data, err := json.Marshal(session_settings(sess))
+		if err == nil {
+			err = nicknames.SetSettings(sess.nick, data)
+		}
+		if err != nil {
+			log.Printf("profiles: %v", err)
+			return "Couldn't save your settings.\n"
+		}
+		return fmt.Sprintf("Saved: these settings apply whenever you log in as %s.\n", sess.nick)
+	default:
+		return "Usage: profile [save]\n"
+	}
+
+	p, ok := nicknames.Get(sess.nick)
+	if !ok {
+		return "Your profile is gone.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, registered %s; %s.\n", sess.nick, p.Created.UTC().Format("2006-01-02"), plural(p.Logins, "login"))
+	if len(p.Settings) > 0 {
+		b.WriteString("Settings: saved, applied at login.\n")
+	} else {
+		b.WriteString("Settings: none saved; 'profile save' keeps the ones you have now.\n")
+	}
+
+	if len(p.Plays) == 0 {
+		b.WriteString("Games: none finished yet.\n")
+		return b.String()
+	}
+	games := make([]string, 0, len(p.Plays))
+	total := 0
+	for game, n := range p.Plays {
+		games = append(games, game)
+		total += n
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if p.Plays[games[i]] != p.Plays[games[j]] {
+			return p.Plays[games[i]] > p.Plays[games[j]]
+		}
+		return games[i] < games[j]
+	})
+	fmt.Fprintf(&b, "Games: %d finished.\n", total)
+	for _, game := range games {
+		fmt.Fprintf(&b, "  %-16s %d\n", game, p.Plays[game])
+	}
+	return b.String()
+}
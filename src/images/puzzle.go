@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/puzzle"
+)
+
+const (
+	puzzle_size = 4
+
+	// After a digit that could be the start of a longer tile number, how
+	// long to wait for the next one.
+	puzzle_digit_wait = 700 * time.Millisecond
+
+	puzzle_label = "\033[1;97;44m"
+)
+
+var puzzle_keys = map[rune]puzzle.Dir{
+	'w': puzzle.Up,
+	's': puzzle.Down,
+	'a': puzzle.Left,
+	'd': puzzle.Right,
+}
+
+// A puzzle_game cuts a render into tiles. The render is never redrawn, so
+// the tiles stay the same however they're moved around.
+type puzzle_game struct {
+	p      *puzzle.Puzzle
+	cells  [][]string
+	tw, th int
+}
+
+// puzzle_command handles "puzzle URL [3|4|5]".
+func puzzle_command(sess *session, line string) (string, error) {
+	usage := "Usage: puzzle URL [3|4|5]\n"
+
+	args := strings.Fields(strings.TrimPrefix(line, "puzzle"))
+	if len(args) < 1 || len(args) > 2 {
+		return usage, nil
+	}
+	n := puzzle_size
+	if len(args) == 2 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < puzzle.MinSize || n > puzzle.MaxSize {
+			return usage, nil
+		}
+	}
+
+	sess.last_url = args[0]
+	img, err := fetch_image(sess, args[0], sess.max_pixels)
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+	stats.rendered.Add(1)
+
+	// The borders take a column between each pair of tiles and one at
+	// either side.
+	g := &puzzle_game{cells: renderCells(preprocess(img, sess), sess.width-(n+1), 1, sess)}
+	if len(g.cells) > 0 {
+		g.tw, g.th = len(g.cells[0])/n, len(g.cells)/n
+	}
+	if g.tw < 3 || g.th < 2 {
+		return fmt.Sprintf("That image is too small to cut into %dx%d tiles.\n", n, n), nil
+	}
+
+	g.p, _ = puzzle.Scramble(n, rand.New(rand.NewSource(time.Now().UnixNano())))
+	least := g.p.Estimate()
+
+	stop_live := go_live(sess, "puzzle")
+	defer stop_live()
+
+	sess.send(clearScreen)
+	defer sess.send(resetAttrs + showCursor)
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	sess.send(hideCursor)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	help := "w/a/s/d or arrows slide a tile into the gap, or type a tile's number. q quits."
+	status := help
+	start := time.Now()
+
+	// A tile number is built up a key at a time; wait fires when it has
+	// had long enough to be finished.
+	digits := ""
+	var wait <-chan time.Time
+
+	for !g.p.Done() {
+		sess.send(g.draw(status))
+
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+
+			if k >= '0' && k <= '9' {
+				digits += string(k)
+				if t, _ := strconv.Atoi(digits); t > 0 && t*10 < n*n {
+					wait = time.After(puzzle_digit_wait)
+					status = "Tile " + digits + "..."
+					continue
+				}
+				status = g.slide_tile(digits, help)
+				digits, wait = "", nil
+				continue
+			}
+			digits, wait = "", nil
+
+			if k == 'q' {
+				return fmt.Sprintf("Puzzle: gave up after %d moves.\n", g.p.Moves), nil
+			}
+			if d, ok := puzzle_keys[k]; ok {
+				status = help
+				if !g.p.Slide(d) {
+					status = "There's no tile to slide that way."
+				}
+			}
+		case <-wait:
+			status = g.slide_tile(digits, help)
+			digits, wait = "", nil
+		}
+	}
+
+	took := time.Since(start).Round(time.Second)
+	sess.send(clearScreen + g.intact() + fmt.Sprintf("\nSolved in %d moves and %s; this scramble needed at least %d. Press any key.\n",
+		g.p.Moves, took, least))
+	if _, ok := <-keys; !ok {
+		return "", io.EOF
+	}
+
+	return fmt.Sprintf("Puzzle: solved %dx%d in %d moves (at least %d needed) and %s.%s\n",
+		n, n, g.p.Moves, least, took, sess.record_score(fmt.Sprintf("puzzle-%dx%d", n, n), float64(g.p.Moves))), nil
+}
+
+func (g *puzzle_game) slide_tile(digits, help string) string {
+	t, _ := strconv.Atoi(digits)
+	if t < 1 || t >= g.p.N*g.p.N {
+		return fmt.Sprintf("There's no tile %s.", digits)
+	}
+	if !g.p.SlideTile(t) {
+		return fmt.Sprintf("Tile %d isn't next to the gap.", t)
+	}
+	return help
+}
+
+func (g *puzzle_game) draw(status string) string {
+	var b strings.Builder
+	n := g.p.N
+
+	border := func(left, middle, right string) {
+		b.WriteString(left)
+		for c := range n {
+			if c > 0 {
+				b.WriteString(middle)
+			}
+			b.WriteString(strings.Repeat("─", g.tw))
+		}
+		b.WriteString(right + clearLine + "\n")
+	}
+
+	b.WriteString(cursorHome)
+	fmt.Fprintf(&b, "\033[1mPuzzle\033[0m   %dx%d   moves: %d%s\n", n, n, g.p.Moves, clearLine)
+
+	border("┌", "┬", "┐")
+	for r := range n {
+		for y := range g.th {
+			for c := range n {
+				b.WriteString("│" + g.tile_row(g.p.Tiles[r*n+c], y))
+			}
+			b.WriteString("│" + clearLine + "\n")
+		}
+		if r < n-1 {
+			border("├", "┼", "┤")
+		}
+	}
+	border("└", "┴", "┘")
+
+	b.WriteString(status + clearLine + "\n" + clearBelow)
+	return b.String()
+}
+
+// tile_row draws row y of a tile, with its number in the top-left corner
+// so tiles can be told apart on busy images.
+func (g *puzzle_game) tile_row(tile, y int) string {
+	if tile == 0 {
+		return strings.Repeat(" ", g.tw)
+	}
+
+	r, c := (tile-1)/g.p.N, (tile-1)%g.p.N
+	row := g.cells[r*g.th+y][c*g.tw : (c+1)*g.tw]
+
+	if y == 0 {
+		label := strconv.Itoa(tile)
+		return puzzle_label + label + resetAttrs + strings.Join(row[len(label):], "") + resetAttrs
+	}
+	return strings.Join(row, "") + resetAttrs
+}
+
+// intact is the render the tiles were cut from, whole again.
+func (g *puzzle_game) intact() string {
+	var b strings.Builder
+	for _, row := range g.cells[:g.th*g.p.N] {
+		b.WriteString(strings.Join(row[:g.tw*g.p.N], "") + resetAttrs + "\n")
+	}
+	return b.String()
+}
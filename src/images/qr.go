@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Modules are drawn with half-block characters, one column wide and half a
+// row tall, which is roughly square on most terminal fonts. Going bigger
+// than this just makes the code harder to fit on screen.
+const qr_max_scale = 3
+
+// qr_command handles "qr TEXT": it encodes the text itself (nothing is
+// fetched) and draws the code in white and black so it scans the same on
+// dark and light terminals.
+func qr_command(sess *session, text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "Usage: qr TEXT\n"
+	}
+
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return fmt.Sprintf("Can't encode that: %v\n", err)
+	}
+
+	// The bitmap includes the quiet zone scanners need around the code.
+	bitmap := code.Bitmap()
+	size := len(bitmap)
+
+	scale := min(sess.width/size, qr_max_scale)
+	if scale < 1 {
+		return fmt.Sprintf("That needs %d columns to stay scannable; your width is %d.\n", size, sess.width)
+	}
+
+	dark := func(x, y int) bool {
+		if y/scale >= size {
+			return false
+		}
+		return bitmap[y/scale][x/scale]
+	}
+
+	var b strings.Builder
+	for y := 0; y < size*scale; y += 2 {
+		b.WriteString("\033[97;40m")
+		for x := range size * scale {
+			top, bottom := !dark(x, y), !dark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune('█')
+			case top:
+				b.WriteRune('▀')
+			case bottom:
+				b.WriteRune('▄')
+			default:
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteString("\033[0m\n")
+	}
+
+	return b.String()
+}
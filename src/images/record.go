@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var recordingsDir = flag.String("recordings-dir", "recordings", "directory 'record' saves sessions in, as asciinema casts")
+
+var recording_names = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+const recording_bad_name = "Recording names are 1-32 letters, digits, '_' or '-'.\n"
+
+const (
+	// A recording stops by itself once it gets this big or this long.
+	record_max_bytes = 20 << 20
+	record_max_time  = time.Hour
+
+	// Replays go from a quarter of the speed to sixteen times it.
+	replay_min_speed = 0.25
+	replay_max_speed = 16
+
+	// The size of the screen a recording says it wants, in rows.
+	record_height = 50
+
+	// The limits above are for each recording; no more than this many
+	// can be started from one address while the server runs.
+	record_max_per_addr = 10
+)
+
+// Commands whose answers stay out of recordings: admin commands show who
+// is connected from where, and 'admin', 'register' and 'login' are where
+// passwords go in.
+//
+// Nothing the client types is recorded, only what it's sent, so passwords
+// typed at the prompt never are.
+var unrecorded_commands = map[string]bool{
+	"admin": true, "ban": true, "unban": true, "bans": true, "kick": true, "policy": true,
+	"register": true, "login": true,
+}
+
+// off_record reports whether the answer to line should stay out of the
+// session's recording.
+func off_record(line string) bool {
+	name, _, _ := strings.Cut(line, " ")
+	return unrecorded_commands[name]
+}
+
+// A recorder writes everything one session is sent to a cast file, in
+// asciinema's format: a header line, then one [seconds, "o", text] line
+// per write. Only the session's own screen is recorded, which only ever
+// holds what it was allowed to see.
+type recorder struct {
+	mu      sync.Mutex
+	name    string
+	f       *os.File
+	w       *bufio.Writer
+	start   time.Time
+	written int64
+
+	// stopped says why the recording stopped by itself, if it did.
+	stopped string
+}
+
+// The recordings being made now, by name, so they can be told apart in
+// the listing.
+var recording_now = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// How many recordings have been started from each address. It's kept
+// by address rather than by session, as reconnecting makes a new one.
+var recorded_from = struct {
+	sync.Mutex
+	count map[netip.Addr]int
+}{count: map[netip.Addr]int{}}
+
+// take_recording counts a new recording against addr, reporting false
+// if it has started as many as it may.
+func take_recording(addr netip.Addr) bool {
+	recorded_from.Lock()
+	defer recorded_from.Unlock()
+	if recorded_from.count[addr] >= record_max_per_addr {
+		return false
+	}
+	recorded_from.count[addr]++
+	return true
+}
+
+// give_back_recording undoes take_recording for a recording that
+// couldn't be started.
+func give_back_recording(addr netip.Addr) {
+	recorded_from.Lock()
+	defer recorded_from.Unlock()
+	recorded_from.count[addr]--
+}
+
+func recording_path(name string) string {
+	return filepath.Join(*recordingsDir, name+".cast")
+}
+
+type cast_header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+
+	// IdleTimeLimit is how long a replay waits at most between writes.
+	IdleTimeLimit float64 `json:"idle_time_limit,omitempty"`
+}
+
+// start_recording creates the file for a new recording. Names are taken
+// first come, first served: the file is created only if there isn't one
+// already, so two connections can't end up writing the same one.
+func start_recording(sess *session, name string) (*recorder, error) {
+	if err := os.MkdirAll(*recordingsDir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(recording_path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recorder{name: name, f: f, w: bufio.NewWriter(f), start: time.Now()}
+	header, _ := json.Marshal(cast_header{
+		Version:   2,
+		Width:     sess.width,
+		Height:    record_height,
+		Timestamp: r.start.Unix(),
+		Title:     name,
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	r.w.Write(append(header, '\n'))
+
+	recording_now.Lock()
+	recording_now.names[name] = true
+	recording_now.Unlock()
+	return r, nil
+}
+
+// write records one write to the session. It returns false once the
+// recording has stopped, whether it already had or just hit a limit.
+func (r *recorder) write(s string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return false
+	}
+	s = strip_telnet(s)
+	if s == "" {
+		return true
+	}
+
+	when := time.Since(r.start)
+	if when > record_max_time {
+		r.stop_locked(fmt.Sprintf("it reached the %s limit", record_max_time))
+		return false
+	}
+
+	line, _ := json.Marshal([]any{when.Seconds(), "o", s})
+	r.written += int64(len(line) + 1)
+	r.w.Write(append(line, '\n'))
+	if r.written > record_max_bytes {
+		r.stop_locked(fmt.Sprintf("it reached the %d MB limit", record_max_bytes>>20))
+		return false
+	}
+	return true
+}
+
+// end_recording stops sess's recording, if it's making one, when it
+// disconnects.
+func end_recording(sess *session) {
+	if r := sess.recording.Swap(nil); r != nil {
+		r.stop()
+	}
+}
+
+// stop ends the recording, and returns why it had ended already if it
+// had.
+func (r *recorder) stop() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return r.stopped
+	}
+	r.stop_locked("")
+	return ""
+}
+
+func (r *recorder) stop_locked(why string) {
+	r.w.Flush()
+	r.f.Close()
+	r.f = nil
+	r.stopped = why
+
+	recording_now.Lock()
+	delete(recording_now.names, r.name)
+	recording_now.Unlock()
+}
+
+// strip_telnet takes telnet negotiation out of s. It's meant for the
+// client, not its terminal, so a player replaying it wouldn't know what
+// to do with it.
+func strip_telnet(s string) string {
+	if strings.IndexByte(s, tel_iac) < 0 {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != tel_iac || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case tel_will, tel_wont, tel_do, tel_dont:
+			i += 2
+		case tel_sb:
+			end := strings.Index(s[i:], string([]byte{tel_iac, tel_se}))
+			if end < 0 {
+				return b.String()
+			}
+			i += end + 1
+		default:
+			i++
+		}
+	}
+	return b.String()
+}
+
+// record_command handles "record start NAME" and "record stop".
+func record_command(sess *session, line string) string {
+	f := strings.Fields(strings.TrimPrefix(line, "record"))
+	switch {
+	case len(f) == 2 && f[0] == "start":
+		if sess.recording.Load() != nil {
+			return "You're recording already; 'record stop' first.\n"
+		}
+		if !recording_names.MatchString(f[1]) {
+			return recording_bad_name
+		}
+		addr := remote_addr(sess.conn)
+		if !take_recording(addr) {
+			return fmt.Sprintf("That's the %d recordings one address can make.\n", record_max_per_addr)
+		}
+
+		r, err := start_recording(sess, f[1])
+		if err != nil {
+			give_back_recording(addr)
+		}
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Sprintf("There's a recording called %s already; pick another name.\n", f[1])
+		}
+		if err != nil {
+			return fmt.Sprintf("Couldn't start recording: %v.\n", err)
+		}
+		sess.recording.Store(r)
+		return fmt.Sprintf("Recording as %s. Everything you're sent from now on is kept; 'record stop' ends it.\n", f[1])
+	case len(f) == 1 && f[0] == "stop":
+		r := sess.recording.Swap(nil)
+		if r == nil {
+			return "You aren't recording.\n"
+		}
+		if why := r.stop(); why != "" {
+			return fmt.Sprintf("The recording %s had already stopped, as %s.\n", r.name, why)
+		}
+		return fmt.Sprintf("Saved the recording %s; 'replay %s' plays it back.\n", r.name, r.name)
+	}
+	return "Usage: record start NAME, or record stop\n"
+}
+
+// A cast_event is one write in a recording.
+type cast_event struct {
+	at   float64
+	data string
+}
+
+// read_cast reads a recording back. A recording cut off partway, by a
+// crash or because it's still being made, is read up to where it ends.
+func read_cast(name string) (cast_header, []cast_event, error) {
+	f, err := os.Open(recording_path(name))
+	if err != nil {
+		return cast_header{}, nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, record_max_bytes)
+
+	var header cast_header
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &header) != nil || header.Version != 2 {
+		return header, nil, fmt.Errorf("it isn't a version 2 cast")
+	}
+
+	var events []cast_event
+	for sc.Scan() {
+		var ev []any
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || len(ev) != 3 {
+			break
+		}
+		at, ok1 := ev[0].(float64)
+		kind, ok2 := ev[1].(string)
+		data, ok3 := ev[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			break
+		}
+		if kind == "o" {
+			events = append(events, cast_event{at, data})
+		}
+	}
+	return header, events, nil
+}
+
+// replay_command handles "replay NAME [SPEED]", which plays a recording
+// back with its own timing, sped up or slowed down by SPEED. Any key
+// stops it.
+func replay_command(sess *session, line string) (string, error) {
+	f := strings.Fields(strings.TrimPrefix(line, "replay"))
+	usage := fmt.Sprintf("Usage: replay NAME [SPEED], with SPEED from %g to %g.\n", replay_min_speed, float64(replay_max_speed))
+	if len(f) < 1 || len(f) > 2 {
+		return usage, nil
+	}
+	if !recording_names.MatchString(f[0]) {
+		return recording_bad_name, nil
+	}
+	speed := 1.0
+	if len(f) == 2 {
+		var err error
+		speed, err = strconv.ParseFloat(f[1], 64)
+		if err != nil || !(speed >= replay_min_speed && speed <= replay_max_speed) {
+			return usage, nil
+		}
+	}
+
+	header, events, err := read_cast(f[0])
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("There's no recording called %s; 'recordings' lists them.\n", f[0]), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't replay %s: %v.\n", f[0], err), nil
+	}
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	sess.send(clearScreen)
+	start := time.Now()
+	offset := 0.0
+	last := 0.0
+	for _, ev := range events {
+		// Long pauses are cut short if the recording asks for it.
+		gap := ev.at - last
+		if header.IdleTimeLimit > 0 && gap > header.IdleTimeLimit {
+			offset += gap - header.IdleTimeLimit
+		}
+		last = ev.at
+
+		due := start.Add(time.Duration((ev.at - offset) / speed * float64(time.Second)))
+		select {
+		case <-time.After(time.Until(due)):
+		case _, ok := <-keys:
+			sess.send(resetAttrs + showCursor + "\n")
+			if !ok {
+				return "", fmt.Errorf("replay: connection closed")
+			}
+			return "Replay stopped.\n", nil
+		}
+		sess.send(ev.data)
+	}
+
+	sess.send(resetAttrs + showCursor + "\n")
+	return fmt.Sprintf("End of %s.\n", f[0]), nil
+}
+
+// recordings_command handles "recordings".
+func recordings_command(*session, string) string {
+	entries, err := os.ReadDir(*recordingsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("Couldn't list recordings: %v.\n", err)
+	}
+
+	recording_now.Lock()
+	now := make(map[string]bool, len(recording_now.names))
+	for name := range recording_now.names {
+		now[name] = true
+	}
+	recording_now.Unlock()
+
+	var b strings.Builder
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".cast"); ok && recording_names.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		info, err := os.Stat(recording_path(name))
+		if err != nil {
+			continue
+		}
+		length := "unreadable"
+		if _, events, err := read_cast(name); err == nil {
+			length = "0s"
+			if len(events) > 0 {
+				length = time.Duration(events[len(events)-1].at * float64(time.Second)).Round(time.Second).String()
+			}
+		}
+		note := ""
+		if now[name] {
+			note = "  (still recording)"
+		}
+		fmt.Fprintf(&b, "%-32s %8s %10s%s\n", name, length, human_bytes(info.Size()), note)
+	}
+	if b.Len() == 0 {
+		return "No recordings yet. 'record start NAME' makes one.\n"
+	}
+	return b.String()
+}
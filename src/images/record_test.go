@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestRecordLimitPerAddress(t *testing.T) {
+	defer func(dir string) { *recordingsDir = dir }(*recordingsDir)
+	*recordingsDir = t.TempDir()
+	recorded_from.Lock()
+	recorded_from.count = map[netip.Addr]int{}
+	recorded_from.Unlock()
+
+	for i := range record_max_per_addr {
+		// Each recording comes from a new connection, but all from the
+		// same address.
+		sess := session_from(t, "127.0.0.3", "recorder")
+		if got := record_command(sess, fmt.Sprintf("record start r%d", i)); !strings.HasPrefix(got, "Recording as") {
+			t.Fatalf("recording %d: %q", i, got)
+		}
+		record_command(sess, "record stop")
+	}
+	if got := record_command(session_from(t, "127.0.0.3", "recorder"), "record start another"); strings.HasPrefix(got, "Recording as") {
+		t.Errorf("recording %d started: %q", record_max_per_addr+1, got)
+	}
+	elsewhere := session_from(t, "127.0.0.4", "recorder")
+	if got := record_command(elsewhere, "record start elsewhere"); !strings.HasPrefix(got, "Recording as") {
+		t.Errorf("another address couldn't record: %q", got)
+	}
+	record_command(elsewhere, "record stop")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// watch_url_max is the longest 'watch URL N' waits between fetches, in
+// seconds.
+const watch_url_max = 3600
+
+// watch_stamp is a cursor-addressed write of the time, right-aligned on
+// the top row, that leaves the cursor where it found it.
+func watch_stamp(sess *session, note string) string {
+	text := time.Now().UTC().Format("15:04:05") + note
+	col := max(sess.width-len(text)+1, 1)
+	return fmt.Sprintf("\0337\033[1;%dH%s%s\0338", col, resetAttrs, text)
+}
+
+// watch_url handles "watch URL N", which fetches and draws URL every N
+// seconds until a key is pressed, for images that change: webcams,
+// graphs, dashboards. An image the server says hasn't changed isn't
+// drawn again; only the time in the corner moves on.
+func watch_url(sess *session, ref, every string) (string, error) {
+	n, err := strconv.Atoi(every)
+	if err != nil || n < 1 || n > watch_url_max {
+		return fmt.Sprintf("Usage: watch URL SECONDS, with SECONDS from 1 to %d.\n", watch_url_max), nil
+	}
+
+	var meta fetch.Metadata
+	load := func() (image.Image, error) {
+		img, m, err := fetch_changed(sess, ref, meta)
+		if err == nil {
+			meta = m
+		}
+		return img, err
+	}
+
+	img, err := load()
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't load %s: %v.\n", ref, err), nil
+	}
+	sess.last_url = ref
+
+	sess.char_mode(true)
+	defer sess.char_mode(false)
+
+	keys, stop := sess.keypresses()
+	defer stop()
+
+	defer sess.send(resetAttrs + showCursor)
+	sess.send(hideCursor)
+
+	for {
+		switch {
+		case err == nil:
+			stats.rendered.Add(1)
+			sess.last_render = compress(preprocess(img, sess), 1, sess)
+			sess.send(clearScreen + sess.last_render + watch_stamp(sess, ""))
+		case errors.Is(err, fetch.ErrNotModified):
+			sess.send(watch_stamp(sess, ""))
+		default:
+			// Keep the last frame up; the next fetch may well work.
+			sess.send(watch_stamp(sess, " (fetch failed)"))
+		}
+
+		select {
+		case _, ok := <-keys:
+			if !ok {
+				return "", io.EOF
+			}
+			return "Stopped watching " + ref + ".\n", nil
+		case <-time.After(sess.next_frame(time.Duration(n) * time.Second)):
+		}
+		img, err = load()
+	}
+}
@@ -1,23 +1,36 @@
 package main
 
 import (
+	"errors"
 	"strings"
-	"bufio"
-	"net/http"
+	"flag"
 	"image"
+	"image/draw"
 	"log"
-	"io"
 	"net"
+	"net/netip"
 	"fmt"
+	"time"
+	"runtime/debug"
 	_ "image/png"
 	_ "image/jpeg"
 	_ "golang.org/x/image/webp"
+
+	"github.com/atalii/image-server-thing/internal/ansi"
+	"github.com/atalii/image-server-thing/internal/fetch"
+	"github.com/atalii/image-server-thing/internal/scale"
 )
 
 var chars = []rune{' ', '░', '▒', '▓'}
 
 type ascii_fn func(image.Image, int, int) string
 
+// modes are the converters a session can switch between, by name.
+var modes = map[string]ascii_fn{
+	"color": pix_to_rgb,
+	"bw":    pix_to_bw,
+}
+
 func pix_to_bw(img image.Image, x, y int) string {
 	var r, g, b uint32
 	var lightness float64
@@ -26,8 +39,12 @@ func pix_to_bw(img image.Image, x, y int) string {
 
 	lightness = 0.2126 * float64(r) / float64(0xffff) + 0.7152 * (float64(g) / float64(0xffff)) + 0.0722 * (float64(b) / float64(0xffff))
 
-	k := max(int32(lightness * 4) - 1, 0)
-	return string(chars[k])
+	return string(chars[bw_index(lightness)])
+}
+
+// bw_index picks the character of chars for a lightness from 0 to 1.
+func bw_index(lightness float64) int {
+	return min(max(int(lightness * float64(len(chars))) - 1, 0), len(chars) - 1)
 }
 
 func pix_to_rgb(img image.Image, x, y int) string {
@@ -45,94 +62,367 @@ func pix_to_rgb(img image.Image, x, y int) string {
 	return fmt.Sprintf("\033[38;2;%d;%d;%dm█", rs, gs, bs)
 }
 
-func compress(img image.Image, converter ascii_fn) string {
-	var ret string
+// cell_rows is how many rows an image height pixels tall and img_width
+// wide takes up drawn target_width columns across, with cells aspect
+// times as tall as they're wide. A wide, short image can round down to no
+// rows at all; it still gets one, as renderCells' strides divide by it.
+func cell_rows(height, img_width, target_width int, aspect float64) int {
+	return max(int(float64(height) / float64(img_width) / aspect * float64(target_width)), 1)
+}
+
+// renderCells renders img scaled to width columns, or to its own width if
+// that is narrower. Each cell is one character along with the escapes that
+// color it, so cells can be cut out and moved around without breaking a
+// sequence in half. A block above 1 pixelates the render: each block of
+// cells that many columns wide (and half as many rows tall, as cells are
+// twice as tall as they are wide) takes the color of its top-left corner.
+func renderCells(img image.Image, width, block int, sess *session) [][]string {
+	// A cropped image keeps the coordinates it had in the original, so
+	// sampling starts from its corner rather than from 0, 0.
+	origin := img.Bounds().Min
+	img_width := img.Bounds().Max.X - img.Bounds().Min.X
 
-	target_width := 100
-	width := img.Bounds().Max.X - img.Bounds().Min.X
+	// A shadow takes its columns out of the width, so the render with it
+	// is no wider than without.
+	if sess.shadow > 0 {
+		dx, _ := shadow_offset(sess)
+		width = max(width - abs(dx), 1)
+	}
+	target_width := max(min(img_width, width), 1)
 
 	height := img.Bounds().Max.Y - img.Bounds().Min.Y
-	target_height := int(float64(height) / float64(width) / 2.0 * float64(target_width))
+	target_height := cell_rows(height, img_width, target_width, sess.aspect)
+
+	// Sampling other than nearest scales the whole image down first,
+	// after which every pixel is used.
+	if sess.sampling != "nearest" && (target_width < img_width || target_height < height) {
+		img = scale.To(img, target_width, target_height, sess.sampling)
+		origin, img_width, height = image.Point{}, target_width, target_height
+	}
 
-	xstride := width / target_width
+	xstride := img_width / target_width
 	ystride := height / target_height
 
+	yblock := max(block / 2, 1)
+
+	// at is the pixel cell x, y takes its color from.
+	at := func(x, y int) image.Point {
+		return image.Pt(origin.X + (x - x % block) * xstride, origin.Y + (y - y % yblock) * ystride)
+	}
+
+	rows := make([][]string, target_height)
 	for y := range(target_height) {
-		for x := range 100 {
-			ret += converter(img, x * xstride, y * ystride)
+		rows[y] = make([]string, target_width)
+		for x := range target_width {
+			p := at(x, y)
+			if sess.transparency_check {
+				rows[y][x] = checker_cell(img, p, x, y, sess.converter)
+			} else {
+				rows[y][x] = sess.converter(img, p.X, p.Y)
+			}
 		}
-		ret += "\033[0m\n"
 	}
 
-	return ret
+	if sess.outline > 0 {
+		draw_outline(rows, img, at, sess)
+	}
+
+	if sess.shadow > 0 {
+		rows = draw_shadow(rows, img, at, sess)
+	}
+
+	// Overlays go last so they always end up on top.
+	if sess.watermark != "" {
+		draw_watermark(rows, sess.watermark)
+	}
+
+	return rows
+}
+
+// renderToStrings is renderCells joined into one string per row. Each row
+// ends with an attribute reset so rows can be placed side by side.
+func renderToStrings(img image.Image, width, block int, sess *session) []string {
+	rows := renderCells(img, width, block, sess)
+
+	lines := make([]string, len(rows))
+	for y, row := range rows {
+		lines[y] = strings.Join(row, "") + "\033[0m"
+	}
+
+	return lines
 }
 
-func make_image(r io.Reader, converter *ascii_fn) (string, error) {
-	reader := bufio.NewReader(r)
-	line, err := reader.ReadString('\n')
+func compress(img image.Image, block int, sess *session) string {
+	lines, pad := render_lines(img, block, sess)
+	return format_lines(lines, pad, sess)
+}
+
+// render_lines is the rows of a render of img, bordered if the session
+// asks for that, and the padding that aligns them.
+func render_lines(img image.Image, block int, sess *session) ([]string, string) {
+	// A border comes out of the width and height asked for.
+	inset := border_inset(sess)
+	if sess.height > 0 {
+		img = resize_to_cells(img, sess, inset)
+	}
+	width := min(render_width(img, sess), max(sess.width - inset, 1))
+	pad := align_padding(sess, width + inset)
+
+	lines := renderToStrings(img, width, block, sess)
+	if inset > 0 {
+		lines = draw_border(lines, sess)
+	}
+	return lines, pad
+}
+
+// format_lines joins lines into the render that's sent.
+func format_lines(lines []string, pad string, sess *session) string {
+	// Unless the session asked for raw output, repeated colors and
+	// trailing spaces are left out.
+	var compactor ansi.Compactor
+	var ret strings.Builder
+	for _, line := range lines {
+		if !sess.raw_output {
+			line = compactor.Line(line)
+		}
+		ret.WriteString(pad)
+		ret.WriteString(line)
+		ret.WriteString("\n")
+	}
+	if sess.clock {
+		ret.WriteString(clock_overlay(lines, pad))
+	}
+
+	return ret.String()
+}
+
+// normalizeImage returns img as an *image.RGBA, converting it if it's
+// any other type. image.Decode can return all sorts of types, and not all
+// of them have SubImage; once normalized, an image can always be cropped
+// to a view that shares its pixels instead of copying them out.
+func normalizeImage(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+// crop_image returns the part of img inside r, which shares img's pixels.
+// It's empty if r misses img entirely.
+func crop_image(img *image.RGBA, r image.Rectangle) *image.RGBA {
+	return img.SubImage(r).(*image.RGBA)
+}
+
+func make_image(sess *session) (string, error) {
+	line, err := sess.peekLatest(time.Duration(*debounceMs) * time.Millisecond)
 	if err != nil {
-		log.Printf("err: %w", err)
+		log.Printf("err: %v", err)
 		return "fucky wucky\n", err
 	}
+	sess.set_prompt(false)
 
-	line = strings.TrimSpace(line)
-	if line == "color" {
-		*converter = pix_to_rgb
-		return "Using RGB.\n", nil
-	} else if line == "bw" {
-		*converter = pix_to_bw
-		return "Using BW.\n", nil
+	sess.off_record.Store(off_record(line))
+	if note := nick_displaced(sess); note != "" {
+		sess.send(note)
 	}
+	return commands.Dispatch(sess, line)
+}
+
+// render_url fetches and renders the image at url, for lines that aren't
+// a command.
+func render_url(sess *session, url string) (string, error) {
+	sess.last_url = url
+	stop := watch_hangup(sess)
+	img, err := fetch_image(sess, url, sess.max_pixels)
+	stop()
 
-	resp, err := http.Get(line)
+	var big *fetch.TooLargeError
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ". Use 'info' to check dimensions first.\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
 	if err != nil {
-		log.Printf("err: %w", err)
+		log.Printf("err: %v", err)
 		return "other fucky wucky\n", err
 	}
 
-	img, _, err := image.Decode(resp.Body)
-	if err != nil {
-		log.Fatalf("%w", err)
-		return "fucky wucky!\n", err
+	note := ""
+	if sess.trim && trim_bounds(img).Empty() {
+		note = trim_blank
+	}
+	if sess.auto_palette {
+		var picked string
+		img, picked = auto_palette(sess, img)
+		note += picked
 	}
 
-	return compress(img, *converter), nil
+	stats.rendered.Add(1)
+	sess.last_render = compress(preprocess(img, sess), 1, sess)
+	return sess.last_render + note, nil
+}
+
+func send(conn net.Conn, s string) error {
+	n, err := conn.Write([]byte(s))
+	stats.bytesSent.Add(int64(n))
+	return err
 }
 
 func handleConn(conn net.Conn) {
-	var converter ascii_fn
-	converter = pix_to_rgb
+	sess := new_session(conn)
+	if c, ok := conn.(*ssh_conn); ok && c.cols > 0 {
+		sess.width = clamp_width(c.cols)
+	}
+
+	sess.id = stats.connections.Add(1)
+	stats.active.Add(1)
+	defer stats.active.Add(-1)
+	defer track_session(sess)()
+	defer sess.cancel()
+	defer end_recording(sess)
+
+	// A bad image can panic deep inside a decoder. That should only cost
+	// the connection that sent it.
+	defer func() {
+		if v := recover(); v != nil {
+			report_crash(sess, v, debug.Stack())
+			conn.Close()
+		}
+	}()
+
+	if !*noProbe {
+		probe_terminal(sess)
+	}
+
+	sess.send(string(banner.Load().([]byte)))
+	sess.send("Welcome! Paste an image URL to view. Commands 'color' and 'bw' can be used to alter the output; 'width N' sets how wide images are drawn " + width_limits() + "; 'stats' shows server statistics; 'play " + game_names() + "' starts a game.\n")
+	sess.send(probe_note(sess))
 
-	conn.Write([]byte("Welcome! Paste an image URL to view. Commands 'color' and 'bw' can be used to alter the output.\n"))
+	go notice_loop(sess)
 
 	for {
-		img, err := make_image(conn, &converter)
-		conn.Write([]byte(img))
+		share_settings(sess)
+		sess.set_prompt(true)
+		idle_wait(sess)
+		img, err := make_image(sess)
+		sess.send(img)
 
 		if err != nil {
-			log.Printf("%w", err)
+			log.Printf("%v", err)
 			break
 		}
 	}
 }
 
 func main() {
+	flag.Parse()
+	open_log()
+	open_crash_log()
+	open_scoreboard()
+	open_profiles()
+	open_bans()
+	open_policy()
+	open_exports()
+	open_user_agent()
+	open_sources()
+	open_jobs()
+	if err := load_trivia(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *minWidth < 1 || *minWidth > *maxWidth {
+		log.Fatalf("-min-width %d must be at least 1 and no more than -max-width %d", *minWidth, *maxWidth)
+	}
+
+	if *maxPixels < 1 || *maxPixels > max_pixels_ceiling {
+		log.Fatalf("-max-pixels %d must be from 1 to %d", *maxPixels, max_pixels_ceiling)
+	}
+
+	for _, flag := range []struct {
+		name  string
+		value int
+	}{{"throttle", *throttleDefault}, {"throttle-cap", *throttleCap}} {
+		if flag.value != 0 && (flag.value < min_throttle || flag.value > max_throttle) {
+			log.Fatalf("-%s %d must be 0 or from %d to %d bytes a second", flag.name, flag.value, min_throttle, max_throttle)
+		}
+	}
+
+	if *screensaverMinutes < 0 || *screensaverMinutes > screensaver_max_minutes {
+		log.Fatalf("-screensaver %d must be from 0 to %d minutes", *screensaverMinutes, screensaver_max_minutes)
+	}
+
+	if _, ok := modes[*lockMode]; *lockMode != "" && !ok {
+		log.Fatalf("-lock-mode %q isn't a mode; use color or bw", *lockMode)
+	}
+
+	if *bannerPath != "" {
+		if err := load_banner(); err != nil {
+			log.Fatalf("banner: %v", err)
+		}
+		go reload_banner()
+	}
+	if *policyFile != "" {
+		go reload_policy()
+	}
+	go daily_reminder()
+
+	if *wsPort < 0 || *wsPort > 65535 {
+		log.Fatalf("-ws-port %d must be 0 or a port from 1 to 65535", *wsPort)
+	}
+	if *wsPort != 0 {
+		go serve_ws()
+	}
+
+	if _, err := netip.ParseAddr(*adminIP); err != nil {
+		log.Fatalf("-admin-ip %q isn't an IP address", *adminIP)
+	}
+
+	if *metricsPort < 0 || *metricsPort > 65535 {
+		log.Fatalf("-metrics-port %d must be 0 or a port from 1 to 65535", *metricsPort)
+	}
+	if *metricsPort != 0 {
+		go serve_metrics()
+	}
+
+	if *sshGenKey && *sshHostKey == "" {
+		log.Fatalf("-ssh-gen-key needs -ssh-host-key to say where to write the key")
+	}
+	if *sshPort < 1 || *sshPort > 65535 {
+		log.Fatalf("-ssh-port %d must be a port from 1 to 65535", *sshPort)
+	}
+	if *sshHostKey != "" {
+		conf, err := ssh_config()
+		if err != nil {
+			log.Fatalf("ssh: %v", err)
+		}
+		go serve_ssh(conf)
+	}
+
 	log.Print("Binding: 0.0.0.0:5173")
 	ln, err := net.Listen("tcp", ":5173")
 	if err != nil {
-		log.Fatalf("%w\n", err)
+		log.Fatalf("%v\n", err)
 	}
 
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			log.Printf("%w\n", err)
+			log.Printf("%v\n", err)
+			continue
+		}
+		set_nodelay(conn)
+		if turn_away(conn) {
+			continue
 		}
 
 		go handleConn(conn)
 	}
-
-	if err != nil {
-		log.Fatalf("%w", err)
-	}
 }
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"image"
+	"net"
+	"testing"
+)
+
+// test_session is a session on one end of a pipe nothing reads.
+func test_session(t *testing.T) *session {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return new_session(server)
+}
+
+func TestRenderWideShortImage(t *testing.T) {
+	for _, sampling := range []string{"nearest", "bilinear"} {
+		sess := test_session(t)
+		sess.sampling = sampling
+
+		rows := renderCells(image.NewRGBA(image.Rect(0, 0, 1000, 3)), 100, 1, sess)
+		if len(rows) != 1 || len(rows[0]) != 100 {
+			t.Errorf("%s: 1000x3 rendered as %d rows", sampling, len(rows))
+		}
+	}
+}
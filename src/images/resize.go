@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/scale"
+)
+
+// max_resize_rows is the most rows 'resize' can ask renders to be.
+const max_resize_rows = 200
+
+// resize_to_cells stretches img so that it's drawn exactly sess.width
+// columns by sess.height rows, less inset of each for a border, whatever
+// its own shape. Each row covers sess.aspect rows of pixels, give or take
+// rounding, so the height is the fewest pixel rows that make h rows.
+// Cells less tall than they're wide can make one row too many.
+func resize_to_cells(img image.Image, sess *session, inset int) image.Image {
+	w, h := max(sess.width-inset, 1), max(sess.height-inset, 1)
+	ph := max(int(float64(h)*sess.aspect), 1)
+	for cell_rows(ph, w, w, sess.aspect) < h {
+		ph++
+	}
+	return scale.To(img, w, ph, sess.sampling)
+}
+
+func resize_status(sess *session) string {
+	if sess.height == 0 {
+		return "auto"
+	}
+	return fmt.Sprintf("%d×%d", sess.width, sess.height)
+}
+
+// resize_command handles "resize W H", which fixes both dimensions of
+// renders, stretching images to fit, and "resize auto", which goes back
+// to rows following from the width and the image's shape.
+func resize_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "resize"))
+	switch {
+	case len(args) == 0:
+		return "Size: " + resize_status(sess) + "\n"
+	case len(args) == 1 && args[0] == "auto":
+		sess.height = 0
+		return fmt.Sprintf("Size: auto, %d columns wide and as tall as the image's shape makes it.\n", sess.width)
+	}
+
+	usage := fmt.Sprintf("Usage: resize W H, with W from %d to %d columns and H from 1 to %d rows, or resize auto.\n", *minWidth, *maxWidth, max_resize_rows)
+	if len(args) != 2 {
+		return usage
+	}
+	w, err1 := strconv.Atoi(args[0])
+	h, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || h < 1 || h > max_resize_rows {
+		return usage
+	}
+
+	sess.width, sess.height = clamp_width(w), h
+	note := ""
+	if sess.width != w {
+		note = fmt.Sprintf(", as width %d was clamped %s", w, width_limits())
+	}
+	return fmt.Sprintf("Size: %s%s. Images are stretched to fit.\n", resize_status(sess), note)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestResizeRowsAtAnyAspect(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for _, aspect := range []float64{1, 2, 2.5} {
+		for _, sampling := range []string{"nearest", "bilinear"} {
+			sess := test_session(t)
+			sess.aspect, sess.sampling = aspect, sampling
+			resize_command(sess, "resize 80 40")
+
+			if lines, _ := render_lines(img, 1, sess); len(lines) != 40 {
+				t.Errorf("aspect %g, %s: %d rows, want 40", aspect, sampling, len(lines))
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/reveal"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	reveal_countdown = 15 * time.Second
+	reveal_step      = 6 * time.Second
+	reveal_log_lines = 5
+
+	// Guesses are cut to this many columns, so one can't fill the screen.
+	reveal_guess_max = 60
+)
+
+// A reveal_round is one image being guessed. run moves it from stage to
+// stage; everyone taking part, host included, watches it from their own
+// connection and renders it for themselves, so each sees it at their own
+// width and mode. changed is closed and replaced on every change, as in
+// typing races.
+type reveal_round struct {
+	host   string
+	answer string
+	img    image.Image
+	starts time.Time
+
+	mu      sync.Mutex
+	stage   int // -1 until it starts
+	over    bool
+	winner  string
+	points  int
+	players []string
+	log     []string
+	changed chan struct{}
+	solved  chan struct{}
+}
+
+// Only one round runs at a time; there are no rooms to keep them apart.
+var reveal_lobby struct {
+	sync.Mutex
+	open *reveal_round
+}
+
+// reveal_command handles "reveal URL ANSWER", which hosts a round, and
+// "reveal", which joins the one running.
+func reveal_command(sess *session, line string) (string, error) {
+	url, answer, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "reveal")), " ")
+	answer = strings.TrimSpace(answer)
+
+	if url == "" {
+		reveal_lobby.Lock()
+		r := reveal_lobby.open
+		reveal_lobby.Unlock()
+		if r == nil {
+			return "No round is running. Host one with 'reveal URL ANSWER'.\n", nil
+		}
+		return r.play(sess, false)
+	}
+
+	if !reveal.Valid(answer) {
+		return "Usage: reveal URL ANSWER to host a round, or reveal to join one.\n", nil
+	}
+
+	sess.last_url = url
+	img, err := fetch_image(sess, url, sess.max_pixels)
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+
+	r := &reveal_round{
+		host:    player_name(sess, "host"),
+		answer:  answer,
+		img:     img,
+		starts:  time.Now().Add(reveal_countdown),
+		stage:   -1,
+		changed: make(chan struct{}),
+		solved:  make(chan struct{}),
+	}
+
+	reveal_lobby.Lock()
+	if reveal_lobby.open != nil {
+		reveal_lobby.Unlock()
+		return "A round is already running. Type 'reveal' to join it.\n", nil
+	}
+	reveal_lobby.open = r
+	reveal_lobby.Unlock()
+
+	go r.run()
+	return r.play(sess, true)
+}
+
+// player_name is what to call sess in a shared game.
+func player_name(sess *session, fallback string) string {
+	if sess.nick != "" {
+		return sess.nick
+	}
+	return fallback
+}
+
+// run steps the round through its stages, stopping early if someone gets
+// it, and takes it out of the lobby once it's over.
+func (r *reveal_round) run() {
+	defer func() {
+		reveal_lobby.Lock()
+		if reveal_lobby.open == r {
+			reveal_lobby.open = nil
+		}
+		reveal_lobby.Unlock()
+	}()
+
+	// The countdown is redrawn every second so the list of players stays
+	// fresh.
+	for time.Now().Before(r.starts) {
+		time.Sleep(min(time.Second, time.Until(r.starts)))
+		r.update(func() {})
+	}
+
+	for stage := range reveal.Stages {
+		r.update(func() { r.stage = stage })
+
+		select {
+		case <-time.After(reveal_step):
+		case <-r.solved:
+			return
+		}
+	}
+
+	r.update(func() { r.over = true })
+}
+
+// update changes the round under its lock and tells everyone watching.
+func (r *reveal_round) update(change func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	change()
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *reveal_round) say(msg string) {
+	r.log = append(r.log, msg)
+	if len(r.log) > reveal_log_lines {
+		r.log = r.log[1:]
+	}
+}
+
+// guess checks a player's guess. The first right one ends the round.
+func (r *reveal_round) guess(name, text string) {
+	r.update(func() {
+		switch {
+		case r.over:
+		case r.stage < 0:
+			r.say(name + " is too keen: the round hasn't started.")
+		case reveal.Match(text, r.answer):
+			r.over = true
+			r.winner = name
+			r.points = reveal.Points(r.stage)
+			close(r.solved)
+		default:
+			r.say(name + ": " + text)
+		}
+	})
+}
+
+// play shows the round to sess until it's over, taking its guesses unless
+// it's the host's.
+func (r *reveal_round) play(sess *session, host bool) (string, error) {
+	name := r.host
+	r.update(func() {
+		if !host {
+			name = player_name(sess, fmt.Sprintf("guest%d", len(r.players)))
+			r.say(name + " joined.")
+		}
+		r.players = append(r.players, name)
+	})
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	for {
+		r.mu.Lock()
+		changed, over := r.changed, r.over
+		screen := r.draw(sess, host)
+		winner, points := r.winner, r.points
+		r.mu.Unlock()
+
+		sess.send(screen)
+		if over {
+			if winner == name && !host {
+				return fmt.Sprintf("Reveal: you got it for %d points!%s\n", points, sess.record_score("reveal", float64(points))), nil
+			}
+			return "Reveal: round over.\n", nil
+		}
+
+		select {
+		case <-changed:
+		case line, ok := <-lines:
+			if !ok {
+				r.update(func() { r.say(name + " left.") })
+				return "", io.EOF
+			}
+			if line == "q" {
+				r.update(func() { r.say(name + " left.") })
+				return "Reveal: left the round.\n", nil
+			}
+			if host {
+				sess.send("You're the host, so no guessing. Type q to leave.\n> ")
+				continue
+			}
+			if line = usertext.Truncate(usertext.Clean(strings.TrimSpace(line)), reveal_guess_max); line != "" {
+				r.guess(name, line)
+			}
+		}
+	}
+}
+
+// draw renders the round as sess sees it. It's called with r.mu held.
+func (r *reveal_round) draw(sess *session, host bool) string {
+	var b strings.Builder
+	b.WriteString(clearScreen + "\033[1mReveal\033[0m   hosted by " + r.host + "\n\n")
+
+	switch {
+	case r.over:
+		b.WriteString(compress(preprocess(r.img, sess), 1, sess))
+		if r.winner != "" {
+			fmt.Fprintf(&b, "\nIt was \033[1m%s\033[0m. %s got it for %d points.\n", r.answer, r.winner, r.points)
+		} else {
+			fmt.Fprintf(&b, "\nIt was \033[1m%s\033[0m. Nobody got it.\n", r.answer)
+		}
+		return b.String()
+	case r.stage < 0:
+		fmt.Fprintf(&b, "Starting in about %ds. Players: %s.\n",
+			max(0, int(time.Until(r.starts).Round(time.Second).Seconds())), strings.Join(r.players, ", "))
+	default:
+		b.WriteString(compress(preprocess(r.img, sess), reveal.Block(sess.width, r.stage), sess))
+		fmt.Fprintf(&b, "\nStage %d of %d: a right guess now is worth %d points.\n", r.stage+1, reveal.Stages, reveal.Points(r.stage))
+	}
+
+	b.WriteString("\n")
+	for _, msg := range r.log {
+		b.WriteString(msg + "\n")
+	}
+
+	if host {
+		fmt.Fprintf(&b, "\nThe answer is %s. Type q to leave.\n", r.answer)
+	} else {
+		b.WriteString("\nType your guess and press enter, or q to leave.\n> ")
+	}
+	return b.String()
+}
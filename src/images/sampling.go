@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/scale"
+)
+
+// sampling_command handles "sampling nearest|bilinear|lanczos", which is
+// "scale-filter" as well: how images are brought down to the render's
+// size. The name is taken in any case.
+func sampling_command(sess *session, line string) string {
+	args := strings.Fields(line)[1:]
+	if len(args) != 1 || scale.Filters[strings.ToLower(args[0])] == nil {
+		return fmt.Sprintf("Usage: sampling nearest|bilinear|lanczos (currently %s)\n", sess.sampling)
+	}
+
+	sess.sampling = strings.ToLower(args[0])
+	return fmt.Sprintf("Images will be sampled %s.\n", sess.sampling)
+}
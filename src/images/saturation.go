@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/colorspace"
+)
+
+const max_saturation = 200
+
+// apply_saturation scales every pixel's saturation to pct percent of
+// what it was: 0 is all grays, 100 the image as it is and 200 twice as
+// vivid, as far as colors go.
+func apply_saturation(img image.Image, pct int) image.Image {
+	out := to_nrgba(img)
+	f := float64(pct) / 100
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		px := out.Pix[i : i+3]
+		r, g, b := colorspace.Saturate(float64(px[0])/255, float64(px[1])/255, float64(px[2])/255, f)
+		px[0], px[1], px[2] = clamp8(int(math.Round(r*255))), clamp8(int(math.Round(g*255))), clamp8(int(math.Round(b*255)))
+	}
+	return out
+}
+
+// saturation_command handles "saturation N".
+func saturation_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "saturation"))
+	if arg == "" {
+		return fmt.Sprintf("Saturation: %d%%\n", sess.saturation)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(arg, "%"))
+	if err != nil || n < 0 || n > max_saturation {
+		return fmt.Sprintf("Usage: saturation N, from 0 (gray) to %d percent (100 leaves images as they are).\n", max_saturation)
+	}
+	sess.saturation = n
+	return fmt.Sprintf("Saturation: %d%%\n", n)
+}
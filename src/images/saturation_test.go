@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func render_with(t *testing.T, img image.Image, mode string, saturation int) [][]string {
+	sess := test_session(t)
+	if !sess.set_mode(mode) {
+		t.Fatalf("can't set mode %s", mode)
+	}
+	sess.saturation = saturation
+	return renderCells(preprocess(img, sess), 16, 1, sess)
+}
+
+// gray_cell returns the level of a cell the color converter drew, failing
+// the test if it isn't a gray.
+func gray_cell(t *testing.T, cell string) int {
+	var r, g, b int
+	if _, err := fmt.Sscanf(cell, "\033[38;2;%d;%d;%dm█", &r, &g, &b); err != nil {
+		t.Fatalf("%q: %v", cell, err)
+	}
+	if r != g || g != b {
+		t.Fatalf("%q is not gray", cell)
+	}
+	return r
+}
+
+// Saturation 0 draws a gray image with the color converter in the same
+// tones the bw converter shades it in, and leaves it as it was.
+func TestSaturationZeroMatchesBW(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			img.SetGray(x, y, color.Gray{uint8(x*16 + y)})
+		}
+	}
+
+	cells := render_with(t, img, "color", 0)
+	if !slices.EqualFunc(cells, render_with(t, img, "color", 100), slices.Equal) {
+		t.Error("saturation 0 changed a gray image")
+	}
+
+	bw := render_with(t, img, "bw", 0)
+	if !slices.EqualFunc(bw, render_with(t, img, "bw", 100), slices.Equal) {
+		t.Error("saturation 0 changed a gray image in bw")
+	}
+	for y := range cells {
+		for x, cell := range cells[y] {
+			level := gray_cell(t, cell)
+			if want := string(chars[bw_index(float64(level)/255)]); bw[y][x] != want {
+				t.Errorf("%d,%d: gray %d is %q in bw, want %q", x, y, level, bw[y][x], want)
+			}
+		}
+	}
+}
+
+func TestSaturationZeroIsGray(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 200, 255})
+		}
+	}
+
+	for _, row := range render_with(t, img, "color", 0) {
+		for _, cell := range row {
+			gray_cell(t, cell)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+const (
+	scan_max_urls = 10
+	scan_timeout  = 10 * time.Second
+
+	// An image's header is near its start; reading further than this to
+	// find one means there isn't one.
+	scan_max_read = 1 << 20
+
+	scan_url_width = 40
+)
+
+// A scan_result is what probing one URL found. Anything not found is
+// left empty.
+type scan_result struct {
+	status string
+	kind   string
+	size   string
+	err    error
+}
+
+// scan_command handles "scan URL...", which checks up to ten URLs at once
+// for whether each answers with an image, reading only as far as the
+// image's header. The table keeps the URLs in the order they were given.
+func scan_command(sess *session, line string) string {
+	urls := strings.Fields(strings.TrimPrefix(line, "scan"))
+	if len(urls) == 0 || len(urls) > scan_max_urls {
+		return fmt.Sprintf("Usage: scan URL..., with 1 to %d URLs.\n", scan_max_urls)
+	}
+
+	results := make([]scan_result, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = scan_url(sess, url)
+		}()
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s %-6s %-14s %-11s\n", scan_url_width, "URL", "STATUS", "TYPE", "SIZE")
+	good := 0
+	for i, r := range results {
+		mark := "✓"
+		if r.err != nil {
+			mark = "✗"
+		} else {
+			good++
+		}
+		fmt.Fprintf(&b, "%-*s %-6s %-14s %-11s %s\n", scan_url_width, truncate_url(urls[i]), or_dash(r.status), or_dash(r.kind), or_dash(r.size), mark)
+		if r.err != nil {
+			fmt.Fprintf(&b, "    %v\n", r.err)
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d look like images.\n", good, len(urls))
+	return b.String()
+}
+
+// scan_url probes one URL, giving up after scan_timeout.
+func scan_url(sess *session, url string) scan_result {
+	ctx, cancel := context.WithTimeout(fetching_for(sess), scan_timeout)
+	defer cancel()
+
+	var r scan_result
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		r.err = policy_unwrap(err)
+		return r
+	}
+	defer fetch.Close(resp.Body)
+
+	r.status = strconv.Itoa(resp.StatusCode)
+	r.kind = strings.TrimSpace(strings.SplitN(resp.Header.Get("Content-Type"), ";", 2)[0])
+	if resp.StatusCode/100 != 2 {
+		r.err = fmt.Errorf("the server answered %s", resp.Status)
+		return r
+	}
+
+	cfg, format, err := image.DecodeConfig(io.LimitReader(resp.Body, scan_max_read))
+	if err != nil {
+		r.err = fmt.Errorf("not an image: %v", err)
+		return r
+	}
+	r.size = fmt.Sprintf("%d×%d", cfg.Width, cfg.Height)
+	if r.kind == "" {
+		r.kind = format
+	}
+	return r
+}
+
+// truncate_url shortens url to fit its column, keeping the ends, which
+// tell URLs apart best.
+func truncate_url(url string) string {
+	runes := []rune(url)
+	if len(runes) <= scan_url_width {
+		return url
+	}
+	half := (scan_url_width - 1) / 2
+	return string(runes[:half]) + "…" + string(runes[len(runes)-(scan_url_width-1-half):])
+}
+
+func or_dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
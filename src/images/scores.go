@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+var scoresFile = flag.String("scores-file", "", "keep leaderboards in this JSON file across restarts (in memory only if unset)")
+
+// scoreboard holds every nicknamed player's results; main opens it.
+var scoreboard *leaderboard.Store
+
+// score_kinds says how each game ranks its results. Games with several
+// sizes keep a board per size, named like "memory-4x4".
+var score_kinds = map[string]leaderboard.Kind{
+	"2048":       leaderboard.Highest,
+	"snake":      leaderboard.Highest,
+	"trivia":     leaderboard.Highest,
+	"tetris":     leaderboard.Highest,
+	"rogue":      leaderboard.Highest,
+	"typing":     leaderboard.Highest,
+	"maze":       leaderboard.Lowest,
+	"memory":     leaderboard.Lowest,
+	"puzzle":     leaderboard.Lowest,
+	"wordle":     leaderboard.Lowest,
+	"battleship": leaderboard.Total,
+	"checkers":   leaderboard.Total,
+	"chess":      leaderboard.Total,
+	"pong":       leaderboard.Total,
+	"reversi":    leaderboard.Total,
+	"reveal":     leaderboard.Total,
+}
+
+// What each game's score counts, for the tables.
+var score_units = map[string]string{
+	"typing":     "WPM",
+	"maze":       "extra steps",
+	"memory":     "turns",
+	"puzzle":     "moves",
+	"wordle":     "guesses",
+	"battleship": "wins",
+	"checkers":   "wins",
+	"chess":      "wins",
+	"pong":       "wins",
+	"reversi":    "wins",
+	"memory-duo": "wins",
+	"reveal":     "points",
+	"trivia":     "points",
+	"tetris":     "points",
+}
+
+const top_default, top_max = 10, 50
+
+func open_scoreboard() {
+	s, backup, err := leaderboard.Open(*scoresFile)
+	if err != nil {
+		log.Fatalf("scores: %v", err)
+	}
+	if backup != "" {
+		log.Printf("scores: %s was unreadable; moved it to %s and started afresh", *scoresFile, backup)
+	}
+	scoreboard = s
+}
+
+func score_kind(game string) leaderboard.Kind {
+	if k, ok := score_kinds[game]; ok {
+		return k
+	}
+	base, _, _ := strings.Cut(game, "-")
+	return score_kinds[base]
+}
+
+func score_unit(game string) string {
+	if u, ok := score_units[game]; ok {
+		return u
+	}
+	if day, ok := strings.CutPrefix(game, "daily-"); ok {
+		if c, ok := daily_for(day); ok {
+			return c.unit
+		}
+	}
+	base, _, _ := strings.Cut(game, "-")
+	if u, ok := score_units[base]; ok {
+		return u
+	}
+	return "points"
+}
+
+func format_score(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// record_score keeps the best score per game for this connection and, for
+// players with a nickname, on the leaderboard, and says how it compares.
+// In games scored by total, like wins, the scores add up instead.
+func (s *session) record_score(game string, score float64) string {
+	kind := score_kind(game)
+
+	note := ""
+	best, ok := s.scores[game]
+	switch {
+	case kind == leaderboard.Total:
+		s.scores[game] = best + score
+	case ok && !kind.Better(score, best):
+		note = fmt.Sprintf(" (best: %s)", format_score(best))
+	default:
+		s.scores[game] = score
+		if ok {
+			note = " New best!"
+		}
+	}
+
+	if s.nick == "" || !s.owns_nick() {
+		return note
+	}
+	if s.registered {
+		if err := nicknames.AddPlay(s.nick, game); err != nil {
+			log.Printf("profiles: %v", err)
+		}
+	}
+	before, _, _ := scoreboard.Top(game, top_max)
+	res, err := scoreboard.Submit(game, s.nick, kind, score)
+	if err != nil {
+		log.Printf("scores: %v", err)
+		return note
+	}
+	if res.Improved && kind != leaderboard.Total {
+		notice_passed(game, s.nick, before, res.Best)
+	}
+
+	switch {
+	case kind == leaderboard.Total:
+		return fmt.Sprintf(" (%s: %s %s in all)", s.nick, format_score(res.Best), score_unit(game))
+	case res.First:
+		return ""
+	case res.Improved:
+		return fmt.Sprintf(" New best for %s!", s.nick)
+	}
+	return fmt.Sprintf(" (best for %s: %s)", s.nick, format_score(res.Best))
+}
+
+// top_command handles "top GAME [N]".
+func top_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "top"))
+	usage := fmt.Sprintf("Usage: top GAME [N]. Boards: %s.\n", strings.Join(scoreboard.Games(), ", "))
+	if len(args) == 0 || len(args) > 2 {
+		return usage
+	}
+
+	n := top_default
+	if len(args) == 2 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 || n > top_max {
+			return fmt.Sprintf("Show from 1 to %d places.\n", top_max)
+		}
+	}
+
+	game := args[0]
+	entries, kind, ok := scoreboard.Top(game, n)
+	if !ok {
+		return fmt.Sprintf("No scores for %s yet. %s", game, usage)
+	}
+
+	verb := "highest"
+	switch kind {
+	case leaderboard.Lowest:
+		verb = "fewest"
+	case leaderboard.Total:
+		verb = "most"
+	}
+
+	medals := []string{fg(255, 215, 0), fg(200, 200, 210), fg(205, 127, 50)}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\033[1m%s\033[0m, %s %s first\n", game, verb, score_unit(game))
+	fmt.Fprintf(&b, "%4s  %-16s %10s %6s  %s\n", "#", "nick", score_unit(game), "plays", "set")
+	// Daily challenges enter players before they finish.
+	entries = slices.DeleteFunc(entries, func(e leaderboard.Entry) bool { return e.Plays == 0 })
+	for i, e := range entries {
+		row := fmt.Sprintf("%4d  %s %10s %6d  %s", i+1, usertext.Pad(e.Nick, 16), format_score(e.Best), e.Plays, e.When.Format(time.DateOnly))
+		if i < len(medals) && sess.mode != "bw" {
+			row = medals[i] + row + resetAttrs
+		}
+		b.WriteString(row + "\n")
+	}
+	return b.String()
+}
+
+// player_stats describes how nick is doing in every game, for "stats NICK".
+func player_stats(nick string) string {
+	standings := scoreboard.Player(nick)
+	if len(standings) == 0 {
+		return fmt.Sprintf("No scores for %s.\n", nick)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\033[1m%s\033[0m\n", nick)
+	for _, st := range standings {
+		what := "best"
+		if st.Kind == leaderboard.Total {
+			what = "total"
+		}
+		fmt.Fprintf(&b, "%-12s %s %s %s, #%d of %d, %d played\n",
+			st.Game, what, format_score(st.Best), score_unit(st.Game), st.Rank, st.Of, st.Plays)
+	}
+	return b.String()
+}
+
+// record_win credits the winner of a two-player game and returns the note
+// to show them. Only wins over another player count: ones over the
+// computer would be too easy to rack up.
+func record_win(winner, loser *session, game string) string {
+	if winner == nil || loser == nil {
+		return ""
+	}
+	return winner.record_score(game, 1)
+}
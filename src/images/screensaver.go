@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/font"
+)
+
+// Output piped into a file shouldn't fill up with screensaver frames, so
+// it's off unless the server or the client turns it on.
+var screensaverMinutes = flag.Int("screensaver", 0, "minutes a connection sits idle before a screensaver starts, until it sets its own with 'screensaver'; 0 leaves it off")
+
+const (
+	screensaver_max_minutes = 24 * 60
+
+	// A screensaver is a frame a second, a line or two of it.
+	screensaver_frame = time.Second
+	screensaver_rows  = 20
+	screensaver_stars = 16
+)
+
+// screensavers draw the frame elapsed into a screensaver, each a
+// screenful of cursor-addressed writes. They're given the time rather
+// than a frame count, like the demo effects.
+var screensavers = map[string]func(sess *session) func(elapsed time.Duration) string{
+	"clock": screensaver_clock,
+	"drift": screensaver_drift,
+}
+
+// screensaver_command handles "screensaver [off|MINUTES|clock|drift]".
+func screensaver_command(sess *session, line string) string {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "screensaver"))
+	switch {
+	case arg == "":
+	case arg == "off":
+		sess.screensaver = 0
+	case screensavers[arg] != nil:
+		sess.screensaver_style = arg
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > screensaver_max_minutes {
+			return fmt.Sprintf("Usage: screensaver off, screensaver MINUTES from 1 to %d, or screensaver clock|drift\n", screensaver_max_minutes)
+		}
+		sess.screensaver = n
+	}
+	return "Screensaver: " + screensaver_status(sess) + "\n"
+}
+
+func screensaver_status(sess *session) string {
+	if sess.screensaver == 0 {
+		return "off (" + sess.screensaver_style + " when on)"
+	}
+	return fmt.Sprintf("%s after %s idle", sess.screensaver_style, plural(sess.screensaver, "minute"))
+}
+
+// idle_wait waits for input, and if there's none by the time the session's
+// screensaver is due, draws it until there is. The input is left to be
+// read; the first key stops the screensaver and clears it off the screen.
+func idle_wait(sess *session) {
+	if sess.screensaver == 0 || wait_input(sess, time.Duration(sess.screensaver)*time.Minute) {
+		return
+	}
+
+	// Frames have no place in a recording of what was done.
+	off := sess.off_record.Swap(true)
+	defer sess.off_record.Store(off)
+
+	// Nor do notices have a place on top of them.
+	sess.set_prompt(false)
+	defer sess.set_prompt(true)
+
+	draw := screensavers[sess.screensaver_style](sess)
+	start := time.Now()
+	for {
+		sess.send(hideCursor + clearScreen + draw(time.Since(start)))
+		if wait_input(sess, screensaver_frame) {
+			break
+		}
+	}
+	sess.send(resetAttrs + clearScreen + showCursor)
+}
+
+// wait_input reports whether input arrives within d, without reading it.
+// A connection that fails counts as input, so that whatever reads next
+// finds out.
+func wait_input(sess *session, d time.Duration) bool {
+	if sess.reader.Buffered() > 0 {
+		return true
+	}
+	sess.conn.SetReadDeadline(time.Now().Add(d))
+	defer sess.conn.SetReadDeadline(time.Time{})
+
+	_, err := sess.reader.Peek(1)
+	return !errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// screensaver_dim is how a screensaver colors what it draws: a dim gray,
+// unless the session is in bw.
+func screensaver_dim(sess *session) string {
+	if sess.mode == "bw" {
+		return ""
+	}
+	return fg(70, 70, 80)
+}
+
+// screensaver_clock is the time in the big font, drifting a column or a
+// row a second and bouncing off the edges, so it never sits still long
+// enough to burn in.
+func screensaver_clock(sess *session) func(time.Duration) string {
+	return func(elapsed time.Duration) string {
+		rows := font.Big.Render(time.Now().Format("15:04"))
+		s := elapsed.Seconds()
+		x := bounce(s, sess.width-len(rows[0]))
+		y := bounce(s/2, screensaver_rows-len(rows))
+
+		var b strings.Builder
+		b.WriteString(screensaver_dim(sess))
+		for dy, row := range rows {
+			fmt.Fprintf(&b, "\033[%d;%dH", y+dy+1, x+1)
+			for _, on := range row {
+				if on {
+					b.WriteRune(chars[len(chars)-1])
+				} else {
+					b.WriteRune(chars[0])
+				}
+			}
+		}
+		return b.String()
+	}
+}
+
+// screensaver_drift is a few dim stars, each drifting left at a speed of
+// its own and coming back round on the right.
+func screensaver_drift(sess *session) func(time.Duration) string {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	type star struct{ x, y, speed float64 }
+	stars := make([]star, screensaver_stars)
+	for i := range stars {
+		stars[i] = star{rng.Float64(), float64(rng.Intn(screensaver_rows)), 0.5 + rng.Float64()*2}
+	}
+
+	return func(elapsed time.Duration) string {
+		var b strings.Builder
+		b.WriteString(screensaver_dim(sess))
+		w := float64(sess.width)
+		for _, st := range stars {
+			x := math.Mod(st.x*w-elapsed.Seconds()*st.speed, w)
+			if x < 0 {
+				x += w
+			}
+			fmt.Fprintf(&b, "\033[%d;%dH.", int(st.y)+1, int(x)+1)
+		}
+		return b.String()
+	}
+}
+
+// bounce goes from 0 up to span and back down again as v goes up, a step
+// for each one v does.
+func bounce(v float64, span int) int {
+	if span <= 0 {
+		return 0
+	}
+	p := int(v) % (2 * span)
+	if p > span {
+		p = 2*span - p
+	}
+	return p
+}
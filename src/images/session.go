@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
+
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+)
+
+var debounceMs = flag.Int("debounce-ms", 0, "wait this long after a line for a newer one to replace it (0 disables)")
+
+var lockMode = flag.String("lock-mode", "", "render every client in this mode (color or bw) and don't let them switch")
+
+const mode_locked = "Mode is locked by server.\n"
+
+// At most this many lines of a burst are thrown away before one is used
+// anyway, so a client that never stops sending still gets served.
+const max_debounced = 5
+
+// session is the per-connection state. The reader is kept for the life of
+// the connection so input buffered past one line isn't lost.
+type session struct {
+	id        int64
+	conn      net.Conn
+	input     *telnet_reader
+	reader    *bufio.Reader
+	mode      string
+	converter ascii_fn
+
+	// channel is the one color channel, R, G or B, renders show as
+	// lightness in place of the mode's converter, or "" for none.
+	channel string
+
+	// ctx is done once the connection is, so that fetches made for it
+	// give up.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// terminal describes what the capability probe found out about the
+	// client's terminal; it's empty if there was no probe.
+	terminal string
+
+	// width is the number of columns renders are scaled to.
+	width int
+
+	// height is the number of rows renders are stretched to, with
+	// 'resize', or 0 for as many as the image's shape gives.
+	height int
+
+	// aspect is how many times taller than wide the client's terminal
+	// cells are, which sets how many rows an image of a given shape
+	// takes.
+	aspect float64
+
+	// adaptive_width narrows renders of tall images to keep them on one
+	// screen.
+	adaptive_width bool
+
+	// align places renders narrower than width: left, center or right.
+	align string
+
+	// trim crops white or transparent margins off images.
+	trim bool
+
+	// sampling is how images are scaled down, a name from scale.Filters.
+	sampling string
+
+	// raw_output turns off compacting renders, to see every cell's escapes.
+	raw_output bool
+
+	// throttle is the output rate asked for, in bytes a second, or 0 for
+	// full speed; pace is what keeps to it, or to the server's cap.
+	//
+	// pace.mu is also the session's write lock. Every send holds it for
+	// the whole write, so goroutines other than the session's own, like
+	// a broadcast or a game's, can send without their writes mixing.
+	throttle int
+	pace     pacer
+
+	// max_fps caps how many frames a second animations draw, or is 0 for
+	// no cap; frames is the token bucket that keeps to it.
+	max_fps float64
+	frames  *rate.Limiter
+
+	// user_agent is what fetches made for the session call themselves.
+	user_agent string
+
+	// last_render is the last image rendered or game board finished, for
+	// 'export'.
+	last_render string
+
+	// screensaver is how many minutes of quiet start the screensaver, or
+	// 0 for never, and screensaver_style which one it is.
+	screensaver       int
+	screensaver_style string
+
+	// auto_contrast stretches images to the full range from dark to
+	// light.
+	auto_contrast bool
+
+	// auto_palette picks the mode for each image pasted by how colorful
+	// it is.
+	auto_palette bool
+
+	// noise is the amplitude, in percent, of random noise added to each
+	// render.
+	noise int
+
+	// color_reduce is how many colors renders are quantized to, or 0 to
+	// leave them be.
+	color_reduce int
+
+	// outline is the edge strength, from 1 to 255, above which cells are
+	// drawn as outline rather than color; 0 turns it off.
+	outline int
+
+	// shadow is how many characters away a drop shadow falls, at
+	// shadow_angle degrees clockwise from the right; 0 turns it off.
+	shadow       int
+	shadow_angle int
+
+	// hue_rotate is how many degrees every pixel's hue is turned by.
+	hue_rotate int
+
+	// saturation is the percentage of their saturation pixels keep.
+	saturation int
+
+	// ycbcr_only is "luminance" or "chrominance" to draw just that side
+	// of images in color, or "" for both.
+	ycbcr_only string
+
+	// color_temp is the temperature, in kelvin, renders are corrected to,
+	// and temp_mult the channel multipliers worked out from it.
+	color_temp int
+	temp_mult  [3]float64
+
+	// background is what transparent images are drawn over, fetched from
+	// background_url; nil means they're drawn as they are.
+	background     *image.RGBA
+	background_url string
+
+	// palette_swaps recolor images before anything else is done to them.
+	palette_swaps []palette_swap
+
+	// border is the style of the border drawn round renders, "none" for
+	// none, in border_color, a hex color, or the terminal's own for "".
+	border       string
+	border_color string
+
+	// transparency_check draws a checkerboard behind transparent pixels,
+	// in place of the background image.
+	transparency_check bool
+
+	// clock puts the time over the top-right corner of every render.
+	clock bool
+
+	// watermark is drawn over the bottom-left corner of every render.
+	watermark string
+
+	// max_pixels is the most megapixels an image may have to be decoded.
+	max_pixels int
+
+	// decode_format is the format images are decoded as, or "" for
+	// whatever they look like.
+	decode_format string
+
+	// decode_timeout is the most seconds decoding an image may take.
+	decode_timeout int
+
+	// matrix_charset is the characters matrix rains.
+	matrix_charset string
+
+	// diff_threshold is how far apart, from 0 to 1, colors have to be for
+	// diff to show them as different.
+	diff_threshold float64
+
+	// scores holds the best score per game for this connection.
+	scores map[string]float64
+
+	// trivia_seen holds the trivia questions asked on this connection, by
+	// text, so they aren't asked again until the rest have been.
+	trivia_seen map[string]bool
+
+	// admin is set once the client has given the admin password.
+	admin bool
+
+	// nick is the name shown on leaderboards. Empty until set with "nick".
+	// registered is set when it's a registered nickname, logged in to;
+	// otherwise it's a guest's.
+	nick       string
+	registered bool
+
+	// last_url is the last image this connection asked for, for crash
+	// reports.
+	last_url string
+
+	// last_pgn is the record of the last chess game played.
+	last_pgn string
+
+	// live is the game this session's output is mirrored to, if any.
+	live atomic.Pointer[live_game]
+
+	// recording is where this session's output is being recorded, if
+	// anywhere. off_record is set while answering a command whose output
+	// is kept out of it.
+	recording  atomic.Pointer[recorder]
+	off_record atomic.Bool
+
+	// shared_settings is the session's settings as JSON, as they were
+	// when it last came back to the prompt. Other connections copy them
+	// from here; the fields themselves are only the session's own.
+	shared_settings atomic.Pointer[[]byte]
+
+	// notices are what's waiting to be told to the connection, and what
+	// it was told lately; notice_mu guards them. at_prompt is set while
+	// it's waiting for a command, when a notice can't get in the way.
+	notices   notice_box
+	notice_mu sync.Mutex
+	at_prompt atomic.Bool
+}
+
+func new_session(conn net.Conn) *session {
+	mode := "color"
+	if *lockMode != "" {
+		mode = *lockMode
+	}
+
+	input := &telnet_reader{r: conn}
+	sess := &session{
+		conn:              conn,
+		input:             input,
+		reader:            bufio.NewReader(input),
+		mode:              mode,
+		converter:         modes[mode],
+		width:             clamp_width(100),
+		aspect:            default_aspect,
+		align:             "left",
+		sampling:          "nearest",
+		border:            "none",
+		saturation:        100,
+		screensaver:       *screensaverMinutes,
+		screensaver_style: "clock",
+		diff_threshold:    default_diff_threshold,
+		max_pixels:        *maxPixels,
+		decode_timeout:    default_decode_timeout,
+		matrix_charset:    matrix_charsets["katakana"],
+		user_agent:        default_user_agent,
+		scores:            map[string]float64{},
+		notices:           notice_box{mode: "on", wake: make(chan struct{}, 1)},
+	}
+	sess.ctx, sess.cancel = context.WithCancel(context.Background())
+	sess.set_color_temp(neutral_color_temp)
+	sess.set_throttle(*throttleDefault)
+	return sess
+}
+
+// set_mode switches to one of the named modes, putting any channel
+// aside. It reports false, and leaves the mode alone, if the server has
+// locked it to another.
+func (s *session) set_mode(name string) bool {
+	if *lockMode != "" && name != *lockMode {
+		return false
+	}
+	s.mode = name
+	s.set_channel("")
+	return true
+}
+
+func (s *session) send(str string) error {
+	return s.send_by(str, time.Time{})
+}
+
+// send_by is send with a deadline for the write, for goroutines other
+// than the session's own that mustn't be held up by a client that has
+// stopped reading.
+func (s *session) send_by(str string, deadline time.Time) error {
+	if g := s.live.Load(); g != nil {
+		g.mirror(str)
+	}
+	if r := s.recording.Load(); r != nil && !s.off_record.Load() {
+		r.write(str)
+	}
+	return s.pace.write(s.conn, str, deadline)
+}
+
+// readLine returns the next line of input with surrounding whitespace
+// removed.
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	return strings.TrimSpace(line), err
+}
+
+// peekLatest reads a line, then keeps replacing it with the next one for
+// as long as each follows within timeout. Someone who sends a half-typed
+// URL and then the real one straight after only gets the last fetched.
+func (s *session) peekLatest(timeout time.Duration) (string, error) {
+	line, err := s.readLine()
+	// What follows "binary" is a file, not a newer line.
+	if err != nil || timeout <= 0 || line == "binary" {
+		return line, err
+	}
+
+	for range max_debounced {
+		if !s.line_within(timeout) {
+			break
+		}
+		if line, err = s.readLine(); err != nil {
+			return "", err
+		}
+	}
+	return line, nil
+}
+
+// line_within reports whether a whole line of input is buffered, or turns
+// up within d. Nothing is consumed.
+func (s *session) line_within(d time.Duration) bool {
+	s.conn.SetReadDeadline(time.Now().Add(d))
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	for {
+		buf, err := s.reader.Peek(s.reader.Buffered())
+		if bytes.IndexByte(buf, '\n') >= 0 {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+
+		// Block until at least one more byte arrives or time runs out.
+		if _, err := s.reader.Peek(s.reader.Buffered() + 1); err != nil {
+			return false
+		}
+	}
+}
+
+// discard_input throws away whole lines the client has already sent, for
+// games that ignore input while they are showing something.
+func (s *session) discard_input() {
+	for s.line_within(time.Millisecond) {
+		s.readLine()
+	}
+}
+
+// readKey returns the next single keypress. Arrow keys are translated to
+// 'w', 'a', 's' and 'd'; line endings are skipped so that line-buffered
+// clients work too.
+func (s *session) readKey() (rune, error) {
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case b == '\r' || b == '\n':
+			continue
+		case b == '\033':
+			next, err := s.reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if next != '[' && next != 'O' {
+				s.reader.UnreadByte()
+				return '\033', nil
+			}
+
+			final, err := s.reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if k, ok := arrows[final]; ok {
+				return k, nil
+			}
+			continue
+		case b < utf8.RuneSelf:
+			return unicode.ToLower(rune(b)), nil
+		}
+
+		s.reader.UnreadByte()
+		r, _, err := s.reader.ReadRune()
+		return r, err
+	}
+}
+
+// keypresses reads keys in the background so a game loop can select on
+// them alongside its timers. The channel is closed when the connection
+// goes away. stop must be called before anything else reads from the
+// session.
+func (s *session) keypresses() (<-chan rune, func()) {
+	return pump(s, s.readKey)
+}
+
+// lines is keypresses for games that take a line at a time.
+func (s *session) lines() (<-chan string, func()) {
+	return pump(s, s.readLine)
+}
+
+// pump runs read in a goroutine until the connection fails or the returned
+// stop function is called. stop unblocks a pending read with a deadline and
+// waits for the goroutine to finish, so no input is stolen from whatever
+// reads the session next.
+func pump[T any](s *session, read func() (T, error)) (<-chan T, func()) {
+	out := make(chan T, 16)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer close(out)
+
+		for {
+			v, err := read()
+			if err != nil {
+				return
+			}
+
+			select {
+			case out <- v:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		close(done)
+		s.conn.SetReadDeadline(time.Now())
+		<-finished
+		s.conn.SetReadDeadline(time.Time{})
+	}
+
+	return out, stop
+}
+
+// scores_command handles "scores".
+func scores_command(sess *session) string {
+	if len(sess.scores) == 0 {
+		return "No scores yet. Try 'play'.\n"
+	}
+
+	var names []string
+	for name := range sess.scores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%-10s %s\n", name, format_score(sess.scores[name]))
+	}
+	return b.String()
+}
+
+// nick_command handles "nick" and "nick NAME". A registered nickname
+// takes 'login' instead.
+func nick_command(sess *session, line string) string {
+	name := strings.TrimSpace(strings.TrimPrefix(line, "nick"))
+	if name == "" {
+		if sess.nick == "" {
+			return "No nickname set. Use 'nick NAME'.\n"
+		}
+		return fmt.Sprintf("You are %s.\n", sess.nick)
+	}
+
+	if !leaderboard.ValidNick(name) {
+		return "Nicknames are 1-16 letters, digits, '_' or '-'.\n"
+	}
+	if sess.registered && name == sess.nick {
+		return fmt.Sprintf("You are %s.\n", name)
+	}
+	if nicknames.Registered(name) {
+		return fmt.Sprintf("%s is registered; 'login %s PASSWORD' if it's yours.\n", name, name)
+	}
+	return take_nick(sess, name, false)
+}
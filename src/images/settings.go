@@ -0,0 +1,456 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+	"github.com/atalii/image-server-thing/internal/scale"
+)
+
+// saved_settings is the portable form of a session's configuration. Every
+// field is optional so a blob from an older server (or one that only
+// mentions some settings) changes only what it mentions, and fields this
+// server doesn't know are dropped by the decoder.
+type saved_settings struct {
+	Mode              *string  `json:"mode,omitempty"`
+	Channel           *string  `json:"channel,omitempty"`
+	Width             *int     `json:"width,omitempty"`
+	Height            *int     `json:"height,omitempty"`
+	AspectRatio       *float64 `json:"aspect_ratio,omitempty"`
+	AdaptiveWidth     *bool    `json:"adaptive_width,omitempty"`
+	Align             *string  `json:"align,omitempty"`
+	Trim              *bool    `json:"trim,omitempty"`
+	Sampling          *string  `json:"sampling,omitempty"`
+	AutoContrast      *bool    `json:"auto_contrast,omitempty"`
+	AutoPalette       *bool    `json:"auto_palette,omitempty"`
+	Noise             *int     `json:"noise,omitempty"`
+	ColorReduce       *int     `json:"color_reduce,omitempty"`
+	Outline           *int     `json:"outline,omitempty"`
+	Shadow            *int     `json:"shadow,omitempty"`
+	ShadowAngle       *int     `json:"shadow_angle,omitempty"`
+	ColorTemp         *int     `json:"color_temp,omitempty"`
+	HueRotate         *int     `json:"hue_rotate,omitempty"`
+	Saturation        *int     `json:"saturation,omitempty"`
+	YCbCrOnly         *string  `json:"ycbcr_only,omitempty"`
+	Border            *string  `json:"border,omitempty"`
+	BorderColor       *string  `json:"border_color,omitempty"`
+	Clock             *bool    `json:"clock,omitempty"`
+	TransparencyCheck *bool    `json:"transparency_check,omitempty"`
+	Watermark         *string  `json:"watermark,omitempty"`
+	DiffThreshold     *float64 `json:"diff_threshold,omitempty"`
+	MaxPixels         *int     `json:"max_pixels,omitempty"`
+	DecodeFormat      *string  `json:"decode_format,omitempty"`
+	DecodeTimeout     *int     `json:"decode_timeout,omitempty"`
+	MatrixCharset     *string  `json:"matrix_charset,omitempty"`
+	UserAgent         *string  `json:"user_agent,omitempty"`
+	Throttle          *int     `json:"throttle,omitempty"`
+	MaxFPS            *float64 `json:"max_fps,omitempty"`
+	Screensaver       *int     `json:"screensaver,omitempty"`
+	ScreensaverStyle  *string  `json:"screensaver_style,omitempty"`
+}
+
+// session_settings is everything about sess that save-settings keeps.
+func session_settings(sess *session) saved_settings {
+	return saved_settings{
+		Mode:              &sess.mode,
+		Channel:           &sess.channel,
+		Width:             &sess.width,
+		Height:            &sess.height,
+		AspectRatio:       &sess.aspect,
+		AdaptiveWidth:     &sess.adaptive_width,
+		Align:             &sess.align,
+		Trim:              &sess.trim,
+		Sampling:          &sess.sampling,
+		AutoContrast:      &sess.auto_contrast,
+		AutoPalette:       &sess.auto_palette,
+		Noise:             &sess.noise,
+		ColorReduce:       &sess.color_reduce,
+		Outline:           &sess.outline,
+		Shadow:            &sess.shadow,
+		ShadowAngle:       &sess.shadow_angle,
+		ColorTemp:         &sess.color_temp,
+		HueRotate:         &sess.hue_rotate,
+		Saturation:        &sess.saturation,
+		YCbCrOnly:         &sess.ycbcr_only,
+		Border:            &sess.border,
+		BorderColor:       &sess.border_color,
+		Clock:             &sess.clock,
+		TransparencyCheck: &sess.transparency_check,
+		Watermark:         &sess.watermark,
+		DiffThreshold:     &sess.diff_threshold,
+		MaxPixels:         &sess.max_pixels,
+		DecodeFormat:      &sess.decode_format,
+		DecodeTimeout:     &sess.decode_timeout,
+		MatrixCharset:     &sess.matrix_charset,
+		UserAgent:         &sess.user_agent,
+		Throttle:          &sess.throttle,
+		MaxFPS:            &sess.max_fps,
+		Screensaver:       &sess.screensaver,
+		ScreensaverStyle:  &sess.screensaver_style,
+	}
+}
+
+// save_settings handles "save-settings".
+func save_settings(sess *session) string {
+	data, err := json.Marshal(session_settings(sess))
+	if err != nil {
+		return fmt.Sprintf("Couldn't save settings: %v\n", err)
+	}
+
+	blob := base64.RawURLEncoding.EncodeToString(data)
+	return fmt.Sprintf("Settings: %s\nPaste 'load-settings %s' to restore them.\n", blob, blob)
+}
+
+// load_settings handles "load-settings BLOB". The blob is checked in full
+// before anything is applied, so a bad one leaves the session untouched.
+func load_settings(sess *session, blob string) string {
+	blob = strings.TrimSpace(blob)
+	if blob == "" {
+		return "Usage: load-settings BLOB (from save-settings)\n"
+	}
+
+	s, msg := decode_settings(blob)
+	if msg != "" {
+		return msg
+	}
+	return apply_settings(sess, s)
+}
+
+// share_settings publishes sess's settings for copy-settings. Only the
+// session's own goroutine may call it.
+func share_settings(sess *session) {
+	data, err := json.Marshal(session_settings(sess))
+	if err == nil {
+		sess.shared_settings.Store(&data)
+	}
+}
+
+// copy_settings_command handles "copy-settings CONN-ID", which loads the
+// settings of another open connection as if from its save-settings. They
+// come from the copy that connection last shared, as its own fields are
+// changed by its goroutine without a lock.
+func copy_settings_command(sess *session, line string) string {
+	id, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "copy-settings")), 10, 64)
+	if err != nil {
+		return "Usage: copy-settings CONN-ID\n"
+	}
+
+	connected.Lock()
+	from, ok := connected.all[id]
+	var data *[]byte
+	if ok {
+		data = from.shared_settings.Load()
+	}
+	connected.Unlock()
+	if !ok {
+		return fmt.Sprintf("Nobody connected is %d.\n", id)
+	}
+	if data == nil {
+		return fmt.Sprintf("Session %d hasn't got as far as its settings yet.\n", id)
+	}
+
+	var s saved_settings
+	if err := json.Unmarshal(*data, &s); err != nil {
+		return fmt.Sprintf("Couldn't copy settings: %v\n", err)
+	}
+	if msg := apply_settings(sess, s); msg != "Settings loaded.\n" {
+		return msg
+	}
+	return fmt.Sprintf("Settings copied from session %d.\n", id)
+}
+
+// decode_settings reads a blob from save-settings, or says what's wrong
+// with it.
+func decode_settings(blob string) (saved_settings, string) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(blob, "="))
+	if err != nil {
+		return saved_settings{}, "That isn't a settings blob: it should be copied whole from save-settings.\n"
+	}
+
+	var s saved_settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return saved_settings{}, "That settings blob is corrupt.\n"
+	}
+	return s, ""
+}
+
+// apply_settings checks s in full, then applies it to sess, and says how
+// that went.
+func apply_settings(sess *session, s saved_settings) string {
+	if s.Mode != nil {
+		if _, ok := modes[*s.Mode]; !ok {
+			return fmt.Sprintf("Settings not loaded: unknown mode %q.\n", *s.Mode)
+		}
+	}
+	if s.Align != nil && !aligns[*s.Align] {
+		return fmt.Sprintf("Settings not loaded: unknown alignment %q.\n", *s.Align)
+	}
+	if s.Sampling != nil && scale.Filters[*s.Sampling] == nil {
+		return fmt.Sprintf("Settings not loaded: unknown sampling %q.\n", *s.Sampling)
+	}
+	if s.Height != nil && (*s.Height < 0 || *s.Height > max_resize_rows) {
+		return fmt.Sprintf("Settings not loaded: height %d is outside 0-%d.\n", *s.Height, max_resize_rows)
+	}
+	if s.AspectRatio != nil && !(*s.AspectRatio >= min_aspect && *s.AspectRatio <= max_aspect) {
+		return fmt.Sprintf("Settings not loaded: aspect ratio %g is outside %g-%g.\n", *s.AspectRatio, min_aspect, max_aspect)
+	}
+	if s.Border != nil && *s.Border != "none" && border_styles[*s.Border] == (border_style{}) {
+		return fmt.Sprintf("Settings not loaded: unknown border %q.\n", *s.Border)
+	}
+	if s.BorderColor != nil {
+		if _, ok := parse_border_color(*s.BorderColor); !ok {
+			return fmt.Sprintf("Settings not loaded: border color %q isn't #RRGGBB.\n", *s.BorderColor)
+		}
+	}
+	if s.Noise != nil && (*s.Noise < 0 || *s.Noise > 100) {
+		return fmt.Sprintf("Settings not loaded: noise %d is outside 0-100.\n", *s.Noise)
+	}
+	if s.ColorReduce != nil && *s.ColorReduce != 0 && (*s.ColorReduce < min_color_reduce || *s.ColorReduce > max_color_reduce) {
+		return fmt.Sprintf("Settings not loaded: color reduce to %d colors is outside %d-%d.\n", *s.ColorReduce, min_color_reduce, max_color_reduce)
+	}
+	if s.Outline != nil && (*s.Outline < 0 || *s.Outline > 255) {
+		return fmt.Sprintf("Settings not loaded: outline %d is outside 0-255.\n", *s.Outline)
+	}
+	if s.Shadow != nil && (*s.Shadow < 0 || *s.Shadow > max_shadow) {
+		return fmt.Sprintf("Settings not loaded: shadow %d is outside 0-%d.\n", *s.Shadow, max_shadow)
+	}
+	if s.ShadowAngle != nil && (*s.ShadowAngle < 0 || *s.ShadowAngle >= 360) {
+		return fmt.Sprintf("Settings not loaded: shadow angle %d is outside 0-359.\n", *s.ShadowAngle)
+	}
+	if s.HueRotate != nil && (*s.HueRotate < 0 || *s.HueRotate > 359) {
+		return fmt.Sprintf("Settings not loaded: hue rotation %d° is outside 0-359.\n", *s.HueRotate)
+	}
+	if s.Saturation != nil && (*s.Saturation < 0 || *s.Saturation > max_saturation) {
+		return fmt.Sprintf("Settings not loaded: saturation %d%% is outside 0-%d.\n", *s.Saturation, max_saturation)
+	}
+	if s.YCbCrOnly != nil && *s.YCbCrOnly != "" && *s.YCbCrOnly != "luminance" && *s.YCbCrOnly != "chrominance" {
+		return fmt.Sprintf("Settings not loaded: unknown YCbCr view %q.\n", *s.YCbCrOnly)
+	}
+	if s.ColorTemp != nil && (*s.ColorTemp < min_color_temp || *s.ColorTemp > max_color_temp) {
+		return fmt.Sprintf("Settings not loaded: color temperature %dK is outside %d-%d.\n", *s.ColorTemp, min_color_temp, max_color_temp)
+	}
+	if s.DiffThreshold != nil && (*s.DiffThreshold < 0 || *s.DiffThreshold > 1) {
+		return fmt.Sprintf("Settings not loaded: diff threshold %.2f is outside 0-1.\n", *s.DiffThreshold)
+	}
+	if s.MaxPixels != nil && (*s.MaxPixels < 1 || *s.MaxPixels > max_pixels_ceiling) {
+		return fmt.Sprintf("Settings not loaded: max pixels %d MP is outside 1-%d.\n", *s.MaxPixels, max_pixels_ceiling)
+	}
+	if s.DecodeFormat != nil && *s.DecodeFormat != "" && !slices.Contains(fetch.Formats(), *s.DecodeFormat) {
+		return fmt.Sprintf("Settings not loaded: unknown decode format %q.\n", *s.DecodeFormat)
+	}
+	if s.DecodeTimeout != nil && (*s.DecodeTimeout < 1 || *s.DecodeTimeout > max_decode_timeout) {
+		return fmt.Sprintf("Settings not loaded: decode timeout %ds is outside 1-%d.\n", *s.DecodeTimeout, max_decode_timeout)
+	}
+	if s.MatrixCharset != nil && !valid_matrix_charset(*s.MatrixCharset) {
+		return "Settings not loaded: the matrix charset isn't one matrix can rain.\n"
+	}
+	if s.UserAgent != nil && !valid_user_agent(*s.UserAgent) {
+		return "Settings not loaded: the User-Agent isn't one that can be sent.\n"
+	}
+	if s.Throttle != nil && *s.Throttle != 0 && (*s.Throttle < min_throttle || *s.Throttle > max_throttle) {
+		return fmt.Sprintf("Settings not loaded: throttle %d bytes a second is outside %d-%d.\n", *s.Throttle, min_throttle, max_throttle)
+	}
+	if s.MaxFPS != nil && !valid_max_fps(*s.MaxFPS) {
+		return fmt.Sprintf("Settings not loaded: max FPS %g is outside %g-%d.\n", *s.MaxFPS, min_max_fps, max_max_fps)
+	}
+	if s.Screensaver != nil && (*s.Screensaver < 0 || *s.Screensaver > screensaver_max_minutes) {
+		return fmt.Sprintf("Settings not loaded: screensaver after %d minutes is outside 0-%d.\n", *s.Screensaver, screensaver_max_minutes)
+	}
+	if s.Channel != nil && *s.Channel != "" && channels[*s.Channel] == nil {
+		return fmt.Sprintf("Settings not loaded: unknown channel %q.\n", *s.Channel)
+	}
+	if s.ScreensaverStyle != nil && screensavers[*s.ScreensaverStyle] == nil {
+		return fmt.Sprintf("Settings not loaded: unknown screensaver %q.\n", *s.ScreensaverStyle)
+	}
+
+	// A locked mode isn't an error; everything else still applies.
+	locked := s.Mode != nil && !sess.set_mode(*s.Mode)
+	if s.Channel != nil && !sess.set_channel(*s.Channel) {
+		locked = true
+	}
+	if s.Width != nil {
+		sess.width = clamp_width(*s.Width)
+	}
+	if s.Height != nil {
+		sess.height = *s.Height
+	}
+	if s.AspectRatio != nil {
+		sess.aspect = *s.AspectRatio
+	}
+	if s.AdaptiveWidth != nil {
+		sess.adaptive_width = *s.AdaptiveWidth
+	}
+	if s.Align != nil {
+		sess.align = *s.Align
+	}
+	if s.Trim != nil {
+		sess.trim = *s.Trim
+	}
+	if s.Sampling != nil {
+		sess.sampling = *s.Sampling
+	}
+	if s.AutoContrast != nil {
+		sess.auto_contrast = *s.AutoContrast
+	}
+	if s.AutoPalette != nil {
+		sess.auto_palette = *s.AutoPalette
+	}
+	if s.Noise != nil {
+		sess.noise = *s.Noise
+	}
+	if s.ColorReduce != nil {
+		sess.color_reduce = *s.ColorReduce
+	}
+	if s.Outline != nil {
+		sess.outline = *s.Outline
+	}
+	if s.Shadow != nil {
+		sess.shadow = *s.Shadow
+	}
+	if s.ShadowAngle != nil {
+		sess.shadow_angle = *s.ShadowAngle
+	}
+	if s.ColorTemp != nil {
+		sess.set_color_temp(*s.ColorTemp)
+	}
+	if s.HueRotate != nil {
+		sess.hue_rotate = *s.HueRotate
+	}
+	if s.Saturation != nil {
+		sess.saturation = *s.Saturation
+	}
+	if s.YCbCrOnly != nil {
+		sess.ycbcr_only = *s.YCbCrOnly
+	}
+	if s.Border != nil {
+		sess.border = *s.Border
+	}
+	if s.BorderColor != nil {
+		sess.border_color, _ = parse_border_color(*s.BorderColor)
+	}
+	if s.TransparencyCheck != nil {
+		sess.transparency_check = *s.TransparencyCheck
+	}
+	if s.Clock != nil {
+		sess.clock = *s.Clock
+	}
+	if s.Watermark != nil {
+		sess.watermark = clean_watermark(*s.Watermark)
+	}
+	if s.DiffThreshold != nil {
+		sess.diff_threshold = *s.DiffThreshold
+	}
+	if s.MaxPixels != nil {
+		sess.max_pixels = *s.MaxPixels
+	}
+	if s.DecodeFormat != nil {
+		sess.decode_format = *s.DecodeFormat
+	}
+	if s.DecodeTimeout != nil {
+		sess.decode_timeout = *s.DecodeTimeout
+	}
+	if s.MatrixCharset != nil {
+		sess.matrix_charset = *s.MatrixCharset
+	}
+	if s.UserAgent != nil {
+		sess.user_agent = *s.UserAgent
+	}
+	if s.Throttle != nil {
+		sess.set_throttle(*s.Throttle)
+	}
+	if s.MaxFPS != nil {
+		sess.set_max_fps(*s.MaxFPS)
+	}
+	if s.Screensaver != nil {
+		sess.screensaver = *s.Screensaver
+	}
+	if s.ScreensaverStyle != nil {
+		sess.screensaver_style = *s.ScreensaverStyle
+	}
+
+	if s.Width != nil && sess.width != *s.Width {
+		return fmt.Sprintf("Settings loaded, but width %d was clamped to %d %s.\n", *s.Width, sess.width, width_limits())
+	}
+	if locked {
+		return "Settings loaded, except the mode: " + mode_locked
+	}
+	return "Settings loaded.\n"
+}
+
+// status_command handles "status".
+func status_command(sess *session) string {
+	mode := sess.mode
+	if *lockMode != "" {
+		mode += " (locked)"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Connection: %d (for copy-settings)\n", sess.id)
+	fmt.Fprintf(&b, "Mode: %s\n", mode)
+	fmt.Fprintf(&b, "Channel: %s\n", channel_status(sess))
+	if sess.terminal != "" {
+		fmt.Fprintf(&b, "Terminal: %s\n", sess.terminal)
+	}
+	fmt.Fprintf(&b, "Width: %d %s\n", sess.width, width_limits())
+	fmt.Fprintf(&b, "Size: %s\n", resize_status(sess))
+	fmt.Fprintf(&b, "Aspect ratio: %s\n", aspect_status(sess))
+	fmt.Fprintf(&b, "Adaptive width: %s\n", on_off(sess.adaptive_width))
+	fmt.Fprintf(&b, "Align: %s\n", sess.align)
+	fmt.Fprintf(&b, "Trim: %s\n", on_off(sess.trim))
+	fmt.Fprintf(&b, "Sampling: %s\n", sess.sampling)
+	fmt.Fprintf(&b, "Auto contrast: %s\n", on_off(sess.auto_contrast))
+	fmt.Fprintf(&b, "Auto palette: %s\n", on_off(sess.auto_palette))
+	fmt.Fprintf(&b, "Noise: %d%%\n", sess.noise)
+	fmt.Fprintf(&b, "Color reduce: %s\n", color_reduce_status(sess))
+	fmt.Fprintf(&b, "Outline: %d\n", sess.outline)
+	fmt.Fprintf(&b, "Shadow: %s\n", shadow_status(sess))
+	fmt.Fprintf(&b, "Color temperature: %dK\n", sess.color_temp)
+	fmt.Fprintf(&b, "Hue rotate: %d°\n", sess.hue_rotate)
+	fmt.Fprintf(&b, "Saturation: %d%%\n", sess.saturation)
+	fmt.Fprintf(&b, "Luminance and chrominance: %s\n", ycbcr_status(sess))
+	fmt.Fprintf(&b, "Border: %s\n", border_status(sess))
+	fmt.Fprintf(&b, "Clock: %s\n", on_off(sess.clock))
+	fmt.Fprintf(&b, "Transparency check: %s\n", on_off(sess.transparency_check))
+	fmt.Fprintf(&b, "Diff threshold: %.2f\n", sess.diff_threshold)
+	fmt.Fprintf(&b, "Max pixels: %d MP\n", sess.max_pixels)
+	fmt.Fprintf(&b, "Decode format: %s\n", decode_format_status(sess))
+	fmt.Fprintf(&b, "Decode timeout: %ds\n", sess.decode_timeout)
+	fmt.Fprintf(&b, "Matrix charset: %s\n", matrix_charset_status(sess))
+	fmt.Fprintf(&b, "User-Agent: %s\n", sess.user_agent)
+	fmt.Fprintf(&b, "Throttle: %s\n", throttle_status(sess))
+	fmt.Fprintf(&b, "Max FPS: %s\n", max_fps_status(sess))
+	fmt.Fprintf(&b, "Screensaver: %s\n", screensaver_status(sess))
+	fmt.Fprintf(&b, "Notices: %s\n", notify_status(sess))
+	if sess.raw_output {
+		b.WriteString("Raw output: on\n")
+	}
+	if n := len(sess.palette_swaps); n > 0 {
+		fmt.Fprintf(&b, "Palette swaps: %d ('palette-swap' lists them)\n", n)
+	}
+	if sess.background != nil {
+		fmt.Fprintf(&b, "Background image: %s\n", sess.background_url)
+	}
+	if sess.watermark != "" {
+		fmt.Fprintf(&b, "Watermark: %s\n", sess.watermark)
+	}
+	if sess.nick != "" {
+		fmt.Fprintf(&b, "Nick: %s", sess.nick)
+		if !sess.registered {
+			b.WriteString(" (guest)")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func on_off(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
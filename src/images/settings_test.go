@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCopySettingsShared(t *testing.T) {
+	from, to := test_session(t), test_session(t)
+	from.id, to.id = 1001, 1002
+	defer track_session(from)()
+	defer track_session(to)()
+
+	line := fmt.Sprintf("copy-settings %d", from.id)
+	if got := copy_settings_command(to, line); got == "Settings copied from session 1001.\n" {
+		t.Error("copied settings that were never shared")
+	}
+
+	from.width = 42
+	share_settings(from)
+
+	// Changed since, but not shared: copying mustn't see it.
+	done := make(chan struct{})
+	go func() {
+		for i := range 1000 {
+			from.width = 43 + i%10
+		}
+		close(done)
+	}()
+	got := copy_settings_command(to, line)
+	<-done
+
+	if got != "Settings copied from session 1001.\n" || to.width != 42 {
+		t.Errorf("copy-settings said %q, width %d, want 42", got, to.width)
+	}
+}
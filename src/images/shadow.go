@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const max_shadow = 16
+
+// shadow_ink is what shadow cells are drawn from, handed to the
+// session's converter as outline_ink is, so the shadow is a dim gray in
+// whatever way the mode draws gray. It's as dark as gray goes and still
+// shows in bw.
+var shadow_ink = image.NewUniform(color.Gray{0x80})
+
+// shadow_offset is how many columns right and rows down the shadow falls
+// for sess. Rows count half, as cells are twice as tall as they are
+// wide, so a shadow at 45 degrees looks like one.
+func shadow_offset(sess *session) (dx, dy int) {
+	rad := float64(sess.shadow_angle) * math.Pi / 180
+	dx = int(math.Round(float64(sess.shadow) * math.Cos(rad)))
+	dy = int(math.Round(float64(sess.shadow) * math.Sin(rad) / 2))
+	return dx, dy
+}
+
+// draw_shadow returns rows on a canvas grown to fit their shadow, cast by
+// shadow_offset. The shadow is drawn first and the render on top, so it
+// only shows where the render doesn't cover it: past its edges, and
+// where the image is transparent. at is the pixel each cell samples.
+func draw_shadow(rows [][]string, img image.Image, at func(x, y int) image.Point, sess *session) [][]string {
+	if len(rows) == 0 {
+		return rows
+	}
+	height, width := len(rows), len(rows[0])
+	dx, dy := shadow_offset(sess)
+
+	// The render moves right and down when the shadow falls left or up of
+	// it.
+	ox, oy := max(-dx, 0), max(-dy, 0)
+	sx, sy := max(dx, 0), max(dy, 0)
+
+	opaque := make([][]bool, height)
+	for y := range height {
+		opaque[y] = make([]bool, width)
+		for x := range width {
+			p := at(x, y)
+			_, _, _, a := img.At(p.X, p.Y).RGBA()
+			opaque[y][x] = a >= 0x8000
+		}
+	}
+
+	out := make([][]string, height+abs(dy))
+	for y := range out {
+		out[y] = make([]string, width+abs(dx))
+		for x := range out[y] {
+			out[y][x] = " "
+		}
+	}
+
+	ink := sess.converter(shadow_ink, 0, 0)
+	for y := range height {
+		for x := range width {
+			if opaque[y][x] {
+				out[y+sy][x+sx] = ink
+			}
+		}
+	}
+	for y := range height {
+		for x := range width {
+			if opaque[y][x] || out[y+oy][x+ox] == " " {
+				out[y+oy][x+ox] = rows[y][x]
+			}
+		}
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func shadow_status(sess *session) string {
+	if sess.shadow == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("%d at %d°", sess.shadow, sess.shadow_angle)
+}
+
+// shadow_command handles "shadow N ANGLE", which casts a drop shadow N
+// characters away at ANGLE degrees, 0 to the right and 90 down, and
+// "shadow off".
+func shadow_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "shadow"))
+	switch {
+	case len(args) == 0:
+		return "Shadow: " + shadow_status(sess) + "\n"
+	case len(args) == 1 && args[0] == "off":
+		sess.shadow = 0
+		return "Shadow off.\n"
+	}
+
+	usage := fmt.Sprintf("Usage: shadow N ANGLE, where N is 1 to %d characters and ANGLE is in degrees, 0 right and 90 down; or shadow off.\n", max_shadow)
+	if len(args) != 2 {
+		return usage
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > max_shadow {
+		return usage
+	}
+	angle, err := strconv.Atoi(args[1])
+	if err != nil {
+		return usage
+	}
+
+	sess.shadow, sess.shadow_angle = n, (angle%360+360)%360
+	return "Shadow: " + shadow_status(sess) + ".\n"
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	slideshow_host_help   = "Paste URLs to queue them. next, prev, auto SECONDS (0 stops it), say TEXT, stop ends the show, q leaves."
+	slideshow_viewer_help = "say TEXT to comment, q to leave."
+
+	slideshow_min_auto = 2
+	slideshow_max_auto = 600
+
+	// Only the last few comments stay on screen.
+	slideshow_chat_lines = 5
+	slideshow_say_max    = 200
+)
+
+// There is one slideshow room. Like the canvas, it's owned by a single
+// goroutine, and the viewers' connections only pass it their lines.
+var slideshow_room = struct {
+	start  sync.Once
+	joins  chan *slideshow_viewer
+	events chan slideshow_event
+}{
+	joins:  make(chan *slideshow_viewer),
+	events: make(chan slideshow_event),
+}
+
+type slideshow_event struct {
+	v    *slideshow_viewer
+	line string
+	gone bool
+
+	// loaded is a slide that finished downloading, with what came of it.
+	loaded *slide
+	img    image.Image
+	err    error
+
+	// tick is set when the auto-advance timer of that generation fires.
+	tick int
+
+	// redraw is a viewer whose screen was held back by their maxfps,
+	// due now.
+	redraw *slideshow_viewer
+}
+
+type slideshow_viewer struct {
+	id   int
+	sess *session
+
+	// hosting is set for the viewer who starts the show.
+	hosting bool
+
+	// frame is the current slide as rendered for this viewer, kept so a
+	// new comment doesn't mean rendering it again.
+	frame  string
+	status string
+
+	// held is set while a redraw held back by maxfps is waiting.
+	held bool
+
+	left chan string
+}
+
+// A slide is fetched at most once, when it's shown or about to be.
+type slide struct {
+	url      string
+	fetching bool
+	done     bool
+	img      image.Image
+	err      error
+}
+
+type slideshow_state struct {
+	viewers map[*slideshow_viewer]bool
+	next_id int
+
+	// host is nil after the host leaves, until someone takes over.
+	host *slideshow_viewer
+
+	slides []*slide
+	at     int
+
+	auto  time.Duration
+	timer *time.Timer
+	gen   int
+
+	chat []string
+}
+
+// slideshow_command handles "slideshow start" and "slideshow join".
+func slideshow_command(sess *session, line string) (string, error) {
+	arg := strings.TrimSpace(strings.TrimPrefix(line, "slideshow"))
+	if arg != "start" && arg != "join" {
+		return "Usage: slideshow start (to host one) or slideshow join (to watch).\n", nil
+	}
+
+	slideshow_room.start.Do(func() { go run_slideshow() })
+
+	v := &slideshow_viewer{sess: sess, hosting: arg == "start", left: make(chan string, 1)}
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	sess.send(clearScreen)
+	defer sess.send(resetAttrs + showCursor)
+
+	slideshow_room.joins <- v
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				slideshow_room.events <- slideshow_event{v: v, gone: true}
+				<-v.left
+				return "", io.EOF
+			}
+			slideshow_room.events <- slideshow_event{v: v, line: line}
+		case msg := <-v.left:
+			return msg, nil
+		}
+	}
+}
+
+func run_slideshow() {
+	st := &slideshow_state{viewers: map[*slideshow_viewer]bool{}, at: -1}
+
+	for {
+		select {
+		case v := <-slideshow_room.joins:
+			st.join(v)
+		case ev := <-slideshow_room.events:
+			switch {
+			case ev.loaded != nil:
+				st.loaded(ev)
+			case ev.tick != 0:
+				if ev.tick == st.gen {
+					st.advance()
+				}
+			case ev.redraw != nil:
+				ev.redraw.held = false
+				if st.viewers[ev.redraw] && !st.draw_one(ev.redraw, st.header()) {
+					st.leave(ev.redraw, slideshow_stuck)
+				}
+			case !st.viewers[ev.v]:
+			case ev.gone || ev.line == "q":
+				st.leave(ev.v, "Left the slideshow.\n")
+			default:
+				st.command(ev.v, strings.TrimSpace(ev.line))
+				st.draw()
+			}
+		}
+	}
+}
+
+func (st *slideshow_state) join(v *slideshow_viewer) {
+	switch {
+	case v.hosting && len(st.viewers) > 0:
+		v.left <- "A slideshow is already running. Try 'slideshow join'.\n"
+		return
+	case !v.hosting && len(st.viewers) == 0:
+		v.left <- "No slideshow is running. 'slideshow start' begins one.\n"
+		return
+	}
+
+	st.next_id++
+	v.id = st.next_id
+	st.viewers[v] = true
+	if v.hosting {
+		st.host = v
+		v.status = "You're hosting. " + slideshow_host_help
+	} else {
+		st.announce(v, "%s joined.", player_name(v.sess, "Someone"))
+		v.status = slideshow_viewer_help
+		if st.at >= 0 {
+			st.render(v)
+		}
+	}
+	st.draw()
+}
+
+// leave sends v off with msg. Once everyone has gone the show is over,
+// and the next one starts from scratch.
+func (st *slideshow_state) leave(v *slideshow_viewer, msg string) {
+	delete(st.viewers, v)
+	v.left <- msg
+
+	if len(st.viewers) == 0 {
+		st.reset()
+		return
+	}
+
+	name := player_name(v.sess, "Someone")
+	if v == st.host {
+		st.host = nil
+		st.announce(nil, "%s, the host, left. Type 'host' to take over the show.", name)
+	} else {
+		st.announce(nil, "%s left.", name)
+	}
+	st.draw()
+}
+
+// end sends everyone off, as the host asked.
+func (st *slideshow_state) end(by *slideshow_viewer) {
+	for v := range st.viewers {
+		if v == by {
+			v.left <- "Slideshow over.\n"
+		} else {
+			v.left <- "The host ended the slideshow.\n"
+		}
+		delete(st.viewers, v)
+	}
+	st.reset()
+}
+
+// reset clears the room for the next show. Slides still downloading are
+// dropped when they arrive, and the generation carries on so the last
+// show's timer can't fire into the next.
+func (st *slideshow_state) reset() {
+	st.set_auto(0)
+	*st = slideshow_state{viewers: st.viewers, next_id: st.next_id, gen: st.gen, at: -1}
+}
+
+// announce puts a message on everyone's status line but v's.
+func (st *slideshow_state) announce(v *slideshow_viewer, format string, args ...any) {
+	for w := range st.viewers {
+		if w != v {
+			w.status = fmt.Sprintf(format, args...)
+		}
+	}
+}
+
+// command carries out one line from v. Anything from the host that isn't
+// a command is taken as a URL to queue.
+func (st *slideshow_state) command(v *slideshow_viewer, line string) {
+	f := strings.Fields(line)
+	is_host := v == st.host
+	v.status = ""
+
+	switch {
+	case len(f) == 0:
+		return
+	case f[0] == "say":
+		text := clean_say(strings.TrimSpace(strings.TrimPrefix(line, "say")))
+		if text == "" {
+			v.status = "Usage: say TEXT"
+			return
+		}
+		st.chat = append(st.chat, player_name(v.sess, "guest")+": "+text)
+		prefetch_mentions(text)
+		st.chat = st.chat[max(len(st.chat)-slideshow_chat_lines, 0):]
+	case line == "host" && st.host == nil:
+		st.host = v
+		v.status = "You're hosting now. " + slideshow_host_help
+		st.announce(v, "%s is hosting now.", player_name(v.sess, "Someone"))
+	case line == "host" && is_host:
+		v.status = "You're already hosting."
+	case line == "host":
+		v.status = player_name(st.host.sess, "Someone else") + " is hosting."
+	case !is_host:
+		v.status = "Only the host can change slides. " + slideshow_viewer_help
+	case line == "next":
+		if st.at+1 >= len(st.slides) {
+			v.status = "That's the last slide; paste a URL to add another."
+			return
+		}
+		st.show(st.at + 1)
+	case line == "prev":
+		if st.at <= 0 {
+			v.status = "That's the first slide."
+			return
+		}
+		st.show(st.at - 1)
+	case f[0] == "auto" && len(f) == 2:
+		n, err := strconv.Atoi(f[1])
+		if err != nil || n != 0 && (n < slideshow_min_auto || n > slideshow_max_auto) {
+			v.status = fmt.Sprintf("Usage: auto SECONDS, from %d to %d, or 0 to stop.", slideshow_min_auto, slideshow_max_auto)
+			return
+		}
+		st.set_auto(time.Duration(n) * time.Second)
+	case line == "stop":
+		st.end(v)
+	case len(f) == 1:
+		st.slides = append(st.slides, &slide{url: line})
+		v.status = fmt.Sprintf("Queued as slide %d.", len(st.slides))
+		if st.at < 0 {
+			st.show(0)
+		} else if len(st.slides)-1 == st.at+1 {
+			st.fetch(st.at + 1)
+		} else {
+			prefetch_url(line)
+		}
+	default:
+		v.status = "Unknown command. " + slideshow_host_help
+	}
+}
+
+// clean_say keeps a comment to one line that's safe to show everyone.
+func clean_say(text string) string {
+	return usertext.Truncate(usertext.Clean(text), slideshow_say_max)
+}
+
+// show moves to slide i, and starts fetching the one after it so it's
+// ready by the time it's wanted.
+func (st *slideshow_state) show(i int) {
+	st.at = i
+	st.fetch(i)
+	if i+1 < len(st.slides) {
+		st.fetch(i + 1)
+	}
+	for v := range st.viewers {
+		st.render(v)
+	}
+	if st.auto > 0 {
+		st.set_auto(st.auto)
+	}
+}
+
+// advance is auto-advance's next slide. At the end of the queue it waits
+// for the host to add more.
+func (st *slideshow_state) advance() {
+	if st.at+1 < len(st.slides) {
+		st.show(st.at + 1)
+		st.draw()
+		return
+	}
+	st.set_auto(st.auto)
+}
+
+// set_auto restarts the auto-advance timer, or stops it for 0. A timer
+// that fires after it was replaced is told apart by its generation.
+func (st *slideshow_state) set_auto(d time.Duration) {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.gen++
+	st.auto = d
+	if d == 0 {
+		return
+	}
+
+	gen := st.gen
+	st.timer = time.AfterFunc(d, func() { slideshow_room.events <- slideshow_event{tick: gen} })
+}
+
+// fetch starts downloading slide i, within the host's pixel limit. The
+// result comes back to the room as an event.
+func (st *slideshow_state) fetch(i int) {
+	s := st.slides[i]
+	if s.fetching {
+		return
+	}
+	s.fetching = true
+
+	var host *session
+	limit := *maxPixels
+	if st.host != nil {
+		host, limit = st.host.sess, st.host.sess.max_pixels
+	}
+	go func() {
+		img, err := fetch_image(host, s.url, limit)
+		slideshow_room.events <- slideshow_event{loaded: s, img: img, err: err}
+	}()
+}
+
+func (st *slideshow_state) loaded(ev slideshow_event) {
+	s := ev.loaded
+	s.done, s.img, s.err = true, ev.img, ev.err
+	if st.at >= 0 && st.at < len(st.slides) && st.slides[st.at] == s {
+		for v := range st.viewers {
+			st.render(v)
+		}
+		st.draw()
+	}
+}
+
+// render draws the current slide for v with v's own settings.
+func (st *slideshow_state) render(v *slideshow_viewer) {
+	s := st.slides[st.at]
+	switch {
+	case !s.done:
+		v.frame = "Loading " + s.url + "...\n"
+	case s.err != nil:
+		v.frame = fmt.Sprintf("Couldn't load %s: %v.\n", s.url, s.err)
+	default:
+		b := s.img.Bounds()
+		if fetch.OverLimit(b.Dx(), b.Dy(), v.sess.max_pixels) {
+			big := &fetch.TooLargeError{Width: b.Dx(), Height: b.Dy(), Limit: v.sess.max_pixels}
+			v.frame = "Not shown here: the image is " + big.Size() + ".\n"
+			return
+		}
+		stats.rendered.Add(1)
+		v.frame = compress(preprocess(s.img, v.sess), 1, v.sess)
+	}
+}
+
+// draw sends every viewer their screen: a header, the slide, the latest
+// comments and their status line.
+func (st *slideshow_state) draw() {
+	// Viewers are drawn in the order they joined, so a slow connection
+	// holds up the same people each time.
+	var order []*slideshow_viewer
+	for v := range st.viewers {
+		order = append(order, v)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].id < order[j].id })
+
+	header := st.header()
+	var stuck []*slideshow_viewer
+	for _, v := range order {
+		if !st.draw_one(v, header) {
+			stuck = append(stuck, v)
+		}
+	}
+	for _, v := range stuck {
+		if st.viewers[v] {
+			st.leave(v, slideshow_stuck)
+		}
+	}
+}
+
+func (st *slideshow_state) header() string {
+	host := "nobody (type 'host' to take over)"
+	if st.host != nil {
+		host = player_name(st.host.sess, "a guest")
+	}
+	position := "no slides yet"
+	if st.at >= 0 {
+		position = fmt.Sprintf("slide %d/%d", st.at+1, len(st.slides))
+	}
+	auto := ""
+	if st.auto > 0 {
+		auto = fmt.Sprintf("   auto: %s", st.auto)
+	}
+	return fmt.Sprintf("\033[1mSlideshow\033[0m   %s   host: %s   %d watching%s\n\n", position, host, len(st.viewers), auto)
+}
+
+const slideshow_stuck = "Your connection fell behind, so you've left the slideshow.\n"
+
+// draw_one sends v their screen. A viewer over their maxfps gets it, or
+// a later one, once they're under it again. It reports false if the
+// write failed or took too long, and v should be dropped: the deadline
+// stops one stuck client holding up everyone else for long.
+func (st *slideshow_state) draw_one(v *slideshow_viewer, header string) bool {
+	if v.held {
+		return true
+	}
+	if d := v.sess.next_frame(0); d > 0 {
+		v.held = true
+		time.AfterFunc(d, func() { slideshow_room.events <- slideshow_event{redraw: v} })
+		return true
+	}
+
+	var b strings.Builder
+	b.WriteString(clearScreen + header + v.frame + "\n")
+	for _, c := range st.chat {
+		b.WriteString(c + "\n")
+	}
+	b.WriteString(v.status + "\n> ")
+	v.sess.conn.SetWriteDeadline(time.Now().Add(versus_write_timeout))
+	err := v.sess.send(b.String())
+	v.sess.conn.SetWriteDeadline(time.Time{})
+	return err == nil
+}
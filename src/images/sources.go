@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"image"
+	"os"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+var (
+	fetchTimeout = flag.Duration("fetch-timeout", 30*time.Second, "longest a download may take, headers and body; 0 is no limit")
+	fileRoot     = flag.String("file-root", "", "directory that file: references are served from; without one, there are no file: references")
+)
+
+// open_sources registers the server's own sources with fetch.Default,
+// alongside any an embedder registered in an init function. The HTTP
+// source goes through http.DefaultClient, so the fetch policy holds for
+// it.
+func open_sources() {
+	web := fetch.HTTP{Timeout: *fetchTimeout}
+	fetch.Register("http", web)
+	fetch.Register("https", web)
+	fetch.Register("data", fetch.Data{})
+	if *fileRoot != "" {
+		fetch.Register("file", fetch.File{Root: *fileRoot})
+	}
+}
+
+// fetch_image fetches and decodes the image ref names for sess, which
+// may be nil, if it has no more than max_pixels megapixels. An image
+// prefetched for ref saves fetching it again.
+func fetch_image(sess *session, ref string, max_pixels int) (image.Image, error) {
+	return fetch_in(fetching_for(sess), ref, max_pixels)
+}
+
+// fetch_in is fetch_image within ctx, for fetches no connection is
+// waiting on.
+func fetch_in(ctx context.Context, ref string, max_pixels int) (image.Image, error) {
+	if img, ok, err := prefetch_take(ref, max_pixels); ok {
+		return img, err
+	}
+
+	img, _, err := fetch.Default.Fetch(fetch.WithMaxPixels(ctx, max_pixels), ref)
+	if err != nil {
+		return nil, policy_unwrap(err)
+	}
+	return normalizeImage(img), nil
+}
+
+// fetch_changed fetches ref for sess again, unless it's the same image
+// since describes, in which case it fails with fetch.ErrNotModified. It
+// skips the prefetch cache, which would only have the same image again.
+func fetch_changed(sess *session, ref string, since fetch.Metadata) (image.Image, fetch.Metadata, error) {
+	ctx := fetch.IfChanged(fetch.WithMaxPixels(fetching_for(sess), sess.max_pixels), since)
+	img, meta, err := fetch.Default.Fetch(ctx, ref)
+	if err != nil {
+		return nil, since, policy_unwrap(err)
+	}
+	return normalizeImage(img), meta, nil
+}
+
+// watch_hangup ends sess's context if the client hangs up before stop is
+// called, so that a fetch the connection is waiting on gives up rather
+// than finishing for nobody. Only the connection's own goroutine may
+// call it, when nothing else is reading. Input that comes meanwhile is
+// left to be read.
+func watch_hangup(sess *session) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := sess.reader.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			sess.cancel()
+		}
+	}()
+
+	return func() {
+		sess.conn.SetReadDeadline(time.Now())
+		<-done
+		sess.conn.SetReadDeadline(time.Time{})
+	}
+}
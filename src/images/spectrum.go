@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+const (
+	// With the height left automatic, the strips share this many rows.
+	spectrum_rows     = 24
+	spectrum_min_rows = 3
+)
+
+// spectrum_band is the middle of img, cut to the shape of a strip cols
+// wide and rows tall.
+func spectrum_band(img *image.NRGBA, cols, rows int, aspect float64) image.Image {
+	b := img.Bounds()
+	want := float64(rows) * aspect / float64(cols)
+	if h := int(float64(b.Dx()) * want); h < b.Dy() {
+		top := b.Min.Y + (b.Dy()-h)/2
+		return img.SubImage(image.Rect(b.Min.X, top, b.Max.X, top+max(h, 1)))
+	}
+	w := int(float64(b.Dy()) / want)
+	left := b.Min.X + (b.Dx()-w)/2
+	return img.SubImage(image.Rect(left, b.Min.Y, left+max(w, 1), b.Max.Y))
+}
+
+// spectrum_command handles "spectrum URL", which draws a strip of the
+// image at URL in every mode there is, one above the other under its
+// name, to compare them on one screen. The strips share the session's
+// height, each getting at least spectrum_min_rows. A server locked to
+// one mode only shows that one.
+func spectrum_command(sess *session, line string) (string, error) {
+	url := strings.TrimSpace(strings.TrimPrefix(line, "spectrum"))
+	if url == "" {
+		return "Usage: spectrum URL\n", nil
+	}
+
+	sess.last_url = url
+	stop := watch_hangup(sess)
+	img, err := fetch_image(sess, url, sess.max_pixels)
+	stop()
+
+	var big *fetch.TooLargeError
+	if refused, ok := err.(*policy_error); ok {
+		return refused.sentence(), nil
+	}
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ". Use 'info' to check dimensions first.\n", nil
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't load that image: %v.\n", err), nil
+	}
+
+	var names []string
+	for name := range modes {
+		if *lockMode == "" || name == *lockMode {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	height := sess.height
+	if height == 0 {
+		height = spectrum_rows
+	}
+	rows := max(height/len(names), spectrum_min_rows)
+	band := spectrum_band(to_nrgba(preprocess(img, sess)), sess.width, rows, sess.aspect)
+
+	converter := sess.converter
+	defer func() { sess.converter = converter }()
+
+	var b strings.Builder
+	for _, name := range names {
+		pad := max(sess.width-len(name), 0) / 2
+		b.WriteString(strings.Repeat(" ", pad) + "\033[1m" + name + "\033[0m\n")
+
+		sess.converter = modes[name]
+		strip := renderToStrings(band, sess.width, 1, sess)
+		for _, row := range strip[:min(len(strip), rows)] {
+			b.WriteString(row + "\n")
+		}
+	}
+	stats.rendered.Add(1)
+	sess.last_render = b.String()
+	return sess.last_render, nil
+}
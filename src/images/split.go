@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// split_command handles "split N URL1 ... URLN", rendering the images side
+// by side. Each gets an equal share of the session width, less a column
+// that keeps it apart from its neighbour.
+func split_command(sess *session, line string) string {
+	args := strings.Fields(strings.TrimPrefix(line, "split"))
+	usage := "Usage: split N URL1 ... URLN, with N from 2 to 4.\n"
+	if len(args) == 0 {
+		return usage
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 2 || n > 4 {
+		return usage
+	}
+	urls := args[1:]
+	if len(urls) != n {
+		return fmt.Sprintf("split %d needs %d URLs, got %d.\n", n, n, len(urls))
+	}
+
+	width := sess.width/n - 1
+	return join_columns(render_tiles(sess, urls, width), width)
+}
+
+// render_tiles fetches the images at urls at once, and renders each width
+// columns wide, or a placeholder for those that couldn't be fetched.
+func render_tiles(sess *session, urls []string, width int) [][]string {
+	tiles := make([][]string, len(urls))
+
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			img, err := fetch_image(sess, url, sess.max_pixels)
+			if err != nil {
+				tiles[i] = split_placeholder(width, err)
+				return
+			}
+
+			stats.rendered.Add(1)
+			tiles[i] = renderToStrings(preprocess(img, sess), width, 1, sess)
+
+			// Narrow images are filled out so the next column lines up.
+			fill := strings.Repeat(" ", width-min(img.Bounds().Dx(), width))
+			for y := range tiles[i] {
+				tiles[i][y] += fill
+			}
+		}()
+	}
+	wg.Wait()
+
+	return tiles
+}
+
+// grid_command handles "grid-layout COLS URL1 ... URLN", or
+// "multi-column", which is split wrapped onto as many rows as it takes:
+// up to COLS×COLS images, COLS to a row. Cells the last row has no image
+// for say so.
+func grid_command(sess *session, line string) string {
+	args := strings.Fields(line)[1:]
+	usage := "Usage: grid-layout COLS URL1 ... URLN, with COLS from 2 to 4 and up to COLS×COLS URLs.\n"
+	if len(args) < 2 {
+		return usage
+	}
+
+	cols, err := strconv.Atoi(args[0])
+	if err != nil || cols < 2 || cols > 4 {
+		return usage
+	}
+	urls := args[1:]
+	if len(urls) > cols*cols {
+		return fmt.Sprintf("A grid %d wide holds at most %d images, got %d.\n", cols, cols*cols, len(urls))
+	}
+
+	width := sess.width/cols - 1
+	tiles := render_tiles(sess, urls, width)
+
+	var b strings.Builder
+	for start := 0; start < len(tiles); start += cols {
+		row := tiles[start:min(start+cols, len(tiles))]
+		if start > 0 {
+			b.WriteString("\n")
+		}
+		if len(row) < cols {
+			row = append(row, grid_empty(row, width, cols-len(row))...)
+		}
+		b.WriteString(join_columns(row, width))
+	}
+	return b.String()
+}
+
+// grid_empty is n placeholders for the cells at the end of a grid row
+// with no image, each centered among the rows of the tiles beside it.
+func grid_empty(row [][]string, width, n int) [][]string {
+	height := 0
+	for _, tile := range row {
+		height = max(height, len(tile))
+	}
+
+	label := "[empty]"[:min(7, width)]
+	left := (width - len(label)) / 2
+	placeholder := make([]string, height/2+1)
+	for y := range placeholder {
+		placeholder[y] = strings.Repeat(" ", width)
+	}
+	placeholder[height/2] = strings.Repeat(" ", left) + label + strings.Repeat(" ", width-left-len(label))
+
+	empty := make([][]string, n)
+	for i := range empty {
+		empty[i] = placeholder
+	}
+	return empty
+}
+
+// join_columns interleaves the rows of each column. Shorter columns are
+// padded with blank rows so the ones to their right stay lined up.
+func join_columns(columns [][]string, width int) string {
+	height := 0
+	for _, col := range columns {
+		height = max(height, len(col))
+	}
+
+	blank := strings.Repeat(" ", width)
+
+	var b strings.Builder
+	for y := range height {
+		for i, col := range columns {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			if y < len(col) {
+				b.WriteString(col[y])
+			} else {
+				b.WriteString(blank)
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// split_placeholder stands in for an image that couldn't be fetched: a box
+// the width of the column with the error inside.
+func split_placeholder(width int, err error) []string {
+	inner := width - 2
+	msg := []rune("error: " + err.Error())
+
+	rows := []string{"┌" + strings.Repeat("─", inner) + "┐"}
+	for len(msg) > 0 && len(rows) < 6 {
+		n := min(len(msg), inner)
+		rows = append(rows, "│"+string(msg[:n])+strings.Repeat(" ", inner-n)+"│")
+		msg = msg[n:]
+	}
+	rows = append(rows, "└"+strings.Repeat("─", inner)+"┘")
+
+	return rows
+}
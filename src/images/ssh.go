@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	sshHostKey  = flag.String("ssh-host-key", "", "also take SSH connections, with the host key in this file (SSH is off if unset)")
+	sshPort     = flag.Int("ssh-port", 2222, "port SSH connections are taken on, with -ssh-host-key")
+	sshPassword = flag.String("ssh-password", "", "password SSH clients have to give (anyone may connect if unset)")
+	sshGenKey   = flag.Bool("ssh-gen-key", false, "write a new ed25519 host key to the -ssh-host-key file, if there isn't one there yet")
+)
+
+// An ssh_conn is one end of a pipe whose other end is an SSH session's
+// channel, so that handleConn gets the deadlines it relies on, which
+// channels don't have. cols is the width of the client's terminal, and
+// pty whether it asked for one at all.
+type ssh_conn struct {
+	net.Conn
+	remote net.Addr
+	pty    bool
+	cols   int
+
+	// raw is set while a game wants keys as they're pressed, as telnet
+	// clients are put in character mode.
+	raw atomic.Bool
+}
+
+func (c *ssh_conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// char_mode stops or starts input being edited a line at a time.
+func (c *ssh_conn) char_mode(on bool) {
+	c.raw.Store(on)
+}
+
+// gen_host_key writes a new ed25519 host key to path, unless there's a
+// file there already.
+func gen_host_key(path string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "tcp-games host key")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, block); err != nil {
+		f.Close()
+		return err
+	}
+	log.Printf("ssh: wrote a new host key to %s", path)
+	return f.Close()
+}
+
+// ssh_config loads the host key, making it first if -ssh-gen-key says
+// to, and sets up how clients log in: with no questions asked, or with
+// -ssh-password, given either as a password or at a keyboard-interactive
+// prompt.
+func ssh_config() (*ssh.ServerConfig, error) {
+	if *sshGenKey {
+		if err := gen_host_key(*sshHostKey); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(*sshHostKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", *sshHostKey, err)
+	}
+
+	conf := &ssh.ServerConfig{}
+	conf.AddHostKey(key)
+	if *sshPassword == "" {
+		conf.KeyboardInteractiveCallback = func(ssh.ConnMetadata, ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return nil, nil
+		}
+		return conf, nil
+	}
+
+	check := func(given string) (*ssh.Permissions, error) {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(*sshPassword)) != 1 {
+			return nil, errors.New("wrong password")
+		}
+		return nil, nil
+	}
+	conf.PasswordCallback = func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		return check(string(password))
+	}
+	conf.KeyboardInteractiveCallback = func(_ ssh.ConnMetadata, ask ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		answers, err := ask("", "", []string{"Password: "}, []bool{false})
+		if err != nil || len(answers) != 1 {
+			return nil, errors.New("no password given")
+		}
+		return check(answers[0])
+	}
+	return conf, nil
+}
+
+// serve_ssh takes SSH connections on -ssh-port for as long as the server
+// runs.
+func serve_ssh(conf *ssh.ServerConfig) {
+	addr := fmt.Sprintf(":%d", *sshPort)
+	log.Printf("Binding SSH: 0.0.0.0%s", addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("ssh: %v", err)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("ssh: %v", err)
+			continue
+		}
+		set_nodelay(conn)
+		if banned(remote_addr(conn)) {
+			conn.Close()
+			continue
+		}
+
+		go ssh_handshake(conn, conf)
+	}
+}
+
+// ssh_handshake logs conn in and starts each session it opens.
+func ssh_handshake(conn net.Conn, conf *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, conf)
+	if err != nil {
+		log.Printf("ssh: %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only sessions are served here")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			log.Printf("ssh: %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		go ssh_session(sconn, ch, requests)
+	}
+}
+
+// pty_cols is the terminal width in a pty-req's payload, RFC 4254 6.2,
+// or 0 if it doesn't say.
+func pty_cols(payload []byte) int {
+	var pty struct {
+		Term                      string
+		Cols, Rows, Width, Height uint32
+		Modes                     string
+	}
+	if ssh.Unmarshal(payload, &pty) != nil {
+		return 0
+	}
+	return int(pty.Cols)
+}
+
+// ssh_session waits for the client to ask for a shell, noting the width
+// of the terminal if it asks for one, whatever its type, and then serves
+// it as handleConn would anyone.
+func ssh_session(sconn *ssh.ServerConn, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+
+	ours, theirs := net.Pipe()
+	c := &ssh_conn{Conn: ours, remote: sconn.RemoteAddr()}
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			c.pty, c.cols = true, pty_cols(req.Payload)
+			req.Reply(true, nil)
+		case "shell":
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+
+			go c.input(ch, theirs)
+			go c.output(ch, theirs)
+			handleConn(c)
+			c.Close()
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// output copies what the server sends from r to ch. A terminal the
+// client has made raw doesn't go back to the start of the line on a
+// newline, so it's sent a carriage return too.
+func (c *ssh_conn) output(ch ssh.Channel, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		out := buf[:n]
+		if c.pty {
+			out = bytes.ReplaceAll(out, []byte("\n"), []byte("\r\n"))
+		}
+		if _, werr := ch.Write(out); werr != nil || err != nil {
+			return
+		}
+	}
+}
+
+// input copies what the client types from ch to w. With a pty, the
+// client's terminal is raw, so unless a game wants keys as they come,
+// this does what the terminal's line discipline would: it echoes what's
+// typed, lets backspace rub it out, and sends the line on enter. ^C
+// drops the line and ^D on an empty one hangs up. Escape sequences, the
+// terminal's answer to the probe among them, go straight through.
+func (c *ssh_conn) input(ch ssh.Channel, w io.WriteCloser) {
+	defer w.Close()
+
+	r := bufio.NewReader(ch)
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		var pass, echo []byte
+		switch {
+		case !c.pty || c.raw.Load():
+			pass = []byte{b}
+		case b == '\r' || b == '\n':
+			pass, echo, line = append(line, '\n'), []byte("\r\n"), nil
+		case b == 0x7f || b == '\b':
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line, echo = line[:len(line)-size], []byte("\b \b")
+			}
+		case b == 0x03:
+			line, echo = nil, []byte("^C\r\n")
+		case b == 0x04 && len(line) == 0:
+			return
+		case b == '\033':
+			pass = escape_sequence(r)
+		case b < ' ':
+		default:
+			line, echo = append(line, b), []byte{b}
+		}
+
+		if len(echo) > 0 {
+			ch.Write(echo)
+		}
+		if len(pass) > 0 {
+			if _, err := w.Write(pass); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// escape_sequence reads the rest of an escape sequence whose ESC has
+// just been read from r, and returns all of it. Only CSI and SS3
+// sequences are read to their end; anything else is the ESC alone.
+func escape_sequence(r *bufio.Reader) []byte {
+	seq := []byte{'\033'}
+	next, err := r.Peek(1)
+	if err != nil || (next[0] != '[' && next[0] != 'O') {
+		return seq
+	}
+	r.ReadByte()
+	seq = append(seq, next[0])
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return seq
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			return seq
+		}
+	}
+}
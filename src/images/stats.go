@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/leaderboard"
+)
+
+var statsPassword = flag.String("stats-password", "", "require 'stats PASSWORD' before showing server statistics")
+
+// server_stats holds counters shared by every connection. All fields are
+// updated atomically; started is written once before the listener opens.
+type server_stats struct {
+	started time.Time
+
+	connections atomic.Int64
+	active      atomic.Int64
+	rendered    atomic.Int64
+	bytesSent   atomic.Int64
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+var stats = server_stats{started: time.Now()}
+
+func (s *server_stats) hitRate() string {
+	hits := s.cacheHits.Load()
+	total := hits + s.cacheMisses.Load()
+	if total == 0 {
+		return "n/a"
+	}
+
+	return fmt.Sprintf("%.1f%% (%d/%d)", 100*float64(hits)/float64(total), hits, total)
+}
+
+func (s *server_stats) report() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "uptime:      %s\n", time.Since(s.started).Round(time.Second))
+	fmt.Fprintf(&b, "connections: %d total, %d active\n", s.connections.Load(), s.active.Load())
+	fmt.Fprintf(&b, "rendered:    %d images\n", s.rendered.Load())
+	fmt.Fprintf(&b, "sent:        %d bytes\n", s.bytesSent.Load())
+	fmt.Fprintf(&b, "cache:       %s\n", s.hitRate())
+	fmt.Fprintf(&b, "prefetch:    %s\n", prefetch_report())
+
+	return b.String()
+}
+
+// stats_command handles "stats", "stats PASSWORD" and "stats NICK". With
+// a password set, anything but the password is taken as a nickname.
+func stats_command(line string) string {
+	given := strings.TrimSpace(strings.TrimPrefix(line, "stats"))
+
+	if *statsPassword != "" && subtle.ConstantTimeCompare([]byte(given), []byte(*statsPassword)) == 1 {
+		return stats.report()
+	}
+	if given != "" && leaderboard.ValidNick(given) {
+		return player_stats(given)
+	}
+	if *statsPassword != "" {
+		return "Stats are password protected: use 'stats PASSWORD', or 'stats NICK' for a player's scores.\n"
+	}
+	if given != "" {
+		return fmt.Sprintf("No scores for %s.\n", given)
+	}
+
+	return stats.report()
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// Telnet commands and options, RFC 854 and friends.
+const (
+	tel_se   = 240
+	tel_sb   = 250
+	tel_will = 251
+	tel_wont = 252
+	tel_do   = 253
+	tel_dont = 254
+	tel_iac  = 255
+
+	opt_echo     = 1
+	opt_sga      = 3
+	opt_ttype    = 24
+	opt_linemode = 34
+
+	// TTYPE subnegotiation, RFC 1091.
+	ttype_is   = 0
+	ttype_send = 1
+)
+
+// telnet_reader strips telnet negotiation out of the input stream so the
+// rest of the server only ever sees what the user typed. Raw netcat
+// clients never send IAC, so for them it is a passthrough. Replies to the
+// capability probe are taken out too, whenever they arrive, since a line
+// buffered client only sends them along with the next line.
+type telnet_reader struct {
+	r     io.Reader
+	state int
+
+	// telnet is set once the client has sent any negotiation, which
+	// tells us it understands option replies.
+	telnet atomic.Bool
+
+	// cmd is the negotiation command whose option comes next, and sub
+	// the subnegotiation read so far.
+	cmd byte
+	sub []byte
+
+	// ttype_will is set when the client agrees to tell its terminal
+	// type, and ttype_refused when it won't. ttype is what it said.
+	ttype_will    atomic.Bool
+	ttype_refused atomic.Bool
+	ttype         atomic.Pointer[string]
+
+	// da is the parameters of the terminal's Device Attributes reply,
+	// as in "?62;22", once one has come in.
+	da atomic.Pointer[string]
+
+	// reports is set once the terminal's been asked where its cursor is
+	// and how big its text area is, after which answers are taken out
+	// like DA replies. cpr and text_px are the last of each, as in
+	// "24;80" and "4;600;800".
+	reports atomic.Bool
+	cpr     atomic.Pointer[string]
+	text_px atomic.Pointer[string]
+
+	// held is what might be the start of a DA reply, kept back until
+	// it's clear whether it is one.
+	held []byte
+
+	// line is the line being read, up to max_line_noted bytes, so that a
+	// "binary" line and the size after it are noticed. long is set when
+	// it's gone past that, binary when the last line was "binary", and
+	// raw is how many bytes of the file after the size are still to be
+	// let through untouched.
+	line   []byte
+	long   bool
+	binary bool
+	raw    int
+
+	// pending is filtered input a Read had no room for, and err what
+	// the underlying reader returned after it.
+	pending []byte
+	err     error
+}
+
+const (
+	tel_data = iota
+	tel_cmd
+	tel_opt
+	tel_sub
+	tel_sub_iac
+
+	// ESC, then ESC [, then ESC [ ?, on the way to a DA reply, or
+	// ESC [ and a digit, on the way to a cursor or size report.
+	esc_seen
+	esc_csi
+	esc_da
+	esc_report
+)
+
+// A DA reply has no business being longer than this; anything that is
+// must be something else. Subnegotiations are cut short at max_sub, which
+// is more than a terminal type needs.
+const (
+	max_da_reply = 64
+	max_sub      = 64
+)
+
+// Neither "binary" nor a size is anywhere near this long.
+const max_line_noted = 32
+
+func (t *telnet_reader) Read(p []byte) (int, error) {
+	// Don't hand back an empty read for a packet that was nothing but
+	// negotiation; callers would take it for a stalled connection.
+	for len(t.pending) == 0 && t.err == nil {
+		n, err := t.r.Read(p)
+		t.filter(p[:n])
+		t.err = err
+	}
+
+	if len(t.pending) > 0 {
+		n := copy(p, t.pending)
+		t.pending = t.pending[n:]
+		return n, nil
+	}
+
+	// A timeout is worth reporting once and then carrying on from.
+	err := t.err
+	t.err = nil
+	return 0, err
+}
+
+func (t *telnet_reader) filter(in []byte) {
+	for _, b := range in {
+		if t.raw > 0 {
+			t.pending = append(t.pending, b)
+			t.raw--
+			continue
+		}
+
+		switch t.state {
+		case tel_data:
+			t.data(b)
+		case tel_cmd:
+			switch b {
+			case tel_iac:
+				t.pending = append(t.pending, b)
+				t.state = tel_data
+			case tel_will, tel_wont, tel_do, tel_dont:
+				t.cmd = b
+				t.state = tel_opt
+			case tel_sb:
+				t.sub = t.sub[:0]
+				t.state = tel_sub
+			default:
+				t.state = tel_data
+			}
+		case tel_opt:
+			if b == opt_ttype {
+				switch t.cmd {
+				case tel_will:
+					t.ttype_will.Store(true)
+				case tel_wont:
+					t.ttype_refused.Store(true)
+				}
+			}
+			t.state = tel_data
+		case tel_sub:
+			if b == tel_iac {
+				t.state = tel_sub_iac
+			} else if len(t.sub) < max_sub {
+				t.sub = append(t.sub, b)
+			}
+		case tel_sub_iac:
+			switch b {
+			case tel_se:
+				t.subnegotiation()
+				t.state = tel_data
+			case tel_iac:
+				t.sub = append(t.sub, b)
+				t.state = tel_sub
+			default:
+				t.state = tel_sub
+			}
+		case esc_seen:
+			if b == '[' {
+				t.held = append(t.held, b)
+				t.state = esc_csi
+			} else {
+				t.release(b)
+			}
+		case esc_csi:
+			switch {
+			case b == '?':
+				t.held = append(t.held, b)
+				t.state = esc_da
+			case b >= '0' && b <= '9' && t.reports.Load():
+				t.held = append(t.held, b)
+				t.state = esc_report
+			default:
+				t.release(b)
+			}
+		case esc_da:
+			switch {
+			case b == 'c':
+				da := string(t.held[2:])
+				t.da.Store(&da)
+				t.held = t.held[:0]
+				t.state = tel_data
+			case (b >= '0' && b <= '9' || b == ';') && len(t.held) < max_da_reply:
+				t.held = append(t.held, b)
+			default:
+				t.release(b)
+			}
+		case esc_report:
+			switch {
+			case b == 'R' || b == 't':
+				report := string(t.held[2:])
+				if b == 'R' {
+					t.cpr.Store(&report)
+				} else {
+					t.text_px.Store(&report)
+				}
+				t.held = t.held[:0]
+				t.state = tel_data
+			case (b >= '0' && b <= '9' || b == ';') && len(t.held) < max_da_reply:
+				t.held = append(t.held, b)
+			default:
+				t.release(b)
+			}
+		}
+	}
+
+	// Terminals send a reply in one go, so a lone ESC at the end of a
+	// packet is the Escape key, and is let through rather than held up.
+	if t.state == esc_seen {
+		t.release_held()
+	}
+}
+
+// data handles b outside of any negotiation or escape.
+func (t *telnet_reader) data(b byte) {
+	switch b {
+	case tel_iac:
+		t.state = tel_cmd
+		t.telnet.Store(true)
+	case '\033':
+		t.held = append(t.held[:0], b)
+		t.state = esc_seen
+	case 0:
+		// Telnet sends CR NUL for a bare return.
+	default:
+		t.pending = append(t.pending, b)
+		t.note_line(b)
+	}
+}
+
+// note_line keeps track of the line b is part of. After a line saying
+// "binary" and one with a size, as the binary command reads them, that
+// many bytes are let through as they are: they're a file, where IAC and
+// ESC mean nothing.
+func (t *telnet_reader) note_line(b byte) {
+	if b != '\n' {
+		t.long = t.long || len(t.line) == max_line_noted
+		if !t.long {
+			t.line = append(t.line, b)
+		}
+		return
+	}
+
+	line := strings.TrimSpace(string(t.line))
+	if t.long {
+		line = ""
+	}
+	t.line, t.long = t.line[:0], false
+
+	if t.binary {
+		t.raw, _ = binary_size(line)
+	}
+	t.binary = line == "binary"
+}
+
+// release lets through what was held back, then carries on with b, which
+// showed it wasn't a DA reply after all.
+func (t *telnet_reader) release(b byte) {
+	t.release_held()
+	t.data(b)
+}
+
+func (t *telnet_reader) release_held() {
+	t.pending = append(t.pending, t.held...)
+	t.held = t.held[:0]
+	t.state = tel_data
+}
+
+// subnegotiation takes in a finished subnegotiation. The only one asked
+// for is the terminal type.
+func (t *telnet_reader) subnegotiation() {
+	if len(t.sub) >= 2 && t.sub[0] == opt_ttype && t.sub[1] == ttype_is {
+		name := string(t.sub[2:])
+		t.ttype.Store(&name)
+	}
+}
+
+// A char_moder is a connection that doesn't negotiate telnet, and goes
+// in and out of character mode by itself.
+type char_moder interface {
+	char_mode(on bool)
+}
+
+// char_mode asks a telnet client to send every keypress as it happens
+// instead of a line at a time: the server will echo (so the client stops
+// echoing locally) and go-aheads are suppressed. Either way it's only
+// sent to clients that have shown they speak telnet; netcat would print
+// the bytes as garbage at the prompt.
+//
+// Plain netcat can't be switched out of line buffering from our side, so
+// character-mode games still accept keys typed and followed by enter.
+// Connections that aren't telnet underneath, SSH and WebSockets, aren't
+// sent any of this; they switch modes their own way.
+func (s *session) char_mode(on bool) {
+	if c, ok := s.conn.(char_moder); ok {
+		c.char_mode(on)
+		return
+	}
+	if !s.input.telnet.Load() {
+		return
+	}
+	if on {
+		s.send(string([]byte{
+			tel_iac, tel_will, opt_echo,
+			tel_iac, tel_will, opt_sga,
+			tel_iac, tel_do, opt_sga,
+			tel_iac, tel_dont, opt_linemode,
+		}))
+	} else {
+		s.send(string([]byte{
+			tel_iac, tel_wont, opt_echo,
+			tel_iac, tel_wont, opt_sga,
+		}))
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/font"
+)
+
+// text_command handles "text FONT MESSAGE", which draws the message in one
+// of the built-in fonts, big or small, with the darkest and lightest of
+// the bw characters. Lines wrap between words to fit the session's width.
+func text_command(sess *session, line string) string {
+	usage := "Usage: text big|small MESSAGE\n"
+
+	args := strings.TrimSpace(strings.TrimPrefix(line, "text"))
+	name, message, _ := strings.Cut(args, " ")
+	f, ok := font.Fonts[name]
+	if !ok || strings.TrimSpace(message) == "" {
+		return usage
+	}
+
+	lines := f.Wrap(message, sess.width)
+	widest := 0
+	for _, l := range lines {
+		widest = max(widest, f.Columns(l))
+	}
+	pad := align_padding(sess, widest)
+
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for _, row := range f.Render(l) {
+			b.WriteString(pad)
+			for _, on := range row {
+				if on {
+					b.WriteRune(chars[len(chars)-1])
+				} else {
+					b.WriteRune(chars[0])
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	throttleDefault = flag.Int("throttle", 0, "bytes a second each connection's output is paced to until it sets its own with 'throttle'; 0 is full speed")
+	throttleCap     = flag.Int("throttle-cap", 0, "bytes a second no connection's output goes faster than, whatever it asks for; 0 is no cap")
+	noDelay         = flag.Bool("nodelay", true, "send output as soon as it's written (TCP_NODELAY), rather than leaving the OS to gather it into fewer packets")
+)
+
+const (
+	// 50 bytes a second is about 400 baud, slower than anything still
+	// in use.
+	min_throttle = 50
+	max_throttle = 100_000_000
+)
+
+// A pacer spaces a connection's output out to rate bytes a second, with
+// a token bucket holding a tenth of a second's worth. Output is written
+// in pieces no bigger than the bucket, ending at a row where one falls
+// in the piece, so rows come out whole when they can and a connection
+// that's gone is found out within a piece. A pacer with a rate of 0
+// writes straight through.
+type pacer struct {
+	// mu is held for all of a write, so that the pieces of two writes
+	// don't interleave.
+	mu     sync.Mutex
+	rate   int
+	tokens float64
+	last   time.Time
+}
+
+// write sends s on conn. A deadline that isn't zero is set for this
+// write alone, while mu is held, so it can't cut short anyone else's.
+func (p *pacer) write(conn net.Conn, s string, deadline time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !deadline.IsZero() {
+		conn.SetWriteDeadline(deadline)
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	if p.rate == 0 {
+		return send(conn, s)
+	}
+
+	burst := max(p.rate/10, 64)
+	for len(s) > 0 {
+		n := min(len(s), burst)
+		if i := strings.LastIndexByte(s[:n], '\n'); i >= 0 && n < len(s) {
+			n = i + 1
+		}
+
+		p.take(n, burst)
+		if err := send(conn, s[:n]); err != nil {
+			return err
+		}
+		s = s[n:]
+	}
+	return nil
+}
+
+// take waits until the bucket has n tokens, and takes them.
+func (p *pacer) take(n, burst int) {
+	now := time.Now()
+	p.tokens = min(p.tokens+now.Sub(p.last).Seconds()*float64(p.rate), float64(burst))
+	p.last = now
+
+	if short := float64(n) - p.tokens; short > 0 {
+		time.Sleep(time.Duration(short / float64(p.rate) * float64(time.Second)))
+		p.tokens, p.last = float64(n), time.Now()
+	}
+	p.tokens -= float64(n)
+}
+
+// set_nodelay turns Nagle's algorithm off for conn, so that a render
+// written a row at a time reaches the client a row at a time. With
+// -nodelay=false it's turned back on, as the OS would have it; Go turns
+// it off for every TCP connection by itself.
+func set_nodelay(conn net.Conn) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		log.Printf("warning: can't set TCP_NODELAY on a %T from %s", conn, conn.RemoteAddr())
+		return
+	}
+	if err := tcp.SetNoDelay(*noDelay); err != nil {
+		log.Printf("warning: setting TCP_NODELAY for %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// set_throttle asks for output at n bytes a second, or at full speed for
+// 0. The server's cap, if it has one, wins over either.
+func (s *session) set_throttle(n int) {
+	s.throttle = n
+	if *throttleCap > 0 && (n == 0 || n > *throttleCap) {
+		n = *throttleCap
+	}
+
+	s.pace.mu.Lock()
+	s.pace.rate = n
+	s.pace.mu.Unlock()
+}
+
+func throttle_status(sess *session) string {
+	sess.pace.mu.Lock()
+	rate := sess.pace.rate
+	sess.pace.mu.Unlock()
+
+	switch {
+	case rate == 0:
+		return "off"
+	case rate != sess.throttle:
+		return fmt.Sprintf("%s/s (the server's cap)", human_bytes(int64(rate)))
+	}
+	return fmt.Sprintf("%s/s", human_bytes(int64(rate)))
+}
+
+// throttle_command handles "throttle [off|BYTES]", which paces the
+// connection's output for links slower than it's made.
+func throttle_command(sess *session, line string) string {
+	switch arg := strings.TrimSpace(strings.TrimPrefix(line, "throttle")); arg {
+	case "":
+	case "off":
+		sess.set_throttle(0)
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < min_throttle || n > max_throttle {
+			return fmt.Sprintf("Usage: throttle off, or throttle BYTES a second from %d to %d.\n", min_throttle, max_throttle)
+		}
+		sess.set_throttle(n)
+	}
+	return "Throttle: " + throttle_status(sess) + "\n"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atalii/image-server-thing/internal/fetch"
+)
+
+// A phase_timer notes when each phase of a render ends, and how long it
+// took from the end of the one before.
+type phase_timer struct {
+	last   time.Time
+	phases []string
+	took   []time.Duration
+}
+
+func (t *phase_timer) done(phase string) {
+	now := time.Now()
+	t.phases = append(t.phases, phase)
+	t.took = append(t.took, now.Sub(t.last))
+	t.last = now
+}
+
+func (t *phase_timer) String() string {
+	var b strings.Builder
+	var total time.Duration
+	for i, phase := range t.phases {
+		fmt.Fprintf(&b, "%s: %dms | ", phase, t.took[i].Milliseconds())
+		total += t.took[i]
+	}
+	fmt.Fprintf(&b, "Total: %dms\n", total.Milliseconds())
+	return b.String()
+}
+
+// timed_dial looks addr's host up and connects to it, and notes how long
+// each of those took, the first time it's called; later dials, for
+// redirects, count towards whatever phase they come in.
+func timed_dial(t *phase_timer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialed := false
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		first := !dialed
+		dialed = true
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			t.done("DNS")
+		}
+
+		var d net.Dialer
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				if first {
+					t.done("TCP")
+				}
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// time_render_command handles "time-render URL", which renders the image
+// at URL as usual, on a connection of its own, and says how long each
+// step took: looking the host up, connecting, waiting for the first byte
+// (TLS included), downloading the rest, decoding, preprocessing, drawing
+// the cells and putting them into the text that's sent. Redirects are
+// timed as part of waiting for the first byte.
+func time_render_command(sess *session, line string) string {
+	url := strings.TrimSpace(strings.TrimPrefix(line, "time-render"))
+	if scheme, _ := fetch.Scheme(url); scheme != "http" && scheme != "https" {
+		return "Usage: time-render URL, with an http: or https: URL.\n"
+	}
+
+	t := &phase_timer{last: time.Now()}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.DialContext = timed_dial(t)
+	client := &http.Client{Transport: agent_transport{policy_transport{transport}}}
+
+	req, err := http.NewRequestWithContext(fetching_for(sess), http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Sprintf("Couldn't ask for that: %v.\n", err)
+	}
+	sess.last_url = url
+	resp, err := client.Do(req)
+	if refused, ok := policy_unwrap(err).(*policy_error); ok {
+		return refused.sentence()
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't fetch that: %v.\n", err)
+	}
+	defer fetch.Close(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Sprintf("Couldn't fetch that: the server said %s.\n", resp.Status)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	body.Peek(1)
+	t.done("TTFB")
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Sprintf("The download failed: %v.\n", err)
+	}
+	t.done("Download")
+
+	img, _, err := fetch.Decode(fetch.WithMaxPixels(fetching_for(sess), sess.max_pixels), bytes.NewReader(data))
+	var big *fetch.TooLargeError
+	if errors.As(err, &big) {
+		return "Image too large: " + big.Size() + ".\n"
+	}
+	var slow *fetch.DecodeTimeoutError
+	if errors.As(err, &slow) {
+		return decode_timeout_sentence(slow)
+	}
+	if err != nil {
+		return fmt.Sprintf("Couldn't decode that: %v.\n", err)
+	}
+	t.done("Decode")
+
+	img = preprocess(img, sess)
+	t.done("Preprocess")
+	lines, pad := render_lines(img, 1, sess)
+	t.done("Compress")
+	out := format_lines(lines, pad, sess)
+	t.done("Format")
+
+	stats.rendered.Add(1)
+	sess.last_render = out
+	return out + t.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// checker_colors are the dark and light squares transparency-check draws
+// behind images.
+var checker_colors = [2]color.RGBA{{100, 100, 100, 0xff}, {200, 200, 200, 0xff}}
+
+// checker_cell is cell x, y of a render, sampled from p, with a
+// checkerboard a cell to a square behind the image: a pixel less than
+// half opaque shows the square, and one more so is blended over it.
+// Cells are drawn with convert, so the squares come out in the mode's
+// own way.
+func checker_cell(img image.Image, p image.Point, x, y int, convert ascii_fn) string {
+	c := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA)
+	if c.A == 0xff {
+		return convert(img, p.X, p.Y)
+	}
+
+	square := checker_colors[(x+y)%2]
+	if c.A < 128 {
+		return convert(image.NewUniform(square), 0, 0)
+	}
+
+	a := float64(c.A) / 0xff
+	blend := func(v, under uint8) uint8 {
+		return uint8(math.Round(float64(v)*a + float64(under)*(1-a)))
+	}
+	return convert(image.NewUniform(color.RGBA{blend(c.R, square.R), blend(c.G, square.G), blend(c.B, square.B), 0xff}), 0, 0)
+}
+
+// transparency_check_command handles "transparency-check", which turns
+// the checkerboard behind transparent pixels on and off. While it's on,
+// the background image is left out, so it can't hide them.
+func transparency_check_command(sess *session, _ string) string {
+	sess.transparency_check = !sess.transparency_check
+	if sess.transparency_check {
+		return "Transparency check on: transparent pixels show a checkerboard.\n"
+	}
+	return "Transparency check off.\n"
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+const (
+	// A pixel of an image with transparency is margin if it's less
+	// opaque than trim_alpha; one of an opaque image is if every channel
+	// is within trim_tolerance of white, out of 255.
+	trim_alpha     = 16
+	trim_tolerance = 5
+
+	trim_blank = "Warning: image appears blank after trimming.\n"
+)
+
+// trim_bounds is the smallest rectangle holding everything in img that
+// isn't margin, which is empty if it's all margin.
+func trim_bounds(img image.Image) image.Rectangle {
+	opaque := false
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+	margin := func(x, y int) bool {
+		r, g, b, a := img.At(x, y).RGBA()
+		if !opaque {
+			return a>>8 < trim_alpha
+		}
+		near := uint32(0xffff - trim_tolerance*0x101)
+		return r >= near && g >= near && b >= near
+	}
+
+	b := img.Bounds()
+	out := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !margin(x, y) {
+				out.Min.X, out.Max.X = min(out.Min.X, x), max(out.Max.X, x+1)
+				out.Min.Y, out.Max.Y = min(out.Min.Y, y), max(out.Max.Y, y+1)
+			}
+		}
+	}
+	if out.Empty() {
+		return image.Rectangle{}
+	}
+	return out
+}
+
+// apply_trim crops img to what isn't margin. An image that's all margin
+// is left as it is.
+func apply_trim(img image.Image) image.Image {
+	r := trim_bounds(img)
+	if r.Empty() || r == img.Bounds() {
+		return img
+	}
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	return to_nrgba(img).SubImage(r)
+}
+
+// trim_command handles "trim [on|off]", which turns cropping margins off
+// images on or off, or on bare, the other way from how it is.
+func trim_command(sess *session, line string) string {
+	name, arg, _ := strings.Cut(line, " ")
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "":
+		sess.trim = !sess.trim
+	case "on":
+		sess.trim = true
+	case "off":
+		sess.trim = false
+	default:
+		return fmt.Sprintf("Usage: %s [on|off] (currently %s)\n", name, on_off(sess.trim))
+	}
+	if sess.trim {
+		return "Trim on: white or transparent margins are cropped off images before they're drawn.\n"
+	}
+	return "Trim off.\n"
+}
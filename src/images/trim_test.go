@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestTrimCommand(t *testing.T) {
+	sess := test_session(t)
+
+	for _, tt := range []struct {
+		line string
+		want bool
+	}{
+		{"trim off", false},
+		{"trim on", true},
+		{"trim on", true},
+		{"trim-whitespace off", false},
+		{"trim", true},
+		{"trim", false},
+	} {
+		trim_command(sess, tt.line)
+		if sess.trim != tt.want {
+			t.Errorf("after %q trim is %v, want %v", tt.line, sess.trim, tt.want)
+		}
+	}
+
+	if got := trim_command(sess, "trim sideways"); got != "Usage: trim [on|off] (currently off)\n" || sess.trim {
+		t.Errorf("trim sideways said %q", got)
+	}
+}
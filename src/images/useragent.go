@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Some image hosts turn away Go's own User-Agent as a bot's.
+const (
+	default_user_agent = "tcp-games/1.0 (image viewer)"
+	max_user_agent     = 200
+)
+
+// open_user_agent has every request the server makes name itself with
+// the User-Agent of the session it's for.
+func open_user_agent() {
+	http.DefaultClient.Transport = agent_transport{http.DefaultClient.Transport}
+}
+
+// agent_transport sets the User-Agent on each request, redirects
+// included, to the one the session that asked for it chose, where the
+// request doesn't have one already.
+type agent_transport struct {
+	base http.RoundTripper
+}
+
+func (t agent_transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	agent := default_user_agent
+	if sess, _ := req.Context().Value(fetcher_key{}).(*session); sess != nil {
+		agent = sess.user_agent
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", agent)
+	return t.base.RoundTrip(req)
+}
+
+// valid_user_agent reports whether s can go in a header as it is.
+func valid_user_agent(s string) bool {
+	if s == "" || len(s) > max_user_agent {
+		return false
+	}
+	for _, c := range s {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// user_agent_command handles "user-agent [STRING|reset]".
+func user_agent_command(sess *session, line string) string {
+	switch arg := strings.TrimSpace(strings.TrimPrefix(line, "user-agent")); arg {
+	case "":
+	case "reset":
+		sess.user_agent = default_user_agent
+	default:
+		if !valid_user_agent(arg) {
+			return fmt.Sprintf("Usage: user-agent STRING, of up to %d printable ASCII characters, or user-agent reset.\n", max_user_agent)
+		}
+		sess.user_agent = arg
+	}
+	return "User-Agent: " + sess.user_agent + "\n"
+}
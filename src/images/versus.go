@@ -0,0 +1,728 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Turn-based two-player games share this plumbing: a lobby pairs players
+// by game name, and each match runs in a single goroutine that owns all
+// of the game's state. Players' connection goroutines only relay their
+// input to it as events, so game code never needs locks and a player
+// vanishing is just another event.
+//
+// The match goroutine also keeps the clocks. A player who disconnects
+// with a nickname set has a grace period to come back and type "resume";
+// their seat is held, the game carries on from where it was, and its
+// redraw hook puts the board back on their new screen.
+//
+// Once nobody is left connected to a match, there's nothing for it to do
+// but wait, so a game that can save and restore itself is frozen: its
+// state is saved, its goroutine exits and its timers stop. The first
+// player to resume starts it again from the saved state; if nobody does
+// before the last grace period runs out, it's dropped.
+
+const (
+	versus_write_timeout = 10 * time.Second
+
+	// versus_grace is how long a disconnected player's seat is held.
+	versus_grace = 60 * time.Second
+
+	// versus_warning is how long before a turn clock runs out the player
+	// is warned.
+	versus_warning = 10 * time.Second
+)
+
+type versus_seat struct {
+	sess    *session
+	matched chan *versus_match
+}
+
+type versus_event struct {
+	player int
+	line   string
+
+	// gone is set when the player disconnects for good or quits.
+	gone bool
+
+	// timeout is set when the player's turn clock runs out.
+	timeout bool
+}
+
+// A versus_game can write out its state and read it back, which lets a
+// match be frozen while nobody is connected to it.
+type versus_game interface {
+	save() ([]byte, error)
+	restore([]byte) error
+}
+
+type versus_match struct {
+	name string
+	play func(*versus_match)
+
+	// A nil seat is played by the computer.
+	seats  [2]*versus_seat
+	live   *live_game
+	events chan versus_event
+	done   chan struct{}
+	result [2]string
+
+	// redraw, if set, shows player p the game again after they resume.
+	redraw func(p int)
+
+	clocks  [2]versus_clock
+	away    [2]*versus_absence
+	rejoins chan versus_rejoin
+
+	// game is what's saved when the match freezes. saved holds it from
+	// then until the game is restored, and carried the time that was left
+	// on each player's clock, for the first clock started for them after.
+	game    versus_game
+	saved   []byte
+	carried [2]time.Duration
+
+	// froze is set by the match goroutine as it exits for a freeze, and
+	// exited is closed once it's gone. thawed is the player whose resume
+	// started it again, to be seated before anything else.
+	froze  bool
+	exited chan struct{}
+	thawed *versus_rejoin
+
+	// mu guards frozen and expiry, which are all there is to a frozen
+	// match until it's thawed or dropped; expiry drops it.
+	mu     sync.Mutex
+	frozen bool
+	expiry *time.Timer
+}
+
+// A versus_clock counts down one player's turn. It fires once to warn
+// them and again when time is up.
+type versus_clock struct {
+	timer  *time.Timer
+	ends   time.Time
+	warned bool
+
+	// paused is the time that was left when the player disconnected.
+	paused time.Duration
+}
+
+// A versus_absence is a player away from the match. addr is where they
+// were playing from.
+type versus_absence struct {
+	nick  string
+	addr  netip.Addr
+	ends  time.Time
+	timer *time.Timer
+}
+
+// A versus_rejoin asks for a held seat back. The reply is why it can't
+// be had, or "" once it's taken.
+type versus_rejoin struct {
+	player int
+	sess   *session
+	reply  chan string
+}
+
+var versus_lobby = struct {
+	sync.Mutex
+	waiting map[string]*versus_seat
+}{waiting: map[string]*versus_seat{}}
+
+// versus_away holds the seats of players who disconnected mid-match, by
+// nickname, until they resume or their grace period runs out.
+var versus_away = struct {
+	sync.Mutex
+	seats map[string]versus_held
+}{seats: map[string]versus_held{}}
+
+// A versus_held seat is player's in m. registered is set if the player
+// was logged in to the nickname, so only its owner can resume.
+type versus_held struct {
+	m          *versus_match
+	player     int
+	registered bool
+}
+
+// versus_play seats sess in a match of the named game, against the
+// computer if ai is set, and relays its input until the match is over.
+// run is the game itself; it is started, in its own goroutine, once both
+// seats are filled.
+func versus_play(sess *session, name string, ai bool, run func(*versus_match)) (string, error) {
+	seat := &versus_seat{sess: sess, matched: make(chan *versus_match, 1)}
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	var m *versus_match
+	if ai {
+		m = new_versus_match(name, seat, nil, run)
+	} else {
+		var err error
+		if m, err = versus_matchmake(seat, name, lines, run); m == nil {
+			return "No game.\n", err
+		}
+	}
+
+	return seat.relay(m, lines)
+}
+
+func versus_matchmake(seat *versus_seat, name string, lines <-chan string, run func(*versus_match)) (*versus_match, error) {
+	versus_lobby.Lock()
+	if other := versus_lobby.waiting[name]; other != nil {
+		delete(versus_lobby.waiting, name)
+		versus_lobby.Unlock()
+
+		m := new_versus_match(name, other, seat, run)
+		other.matched <- m
+		return m, nil
+	}
+	versus_lobby.waiting[name] = seat
+	versus_lobby.Unlock()
+
+	seat.sess.send("Waiting for an opponent... Type 'ai' to play the computer instead, or 'q' to give up.\n")
+	notify_all(fmt.Sprintf("%s is waiting for someone to play %s with.", player_name(seat.sess, "Someone"), name), seat.sess)
+
+	// leave takes us out of the lobby, unless we were matched in the
+	// meantime, in which case that match has to be played.
+	leave := func() *versus_match {
+		versus_lobby.Lock()
+		defer versus_lobby.Unlock()
+		if versus_lobby.waiting[name] == seat {
+			delete(versus_lobby.waiting, name)
+			return nil
+		}
+		return <-seat.matched
+	}
+
+	for {
+		select {
+		case m := <-seat.matched:
+			return m, nil
+		case line, ok := <-lines:
+			if !ok {
+				if m := leave(); m != nil {
+					return m, nil
+				}
+				return nil, io.EOF
+			}
+
+			if line != "q" && line != "ai" {
+				continue
+			}
+			if m := leave(); m != nil {
+				return m, nil
+			}
+			if line == "ai" {
+				return new_versus_match(name, seat, nil, run), nil
+			}
+			return nil, nil
+		}
+	}
+}
+
+func new_versus_match(name string, first, second *versus_seat, run func(*versus_match)) *versus_match {
+	var other *session
+	if second != nil {
+		other = second.sess
+	}
+
+	m := &versus_match{
+		name:    name,
+		play:    run,
+		seats:   [2]*versus_seat{first, second},
+		live:    merge_live(first.sess, other),
+		events:  make(chan versus_event),
+		done:    make(chan struct{}),
+		rejoins: make(chan versus_rejoin),
+	}
+	m.start()
+	return m
+}
+
+// start runs the game in a new match goroutine. When it returns the match
+// is over, unless it's exiting for a freeze.
+func (m *versus_match) start() {
+	m.froze = false
+	m.exited = make(chan struct{})
+	exited := m.exited
+
+	go func() {
+		defer close(exited)
+		defer func() {
+			if !m.froze {
+				m.cleanup()
+				close(m.done)
+			}
+		}()
+		m.play(m)
+	}()
+}
+
+// attach makes g the game saved if the match freezes. If the match is
+// starting again after a freeze, g is restored first; attach returns
+// false if that fails, and the match is over.
+func (m *versus_match) attach(g versus_game) bool {
+	m.game = g
+	if m.saved == nil {
+		return true
+	}
+
+	data := m.saved
+	m.saved = nil
+	if err := g.restore(data); err != nil {
+		log.Printf("versus: can't restore %s: %v", m.name, err)
+		m.end("That game couldn't be picked up again.\n", "That game couldn't be picked up again.\n")
+		return false
+	}
+	return true
+}
+
+// freeze saves the game and exits the match goroutine if every player is
+// away. It comes back only if the game can't be saved.
+func (m *versus_match) freeze() {
+	if m.game == nil {
+		return
+	}
+	var last time.Time
+	for p := range 2 {
+		if m.ai(p) {
+			continue
+		}
+		if m.away[p] == nil {
+			return
+		}
+		if ends := m.away[p].ends; ends.After(last) {
+			last = ends
+		}
+	}
+	if last.IsZero() {
+		return
+	}
+
+	data, err := m.game.save()
+	if err != nil {
+		log.Printf("versus: can't save %s: %v", m.name, err)
+		return
+	}
+	m.saved = data
+	for p := range 2 {
+		m.carried[p] = m.clocks[p].paused
+		if a := m.away[p]; a != nil {
+			a.timer.Stop()
+		}
+	}
+
+	m.froze = true
+	m.mu.Lock()
+	m.frozen = true
+	m.expiry = time.AfterFunc(time.Until(last), m.drop)
+	m.mu.Unlock()
+	runtime.Goexit()
+}
+
+// thaw starts a frozen match again for the player resuming in r, with the
+// grace periods of anyone still away carrying on where they were. It
+// returns false if the match wasn't frozen, in which case r still has to
+// be sent.
+func (m *versus_match) thaw(r versus_rejoin) bool {
+	if !m.unfreeze() {
+		return false
+	}
+	for p := range 2 {
+		if a := m.away[p]; a != nil {
+			a.timer = time.NewTimer(time.Until(a.ends))
+		}
+	}
+	m.thawed = &r
+	m.start()
+	return true
+}
+
+// drop ends a match that stayed frozen until every grace period ran out.
+func (m *versus_match) drop() {
+	if !m.unfreeze() {
+		return
+	}
+	m.cleanup()
+	close(m.done)
+}
+
+// unfreeze takes the match out of the frozen state for whichever of thaw
+// and drop gets there first, once its old goroutine has finished exiting.
+// Whoever it returns true to owns the match from then on.
+func (m *versus_match) unfreeze() bool {
+	m.mu.Lock()
+	if !m.frozen {
+		m.mu.Unlock()
+		return false
+	}
+	m.frozen = false
+	m.expiry.Stop()
+	exited := m.exited
+	m.mu.Unlock()
+
+	<-exited
+	return true
+}
+
+func (seat *versus_seat) relay(m *versus_match, lines <-chan string) (string, error) {
+	player := 0
+	if m.seats[1] == seat {
+		player = 1
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				m.post(versus_event{player: player, gone: true})
+				<-m.done
+				return "", io.EOF
+			}
+			m.post(versus_event{player: player, line: line})
+		case <-m.done:
+			return m.result[player], nil
+		}
+	}
+}
+
+// post delivers an event unless the match has already finished.
+func (m *versus_match) post(ev versus_event) {
+	select {
+	case m.events <- ev:
+	case <-m.done:
+	}
+}
+
+// next waits for the next thing the game has to deal with: a line from
+// either player, one of them leaving, or a turn clock running out. Clock
+// warnings, disconnects within the grace period and players resuming are
+// all handled on the way.
+func (m *versus_match) next() versus_event {
+	for {
+		if r := m.thawed; r != nil {
+			m.thawed = nil
+			m.rejoin(*r)
+		}
+		m.freeze()
+
+		select {
+		case ev := <-m.events:
+			if ev.gone && m.suspend(ev.player) {
+				continue
+			}
+			return ev
+		case <-timer_channel(m.clocks[0].timer):
+			if ev, ok := m.tick(0); ok {
+				return ev
+			}
+		case <-timer_channel(m.clocks[1].timer):
+			if ev, ok := m.tick(1); ok {
+				return ev
+			}
+		case <-m.absence_channel(0):
+			m.give_up(0)
+			return versus_event{player: 0, gone: true}
+		case <-m.absence_channel(1):
+			m.give_up(1)
+			return versus_event{player: 1, gone: true}
+		case r := <-m.rejoins:
+			m.rejoin(r)
+		}
+	}
+}
+
+// poll is next for games that only want input that has already been sent.
+// It returns false once there is none waiting.
+func (m *versus_match) poll() (versus_event, bool) {
+	for {
+		select {
+		case ev := <-m.events:
+			if ev.gone && m.suspend(ev.player) {
+				continue
+			}
+			return ev, true
+		default:
+			return versus_event{}, false
+		}
+	}
+}
+
+func timer_channel(t *time.Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.C
+}
+
+func (m *versus_match) absence_channel(p int) <-chan time.Time {
+	if m.away[p] == nil {
+		return nil
+	}
+	return m.away[p].timer.C
+}
+
+// start_clock gives player p d to make their move. Starting a clock that
+// is already running starts it over.
+func (m *versus_match) start_clock(p int, d time.Duration) {
+	m.stop_clock(p)
+	if m.ai(p) {
+		return
+	}
+	if m.carried[p] > 0 {
+		d = min(d, m.carried[p])
+		m.carried[p] = 0
+	}
+
+	c := &m.clocks[p]
+	c.ends = time.Now().Add(d)
+	c.warned = d <= versus_warning
+	if m.away[p] != nil {
+		c.paused = d
+		return
+	}
+	c.arm()
+}
+
+func (m *versus_match) stop_clock(p int) {
+	c := &m.clocks[p]
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	*c = versus_clock{}
+}
+
+// arm sets the timer for whichever of the warning and the end is next.
+func (c *versus_clock) arm() {
+	left := time.Until(c.ends)
+	if !c.warned {
+		left -= versus_warning
+	}
+	c.timer = time.NewTimer(left)
+}
+
+// tick handles player p's clock firing. It returns a timeout event once
+// their time is up.
+func (m *versus_match) tick(p int) (versus_event, bool) {
+	c := &m.clocks[p]
+	if !c.warned {
+		c.warned = true
+		c.arm()
+		m.send(p, fmt.Sprintf("\n%s left to move!\n> ", versus_warning.Round(time.Second)))
+		return versus_event{}, false
+	}
+
+	m.stop_clock(p)
+	return versus_event{player: p, timeout: true}, true
+}
+
+// suspend holds player p's seat after they disconnect, if they can come
+// back for it: they need a nickname to say who they are, and nobody else
+// of that name can already be away.
+func (m *versus_match) suspend(p int) bool {
+	if m.ai(p) || m.seats[p].sess.nick == "" {
+		return false
+	}
+	sess := m.seats[p].sess
+	nick := sess.nick
+
+	versus_away.Lock()
+	_, taken := versus_away.seats[nick]
+	if !taken {
+		versus_away.seats[nick] = versus_held{m: m, player: p, registered: sess.registered}
+	}
+	versus_away.Unlock()
+	if taken {
+		return false
+	}
+
+	m.away[p] = &versus_absence{nick: nick, addr: remote_addr(sess.conn), ends: time.Now().Add(versus_grace), timer: time.NewTimer(versus_grace)}
+
+	if c := &m.clocks[p]; c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+		c.paused = time.Until(c.ends)
+	}
+
+	m.send(1-p, fmt.Sprintf("\nYour opponent disconnected; they have %.0f seconds to reconnect...\n> ", versus_grace.Seconds()))
+	return true
+}
+
+// give_up lets go of player p's seat once their grace period is over.
+func (m *versus_match) give_up(p int) {
+	m.release(p)
+	m.stop_clock(p)
+}
+
+// release takes player p out of versus_away.
+func (m *versus_match) release(p int) {
+	a := m.away[p]
+	if a == nil {
+		return
+	}
+	a.timer.Stop()
+	m.away[p] = nil
+
+	versus_away.Lock()
+	if held := versus_away.seats[a.nick]; held.m == m {
+		delete(versus_away.seats, a.nick)
+	}
+	versus_away.Unlock()
+}
+
+// rejoin seats a player who came back, with the time they had left on
+// their clock, or at least long enough to read the warning.
+func (m *versus_match) rejoin(r versus_rejoin) {
+	if why := m.refuse(r); why != "" {
+		r.reply <- why
+		return
+	}
+	m.release(r.player)
+	m.seats[r.player].sess = r.sess
+	r.reply <- ""
+
+	m.send(1-r.player, "\nYour opponent is back.\n> ")
+	if m.redraw != nil {
+		m.redraw(r.player)
+	}
+
+	if c := &m.clocks[r.player]; c.paused > 0 {
+		left := max(c.paused, versus_warning)
+		c.ends = time.Now().Add(left)
+		c.warned = left <= versus_warning
+		c.paused = 0
+		c.arm()
+	}
+}
+
+// refuse says why r can't have the seat it asks for, or "" if it can. The
+// opponent mustn't get it, to throw the game: not from the session
+// they're playing on, nor from a second connection from where they're
+// playing, unless the absent player was playing from there too, as
+// happens behind a proxy or a shared router.
+func (m *versus_match) refuse(r versus_rejoin) string {
+	a := m.away[r.player]
+	if a == nil {
+		return "That game can't be resumed any more.\n"
+	}
+
+	other := 1 - r.player
+	if m.ai(other) || m.away[other] != nil {
+		return ""
+	}
+	them := m.seats[other].sess
+	addr := remote_addr(r.sess.conn)
+	if them == r.sess || addr.IsValid() && addr == remote_addr(them.conn) && addr != a.addr {
+		return "You're playing the other side of that game.\n"
+	}
+	return ""
+}
+
+// cleanup stops every timer and gives up any seats still held once the
+// match is over.
+func (m *versus_match) cleanup() {
+	for p := range 2 {
+		m.release(p)
+		m.stop_clock(p)
+	}
+}
+
+// session returns player p's session, or nil for the computer.
+func (m *versus_match) session(p int) *session {
+	if m.seats[p] == nil {
+		return nil
+	}
+	return m.seats[p].sess
+}
+
+// ai reports whether player p is the computer.
+func (m *versus_match) ai(p int) bool {
+	return m.seats[p] == nil
+}
+
+// send writes to one player. Only the match goroutine calls it, so writes
+// never interleave; the deadline stops one stuck client holding up the
+// game for both.
+func (m *versus_match) send(p int, s string) {
+	seat := m.seats[p]
+	if seat == nil || m.away[p] != nil {
+		return
+	}
+
+	seat.sess.conn.SetWriteDeadline(time.Now().Add(versus_write_timeout))
+	seat.sess.send(s)
+	seat.sess.conn.SetWriteDeadline(time.Time{})
+}
+
+// end records the closing message for each player; the match finishes
+// when run returns.
+func (m *versus_match) end(first, second string) {
+	m.result = [2]string{first, second}
+}
+
+// versus_waiting names the game nick has a seat held in, if any.
+func versus_waiting(nick string) string {
+	versus_away.Lock()
+	defer versus_away.Unlock()
+
+	if held, ok := versus_away.seats[nick]; ok {
+		return held.m.name
+	}
+	return ""
+}
+
+// resume_command handles "resume", which takes back a seat held since the
+// connection dropped.
+func resume_command(sess *session, _ string) (string, error) {
+	if sess.nick == "" {
+		return "Set the nickname you were playing under with 'nick NAME' first.\n", nil
+	}
+
+	versus_away.Lock()
+	held, ok := versus_away.seats[sess.nick]
+	versus_away.Unlock()
+	if !ok {
+		return "You have no game to resume.\n", nil
+	}
+	if held.registered && !sess.registered {
+		return fmt.Sprintf("%s was logged in when they left; 'login %s PASSWORD' to resume.\n", sess.nick, sess.nick), nil
+	}
+	m := held.m
+
+	lines, stop := sess.lines()
+	defer stop()
+
+	// Only the first player's screen is mirrored to spectators.
+	if held.player == 0 && m.live != nil {
+		sess.live.Store(m.live)
+		defer sess.live.CompareAndSwap(m.live, nil)
+	}
+
+	sess.send(clearScreen)
+	defer sess.send(resetAttrs + showCursor)
+
+	reply := make(chan string, 1)
+	r := versus_rejoin{player: held.player, sess: sess, reply: reply}
+	if !m.thaw(r) {
+		select {
+		case m.rejoins <- r:
+		case <-m.done:
+			return "That game is already over.\n", nil
+		}
+	}
+	select {
+	case why := <-reply:
+		if why != "" {
+			return why, nil
+		}
+	case <-m.done:
+		return "That game is already over.\n", nil
+	}
+
+	return m.seats[held.player].relay(m, lines)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipe_session is a session along with the client's end of its
+// connection, whose output is thrown away.
+func pipe_session(t *testing.T, nick string) (*session, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go io.Copy(io.Discard, client)
+
+	sess := new_session(server)
+	sess.nick = nick
+	return sess, client
+}
+
+// counter_game counts "inc" lines until someone says "end".
+type counter_game struct {
+	m *versus_match
+	n int
+}
+
+func (g *counter_game) save() ([]byte, error) { return json.Marshal(g.n) }
+
+func (g *counter_game) restore(data []byte) error { return json.Unmarshal(data, &g.n) }
+
+func (g *counter_game) run() {
+	for {
+		ev := g.m.next()
+		switch {
+		case ev.gone:
+			g.m.end("gone\n", "gone\n")
+			return
+		case ev.line == "inc":
+			g.n++
+		case ev.line == "end":
+			msg := fmt.Sprintf("counted %d\n", g.n)
+			g.m.end(msg, msg)
+			return
+		}
+	}
+}
+
+func frozen(m *versus_match) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.frozen
+}
+
+func TestVersusFreezeAndResume(t *testing.T) {
+	ann, _ := pipe_session(t, "freeze-ann")
+	bob, _ := pipe_session(t, "freeze-bob")
+
+	m := new_versus_match("counter", &versus_seat{sess: ann}, &versus_seat{sess: bob}, func(m *versus_match) {
+		g := &counter_game{m: m}
+		if m.attach(g) {
+			g.run()
+		}
+	})
+	m.post(versus_event{player: 0, line: "inc"})
+	m.post(versus_event{player: 1, line: "inc"})
+	m.post(versus_event{player: 0, gone: true})
+	m.post(versus_event{player: 1, gone: true})
+
+	for deadline := time.Now().Add(time.Second); !frozen(m); {
+		if time.Now().After(deadline) {
+			t.Fatal("the match didn't freeze with both players away")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := versus_waiting("freeze-ann"); got != "counter" {
+		t.Fatalf("ann's seat is held in %q", got)
+	}
+
+	back, client := pipe_session(t, "freeze-ann")
+	go io.WriteString(client, "inc\nend\n")
+	got, err := resume_command(back, "resume")
+	if err != nil || got != "counted 3\n" {
+		t.Errorf("resumed game ended with %q, %v; want it to count on from 2", got, err)
+	}
+
+	<-m.done
+	if versus_waiting("freeze-bob") != "" {
+		t.Error("bob's seat is still held after the game ended")
+	}
+}
+
+// session_from is a session on a real connection from ip, one of the
+// loopback addresses.
+func session_from(t *testing.T, ip, nick string) *session {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	d := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	client, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go io.Copy(io.Discard, client)
+
+	sess := new_session(server)
+	sess.nick = nick
+	return sess
+}
+
+func TestResumeNotByOpponent(t *testing.T) {
+	ann := session_from(t, "127.0.0.2", "refuse-ann")
+	ann.registered = true
+	bob := session_from(t, "127.0.0.1", "refuse-bob")
+
+	m := new_versus_match("counter", &versus_seat{sess: ann}, &versus_seat{sess: bob}, func(m *versus_match) {
+		g := &counter_game{m: m}
+		if m.attach(g) {
+			g.run()
+		}
+	})
+	defer m.post(versus_event{player: 1, line: "end"})
+	m.post(versus_event{player: 0, gone: true})
+	for versus_waiting("refuse-ann") == "" {
+		time.Sleep(time.Millisecond)
+	}
+
+	guest := session_from(t, "127.0.0.2", "refuse-ann")
+	if got, _ := resume_command(guest, "resume"); !strings.Contains(got, "login refuse-ann") {
+		t.Errorf("a guest resuming a registered player's seat got %q", got)
+	}
+
+	for _, sess := range []*session{bob, session_from(t, "127.0.0.1", "refuse-ann")} {
+		sess.nick, sess.registered = "refuse-ann", true
+		if got, _ := resume_command(sess, "resume"); !strings.Contains(got, "other side") {
+			t.Errorf("the opponent resuming got %q", got)
+		}
+	}
+	if versus_waiting("refuse-ann") == "" {
+		t.Error("the seat was given up")
+	}
+}
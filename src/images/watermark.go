@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/atalii/image-server-thing/internal/usertext"
+)
+
+const (
+	watermark_max   = 80
+	watermark_style = "\033[1;97;40m"
+)
+
+// watermark_command handles "watermark TEXT" and "watermark off".
+func watermark_command(sess *session, line string) string {
+	text := strings.TrimSpace(strings.TrimPrefix(line, "watermark"))
+
+	switch text {
+	case "":
+		if sess.watermark == "" {
+			return "No watermark set. Use 'watermark TEXT' to add one.\n"
+		}
+		return fmt.Sprintf("Watermark: %s\n", sess.watermark)
+	case "off":
+		sess.watermark = ""
+		return "Watermark cleared.\n"
+	}
+
+	sess.watermark = clean_watermark(text)
+	return fmt.Sprintf("Watermark set: %s\n", sess.watermark)
+}
+
+// clean_watermark keeps the text safe to print, up to watermark_max
+// columns of it; anything else could smuggle escape sequences into the
+// render.
+func clean_watermark(text string) string {
+	return usertext.Truncate(usertext.Clean(text), watermark_max)
+}
+
+// draw_watermark overwrites the bottom-left cells of a render with text.
+// Text wider than the render wraps onto the row above; anything that still
+// doesn't fit in the last two rows is cut off.
+func draw_watermark(rows [][]string, text string) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return
+	}
+	width := len(rows[0])
+
+	// A wide character takes two cells, the second of them empty, and
+	// isn't split across rows.
+	var lines [][]string
+	for cells := usertext.Cells(text); len(cells) > 0 && len(lines) < 2; {
+		n := min(width, len(cells))
+		if n < len(cells) && cells[n] == "" && n > 1 {
+			n--
+		}
+		lines = append(lines, cells[:n])
+		cells = cells[n:]
+	}
+
+	start := max(len(rows)-len(lines), 0)
+	for i, l := range lines[:len(rows)-start] {
+		for x, c := range l {
+			if c != "" {
+				c = watermark_style + c + "\033[0m"
+			}
+			rows[start+i][x] = c
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/net/websocket"
+)
+
+var (
+	wsPort    = flag.Int("ws-port", 0, "also take WebSocket connections over HTTP on this port, for clients in browsers, which can't open plain TCP; 0 is off")
+	wsOrigins = flag.String("ws-origins", "", "comma-separated origins, like https://example.com, whose pages may open WebSockets besides pages served from the server's own host")
+)
+
+var errBinaryFrame = errors.New("websocket: binary frame")
+
+// ws_text reads text frames whole, and refuses binary ones.
+var ws_text = websocket.Codec{
+	Unmarshal: func(data []byte, kind byte, v any) error {
+		if kind != websocket.TextFrame {
+			return errBinaryFrame
+		}
+		*v.(*[]byte) = data
+		return nil
+	},
+}
+
+// A ws_conn passes a WebSocket off as the TCP connection handleConn
+// expects. Each text frame that comes in is a line, whether or not it
+// ends in a newline. Output goes out as text frames, which have to be
+// whole UTF-8, so a character that a write ends partway through is held
+// back for the next.
+type ws_conn struct {
+	*websocket.Conn
+	remote net.Addr
+
+	// in is what's left of the last frame read.
+	in []byte
+
+	mu   sync.Mutex
+	held []byte
+}
+
+func (c *ws_conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// char_mode does nothing: telnet bytes aren't UTF-8, and a browser drops
+// the connection over a text frame with them in. A page sends keys as it
+// likes.
+func (c *ws_conn) char_mode(bool) {}
+
+func (c *ws_conn) Read(p []byte) (int, error) {
+	for len(c.in) == 0 {
+		var frame []byte
+		err := ws_text.Receive(c.Conn, &frame)
+		if errors.Is(err, errBinaryFrame) {
+			send(c, "Binary frames aren't understood here; send text.\n")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.HasSuffix(frame, []byte("\n")) {
+			frame = append(frame, '\n')
+		}
+		c.in = frame
+	}
+
+	n := copy(p, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+func (c *ws_conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := append(c.held, p...)
+	end := len(out)
+	for i := len(out) - 1; i >= max(len(out)-utf8.UTFMax, 0); i-- {
+		if utf8.RuneStart(out[i]) {
+			if !utf8.FullRune(out[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	c.held = bytes.Clone(out[end:])
+
+	if end > 0 {
+		if _, err := c.Conn.Write(out[:end]); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// ws_handshake turns banned addresses away before the upgrade, and pages
+// from other sites, which would otherwise be able to use the server as
+// whoever has them open. Clients that aren't browsers send no origin and
+// may connect, as anyone may over TCP.
+func ws_handshake(config *websocket.Config, r *http.Request) error {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err == nil && banned(ap.Addr().Unmap()) {
+		return errors.New("banned")
+	}
+
+	config.Origin, err = websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if config.Origin != nil && !ws_origin_ok(config.Origin, r.Host) {
+		return fmt.Errorf("origin %s not allowed", config.Origin)
+	}
+	return nil
+}
+
+// ws_origin_ok reports whether a page from origin may connect to host: it
+// has to be from host itself, or one of -ws-origins.
+func ws_origin_ok(origin *url.URL, host string) bool {
+	if strings.EqualFold(origin.Host, host) {
+		return true
+	}
+	for _, allowed := range strings.Split(*wsOrigins, ",") {
+		allowed = strings.TrimSuffix(strings.TrimSpace(allowed), "/")
+		if allowed != "" && strings.EqualFold(allowed, origin.Scheme+"://"+origin.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// serve_ws listens for WebSocket connections on -ws-port, and hands
+// them to handleConn as if they'd come in over TCP.
+func serve_ws() {
+	srv := websocket.Server{
+		Handshake: ws_handshake,
+		Handler: func(ws *websocket.Conn) {
+			remote, err := net.ResolveTCPAddr("tcp", ws.Request().RemoteAddr)
+			if err != nil {
+				log.Printf("ws: %v", err)
+				return
+			}
+			handleConn(&ws_conn{Conn: ws, remote: remote})
+		},
+	}
+
+	addr := fmt.Sprintf(":%d", *wsPort)
+	log.Printf("Binding WebSockets: 0.0.0.0%s", addr)
+	log.Fatalf("ws: %v", http.ListenAndServe(addr, srv))
+}
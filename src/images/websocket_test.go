@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestWSOriginOK(t *testing.T) {
+	defer func(old string) { *wsOrigins = old }(*wsOrigins)
+	*wsOrigins = "https://friends.example, http://localhost:3000/"
+
+	tests := []struct {
+		origin, host string
+		ok           bool
+	}{
+		{"http://images.example:8080", "images.example:8080", true},
+		{"https://IMAGES.example:8080", "images.example:8080", true},
+		{"https://evil.example", "images.example:8080", false},
+		{"http://images.example", "images.example:8080", false},
+		{"https://friends.example", "images.example:8080", true},
+		{"http://friends.example", "images.example:8080", false},
+		{"http://localhost:3000", "127.0.0.1:8080", true},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ws_origin_ok(u, tt.host); got != tt.ok {
+			t.Errorf("ws_origin_ok(%s, %s) = %v, want %v", tt.origin, tt.host, got, tt.ok)
+		}
+	}
+}
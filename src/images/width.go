@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// The render width a session may ask for. Wide renders cost CPU, so
+// operators can tighten these; requests outside them are clamped rather
+// than refused.
+var (
+	minWidth = flag.Int("min-width", 20, "narrowest render width a client may set")
+	maxWidth = flag.Int("max-width", 300, "widest render width a client may set")
+)
+
+// With adaptive width on, renders are kept to this many rows: a tall
+// image is drawn narrower, rather than taking screen after screen.
+const adaptive_max_rows = 60
+
+func clamp_width(n int) int {
+	return min(max(n, *minWidth), *maxWidth)
+}
+
+func width_limits() string {
+	return fmt.Sprintf("(server limits: %d–%d columns)", *minWidth, *maxWidth)
+}
+
+// width_command handles "width N".
+func width_command(sess *session, line string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "width")))
+	if err != nil {
+		return fmt.Sprintf("Usage: width N %s, currently %d.\n", width_limits(), sess.width)
+	}
+
+	sess.width = clamp_width(n)
+	return fmt.Sprintf("Width set to %d %s.\n", sess.width, width_limits())
+}
+
+// render_width is how many columns img is drawn across: the session's
+// width, or the image's own if that's narrower. With adaptive width, it's
+// also narrowed as far as it takes to fit the height in adaptive_max_rows,
+// keeping the aspect ratio; cells being sess.aspect times as tall as
+// they're wide is why each row covers that many columns' worth of
+// pixels. A size fixed with 'resize' isn't narrowed.
+func render_width(img image.Image, sess *session) int {
+	w := min(img.Bounds().Dx(), sess.width)
+	if !sess.adaptive_width || sess.height > 0 || img.Bounds().Dy() == 0 {
+		return w
+	}
+
+	fit := int(adaptive_max_rows * sess.aspect * float64(img.Bounds().Dx()) / float64(img.Bounds().Dy()))
+	return max(min(w, fit), 1)
+}
+
+// adaptive_width_command handles "adaptive-width", which turns adaptive
+// width on and off.
+func adaptive_width_command(sess *session, _ string) string {
+	sess.adaptive_width = !sess.adaptive_width
+	if sess.adaptive_width {
+		return fmt.Sprintf("Adaptive width on: tall images are drawn narrower, to fit in %d rows.\n", adaptive_max_rows)
+	}
+	return fmt.Sprintf("Adaptive width off: images are drawn %d columns wide.\n", sess.width)
+}
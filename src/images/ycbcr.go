@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// apply_ycbcr_split keeps one side of every pixel's YCbCr: its luminance,
+// with the chroma made neutral, for "luminance", or its chroma at
+// middling luminance for "chrominance".
+func apply_ycbcr_split(img image.Image, keep string) image.Image {
+	out := to_nrgba(img)
+
+	for i := 0; i < len(out.Pix); i += 4 {
+		px := out.Pix[i : i+3]
+		y, cb, cr := color.RGBToYCbCr(px[0], px[1], px[2])
+		if keep == "luminance" {
+			cb, cr = 128, 128
+		} else {
+			y = 128
+		}
+		px[0], px[1], px[2] = color.YCbCrToRGB(y, cb, cr)
+	}
+	return out
+}
+
+// ycbcr_command handles "luminance-only" and "chrominance-only", each of
+// which turns drawing only that side of the image on and off, in color.
+func ycbcr_command(keep string) func(*session, string) string {
+	return func(sess *session, _ string) string {
+		if sess.ycbcr_only == keep {
+			sess.ycbcr_only = ""
+			return "Showing luminance and chrominance both again.\n"
+		}
+		sess.ycbcr_only = keep
+		note := ""
+		if sess.mode == "bw" {
+			note = " It only shows in color; 'color' switches to it."
+		}
+		if keep == "luminance" {
+			return "Luminance only: images are drawn in the grays of their Y channel." + note + "\n"
+		}
+		return "Chrominance only: images are drawn in their Cb and Cr channels at middling luminance." + note + "\n"
+	}
+}
+
+func ycbcr_status(sess *session) string {
+	if sess.ycbcr_only == "" {
+		return "both"
+	}
+	return sess.ycbcr_only + " only"
+}